@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"config-validator/pkg/config"
+	"config-validator/pkg/server"
+)
+
+// runAdmission implements `config-validator admission`: a Kubernetes validating
+// admission webhook that rejects annotated ConfigMaps/Secrets with invalid payloads.
+func runAdmission(args []string) {
+	fs := flag.NewFlagSet("admission", flag.ExitOnError)
+	listen := fs.String("listen", ":8443", "Address to serve the webhook on")
+	certFile := fs.String("tls-cert", "", "TLS certificate (the API server only calls webhooks over HTTPS)")
+	keyFile := fs.String("tls-key", "", "TLS private key")
+	rulesFile := fs.String("rules", defaultRules, "Rules used for cisco-config payloads (file, https:// URL, oci:// reference, or builtin)")
+	rulesKey := rulesKeyFlag(fs)
+	sandboxed := fs.Bool("sandboxed", false, "Only run WASM rule checks, refusing Starlark scripts")
+	watch := fs.Duration("watch", 2*time.Second, "How often to check the rules files for changes (0 disables hot reload)")
+	guard := addGuardFlags(fs)
+	queueing := addQueueFlags(fs)
+	fs.Parse(args)
+
+	rules := mustReloader(*rulesFile, *rulesKey, config.Options{Sandboxed: *sandboxed})
+	if *watch > 0 {
+		go rules.Watch(context.Background(), *watch)
+	}
+
+	requests := queueing.queue()
+	mux := http.NewServeMux()
+	mux.Handle("POST /validate", &server.AdmissionHandler{Rules: rules})
+	mux.Handle("POST /-/reload", server.ReloadHandler(rules))
+	mux.Handle("GET /metrics", server.MetricsHandler(rules, requests))
+	mux.Handle("GET /openapi.yaml", server.OpenAPIHandler(false))
+	mux.Handle("GET /openapi.json", server.OpenAPIHandler(true))
+	mux.Handle("GET /healthz", server.HealthHandler())
+	mux.Handle("GET /readyz", server.ReadyHandler(rules))
+	mux.Handle("GET /buildinfo", server.BuildInfoHandler(rules))
+
+	handler, tlsConfig := guard.wrap(requests.Wrap(mux), *listen, *certFile != "")
+	srv := &http.Server{Addr: *listen, Handler: handler, TLSConfig: tlsConfig}
+
+	log.Println("🛡️  Admission webhook listening on", *listen)
+	var err error
+	if *certFile != "" {
+		err = srv.ListenAndServeTLS(*certFile, *keyFile)
+	} else {
+		log.Println("⚠️  No -tls-cert given, serving plain HTTP (only useful behind a TLS-terminating proxy)")
+		err = srv.ListenAndServe()
+	}
+	log.Fatal("❌ Admission webhook failed:", err)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"time"
+
+	"config-validator/pkg/archive"
+	"config-validator/pkg/automata"
+	"config-validator/pkg/config"
+	"config-validator/pkg/hook"
+	"config-validator/pkg/progress"
+	"config-validator/pkg/seal"
+	"config-validator/pkg/store"
+	"config-validator/pkg/telemetry"
+	"config-validator/pkg/validation"
+)
+
+// validateArchive validates every file in a zip or tar archive that matches the config
+// or JSON globs, or that a plugin claims, reading the files in memory. The archive's
+// own ignore files skip entries and drop findings, as in a repository. bar, when
+// set, counts the entries as they are validated.
+func validateArchive(ctx context.Context, inputFile, rulesFile string, opts config.Options, pluginDir string, configGlobs, jsonGlobs []string, bar *progress.Reporter) *validation.ArchiveReport {
+	rs, err := config.LoadRuleSet(rulesFile, opts)
+	if err != nil {
+		log.Fatal("❌ Error loading rules:", err)
+	}
+	plugins := loadPlugins(pluginDir)
+	ignores, err := archiveIgnores(inputFile)
+	if err != nil {
+		log.Fatal("❌ Error validating archive:", err)
+	}
+	all := append(append([]string{}, configGlobs...), jsonGlobs...)
+	match := func(name string) bool { return hook.Match(name, all) || !plugins.Empty() }
+
+	var entries []validation.EntryResult
+	err = archive.Walk(inputFile, match, func(e archive.Entry) error {
+		ctx, span := telemetry.Start(ctx, "archive.entry")
+		span.SetAttr("validator.input", e.Name)
+		defer span.End()
+		name := path.Clean(e.Name)
+		if ignores.Ignored(name) {
+			return nil
+		}
+		var findings []automata.Finding
+		var kind, encoding string
+		if v := plugins.Detect(e.Name, e.Content); v != nil {
+			kind = v.Name()
+			var err error
+			if findings, err = v.Validate(e.Name, e.Content); err != nil {
+				return fmt.Errorf("plugin %s failed on %s: %v", v.Name(), e.Name, err)
+			}
+		} else if !hook.Match(e.Name, all) {
+			return nil
+		} else if hook.Match(e.Name, configGlobs) {
+			kind = "config"
+			fsm, err := rs.ParseContext(ctx, bytes.NewReader(e.Content))
+			if err != nil {
+				return fmt.Errorf("%s: %v", e.Name, err)
+			}
+			findings, encoding = fsm.Findings, fsm.Encoding
+		} else {
+			kind = "json"
+			findings = validation.CheckJSON(e.Content)
+		}
+		entry := validation.NewEntryResult(e.Name, kind, ignores.Filter(name, findings))
+		entry.Encoding = encoding
+		entry.SHA256 = store.HashBytes(e.Content)
+		entries = append(entries, entry)
+		bar.Done(len(findings))
+		return nil
+	})
+	if err != nil {
+		log.Fatal("❌ Error validating archive:", err)
+	}
+	return validation.NewArchiveReport(inputFile, entries)
+}
+
+// filterArchiveReport applies the findings filter to every entry. MaxFindings is left
+// to printArchiveReport.
+func filterArchiveReport(report *validation.ArchiveReport, filter *validation.Filter) *validation.ArchiveReport {
+	return rebuildArchiveReport(report, func(e validation.EntryResult) []automata.Finding {
+		return filter.Apply(e.Findings)
+	})
+}
+
+// rebuildArchiveReport scores every entry again with the findings keep returns for
+// it, in entry order, and tallies the report again.
+func rebuildArchiveReport(report *validation.ArchiveReport, keep func(validation.EntryResult) []automata.Finding) *validation.ArchiveReport {
+	entries := make([]validation.EntryResult, len(report.Entries))
+	for i, e := range report.Entries {
+		entries[i] = validation.NewEntryResult(e.Name, e.Kind, keep(e))
+		entries[i].Encoding, entries[i].SHA256 = e.Encoding, e.SHA256
+	}
+	return validation.NewArchiveReport(report.Archive, entries)
+}
+
+// archiveRuns builds one store entry per archive entry, named archive:entry.
+func archiveRuns(source, rulesFile string, started time.Time, report *validation.ArchiveReport) []*store.Run {
+	var runs []*store.Run
+	for _, e := range report.Entries {
+		run := fileRun(source+":"+e.Name, "", rulesFile, started, e.Findings)
+		run.InputHash = e.SHA256
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// printArchiveReport prints a line per entry (none with -q), or workflow annotations, and exits with
+// status 1 in github format when any entry is invalid. The csv and xlsx formats also
+// export the findings of every entry, named archive:entry, sealed with sealer. Only the
+// first limit findings of the archive are printed or exported (all when 0).
+func printArchiveReport(report *validation.ArchiveReport, format, outputFile string, sealer *seal.Sealer, limit int, level verbosity) {
+	files := make([]validation.FileFindings, len(report.Entries))
+	for i, e := range report.Entries {
+		files[i] = validation.FileFindings{File: e.Name, Findings: e.Findings}
+	}
+	if format == "github" {
+		for _, file := range validation.LimitFiles(files, limit) {
+			validation.WriteGitHubAnnotations(os.Stdout, file.File, file.Findings)
+		}
+		if report.Failed > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+	if _, ok := exportFormats[format]; ok {
+		exported := validation.LimitFiles(files, limit)
+		for i := range exported {
+			exported[i].File = report.Archive + ":" + exported[i].File
+		}
+		exportFile := exportPath(outputFile, format)
+		if err := writeExport(sealer, exportFile, format, exported...); err != nil {
+			log.Fatal("❌ Error exporting findings:", err)
+		}
+		if level > quietOutput {
+			fmt.Println("📊 Findings exported to", exportFile)
+		}
+	}
+	if format == "text" {
+		validation.WriteConsole(os.Stdout, files, validation.ConsoleOptions{
+			Color: validation.UseColor(os.Stdout),
+			Summary: fmt.Sprintf("%d/%d files passed, score %d (%s), report written to %s",
+				report.Passed, report.Total, report.Score, report.Grade, outputFile),
+			SummaryOnly: level == quietOutput,
+			MaxFindings: limit,
+		})
+		return
+	}
+	if level > quietOutput {
+		for _, e := range report.Entries {
+			if e.Status == "success" {
+				fmt.Printf("✅ %s: valid\n", e.Name)
+			} else {
+				fmt.Printf("❌ %s: %d findings, score %d (%s)\n", e.Name, len(e.Errors), e.Score, e.Grade)
+			}
+		}
+	}
+	fmt.Printf("Archive validation complete: %d/%d files passed, score %d (%s). Report written to %s\n",
+		report.Passed, report.Total, report.Score, report.Grade, outputFile)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/baseline"
+	"config-validator/pkg/validation"
+)
+
+// baselineFlags are the flags that compare a run against a baseline of accepted
+// findings (see pkg/baseline), or record one.
+type baselineFlags struct {
+	path     *string
+	update   *bool
+	resolved *bool
+}
+
+func addBaselineFlags(fs *flag.FlagSet) *baselineFlags {
+	return &baselineFlags{
+		path:     fs.String("baseline", "", "Findings file (JSON) to report only new findings against; recorded from this run when missing"),
+		update:   fs.Bool("update-baseline", false, "Record this run's findings in the -baseline file instead of comparing against it"),
+		resolved: fs.Bool("show-resolved", false, "Also list the findings of the -baseline file that no longer occur"),
+	}
+}
+
+// baselineRun compares the findings of a run against a baseline, or records them
+// when the baseline is missing or being updated. A nil *baselineRun does neither.
+type baselineRun struct {
+	path         string
+	compare      *baseline.Baseline // nil while recording
+	record       *baseline.Baseline // nil while comparing
+	showResolved bool
+	known        int      // findings left out because the baseline has them
+	resolved     []string // baseline findings that no longer occur, as file: finding
+}
+
+// open loads the baseline, or starts recording one. It returns nil without -baseline.
+func (f *baselineFlags) open() *baselineRun {
+	if *f.path == "" {
+		if *f.update {
+			log.Fatal("❌ -update-baseline needs -baseline")
+		}
+		return nil
+	}
+	r := &baselineRun{path: *f.path, showResolved: *f.resolved}
+	if *f.update {
+		r.record = baseline.New()
+		return r
+	}
+	b, err := baseline.Load(*f.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		r.record = baseline.New()
+	case err != nil:
+		log.Fatal("❌ Error loading baseline: ", err)
+	default:
+		r.compare = b
+	}
+	return r
+}
+
+// apply returns the findings of a file to report: those not in the baseline, or all
+// of them while recording.
+func (r *baselineRun) apply(file string, findings []automata.Finding) []automata.Finding {
+	if r == nil {
+		return findings
+	}
+	if r.record != nil {
+		r.record.Add(file, findings)
+		return findings
+	}
+	fresh, resolved := r.compare.Compare(file, findings)
+	r.known += len(findings) - len(fresh)
+	for _, e := range resolved {
+		r.resolved = append(r.resolved, file+": "+e.String())
+	}
+	return fresh
+}
+
+// applyFSM leaves the baseline's findings out of a validation run, and out of the
+// Errors entries rendered from them.
+func (r *baselineRun) applyFSM(file string, fsm *automata.FSM) {
+	if r == nil {
+		return
+	}
+	fsm.Findings = r.apply(file, fsm.Findings)
+	fsm.Errors = validation.FormatFindings(fsm.Findings)
+}
+
+// fleetBaseline is the baseline fleet.Run compares devices against, nil while recording.
+func (r *baselineRun) fleetBaseline() *baseline.Baseline {
+	if r == nil {
+		return nil
+	}
+	return r.compare
+}
+
+// addFleet records the findings of every device of a fleet run, by device name, or
+// takes in how fleet.Run compared them against the baseline.
+func (r *baselineRun) addFleet(results []validation.DeviceResult) {
+	if r == nil {
+		return
+	}
+	for _, result := range results {
+		if r.record != nil {
+			r.record.Add(result.Name, result.Findings)
+			continue
+		}
+		r.known += result.Baselined
+		for _, e := range result.Resolved {
+			r.resolved = append(r.resolved, result.Name+": "+e)
+		}
+	}
+}
+
+// finish writes a recorded baseline, or says how the run compared to the baseline.
+func (r *baselineRun) finish(level verbosity) {
+	if r == nil {
+		return
+	}
+	if r.record != nil {
+		if err := r.record.Write(r.path); err != nil {
+			log.Fatal("❌ Error writing baseline:", err)
+		}
+		if level > quietOutput {
+			fmt.Printf("📌 Baseline of %d findings written to %s\n", r.record.Len(), r.path)
+		}
+		return
+	}
+	if level == quietOutput {
+		return
+	}
+	fmt.Printf("📌 %d findings left out as in the baseline, %d baseline findings resolved\n", r.known, len(r.resolved))
+	if r.showResolved {
+		for _, e := range r.resolved {
+			fmt.Println("   resolved:", e)
+		}
+	}
+}
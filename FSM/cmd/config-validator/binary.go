@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/bincheck"
+	"config-validator/pkg/protocheck"
+)
+
+// runCBOR implements `config-validator cbor`: the payload must be well-formed CBOR.
+func runCBOR(args []string) {
+	runBinaryCheck("cbor", args, bincheck.CheckCBOR)
+}
+
+// runMsgPack implements `config-validator msgpack`: the payload must be well-formed
+// MessagePack.
+func runMsgPack(args []string) {
+	runBinaryCheck("msgpack", args, bincheck.CheckMsgPack)
+}
+
+// runBinaryCheck checks a binary payload with check. A well-formed payload can be
+// written out as JSON, and checked against a protobuf message the way JSON payloads
+// are by `config-validator proto`.
+func runBinaryCheck(kind string, args []string, check func(content []byte, sequence bool) ([]automata.Finding, []any)) {
+	d := newDocumentRun(kind)
+	sequence := d.fs.Bool("sequence", false, "The payload is a sequence of items rather than a single one")
+	jsonFile := d.fs.String("json", "", "Write the payload transcoded to JSON to this file (- for stdout)")
+	descriptorFile := d.fs.String("descriptors", "", "Descriptor set to check the payload against (with -message)")
+	messageName := d.fs.String("message", "", "Full name of the protobuf message the payload must be")
+	d.parse(args)
+	if (*descriptorFile == "") != (*messageName == "") {
+		log.Fatal("❌ -descriptors and -message must be given together")
+	}
+
+	content, err := os.ReadFile(*d.inputFile)
+	if err != nil {
+		log.Fatal("❌ Error reading file:", err)
+	}
+	findings, values := check(content, *sequence)
+	if values == nil {
+		d.finish(findings, nil) // not well-formed, so there is nothing to transcode
+		return
+	}
+
+	if *jsonFile != "" {
+		var out any = values[0]
+		if *sequence {
+			out = values
+		}
+		data, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			log.Fatal("❌ Error transcoding to JSON:", err)
+		}
+		if *jsonFile == "-" {
+			fmt.Println(string(data))
+			d.quiet = true
+		} else if err := os.WriteFile(*jsonFile, append(data, '\n'), 0644); err != nil {
+			log.Fatal("❌ Error writing JSON:", err)
+		}
+	}
+
+	if *messageName != "" {
+		descriptors, err := protocheck.LoadDescriptors(*descriptorFile)
+		if err != nil {
+			log.Fatal("❌ Error loading descriptors:", err)
+		}
+		message, err := descriptors.Message(*messageName)
+		if err != nil {
+			log.Fatal("❌ ", err)
+		}
+		for i, v := range values {
+			data, err := json.Marshal(v)
+			if err != nil {
+				log.Fatal("❌ Error transcoding to JSON:", err)
+			}
+			for _, f := range protocheck.Check(data, descriptors, message) {
+				f.Line = 0 // lines of the transcoded JSON mean nothing here; the path locates it
+				if *sequence {
+					f.Message = fmt.Sprintf("item %d: %s", i, f.Message)
+				}
+				findings = append(findings, f)
+			}
+		}
+		d.what = kind + " " + message.FullName
+	}
+	d.finish(findings, nil)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/capture"
+)
+
+// readConversations reassembles the TCP connections of a capture file's content,
+// with the sampling flags applied.
+func (d *documentRun) readConversations(content []byte) []*capture.Conversation {
+	convs, err := d.sampler.Conversations(bytes.NewReader(content))
+	if err != nil {
+		log.Fatal("❌ Error reading capture: ", err)
+	}
+	return convs
+}
+
+// streamFindings tags the findings about one side of a connection with its flow, and
+// warns when bytes missing from the capture fall within the part that was checked,
+// as the findings after them may be wrong. The findings go into the flow report, if
+// one was asked for, at layer, and the warning at the tcp layer.
+func (d *documentRun) streamFindings(flow capture.Flow, side, layer string, st capture.Stream, checked int, findings []automata.Finding) []automata.Finding {
+	var gap []automata.Finding
+	if len(st.Gaps) > 0 && st.Gaps[0] < checked {
+		gap = append(gap, automata.Finding{Severity: automata.SeverityWarning, Message: fmt.Sprintf(
+			"offset %d: %d bytes are missing from the capture; findings after this offset may be wrong", st.Gaps[0], st.Missing)})
+	}
+	if d.flows != nil {
+		d.flows.Add(flow, "tcp", sideFindings(side, gap))
+		d.flows.Add(flow, layer, sideFindings(side, findings))
+	}
+	findings = append(findings, gap...)
+	for i := range findings {
+		findings[i].Message = fmt.Sprintf("%s %s %s", flow, side, findings[i].Message)
+	}
+	return findings
+}
+
+// sideFindings returns copies of findings about a stream, saying which side sent it,
+// as the flow report lists them under the flow.
+func sideFindings(side string, findings []automata.Finding) []automata.Finding {
+	out := make([]automata.Finding, len(findings))
+	for i, f := range findings {
+		if f.Packet == 0 {
+			f.Message = side + " " + f.Message
+		}
+		out[i] = f
+	}
+	return out
+}
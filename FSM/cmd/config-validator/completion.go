@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// command is one subcommand, as typed after the binary name.
+type command struct {
+	path    string // e.g. "report history"; empty for the single-file validation run
+	summary string
+}
+
+// commands lists the subcommands main dispatches, for completion scripts and the
+// man page. Keep it in step with the switch in main.
+var commands = []command{
+	{"", "Validate a Cisco config file against the FSM rules"},
+	{"fetch", "Fetch a device's running config over SSH and validate it"},
+	{"validate-fleet", "Fetch and validate every device of an inventory concurrently"},
+	{"daemon", "Re-validate an inventory on a schedule and serve the results over a REST API"},
+	{"report history", "Past results of a file or device from the result store"},
+	{"report trends", "Fleet trends from the result store"},
+	{"report merge", "Combine report files into one summary by severity, rule, and file"},
+	{"report verify", "Check the signature of a saved report, and decrypt it"},
+	{"admission", "Kubernetes validating admission webhook for annotated ConfigMaps and Secrets"},
+	{"hook pre-commit", "Validate the staged files of a commit"},
+	{"hook pre-receive", "Validate the files of pushed commits"},
+	{"plugins list", "List the installed validator plugins"},
+	{"explain-line", "Show how the FSM treats one line of a config and which rules were tried"},
+	{"rules compile", "Compile a rules file into a bundle"},
+	{"rules lint", "Check a rule pack for mixed schemas and inconsistent deprecations"},
+	{"rules update", "Install and update rule packs from a registry, as pinned in rules.lock"},
+	{"rules rollback", "Switch rule packs back to the version they were updated from"},
+	{"yaml", "Check the structure of a YAML document"},
+	{"xml", "Check the tag nesting and syntax of an XML document"},
+	{"toml", "Check the tables, keys, and values of a TOML document"},
+	{"ini", "Check the sections and keys of an INI file"},
+	{"csv", "Check the quoting and fields of a CSV file, optionally against a schema"},
+	{"graphql", "Check the grammar, variables, and fragments of a GraphQL query document"},
+	{"proto", "Check a JSON payload against a protobuf message"},
+	{"cbor", "Check that a payload is well-formed CBOR"},
+	{"msgpack", "Check that a payload is well-formed MessagePack"},
+	{"jwt", "Check the structure, claims, and signatures of JWTs"},
+	{"http", "Check a captured HTTP message and validate its body"},
+	{"har", "Validate every entry of a HAR archive"},
+	{"proxy", "Forward HTTP traffic to an upstream, validating it on the fly"},
+	{"ssh", "Check the SSH version exchange and KEXINIT of captured connections"},
+	{"ics", "Check captured industrial protocol traffic, such as Modbus/TCP"},
+	{"netflow", "Check captured NetFlow v5, v9, and IPFIX export packets, templates, and sequence numbers"},
+	{"pop3", "Check POP3 sessions from a transcript or a capture against the protocol's states"},
+	{"imap", "Check IMAP sessions from a transcript or a capture: states, tags, and literals"},
+	{"rtsp", "Check captured RTSP connections, their CSeq sequencing, and SDP bodies"},
+	{"udp", "Check captured exchanges of simple UDP protocols: TFTP transfers and NTP requests"},
+	{"discovery", "Check captured LLDP and CDP advertisements"},
+	{"eapol", "Check captured 802.1X exchanges: EAPOL frames and the EAP state machine"},
+	{"session", "Run text protocol sessions through a state machine declared in YAML"},
+	{"version", "Print the build and the rules version"},
+	{"selftest", "Run the built-in samples through the validators with the rules in use"},
+	{"lsp", "Language server publishing findings as diagnostics while files are edited"},
+	{"completion", "Print a shell completion script (bash, zsh, fish, or powershell)"},
+	{"man", "Print the man page"},
+}
+
+// commandFlag is a flag of a subcommand, as the flag package prints it for -h.
+type commandFlag struct {
+	name  string
+	arg   string // the value placeholder; empty for boolean flags
+	usage string
+}
+
+// commandFlags returns the flags of every subcommand, keyed by path. They are read
+// from the -h output of this binary, so completions and the man page always match
+// the flags the commands define rather than a copy of them.
+func commandFlags() map[string][]commandFlag {
+	self, err := os.Executable()
+	if err != nil {
+		log.Fatal("❌ Error locating the binary:", err)
+	}
+	flags := map[string][]commandFlag{}
+	for _, c := range commands {
+		if c.path == "completion" || c.path == "man" {
+			continue
+		}
+		cmd := exec.Command(self, append(strings.Fields(c.path), "-h")...)
+		// Commands the help output runs through must not touch the user's store
+		cmd.Env = append(os.Environ(), "CONFIG_VALIDATOR_DB=")
+		out, _ := cmd.CombinedOutput()
+		flags[c.path] = parseFlagUsage(out)
+	}
+	return flags
+}
+
+// parseFlagUsage parses flag.PrintDefaults output:
+//
+//	-name type
+//	    	usage (default x)
+func parseFlagUsage(out []byte) []commandFlag {
+	var flags []commandFlag
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "  -"):
+			head, usage, _ := strings.Cut(line[3:], "\t")
+			name, arg, _ := strings.Cut(strings.TrimSpace(head), " ")
+			flags = append(flags, commandFlag{name: name, arg: arg, usage: usage})
+		case strings.HasPrefix(line, "    \t") && len(flags) > 0:
+			f := &flags[len(flags)-1]
+			f.usage = strings.TrimSpace(f.usage + " " + strings.TrimSpace(line))
+		}
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].name < flags[j].name })
+	return flags
+}
+
+// runCompletion implements `config-validator completion bash|zsh|fish|powershell`:
+// the completion script for the shell is printed, to be sourced or installed where
+// the shell looks for completions.
+func runCompletion(args []string) {
+	if len(args) != 1 {
+		log.Fatal("❌ usage: config-validator completion bash|zsh|fish|powershell")
+	}
+	var script string
+	switch args[0] {
+	case "bash":
+		script = bashCompletion(commandFlags())
+	case "zsh":
+		script = zshCompletion(commandFlags())
+	case "fish":
+		script = fishCompletion(commandFlags())
+	case "powershell":
+		script = powershellCompletion(commandFlags())
+	default:
+		log.Fatal("❌ Unknown shell: ", args[0])
+	}
+	fmt.Print(script)
+}
+
+// children returns the words that may follow parent ("" for the binary itself):
+// the next word of every subcommand under it.
+func children(parent string) []string {
+	var words []string
+	seen := map[string]bool{}
+	for _, c := range commands {
+		rest := c.path
+		if parent != "" {
+			if !strings.HasPrefix(c.path, parent+" ") {
+				continue
+			}
+			rest = strings.TrimPrefix(c.path, parent+" ")
+		}
+		word, _, _ := strings.Cut(rest, " ")
+		if word != "" && !seen[word] {
+			seen[word] = true
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// groups are the words that only lead to subcommands, such as report.
+func groups() []string {
+	var out []string
+	for _, c := range commands {
+		if parent, _, ok := strings.Cut(c.path, " "); ok && (len(out) == 0 || out[len(out)-1] != parent) {
+			out = append(out, parent)
+		}
+	}
+	return out
+}
+
+func summaryOf(path string) string {
+	for _, c := range commands {
+		if c.path == path {
+			return c.summary
+		}
+	}
+	return ""
+}
+
+func flagNames(flags []commandFlag, withArg bool) []string {
+	var names []string
+	for _, f := range flags {
+		if (f.arg != "") == withArg {
+			names = append(names, "-"+f.name)
+		}
+	}
+	return names
+}
+
+func bashCompletion(flags map[string][]commandFlag) string {
+	var b strings.Builder
+	b.WriteString(`# bash completion for config-validator
+# source <(config-validator completion bash)
+
+_config_validator() {
+    local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"
+    local path="" opts="" valued="" i
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        case "${COMP_WORDS[i]}" in
+            -*) break ;;
+        esac
+        path="${path:+$path }${COMP_WORDS[i]}"
+    done
+    case "$path" in
+`)
+	for _, c := range commands {
+		if c.path == "" {
+			continue
+		}
+		f := flags[c.path]
+		opts := strings.Join(flagNames(f, false), " ") + " " + strings.Join(flagNames(f, true), " ")
+		if c.path == "completion" {
+			opts = "bash zsh fish powershell"
+		}
+		fmt.Fprintf(&b, "        %q*) opts=%q; valued=%q ;;\n", c.path, strings.TrimSpace(opts), strings.Join(flagNames(f, true), " "))
+	}
+	for _, g := range groups() {
+		fmt.Fprintf(&b, "        %q) opts=%q ;;\n", g, strings.Join(children(g), " "))
+	}
+	top := flags[""]
+	fmt.Fprintf(&b, "        \"\") opts=%q; valued=%q ;;\n",
+		strings.Join(append(children(""), append(flagNames(top, false), flagNames(top, true)...)...), " "),
+		strings.Join(flagNames(top, true), " "))
+	b.WriteString(`        *) valued="" ;;
+    esac
+    if [[ $prev == -* && " $valued " == *" $prev "* ]]; then
+        COMPREPLY=($(compgen -f -- "$cur"))
+        return
+    fi
+    COMPREPLY=($(compgen -W "$opts" -- "$cur"))
+}
+
+complete -o default -F _config_validator config-validator
+`)
+	return b.String()
+}
+
+func zshCompletion(flags map[string][]commandFlag) string {
+	var b strings.Builder
+	b.WriteString(`#compdef config-validator
+# zsh completion for config-validator
+# config-validator completion zsh > "${fpath[1]}/_config-validator"
+
+_config_validator_flags() {
+    case "$1" in
+`)
+	for _, c := range commands {
+		f := flags[c.path]
+		if len(f) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "        %q) _arguments \\\n", c.path)
+		for _, fl := range f {
+			spec := fmt.Sprintf("-%s[%s]", fl.name, zshEscape(fl.usage))
+			if fl.arg != "" {
+				spec += ":" + fl.arg + ":_files"
+			}
+			fmt.Fprintf(&b, "            %s \\\n", shellQuote(spec))
+		}
+		b.WriteString("            '*:file:_files' ;;\n")
+	}
+	b.WriteString(`    esac
+}
+
+_config_validator() {
+    local path="" w
+    for w in "${words[@]:1:CURRENT-2}"; do
+        [[ $w == -* ]] && break
+        path="${path:+$path }$w"
+    done
+    case "$path" in
+`)
+	for _, g := range append([]string{""}, groups()...) {
+		var items []string
+		for _, word := range children(g) {
+			full := strings.TrimSpace(g + " " + word)
+			summary := summaryOf(full)
+			if summary == "" {
+				summary = "Subcommands of " + full
+			}
+			items = append(items, shellQuote(word+":"+zshEscape(summary)))
+		}
+		if g == "" {
+			fmt.Fprintf(&b, "        \"\")\n            if [[ $PREFIX != -* ]]; then\n                local -a cmds=(%s)\n                _describe command cmds\n            fi\n            _config_validator_flags \"\" ;;\n", strings.Join(items, " "))
+			continue
+		}
+		fmt.Fprintf(&b, "        %q)\n            local -a cmds=(%s)\n            _describe command cmds ;;\n", g, strings.Join(items, " "))
+	}
+	b.WriteString(`        completion) compadd bash zsh fish powershell ;;
+        *) _config_validator_flags "$path" ;;
+    esac
+}
+
+_config_validator "$@"
+`)
+	return b.String()
+}
+
+func fishCompletion(flags map[string][]commandFlag) string {
+	var b strings.Builder
+	b.WriteString(`# fish completion for config-validator
+# config-validator completion fish > ~/.config/fish/completions/config-validator.fish
+
+complete -c config-validator -f
+`)
+	// condition returns the fish condition under which path's words are complete
+	condition := func(path string) string {
+		if path == "" {
+			return "__fish_use_subcommand"
+		}
+		var parts []string
+		for _, word := range strings.Fields(path) {
+			parts = append(parts, "__fish_seen_subcommand_from "+word)
+		}
+		return strings.Join(parts, "; and ")
+	}
+	for _, g := range append([]string{""}, groups()...) {
+		for _, word := range children(g) {
+			summary := summaryOf(strings.TrimSpace(g + " " + word))
+			cond := condition(g)
+			if g != "" {
+				cond += "; and not __fish_seen_subcommand_from " + strings.Join(children(g), " ")
+			}
+			fmt.Fprintf(&b, "complete -c config-validator -n %s -a %s -d %s\n", shellQuote(cond), word, shellQuote(summary))
+		}
+	}
+	b.WriteString("complete -c config-validator -n " + shellQuote(condition("completion")) + " -a 'bash zsh fish powershell'\n")
+	for _, c := range commands {
+		for _, f := range flags[c.path] {
+			line := fmt.Sprintf("complete -c config-validator -n %s -o %s -d %s", shellQuote(condition(c.path)), f.name, shellQuote(f.usage))
+			if f.arg != "" {
+				line += " -r -F"
+			}
+			b.WriteString(line + "\n")
+		}
+	}
+	return b.String()
+}
+
+func powershellCompletion(flags map[string][]commandFlag) string {
+	var b strings.Builder
+	b.WriteString(`# powershell completion for config-validator
+# config-validator completion powershell | Out-String | Invoke-Expression
+
+Register-ArgumentCompleter -Native -CommandName config-validator -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $candidates = @{
+`)
+	for _, g := range append([]string{""}, groups()...) {
+		words := children(g)
+		if g == "" {
+			words = append(words, flagNames(flags[""], false)...)
+			words = append(words, flagNames(flags[""], true)...)
+		}
+		fmt.Fprintf(&b, "        %s = @(%s)\n", psQuote(g), psList(words))
+	}
+	for _, c := range commands {
+		if c.path == "" {
+			continue
+		}
+		words := append(flagNames(flags[c.path], false), flagNames(flags[c.path], true)...)
+		if c.path == "completion" {
+			words = []string{"bash", "zsh", "fish", "powershell"}
+		}
+		fmt.Fprintf(&b, "        %s = @(%s)\n", psQuote(c.path), psList(words))
+	}
+	b.WriteString(`    }
+    $path = @()
+    foreach ($element in $commandAst.CommandElements | Select-Object -Skip 1) {
+        if ($element.Extent.StartOffset -ge $cursorPosition) { break }
+        $text = $element.ToString()
+        if ($text.StartsWith('-') -or $text -eq $wordToComplete) { break }
+        $path += $text
+    }
+    $key = $path -join ' '
+    if (-not $candidates.ContainsKey($key)) { return }
+    $candidates[$key] | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}
+`)
+	return b.String()
+}
+
+// shellQuote single-quotes s for sh, zsh, and fish.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// zshEscape escapes the characters _arguments and _describe treat specially.
+func zshEscape(s string) string {
+	return strings.NewReplacer(`[`, `\[`, `]`, `\]`, `:`, `\:`).Replace(s)
+}
+
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func psList(words []string) string {
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = psQuote(w)
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/csvcheck"
+)
+
+// runCSV implements `config-validator csv`: RFC 4180 quoting, the number of fields in
+// each row, and optionally a schema of column names and types. The file is streamed,
+// and in the text format each finding is printed as soon as its row is read.
+func runCSV(args []string) {
+	d := newDocumentRun("csv")
+	schemaFile := d.fs.String("schema", "", "CSV schema (YAML) of column names and types")
+	delimiter := d.fs.String("delimiter", ",", "Field delimiter (one character, e.g. ';' or '\\t')")
+	noHeader := d.fs.Bool("no-header", false, "The first row is data, not column names")
+	d.parse(args)
+
+	opts := csvcheck.Options{NoHeader: *noHeader}
+	switch *delimiter {
+	case `\t`, "tab":
+		opts.Comma = '\t'
+	default:
+		if len(*delimiter) != 1 || *delimiter == `"` || *delimiter == "\n" || *delimiter == "\r" {
+			log.Fatalf("❌ -delimiter must be one character other than a quote or line break, got %q", *delimiter)
+		}
+		opts.Comma = (*delimiter)[0]
+	}
+	if *schemaFile != "" {
+		var err error
+		if opts.Schema, err = csvcheck.LoadSchema(*schemaFile); err != nil {
+			log.Fatal("❌ Error loading schema:", err)
+		}
+	}
+
+	file, err := os.Open(*d.inputFile)
+	if err != nil {
+		log.Fatal("❌ Error reading file:", err)
+	}
+	defer file.Close()
+	var findings []automata.Finding
+	err = csvcheck.Check(file, opts, func(f automata.Finding) {
+		findings = append(findings, f)
+		if *d.format == "text" {
+			d.print(f)
+		}
+	})
+	if err != nil {
+		log.Fatal("❌ Error reading file:", err)
+	}
+	d.printed = true
+	d.finish(findings, nil)
+}
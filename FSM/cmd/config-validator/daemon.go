@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"config-validator/pkg/buildinfo"
+	"config-validator/pkg/config"
+	"config-validator/pkg/fleet"
+	"config-validator/pkg/history"
+	"config-validator/pkg/schedule"
+	"config-validator/pkg/server"
+	"config-validator/pkg/telemetry"
+	"config-validator/pkg/validation"
+)
+
+// runDaemon implements `config-validator daemon`: the inventory is re-validated on a
+// schedule, every run is kept in the history store, and the latest status per device
+// is served over the REST API.
+func runDaemon(args []string) {
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	inventoryFile := fs.String("inventory", "inventory.yaml", "Inventory file (YAML or CSV)")
+	credentialsFile := fs.String("credentials", "", "YAML file with credential sets (for CSV inventories)")
+	rulesFile := fs.String("rules", defaultRules, "Rules for devices without a profile (file, https:// URL, oci:// reference, or builtin)")
+	rulesKey := rulesKeyFlag(fs)
+	outDir := fs.String("outdir", "daemon-data", "Directory for run artifacts and result history")
+	spec := fs.String("schedule", "@every 1h", "Cron expression or @every <duration>")
+	listen := fs.String("listen", ":8080", "Address for the REST API")
+	certFile := fs.String("tls-cert", "", "TLS certificate for the REST API (plain HTTP when empty)")
+	keyFile := fs.String("tls-key", "", "TLS private key")
+	runNow := fs.Bool("run-now", true, "Validate once at startup instead of waiting for the first tick")
+	workers := fs.Int("workers", 8, "Number of devices validated concurrently")
+	knownHosts := fs.String("known-hosts", "", "known_hosts file used to verify devices (default ~/.ssh/known_hosts)")
+	insecure := fs.Bool("insecure", false, "Skip host key verification")
+	sandboxed := fs.Bool("sandboxed", false, "Only run WASM rule checks, refusing Starlark scripts")
+	hardening := hardeningFlag(fs)
+	timeout := fs.Duration("timeout", 30*time.Second, "Per-device connection timeout")
+	dbPath := fs.String("db", defaultDB(), "SQLite result store to record runs in (disabled when empty)")
+	notifyPath := fs.String("notify", "", "Notification config (YAML) for failures and new findings")
+	ownersFile := ownersFlag(fs)
+	redactPattern := redactFlag(fs)
+	keepRuns := fs.Int("keep-runs", 1000, "Number of runs kept in the history, with their artifacts (0 keeps all)")
+	keepFor := fs.Duration("keep-for", 90*24*time.Hour, "How long runs are kept in the history, with their artifacts (0 keeps them regardless of age)")
+	watch := fs.Duration("watch", 2*time.Second, "How often to check the rules files for changes (0 disables hot reload)")
+	guard := addGuardFlags(fs)
+	queueing := addQueueFlags(fs)
+	fs.Parse(args)
+	checkNotify(*notifyPath, *dbPath)
+	owners := mustOwners(*ownersFile)
+	redact := mustRedact(*redactPattern)
+
+	sched, err := schedule.Parse(*spec)
+	if err != nil {
+		log.Fatal("❌ Invalid schedule:", err)
+	}
+	store, err := history.Open(filepath.Join(*outDir, "history"), history.Retention{MaxRuns: *keepRuns, MaxAge: *keepFor})
+	if err != nil {
+		log.Fatal("❌ Error opening history:", err)
+	}
+	// Drops the runs beyond the retention, with the configs and reports of their devices
+	prune := func() {
+		pruned, err := store.Prune()
+		for _, id := range pruned {
+			if err := os.RemoveAll(filepath.Join(*outDir, "runs", id)); err != nil {
+				log.Println("⚠️  Error removing run artifacts:", err)
+			}
+		}
+		if err != nil {
+			log.Println("⚠️  Error pruning history:", err)
+		}
+	}
+	prune()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	stopTelemetry := telemetry.Init("config-validator-daemon", buildinfo.Get().Version)
+	defer stopTelemetry()
+
+	rules := mustReloader(*rulesFile, *rulesKey, config.Options{Sandboxed: *sandboxed, Hardening: *hardening})
+	if *watch > 0 {
+		go rules.Watch(ctx, *watch)
+	}
+
+	requests := queueing.queue()
+	mux := http.NewServeMux()
+	mux.Handle("/", server.New(store))
+	mux.Handle("POST /-/reload", server.ReloadHandler(rules))
+	mux.Handle("GET /metrics", server.MetricsHandler(rules, requests))
+	mux.Handle("POST /api/v1/validate", server.ValidateHandler(rules))
+	mux.Handle("GET /api/v1/rules", server.RulesHandler(rules))
+	mux.Handle("GET /openapi.yaml", server.OpenAPIHandler(false))
+	mux.Handle("GET /openapi.json", server.OpenAPIHandler(true))
+	mux.Handle("GET /healthz", server.HealthHandler())
+	mux.Handle("GET /readyz", server.ReadyHandler(rules))
+	mux.Handle("GET /buildinfo", server.BuildInfoHandler(rules))
+	handler, tlsConfig := guard.wrap(requests.Wrap(mux), *listen, *certFile != "")
+	srv := &http.Server{Addr: *listen, Handler: handler, TLSConfig: tlsConfig}
+	go func() {
+		log.Println("🌐 REST API listening on", *listen)
+		serve := srv.ListenAndServe
+		if *certFile != "" {
+			serve = func() error { return srv.ListenAndServeTLS(*certFile, *keyFile) }
+		}
+		if err := serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("❌ REST API failed:", err)
+		}
+	}()
+
+	validateOnce := func() {
+		// The inventory is re-read every run so edits apply without a restart.
+		inv, err := loadInventory(*inventoryFile, *credentialsFile)
+		if err != nil {
+			log.Println("❌ Error loading inventory:", err)
+			return
+		}
+		// Like the inventory, the ignore files are read again every run.
+		ignores := inventoryIgnores(*inventoryFile)
+		skipIgnored(inv, ignores)
+		// Remote rule packs are revalidated every run, so published updates are picked up.
+		// A rejected update leaves the previous rules in use.
+		if err := rules.Reload(); err != nil {
+			log.Println("❌ Rules reload rejected, keeping version", rules.Current().Version+":", err)
+		}
+		current := rules.Current()
+		started := time.Now()
+		runID := started.UTC().Format("20060102T150405Z")
+		results := fleet.Run(inv, fleet.Options{
+			RulesFile:  current.File,
+			Rules:      current,
+			OutDir:     filepath.Join(*outDir, "runs", runID),
+			Workers:    *workers,
+			Timeout:    *timeout,
+			KnownHosts: *knownHosts,
+			Insecure:   *insecure,
+			Sandboxed:  *sandboxed,
+			Hardening:  *hardening,
+			Owners:     owners,
+			Redact:     redact,
+			Ignore:     ignores,
+		})
+		report := validation.NewFleetReport(results)
+		finishRuns(*dbPath, *notifyPath, fleetRuns(results, started)...)
+		err = store.Record(&history.Run{ID: runID, Started: started, Finished: time.Now(), Report: report})
+		if err != nil {
+			log.Println("❌ Error recording run:", err)
+			return
+		}
+		prune()
+		log.Printf("✅ Run %s complete: %d/%d devices passed\n", runID, report.Passed, report.Total)
+	}
+
+	if *runNow {
+		validateOnce()
+	}
+	for {
+		next := sched.Next(time.Now())
+		if next.IsZero() {
+			log.Fatal("❌ Schedule never fires")
+		}
+		log.Println("⏰ Next run at", next.Format(time.RFC3339))
+		select {
+		case <-ctx.Done():
+			shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			srv.Shutdown(shutdown)
+			log.Println("👋 Daemon stopped")
+			return
+		case <-time.After(time.Until(next)):
+			validateOnce()
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/capture"
+	"config-validator/pkg/discovery"
+)
+
+// runDiscovery implements `config-validator discovery`: the LLDP and CDP
+// advertisements of a pcap or pcapng capture are checked frame by frame.
+func runDiscovery(args []string) {
+	d := newDocumentRun("discovery")
+	d.captureFlags(false)
+	d.parse(args)
+	d.what = "LLDP and CDP"
+
+	content, err := os.ReadFile(*d.inputFile)
+	if err != nil {
+		log.Fatal("❌ Error reading file:", err)
+	}
+	if !capture.IsCapture(content) {
+		log.Fatalf("❌ %s is not a pcap or pcapng capture; advertisements are read from captures", *d.inputFile)
+	}
+	var findings []automata.Finding
+	lldp, cdp := 0, 0
+	err = d.sampler.Frames(bytes.NewReader(content), func(fr capture.Frame) {
+		switch {
+		case fr.EtherType == capture.EtherLLDP && !fr.LLC:
+			lldp++
+			findings = append(findings, discovery.CheckLLDP(fr)...)
+		case discovery.IsCDP(fr):
+			cdp++
+			findings = append(findings, discovery.CheckCDP(fr)...)
+		}
+	})
+	if err != nil {
+		log.Fatal("❌ Error reading capture: ", err)
+	}
+	if lldp+cdp == 0 {
+		log.Fatal("❌ No LLDP or CDP frames found in ", *d.inputFile)
+	}
+	d.what = fmt.Sprintf("discovery (LLDP: %d, CDP: %d)", lldp, cdp)
+	d.finish(findings, nil)
+}
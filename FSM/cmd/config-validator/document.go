@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/capture"
+	"config-validator/pkg/flowreport"
+	"config-validator/pkg/i18n"
+	"config-validator/pkg/ownership"
+	"config-validator/pkg/validation"
+)
+
+// runDocumentCheck implements the document subcommands (yaml, xml, toml, ini): check
+// finds the problems of the input file, and the findings go through the same report,
+// store, and annotation outputs as config validation. check may also return a detailed
+// form of its errors, which -format json prints instead of the findings.
+func runDocumentCheck(kind string, args []string, check func(content []byte) ([]automata.Finding, any)) {
+	d := newDocumentRun(kind)
+	d.parse(args)
+	content, err := os.ReadFile(*d.inputFile)
+	if err != nil {
+		log.Fatal("❌ Error reading file:", err)
+	}
+	findings, detail := check(content)
+	d.finish(findings, detail)
+}
+
+// documentRun holds the flags and outputs shared by the document subcommands.
+type documentRun struct {
+	kind       string
+	fs         *flag.FlagSet
+	inputFile  *string
+	outputFile *string
+	format     *string
+	dbPath     *string
+	notifyPath *string
+	lang       *string
+	filters    *filterFlags
+	filter     *validation.Filter
+	ownersFile *string
+	owners     *ownership.Map
+	redactFlag *string
+	redact     *regexp.Regexp
+	sealing    *sealFlags
+	shown      int     // findings printed as they were found, for -max-findings
+	flowOut    *string // -flow-report, for the subcommands that read captures
+	flows      *flowreport.Builder
+	sampling   *samplingFlags
+	sampler    *capture.Sampler // nil unless sampling flags were given
+	messages   *i18n.Catalog
+	started    time.Time
+	printed    bool   // text findings were already printed as they were found
+	what       string // what a valid input is, for the success message; the kind when empty
+	quiet      bool   // stdout carries other output, so no success message
+}
+
+// newDocumentRun defines the shared flags; a subcommand may add its own to fs before
+// calling parse.
+func newDocumentRun(kind string) *documentRun {
+	fs := flag.NewFlagSet(kind, flag.ExitOnError)
+	return &documentRun{
+		kind:       kind,
+		fs:         fs,
+		inputFile:  fs.String("input", "", "File to validate"),
+		outputFile: fs.String("out", "", "Path to JSON validation report (none when empty)"),
+		format:     fs.String("format", "text", "Output format: text (file:line: message), json (errors on stdout), github (workflow annotations), or csv/xlsx (spreadsheet on stdout)"),
+		dbPath:     fs.String("db", defaultDB(), "SQLite result store to record the run in (disabled when empty)"),
+		notifyPath: fs.String("notify", "", "Notification config (YAML) for failures and new findings"),
+		lang:       langFlag(fs),
+		filters:    addFilterFlags(fs),
+		ownersFile: ownersFlag(fs),
+		redactFlag: redactFlag(fs),
+		sealing:    addSealFlags(fs),
+	}
+}
+
+// flowReport adds the -flow-report flag of the subcommands that validate the flows
+// of a capture.
+func (d *documentRun) flowReport() {
+	d.flowOut = d.fs.String("flow-report", "", "Path to JSON report of a capture by flow, with each flow's findings by layer and packet (none when empty)")
+}
+
+// samplingFlags are the flags of the subcommands that read captures for cutting
+// down the traffic validated.
+type samplingFlags struct {
+	filter         *string
+	maxFlowPackets *int
+	maxFlowBytes   *int
+	sample         *string
+}
+
+// captureFlags adds the flags that filter, sample, and cap the traffic of a capture.
+// Subcommands that check link-layer frames, which have no flows, only get -filter.
+func (d *documentRun) captureFlags(flows bool) {
+	none, zero := "", 0
+	d.sampling = &samplingFlags{
+		filter:         d.fs.String("filter", "", "Validate only the packets matching a tcpdump-style filter, e.g. 'tcp port 22 and net 10.0.0.0/8'"),
+		maxFlowPackets: &zero,
+		maxFlowBytes:   &zero,
+		sample:         &none,
+	}
+	if flows {
+		d.sampling.maxFlowPackets = d.fs.Int("max-flow-packets", 0, "Packets of each flow to validate, the rest skipped (0 for all)")
+		d.sampling.maxFlowBytes = d.fs.Int("max-flow-bytes", 0, "Payload bytes of each flow to validate, the rest skipped (0 for all)")
+		d.sampling.sample = d.fs.String("sample", "", "Validate N of every M flows, written N/M (all when empty)")
+	}
+}
+
+// newSampler returns the sampler the sampling flags ask for, or nil for none.
+func (f *samplingFlags) newSampler() *capture.Sampler {
+	s := &capture.Sampler{MaxFlowPackets: *f.maxFlowPackets, MaxFlowBytes: *f.maxFlowBytes}
+	if *f.filter != "" {
+		filter, err := capture.ParseFilter(*f.filter)
+		if err != nil {
+			log.Fatal("❌ ", err)
+		}
+		s.Filter = filter
+	}
+	if *f.sample != "" {
+		n, m, ok := strings.Cut(*f.sample, "/")
+		s.SampleN, _ = strconv.Atoi(n)
+		s.SampleM, _ = strconv.Atoi(m)
+		if !ok || s.SampleN < 1 || s.SampleM < s.SampleN {
+			log.Fatalf("❌ -sample %q is not N/M with 1 <= N <= M", *f.sample)
+		}
+	}
+	if s.MaxFlowPackets < 0 || s.MaxFlowBytes < 0 {
+		log.Fatal("❌ -max-flow-packets and -max-flow-bytes must not be negative")
+	}
+	if !s.Active() {
+		return nil
+	}
+	return s
+}
+
+// logSampling reports how much of a capture the sampler kept and why the rest was
+// skipped.
+func (d *documentRun) logSampling() {
+	if !d.sampler.Active() {
+		return
+	}
+	s, st := d.sampler, d.sampler.Stats
+	var skipped []string
+	if s.Filter != nil {
+		skipped = append(skipped, fmt.Sprintf("%d filtered out", st.Filtered))
+	}
+	if s.SampleM > 0 {
+		skipped = append(skipped, fmt.Sprintf("%d in the %d of %d flows not sampled", st.Unsampled, st.Flows-st.SampledFlows, st.Flows))
+	}
+	if s.MaxFlowPackets > 0 || s.MaxFlowBytes > 0 {
+		skipped = append(skipped, fmt.Sprintf("%d over the caps of %d flows", st.Capped, st.CappedFlows))
+	}
+	log.Printf("📊 Validated %d of %d packets (%d of %d bytes): %s", st.Kept, st.Packets, st.KeptBytes, st.Bytes, strings.Join(skipped, ", "))
+}
+
+func (d *documentRun) parse(args []string) {
+	d.fs.Parse(args)
+	checkNotify(*d.notifyPath, *d.dbPath)
+	if *d.inputFile == "" && d.fs.NArg() > 0 {
+		*d.inputFile = d.fs.Arg(0)
+	}
+	if *d.inputFile == "" {
+		log.Fatalf("❌ usage: config-validator %s [-out report.json] [-format text|json|github|csv|xlsx] file", d.kind)
+	}
+	if _, ok := exportFormats[*d.format]; !ok && *d.format != "text" && *d.format != "json" && *d.format != "github" {
+		log.Fatal("❌ Unknown format: ", *d.format)
+	}
+	d.messages = mustCatalog(*d.lang)
+	d.filter = d.filters.filter()
+	d.owners = mustOwners(*d.ownersFile)
+	d.redact = mustRedact(*d.redactFlag)
+	d.started = time.Now()
+	if d.flowOut != nil && *d.flowOut != "" {
+		d.flows = flowreport.NewBuilder(d.kind, *d.inputFile)
+	}
+	if d.sampling != nil {
+		d.sampler = d.sampling.newSampler()
+	}
+}
+
+// print writes a finding in the text format.
+func (d *documentRun) print(f automata.Finding) {
+	f = validation.Redact([]automata.Finding{d.messages.Localize(f)}, d.redact)[0]
+	if !d.filter.Keeps(f) || (d.filter.MaxFindings > 0 && d.shown == d.filter.MaxFindings) {
+		return
+	}
+	d.shown++
+	if f.Line == 0 {
+		fmt.Printf("%s: %s\n", *d.inputFile, f.Message)
+		return
+	}
+	fmt.Printf("%s:%d: %s\n", *d.inputFile, f.Line, f.Message)
+}
+
+// finish writes the report, records the run, prints the findings, and exits with
+// status 1 if there are any.
+func (d *documentRun) finish(findings []automata.Finding, detail any) {
+	// The result store and notifications get every finding; the filters only narrow
+	// what is reported
+	recorded := validation.Redact(d.messages.LocalizeAll(findings), d.redact)
+	d.owners.Annotate(*d.inputFile, recorded)
+	findings = d.filter.Apply(recorded)
+	sealer := d.sealing.sealer()
+	if *d.outputFile != "" {
+		data, err := validation.FindingsReportJSON(findings)
+		mustSaveReport(sealer, *d.outputFile, data, err)
+	}
+	d.logSampling()
+	if d.flows != nil {
+		r := d.flows.Report()
+		if d.sampler.Active() {
+			r.Sampling = &d.sampler.Stats
+		}
+		data, err := flowreport.JSON(r)
+		if err == nil {
+			err = sealer.WriteFile(*d.flowOut, data, 0o644)
+		}
+		if err != nil {
+			log.Fatal("❌ Error generating flow report:", err)
+		}
+	}
+	finishRuns(*d.dbPath, *d.notifyPath, fileRun(*d.inputFile, *d.inputFile, "", d.started, recorded))
+
+	// -max-findings limits what is printed; the report and the exit status cover
+	// every finding
+	shown := d.filter.Limit(findings)
+	switch *d.format {
+	case "github":
+		validation.WriteGitHubAnnotations(os.Stdout, *d.inputFile, shown)
+	case "csv", "xlsx":
+		if err := exportFormats[*d.format](os.Stdout, validation.FileFindings{File: *d.inputFile, Findings: shown}); err != nil {
+			log.Fatal("❌ Error exporting findings:", err)
+		}
+	case "json":
+		if detail == nil {
+			detail = shown
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false) // suggestions quote tags
+		enc.SetIndent("", "  ")
+		enc.Encode(detail)
+	default:
+		if !d.printed {
+			for _, f := range findings {
+				d.print(f)
+			}
+		}
+	}
+	if len(findings) > 0 {
+		os.Exit(1)
+	}
+	if *d.format == "text" && !d.quiet {
+		if d.what == "" {
+			d.what = strings.ToUpper(d.kind)
+		}
+		fmt.Printf("✅ %s is valid %s\n", *d.inputFile, d.what)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+
+	"config-validator/pkg/capture"
+	"config-validator/pkg/eapol"
+)
+
+// runEAPOL implements `config-validator eapol`: the 802.1X exchanges of a pcap or
+// pcapng capture are checked, following each supplicant's EAP state machine across
+// its EAPOL frames.
+func runEAPOL(args []string) {
+	d := newDocumentRun("eapol")
+	d.captureFlags(false)
+	d.parse(args)
+	d.what = "802.1X"
+
+	content, err := os.ReadFile(*d.inputFile)
+	if err != nil {
+		log.Fatal("❌ Error reading file:", err)
+	}
+	if !capture.IsCapture(content) {
+		log.Fatalf("❌ %s is not a pcap or pcapng capture; 802.1X exchanges are read from captures", *d.inputFile)
+	}
+	c := eapol.NewChecker()
+	err = d.sampler.Frames(bytes.NewReader(content), func(fr capture.Frame) {
+		if fr.EtherType == capture.EtherEAPOL && !fr.LLC {
+			c.Frame(fr)
+		}
+	})
+	if err != nil {
+		log.Fatal("❌ Error reading capture: ", err)
+	}
+	if c.Frames == 0 {
+		log.Fatal("❌ No EAPOL frames found in ", *d.inputFile)
+	}
+	findings := c.Close()
+	d.what = fmt.Sprintf("802.1X (supplicants: %d, EAPOL frames: %d)", c.Exchanges(), c.Frames)
+	d.finish(findings, nil)
+}
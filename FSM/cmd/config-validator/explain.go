@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/demo"
+	"config-validator/pkg/linereader"
+)
+
+// runExplainLine implements `config-validator explain-line`: it replays the config up
+// to the given line and shows how the FSM treats it, which rules were tried, and which
+// rule most likely needs extending.
+func runExplainLine(args []string) {
+	fs := flag.NewFlagSet("explain-line", flag.ExitOnError)
+	inputFile := fs.String("input", "", "Cisco config file (the built-in demo config when empty)")
+	lineNum := fs.Int("line", 0, "Line number to explain")
+	rulesFile := fs.String("rules", defaultRules, "Rules file, https:// URL, oci:// reference, or builtin")
+	rulesKey := rulesKeyFlag(fs)
+	role := fs.String("role", "", "Device role (e.g. core, edge, access): use roles/<role>.yaml next to the rules file")
+	format := fs.String("format", "text", "Output format: text or json")
+	fs.Parse(args)
+	if *lineNum < 1 {
+		log.Fatal("❌ -line is required")
+	}
+	*rulesFile = mustResolveRules(*rulesFile, *rulesKey, *role)
+
+	rf, err := automata.LoadRuleFile(*rulesFile)
+	if err != nil {
+		log.Fatal("❌ Error loading rules:", err)
+	}
+	machine, err := automata.Compile(rf.Rules)
+	if err != nil {
+		log.Fatal("❌ Error loading rules:", err)
+	}
+	fsm := machine.WithLines(rf.Lines).NewRun()
+
+	var input io.Reader = bytes.NewReader(demo.Config)
+	if *inputFile != "" {
+		file, err := os.Open(*inputFile)
+		if err != nil {
+			log.Fatal("❌ Error reading file:", err)
+		}
+		defer file.Close()
+		input = file
+	}
+
+	var e *automata.Explanation
+	scanner := linereader.NewJoiner(linereader.NewScanner(input), rf.Lines.Continuation, rf.Lines.WrapWidth)
+	for scanner.Scan() {
+		if *lineNum <= scanner.End() {
+			explanation := fsm.Explain(scanner.Text(), scanner.Line())
+			e = &explanation
+			break
+		}
+		fsm.ProcessLine(scanner.Text(), scanner.Line())
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal("❌ Error reading file:", err)
+	}
+	if e == nil {
+		log.Fatalf("❌ %s has fewer than %d lines", *inputFile, *lineNum)
+	}
+
+	if *format == "json" {
+		out, _ := json.MarshalIndent(e, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+	fmt.Printf("Line %d: %s\n", e.LineNum, e.Line)
+	if e.State != e.Previous {
+		fmt.Printf("State:  %s (left %s, the line is not indented)\n", e.State, e.Previous)
+	} else {
+		fmt.Printf("State:  %s\n", e.State)
+	}
+	if e.Context != "" {
+		fmt.Printf("In:     %s\n", e.Context)
+	}
+	if e.Entered != "" {
+		fmt.Printf("Enters: %s\n", e.Entered)
+	}
+	if len(e.Tried) > 0 {
+		fmt.Printf("Rules tried in %s:\n", e.State)
+		for _, a := range e.Tried {
+			mark := "✗"
+			if a.Matched {
+				mark = "✓"
+			}
+			fmt.Printf("  %s %-45s prefix %q, %d edits\n", mark, a.Pattern, a.Prefix, a.Distance)
+		}
+	}
+	if e.NearMiss != nil {
+		fmt.Printf("Near miss: %s\n", e.NearMiss.Pattern)
+	}
+	fmt.Println("💡", e.Suggestion)
+}
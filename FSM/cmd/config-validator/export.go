@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"config-validator/pkg/seal"
+	"config-validator/pkg/validation"
+)
+
+// exportFormats are the -format values that export the findings as a spreadsheet,
+// one row per finding, for audit teams that review them outside the tool.
+var exportFormats = map[string]func(io.Writer, ...validation.FileFindings) error{
+	"csv":  validation.WriteFindingsCSV,
+	"xlsx": validation.WriteFindingsXLSX,
+}
+
+// exportPath is where a spreadsheet export is written: next to the JSON report,
+// with the format as its extension.
+func exportPath(outputFile, format string) string {
+	return strings.TrimSuffix(outputFile, filepath.Ext(outputFile)) + "." + format
+}
+
+// writeExport writes the findings in a spreadsheet format to path, sealed with sealer
+// as the report is.
+func writeExport(sealer *seal.Sealer, path, format string, files ...validation.FileFindings) error {
+	var b bytes.Buffer
+	if err := exportFormats[format](&b, files...); err != nil {
+		return err
+	}
+	return sealer.WriteFile(path, b.Bytes(), 0o644)
+}
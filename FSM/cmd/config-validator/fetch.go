@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"config-validator/pkg/config"
+	"config-validator/pkg/device"
+	"config-validator/pkg/store"
+	"config-validator/pkg/validation"
+)
+
+// runFetch implements `config-validator fetch`: it logs into a device, retrieves the
+// running config, validates it, and stores the config next to the report.
+func runFetch(args []string) {
+	fs := flag.NewFlagSet("fetch", flag.ExitOnError)
+	host := fs.String("host", "", "Device hostname or IP address")
+	port := fs.Int("port", 0, "Device port (default depends on transport)")
+	transport := fs.String("transport", "ssh", "Retrieval transport (ssh, netconf, restconf)")
+	user := fs.String("user", "", "Login username")
+	password := fs.String("password", "", "Login password (defaults to $CONFIG_VALIDATOR_PASSWORD)")
+	keyFile := fs.String("key", "", "Path to an SSH private key")
+	knownHosts := fs.String("known-hosts", "", "known_hosts file used to verify the device (default ~/.ssh/known_hosts)")
+	path := fs.String("path", "", "RESTCONF resource path (default is the IOS-XE native model)")
+	insecure := fs.Bool("insecure", false, "Skip host key/TLS certificate verification")
+	timeout := fs.Duration("timeout", 30*time.Second, "Connection timeout")
+	outDir := fs.String("outdir", ".", "Directory where the retrieved config and report are saved")
+	rulesFile := fs.String("rules", defaultRules, "Rules file, https:// URL, oci:// reference, or builtin")
+	rulesKey := rulesKeyFlag(fs)
+	hardening := hardeningFlag(fs)
+	role := fs.String("role", "", "Device role (e.g. core, edge, access): use roles/<role>.yaml next to the rules file")
+	format := fs.String("format", "text", "Output format: text (findings grouped by severity on stdout), json (report file only), github (also print workflow annotations), or csv/xlsx (also export the findings as a spreadsheet next to the report)")
+	minScore := fs.Int("min-score", 0, "Exit with status 1 if the config's score (0-100) is below this")
+	dbPath := fs.String("db", defaultDB(), "SQLite result store to record the run in (disabled when empty)")
+	notifyPath := fs.String("notify", "", "Notification config (YAML) for failures and new findings")
+	lang := langFlag(fs)
+	ownersFile := ownersFlag(fs)
+	redactPattern := redactFlag(fs)
+	sealing := addSealFlags(fs)
+	filterFlags := addFilterFlags(fs)
+	baselineFlags := addBaselineFlags(fs)
+	fs.Parse(args)
+	checkNotify(*notifyPath, *dbPath)
+	checkFormat(*format)
+	filter := filterFlags.filter()
+	base := baselineFlags.open()
+	messages := mustCatalog(*lang)
+	owners := mustOwners(*ownersFile)
+	redact := mustRedact(*redactPattern)
+	sealer := sealing.sealer()
+	*rulesFile = mustResolveRules(*rulesFile, *rulesKey, *role)
+	started := time.Now()
+
+	if *host == "" {
+		log.Fatal("❌ -host is required")
+	}
+	if *password == "" {
+		*password = os.Getenv("CONFIG_VALIDATOR_PASSWORD")
+	}
+
+	// Retrieve the live config from the device
+	running, err := device.Fetch(device.Target{
+		Host:       *host,
+		Port:       *port,
+		Transport:  *transport,
+		Username:   *user,
+		Password:   *password,
+		KeyFile:    *keyFile,
+		KnownHosts: *knownHosts,
+		Insecure:   *insecure,
+		Timeout:    *timeout,
+		Path:       *path,
+	})
+	if err != nil {
+		log.Fatal("❌ Error fetching config:", err)
+	}
+
+	// Keep the retrieved config alongside the report so findings can be traced back to it
+	if err := os.MkdirAll(*outDir, 0o755); err != nil {
+		log.Fatal("❌ Error creating output directory:", err)
+	}
+	name := device.FileSafeName(*host)
+	configPath := filepath.Join(*outDir, name+"-running-config.txt")
+	// Running configs hold secrets, so only the owner may read them
+	if err := sealer.WriteFile(configPath, running, 0600); err != nil {
+		log.Fatal("❌ Error saving config:", err)
+	}
+
+	// Validate the retrieved config with FSM + rules
+	fsm, err := config.ParseReaderOptions(bytes.NewReader(running), *rulesFile, config.Options{Hardening: *hardening})
+	if err != nil {
+		log.Fatal("❌ Error parsing config:", err)
+	}
+
+	// The result store and notifications get every finding; the filters and the
+	// baseline only narrow what is reported, as for -input
+	recorded := prepareFSM(fsm, *host, messages, redact, owners)
+	filter.ApplyFSM(fsm)
+	base.applyFSM(*host, fsm)
+	reportPath := filepath.Join(*outDir, name+"-report.json")
+	data, err := validation.ReportJSON(fsm)
+	mustSaveReport(sealer, reportPath, data, err)
+
+	// Hashed from memory, as the saved config may be encrypted
+	run := fileRun(*host, "", *rulesFile, started, recorded)
+	run.Kind = "device"
+	run.InputHash = store.HashBytes(running)
+	finishRuns(*dbPath, *notifyPath, run)
+	base.finish(normalOutput)
+
+	fmt.Println("📥 Config from", *host, "saved to", configPath)
+	printFindings(*host, reportPath, *format, sealer, fsm.Findings, filter.MaxFindings, normalOutput, *minScore)
+}
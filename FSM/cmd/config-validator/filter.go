@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"config-validator/pkg/validation"
+)
+
+// filterFlags are the flags that narrow the findings of a run before they are
+// reported, scored, and turned into an exit status.
+type filterFlags struct {
+	onlyRules    *string
+	excludeRules *string
+	severities   *string
+	maxFindings  *int
+}
+
+func addFilterFlags(fs *flag.FlagSet) *filterFlags {
+	return &filterFlags{
+		onlyRules:    fs.String("only-rules", "", "Comma-separated rules to report, by finding state or code, with globs (e.g. HARDENING,security.*)"),
+		excludeRules: fs.String("exclude-rules", "", "Comma-separated rules not to report, by finding state or code, with globs"),
+		severities:   fs.String("only-severity", "", "Comma-separated severities to report: error, warning, security"),
+		maxFindings:  fs.Int("max-findings", 0, "Report at most this many findings (0 for all)"),
+	}
+}
+
+// filter returns the filter the flags describe, which is inactive without them.
+func (f *filterFlags) filter() *validation.Filter {
+	filter := &validation.Filter{
+		OnlyRules:    splitList(*f.onlyRules),
+		ExcludeRules: splitList(*f.excludeRules),
+		Severities:   splitList(*f.severities),
+		MaxFindings:  *f.maxFindings,
+	}
+	if err := filter.Check(); err != nil {
+		log.Fatal("❌ Invalid findings filter: ", err)
+	}
+	return filter
+}
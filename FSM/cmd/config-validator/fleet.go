@@ -0,0 +1,167 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"config-validator/pkg/config"
+	"config-validator/pkg/device"
+	"config-validator/pkg/fleet"
+	"config-validator/pkg/progress"
+	"config-validator/pkg/remediation"
+	"config-validator/pkg/seal"
+	"config-validator/pkg/validation"
+)
+
+// runValidateFleet implements `config-validator validate-fleet`: every device in the
+// inventory is fetched and validated concurrently, and a fleet summary is written
+// next to the per-device reports.
+func runValidateFleet(args []string) {
+	fs := flag.NewFlagSet("validate-fleet", flag.ExitOnError)
+	inventoryFile := fs.String("inventory", "inventory.yaml", "Inventory file (YAML or CSV)")
+	credentialsFile := fs.String("credentials", "", "YAML file with credential sets (for CSV inventories)")
+	rulesFile := fs.String("rules", defaultRules, "Rules for devices without a profile (file, https:// URL, oci:// reference, or builtin)")
+	rulesKey := rulesKeyFlag(fs)
+	outDir := fs.String("outdir", "fleet-reports", "Directory for per-device configs/reports and the fleet summary")
+	workers := fs.Int("workers", 8, "Number of devices validated concurrently")
+	knownHosts := fs.String("known-hosts", "", "known_hosts file used to verify devices (default ~/.ssh/known_hosts)")
+	insecure := fs.Bool("insecure", false, "Skip host key verification")
+	timeout := fs.Duration("timeout", 30*time.Second, "Per-device connection timeout")
+	dbPath := fs.String("db", defaultDB(), "SQLite result store to record the run in (disabled when empty)")
+	notifyPath := fs.String("notify", "", "Notification config (YAML) for failures and new findings")
+	minScore := fs.Int("min-score", 0, "Exit with status 1 if the fleet score (0-100) is below this")
+	ntpServer := fs.String("ntp-server", "", "NTP server to use in remediation snippets")
+	hardening := hardeningFlag(fs)
+	changeScript := fs.String("change-script", "", "Also write every device's remediation snippet into this one file")
+	lang := langFlag(fs)
+	quiet := fs.Bool("quiet", false, "Do not report progress on stderr")
+	baselineFlags := addBaselineFlags(fs)
+	ownersFile := ownersFlag(fs)
+	redactPattern := redactFlag(fs)
+	sealing := addSealFlags(fs)
+	fs.Parse(args)
+	checkNotify(*notifyPath, *dbPath)
+	base := baselineFlags.open()
+	owners := mustOwners(*ownersFile)
+	redact := mustRedact(*redactPattern)
+	sealer := sealing.sealer()
+	messages := mustCatalog(*lang)
+	*rulesFile = mustResolveRules(*rulesFile, *rulesKey, "")
+	// Loaded once for every device without a profile or role; those rules are loaded
+	// once per run by fleet.Run.
+	rules, err := config.LoadRuleSet(*rulesFile, config.Options{Hardening: *hardening})
+	if err != nil {
+		log.Fatal("❌ Error loading rules:", err)
+	}
+	started := time.Now()
+
+	inv, err := loadInventory(*inventoryFile, *credentialsFile)
+	if err != nil {
+		log.Fatal("❌ Error loading inventory:", err)
+	}
+	ignores := inventoryIgnores(*inventoryFile)
+	skipIgnored(inv, ignores)
+
+	if err := os.MkdirAll(*outDir, 0o755); err != nil {
+		log.Fatal("❌ Error creating output directory:", err)
+	}
+
+	var bar *progress.Reporter
+	if !*quiet {
+		bar = progress.New(os.Stderr, "devices", len(inv.Devices))
+	}
+	results := fleet.Run(inv, fleet.Options{
+		RulesFile:   *rulesFile,
+		Rules:       rules,
+		OutDir:      *outDir,
+		Workers:     *workers,
+		Timeout:     *timeout,
+		KnownHosts:  *knownHosts,
+		Insecure:    *insecure,
+		Hardening:   *hardening,
+		Remediation: remediation.Options{NTPServer: *ntpServer},
+		Messages:    messages,
+		Progress:    bar,
+		Baseline:    base.fleetBaseline(),
+		Owners:      owners,
+		Redact:      redact,
+		Ignore:      ignores,
+		Sealer:      sealer,
+	})
+	bar.Finish()
+	base.addFleet(results)
+	report := validation.NewFleetReport(results)
+	finishRuns(*dbPath, *notifyPath, fleetRuns(results, started)...)
+
+	summaryPath := filepath.Join(*outDir, "fleet-report.json")
+	data, err := validation.FleetReportJSON(report)
+	mustSaveReport(sealer, summaryPath, data, err)
+
+	if *changeScript != "" {
+		if err := writeChangeScript(sealer, *changeScript, results, remediation.Options{NTPServer: *ntpServer}); err != nil {
+			log.Fatal("❌ Error writing change script:", err)
+		}
+		fmt.Println("🔧 Change script written to", *changeScript)
+	}
+
+	base.finish(normalOutput)
+	for _, r := range results {
+		switch r.Status {
+		case "success":
+			fmt.Printf("✅ %s: valid\n", r.Name)
+		case "unreachable":
+			fmt.Printf("⚠️  %s: %s\n", r.Name, r.Error)
+		default:
+			if r.Error != "" {
+				fmt.Printf("❌ %s: %s\n", r.Name, r.Error)
+			} else {
+				fmt.Printf("❌ %s: %d invalid lines\n", r.Name, len(r.Errors))
+			}
+		}
+	}
+	fmt.Printf("Fleet validation complete: %d/%d devices passed, score %d (%s). Summary written to %s\n",
+		report.Passed, report.Total, report.Score, report.Grade, summaryPath)
+	checkMinScore(report.Score, *minScore)
+}
+
+// writeChangeScript concatenates the per-device remediation snippets, each under a
+// header naming the device, into one file for the change ticket, sealed with sealer.
+// The snippets are rendered again, as the saved ones may be encrypted.
+func writeChangeScript(sealer *seal.Sealer, path string, results []validation.DeviceResult, opts remediation.Options) error {
+	var b strings.Builder
+	for _, r := range results {
+		if r.RemediationFile == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "! ===== %s (%s) =====\n", r.Name, r.Host)
+		b.WriteString(remediation.Snippet(r.Name, r.Findings, opts))
+		b.WriteString("\n")
+	}
+	return sealer.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// loadInventory reads the inventory and merges in credential sets from a separate file, if given.
+func loadInventory(inventoryFile, credentialsFile string) (*device.Inventory, error) {
+	inv, err := device.LoadInventory(inventoryFile)
+	if err != nil {
+		return nil, err
+	}
+	if credentialsFile != "" {
+		creds, err := device.LoadCredentials(credentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		if inv.Credentials == nil {
+			inv.Credentials = make(map[string]device.Credential)
+		}
+		for name, cred := range creds {
+			inv.Credentials[name] = cred
+		}
+	}
+	return inv, nil
+}
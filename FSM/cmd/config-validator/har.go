@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"config-validator/pkg/har"
+)
+
+// runHAR implements `config-validator har`: every entry of a HAR archive exported
+// from a browser or proxy is validated with the HTTP and body validators. -format
+// json prints the per-entry report.
+func runHAR(args []string) {
+	d := newDocumentRun("har")
+	specFile := d.fs.String("openapi", "", "OpenAPI 3 document (YAML or JSON) that requests must follow")
+	d.parse(args)
+	checks := contractChecks(*specFile)
+
+	content, err := os.ReadFile(*d.inputFile)
+	if err != nil {
+		log.Fatal("❌ Error reading file:", err)
+	}
+	entries, findings := har.Parse(content)
+	results := []har.Result{}
+	failed := 0
+	for _, e := range entries {
+		r := har.Check(e, checks...)
+		results = append(results, r)
+		findings = append(findings, r.Findings...)
+		if !r.Valid {
+			failed++
+		}
+	}
+	if *d.format == "text" {
+		for _, f := range findings {
+			d.print(f)
+		}
+		d.printed = true
+		if failed > 0 {
+			fmt.Printf("%d of %d entries have findings\n", failed, len(entries))
+		}
+	}
+	d.what = fmt.Sprintf("HAR (%d entries)", len(entries))
+	var detail any
+	if len(entries) > 0 {
+		detail = results
+	}
+	d.finish(findings, detail)
+}
@@ -0,0 +1,8 @@
+package main
+
+import "flag"
+
+// hardeningFlag adds -hardening to a command that validates configs.
+func hardeningFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("hardening", false, "Also report settings the config as a whole lacks: service password-encryption and an NTP server")
+}
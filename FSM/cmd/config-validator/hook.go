@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/config"
+	"config-validator/pkg/hook"
+	"config-validator/pkg/ignore"
+	"config-validator/pkg/plugin"
+	"config-validator/pkg/validation"
+)
+
+// runHook implements `config-validator hook pre-commit|pre-receive`. Only files matching
+// the configured patterns are validated; findings are printed one per line as
+// "path:line: message" and the exit code is 1 when any file is invalid (2 on errors).
+// Files and rules excluded by .nvpignore files are skipped.
+func runHook(args []string) {
+	if len(args) == 0 || (args[0] != "pre-commit" && args[0] != "pre-receive") {
+		fmt.Fprintln(os.Stderr, "usage: config-validator hook pre-commit|pre-receive [flags]")
+		os.Exit(2)
+	}
+	mode := args[0]
+
+	fs := flag.NewFlagSet("hook "+mode, flag.ExitOnError)
+	configPatterns := fs.String("configs", "*.cfg,*.conf", "Comma-separated globs of device config files")
+	jsonPatterns := fs.String("json", "*.json", "Comma-separated globs of JSON payload files")
+	rulesFile := fs.String("rules", defaultRules, "Rules file, https:// URL, oci:// reference, or builtin")
+	rulesKey := rulesKeyFlag(fs)
+	role := fs.String("role", "", "Device role (e.g. core, edge, access): use roles/<role>.yaml next to the rules file")
+	format := fs.String("format", "text", "Output format: text (path:line: message) or github (workflow annotations)")
+	pluginDir := fs.String("plugins", plugin.DefaultDir(), "Directory of validator plugins")
+	varsFile := fs.String("vars", "", "YAML/JSON vars substituted for Jinja2/ERB placeholders in config files")
+	wildcards := fs.Bool("template-wildcards", false, "Match placeholders without a value as wildcards instead of reporting them")
+	fs.Parse(args[1:])
+	opts := config.Options{Template: templateOptions(*varsFile, *wildcards)}
+	*rulesFile = mustResolveRules(*rulesFile, *rulesKey, *role)
+
+	configGlobs := splitList(*configPatterns)
+	jsonGlobs := splitList(*jsonPatterns)
+	all := append(append([]string{}, configGlobs...), jsonGlobs...)
+	plugins := loadPlugins(*pluginDir)
+
+	// With plugins installed every changed file is a candidate, since plugins
+	// detect their files by content as well as by name.
+	match := func(path string) bool { return hook.Match(path, all) || !plugins.Empty() }
+
+	var files []hook.File
+	var err error
+	if mode == "pre-commit" {
+		files, err = hook.StagedFiles(match)
+	} else {
+		files, err = hook.PushedFiles(os.Stdin, match)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "config-validator:", err)
+		os.Exit(2)
+	}
+
+	// Each revision has its own ignore files, read lazily as directories come up.
+	ignores := map[string]*ignore.Matcher{}
+	ignoresFor := func(rev string) *ignore.Matcher {
+		if ignores[rev] == nil {
+			ignores[rev] = ignore.NewMatcher(func(p string) ([]byte, error) { return hook.ReadFile(rev, p) })
+		}
+		return ignores[rev]
+	}
+
+	checked := 0
+	invalid := 0
+	for _, f := range files {
+		ignored := ignoresFor(f.Rev)
+		if ignored.Ignored(f.Path) {
+			continue
+		}
+		var findings []automata.Finding
+		if v := plugins.Detect(f.Path, f.Content); v != nil {
+			findings, err = v.Validate(f.Path, f.Content)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "config-validator:", err)
+				os.Exit(2)
+			}
+		} else if !hook.Match(f.Path, all) {
+			continue
+		} else if hook.Match(f.Path, configGlobs) {
+			fsm, err := config.ParseReaderOptions(bytes.NewReader(f.Content), *rulesFile, opts)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "config-validator:", err)
+				os.Exit(2)
+			}
+			findings = fsm.Findings
+		} else {
+			findings = validation.CheckJSON(f.Content)
+		}
+
+		findings = ignored.Filter(f.Path, findings)
+
+		checked++
+		if len(findings) > 0 {
+			invalid++
+		}
+		if *format == "github" {
+			validation.WriteGitHubAnnotations(os.Stdout, f.Path, findings)
+			continue
+		}
+		for _, finding := range findings {
+			fmt.Printf("%s:%d: %s\n", f.Path, finding.Line, finding.Message)
+		}
+	}
+
+	if invalid > 0 {
+		fmt.Fprintf(os.Stderr, "config-validator: %d of %d file(s) invalid, %s rejected\n", invalid, checked, hookSubject(mode))
+		os.Exit(1)
+	}
+}
+
+func hookSubject(mode string) string {
+	if mode == "pre-commit" {
+		return "commit"
+	}
+	return "push"
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/httpbody"
+	"config-validator/pkg/httpmsg"
+	"config-validator/pkg/httpsource"
+	"config-validator/pkg/mediatype"
+	"config-validator/pkg/openapi"
+)
+
+// runHTTP implements `config-validator http`: a captured HTTP/1.x request or response
+// is checked for its framing and Content-Type, and its body is validated by the
+// validator its media type selects (JSON, XML, multipart, ...). With -content-type,
+// the input is a bare body of that type. Requests may also be given as curl command
+// lines or .http request files, from which the raw messages are built, or embedded
+// in the string fields of a JSON fixture that -json-path selects.
+func runHTTP(args []string) {
+	d := newDocumentRun("http")
+	contentType := d.fs.String("content-type", "", "Media type of the input, which is then a bare body rather than an HTTP message")
+	inputFormat := d.fs.String("input-format", "auto", "Input format: raw (an HTTP message), curl (curl command lines), http-file (a .http request file), json (a JSON fixture, see -json-path), or auto")
+	jsonPath := d.fs.String("json-path", "", "JSONPath of the string fields of a JSON fixture that hold HTTP messages, e.g. '$.request' or '$.cases[*].response'")
+	stream := d.fs.Bool("stream", false, "The input is the client side of a connection: pipelined HTTP/1.1 requests, framed strictly as a server reads them")
+	show := d.fs.Bool("show", false, "Print the HTTP messages built from curl commands or .http files, or taken from JSON fixtures")
+	specFile := d.fs.String("openapi", "", "OpenAPI 3 document (YAML or JSON) that requests must follow")
+	d.parse(args)
+	d.what = "HTTP"
+	checks := contractChecks(*specFile)
+
+	content, err := os.ReadFile(*d.inputFile)
+	if err != nil {
+		log.Fatal("❌ Error reading file:", err)
+	}
+	var findings []automata.Finding
+	if *contentType != "" {
+		m, typeFindings := mediatype.Parse(*contentType, 0)
+		findings = append(typeFindings, httpbody.Check(m, content, 1)...)
+		d.what = m.Essence() + " content"
+		d.finish(findings, nil)
+		return
+	}
+
+	format := *inputFormat
+	if format == "auto" && *jsonPath != "" {
+		format = "json"
+	} else if format == "auto" {
+		format = detectHTTPFormat(*d.inputFile, content)
+	} else if *jsonPath != "" && format != "json" {
+		log.Fatal("❌ -json-path needs -input-format json")
+	}
+	if *stream {
+		if format != "raw" && *inputFormat != "auto" {
+			log.Fatal("❌ -stream needs -input-format raw")
+		}
+		format = "stream"
+	}
+	var requests []httpsource.Request
+	dir := filepath.Dir(*d.inputFile)
+	switch format {
+	case "raw":
+		parts := httpmsg.Split(content)
+		for i, part := range parts {
+			msg, msgFindings := httpmsg.Parse(part.Data)
+			msgFindings = append(msgFindings, httpbody.CheckMessage(msg)...)
+			for _, check := range checks {
+				msgFindings = append(msgFindings, check(msg)...)
+			}
+			if len(parts) > 1 {
+				for j := range msgFindings {
+					f := &msgFindings[j]
+					if f.Line >= 1 {
+						f.Line += part.Line - 1
+					} else {
+						f.Line = part.Line
+					}
+					f.Message = fmt.Sprintf("message %d: %s", i+1, f.Message)
+				}
+			}
+			findings = append(findings, msgFindings...)
+		}
+		if len(parts) > 1 {
+			d.what = fmt.Sprintf("HTTP messages (%d)", len(parts))
+		}
+		d.finish(findings, nil)
+		return
+	case "stream":
+		parts, streamFindings := httpmsg.Stream(content)
+		findings = streamFindings
+		for i, part := range parts {
+			msg, msgFindings := httpmsg.Parse(part.Data)
+			msgFindings = append(msgFindings, httpbody.CheckMessage(msg)...)
+			for _, check := range checks {
+				msgFindings = append(msgFindings, check(msg)...)
+			}
+			for j := range msgFindings {
+				f := &msgFindings[j]
+				if f.Line >= 1 {
+					f.Line += part.Line - 1
+				} else {
+					f.Line = part.Line
+				}
+				f.Message = httpmsg.Label(i+1, part.Offset) + f.Message
+			}
+			findings = append(findings, msgFindings...)
+		}
+		sort.SliceStable(findings, func(i, j int) bool { return findings[i].Line < findings[j].Line })
+		d.what = fmt.Sprintf("HTTP stream (%d requests)", len(parts))
+		d.finish(findings, nil)
+		return
+	case "curl":
+		requests = httpsource.Curl(content, dir)
+		d.what = "curl request"
+	case "http-file":
+		requests = httpsource.HTTPFile(content, dir)
+		d.what = ".http request"
+	case "json":
+		if *jsonPath == "" {
+			log.Fatal("❌ -input-format json needs -json-path")
+		}
+		var err error
+		if requests, findings, err = httpsource.JSONField(content, *jsonPath); err != nil {
+			log.Fatal("❌ Invalid -json-path: ", err)
+		}
+		if len(requests) == 0 && len(findings) == 0 {
+			log.Fatalf("❌ %s selects nothing in %s", *jsonPath, *d.inputFile)
+		}
+		if len(requests) == 0 {
+			d.finish(findings, nil)
+			return
+		}
+		d.what = "embedded HTTP message"
+	default:
+		log.Fatal("❌ Unknown input format: ", format)
+	}
+	if len(requests) == 0 {
+		log.Fatal("❌ No requests found in ", *d.inputFile)
+	}
+	for _, r := range requests {
+		if *show && *d.format == "text" && r.Message != nil {
+			where := fmt.Sprintf("%s:%d", *d.inputFile, r.Line)
+			if r.Path != "" {
+				where += " " + r.Path
+			}
+			fmt.Printf("# %s\n%s\n", where, r.Message)
+		}
+		findings = append(findings, r.Check(checks...)...)
+	}
+	if len(requests) > 1 {
+		d.what += fmt.Sprintf("s (%d)", len(requests))
+	}
+	d.finish(findings, nil)
+}
+
+// contractChecks loads the OpenAPI document, if one is given, as a check of requests.
+func contractChecks(specFile string) []func(*httpmsg.Message) []automata.Finding {
+	if specFile == "" {
+		return nil
+	}
+	spec, err := openapi.Load(specFile)
+	if err != nil {
+		log.Fatal("❌ Error loading OpenAPI document:", err)
+	}
+	return []func(*httpmsg.Message) []automata.Finding{spec.Check}
+}
+
+// detectHTTPFormat tells the input formats apart: .http and .rest files are request
+// files, and a file whose first command is curl holds curl command lines.
+func detectHTTPFormat(path string, content []byte) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".http", ".rest":
+		return "http-file"
+	case ".sh", ".curl":
+		return "curl"
+	}
+	for _, line := range bytes.Split(content, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		line = bytes.TrimPrefix(line, []byte("$ "))
+		if bytes.HasPrefix(line, []byte("curl ")) {
+			return "curl"
+		}
+		break
+	}
+	return "raw"
+}
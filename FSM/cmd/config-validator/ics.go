@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/capture"
+	"config-validator/pkg/ics"
+)
+
+// runICS implements `config-validator ics`: the connections of an industrial
+// protocol, Modbus/TCP by default, are validated from a pcap or pcapng capture, with
+// responses paired to their requests. Any other input is taken as the raw stream one
+// side sent.
+func runICS(args []string) {
+	d := newDocumentRun("ics")
+	protocol := d.fs.String("protocol", "modbus", "Protocol to validate: "+strings.Join(ics.Names(), ", "))
+	port := d.fs.Int("port", 0, "Server port of the protocol in captures (its well-known port when 0)")
+	side := d.fs.String("side", "client", "Side that sent a raw stream: client or server")
+	d.captureFlags(true)
+	d.flowReport()
+	d.parse(args)
+	p, ok := ics.Protocols[*protocol]
+	if !ok {
+		log.Fatalf("❌ Unknown protocol %q; known: %s", *protocol, strings.Join(ics.Names(), ", "))
+	}
+	if *side != "server" && *side != "client" {
+		log.Fatal("❌ -side must be client or server")
+	}
+	if *port == 0 {
+		*port = p.Port
+	}
+	d.what = p.Name
+
+	content, err := os.ReadFile(*d.inputFile)
+	if err != nil {
+		log.Fatal("❌ Error reading file:", err)
+	}
+	if !capture.IsCapture(content) {
+		clientFindings, serverFindings := p.Check(content, nil)
+		if *side == "server" {
+			clientFindings, serverFindings = p.Check(nil, content)
+		}
+		d.finish(append(clientFindings, serverFindings...), nil)
+		return
+	}
+
+	var findings []automata.Finding
+	n := 0
+	for _, c := range d.readConversations(content) {
+		if int(c.Flow.Dst.Port()) != *port {
+			continue
+		}
+		n++
+		d.flows.Conversation(c)
+		clientFindings, serverFindings := p.Check(captured(c.Client), captured(c.Server))
+		findings = append(findings, d.streamFindings(c.Flow, "client", *protocol, c.Client, len(c.Client.Data), clientFindings)...)
+		findings = append(findings, d.streamFindings(c.Flow.Reverse(), "server", *protocol, c.Server, len(c.Server.Data), serverFindings)...)
+	}
+	if n == 0 {
+		log.Fatalf("❌ No %s connections to port %d found in %s", p.Name, *port, *d.inputFile)
+	}
+	d.what = fmt.Sprintf("%s (connections checked: %d)", p.Name, n)
+	d.finish(findings, nil)
+}
+
+// captured returns what one side of a connection sent, or nil when none of its
+// packets were captured.
+func captured(st capture.Stream) []byte {
+	if st.Packets == 0 {
+		return nil
+	}
+	if st.Data == nil {
+		return []byte{}
+	}
+	return st.Data
+}
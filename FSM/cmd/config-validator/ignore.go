@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+
+	"config-validator/pkg/archive"
+	"config-validator/pkg/device"
+	"config-validator/pkg/ignore"
+)
+
+// archiveIgnores returns a Matcher over the ignore files inside an archive. They are
+// read in a pass of their own, as they may come after the files they apply to. Entry
+// names are cleaned, so that "./configs/a.cfg" and "configs/a.cfg" are the same path.
+func archiveIgnores(inputFile string) (*ignore.Matcher, error) {
+	files := map[string][]byte{}
+	err := archive.Walk(inputFile, func(name string) bool { return path.Base(name) == ignore.FileName }, func(e archive.Entry) error {
+		files[path.Clean(e.Name)] = e.Content
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ignore.NewMatcher(func(p string) ([]byte, error) {
+		if content, ok := files[p]; ok {
+			return content, nil
+		}
+		return nil, os.ErrNotExist
+	}), nil
+}
+
+// inventoryIgnores returns a Matcher over the ignore files next to an inventory. Device
+// names stand in for the file paths, relative to the inventory's directory, so that
+// `lab-*` skips the lab devices and `rule hardening.ntp edge-*` accepts an exception.
+func inventoryIgnores(inventoryFile string) *ignore.Matcher {
+	dir := filepath.Dir(inventoryFile)
+	return ignore.NewMatcher(func(p string) ([]byte, error) {
+		return os.ReadFile(filepath.Join(dir, filepath.FromSlash(p)))
+	})
+}
+
+// skipIgnored drops the devices the ignore files skip from the inventory.
+func skipIgnored(inv *device.Inventory, ignores *ignore.Matcher) {
+	var kept []device.Device
+	for _, d := range inv.Devices {
+		if !ignores.Ignored(d.Name) {
+			kept = append(kept, d)
+		}
+	}
+	inv.Devices = kept
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/jwtcheck"
+)
+
+// runJWT implements `config-validator jwt`: every token in the input (one per line,
+// captured Authorization headers, or tokens inside log lines) is checked for its
+// structure and registered claims, and its signature when -key is given.
+func runJWT(args []string) {
+	d := newDocumentRun("jwt")
+	keyFile := d.fs.String("key", "", "Verification key: PEM public key, certificate, or private key, or a file holding an HMAC secret")
+	d.parse(args)
+
+	var opts jwtcheck.Options
+	if *keyFile != "" {
+		var err error
+		if opts.Key, err = jwtcheck.LoadKey(*keyFile); err != nil {
+			log.Fatal("❌ Error loading key:", err)
+		}
+	}
+	content, err := os.ReadFile(*d.inputFile)
+	if err != nil {
+		log.Fatal("❌ Error reading file:", err)
+	}
+	tokens := jwtcheck.Tokens(content)
+	if len(tokens) == 0 {
+		log.Fatal("❌ No tokens found in ", *d.inputFile)
+	}
+	var findings []automata.Finding
+	for _, token := range tokens {
+		findings = append(findings, jwtcheck.Check(token, opts)...)
+	}
+	d.finish(findings, nil)
+}
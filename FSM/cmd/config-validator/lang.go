@@ -0,0 +1,23 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"config-validator/pkg/i18n"
+)
+
+// langFlag adds -lang to a command that reports findings.
+func langFlag(fs *flag.FlagSet) *string {
+	return fs.String("lang", os.Getenv("CONFIG_VALIDATOR_LANG"), "Language of finding messages (en, es, ta); codes stay the same")
+}
+
+// mustCatalog loads the message catalog of -lang.
+func mustCatalog(lang string) *i18n.Catalog {
+	c, err := i18n.Load(lang)
+	if err != nil {
+		log.Fatal("❌ Error loading messages:", err)
+	}
+	return c
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/buildinfo"
+	"config-validator/pkg/config"
+	"config-validator/pkg/hook"
+	"config-validator/pkg/lsp"
+	"config-validator/pkg/remediation"
+	"config-validator/pkg/validation"
+)
+
+// runLSP implements `config-validator lsp`: a language server on stdin and stdout
+// that validates open config files and JSON payloads as they are edited, publishes
+// the findings as diagnostics, and offers their fixes as quick fixes. Documents are
+// recognized by their language ID (json, jsonc) or by name, with the same globs as
+// the git hooks. Configs are revalidated incrementally: after an edit, only the
+// blocks that changed go through the FSM again.
+func runLSP(args []string) {
+	fs := flag.NewFlagSet("lsp", flag.ExitOnError)
+	configPatterns := fs.String("configs", "*.cfg,*.conf,*.ios", "Comma-separated globs of device config files")
+	jsonPatterns := fs.String("json", "*.json", "Comma-separated globs of JSON payload files")
+	rulesFile := fs.String("rules", defaultRules, "Rules file, https:// URL, oci:// reference, or builtin")
+	rulesKey := rulesKeyFlag(fs)
+	sandboxed := fs.Bool("sandboxed", false, "Only run WASM rule checks, refusing Starlark scripts")
+	watch := fs.Duration("watch", 2*time.Second, "How often to check the rules files for changes (0 disables hot reload)")
+	ntpServer := fs.String("ntp-server", "", "NTP server to use in quick fixes")
+	hardening := hardeningFlag(fs)
+	fs.Parse(args)
+
+	// stdout carries the protocol, so everything else is logged to stderr
+	log.SetOutput(os.Stderr)
+	rules := mustReloader(*rulesFile, *rulesKey, config.Options{Sandboxed: *sandboxed, Hardening: *hardening})
+	if *watch > 0 {
+		go rules.Watch(context.Background(), *watch)
+	}
+	configGlobs := splitList(*configPatterns)
+	jsonGlobs := splitList(*jsonPatterns)
+	isJSON := func(uri, languageID string) bool {
+		return languageID == "json" || languageID == "jsonc" || hook.Match(documentName(uri), jsonGlobs)
+	}
+
+	// Open configs by URI, each tied to the rule set it was validated with
+	docs := map[string]*config.Document{}
+	s := &lsp.Server{
+		Name:    "config-validator",
+		Version: buildinfo.Get().Version,
+		Validate: func(uri, languageID string, text []byte) ([]automata.Finding, bool) {
+			name := documentName(uri)
+			switch {
+			case isJSON(uri, languageID):
+				return validation.CheckJSON(text), true
+			case hook.Match(name, configGlobs):
+				rs := rules.Current()
+				doc := docs[uri]
+				if doc == nil || doc.RuleSet() != rs {
+					doc = rs.NewDocument()
+					docs[uri] = doc
+				}
+				findings, err := doc.Validate(context.Background(), text)
+				if err != nil {
+					log.Println("❌ Error validating", name+":", err)
+					return nil, false
+				}
+				return findings, true
+			}
+			return nil, false
+		},
+		// Quick fixes: the JSON repair of a syntax error, and the remediation
+		// commands of config findings applied in place
+		Fixes: func(uri, languageID string, text []byte, f automata.Finding) []lsp.Fix {
+			if isJSON(uri, languageID) {
+				if r, ok := validation.RepairJSON(text); ok {
+					return []lsp.Fix{{Title: r.Title, Offset: r.Offset, Length: r.Length, Text: r.Text}}
+				}
+				return nil
+			}
+			if e, ok := remediation.EditFor(text, f, remediation.Options{NTPServer: *ntpServer}); ok {
+				return []lsp.Fix{{Title: e.Title, Offset: e.Offset, Length: e.Length, Text: e.Text}}
+			}
+			return nil
+		},
+		Closed: func(uri string) { delete(docs, uri) },
+	}
+	if err := s.Serve(os.Stdin, os.Stdout); err != nil {
+		log.Fatal("❌ Language server failed:", err)
+	}
+}
+
+// documentName is the path of a file:// URI, which globs are matched against.
+func documentName(uri string) string {
+	if u, err := url.Parse(uri); err == nil && u.Path != "" {
+		return u.Path
+	}
+	return uri
+}
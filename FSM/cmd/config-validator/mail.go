@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/capture"
+	"config-validator/pkg/mailcheck"
+	"config-validator/pkg/session"
+)
+
+// runPOP3 implements `config-validator pop3`: POP3 sessions are validated against
+// the protocol's AUTHORIZATION, TRANSACTION, and UPDATE states.
+func runPOP3(args []string) {
+	runMailSession("pop3", "POP3", 110, false, mailcheck.CheckPOP3, args)
+}
+
+// runIMAP implements `config-validator imap`: IMAP sessions are validated for the
+// commands each state allows, tagged responses, and literals.
+func runIMAP(args []string) {
+	runMailSession("imap", "IMAP", 143, true, mailcheck.CheckIMAP, args)
+}
+
+// runMailSession validates the sessions of a mail access protocol, from a transcript
+// of C: and S: lines, or from the connections to its port in a pcap or pcapng
+// capture. literals splits out IMAP literals.
+func runMailSession(kind, name string, defaultPort int, literals bool, check func([]session.Event) []automata.Finding, args []string) {
+	d := newDocumentRun(kind)
+	port := d.fs.Int("port", defaultPort, "Server port of "+name+" connections in captures")
+	d.captureFlags(true)
+	d.flowReport()
+	d.parse(args)
+	d.what = name
+
+	content, err := os.ReadFile(*d.inputFile)
+	if err != nil {
+		log.Fatal("❌ Error reading file:", err)
+	}
+	findings, n := sessionFindings(d, content, name, *port, literals, check)
+	if n > 0 {
+		d.what = fmt.Sprintf("%s (sessions checked: %d)", name, n)
+	}
+	d.finish(findings, nil)
+}
+
+// sessionFindings runs check over a transcript, or over the connections to port in
+// a capture, port 0 meaning every connection. It returns the findings and the
+// number of connections checked, 0 for transcripts.
+func sessionFindings(d *documentRun, content []byte, name string, port int, literals bool, check func([]session.Event) []automata.Finding) ([]automata.Finding, int) {
+	if !capture.IsCapture(content) {
+		chunks, findings := session.ParseTranscript(content)
+		return append(findings, check(session.Events(chunks, literals))...), 0
+	}
+
+	var findings []automata.Finding
+	n := 0
+	layer := strings.ToLower(name)
+	for _, c := range d.readConversations(content) {
+		if port != 0 && int(c.Flow.Dst.Port()) != port {
+			continue
+		}
+		n++
+		d.flows.Conversation(c)
+		findings = append(findings, d.streamFindings(c.Flow, "client", layer, c.Client, len(c.Client.Data), nil)...)
+		findings = append(findings, d.streamFindings(c.Flow.Reverse(), "server", layer, c.Server, len(c.Server.Data), nil)...)
+		f := check(session.Events(session.FromConversation(c), literals))
+		d.flows.Add(c.Flow, layer, f)
+		for i := range f {
+			f[i].Message = fmt.Sprintf("%s %s", c.Flow, f[i].Message)
+		}
+		findings = append(findings, f...)
+	}
+	if n == 0 && port != 0 {
+		log.Fatalf("❌ No %s connections to port %d found in %s", name, port, *d.inputFile)
+	}
+	if n == 0 {
+		log.Fatalf("❌ No TCP connections found in %s", *d.inputFile)
+	}
+	return findings, n
+}
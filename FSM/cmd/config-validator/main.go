@@ -1,32 +1,458 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"regexp"
+	"time"
 
+	"config-validator/pkg/archive"
+	"config-validator/pkg/automata"
+	"config-validator/pkg/buildinfo"
 	"config-validator/pkg/config"
+	"config-validator/pkg/demo"
+	"config-validator/pkg/i18n"
+	"config-validator/pkg/ownership"
+	"config-validator/pkg/plugin"
+	"config-validator/pkg/policy"
+	"config-validator/pkg/progress"
+	"config-validator/pkg/remediation"
+	"config-validator/pkg/remote"
+	"config-validator/pkg/seal"
+	"config-validator/pkg/telemetry"
 	"config-validator/pkg/validation"
 )
 
 func main() {
+	// Subcommands are picked off the first argument; anything else is the
+	// classic single-file validation run.
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "fetch":
+			runFetch(os.Args[2:])
+			return
+		case "validate-fleet":
+			runValidateFleet(os.Args[2:])
+			return
+		case "daemon":
+			runDaemon(os.Args[2:])
+			return
+		case "report":
+			runReport(os.Args[2:])
+			return
+		case "admission":
+			runAdmission(os.Args[2:])
+			return
+		case "hook":
+			runHook(os.Args[2:])
+			return
+		case "plugins":
+			runPlugins(os.Args[2:])
+			return
+		case "explain-line":
+			runExplainLine(os.Args[2:])
+			return
+		case "rules":
+			runRules(os.Args[2:])
+			return
+		case "yaml":
+			runYAML(os.Args[2:])
+			return
+		case "xml":
+			runXML(os.Args[2:])
+			return
+		case "toml":
+			runTOML(os.Args[2:])
+			return
+		case "ini":
+			runINI(os.Args[2:])
+			return
+		case "csv":
+			runCSV(os.Args[2:])
+			return
+		case "graphql":
+			runGraphQL(os.Args[2:])
+			return
+		case "proto":
+			runProto(os.Args[2:])
+			return
+		case "cbor":
+			runCBOR(os.Args[2:])
+			return
+		case "msgpack":
+			runMsgPack(os.Args[2:])
+			return
+		case "jwt":
+			runJWT(os.Args[2:])
+			return
+		case "http":
+			runHTTP(os.Args[2:])
+			return
+		case "har":
+			runHAR(os.Args[2:])
+			return
+		case "proxy":
+			runProxy(os.Args[2:])
+			return
+		case "ssh":
+			runSSH(os.Args[2:])
+			return
+		case "ics":
+			runICS(os.Args[2:])
+			return
+		case "netflow":
+			runNetFlow(os.Args[2:])
+			return
+		case "pop3":
+			runPOP3(os.Args[2:])
+			return
+		case "imap":
+			runIMAP(os.Args[2:])
+			return
+		case "rtsp":
+			runRTSP(os.Args[2:])
+			return
+		case "udp":
+			runUDP(os.Args[2:])
+			return
+		case "discovery":
+			runDiscovery(os.Args[2:])
+			return
+		case "eapol":
+			runEAPOL(os.Args[2:])
+			return
+		case "session":
+			runSession(os.Args[2:])
+			return
+		case "version":
+			runVersion(os.Args[2:])
+			return
+		case "selftest":
+			runSelftest(os.Args[2:])
+			return
+		case "lsp":
+			runLSP(os.Args[2:])
+			return
+		case "completion":
+			runCompletion(os.Args[2:])
+			return
+		case "man":
+			runMan(os.Args[2:])
+			return
+		}
+	}
+
 	// CLI flags
-	inputFile := flag.String("input", "test/sample_config.txt", "Cisco config file to validate")
-	outputFile := flag.String("out", "test/report.json", "Path to JSON validation report")
-	rulesFile := flag.String("rules", "pkg/automata/rules.yaml", "Path to YAML rules file")
+	inputFile := flag.String("input", "", "Cisco config file to validate, or s3://, gs://, https:// URL (the built-in demo config when empty)")
+	outputFile := flag.String("out", "report.json", "Path to JSON validation report")
+	rulesFile := flag.String("rules", defaultRules, "Rules file, https:// URL, oci:// reference, or builtin")
+	rulesKey := rulesKeyFlag(flag.CommandLine)
+	dbPath := flag.String("db", defaultDB(), "SQLite result store to record the run in (disabled when empty)")
+	format := flag.String("format", "text", "Output format: text (findings grouped by severity on stdout), json (report file only), github (also print workflow annotations), or csv/xlsx (also export the findings as a spreadsheet next to the report)")
+	role := flag.String("role", "", "Device role (e.g. core, edge, access): use roles/<role>.yaml next to the rules file")
+	pluginDir := flag.String("plugins", plugin.DefaultDir(), "Directory of validator plugins")
+	notifyPath := flag.String("notify", "", "Notification config (YAML) for failures and new findings")
+	policyFile := flag.String("policy", "", "Policy pack (YAML) whose controls are reported as a compliance matrix")
+	minScore := flag.Int("min-score", 0, "Exit with status 1 if the config's score (0-100) is below this")
+	hardening := hardeningFlag(flag.CommandLine)
+	ntpServer := flag.String("ntp-server", "", "NTP server to use in remediation snippets")
+	varsFile := flag.String("vars", "", "YAML/JSON vars substituted for Jinja2/ERB placeholders in the input")
+	wildcards := flag.Bool("template-wildcards", false, "Match placeholders without a value as wildcards instead of reporting them")
+	archiveConfigs := flag.String("archive-configs", "*.cfg,*.conf,*.txt", "Comma-separated globs of config files validated inside a .zip/.tar.gz input")
+	archiveJSON := flag.String("archive-json", "*.json", "Comma-separated globs of JSON payload files validated inside a .zip/.tar.gz input")
+	quiet := flag.Bool("quiet", false, "Do not report progress on stderr while validating an archive")
+	verbosityFlags := addVerbosityFlags(flag.CommandLine)
+	filterFlags := addFilterFlags(flag.CommandLine)
+	baselineFlags := addBaselineFlags(flag.CommandLine)
+	ownersFile := ownersFlag(flag.CommandLine)
+	redactPattern := redactFlag(flag.CommandLine)
+	sealing := addSealFlags(flag.CommandLine)
+	maxLineLength := flag.Int("max-line-length", config.DefaultMaxLineLength, "Report lines longer than this many bytes (negative disables)")
+	maxMemory := flag.String("max-memory", "", "Stop with an error if the run uses more memory than this (e.g. 512M, 2G)")
+	profile := flag.String("profile", "", "Write CPU and heap profiles of the run to <prefix>.cpu.pprof and <prefix>.heap.pprof")
+	lang := langFlag(flag.CommandLine)
+	flag.Usage = usage
 	flag.Parse()
+	// Arguments left over are most likely a mistyped subcommand, which would otherwise
+	// validate the demo config and pass
+	if flag.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "config-validator: unknown command or argument %q\n\n", flag.Arg(0))
+		flag.Usage()
+		os.Exit(2)
+	}
+	checkNotify(*notifyPath, *dbPath)
+	level := verbosityFlags.level()
+	filter := filterFlags.filter()
+	base := baselineFlags.open()
+	owners := mustOwners(*ownersFile)
+	redact := mustRedact(*redactPattern)
+	sealer := sealing.sealer()
+	timer := newStageTimer()
+	messages := mustCatalog(*lang)
+	started := time.Now()
+	limitMemory(*maxMemory)
+	stopProfile := startProfile(*profile)
+	stopTelemetry := telemetry.Init("config-validator", buildinfo.Get().Version)
+	ctx, runSpan := telemetry.Start(context.Background(), "config-validator")
+	defer stopTelemetry()
+	defer runSpan.End()
+	runSpan.SetAttr("validator.input", *inputFile)
+
+	var pack *policy.Pack
+	if *policyFile != "" {
+		var err error
+		if pack, err = policy.Load(*policyFile); err != nil {
+			log.Fatal("❌ Error loading policy pack:", err)
+		}
+		// The pack's own rules apply unless -rules was given explicitly.
+		if pack.Rules != "" && !flagSet(flag.CommandLine, "rules") {
+			*rulesFile = pack.Rules
+		}
+	}
+	*rulesFile = mustResolveRules(*rulesFile, *rulesKey, *role)
+
+	checkFormat(*format)
+
+	opts := config.Options{
+		Template:      templateOptions(*varsFile, *wildcards),
+		MaxLineLength: *maxLineLength,
+		Hardening:     *hardening,
+	}
+	if level == traceOutput {
+		opts.Trace = traceLine
+	}
+
+	// Remote inputs are fetched to a temporary copy; reports still name the URL
+	source := *inputFile
+	cleanup := func() {}
+	if source == "" {
+		local, remove, err := demo.WriteConfig()
+		if err != nil {
+			log.Fatal("❌ Error writing demo config:", err)
+		}
+		if level > quietOutput {
+			fmt.Println("📄 No -input given, validating the built-in demo config")
+		}
+		source, *inputFile, cleanup = demo.Name, local, remove
+	} else if remote.IsRemote(source) {
+		local, remove, err := remote.Download(source)
+		if err != nil {
+			log.Fatal("❌ Error fetching input:", err)
+		}
+		if level > quietOutput {
+			fmt.Println("🌐 Fetched", source)
+		}
+		*inputFile, cleanup = local, remove
+	}
+
+	// Archives are validated entry by entry, with a report covering every entry
+	if archive.IsArchive(*inputFile) {
+		if pack != nil {
+			log.Fatal("❌ -policy is not supported for archive inputs")
+		}
+		var bar *progress.Reporter
+		if !*quiet && level > quietOutput {
+			bar = progress.New(os.Stderr, "files", 0)
+		}
+		report := validateArchive(ctx, *inputFile, *rulesFile, opts, *pluginDir, splitList(*archiveConfigs), splitList(*archiveJSON), bar)
+		bar.Finish()
+		timer.done("validate")
+		report.Archive = source
+		for i, e := range report.Entries {
+			report.Entries[i].Findings = validation.Redact(messages.LocalizeAll(e.Findings), redact)
+			report.Entries[i].Errors = validation.FormatFindings(report.Entries[i].Findings)
+			owners.Annotate(e.Name, report.Entries[i].Findings)
+			report.Entries[i].Owners = validation.FindingsByOwner(report.Entries[i].Findings)
+		}
+		// The result store and notifications get every finding; the filters and the
+		// baseline only narrow what is reported
+		runs := archiveRuns(source, *rulesFile, started, report)
+		if filter.Active() {
+			report = filterArchiveReport(report, filter)
+		}
+		if base != nil {
+			report = rebuildArchiveReport(report, func(e validation.EntryResult) []automata.Finding { return base.apply(e.Name, e.Findings) })
+		}
+		data, err := validation.ArchiveReportJSON(report)
+		mustSaveReport(sealer, *outputFile, data, err)
+		finishRuns(*dbPath, *notifyPath, runs...)
+		cleanup()
+		stopProfile()
+		// Ended here as well as deferred, as a failing -min-score exits without the defers
+		runSpan.End()
+		stopTelemetry()
+		timer.done("report")
+		if level >= verboseOutput {
+			timer.print()
+		}
+		base.finish(level)
+		printArchiveReport(report, *format, *outputFile, sealer, filter.MaxFindings, level)
+		checkMinScore(report.Score, *minScore)
+		return
+	}
+
+	var findings []automata.Finding
+	var recorded []automata.Finding // findings before the filters and the baseline, for finishRuns
+	var ruleStats *automata.Stats   // of the FSM, for -v
+	if v := detectPlugin(*pluginDir, *inputFile); v != nil {
+		// A plugin claimed the input, so it is not a Cisco config
+		content, err := os.ReadFile(*inputFile)
+		if err != nil {
+			log.Fatal("❌ Error reading file:", err)
+		}
+		findings, err = v.Validate(source, content)
+		if err != nil {
+			log.Fatal("❌ Plugin "+v.Name()+" failed:", err)
+		}
+		timer.done("validate")
+		recorded = validation.Redact(messages.LocalizeAll(findings), redact)
+		owners.Annotate(source, recorded)
+		findings = base.apply(source, filter.Apply(recorded))
+		data, err := validation.FindingsReportJSON(findings)
+		mustSaveReport(sealer, *outputFile, data, err)
+	} else {
+		// Parse Cisco config with FSM + rules
+		file, err := os.Open(*inputFile)
+		if err != nil {
+			log.Fatal("❌ Error reading file:", err)
+		}
+		rules, err := config.LoadRuleSet(*rulesFile, opts)
+		if err != nil {
+			log.Fatal("❌ Error parsing file:", err)
+		}
+		timer.done("rules")
+		fsm, err := rules.ParseContext(ctx, file)
+		file.Close()
+		if err != nil {
+			log.Fatal("❌ Error parsing file:", err)
+		}
+		timer.done("validate")
+		ruleStats = fsm.Stats()
+
+		// Generate JSON report, with the compliance matrix when a policy pack is used
+		_, encodeSpan := telemetry.Start(ctx, "report.encode")
+		var data []byte
+		// Policy controls match the English messages, so they are evaluated first
+		if pack != nil {
+			matrix := evaluatePolicy(pack, *inputFile, fsm)
+			validation.RedactMatrix(matrix, redact)
+			recorded = prepareFSM(fsm, source, messages, redact, owners)
+			filter.ApplyFSM(fsm)
+			base.applyFSM(source, fsm)
+			data, err = validation.PolicyReportJSON(fsm, matrix)
+		} else {
+			recorded = prepareFSM(fsm, source, messages, redact, owners)
+			filter.ApplyFSM(fsm)
+			base.applyFSM(source, fsm)
+			data, err = validation.ReportJSON(fsm)
+		}
+		mustSaveReport(sealer, *outputFile, data, err)
+		encodeSpan.EndStage()
+		findings = fsm.Findings
 
-	// Parse Cisco config with FSM + rules
-	fsm, err := config.ParseFile(*inputFile, *rulesFile)
-	if err != nil {
-		log.Fatal("❌ Error parsing file:", err)
+		// Findings with known fixes get a config snippet next to the report
+		fixFile := remediation.File(*outputFile)
+		written, err := remediation.Write(fixFile, source, findings, remediation.Options{NTPServer: *ntpServer}, sealer)
+		if err != nil {
+			log.Fatal("❌ Error writing remediation snippet:", err)
+		}
+		if written && level > quietOutput {
+			fmt.Println("🔧 Remediation snippet written to", fixFile)
+		}
 	}
 
-	// Generate JSON report
-	err = validation.GenerateReport(fsm, *outputFile)
-	if err != nil {
-		log.Fatal("❌ Error generating report:", err)
+	finishRuns(*dbPath, *notifyPath, fileRun(source, *inputFile, *rulesFile, started, recorded))
+	cleanup()
+	stopProfile()
+	// Ended here as well as deferred, as a failing -min-score exits without the defers
+	runSpan.End()
+	stopTelemetry()
+	timer.done("report")
+	if level >= verboseOutput {
+		timer.print()
+		if ruleStats != nil {
+			printRuleStats(ruleStats)
+		}
 	}
+	base.finish(level)
+
+	printFindings(source, *outputFile, *format, sealer, findings, filter.MaxFindings, level, *minScore)
+}
+
+// usage prints the subcommands and the flags of the single-file validation run.
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "Usage: config-validator [flags]")
+	fmt.Fprintln(out, "       config-validator <command> [flags]")
+	fmt.Fprintln(out, "\nCommands:")
+	for _, c := range commands {
+		if c.path != "" {
+			fmt.Fprintf(out, "  %-18s %s\n", c.path, c.summary)
+		}
+	}
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
+}
+
+// printFindings prints the findings of a file's report in format, exporting them next
+// to the report, sealed with sealer, for csv and xlsx, and applies -min-score to their
+// score. Only the first limit findings are printed or exported (all when 0); the
+// score, the summary, and the exit status cover all of them.
+func printFindings(source, outputFile, format string, sealer *seal.Sealer, findings []automata.Finding, limit int, level verbosity, minScore int) {
+	score := validation.Score(findings)
+	shown := validation.LimitFiles([]validation.FileFindings{{File: source, Findings: findings}}, limit)[0]
+	switch format {
+	case "csv", "xlsx":
+		exportFile := exportPath(outputFile, format)
+		if err := writeExport(sealer, exportFile, format, shown); err != nil {
+			log.Fatal("❌ Error exporting findings:", err)
+		}
+		if level > quietOutput {
+			fmt.Println("📊 Findings exported to", exportFile)
+		}
+		fallthrough
+	case "json":
+		fmt.Printf("✅ Validation complete, score %d (%s). Report written to %s\n", score, validation.Grade(score), outputFile)
+	case "text":
+		validation.WriteConsole(os.Stdout, []validation.FileFindings{{File: source, Findings: findings}}, validation.ConsoleOptions{
+			Color:       validation.UseColor(os.Stdout),
+			Summary:     fmt.Sprintf("score %d (%s), report written to %s", score, validation.Grade(score), outputFile),
+			SummaryOnly: level == quietOutput,
+			MaxFindings: limit,
+		})
+	case "github":
+		validation.WriteGitHubAnnotations(os.Stdout, source, shown.Findings)
+		if len(findings) > 0 {
+			os.Exit(1) // fail the workflow step
+		}
+	}
+	checkMinScore(score, minScore)
+}
+
+// checkFormat stops with an error for a -format that is not supported.
+func checkFormat(format string) {
+	if _, ok := exportFormats[format]; !ok && format != "text" && format != "json" && format != "github" {
+		log.Fatal("❌ Unknown format: ", format)
+	}
+}
+
+// checkMinScore exits with status 1 when a score is below the -min-score threshold.
+func checkMinScore(score, minScore int) {
+	if score < minScore {
+		fmt.Printf("❌ Score %d is below the minimum of %d\n", score, minScore)
+		os.Exit(1)
+	}
+}
 
-	fmt.Println("✅ Validation complete. Report written to", *outputFile)
+// prepareFSM localizes, redacts, and annotates the findings of a validation run, and
+// returns a copy of them for the result store and notifications, which the filters
+// and the baseline then applied to fsm leave whole.
+func prepareFSM(fsm *automata.FSM, source string, messages *i18n.Catalog, redact *regexp.Regexp, owners *ownership.Map) []automata.Finding {
+	messages.LocalizeFSM(fsm)
+	validation.RedactFSM(fsm, redact)
+	owners.Annotate(source, fsm.Findings)
+	return append([]automata.Finding(nil), fsm.Findings...)
 }
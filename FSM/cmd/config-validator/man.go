@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"config-validator/pkg/buildinfo"
+)
+
+// manEnvironment lists the environment variables the commands read.
+var manEnvironment = [][2]string{
+	{"CONFIG_VALIDATOR_DB", "Result store used when -db is not given."},
+	{"CONFIG_VALIDATOR_CACHE", "Directory remote rule packs and the built-in rules are cached in."},
+	{"CONFIG_VALIDATOR_RULES_KEY", "PEM ed25519 public key remote rule packs must be signed with."},
+	{"CONFIG_VALIDATOR_PACKS", "Directory rules update installs packs and rules.lock in."},
+	{"CONFIG_VALIDATOR_REGISTRY", "Registry index rules update uses when -registry is not given."},
+	{"CONFIG_VALIDATOR_SIGN_KEY", "PEM ed25519 private key saved files are signed with (-sign-key)."},
+	{"CONFIG_VALIDATOR_VERIFY_KEY", "PEM ed25519 public key report verify checks signatures with (-key)."},
+	{"CONFIG_VALIDATOR_PLUGINS", "Directory of validator plugins."},
+	{"CONFIG_VALIDATOR_PASSWORD", "SSH password for fetch and validate-fleet."},
+	{"CONFIG_VALIDATOR_INPUT_TOKEN", "Bearer token sent when fetching https:// inputs."},
+	{"OTEL_EXPORTER_OTLP_ENDPOINT", "OTLP/HTTP collector that traces and metrics are exported to."},
+}
+
+// runMan implements `config-validator man`: the man page, generated from the
+// subcommands and their flags, is printed or, with -dir, written as
+// config-validator.1 into the directory.
+func runMan(args []string) {
+	fs := flag.NewFlagSet("man", flag.ExitOnError)
+	dir := fs.String("dir", "", "Write config-validator.1 into this directory instead of printing it")
+	fs.Parse(args)
+
+	page := manPage(commandFlags(), time.Now())
+	if *dir == "" {
+		fmt.Print(page)
+		return
+	}
+	out := filepath.Join(*dir, "config-validator.1")
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		log.Fatal("❌ Error creating directory:", err)
+	}
+	if err := os.WriteFile(out, []byte(page), 0o644); err != nil {
+		log.Fatal("❌ Error writing man page:", err)
+	}
+	fmt.Println("✅ Man page written to", out)
+}
+
+// manPage renders the man page in roff (man macros).
+func manPage(flags map[string][]commandFlag, date time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, ".TH CONFIG-VALIDATOR 1 %q %q \"User Commands\"\n", date.Format("2006-01-02"), "config-validator "+buildinfo.Get().Version)
+	b.WriteString(".SH NAME\nconfig-validator \\- validate network device configs and protocol payloads with automata\n")
+	b.WriteString(".SH SYNOPSIS\n.B config-validator\n[\\fIflags\\fR]\n.br\n.B config-validator\n\\fIcommand\\fR [\\fIflags\\fR] [\\fIfile\\fR]\n")
+	b.WriteString(".SH DESCRIPTION\n")
+	b.WriteString("Without a command, a Cisco config is validated with a finite-state machine whose rules are declared in YAML, ")
+	b.WriteString("and a JSON report is written. The commands validate devices, fleets, and other documents and payloads, ")
+	b.WriteString("serve results and webhooks, and manage rules. Flags may be written with one or two dashes.\n")
+	b.WriteString(".SH OPTIONS\n")
+	writeManFlags(&b, flags[""])
+	b.WriteString(".SH COMMANDS\n")
+	for _, c := range commands {
+		if c.path == "" {
+			continue
+		}
+		fmt.Fprintf(&b, ".SS %s\n%s.\n", roffEscape(c.path), roffEscape(c.summary))
+		switch c.path {
+		case "completion":
+			b.WriteString(".PP\nThe argument is the shell: bash, zsh, fish, or powershell.\n")
+		case "man":
+			b.WriteString(".TP\n.BR \\-dir \" \\fIstring\\fR\"\nWrite config-validator.1 into this directory instead of printing it\n")
+		default:
+			writeManFlags(&b, flags[c.path])
+		}
+	}
+	b.WriteString(".SH ENVIRONMENT\n")
+	for _, e := range manEnvironment {
+		fmt.Fprintf(&b, ".TP\n.B %s\n%s\n", e[0], roffEscape(e[1]))
+	}
+	b.WriteString("The standard OTEL_* variables configure export further.\n")
+	b.WriteString(".SH EXIT STATUS\n0 when the input is valid, 1 when it is not, and otherwise when the command fails.\n")
+	return b.String()
+}
+
+func writeManFlags(b *strings.Builder, flags []commandFlag) {
+	for _, f := range flags {
+		b.WriteString(".TP\n.BR \\-" + roffEscape(f.name))
+		if f.arg != "" {
+			fmt.Fprintf(b, " \" \\fI%s\\fR\"", roffEscape(f.arg))
+		}
+		b.WriteString("\n" + roffEscape(f.usage) + "\n")
+	}
+}
+
+// roffEscape escapes text for roff: backslashes, dashes, and control characters at
+// the start of a line.
+func roffEscape(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
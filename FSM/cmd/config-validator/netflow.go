@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"config-validator/pkg/capture"
+	"config-validator/pkg/netflow"
+)
+
+// runNetFlow implements `config-validator netflow`: the NetFlow v5, v9, and IPFIX
+// packets of a pcap or pcapng capture are checked in order, so templates and
+// sequence numbers are followed across the capture. Any other input is taken as a
+// file of IPFIX messages.
+func runNetFlow(args []string) {
+	d := newDocumentRun("netflow")
+	portList := d.fs.String("ports", "2055,2056,4739,9995,9996", "Comma-separated UDP ports flow export is sent to in captures")
+	d.captureFlags(true)
+	d.parse(args)
+	d.what = "flow export"
+	ports := map[uint16]bool{}
+	for _, p := range strings.Split(*portList, ",") {
+		n, err := strconv.ParseUint(strings.TrimSpace(p), 10, 16)
+		if err != nil {
+			log.Fatal("❌ Invalid port in -ports: ", p)
+		}
+		ports[uint16(n)] = true
+	}
+
+	content, err := os.ReadFile(*d.inputFile)
+	if err != nil {
+		log.Fatal("❌ Error reading file:", err)
+	}
+	c := netflow.NewChecker()
+	if !capture.IsCapture(content) {
+		c.File(content)
+		d.finish(c.Findings(), nil)
+		return
+	}
+	err = d.sampler.Segments(bytes.NewReader(content), func(s capture.Segment) {
+		if s.Flow.Proto == capture.UDP && ports[s.Flow.Dst.Port()] {
+			c.Packet(fmt.Sprintf("packet %d (%s)", s.Number, s.Flow), s.Flow.Src.Addr().String(), s.Payload)
+		}
+	})
+	if err != nil {
+		log.Fatal("❌ Error reading capture: ", err)
+	}
+	if c.Packets == 0 {
+		log.Fatalf("❌ No flow export packets to ports %s found in %s", *portList, *d.inputFile)
+	}
+	var versions []string
+	for v, n := range c.Versions {
+		versions = append(versions, fmt.Sprintf("%s: %d", versionName(v), n))
+	}
+	sort.Strings(versions)
+	d.what = fmt.Sprintf("flow export (%s)", strings.Join(versions, ", "))
+	d.finish(c.Findings(), nil)
+}
+
+func versionName(v int) string {
+	if v == 10 {
+		return "IPFIX"
+	}
+	return fmt.Sprintf("NetFlow v%d", v)
+}
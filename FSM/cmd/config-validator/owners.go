@@ -0,0 +1,25 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"config-validator/pkg/ownership"
+)
+
+// ownersFlag adds -owners to a command that reports findings.
+func ownersFlag(fs *flag.FlagSet) *string {
+	return fs.String("owners", "", "Owners file (YAML) mapping file paths, device names, and rules to the team owning their findings")
+}
+
+// mustOwners loads the owners file of -owners, or returns nil without one.
+func mustOwners(file string) *ownership.Map {
+	if file == "" {
+		return nil
+	}
+	m, err := ownership.Load(file)
+	if err != nil {
+		log.Fatal("❌ Error loading owners file:", err)
+	}
+	return m
+}
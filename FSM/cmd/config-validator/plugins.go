@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"config-validator/pkg/plugin"
+)
+
+// runPlugins implements `config-validator plugins list`.
+func runPlugins(args []string) {
+	if len(args) == 0 || args[0] != "list" {
+		log.Fatal("❌ usage: config-validator plugins list [-dir path]")
+	}
+	fs := flag.NewFlagSet("plugins list", flag.ExitOnError)
+	dir := fs.String("dir", plugin.DefaultDir(), "Directory of validator plugins")
+	fs.Parse(args[1:])
+
+	plugins := loadPlugins(*dir)
+	if plugins.Empty() {
+		fmt.Println("No plugins installed in", *dir)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tKIND\tPATH")
+	for _, p := range plugins.List() {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", p.Name, p.Kind, p.Path)
+	}
+	w.Flush()
+}
+
+// loadPlugins loads the plugin directory, warning about (and skipping) broken plugins.
+func loadPlugins(dir string) *plugin.Registry {
+	registry, errs := plugin.Load(dir)
+	for _, err := range errs {
+		log.Println("⚠️  Skipping", err)
+	}
+	return registry
+}
+
+// detectPlugin returns the plugin that claims the input file, if any.
+func detectPlugin(dir, inputFile string) plugin.Validator {
+	plugins := loadPlugins(dir)
+	if plugins.Empty() {
+		return nil
+	}
+	content, err := os.ReadFile(inputFile)
+	if err != nil {
+		return nil
+	}
+	return plugins.Detect(inputFile, content)
+}
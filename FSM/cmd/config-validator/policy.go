@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/policy"
+)
+
+// evaluatePolicy checks the config against a policy pack and adds a finding for every
+// failed check, so that non-compliance fails the run like any other finding.
+func evaluatePolicy(pack *policy.Pack, inputFile string, fsm *automata.FSM) *policy.Matrix {
+	file, err := os.Open(inputFile)
+	if err != nil {
+		log.Fatal("❌ Error reading file:", err)
+	}
+	defer file.Close()
+
+	matrix, failures, err := pack.Evaluate(file, fsm.Findings)
+	if err != nil {
+		log.Fatal("❌ Error evaluating policy pack:", err)
+	}
+	for _, f := range failures {
+		fsm.AddFinding(f)
+	}
+	log.Printf("📋 %s: %d/%d controls passed\n", matrix.Pack, matrix.Passed, matrix.Passed+matrix.Failed)
+	return matrix
+}
+
+// flagSet reports whether a flag was given on the command line.
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseSize parses a byte size such as "512M", "2GiB", or "1073741824".
+func parseSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		size   int64
+	}{
+		{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30},
+		{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30},
+		{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"B", 1},
+	}
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	mult := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(upper, u.suffix) {
+			upper, mult = strings.TrimSpace(strings.TrimSuffix(upper, u.suffix)), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(upper, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * mult, nil
+}
+
+// limitMemory bounds the run to about limit bytes of Go memory. The garbage collector
+// works harder as the limit nears, and the run stops with an error once the live heap
+// exceeds it, rather than the machine running out of memory on a huge input.
+func limitMemory(limit string) {
+	if limit == "" {
+		return
+	}
+	max, err := parseSize(limit)
+	if err != nil {
+		log.Fatal("❌ Error in -max-memory:", err)
+	}
+	debug.SetMemoryLimit(max)
+
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	go func() {
+		for range time.Tick(50 * time.Millisecond) {
+			metrics.Read(sample)
+			if heap := int64(sample[0].Value.Uint64()); heap > max {
+				log.Fatalf("❌ Memory use of %d MiB exceeds -max-memory %s", heap>>20, limit)
+			}
+		}
+	}()
+}
+
+// startProfile writes a CPU profile to <prefix>.cpu.pprof until the returned function
+// is called, which also writes a heap profile to <prefix>.heap.pprof. Both can be
+// read with `go tool pprof`.
+func startProfile(prefix string) func() {
+	if prefix == "" {
+		return func() {}
+	}
+	cpuFile, err := os.Create(prefix + ".cpu.pprof")
+	if err != nil {
+		log.Fatal("❌ Error creating CPU profile:", err)
+	}
+	if err := pprof.StartCPUProfile(cpuFile); err != nil {
+		log.Fatal("❌ Error starting CPU profile:", err)
+	}
+	return func() {
+		pprof.StopCPUProfile()
+		cpuFile.Close()
+
+		heapFile, err := os.Create(prefix + ".heap.pprof")
+		if err != nil {
+			log.Fatal("❌ Error creating heap profile:", err)
+		}
+		defer heapFile.Close()
+		runtime.GC() // report the memory still in use, not garbage
+		if err := pprof.Lookup("allocs").WriteTo(heapFile, 0); err != nil {
+			log.Fatal("❌ Error writing heap profile:", err)
+		}
+		fmt.Printf("📊 Profiles written to %s.cpu.pprof and %s.heap.pprof\n", prefix, prefix)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"config-validator/pkg/protocheck"
+)
+
+// runProto implements `config-validator proto`: a JSON payload is checked against a
+// protobuf message of a compiled descriptor set, following the proto3 JSON mapping.
+func runProto(args []string) {
+	d := newDocumentRun("proto")
+	descriptorFile := d.fs.String("descriptors", "", "Descriptor set (protoc --descriptor_set_out --include_imports)")
+	messageName := d.fs.String("message", "", "Full name of the message the payload must be (e.g. acme.v1.Device)")
+	d.parse(args)
+	if *descriptorFile == "" || *messageName == "" {
+		log.Fatal("❌ usage: config-validator proto -descriptors api.pb -message pkg.Message payload.json")
+	}
+
+	descriptors, err := protocheck.LoadDescriptors(*descriptorFile)
+	if err != nil {
+		log.Fatal("❌ Error loading descriptors:", err)
+	}
+	message, err := descriptors.Message(*messageName)
+	if err != nil {
+		log.Fatal("❌ ", err)
+	}
+	content, err := os.ReadFile(*d.inputFile)
+	if err != nil {
+		log.Fatal("❌ Error reading file:", err)
+	}
+	d.what = message.FullName
+	d.finish(protocheck.Check(content, descriptors, message), nil)
+}
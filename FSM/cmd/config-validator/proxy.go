@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/proxy"
+)
+
+// runProxy implements `config-validator proxy`: HTTP traffic is forwarded to the
+// upstream while requests and responses are validated on the fly. Findings are logged
+// per transaction, and findings in event streams as they arrive; with -reject failing messages are answered with the findings
+// instead of being forwarded.
+func runProxy(args []string) {
+	fs := flag.NewFlagSet("proxy", flag.ExitOnError)
+	listen := fs.String("listen", ":8080", "Address to accept traffic on")
+	upstream := fs.String("upstream", "", "URL of the server to forward to, such as http://api:8000")
+	specFile := fs.String("openapi", "", "OpenAPI 3 document (YAML or JSON) that requests must follow")
+	rejectFailing := fs.Bool("reject", false, "Answer failing requests with 400 and failing responses with 502 instead of forwarding them")
+	maxBody := fs.Int64("max-body", proxy.DefaultMaxBody, "Largest body to validate, in bytes; larger bodies are forwarded unchecked")
+	outFile := fs.String("out", "", "File to append each transaction to, as a JSON line")
+	quiet := fs.Bool("quiet", false, "Only log transactions with findings")
+	queueing := addQueueFlags(fs)
+	fs.Parse(args)
+
+	if *upstream == "" {
+		log.Fatal("❌ usage: config-validator proxy -upstream http://api [-listen :8080] [-openapi api.yaml] [-reject]")
+	}
+	target, err := url.Parse(*upstream)
+	if err != nil || target.Scheme == "" || target.Host == "" {
+		log.Fatal("❌ Invalid upstream URL: ", *upstream)
+	}
+
+	var mu sync.Mutex
+	var out *json.Encoder
+	if *outFile != "" {
+		f, err := os.OpenFile(*outFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			log.Fatal("❌ Error opening transaction log:", err)
+		}
+		defer f.Close()
+		out = json.NewEncoder(f)
+	}
+	report := func(tx proxy.Transaction) {
+		mu.Lock()
+		defer mu.Unlock()
+		if out != nil {
+			if err := out.Encode(tx); err != nil {
+				log.Println("❌ Error writing transaction log:", err)
+			}
+		}
+		n := len(tx.Request) + len(tx.Response)
+		if *quiet && n == 0 {
+			return
+		}
+		status := "✅"
+		switch {
+		case tx.Rejected != "":
+			status = "⛔ rejected " + tx.Rejected + ","
+		case n > 0:
+			status = "⚠️"
+		}
+		fmt.Printf("%s tx %d %s %s → %d (%d findings)\n", status, tx.ID, tx.Method, tx.Target, tx.Status, n)
+		printTransactionFindings(tx.ID, "request", tx.Request)
+		printTransactionFindings(tx.ID, "response", tx.Response)
+	}
+	// Event streams may last as long as the proxy, so their findings are also
+	// printed as they are found
+	stream := func(tx proxy.Transaction, f automata.Finding) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Printf("📡 tx %d %s %s stream line %d: %s\n", tx.ID, tx.Method, tx.Target, f.Line, f.Message)
+	}
+
+	// With -queue-workers, an event stream holds its worker for as long as it stays open
+	requests := queueing.queue()
+	srv := &http.Server{
+		Addr: *listen,
+		Handler: requests.Wrap(proxy.New(proxy.Options{
+			Upstream: target,
+			Checks:   contractChecks(*specFile),
+			Reject:   *rejectFailing,
+			MaxBody:  *maxBody,
+			Report:   report,
+			Stream:   stream,
+		})),
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+	log.Printf("🔀 Proxying %s to %s", *listen, target)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal("❌ Proxy failed:", err)
+	}
+}
+
+// printTransactionFindings prints the findings of one side of a transaction. Lines
+// are those of the message as it would be written out.
+func printTransactionFindings(id uint64, side string, findings []automata.Finding) {
+	for _, f := range findings {
+		where := side
+		if f.Line > 0 {
+			where = fmt.Sprintf("%s line %d", side, f.Line)
+		}
+		fmt.Printf("   tx %d %s: %s\n", id, where, f.Message)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"config-validator/pkg/queue"
+	"config-validator/pkg/server"
+)
+
+// queueFlags are the flags that bound the requests a server holds at once.
+type queueFlags struct {
+	workers *int
+	depth   *int
+	policy  *string
+}
+
+func addQueueFlags(fs *flag.FlagSet) *queueFlags {
+	return &queueFlags{
+		workers: fs.Int("queue-workers", 0, "Requests handled at once; others wait in a bounded queue (0 is unbounded)"),
+		depth:   fs.Int("queue-depth", 0, "Requests that may wait for a worker (default -queue-workers)"),
+		policy:  fs.String("queue-policy", string(queue.Block), "When the queue is full: block (wait for room), drop (answer 503), or shed-oldest (answer the longest-waiting request 503)"),
+	}
+}
+
+// queue starts the request queue the flags ask for, or returns nil without
+// -queue-workers. Health probes and metrics bypass it.
+func (q *queueFlags) queue() *server.RequestQueue {
+	policy, err := queue.ParsePolicy(*q.policy)
+	if err != nil {
+		log.Fatal("❌ Invalid -queue-policy: ", err)
+	}
+	if *q.workers <= 0 {
+		return nil
+	}
+	depth := *q.depth
+	if depth <= 0 {
+		depth = *q.workers
+	}
+	log.Printf("🚦 Handling %d requests at once, %d more may wait (%s when full)", *q.workers, depth, policy)
+	return server.NewRequestQueue(server.QueueOptions{
+		Workers: *q.workers,
+		Depth:   depth,
+		Policy:  policy,
+		Public:  []string{"/healthz", "/readyz", "/metrics"},
+	})
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"regexp"
+)
+
+// redactFlag adds -redact to a command that reports findings.
+func redactFlag(fs *flag.FlagSet) *string {
+	return fs.String("redact", "", "Regular expression of text masked in reports and notifications; with a group, only the group is masked (e.g. 'secret (\\S+)')")
+}
+
+// mustRedact compiles the pattern of -redact, or returns nil without one.
+func mustRedact(pattern string) *regexp.Regexp {
+	if pattern == "" {
+		return nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		log.Fatal("❌ Invalid -redact pattern: ", err)
+	}
+	return re
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/i18n"
+	"config-validator/pkg/notify"
+	"config-validator/pkg/store"
+	"config-validator/pkg/validation"
+)
+
+// runReport implements `config-validator report history <file|device>` and
+// `config-validator report trends`, both answered from the SQLite result store, and
+// `config-validator report merge <report.json>...`, which combines report files.
+func runReport(args []string) {
+	if len(args) == 0 {
+		log.Fatal("❌ usage: config-validator report history|trends|merge|verify [flags]")
+	}
+	switch args[0] {
+	case "history":
+		runReportHistory(args[1:])
+	case "trends":
+		runReportTrends(args[1:])
+	case "merge":
+		runReportMerge(args[1:])
+	case "verify":
+		runReportVerify(args[1:])
+	default:
+		log.Fatal("❌ unknown report command: ", args[0])
+	}
+}
+
+func runReportHistory(args []string) {
+	fs := flag.NewFlagSet("report history", flag.ExitOnError)
+	dbPath := fs.String("db", defaultDB(), "SQLite result store (defaults to $CONFIG_VALIDATOR_DB)")
+	showFindings := fs.Bool("findings", false, "List the findings of every run")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatal("❌ usage: config-validator report history [flags] <file|device>")
+	}
+
+	s := openStore(*dbPath)
+	defer s.Close()
+
+	runs, err := s.History(fs.Arg(0))
+	if err != nil {
+		log.Fatal("❌ Error reading history:", err)
+	}
+	if len(runs) == 0 {
+		fmt.Println("No runs recorded for", fs.Arg(0))
+		return
+	}
+
+	fmt.Printf("%-20s %-8s %8s  %-12s %-12s\n", "STARTED", "STATUS", "FINDINGS", "INPUT", "RULES")
+	for _, r := range runs {
+		fmt.Printf("%-20s %-8s %8d  %-12s %-12s\n",
+			r.Started.Local().Format("2006-01-02 15:04:05"), r.Status, len(r.Findings),
+			shortHash(r.InputHash), shortHash(r.RulesHash))
+		if *showFindings {
+			findings, err := s.Findings(r.ID)
+			if err != nil {
+				log.Fatal("❌ Error reading findings:", err)
+			}
+			for _, f := range findings {
+				if f.Rule != "" {
+					fmt.Printf("     %s  (%s)\n", f.Message, f.Rule)
+				} else {
+					fmt.Println("    ", f.Message)
+				}
+			}
+		}
+	}
+}
+
+func runReportTrends(args []string) {
+	fs := flag.NewFlagSet("report trends", flag.ExitOnError)
+	dbPath := fs.String("db", defaultDB(), "SQLite result store (defaults to $CONFIG_VALIDATOR_DB)")
+	fs.Parse(args)
+
+	s := openStore(*dbPath)
+	defer s.Close()
+
+	trends, err := s.Trends()
+	if err != nil {
+		log.Fatal("❌ Error reading trends:", err)
+	}
+	if len(trends) == 0 {
+		fmt.Println("No runs recorded")
+		return
+	}
+
+	fmt.Printf("%-30s %5s %6s %6s %7s  %-32s  %s\n", "SUBJECT", "RUNS", "FIRST", "LAST", "CHANGE", "LAST BY SEVERITY", "TREND")
+	for _, t := range trends {
+		fmt.Printf("%-30s %5d %6d %6d %+7d  %-32s  %s\n", t.Subject, t.Runs, t.First, t.Last, t.Last-t.First,
+			severityCounts(t.Severities), sparkline(t.Counts, t.Min, t.Max))
+	}
+}
+
+// runReportMerge combines the JSON reports of single files, archives, and fleets
+// into one summary: totals by severity, findings by rule, and the files with the
+// most findings. Findings are counted under the codes of the English message
+// catalog.
+func runReportMerge(args []string) {
+	fs := flag.NewFlagSet("report merge", flag.ExitOnError)
+	outputFile := fs.String("out", "", "Path to the merged JSON report (none when empty)")
+	format := fs.String("format", "text", "Output format: text (summary tables) or json (merged report on stdout)")
+	top := fs.Int("top", 10, "Rules and files listed in the text summary")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		log.Fatal("❌ usage: config-validator report merge [flags] <report.json>...")
+	}
+	if *format != "text" && *format != "json" {
+		log.Fatal("❌ Unknown format: ", *format)
+	}
+
+	messages := mustCatalog(i18n.English)
+	var inputs []validation.MergeInput
+	reports := 0
+	for _, path := range fs.Args() {
+		in, err := validation.ReadReportFile(path)
+		if errors.Is(err, validation.ErrMergedReport) {
+			log.Println("⚠️  Skipping", path+":", "already a merged report")
+			continue
+		}
+		if err != nil {
+			log.Fatal("❌ Error reading report:", err)
+		}
+		for _, i := range in {
+			messages.LocalizeAll(i.Findings)
+		}
+		inputs = append(inputs, in...)
+		reports++
+	}
+	merged := validation.MergeReports(reports, inputs)
+	if *outputFile != "" {
+		if err := validation.GenerateMergedReport(merged, *outputFile); err != nil {
+			log.Fatal("❌ Error generating report:", err)
+		}
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(merged)
+		return
+	}
+	fmt.Printf("%d reports, %d files: %d passed, %d failed", merged.Reports, merged.Total, merged.Passed, merged.Failed)
+	if merged.Unreachable > 0 {
+		fmt.Printf(", %d unreachable", merged.Unreachable)
+	}
+	fmt.Printf("; %d findings, score %d (%s)\n", merged.Findings, merged.Score, merged.Grade)
+
+	var severities []string
+	for s := range merged.BySeverity {
+		severities = append(severities, s)
+	}
+	sort.Strings(severities)
+	if len(severities) > 0 {
+		fmt.Printf("\n%-10s %8s\n", "SEVERITY", "FINDINGS")
+		for _, s := range severities {
+			fmt.Printf("%-10s %8d\n", s, merged.BySeverity[s])
+		}
+	}
+
+	if len(merged.ByRule) > 0 {
+		fmt.Printf("\n%-40s %8s %6s\n", "RULE", "FINDINGS", "FILES")
+		for _, r := range merged.ByRule[:min(*top, len(merged.ByRule))] {
+			fmt.Printf("%-40s %8d %6d\n", r.Rule, r.Findings, r.Files)
+		}
+	}
+
+	fmt.Printf("\n%-40s %-11s %5s %8s\n", "FILE", "STATUS", "SCORE", "FINDINGS")
+	for _, f := range merged.Files[:min(*top, len(merged.Files))] {
+		score := "-"
+		if f.Score != nil {
+			score = fmt.Sprint(*f.Score)
+		}
+		fmt.Printf("%-40s %-11s %5s %8d\n", f.File, f.Status, score, f.Findings)
+	}
+	if *outputFile != "" {
+		fmt.Println("\nMerged report written to", *outputFile)
+	}
+}
+
+// openStore opens the result store for the read-only report commands.
+func openStore(dbPath string) *store.Store {
+	if dbPath == "" {
+		log.Fatal("❌ no result store given (use -db or set CONFIG_VALIDATOR_DB)")
+	}
+	if _, err := os.Stat(dbPath); err != nil {
+		log.Fatal("❌ Error opening result store:", err)
+	}
+	s, err := store.Open(dbPath)
+	if err != nil {
+		log.Fatal("❌ Error opening result store:", err)
+	}
+	return s
+}
+
+// checkNotify fails a command given -notify without a result store, which it needs
+// to compare each run with the previous one.
+func checkNotify(notifyPath, dbPath string) {
+	if notifyPath != "" && dbPath == "" {
+		log.Fatal("❌ -notify needs a result store to compare runs with: use -db or set CONFIG_VALIDATOR_DB")
+	}
+}
+
+// finishRuns notifies about runs that got worse since their previous run and then
+// records them in the SQLite result store. Either step is skipped when its path is
+// empty, and failures are reported but never fail the validation itself.
+func finishRuns(dbPath, notifyPath string, runs ...*store.Run) {
+	var s *store.Store
+	if dbPath != "" {
+		var err error
+		if s, err = store.Open(dbPath); err != nil {
+			log.Println("⚠️  Could not open result store:", err)
+		} else {
+			defer s.Close()
+		}
+	}
+
+	if notifyPath != "" && s == nil {
+		// Without previous runs every failing run would look newly failing
+		log.Println("⚠️  Notifications skipped: no result store to compare runs with")
+	} else if notifyPath != "" {
+		cfg, err := notify.LoadConfig(notifyPath)
+		if err != nil {
+			log.Println("⚠️  Could not load notification config:", err)
+		} else {
+			for _, run := range runs {
+				var prevStatus string
+				var prevFindings []store.Finding
+				if prev, err := s.Last(run.Subject); err == nil && prev != nil {
+					prevStatus, prevFindings = prev.Status, prev.Findings
+				}
+				if e := cfg.Evaluate(run.Subject, prevStatus, prevFindings, run.Status, run.Findings); e != nil {
+					e.Owners = run.Owners
+					if err := cfg.Send(e); err != nil {
+						log.Println("⚠️  Notification failed:", err)
+					}
+				}
+			}
+		}
+	}
+
+	if s != nil {
+		for _, run := range runs {
+			if err := s.Record(run); err != nil {
+				log.Println("⚠️  Could not record run:", err)
+			}
+		}
+	}
+}
+
+// fileRun builds the store entry for a validated config file.
+func fileRun(subject, inputFile, rulesFile string, started time.Time, findings []automata.Finding) *store.Run {
+	run := &store.Run{
+		Subject:   subject,
+		Kind:      "file",
+		RulesFile: rulesFile,
+		Started:   started,
+		Finished:  time.Now(),
+		Status:    statusOf(validation.FormatFindings(findings)),
+		Findings:  storedFindings(findings),
+		Owners:    validation.FindingsByOwner(findings),
+	}
+	run.InputHash, _ = store.HashFile(inputFile)
+	run.RulesHash, _ = store.HashFile(rulesFile)
+	return run
+}
+
+// fleetRuns builds one store entry per device of a fleet run.
+func fleetRuns(results []validation.DeviceResult, started time.Time) []*store.Run {
+	finished := time.Now()
+	var runs []*store.Run
+	for _, r := range results {
+		run := &store.Run{
+			Subject:   r.Name,
+			Kind:      "device",
+			RulesFile: r.RulesFile,
+			Started:   started,
+			Finished:  finished,
+			Status:    r.Status,
+			Findings:  storedFindings(r.Findings),
+			Owners:    r.Owners,
+		}
+		run.InputHash = r.ConfigSHA256
+		if r.RulesFile != "" {
+			run.RulesHash, _ = store.HashFile(r.RulesFile)
+		}
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// storedFindings returns findings as the result store records them.
+func storedFindings(findings []automata.Finding) []store.Finding {
+	out := make([]store.Finding, len(findings))
+	for i, f := range findings {
+		severity, rule := f.Severity, f.Code
+		if severity == "" {
+			severity = automata.SeverityError
+		}
+		if rule == "" {
+			rule = f.State
+		}
+		out[i] = store.Finding{Message: automata.FormatFinding(f), Severity: severity, Rule: rule}
+	}
+	return out
+}
+
+func statusOf(errors []string) string {
+	if len(errors) == 0 {
+		return "success"
+	}
+	return "failed"
+}
+
+// severityCounts renders counts by severity, the worst first, such as "security 1,
+// error 3". Findings recorded without a severity are left out.
+func severityCounts(counts map[string]int) string {
+	severities := make([]string, 0, len(counts))
+	for s := range counts {
+		if s != "" {
+			severities = append(severities, s)
+		}
+	}
+	sort.Slice(severities, func(i, j int) bool {
+		pi, pj := validation.SeverityPenalty[severities[i]], validation.SeverityPenalty[severities[j]]
+		if pi != pj {
+			return pi > pj
+		}
+		return severities[i] < severities[j]
+	})
+	parts := make([]string, len(severities))
+	for i, s := range severities {
+		parts[i] = fmt.Sprintf("%s %d", s, counts[s])
+	}
+	return strings.Join(parts, ", ")
+}
+
+func shortHash(h string) string {
+	if len(h) > 12 {
+		return h[:12]
+	}
+	return h
+}
+
+// sparkline renders counts as a compact bar chart scaled between min and max.
+func sparkline(counts []int, lo, hi int) string {
+	bars := []rune("▁▂▃▄▅▆▇█")
+	var b strings.Builder
+	for _, c := range counts {
+		i := 0
+		if hi > lo {
+			i = (c - lo) * (len(bars) - 1) / (hi - lo)
+		}
+		b.WriteRune(bars[i])
+	}
+	return b.String()
+}
+
+// defaultDB returns the result store path from the environment, so every command
+// records into the same database without repeating -db.
+func defaultDB() string {
+	return os.Getenv("CONFIG_VALIDATOR_DB")
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/capture"
+	"config-validator/pkg/rtspcheck"
+	"config-validator/pkg/sdpcheck"
+)
+
+// runRTSP implements `config-validator rtsp`: the RTSP connections of a pcap or pcapng
+// capture are checked for their framing and CSeq sequencing, with responses paired
+// to requests and SDP bodies validated. Any other input is taken as the raw stream
+// one side sent, or as a session description when it starts with v=.
+func runRTSP(args []string) {
+	d := newDocumentRun("rtsp")
+	port := d.fs.Int("port", rtspcheck.Port, "Server port of RTSP connections in captures")
+	d.captureFlags(true)
+	d.flowReport()
+	d.parse(args)
+	d.what = "RTSP"
+
+	content, err := os.ReadFile(*d.inputFile)
+	if err != nil {
+		log.Fatal("❌ Error reading file:", err)
+	}
+	if !capture.IsCapture(content) {
+		if bytes.HasPrefix(content, []byte("v=")) {
+			d.what = "SDP"
+			d.finish(sdpcheck.Check(content), nil)
+			return
+		}
+		_, findings := rtspcheck.Parse(content)
+		d.finish(findings, nil)
+		return
+	}
+
+	var findings []automata.Finding
+	n := 0
+	for _, c := range d.readConversations(content) {
+		if int(c.Flow.Dst.Port()) != *port {
+			continue
+		}
+		n++
+		d.flows.Conversation(c)
+		client, clientFindings := rtspcheck.Parse(c.Client.Data)
+		server, serverFindings := rtspcheck.Parse(c.Server.Data)
+		clientPaired, serverPaired := rtspcheck.Pair(client, server)
+		findings = append(findings, d.streamFindings(c.Flow, "client", "rtsp", c.Client, len(c.Client.Data), lineFindings(append(clientFindings, clientPaired...)))...)
+		findings = append(findings, d.streamFindings(c.Flow.Reverse(), "server", "rtsp", c.Server, len(c.Server.Data), lineFindings(append(serverFindings, serverPaired...)))...)
+	}
+	if n == 0 {
+		log.Fatalf("❌ No RTSP connections to port %d found in %s", *port, *d.inputFile)
+	}
+	d.what = fmt.Sprintf("RTSP (connections checked: %d)", n)
+	d.finish(findings, nil)
+}
+
+// lineFindings moves the lines of findings about a captured stream, which count from
+// the start of the stream rather than the file, into their messages.
+func lineFindings(findings []automata.Finding) []automata.Finding {
+	for i := range findings {
+		if findings[i].Line > 0 {
+			findings[i].Message = fmt.Sprintf("line %d: %s", findings[i].Line, findings[i].Message)
+			findings[i].Line = 0
+		}
+	}
+	return findings
+}
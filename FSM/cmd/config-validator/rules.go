@@ -0,0 +1,333 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/bundle"
+	"config-validator/pkg/config"
+	"config-validator/pkg/rulepack"
+)
+
+// runRules implements `config-validator rules <command>` for working with rule sets.
+func runRules(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: config-validator rules compile|lint|update|rollback [flags]")
+		os.Exit(2)
+	}
+	switch args[0] {
+	case "compile":
+		runRulesCompile(args[1:])
+	case "lint":
+		runRulesLint(args[1:])
+	case "update":
+		runRulesUpdate(args[1:])
+	case "rollback":
+		runRulesRollback(args[1:])
+	default:
+		fmt.Fprintln(os.Stderr, "config-validator rules: unknown command", args[0])
+		os.Exit(2)
+	}
+}
+
+// runRulesCompile implements `config-validator rules compile`: the rules file is
+// resolved and written as a bundle, which the validator loads in its place.
+func runRulesCompile(args []string) {
+	fs := flag.NewFlagSet("rules compile", flag.ExitOnError)
+	rulesFile := fs.String("rules", defaultRules, "Rules file, https:// URL, oci:// reference, or builtin")
+	rulesKey := rulesKeyFlag(fs)
+	role := fs.String("role", "", "Device role (e.g. core, edge, access): compile roles/<role>.yaml next to the rules file")
+	out := fs.String("o", "", "Bundle to write (default: next to the rules file, with a .bundle extension)")
+	fs.Parse(args)
+	*rulesFile = mustResolveRules(*rulesFile, *rulesKey, *role)
+	if *out == "" {
+		*out = bundle.Path(*rulesFile)
+	}
+
+	started := time.Now()
+	if err := config.CompileBundle(*rulesFile, *out); err != nil {
+		log.Fatal("❌ Error compiling rules:", err)
+	}
+	fmt.Printf("✅ Compiled %s into %s in %v\n", *rulesFile, *out, time.Since(started).Round(time.Millisecond))
+}
+
+// runRulesLint implements `config-validator rules lint`: the pack of the rules file,
+// its role files included, is checked for mixed schemas and for version metadata
+// that does not hold together.
+func runRulesLint(args []string) {
+	fs := flag.NewFlagSet("rules lint", flag.ExitOnError)
+	rulesFile := fs.String("rules", defaultRules, "Rules file, https:// URL, oci:// reference, pack:<name>, or builtin")
+	rulesKey := rulesKeyFlag(fs)
+	fs.Parse(args)
+	*rulesFile = mustResolveRules(*rulesFile, *rulesKey, "")
+
+	issues, err := rulepack.Lint(*rulesFile)
+	if err != nil {
+		log.Fatal("❌ Error loading rules:", err)
+	}
+	errors := 0
+	for _, issue := range issues {
+		icon := "⚠️ "
+		if issue.Severity == automata.SeverityError {
+			icon = "❌"
+			errors++
+		}
+		fmt.Println(icon, issue)
+	}
+	if errors > 0 {
+		fmt.Printf("✖ %d issue(s) in %s, %d error(s)\n", len(issues), *rulesFile, errors)
+		os.Exit(1)
+	}
+	fmt.Printf("✅ %s passed lint with %d warning(s)\n", *rulesFile, len(issues))
+}
+
+// runRulesUpdate implements `config-validator rules update`: each pack of the
+// lockfile, or each one named, is updated to the newest release of the registry its
+// pin allows. A new release is installed next to the one in use, validated, and
+// shown as a diff of its rules before the lockfile switches to it.
+func runRulesUpdate(args []string) {
+	fs := flag.NewFlagSet("rules update", flag.ExitOnError)
+	dir := fs.String("dir", rulepack.DefaultPackDir(), "Directory packs are installed in, with their rules.lock")
+	registry := fs.String("registry", os.Getenv("CONFIG_VALIDATOR_REGISTRY"), "Registry index (https:// URL or file); default: the one in rules.lock")
+	locked := fs.Bool("locked", false, "Install the versions in rules.lock instead of updating them")
+	dryRun := fs.Bool("dry-run", false, "Show what would change without installing anything")
+	rulesKey := rulesKeyFlag(fs)
+	fs.Parse(args)
+
+	lock, err := rulepack.ReadLock(*dir)
+	if err != nil {
+		log.Fatal("❌ Error reading lockfile:", err)
+	}
+	if *registry != "" {
+		lock.Registry = *registry
+		if !rulepack.IsRemote(*registry) {
+			lock.Registry, _ = filepath.Abs(*registry)
+		}
+	}
+	var names []string
+	for _, arg := range fs.Args() {
+		name, pin, hasPin := strings.Cut(arg, "@")
+		if !rulepack.ValidName(name) {
+			log.Fatalf("❌ Invalid pack name %q", name)
+		}
+		p := lock.Find(name)
+		if p == nil {
+			lock.Packs = append(lock.Packs, rulepack.Locked{Name: name})
+			p = &lock.Packs[len(lock.Packs)-1]
+		}
+		if hasPin {
+			p.Pin = pin
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		for _, p := range lock.Packs {
+			names = append(names, p.Name)
+		}
+	}
+	if len(names) == 0 {
+		log.Fatal("❌ No packs to update: name one, e.g. config-validator rules update cisco-ios")
+	}
+
+	var index *rulepack.Index
+	if !*locked {
+		if lock.Registry == "" {
+			log.Fatal("❌ No registry: pass -registry or set CONFIG_VALIDATOR_REGISTRY")
+		}
+		if index, err = rulepack.LoadIndex(lock.Registry, nil); err != nil {
+			log.Fatal("❌ Error loading registry:", err)
+		}
+	}
+	opts := rulepack.Options{PublicKey: *rulesKey}
+	failed := false
+	for _, name := range names {
+		p := lock.Find(name)
+		release := p.Release
+		if !*locked {
+			if release, err = index.Latest(name, p.Pin); err != nil {
+				log.Println("❌", err)
+				failed = true
+				continue
+			}
+		} else if release.Version == "" {
+			log.Printf("❌ %s is not in %s", name, filepath.Join(*dir, rulepack.LockFileName))
+			failed = true
+			continue
+		}
+		if err := updatePack(*dir, p, release, opts, *locked, *dryRun); err != nil {
+			log.Printf("❌ %s: %v", name, err)
+			failed = true
+		}
+	}
+	if !*dryRun {
+		if err := lock.Write(*dir); err != nil {
+			log.Fatal("❌ Error writing lockfile:", err)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// updatePack installs a release of a pack, validates it, shows how its rules differ
+// from the version in use, and makes it the version in use.
+func updatePack(dir string, p *rulepack.Locked, r rulepack.Release, opts rulepack.Options, locked, dryRun bool) error {
+	current, _ := rulepack.InstalledRules(dir, p.Name, p.Version)
+	if r.Version == p.Version && current != "" && !locked {
+		fmt.Printf("✅ %s %s is up to date\n", p.Name, p.Version)
+		return nil
+	}
+	if locked && r.Version == p.Version && current != "" {
+		if _, err := os.Stat(current); err == nil {
+			fmt.Printf("✅ %s %s is installed\n", p.Name, p.Version)
+			return nil
+		}
+	}
+
+	target := rulepack.VersionDir(dir, p.Name, r.Version)
+	if dryRun {
+		tmp, err := os.MkdirTemp("", "config-validator-pack-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmp)
+		target = tmp
+	}
+	rulesFile, sum, err := rulepack.Install(target, r, opts)
+	if err != nil {
+		return err
+	}
+	if err := validatePack(rulesFile); err != nil {
+		if !dryRun {
+			os.RemoveAll(target)
+		}
+		return fmt.Errorf("%s %s does not validate: %v", p.Name, r.Version, err)
+	}
+
+	from := p.Version
+	if from == "" {
+		from = "(not installed)"
+	}
+	if r.Version != p.Version {
+		fmt.Printf("📋 %s %s → %s\n", p.Name, from, r.Version)
+	}
+	if current != "" && r.Version != p.Version {
+		changes, err := rulepack.Diff(filepath.Dir(current), filepath.Dir(rulesFile))
+		if err != nil {
+			log.Println("⚠️  Could not compare the rules:", err)
+		}
+		for _, c := range changes {
+			fmt.Println("   ", c)
+		}
+		if err == nil && len(changes) == 0 {
+			fmt.Println("    no rule changes")
+		}
+	}
+	if dryRun {
+		return nil
+	}
+
+	if r.Version != p.Version && p.Version != "" {
+		previous := p.Release
+		p.Previous = &previous
+	}
+	p.Release = r
+	p.SHA256 = sum
+	if err := rulepack.Prune(dir, *p); err != nil {
+		log.Println("⚠️  Could not remove old versions:", err)
+	}
+	fmt.Printf("✅ Installed %s %s\n", p.Name, r.Version)
+	return nil
+}
+
+// validatePack loads the rules of a pack, and of each of its roles, as the validator
+// would.
+func validatePack(rulesFile string) error {
+	roles, _ := filepath.Glob(filepath.Join(filepath.Dir(rulesFile), "roles", "*.yaml"))
+	for _, file := range append([]string{rulesFile}, roles...) {
+		if _, err := config.LoadRuleSet(file, config.Options{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runRulesRollback implements `config-validator rules rollback`: each pack named goes
+// back to the version it was updated from, which stays installed for this.
+func runRulesRollback(args []string) {
+	fs := flag.NewFlagSet("rules rollback", flag.ExitOnError)
+	dir := fs.String("dir", rulepack.DefaultPackDir(), "Directory packs are installed in, with their rules.lock")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: config-validator rules rollback [flags] pack...")
+		os.Exit(2)
+	}
+
+	lock, err := rulepack.ReadLock(*dir)
+	if err != nil {
+		log.Fatal("❌ Error reading lockfile:", err)
+	}
+	for _, name := range fs.Args() {
+		p := lock.Find(name)
+		switch {
+		case p == nil:
+			log.Fatalf("❌ %s is not in %s", name, filepath.Join(*dir, rulepack.LockFileName))
+		case p.Previous == nil:
+			log.Fatalf("❌ %s %s has no previous version to roll back to", name, p.Version)
+		}
+		if _, err := rulepack.InstalledRules(*dir, name, p.Previous.Version); err != nil {
+			log.Fatal("❌ Error rolling back:", err)
+		}
+		current := p.Release
+		p.Release, p.Previous = *p.Previous, &current
+		fmt.Printf("⏪ %s rolled back from %s to %s\n", name, current.Version, p.Version)
+	}
+	if err := lock.Write(*dir); err != nil {
+		log.Fatal("❌ Error writing lockfile:", err)
+	}
+}
+
+// defaultRules are the rules compiled into the binary, which every command uses
+// unless -rules names others.
+const defaultRules = rulepack.Builtin
+
+// rulesKeyFlag adds -rules-key to a command that takes -rules.
+func rulesKeyFlag(fs *flag.FlagSet) *string {
+	return fs.String("rules-key", os.Getenv("CONFIG_VALIDATOR_RULES_KEY"), "PEM ed25519 public key remote rule packs must be signed with")
+}
+
+// resolveRules turns a -rules reference (a path, an https:// URL, or an oci:// reference)
+// into a local rules file, then applies the role overlay.
+func resolveRules(ref, keyFile, role string) (string, error) {
+	rulesFile, err := rulepack.Resolve(ref, rulepack.Options{PublicKey: keyFile})
+	if err != nil {
+		return "", err
+	}
+	return automata.RoleRules(rulesFile, role), nil
+}
+
+// mustResolveRules is resolveRules for one-shot commands.
+func mustResolveRules(ref, keyFile, role string) string {
+	rulesFile, err := resolveRules(ref, keyFile, role)
+	if err != nil {
+		log.Fatal("❌ Error loading rules:", err)
+	}
+	return rulesFile
+}
+
+// mustReloader loads the rules of a long-running command into a Reloader, which
+// re-resolves the reference (refreshing remote packs) on every reload.
+func mustReloader(ref, keyFile string, opts config.Options) *config.Reloader {
+	rules, err := config.NewReloader(func() (string, error) { return resolveRules(ref, keyFile, "") }, opts)
+	if err != nil {
+		log.Fatal("❌ Error loading rules:", err)
+	}
+	log.Printf("📜 Rules version %s loaded from %s", rules.Current().Version, rules.Current().File)
+	return rules
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"config-validator/pkg/config"
+	"config-validator/pkg/selftest"
+)
+
+// runSelftest implements `config-validator selftest`: the built-in samples are run
+// through the validators with the rules in use, and every sample must produce
+// exactly its expected findings. It exits with status 1 when one does not.
+func runSelftest(args []string) {
+	fs := flag.NewFlagSet("selftest", flag.ExitOnError)
+	rulesFile := fs.String("rules", defaultRules, "Rules file, https:// URL, oci:// reference, or builtin to test")
+	rulesKey := rulesKeyFlag(fs)
+	role := fs.String("role", "", "Device role: test roles/<role>.yaml next to the rules file")
+	sandboxed := fs.Bool("sandboxed", false, "Only run WASM rule checks, refusing Starlark scripts")
+	format := fs.String("format", "text", "Output format: text or json")
+	fs.Parse(args)
+
+	rules, err := config.LoadRuleSet(mustResolveRules(*rulesFile, *rulesKey, *role), config.Options{Sandboxed: *sandboxed})
+	if err != nil {
+		log.Fatal("❌ Error loading rules:", err)
+	}
+	results, err := selftest.Run(rules)
+	if err != nil {
+		log.Fatal("❌ Self-test failed to run:", err)
+	}
+
+	failed := 0
+	for _, r := range results {
+		if !r.Passed {
+			failed++
+		}
+	}
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(map[string]any{"rules": rules.File, "rules_version": rules.Version, "passed": failed == 0, "results": results})
+	case "text":
+		fmt.Printf("Self-test with rules %s (version %s)\n", rules.File, rules.Version)
+		for _, r := range results {
+			mark := "✅"
+			if !r.Passed {
+				mark = "❌"
+			}
+			fmt.Printf("%s %-50s %s\n", mark, r.Name, r.Duration.Round(time.Microsecond))
+			for _, p := range r.Problems {
+				fmt.Printf("     %s\n", p)
+			}
+		}
+		if failed == 0 {
+			fmt.Printf("✅ All %d self-tests passed\n", len(results))
+		} else {
+			fmt.Printf("❌ %d of %d self-tests failed\n", failed, len(results))
+		}
+	default:
+		log.Fatal("❌ Unknown format: ", *format)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
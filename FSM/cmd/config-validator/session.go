@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"config-validator/pkg/session"
+)
+
+// runSession implements `config-validator session`: the sessions of a text protocol
+// are run through a state machine declared in YAML (see session.Machine), from a
+// transcript or from the TCP connections of a capture.
+func runSession(args []string) {
+	d := newDocumentRun("session")
+	machineFile := d.fs.String("machine", "", "YAML file declaring the protocol's states and transitions (required)")
+	port := d.fs.Int("port", 0, "Server port of the connections to check in captures, 0 for every connection")
+	d.captureFlags(true)
+	d.flowReport()
+	d.parse(args)
+	if *machineFile == "" {
+		log.Fatal("❌ -machine is required")
+	}
+	m, err := session.LoadMachine(*machineFile)
+	if err != nil {
+		log.Fatal("❌ ", err)
+	}
+	d.what = m.Name
+
+	content, err := os.ReadFile(*d.inputFile)
+	if err != nil {
+		log.Fatal("❌ Error reading file:", err)
+	}
+	findings, n := sessionFindings(d, content, m.Name, *port, false, m.Check)
+	if n > 0 {
+		d.what = fmt.Sprintf("%s (sessions checked: %d)", m.Name, n)
+	}
+	d.finish(findings, nil)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/capture"
+	"config-validator/pkg/sshcheck"
+)
+
+// runSSH implements `config-validator ssh`: the version exchange and the clear-text
+// packets up to NEWKEYS are checked for every SSH connection of a pcap or pcapng
+// capture, along with whether the two KEXINITs can agree. Any other input is taken
+// as the raw stream one side sent.
+func runSSH(args []string) {
+	d := newDocumentRun("ssh")
+	side := d.fs.String("side", "server", "Side that sent a raw stream: server or client")
+	port := d.fs.Int("port", 22, "Server port of SSH connections in captures; connections that start with an SSH version line are checked on any port")
+	d.captureFlags(true)
+	d.flowReport()
+	d.parse(args)
+	d.what = "SSH"
+	if *side != "server" && *side != "client" {
+		log.Fatal("❌ -side must be server or client")
+	}
+
+	content, err := os.ReadFile(*d.inputFile)
+	if err != nil {
+		log.Fatal("❌ Error reading file:", err)
+	}
+	if !capture.IsCapture(content) {
+		_, findings := sshcheck.Check(content, *side == "server")
+		d.finish(findings, nil)
+		return
+	}
+
+	var findings []automata.Finding
+	n := 0
+	for _, c := range d.readConversations(content) {
+		if !isSSH(c, *port) {
+			continue
+		}
+		n++
+		d.flows.Conversation(c)
+		client, f := sshcheck.Check(c.Client.Data, false)
+		findings = append(findings, d.streamFindings(c.Flow, "client", "ssh", c.Client, client.Checked, f)...)
+		server, f := sshcheck.Check(c.Server.Data, true)
+		findings = append(findings, d.streamFindings(c.Flow.Reverse(), "server", "ssh", c.Server, server.Checked, f)...)
+		if client.KexInit != nil && server.KexInit != nil {
+			findings = append(findings, d.streamFindings(c.Flow.Reverse(), "server", "ssh", c.Server, 0, sshcheck.Negotiate(client.KexInit, server.KexInit))...)
+		}
+	}
+	if n == 0 {
+		log.Fatal("❌ No SSH connections found in ", *d.inputFile)
+	}
+	d.what = fmt.Sprintf("SSH (connections checked: %d)", n)
+	d.finish(findings, nil)
+}
+
+// isSSH reports whether a connection is to the SSH port or starts with a version
+// line. Servers may send other lines first, so the start of theirs is searched.
+func isSSH(c *capture.Conversation, port int) bool {
+	if int(c.Flow.Dst.Port()) == port || bytes.HasPrefix(c.Client.Data, []byte("SSH-")) {
+		return true
+	}
+	head := c.Server.Data[:min(len(c.Server.Data), 1024)]
+	return bytes.HasPrefix(head, []byte("SSH-")) || bytes.Contains(head, []byte("\nSSH-"))
+}
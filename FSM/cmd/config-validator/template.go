@@ -0,0 +1,24 @@
+package main
+
+import (
+	"log"
+
+	"config-validator/pkg/template"
+)
+
+// templateOptions builds the template preprocessing options from the -vars and
+// -template-wildcards flags, or returns nil when neither is given.
+func templateOptions(varsFile string, wildcards bool) *template.Options {
+	if varsFile == "" && !wildcards {
+		return nil
+	}
+	opts := &template.Options{Wildcard: wildcards}
+	if varsFile != "" {
+		vars, err := template.LoadVars(varsFile)
+		if err != nil {
+			log.Fatal("❌ Error loading vars:", err)
+		}
+		opts.Vars = vars
+	}
+	return opts
+}
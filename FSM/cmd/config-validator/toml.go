@@ -0,0 +1,41 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/graphqlcheck"
+	"config-validator/pkg/inicheck"
+	"config-validator/pkg/tomlcheck"
+)
+
+// runTOML implements `config-validator toml`: table headers, keys, and values of a
+// TOML document are checked, with the rules on redefining tables and arrays of tables.
+func runTOML(args []string) {
+	runDocumentCheck("toml", args, func(content []byte) ([]automata.Finding, any) {
+		return tomlcheck.Check(content), nil
+	})
+}
+
+// runINI implements `config-validator ini`: sections and key = value lines of an INI
+// file are checked, with duplicates reported as warnings.
+func runINI(args []string) {
+	runDocumentCheck("ini", args, func(content []byte) ([]automata.Finding, any) {
+		return inicheck.Check(content), nil
+	})
+}
+
+// runGraphQL implements `config-validator graphql`: the literals, brackets, and
+// grammar of a GraphQL query document are checked, with the variables and fragments
+// of its operations.
+func runGraphQL(args []string) {
+	d := newDocumentRun("graphql")
+	d.parse(args)
+	d.what = "GraphQL"
+	content, err := os.ReadFile(*d.inputFile)
+	if err != nil {
+		log.Fatal("❌ Error reading file:", err)
+	}
+	d.finish(graphqlcheck.Check(content), nil)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"strings"
+
+	"config-validator/pkg/capture"
+	"config-validator/pkg/udpcheck"
+)
+
+// runUDP implements `config-validator udp`: the exchanges of a simple UDP protocol,
+// TFTP by default, are validated from the datagrams of a pcap or pcapng capture in
+// order, following each exchange's state from its request on.
+func runUDP(args []string) {
+	d := newDocumentRun("udp")
+	protocol := d.fs.String("protocol", "tftp", "Protocol to validate: "+strings.Join(udpcheck.Names(), ", "))
+	port := d.fs.Int("port", 0, "Server port of the protocol (its well-known port when 0)")
+	d.captureFlags(true)
+	d.flowReport()
+	d.parse(args)
+	p, ok := udpcheck.Protocols[*protocol]
+	if !ok {
+		log.Fatalf("❌ Unknown protocol %q; known: %s", *protocol, strings.Join(udpcheck.Names(), ", "))
+	}
+	if *port == 0 {
+		*port = p.Port
+	}
+	d.what = p.Name
+
+	content, err := os.ReadFile(*d.inputFile)
+	if err != nil {
+		log.Fatal("❌ Error reading file:", err)
+	}
+	if !capture.IsCapture(content) {
+		log.Fatalf("❌ %s is not a pcap or pcapng capture; %s exchanges are read from captures", *d.inputFile, p.Name)
+	}
+	c := p.New(*port)
+	clients := map[netip.AddrPort]bool{} // endpoints that sent to the port, whose other flows belong to the exchange (TFTP transfers)
+	err = d.sampler.Segments(bytes.NewReader(content), func(s capture.Segment) {
+		if s.Flow.Proto == capture.UDP {
+			if int(s.Flow.Dst.Port()) == *port {
+				clients[s.Flow.Src] = true
+			}
+			if fromClient := clients[s.Flow.Src]; fromClient || int(s.Flow.Src.Port()) == *port || clients[s.Flow.Dst] {
+				d.flows.Segment(s, fromClient)
+			}
+		}
+		c.Datagram(s)
+	})
+	if err != nil {
+		log.Fatal("❌ Error reading capture: ", err)
+	}
+	findings, n := c.Close()
+	d.flows.AddPackets(*protocol, findings)
+	if n == 0 && len(findings) == 0 {
+		log.Fatalf("❌ No %s exchanges with port %d found in %s", p.Name, *port, *d.inputFile)
+	}
+	d.what = fmt.Sprintf("%s (exchanges checked: %d)", p.Name, n)
+	d.finish(findings, nil)
+}
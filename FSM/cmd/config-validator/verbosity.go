@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"config-validator/pkg/automata"
+)
+
+// verbosity is how much the default command prints. Findings and the summary line go
+// to stdout; what -v and -vv add goes to stderr, so stdout stays the same for scripts.
+type verbosity int
+
+const (
+	quietOutput   verbosity = iota // -q: the summary line only
+	normalOutput                   // the findings and the summary line
+	verboseOutput                  // -v: also stage timings and rule statistics
+	traceOutput                    // -vv: also how every line was validated
+)
+
+type verbosityFlags struct {
+	quiet, verbose, trace *bool
+}
+
+func addVerbosityFlags(fs *flag.FlagSet) *verbosityFlags {
+	return &verbosityFlags{
+		quiet:   fs.Bool("q", false, "Print the summary line only"),
+		verbose: fs.Bool("v", false, "Also print stage timings and rule statistics on stderr"),
+		trace:   fs.Bool("vv", false, "Like -v, and trace the state and rules tried for every line on stderr"),
+	}
+}
+
+func (f *verbosityFlags) level() verbosity {
+	switch {
+	case *f.quiet && (*f.verbose || *f.trace):
+		log.Fatal("❌ -q cannot be combined with -v or -vv")
+	case *f.quiet:
+		return quietOutput
+	case *f.trace:
+		return traceOutput
+	case *f.verbose:
+		return verboseOutput
+	}
+	return normalOutput
+}
+
+// stageTimer records how long the stages of a run took, for -v.
+type stageTimer struct {
+	started, last time.Time
+	stages        []string
+}
+
+func newStageTimer() *stageTimer {
+	now := time.Now()
+	return &stageTimer{started: now, last: now}
+}
+
+// done ends a stage, which started when the one before it ended.
+func (t *stageTimer) done(stage string) {
+	now := time.Now()
+	t.stages = append(t.stages, fmt.Sprintf("%s %s", stage, now.Sub(t.last).Round(time.Microsecond)))
+	t.last = now
+}
+
+func (t *stageTimer) print() {
+	fmt.Fprintf(os.Stderr, "⏱️  %s, total %s\n", strings.Join(t.stages, ", "), time.Since(t.started).Round(time.Microsecond))
+}
+
+// printRuleStats summarizes how a config exercised the rules, for -v.
+func printRuleStats(stats *automata.Stats) {
+	states, matched := 0, 0
+	for _, s := range stats.States {
+		if s.Lines > 0 {
+			states++
+		}
+	}
+	var unmatched []string
+	for _, r := range stats.Rules {
+		if r.Matches > 0 {
+			matched++
+		} else if len(unmatched) < 5 {
+			unmatched = append(unmatched, r.State+" "+r.Pattern)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "📈 %d lines validated in %d states; %d of %d rules matched\n", stats.Lines, states, matched, len(stats.Rules))
+	for _, u := range unmatched {
+		fmt.Fprintf(os.Stderr, "   never matched: %s\n", u)
+	}
+	if n := len(stats.Rules) - matched - len(unmatched); n > 0 {
+		fmt.Fprintf(os.Stderr, "   ...and %d more rules never matched\n", n)
+	}
+}
+
+// traceLine prints how a line was validated, for -vv.
+func traceLine(e automata.Explanation) {
+	if e.Line == "" || strings.HasPrefix(e.Line, "!") {
+		return
+	}
+	switch {
+	case e.Entered != "":
+		fmt.Fprintf(os.Stderr, "🔎 line %d %s → %s: %s\n", e.LineNum, e.State, e.Entered, e.Line)
+	case e.Matched != "":
+		fmt.Fprintf(os.Stderr, "🔎 line %d %s: %s matched '%s'\n", e.LineNum, e.State, e.Line, e.Matched)
+	default:
+		fmt.Fprintf(os.Stderr, "🔎 line %d %s: %s matched none of %d rules\n", e.LineNum, e.State, e.Line, len(e.Tried))
+		if e.NearMiss != nil {
+			fmt.Fprintf(os.Stderr, "   closest '%s', %d edits\n", e.NearMiss.Pattern, e.NearMiss.Distance)
+		}
+		fmt.Fprintf(os.Stderr, "   💡 %s\n", e.Suggestion)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"config-validator/pkg/config"
+	"config-validator/pkg/server"
+)
+
+// runVersion implements `config-validator version`: the binary's version, the Go
+// version it was built with, and the version and file hashes of the rules it would
+// load, so a result can be reproduced with the same build and rules.
+func runVersion(args []string) {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	rulesFile := fs.String("rules", defaultRules, "Rules file, https:// URL, oci:// reference, or builtin to report on (none when empty)")
+	rulesKey := rulesKeyFlag(fs)
+	role := fs.String("role", "", "Device role: report on roles/<role>.yaml next to the rules file")
+	asJSON := fs.Bool("json", false, "Print JSON")
+	fs.Parse(args)
+
+	var rs *config.RuleSet
+	var rulesErr error
+	if *rulesFile != "" {
+		var resolved string
+		if resolved, rulesErr = resolveRules(*rulesFile, *rulesKey, *role); rulesErr == nil {
+			rs, rulesErr = config.LoadRuleSet(resolved, config.Options{})
+		}
+	}
+	info := server.NewBuildInfo(rs)
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(info)
+	} else {
+		fmt.Printf("config-validator %s\n", info.Version)
+		fmt.Printf("  go:        %s (%s)\n", info.GoVersion, info.Platform)
+		if info.Revision != "" {
+			modified := ""
+			if info.Modified {
+				modified = ", modified"
+			}
+			fmt.Printf("  revision:  %s (%s%s)\n", info.Revision, info.RevisionTime, modified)
+		}
+		if r := info.Rules; r != nil {
+			fmt.Printf("  rules:     %s, version %s\n", r.File, r.Version)
+			for _, src := range r.Sources {
+				fmt.Printf("    %s  %s\n", src.SHA256, src.File)
+			}
+			if r.Error != "" {
+				fmt.Printf("    (could not hash sources: %s)\n", r.Error)
+			}
+		}
+	}
+	if rulesErr != nil {
+		fmt.Fprintln(os.Stderr, "⚠️  Rules not loaded:", rulesErr)
+	}
+}
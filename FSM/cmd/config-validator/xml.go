@@ -0,0 +1,19 @@
+package main
+
+import (
+	"config-validator/pkg/automata"
+	"config-validator/pkg/xmlcheck"
+)
+
+// runXML implements `config-validator xml`: tag nesting, attribute quoting, entity
+// syntax, and the single root are checked with a pushdown automaton over the tags.
+// -format json prints the errors with their open-tag stack, like the PDA's JSON errors.
+func runXML(args []string) {
+	runDocumentCheck("xml", args, func(content []byte) ([]automata.Finding, any) {
+		errs := xmlcheck.Check(content)
+		if errs == nil {
+			errs = []xmlcheck.Error{}
+		}
+		return xmlcheck.Findings(errs), errs
+	})
+}
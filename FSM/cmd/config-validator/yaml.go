@@ -0,0 +1,14 @@
+package main
+
+import (
+	"config-validator/pkg/automata"
+	"config-validator/pkg/yamlcheck"
+)
+
+// runYAML implements `config-validator yaml`: the structure of a YAML document is
+// checked (indentation, tabs, duplicate keys, anchors and aliases).
+func runYAML(args []string) {
+	runDocumentCheck("yaml", args, func(content []byte) ([]automata.Finding, any) {
+		return yamlcheck.Check(content), nil
+	})
+}
@@ -0,0 +1,57 @@
+//go:build wasip1
+
+// Command wasm-vlan is an example WASM rule check. Build it with
+//
+//	GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o vlan.wasm ./examples/wasm-vlan
+//
+// and reference it from rules.yaml as "vlan.wasm:vlan_range".
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"unsafe"
+)
+
+type request struct {
+	Line    string   `json:"line"`
+	LineNum int      `json:"line_num"`
+	State   string   `json:"state"`
+	Groups  []string `json:"groups"`
+}
+
+// buffers keeps memory handed to the host reachable until the next call.
+var buffers [][]byte
+
+func main() {}
+
+//go:wasmexport alloc
+func alloc(size uint32) unsafe.Pointer {
+	buf := make([]byte, size)
+	buffers = append(buffers[:0], buf)
+	return unsafe.Pointer(unsafe.SliceData(buf))
+}
+
+//go:wasmexport vlan_range
+func vlanRange(ptr unsafe.Pointer, size uint32) uint64 {
+	var req request
+	if err := json.Unmarshal(unsafe.Slice((*byte)(ptr), size), &req); err != nil {
+		return result([]string{"invalid request: " + err.Error()})
+	}
+	if len(req.Groups) < 2 {
+		return 0
+	}
+	vlan, err := strconv.Atoi(req.Groups[1])
+	if err != nil || vlan < 1 || vlan > 4094 {
+		return result([]string{fmt.Sprintf("VLAN %s out of range 1-4094", req.Groups[1])})
+	}
+	return 0
+}
+
+// result returns messages to the host as (ptr << 32 | len) of their JSON encoding.
+func result(messages []string) uint64 {
+	out, _ := json.Marshal(messages)
+	buffers = append(buffers, out)
+	return uint64(uintptr(unsafe.Pointer(unsafe.SliceData(out))))<<32 | uint64(len(out))
+}
@@ -0,0 +1,225 @@
+package acl
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"strconv"
+)
+
+// ACL is an IOS access list: a named `ip access-list standard|extended NAME` block or
+// the `access-list N ...` lines sharing a number.
+type ACL struct {
+	Name     string
+	Extended bool
+	Line     int // line of the header, or of the first entry for numbered lists
+	Entries  []Entry
+}
+
+// Entry is one permit or deny statement. Entries using matches the model does not
+// cover (object groups, neq, established, ICMP types, ...) are kept but marked
+// Opaque and left out of the shadowing analysis.
+type Entry struct {
+	Index    int // 1-based position in the ACL
+	Line     int
+	Text     string
+	Action   string // "permit" or "deny"
+	Protocol string // "ip" for standard lists
+	Src, Dst Address
+	SrcPorts PortRange
+	DstPorts PortRange
+	Log      bool
+	Opaque   bool
+}
+
+// Address is an IOS address and wildcard mask; set wildcard bits are "don't care".
+type Address struct {
+	IP       uint32
+	Wildcard uint32
+}
+
+// PortRange is an inclusive range of ports; 0-65535 when the entry has no port match.
+type PortRange struct {
+	Lo, Hi uint16
+}
+
+var anyAddress = Address{Wildcard: 0xFFFFFFFF}
+var anyPort = PortRange{0, 65535}
+
+// Contains reports whether every address matched by b is matched by a.
+func (a Address) Contains(b Address) bool {
+	return a.Wildcard&b.Wildcard == b.Wildcard && a.IP&^a.Wildcard == b.IP&^a.Wildcard
+}
+
+// Contains reports whether r covers every port of o.
+func (r PortRange) Contains(o PortRange) bool {
+	return r.Lo <= o.Lo && o.Hi <= r.Hi
+}
+
+// Covers reports whether every packet matched by b is also matched by a.
+func (a Entry) Covers(b Entry) bool {
+	if a.Opaque || b.Opaque {
+		return false
+	}
+	if a.Protocol != "ip" && a.Protocol != b.Protocol {
+		return false
+	}
+	return a.Src.Contains(b.Src) && a.Dst.Contains(b.Dst) &&
+		a.SrcPorts.Contains(b.SrcPorts) && a.DstPorts.Contains(b.DstPorts)
+}
+
+// namedPorts are the IOS port keywords the parser understands.
+var namedPorts = map[string]uint16{
+	"ftp-data": 20, "ftp": 21, "ssh": 22, "telnet": 23, "smtp": 25, "domain": 53,
+	"bootps": 67, "bootpc": 68, "tftp": 69, "www": 80, "pop3": 110, "ntp": 123,
+	"snmp": 161, "snmptrap": 162, "bgp": 179, "https": 443, "syslog": 514,
+}
+
+// parseEntry parses the text after the optional sequence number of an entry.
+func parseEntry(fields []string, extended bool) (Entry, error) {
+	e := Entry{Action: fields[0], Protocol: "ip", Src: anyAddress, Dst: anyAddress, SrcPorts: anyPort, DstPorts: anyPort}
+	rest := fields[1:]
+	var err error
+	if extended {
+		if len(rest) == 0 {
+			return e, fmt.Errorf("missing protocol")
+		}
+		e.Protocol, rest = rest[0], rest[1:]
+		if e.Src, rest, err = parseAddress(rest); err != nil {
+			return e, err
+		}
+		if e.SrcPorts, rest, err = e.parsePorts(rest); err != nil {
+			return e, err
+		}
+		if e.Dst, rest, err = parseAddress(rest); err != nil {
+			return e, err
+		}
+		if e.DstPorts, rest, err = e.parsePorts(rest); err != nil {
+			return e, err
+		}
+	} else if e.Src, rest, err = parseAddress(rest); err != nil {
+		return e, err
+	}
+
+	for _, f := range rest {
+		if f == "log" || f == "log-input" {
+			e.Log = true
+		} else {
+			e.Opaque = true
+		}
+	}
+	return e, nil
+}
+
+// parseAddress reads `any`, `host A.B.C.D`, or `A.B.C.D [wildcard]`.
+func parseAddress(fields []string) (Address, []string, error) {
+	if len(fields) == 0 {
+		return Address{}, nil, fmt.Errorf("missing address")
+	}
+	switch fields[0] {
+	case "any":
+		return anyAddress, fields[1:], nil
+	case "host":
+		if len(fields) < 2 {
+			return Address{}, nil, fmt.Errorf("missing host address")
+		}
+		ip, err := parseIPv4(fields[1])
+		return Address{IP: ip}, fields[2:], err
+	}
+	ip, err := parseIPv4(fields[0])
+	if err != nil {
+		return Address{}, nil, err
+	}
+	if len(fields) > 1 {
+		if wildcard, err := parseIPv4(fields[1]); err == nil {
+			return Address{IP: ip, Wildcard: wildcard}, fields[2:], nil
+		}
+	}
+	return Address{IP: ip}, fields[1:], nil
+}
+
+func parseIPv4(s string) (uint32, error) {
+	addr, err := netip.ParseAddr(s)
+	if err != nil || !addr.Is4() {
+		return 0, fmt.Errorf("invalid address '%s'", s)
+	}
+	b := addr.As4()
+	return binary.BigEndian.Uint32(b[:]), nil
+}
+
+// parsePorts reads an optional eq/lt/gt/range port match for tcp and udp entries.
+func (e *Entry) parsePorts(fields []string) (PortRange, []string, error) {
+	if (e.Protocol != "tcp" && e.Protocol != "udp") || len(fields) == 0 {
+		return anyPort, fields, nil
+	}
+	port := func(s string) (uint16, error) {
+		if p, ok := namedPorts[s]; ok {
+			return p, nil
+		}
+		p, err := strconv.ParseUint(s, 10, 16)
+		if err != nil {
+			return 0, fmt.Errorf("unknown port '%s'", s)
+		}
+		return uint16(p), nil
+	}
+	switch fields[0] {
+	case "eq", "lt", "gt":
+		if len(fields) < 2 {
+			return anyPort, nil, fmt.Errorf("missing port")
+		}
+		if len(fields) > 2 && isPort(fields[2]) {
+			e.Opaque = true // eq with several ports
+		}
+		p, err := port(fields[1])
+		if err != nil {
+			e.Opaque = true
+			return anyPort, fields[2:], nil
+		}
+		switch fields[0] {
+		case "eq":
+			return PortRange{p, p}, fields[2:], nil
+		case "lt":
+			return PortRange{0, max(p, 1) - 1}, fields[2:], nil
+		default:
+			return PortRange{min(p, 65534) + 1, 65535}, fields[2:], nil
+		}
+	case "range":
+		if len(fields) < 3 {
+			return anyPort, nil, fmt.Errorf("missing port range")
+		}
+		lo, err1 := port(fields[1])
+		hi, err2 := port(fields[2])
+		if err1 != nil || err2 != nil {
+			e.Opaque = true
+		}
+		return PortRange{lo, hi}, fields[3:], nil
+	case "neq":
+		if len(fields) < 2 {
+			return anyPort, nil, fmt.Errorf("missing port")
+		}
+		e.Opaque = true
+		return anyPort, fields[2:], nil
+	}
+	return anyPort, fields, nil
+}
+
+func isPort(s string) bool {
+	if _, ok := namedPorts[s]; ok {
+		return true
+	}
+	_, err := strconv.ParseUint(s, 10, 16)
+	return err == nil
+}
+
+// isIPNumber reports whether a numbered ACL filters IPv4 (1-199, 1300-2699) rather
+// than, say, MAC addresses (700-799).
+func isIPNumber(n string) bool {
+	v, err := strconv.Atoi(n)
+	return err == nil && ((v >= 1 && v <= 199) || (v >= 1300 && v <= 2699))
+}
+
+// isStandardNumber reports whether a numbered ACL is a standard one (1-99, 1300-1999).
+func isStandardNumber(n string) bool {
+	v, err := strconv.Atoi(n)
+	return err == nil && (v <= 99 || (v >= 1300 && v <= 1999))
+}
@@ -0,0 +1,161 @@
+package acl
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"config-validator/pkg/automata"
+)
+
+var (
+	namedHeaderRe = regexp.MustCompile(`^ip access-list (standard|extended) (\S+)$`)
+	numberedRe    = regexp.MustCompile(`^access-list (\d+) ((?:permit|deny) .+)$`)
+	entryRe       = regexp.MustCompile(`^(?:\d+ )?((?:permit|deny) .+)$`)
+)
+
+// Analyzer builds the ACL model from a config, line by line, and reports shadowed,
+// redundant, and unlogged-default-deny problems once the config has been read.
+type Analyzer struct {
+	ACLs     []*ACL
+	numbered map[string]*ACL
+	current  *ACL // named ACL whose entries are being read
+	Findings []automata.Finding
+}
+
+// Line feeds one line of the config to the analyzer.
+func (a *Analyzer) Line(originalLine string, lineNum int) {
+	line := strings.TrimSpace(originalLine)
+	if line == "" || strings.HasPrefix(line, "!") {
+		a.current = nil
+		return
+	}
+	indented := strings.HasPrefix(originalLine, " ")
+
+	if m := namedHeaderRe.FindStringSubmatch(line); m != nil && !indented {
+		a.current = &ACL{Name: m[2], Extended: m[1] == "extended", Line: lineNum}
+		a.ACLs = append(a.ACLs, a.current)
+		return
+	}
+	if a.current != nil && indented {
+		if m := entryRe.FindStringSubmatch(line); m != nil {
+			a.addEntry(a.current, m[1], line, lineNum)
+		}
+		return // remarks and other sub-commands
+	}
+	a.current = nil
+
+	if m := numberedRe.FindStringSubmatch(line); m != nil && isIPNumber(m[1]) {
+		if a.numbered == nil {
+			a.numbered = map[string]*ACL{}
+		}
+		list, ok := a.numbered[m[1]]
+		if !ok {
+			list = &ACL{Name: m[1], Extended: !isStandardNumber(m[1]), Line: lineNum}
+			a.numbered[m[1]] = list
+			a.ACLs = append(a.ACLs, list)
+		}
+		a.addEntry(list, m[2], line, lineNum)
+	}
+}
+
+func (a *Analyzer) addEntry(list *ACL, statement, line string, lineNum int) {
+	e, err := parseEntry(strings.Fields(statement), list.Extended)
+	e.Index, e.Line, e.Text = len(list.Entries)+1, lineNum, line
+	if err != nil {
+		e.Opaque = true // malformed entries are the rules' business, not the analysis'
+	}
+	list.Entries = append(list.Entries, e)
+}
+
+// Finish analyses every ACL read so far and returns the findings.
+func (a *Analyzer) Finish() []automata.Finding {
+	for _, list := range a.ACLs {
+		a.analyse(list)
+	}
+	return a.Findings
+}
+
+func (a *Analyzer) analyse(list *ACL) {
+	for j, later := range list.Entries {
+		for _, earlier := range list.Entries[:j] {
+			if !earlier.Covers(later) {
+				continue
+			}
+			if earlier.Action == later.Action {
+				a.add(later.Line, later.Text, "acl.redundant", fmt.Sprintf("ACL %s entry %d (line %d) is redundant: entry %d (line %d) already %s all its traffic",
+					list.Name, later.Index, later.Line, earlier.Index, earlier.Line, verbs[earlier.Action]))
+			} else {
+				a.add(later.Line, later.Text, "acl.shadowed", fmt.Sprintf("ACL %s entry %d (line %d) is unreachable: shadowed by entry %d (line %d), which %s all its traffic first",
+					list.Name, later.Index, later.Line, earlier.Index, earlier.Line, verbs[earlier.Action]))
+			}
+			break
+		}
+	}
+
+	if len(list.Entries) == 0 {
+		return
+	}
+	last := list.Entries[len(list.Entries)-1]
+	catchAll := Entry{Protocol: "ip", Src: anyAddress, Dst: anyAddress, SrcPorts: anyPort, DstPorts: anyPort}
+	switch {
+	case last.Action != "deny" || !last.Covers(catchAll):
+		a.add(list.Line, "", "acl.no-final-deny", fmt.Sprintf("ACL %s has no explicit final deny; add '%s' so dropped traffic is logged", list.Name, denyAll(list)))
+	case !last.Log:
+		a.add(last.Line, last.Text, "acl.final-deny-no-log", fmt.Sprintf("ACL %s final deny (entry %d) does not log; use '%s'", list.Name, last.Index, denyAll(list)))
+	}
+}
+
+var verbs = map[string]string{"permit": "permits", "deny": "denies"}
+
+func denyAll(list *ACL) string {
+	if list.Extended {
+		return "deny ip any any log"
+	}
+	return "deny any log"
+}
+
+func (a *Analyzer) add(lineNum int, line, code, msg string) {
+	a.Findings = append(a.Findings, automata.Finding{
+		Line:     lineNum,
+		Command:  line,
+		State:    "ACL",
+		Message:  msg,
+		Severity: automata.SeverityWarning,
+		Code:     code,
+	})
+}
+
+// Append adds the ACLs of other, an analyzer fed the lines after a's on their own,
+// with their line numbers moved by shift, as if a had been fed those lines: entries
+// of a numbered list a already has go on at its end. other is not modified.
+func (a *Analyzer) Append(other *Analyzer, shift int) {
+	for _, list := range other.ACLs {
+		entries := make([]Entry, len(list.Entries))
+		for i, e := range list.Entries {
+			e.Line += shift
+			entries[i] = e
+		}
+		if other.numbered[list.Name] != list {
+			a.ACLs = append(a.ACLs, &ACL{Name: list.Name, Extended: list.Extended, Line: list.Line + shift, Entries: entries})
+			continue
+		}
+		if existing, ok := a.numbered[list.Name]; ok {
+			for _, e := range entries {
+				e.Index = len(existing.Entries) + 1
+				existing.Entries = append(existing.Entries, e)
+			}
+			continue
+		}
+		if a.numbered == nil {
+			a.numbered = map[string]*ACL{}
+		}
+		a.numbered[list.Name] = &ACL{Name: list.Name, Extended: list.Extended, Line: list.Line + shift, Entries: entries}
+		a.ACLs = append(a.ACLs, a.numbered[list.Name])
+	}
+	for _, f := range other.Findings {
+		f.Line += shift
+		a.Findings = append(a.Findings, f)
+	}
+	a.current = nil
+}
@@ -0,0 +1,360 @@
+package addressing
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strings"
+
+	"config-validator/pkg/automata"
+)
+
+var (
+	interfaceRe = regexp.MustCompile(`^interface (\S+)`)
+	routerRe    = regexp.MustCompile(`^router (\S+)`)
+	addressRe   = regexp.MustCompile(`^ip address (\S+) (\S+)( secondary)?$`)
+	hsrpRe      = regexp.MustCompile(`^standby (?:(\d+) )?ip (\S+)`)
+	vrrpRe      = regexp.MustCompile(`^vrrp (\d+) ip (\S+)`)
+	// network statements: OSPF/EIGRP use wildcards, BGP a mask.
+	wildcardNetworkRe = regexp.MustCompile(`^network (\S+) (\S+)(?: area .+)?$`)
+	bgpNetworkRe      = regexp.MustCompile(`^network (\S+) mask (\S+)`)
+	vrfForwardingRe   = regexp.MustCompile(`^(?:ip )?vrf forwarding (\S+)`)
+)
+
+// Analyzer checks IP addressing with real address parsing: legal interface addresses
+// and masks, host bits in routing network statements, subnets overlapping across
+// interfaces in the same VRF, and HSRP/VRRP virtual addresses outside the interface's
+// subnet.
+type Analyzer struct {
+	Findings []automata.Finding
+
+	iface    string
+	router   string
+	subnets  []subnet
+	virtuals []virtual
+	vrfs     map[string]string // the VRF of each interface with vrf forwarding
+}
+
+type subnet struct {
+	iface  string
+	prefix netip.Prefix // address with its prefix length, host bits kept
+	line   int
+	text   string
+}
+
+type virtual struct {
+	iface string
+	proto string // "HSRP group N" or "VRRP group N"
+	addr  netip.Addr
+	line  int
+	text  string
+}
+
+// Line feeds one line of the config to the analyzer.
+func (a *Analyzer) Line(originalLine string, lineNum int) {
+	line := strings.TrimSpace(originalLine)
+	if line == "" || strings.HasPrefix(line, "!") {
+		a.iface, a.router = "", ""
+		return
+	}
+	if !strings.HasPrefix(originalLine, " ") {
+		a.iface, a.router = "", ""
+		if m := interfaceRe.FindStringSubmatch(line); m != nil {
+			a.iface = m[1]
+		} else if m := routerRe.FindStringSubmatch(line); m != nil {
+			a.router = m[1]
+		}
+		return
+	}
+
+	switch {
+	case a.iface != "":
+		a.interfaceLine(line, lineNum)
+	case a.router != "":
+		a.routerLine(line, lineNum)
+	}
+}
+
+func (a *Analyzer) interfaceLine(line string, lineNum int) {
+	if m := vrfForwardingRe.FindStringSubmatch(line); m != nil {
+		if a.vrfs == nil {
+			a.vrfs = map[string]string{}
+		}
+		a.vrfs[a.iface] = m[1]
+		return
+	}
+	if m := addressRe.FindStringSubmatch(line); m != nil {
+		addr, err := parseIPv4(m[1])
+		if err != nil {
+			a.invalid(lineNum, line, err)
+			return
+		}
+		bits, err := maskBits(m[2])
+		if err != nil {
+			a.invalid(lineNum, line, err)
+			return
+		}
+		prefix := netip.PrefixFrom(addr, bits)
+		if bits < 31 {
+			switch addr {
+			case prefix.Masked().Addr():
+				a.add(lineNum, line, "addressing.network-address", fmt.Sprintf("%s is the network address of %s", addr, prefix.Masked()))
+				return
+			case broadcast(prefix):
+				a.add(lineNum, line, "addressing.broadcast-address", fmt.Sprintf("%s is the broadcast address of %s", addr, prefix.Masked()))
+				return
+			}
+		}
+		a.subnets = append(a.subnets, subnet{iface: a.iface, prefix: prefix, line: lineNum, text: line})
+		return
+	}
+
+	var m []string
+	var proto string
+	if m = hsrpRe.FindStringSubmatch(line); m != nil {
+		group := m[1]
+		if group == "" {
+			group = "0"
+		}
+		proto = "HSRP group " + group
+	} else if m = vrrpRe.FindStringSubmatch(line); m != nil {
+		proto = "VRRP group " + m[1]
+	} else {
+		return
+	}
+	addr, err := parseIPv4(m[2])
+	if err != nil {
+		a.invalid(lineNum, line, err)
+		return
+	}
+	a.virtuals = append(a.virtuals, virtual{iface: a.iface, proto: proto, addr: addr, line: lineNum, text: line})
+}
+
+func (a *Analyzer) routerLine(line string, lineNum int) {
+	if m := bgpNetworkRe.FindStringSubmatch(line); m != nil {
+		addr, err := parseIPv4(m[1])
+		if err != nil {
+			a.invalid(lineNum, line, err)
+			return
+		}
+		bits, err := maskBits(m[2])
+		if err != nil {
+			a.invalid(lineNum, line, err)
+			return
+		}
+		if p := netip.PrefixFrom(addr, bits); p.Masked().Addr() != addr {
+			a.add(lineNum, line, "addressing.host-bits", fmt.Sprintf("network %s has host bits set for mask %s (did you mean %s?)", addr, m[2], p.Masked().Addr()))
+		}
+		return
+	}
+	if m := wildcardNetworkRe.FindStringSubmatch(line); m != nil {
+		addr, err := parseIPv4(m[1])
+		if err != nil {
+			a.invalid(lineNum, line, err)
+			return
+		}
+		wildcard, err := parseIPv4(m[2])
+		if err != nil {
+			return // e.g. "network 10.0.0.0" in RIP, which takes no wildcard
+		}
+		a4, w4 := addr.As4(), wildcard.As4()
+		for i := range a4 {
+			if a4[i]&w4[i] != 0 {
+				a.add(lineNum, line, "addressing.wildcard-bits", fmt.Sprintf("network %s has bits set under wildcard %s", addr, wildcard))
+				return
+			}
+		}
+	}
+}
+
+// Finish runs the checks that need the whole config and returns the findings.
+func (a *Analyzer) Finish() []automata.Finding {
+	// Each VRF is a routing table of its own, so only subnets in the same VRF can
+	// overlap. Only subnets that overlap any other are compared pairwise, so configs
+	// with thousands of interfaces and few overlaps are not checked in quadratic time
+	byVRF := map[string][]int{}
+	for i, s := range a.subnets {
+		byVRF[a.vrfs[s.iface]] = append(byVRF[a.vrfs[s.iface]], i)
+	}
+	overlapping := make([]bool, len(a.subnets))
+	for _, indexes := range byVRF {
+		subnets := make([]subnet, len(indexes))
+		for k, i := range indexes {
+			subnets[k] = a.subnets[i]
+		}
+		for k, overlaps := range overlaps(subnets) {
+			overlapping[indexes[k]] = overlaps
+		}
+	}
+	for i, s := range a.subnets {
+		if !overlapping[i] {
+			continue
+		}
+		for j, earlier := range a.subnets[:i] {
+			if !overlapping[j] || earlier.iface == s.iface || a.vrfs[earlier.iface] != a.vrfs[s.iface] || !earlier.prefix.Overlaps(s.prefix) {
+				continue
+			}
+			a.add(s.line, s.text, "addressing.overlap", fmt.Sprintf("subnet %s on %s overlaps %s on %s (line %d)",
+				s.prefix.Masked(), s.iface, earlier.prefix.Masked(), earlier.iface, earlier.line))
+			break
+		}
+	}
+
+	for _, v := range a.virtuals {
+		var inSubnet bool
+		for _, s := range a.subnets {
+			if s.iface != v.iface {
+				continue
+			}
+			if s.prefix.Addr() == v.addr {
+				a.add(v.line, v.text, "addressing.vip-own-address", fmt.Sprintf("%s virtual address %s is the interface's own address", v.proto, v.addr))
+				inSubnet = true
+				break
+			}
+			if s.prefix.Contains(v.addr) {
+				inSubnet = true
+			}
+		}
+		if !inSubnet {
+			a.add(v.line, v.text, "addressing.vip-outside-subnet", fmt.Sprintf("%s virtual address %s is not in any subnet of %s", v.proto, v.addr, v.iface))
+		}
+	}
+	return a.Findings
+}
+
+// overlaps reports which subnets overlap at least one other. Prefixes either nest
+// or are disjoint, so with the subnets sorted by first address, largest first, a
+// subnet overlaps another exactly when it starts before the furthest end so far,
+// inside the subnet reaching there, which overlaps it too.
+func overlaps(subnets []subnet) []bool {
+	type span struct {
+		first, last uint32
+		i           int
+	}
+	spans := make([]span, len(subnets))
+	for i, s := range subnets {
+		first := ipv4Value(s.prefix.Masked().Addr())
+		host := uint32(1)<<(32-s.prefix.Bits()) - 1
+		spans[i] = span{first, first | host, i}
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		if spans[i].first != spans[j].first {
+			return spans[i].first < spans[j].first
+		}
+		return spans[i].last > spans[j].last
+	})
+	overlapping := make([]bool, len(subnets))
+	reach := -1 // index in spans of the subnet ending furthest so far
+	for k, sp := range spans {
+		if reach >= 0 && sp.first <= spans[reach].last {
+			overlapping[sp.i], overlapping[spans[reach].i] = true, true
+		}
+		if reach < 0 || sp.last > spans[reach].last {
+			reach = k
+		}
+	}
+	return overlapping
+}
+
+func ipv4Value(addr netip.Addr) uint32 {
+	b := addr.As4()
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
+
+// Prefixes returns the interface addresses seen so far with their prefix lengths, for
+// passes that relate other statements to the interfaces.
+func (a *Analyzer) Prefixes() []netip.Prefix {
+	prefixes := make([]netip.Prefix, len(a.subnets))
+	for i, s := range a.subnets {
+		prefixes[i] = s.prefix
+	}
+	return prefixes
+}
+
+// invalidError is an address or netmask that does not parse, with the code of the
+// finding reporting it.
+type invalidError struct {
+	code, msg string
+}
+
+func (e *invalidError) Error() string { return e.msg }
+
+// invalid reports an address or netmask that does not parse.
+func (a *Analyzer) invalid(lineNum int, line string, err error) {
+	code := ""
+	if e, ok := err.(*invalidError); ok {
+		code = e.code
+	}
+	a.add(lineNum, line, code, err.Error())
+}
+
+func parseIPv4(s string) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(s)
+	if err != nil || !addr.Is4() {
+		return netip.Addr{}, &invalidError{"addressing.invalid-address", "invalid IPv4 address " + s}
+	}
+	return addr, nil
+}
+
+// maskBits returns the prefix length of a dotted netmask, which must be contiguous.
+func maskBits(s string) (int, error) {
+	mask, err := netip.ParseAddr(s)
+	if err != nil || !mask.Is4() {
+		return 0, &invalidError{"addressing.invalid-netmask", "invalid netmask " + s}
+	}
+	m := mask.As4()
+	value := uint32(m[0])<<24 | uint32(m[1])<<16 | uint32(m[2])<<8 | uint32(m[3])
+	inverted := ^value
+	if inverted&(inverted+1) != 0 {
+		return 0, &invalidError{"addressing.netmask-not-contiguous", "invalid netmask " + s + " (not contiguous)"}
+	}
+	bits := 32
+	for ; inverted != 0; inverted >>= 1 {
+		bits--
+	}
+	return bits, nil
+}
+
+func broadcast(p netip.Prefix) netip.Addr {
+	b := p.Masked().Addr().As4()
+	host := uint32(1)<<(32-p.Bits()) - 1
+	v := uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3]) | host
+	return netip.AddrFrom4([4]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)})
+}
+
+func (a *Analyzer) add(lineNum int, line, code, msg string) {
+	a.Findings = append(a.Findings, automata.Finding{
+		Line:     lineNum,
+		Command:  line,
+		State:    "ADDRESSING",
+		Message:  msg,
+		Severity: automata.SeverityError,
+		Code:     code,
+	})
+}
+
+// Append adds what other, an analyzer fed the lines after a's on their own, found,
+// with its line numbers moved by shift, as if a had been fed those lines. other is
+// not modified.
+func (a *Analyzer) Append(other *Analyzer, shift int) {
+	for _, f := range other.Findings {
+		f.Line += shift
+		a.Findings = append(a.Findings, f)
+	}
+	for _, s := range other.subnets {
+		s.line += shift
+		a.subnets = append(a.subnets, s)
+	}
+	for _, v := range other.virtuals {
+		v.line += shift
+		a.virtuals = append(a.virtuals, v)
+	}
+	for iface, vrf := range other.vrfs {
+		if a.vrfs == nil {
+			a.vrfs = map[string]string{}
+		}
+		a.vrfs[iface] = vrf
+	}
+	a.iface, a.router = "", ""
+}
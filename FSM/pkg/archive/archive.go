@@ -0,0 +1,119 @@
+// Package archive reads the files inside zip and tar archives in memory, so config
+// backups exported as bundles can be validated without extracting them to disk.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// MaxEntrySize bounds the size of a single file read from an archive, so that a
+// malformed or malicious archive cannot exhaust memory.
+const MaxEntrySize = 256 << 20
+
+// Entry is a regular file inside an archive.
+type Entry struct {
+	Name    string // path inside the archive
+	Content []byte
+}
+
+// IsArchive reports whether path names an archive format that Walk reads.
+func IsArchive(path string) bool {
+	lower := strings.ToLower(path)
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// Walk calls fn for every regular file in the archive whose name match accepts,
+// in archive order. It stops at the first error fn returns.
+func Walk(path string, match func(name string) bool, fn func(Entry) error) error {
+	if strings.HasSuffix(strings.ToLower(path), ".zip") {
+		return walkZip(path, match, fn)
+	}
+	return walkTar(path, match, fn)
+}
+
+func walkZip(path string, match func(string) bool, fn func(Entry) error) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive %s: %v", path, err)
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() || !match(f.Name) {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("failed to read %s from %s: %v", f.Name, path, err)
+		}
+		content, err := readEntry(rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read %s from %s: %v", f.Name, path, err)
+		}
+		if err := fn(Entry{Name: f.Name, Content: content}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkTar(path string, match func(string) bool, fn func(Entry) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive %s: %v", path, err)
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if lower := strings.ToLower(path); strings.HasSuffix(lower, ".gz") || strings.HasSuffix(lower, ".tgz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("failed to open archive %s: %v", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive %s: %v", path, err)
+		}
+		if hdr.Typeflag != tar.TypeReg || !match(hdr.Name) {
+			continue
+		}
+		content, err := readEntry(tr)
+		if err != nil {
+			return fmt.Errorf("failed to read %s from %s: %v", hdr.Name, path, err)
+		}
+		if err := fn(Entry{Name: hdr.Name, Content: content}); err != nil {
+			return err
+		}
+	}
+}
+
+func readEntry(r io.Reader) ([]byte, error) {
+	content, err := io.ReadAll(io.LimitReader(r, MaxEntrySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > MaxEntrySize {
+		return nil, fmt.Errorf("file is larger than %d MiB", MaxEntrySize>>20)
+	}
+	return content, nil
+}
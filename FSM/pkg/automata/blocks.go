@@ -0,0 +1,53 @@
+package automata
+
+import (
+	"regexp"
+	"strings"
+)
+
+// StartsBlock reports whether a line starts a block that the FSM validates
+// independently of the lines before it: a line that is not indented and is not a
+// comment or blank line. Whatever the comment and blank lines before it did, the FSM
+// is back in GLOBAL there, so a block's findings depend only on its own lines. The
+// analysis passes, which start over at such lines too, can look at blocks on their
+// own the same way.
+func StartsBlock(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return !strings.HasPrefix(line, " ") && trimmed != "" && !strings.HasPrefix(trimmed, "!")
+}
+
+// Fork starts another run of the machine fsm is a run of, with the same Trace, for
+// validating a block on its own (see Absorb).
+func (fsm *FSM) Fork() *FSM {
+	run := fsm.machine.NewRun()
+	run.Trace = fsm.Trace
+	return run
+}
+
+// Absorb adds what run, a Fork that processed the lines of one block, found to fsm,
+// as if fsm had processed those lines with their numbers moved by shift: the
+// findings, and the counters of Stats. A config is warned about a deprecated rule
+// once, at its first line, so a warning of run is dropped when fsm has already
+// warned about the rule. run is not modified and may be absorbed again.
+func (fsm *FSM) Absorb(run *FSM, shift int) {
+	for i, f := range run.Findings {
+		if re, ok := run.warnings[i]; ok {
+			if fsm.warned[re] {
+				continue
+			}
+			fsm.warn(re)
+		}
+		f.Line += shift
+		fsm.AddFinding(f)
+	}
+	fsm.stats.add(run.stats)
+}
+
+// warn records that the deprecation warning for a rule is the next finding.
+func (fsm *FSM) warn(re *regexp.Regexp) {
+	if fsm.warnings == nil {
+		fsm.warnings = map[int]*regexp.Regexp{}
+	}
+	fsm.warned[re] = true
+	fsm.warnings[len(fsm.Findings)] = re
+}
@@ -0,0 +1,75 @@
+package automata
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// builtinRules are the default rules compiled into the binary: rules.yaml, the
+// scripts it references, and the role profiles, so the validator works from any
+// directory without a rules file on disk.
+//
+//go:embed rules.yaml semantic.star roles/*.yaml
+var builtinRules embed.FS
+
+// WriteBuiltinRules writes the built-in rules under dir, in a directory named by
+// their content hash so each version is written once and files in use are never
+// changed, and returns the path of rules.yaml there. Rules are loaded from files
+// because extends, scripts, and roles resolve relative to the rules file.
+func WriteBuiltinRules(dir string) (string, error) {
+	h := sha256.New()
+	var files []string
+	err := fs.WalkDir(builtinRules, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := builtinRules.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		h.Write([]byte(path + "\x00"))
+		h.Write(data)
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	target := filepath.Join(dir, "builtin-"+hex.EncodeToString(h.Sum(nil))[:12])
+	rules := filepath.Join(target, "rules.yaml")
+	if _, err := os.Stat(rules); err == nil {
+		return rules, nil
+	}
+
+	// Write to a temporary directory and rename it into place, so a concurrent run
+	// never sees a partial copy.
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	tmp, err := os.MkdirTemp(dir, ".builtin-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	for _, path := range files {
+		data, _ := builtinRules.ReadFile(path)
+		out := filepath.Join(tmp, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(out, data, 0o644); err != nil {
+			return "", err
+		}
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		if _, statErr := os.Stat(rules); statErr == nil {
+			return rules, nil // another run wrote it first
+		}
+		return "", err
+	}
+	return rules, nil
+}
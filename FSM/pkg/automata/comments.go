@@ -0,0 +1,70 @@
+package automata
+
+import (
+	"fmt"
+	"strings"
+)
+
+// How the FSM treats comment lines (starting with !) and blank lines, as a rules
+// file sets it with `comments:` and `blank_lines:`.
+const (
+	LinesReset     = "reset"     // return to GLOBAL, ending the block; the default
+	LinesIgnore    = "ignore"    // skip the line, the block goes on after it
+	LinesSeparator = "separator" // end the block when not indented, skip it inside one
+)
+
+// LineHandling is how a rules file has the FSM treat comment and blank lines. IOS
+// writes ! between top-level blocks, and some configs have ! or blank lines inside
+// an interface block too, which reset would cut short; separator only ends a block
+// at an unindented one. Empty fields mean LinesReset.
+//
+// Continuation and WrapWidth join the physical lines of commands that span several
+// into one before the FSM sees them (see linereader.Joiner): lines ending in the
+// marker, and lines exactly WrapWidth characters long, go on on the next line.
+// Negations is how the no and default forms of commands are validated.
+type LineHandling struct {
+	Comments     string
+	BlankLines   string
+	Continuation string
+	WrapWidth    int
+	Negations    string // see NegationsAccept; empty means NegationsOff
+}
+
+func checkLineMode(mode string) error {
+	switch mode {
+	case "", LinesReset, LinesIgnore, LinesSeparator:
+		return nil
+	}
+	return fmt.Errorf("unknown mode %q (reset, ignore, or separator)", mode)
+}
+
+// mode returns how a trimmed line is treated when it is a comment or blank line,
+// and false for any other line.
+func (l LineHandling) mode(trimmed string) (string, bool) {
+	var mode string
+	switch {
+	case trimmed == "":
+		mode = l.BlankLines
+	case strings.HasPrefix(trimmed, "!"):
+		mode = l.Comments
+	default:
+		return "", false
+	}
+	if mode == "" {
+		mode = LinesReset
+	}
+	return mode, true
+}
+
+// ends reports whether a comment or blank line in the mode ends the block it is in.
+func ends(mode, originalLine string) bool {
+	return mode == LinesReset || (mode == LinesSeparator && !strings.HasPrefix(originalLine, " "))
+}
+
+// WithLines returns a Machine sharing m's compiled rules that treats comment and
+// blank lines as l says.
+func (m *Machine) WithLines(l LineHandling) *Machine {
+	out := *m
+	out.lines = l
+	return &out
+}
@@ -0,0 +1,106 @@
+package automata
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	vrfBlockRe      = regexp.MustCompile(`^(?:vrf definition|ip vrf) (\S+)$`)
+	nestedVRFRe     = regexp.MustCompile(`^vrf (\S+)$`)
+	addressFamilyRe = regexp.MustCompile(`^address-family (ipv4|ipv6|vpnv4|vpnv6|l2vpn)(?: (unicast|multicast|vpls|evpn))?(?: vrf (\S+))?$`)
+)
+
+// Context is the VRF and address-family a line is in, which the states alone do not
+// tell: the lines under `address-family ipv4 vrf RED` of a `router bgp` block are
+// validated in ROUTER like the rest of the block. Empty fields are the global
+// routing table and no address-family.
+type Context struct {
+	VRF           string `json:"vrf,omitempty"`
+	AddressFamily string `json:"address_family,omitempty"` // e.g. "ipv4 unicast"
+}
+
+func (c Context) String() string {
+	var parts []string
+	if c.VRF != "" {
+		parts = append(parts, "vrf "+c.VRF)
+	}
+	if c.AddressFamily != "" {
+		parts = append(parts, "address-family "+c.AddressFamily)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Contexts follows the context through the lines of a config:
+//   - `vrf definition NAME` and `ip vrf NAME` blocks are in the VRF;
+//   - `address-family AFI [SAFI] [vrf NAME]` inside a block starts an address-family,
+//     in the VRF it names or else in that of the block, until exit-address-family
+//     or a line indented no further than it;
+//   - an indented `vrf NAME`, as NX-OS and IOS XR nest them in `router bgp`, puts the
+//     lines under it in the VRF.
+//
+// An unindented line starts over, so the context of a line only depends on the block
+// it is in.
+type Contexts struct {
+	block, current Context
+	outerVRF       string // VRF of the lines around the address-family
+	vrfIndent      int    // indentation of the nested vrf line, -1 for none
+	afIndent       int    // indentation of the address-family line, -1 for none
+}
+
+// NewContexts returns a Contexts before the first line of a config.
+func NewContexts() *Contexts {
+	return &Contexts{vrfIndent: -1, afIndent: -1}
+}
+
+// Line advances to a line that is not a comment or blank line and returns its context.
+// The line that starts a VRF or address-family is in it.
+func (c *Contexts) Line(originalLine string) Context {
+	trimmed := strings.TrimSpace(originalLine)
+	indent := len(originalLine) - len(strings.TrimLeft(originalLine, " "))
+	if indent == 0 {
+		c.Reset()
+		if m := vrfBlockRe.FindStringSubmatch(trimmed); m != nil {
+			c.block.VRF = m[1]
+		}
+		c.current = c.block
+		return c.current
+	}
+	if c.afIndent >= 0 && indent <= c.afIndent {
+		c.exitAddressFamily()
+	}
+	if c.vrfIndent >= 0 && indent <= c.vrfIndent {
+		c.current.VRF, c.vrfIndent = c.block.VRF, -1
+	}
+	if m := addressFamilyRe.FindStringSubmatch(trimmed); m != nil {
+		c.outerVRF = c.current.VRF
+		family := m[1] + " " + m[2]
+		if m[2] == "" && m[1] != "l2vpn" {
+			family += "unicast" // what IOS takes a bare ipv4 or ipv6 for
+		}
+		c.current.AddressFamily, c.afIndent = strings.TrimSpace(family), indent
+		if m[3] != "" {
+			c.current.VRF = m[3]
+		}
+		return c.current
+	}
+	if m := nestedVRFRe.FindStringSubmatch(trimmed); m != nil && c.afIndent < 0 && c.block.VRF == "" {
+		c.current.VRF, c.vrfIndent = m[1], indent
+		return c.current
+	}
+	if trimmed == "exit-address-family" && c.afIndent >= 0 {
+		line := c.current
+		c.exitAddressFamily()
+		return line
+	}
+	return c.current
+}
+
+func (c *Contexts) exitAddressFamily() {
+	c.current.AddressFamily, c.current.VRF, c.afIndent = "", c.outerVRF, -1
+}
+
+// Reset returns to the global context, as at a line ending the block.
+func (c *Contexts) Reset() {
+	*c = Contexts{vrfIndent: -1, afIndent: -1}
+}
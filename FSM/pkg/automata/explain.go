@@ -0,0 +1,170 @@
+package automata
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Explanation describes how the FSM treats one line, for debugging rules.
+type Explanation struct {
+	Line     string `json:"line"`
+	LineNum  int    `json:"line_num"`
+	Previous string `json:"previous_state"` // state after the line before
+	State    string `json:"state"`          // state the line is validated in
+	// Context is the VRF and address-family the line is in, when it is in one.
+	Context string `json:"context,omitempty"`
+	// Entered is the state the line switches to, when it is a block trigger.
+	Entered string        `json:"entered,omitempty"`
+	Tried   []RuleAttempt `json:"tried,omitempty"`
+	Matched string        `json:"matched,omitempty"`
+	// Via is the state the matching rule is from, when the line's state falls back to it.
+	Via      string       `json:"via,omitempty"`
+	NearMiss *RuleAttempt `json:"near_miss,omitempty"`
+	// ValidIn lists other states with a rule matching the line.
+	ValidIn    []string `json:"valid_in,omitempty"`
+	Suggestion string   `json:"suggestion"`
+}
+
+// RuleAttempt is one rule of the state tried against the line. Distance is the edit
+// distance between the pattern's literal prefix and the start of the line.
+type RuleAttempt struct {
+	Pattern  string `json:"pattern"`
+	Prefix   string `json:"prefix"`
+	Matched  bool   `json:"matched"`
+	Distance int    `json:"distance"`
+}
+
+// Explain reports what ProcessLine would do with the line in the FSM's current state,
+// without changing that state. Feed the lines before it through ProcessLine first.
+func (fsm *FSM) Explain(originalLine string, lineNum int) Explanation {
+	trimmed := strings.TrimSpace(originalLine)
+	e := Explanation{Line: trimmed, LineNum: lineNum, Previous: fsm.CurrentState, State: fsm.CurrentState}
+
+	if mode, ok := fsm.lines.mode(trimmed); ok {
+		if ends(mode, originalLine) {
+			e.State = "GLOBAL"
+			e.Suggestion = fmt.Sprintf("blank and comment lines are always accepted; in mode %s this one returns to GLOBAL", mode)
+		} else {
+			e.Suggestion = fmt.Sprintf("blank and comment lines are always accepted; in mode %s this one is skipped and the state stays %s", mode, e.State)
+		}
+		return e
+	}
+	if e.State != "GLOBAL" && !strings.HasPrefix(originalLine, " ") {
+		e.State = "GLOBAL" // implicit exit from the block
+	}
+	contexts := *fsm.contexts
+	e.Context = contexts.Line(originalLine).String()
+	if entered := fsm.findStateTrigger(trimmed); entered != "" {
+		e.Entered = entered
+		e.Suggestion = fmt.Sprintf("the line starts a %s block and is always accepted", entered)
+		return e
+	}
+
+	prefixes := fsm.prefixes(e.State)
+	for i, re := range fsm.Rules[e.State] {
+		prefix := prefixes[i]
+		attempt := RuleAttempt{
+			Pattern:  re.String(),
+			Prefix:   prefix,
+			Matched:  re.MatchString(trimmed),
+			Distance: levenshtein(prefix, trimmed[:min(len(prefix), len(trimmed))]),
+		}
+		e.Tried = append(e.Tried, attempt)
+		if attempt.Matched && e.Matched == "" {
+			e.Matched = attempt.Pattern
+		}
+	}
+	matchedIn := e.State
+	for _, state := range fsm.fallbacks[e.State] {
+		if e.Matched != "" {
+			break
+		}
+		for _, re := range fsm.Rules[state] {
+			if re.MatchString(trimmed) {
+				e.Matched, e.Via, matchedIn = re.String(), state, state
+				break
+			}
+		}
+	}
+	if e.Matched != "" {
+		e.Suggestion = fmt.Sprintf("the line is valid: it matches '%s' in state %s", e.Matched, e.State)
+		if e.Via != "" {
+			e.Suggestion = fmt.Sprintf("the line is valid: it matches '%s' of state %s, which %s falls back to", e.Matched, e.Via, e.State)
+		}
+		for _, re := range fsm.Rules[matchedIn] {
+			if warning, ok := fsm.deprecated[re]; ok && re.String() == e.Matched {
+				e.Suggestion += ", but " + warning.Message
+			}
+		}
+		return e
+	}
+	if keyword, command := negation(trimmed); keyword != "" && (fsm.lines.Negations == NegationsAccept || fsm.lines.Negations == NegationsCheck) {
+		if re, ok := fsm.matchNegated(append([]string{e.State}, fsm.fallbacks[e.State]...), command); ok {
+			if re == nil {
+				e.Suggestion = fmt.Sprintf("the line is valid: it is the %s form of a command that starts a block", keyword)
+			} else {
+				e.Matched = re.String()
+				e.Suggestion = fmt.Sprintf("the line is valid: it is the %s form of '%s'", keyword, e.Matched)
+			}
+			return e
+		}
+	}
+
+	for state, rules := range fsm.Rules {
+		for _, re := range rules {
+			if state != e.State && re.MatchString(trimmed) {
+				e.ValidIn = append(e.ValidIn, state)
+				break
+			}
+		}
+	}
+	sort.Strings(e.ValidIn)
+
+	// The near miss has the smallest distance; among equals, the longest prefix says
+	// the most about the line.
+	for i, a := range e.Tried {
+		if a.Prefix == "" {
+			continue
+		}
+		best := e.NearMiss
+		if best == nil || a.Distance < best.Distance || (a.Distance == best.Distance && len(a.Prefix) > len(best.Prefix)) {
+			e.NearMiss = &e.Tried[i]
+		}
+	}
+
+	switch {
+	case len(fsm.Rules[e.State]) == 0:
+		e.Suggestion = fmt.Sprintf("state %s has no rules: add a %s section to the rules file", e.State, e.State)
+	case len(e.ValidIn) > 0:
+		e.Suggestion = fmt.Sprintf("the line is valid in %s: check its indentation and the block it is in", strings.Join(e.ValidIn, ", "))
+	case e.NearMiss != nil && e.NearMiss.Distance == 0:
+		e.Suggestion = fmt.Sprintf("the line starts like '%s' but the rest does not match: extend that pattern in state %s", e.NearMiss.Pattern, e.State)
+	case e.NearMiss != nil && e.NearMiss.Distance <= len(e.NearMiss.Prefix)/3:
+		e.Suggestion = fmt.Sprintf("the closest rule is '%s' (%d edits away): check the line for typos, or extend that pattern in state %s", e.NearMiss.Pattern, e.NearMiss.Distance, e.State)
+	default:
+		e.Suggestion = fmt.Sprintf("no rule in state %s comes close: add a rule for this command", e.State)
+	}
+	return e
+}
+
+// levenshtein returns the edit distance between two strings.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -2,7 +2,6 @@ package automata
 
 import (
 	"fmt"
-	"os"
 	"regexp"
 	"strings"
 
@@ -10,57 +9,344 @@ import (
 )
 
 // FSM is the Finite State Machine for validation.
-// It holds the compiled rules, current state, and any errors found.
+// It holds the compiled rules, current state, and any errors found. An FSM is one
+// run over one input and is not safe for concurrent use; the compiled rules it
+// shares with other runs of the same Machine are never modified.
 type FSM struct {
-	Rules        map[string][]*regexp.Regexp
+	Rules        map[string][]*regexp.Regexp // shared with the Machine; read-only
 	CurrentState string
 	Errors       []string
+	Findings     []Finding // the same errors in structured form
+	Encoding     string    // encoding the input was read in, when known (see pkg/linereader)
+	// Trace, when set, is called with the explanation of every line before it is
+	// processed, for verbose output. Explaining tries every rule, so it is slow.
+	Trace func(Explanation)
+
+	checks     map[*regexp.Regexp]Check   // semantic checks attached to rules
+	weights    map[*regexp.Regexp]int     // rule weights other than the default of 1
+	deprecated map[*regexp.Regexp]Finding // warnings for deprecated rules, their message and code
+	warned     map[*regexp.Regexp]bool    // deprecated rules already warned about
+	warnings   map[int]*regexp.Regexp     // those warnings by index in Findings, for Absorb
+	fallbacks  map[string][]string        // states whose rules a state falls back to, in order
+	lines      LineHandling
+	block      string              // line that started the block the FSM is in
+	contexts   *Contexts           // follows the VRF and address-family through the lines
+	context    Context             // that of the line being processed
+	configured map[string][]string // commands set so far by scope, for NegationsCheck
+	stats      stats
+	machine    *Machine // the machine this is a run of
+	// matchers index the rules of each state by literal prefix; see matcher.go. States
+	// without one (never the case after NewFSM) fall back to trying the rules in turn.
+	matchers map[string]*stateMatcher
 }
 
-// LoadRules loads a YAML file and returns it as a map of strings.
-func LoadRules(path string) (map[string][]string, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
+// Finding is a structured validation error, for outputs that need the line number
+// or state separately from the formatted message.
+type Finding struct {
+	Line     int    `json:"line"`
+	Command  string `json:"command"`
+	State    string `json:"state"`
+	Message  string `json:"message"`
+	Severity string `json:"severity,omitempty"` // SeverityError when empty
+	Weight   int    `json:"weight,omitempty"`   // weight of the rule that reported it, 1 when zero
+	Fix      string `json:"fix,omitempty"`      // config commands that resolve it, see pkg/remediation
+	Code     string `json:"code,omitempty"`     // stable message id, see pkg/i18n
+	Packet   int    `json:"packet,omitempty"`   // captured packet it is about, see pkg/flowreport
+	Owner    string `json:"owner,omitempty"`    // team or person it is routed to, see pkg/ownership
+	Context  string `json:"context,omitempty"`  // VRF and address-family of the line, see context.go
+}
+
+// Finding severities.
+const (
+	SeverityError    = "error"    // the config does not follow the rules
+	SeverityWarning  = "warning"  // analysis passes such as pkg/acl
+	SeveritySecurity = "security" // credential hygiene, see pkg/security
+)
+
+// Rule is one entry of a state in rules.yaml. It is either a plain regex string or a
+// mapping with a pattern and a script or wasm check to run on lines the pattern
+// matches, e.g. {pattern: "^vlan ([0-9]+)$", script: "semantic.star:vlan_range"}.
+// Weight scales how much the check's findings lower the config's score. Next is
+// only used by session state machines (see pkg/session): the state a matched event
+// moves to. Since, Deprecated, and ReplacedBy are version metadata (schema 2, see
+// profile.go): the pack version the rule was added in, the one it was deprecated in
+// (or "true"), and the pattern of the rule of the same state to use instead, which
+// deprecates the rule on its own. Configs that rely on a deprecated rule get a
+// warning. Fallback is set on the entries the loader adds for a state's fallback:
+// (see profile.go) instead of a pattern; they are tried after the state's own rules.
+type Rule struct {
+	Pattern    string `yaml:"pattern"`
+	Script     string `yaml:"script"`
+	Wasm       string `yaml:"wasm"`
+	Weight     int    `yaml:"weight"`
+	Next       string `yaml:"next"`
+	Since      string `yaml:"since"`
+	Deprecated string `yaml:"deprecated"`
+	ReplacedBy string `yaml:"replaced_by"`
+	Fallback   string `yaml:"-"`
+	Check      Check  `yaml:"-"` // set by the loader from Script or Wasm
+}
+
+// UnmarshalYAML accepts both the plain string and the mapping form of a rule.
+func (r *Rule) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&r.Pattern)
+	}
+	type plain Rule
+	if err := node.Decode((*plain)(r)); err != nil {
+		return err
+	}
+	if r.Script != "" && r.Wasm != "" {
+		return fmt.Errorf("line %d: rule '%s' has both a script and a wasm check", node.Line, r.Pattern)
+	}
+	if r.Weight < 0 {
+		return fmt.Errorf("line %d: rule '%s' has a negative weight", node.Line, r.Pattern)
+	}
+	if r.Deprecated == "false" {
+		r.Deprecated = ""
+	}
+	if r.ReplacedBy != "" && r.Deprecated == "" {
+		r.Deprecated = "true"
 	}
-	var rawRules map[string][]string
-	err = yaml.Unmarshal(data, &rawRules)
-	return rawRules, err
+	return nil
 }
 
-// NewFSM creates a new FSM instance.
-// It takes raw string rules, compiles them into regular expressions for performance,
-// and initializes the FSM in the "GLOBAL" state.
-func NewFSM(rawRules map[string][]string) (*FSM, error) {
+// DeprecationMessage is the warning for a line that relies on a deprecated rule and
+// its code (see pkg/i18n), or "" when the rule is not deprecated.
+func (r Rule) DeprecationMessage(state string) (msg, code string) {
+	if r.Deprecated == "" {
+		return "", ""
+	}
+	msg, code = fmt.Sprintf("rule '%s' of state %s is deprecated", r.Pattern, state), "rules.deprecated"
+	if r.Deprecated != "true" {
+		msg, code = msg+" since "+r.Deprecated, code+"-since"
+	}
+	if r.ReplacedBy != "" {
+		msg, code = msg+fmt.Sprintf("; use '%s' instead", r.ReplacedBy), code+"-replaced"
+	}
+	return msg, code
+}
+
+// Check is a semantic check attached to a rule. It runs on every line the rule's
+// pattern matches and returns a message for each problem found.
+type Check func(CheckContext) ([]string, error)
+
+// CheckContext is what a Check gets to see of the matched line.
+type CheckContext struct {
+	Line    string // the trimmed line
+	LineNum int
+	State   string
+	// Groups are the regex submatches, Groups[0] being the whole line.
+	Groups []string
+	// Context is the VRF and address-family the line is in.
+	Context Context
+}
+
+// LoadRules loads a YAML file and returns the rules of each state, including those
+// inherited through `extends:` (see profile.go).
+func LoadRules(path string) (map[string][]Rule, error) {
+	return loadProfile(path, nil, nil, nil)
+}
+
+// LoadRulesSources is LoadRules that also returns every rules file read, in load order,
+// for callers that watch them for changes.
+func LoadRulesSources(path string) (map[string][]Rule, []string, error) {
+	var sources []string
+	rules, err := loadProfile(path, nil, &sources, nil)
+	return rules, sources, err
+}
+
+// RuleFile is a loaded rules file: the rules of each state, how comment and blank
+// lines are treated, and every rules file read, in load order.
+type RuleFile struct {
+	Rules   map[string][]Rule
+	Lines   LineHandling
+	Sources []string
+}
+
+// LoadRuleFile is LoadRulesSources with the rest of the settings of the file. Its
+// Machine is Compile(Rules).WithLines(Lines).
+func LoadRuleFile(path string) (*RuleFile, error) {
+	rf := &RuleFile{}
+	var err error
+	rf.Rules, err = loadProfile(path, nil, &rf.Sources, &rf.Lines)
+	return rf, err
+}
+
+// Machine is the compiled, immutable part of an FSM: the rules of each state as
+// regular expressions, their checks and weights, and the per-state rule index. It
+// is compiled once and shared by any number of runs, concurrent ones included; each
+// run is an FSM holding only its own state, findings, and stats. Checks are called
+// from every run, so a Machine used concurrently needs checks that are safe for
+// concurrent use (see WithChecks).
+type Machine struct {
+	rules      map[string][]*regexp.Regexp
+	checks     map[*regexp.Regexp]Check
+	weights    map[*regexp.Regexp]int
+	deprecated map[*regexp.Regexp]Finding
+	fallbacks  map[string][]string
+	lines      LineHandling
+	matchers   map[string]*stateMatcher
+}
+
+// Compile compiles raw rules into a Machine.
+func Compile(rawRules map[string][]Rule) (*Machine, error) {
 	compiledRules := make(map[string][]*regexp.Regexp)
-	for state, patterns := range rawRules {
-		for _, pattern := range patterns {
-			re, err := regexp.Compile(pattern)
+	checks := make(map[*regexp.Regexp]Check)
+	weights := make(map[*regexp.Regexp]int)
+	deprecated := make(map[*regexp.Regexp]Finding)
+	direct := make(map[string][]string)
+	for state, rules := range rawRules {
+		for _, rule := range rules {
+			if rule.Fallback != "" {
+				if _, ok := rawRules[rule.Fallback]; !ok {
+					return nil, fmt.Errorf("state '%s' falls back to state '%s', which is not defined", state, rule.Fallback)
+				}
+				direct[state] = append(direct[state], rule.Fallback)
+				if compiledRules[state] == nil {
+					compiledRules[state] = []*regexp.Regexp{} // a state with only fallbacks still exists
+				}
+				continue
+			}
+			re, err := regexp.Compile(rule.Pattern)
 			if err != nil {
-				return nil, fmt.Errorf("failed to compile regex '%s' for state '%s': %v", pattern, state, err)
+				return nil, fmt.Errorf("failed to compile regex '%s' for state '%s': %v", rule.Pattern, state, err)
 			}
 			compiledRules[state] = append(compiledRules[state], re)
+			if rule.Check != nil {
+				checks[re] = rule.Check
+			}
+			if rule.Weight > 0 {
+				weights[re] = rule.Weight
+			}
+			if msg, code := rule.DeprecationMessage(state); msg != "" {
+				deprecated[re] = Finding{Message: msg, Code: code, Severity: SeverityWarning}
+			}
+		}
+	}
+
+	matchers := make(map[string]*stateMatcher, len(compiledRules))
+	for state, rules := range compiledRules {
+		matchers[state] = newStateMatcher(rules)
+	}
+	return &Machine{rules: compiledRules, checks: checks, weights: weights, deprecated: deprecated, fallbacks: fallbackChains(direct), matchers: matchers}, nil
+}
+
+// fallbackChains follows the fallbacks of each state through the states it falls
+// back to, so INTERFACE -> COMMON -> BASE tries COMMON, then BASE. A state is tried
+// once, which also ends cycles.
+func fallbackChains(direct map[string][]string) map[string][]string {
+	chains := make(map[string][]string, len(direct))
+	for state := range direct {
+		seen := map[string]bool{state: true}
+		queue := append([]string(nil), direct[state]...)
+		for len(queue) > 0 {
+			next := queue[0]
+			queue = queue[1:]
+			if seen[next] {
+				continue
+			}
+			seen[next] = true
+			chains[state] = append(chains[state], next)
+			queue = append(queue, direct[next]...)
+		}
+	}
+	return chains
+}
+
+// WithChecks returns a Machine sharing m's compiled rules, with the checks of
+// rawRules instead of m's. rawRules must be the rules m was compiled from, with
+// checks attached; no pattern is compiled again. Script and wasm checks keep state
+// per loader, so callers that validate concurrently attach a loader's checks per
+// run this way rather than sharing them.
+func (m *Machine) WithChecks(rawRules map[string][]Rule) (*Machine, error) {
+	checks := make(map[*regexp.Regexp]Check)
+	for state, rules := range rawRules {
+		compiled := m.rules[state]
+		rules = patternRules(rules)
+		if len(compiled) != len(rules) {
+			return nil, fmt.Errorf("state '%s' has %d rules, the machine was compiled with %d", state, len(rules), len(compiled))
+		}
+		for i, rule := range rules {
+			if compiled[i].String() != rule.Pattern {
+				return nil, fmt.Errorf("rule %d of state '%s' is '%s', the machine was compiled with '%s'", i+1, state, rule.Pattern, compiled[i])
+			}
+			if rule.Check != nil {
+				checks[compiled[i]] = rule.Check
+			}
 		}
 	}
+	out := *m
+	out.checks = checks
+	return &out, nil
+}
 
+// patternRules returns the rules of a state without its fallback entries.
+func patternRules(rules []Rule) []Rule {
+	out := make([]Rule, 0, len(rules))
+	for _, r := range rules {
+		if r.Fallback == "" {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// NewRun starts a run of the machine: an FSM in the "GLOBAL" state with no findings.
+func (m *Machine) NewRun() *FSM {
 	return &FSM{
-		Rules:        compiledRules,
+		machine:      m,
+		Rules:        m.rules,
 		CurrentState: "GLOBAL",
 		Errors:       []string{},
-	}, nil
+		checks:       m.checks,
+		weights:      m.weights,
+		deprecated:   m.deprecated,
+		warned:       map[*regexp.Regexp]bool{},
+		fallbacks:    m.fallbacks,
+		lines:        m.lines,
+		contexts:     NewContexts(),
+		matchers:     m.matchers,
+	}
+}
+
+// NewFSM creates a new FSM instance.
+// It takes raw string rules, compiles them into regular expressions for performance,
+// and initializes the FSM in the "GLOBAL" state. Callers validating more than one
+// input compile the rules once with Compile and start each run with NewRun instead.
+func NewFSM(rawRules map[string][]Rule) (*FSM, error) {
+	m, err := Compile(rawRules)
+	if err != nil {
+		return nil, err
+	}
+	return m.NewRun(), nil
 }
 
 // ProcessLine is the core logic engine of the validator. It processes a single line of the configuration.
 func (fsm *FSM) ProcessLine(originalLine string, lineNum int) {
+	fsm.ProcessTemplateLine(originalLine, lineNum, nil)
+}
+
+// ProcessTemplateLine processes a line that still has template placeholders. It is
+// valid when the line itself or any of its renderings (see pkg/template) is.
+func (fsm *FSM) ProcessTemplateLine(originalLine string, lineNum int, renderings []string) {
+	if fsm.Trace != nil {
+		fsm.Trace(fsm.Explain(originalLine, lineNum))
+	}
 	// Trim the line for matching, but keep the original to check for indentation.
 	trimmedLine := strings.TrimSpace(originalLine)
 
 	// --- 1. Handle Comments and Blank Lines ---
-	// They are ignored but also reset the state to GLOBAL, which is safe behavior.
-	if trimmedLine == "" || strings.HasPrefix(trimmedLine, "!") {
-		fsm.CurrentState = "GLOBAL"
+	// They are never validated. By default they also reset the state to GLOBAL, which
+	// is safe behavior; the rules file can have them skipped instead (see LineHandling).
+	if mode, ok := fsm.lines.mode(trimmedLine); ok {
+		if ends(mode, originalLine) {
+			fsm.CurrentState = "GLOBAL"
+			fsm.contexts.Reset()
+		}
 		return
 	}
+	fsm.context = fsm.contexts.Line(originalLine)
 
 	// --- 2. Implement IMPLICIT EXIT Logic ---
 	// This is the most critical fix. If we are in any sub-state (not GLOBAL) and the
@@ -71,52 +357,140 @@ func (fsm *FSM) ProcessLine(originalLine string, lineNum int) {
 
 	// --- 3. Implement ENTRY Logic ---
 	// Check if the current line is a command that triggers a new state.
-	if newState := fsm.findStateTrigger(trimmedLine); newState != "" {
-		fsm.CurrentState = newState
-		return // The trigger command itself is valid, so we move to the next line.
+	candidates := append([]string{trimmedLine}, renderings...)
+	for _, candidate := range candidates {
+		if newState := fsm.findStateTrigger(candidate); newState != "" {
+			fsm.configure(fsm.scope(), trimmedLine)
+			fsm.CurrentState, fsm.block = newState, trimmedLine
+			fsm.stats.count(newState, true, nil)
+			return // The trigger command itself is valid, so we move to the next line.
+		}
 	}
 
 	// --- 4. Validate the Line Against Rules for the Current State ---
-	rulesForState, ok := fsm.Rules[fsm.CurrentState]
-	if !ok {
+	// A state's own rules come first, then those of the states it falls back to.
+	if _, ok := fsm.Rules[fsm.CurrentState]; !ok {
+		fsm.stats.count(fsm.CurrentState, false, nil)
 		fsm.addError(lineNum, trimmedLine, fsm.CurrentState)
 		return
 	}
 
-	isMatch := false
-	for _, rule := range rulesForState {
-		if rule.MatchString(trimmedLine) {
-			isMatch = true
+	var matched *regexp.Regexp
+	var matchedLine string
+	for _, state := range append([]string{fsm.CurrentState}, fsm.fallbacks[fsm.CurrentState]...) {
+		for _, candidate := range candidates {
+			if matched = fsm.matchRule(state, fsm.Rules[state], candidate); matched != nil {
+				matchedLine = candidate
+				break
+			}
+		}
+		if matched != nil {
 			break
 		}
 	}
 
-	if !isMatch {
+	// --- 4b. The No and Default Forms of Accepted Commands ---
+	// A negated command sets no values, so the rule's check does not run on it.
+	negated := false
+	keyword, command := negation(trimmedLine)
+	if keyword != "" && (fsm.lines.Negations == NegationsAccept || fsm.lines.Negations == NegationsCheck) {
+		if matched == nil {
+			var ok bool
+			if matched, ok = fsm.matchNegated(append([]string{fsm.CurrentState}, fsm.fallbacks[fsm.CurrentState]...), command); !ok {
+				fsm.stats.count(fsm.CurrentState, false, nil)
+				fsm.addError(lineNum, trimmedLine, fsm.CurrentState)
+				return
+			}
+			negated = true
+		}
+		if fsm.lines.Negations == NegationsCheck && !fsm.unconfigure(fsm.scope(), command) && keyword == "no" {
+			fsm.report(Finding{Line: lineNum, Command: trimmedLine, State: fsm.CurrentState, Severity: SeverityWarning,
+				Message: fmt.Sprintf("'%s' negates '%s', which is not configured before it", trimmedLine, command), Code: "fsm.negates-unconfigured"})
+		}
+		if matched == nil {
+			fsm.stats.count(fsm.CurrentState, false, nil) // the no form of a block
+			return
+		}
+	} else if matched != nil {
+		fsm.configure(fsm.scope(), trimmedLine)
+	}
+
+	fsm.stats.count(fsm.CurrentState, false, matched)
+	if matched == nil {
 		fsm.addError(lineNum, trimmedLine, fsm.CurrentState)
+		return
+	}
+
+	// Configs relying on a deprecated rule are warned once per rule, at its first line.
+	if warning, ok := fsm.deprecated[matched]; ok && !fsm.warned[matched] {
+		fsm.warn(matched)
+		warning.Line, warning.Command, warning.State = lineNum, trimmedLine, fsm.CurrentState
+		fsm.report(warning)
+	}
+
+	// --- 5. Run the Semantic Check, if the Rule Has One ---
+	if check, ok := fsm.checks[matched]; ok && !negated {
+		messages, err := check(CheckContext{
+			Line:    matchedLine,
+			LineNum: lineNum,
+			State:   fsm.CurrentState,
+			Groups:  matched.FindStringSubmatch(matchedLine),
+			Context: fsm.context,
+		})
+		for _, msg := range messages {
+			fsm.report(Finding{Line: lineNum, Command: trimmedLine, State: fsm.CurrentState, Message: msg,
+				Severity: SeverityError, Weight: fsm.weights[matched]})
+		}
+		if err != nil {
+			fsm.report(Finding{Line: lineNum, Command: trimmedLine, State: fsm.CurrentState, Code: "fsm.check-failed",
+				Message: fmt.Sprintf("check failed on '%s': %v", trimmedLine, err), Severity: SeverityError, Weight: fsm.weights[matched]})
+		}
 	}
 }
 
-// findStateTrigger checks if a line matches a known pattern that starts a new configuration block.
-func (fsm *FSM) findStateTrigger(line string) string {
-	// These regex patterns define the commands that change the validator's state.
+// matchRule returns the first rule of the state that matches line, or nil.
+func (fsm *FSM) matchRule(state string, rules []*regexp.Regexp, line string) *regexp.Regexp {
+	if m, ok := fsm.matchers[state]; ok {
+		return m.match(line)
+	}
+	for _, rule := range rules {
+		if rule.MatchString(line) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// stateTriggers are the commands that change the validator's state. They are compiled
+// once rather than on every line.
+var stateTriggers = func() map[*regexp.Regexp]string {
 	triggers := map[string]string{
-		`^interface\s+.*`:               "INTERFACE",
-		`^aaa\s+group\s+server\s+.*`:     "AAA_GROUP",
-		`^aaa\s+cache\s+profile\s+.*`:    "AAA_CACHE_PROFILE",
-		`^dot11\s+ssid\s+.*`:             "DOT11_SSID",
-		`^archive$`:                       "ARCHIVE_CONFIG",
-		`^crypto\s+pki\s+.*`:             "CRYPTO_PKI",
-		`^tacacs\s+server\s+.*`:          "SERVER_CONFIG",
-		`^radius\s+server\s+.*`:          "SERVER_CONFIG",
+		`^interface\s+.*`:                   "INTERFACE",
+		`^aaa\s+group\s+server\s+.*`:        "AAA_GROUP",
+		`^aaa\s+cache\s+profile\s+.*`:       "AAA_CACHE_PROFILE",
+		`^dot11\s+ssid\s+.*`:                "DOT11_SSID",
+		`^archive$`:                         "ARCHIVE_CONFIG",
+		`^crypto\s+pki\s+.*`:                "CRYPTO_PKI",
+		`^tacacs\s+server\s+.*`:             "SERVER_CONFIG",
+		`^radius\s+server\s+.*`:             "SERVER_CONFIG",
 		`^ip\s+access-list\s+standard\s+.*`: "IP_ACL_STANDARD",
-		`^line\s+.*`:                      "LINE",
-		`^router\s+.*`:                    "ROUTER", // Added for completeness
-		`^vlan\s+[0-9]+`:                  "VLAN",   // Added for completeness
+		`^line\s+.*`:                        "LINE",
+		`^router\s+.*`:                      "ROUTER", // Added for completeness
+		`^vlan\s+[0-9]+`:                    "VLAN",   // Added for completeness
+		`^vrf\s+definition\s+\S+$`:          "VRF",
+		`^ip\s+vrf\s+\S+$`:                  "VRF",
 	}
-
+	compiled := make(map[*regexp.Regexp]string, len(triggers))
 	for pattern, state := range triggers {
-		// We can ignore the error here because we know the patterns are valid.
-		if matched, _ := regexp.MatchString(pattern, line); matched {
+		compiled[regexp.MustCompile(pattern)] = state
+	}
+	return compiled
+}()
+
+// findStateTrigger checks if a line matches a known pattern that starts a new configuration block.
+func (fsm *FSM) findStateTrigger(line string) string {
+	for pattern, state := range stateTriggers {
+		if pattern.MatchString(line) {
 			return state
 		}
 	}
@@ -125,6 +499,45 @@ func (fsm *FSM) findStateTrigger(line string) string {
 
 // addError formats and records a validation error.
 func (fsm *FSM) addError(lineNum int, line, state string) {
-	fsm.Errors = append(fsm.Errors,
-		fmt.Sprintf("Line %d: invalid command '%s' in state %s", lineNum, line, state))
-}
\ No newline at end of file
+	fsm.report(Finding{Line: lineNum, Command: line, State: state, Message: fmt.Sprintf("invalid command '%s' in state %s", line, state),
+		Severity: SeverityError, Code: "fsm.invalid-command"})
+}
+
+// report records a finding about the line being processed, in its context.
+func (fsm *FSM) report(f Finding) {
+	f.Context = fsm.context.String()
+	fsm.AddFinding(f)
+}
+
+// AddFinding records a finding from an analysis pass outside the FSM rules.
+func (fsm *FSM) AddFinding(f Finding) {
+	fsm.Errors = append(fsm.Errors, FormatFinding(f))
+	fsm.Findings = append(fsm.Findings, f)
+}
+
+// RedactLine replaces the text of a line in the findings reported for it, for lines
+// that hold secrets.
+func (fsm *FSM) RedactLine(lineNum int, excerpt string) {
+	for i, f := range fsm.Findings {
+		if f.Line != lineNum {
+			continue
+		}
+		f.Message = strings.ReplaceAll(f.Message, f.Command, excerpt)
+		f.Command = excerpt
+		fsm.Findings[i] = f
+		fsm.Errors[i] = FormatFinding(f)
+	}
+}
+
+// FormatFinding renders a finding as an Errors entry; severities other than error are
+// shown so that, say, security findings stand out in plain-text reports.
+func FormatFinding(f Finding) string {
+	msg := f.Message
+	if f.Severity != "" && f.Severity != SeverityError {
+		msg = fmt.Sprintf("[%s] %s", f.Severity, msg)
+	}
+	if f.Line == 0 {
+		return msg // about the config as a whole
+	}
+	return fmt.Sprintf("Line %d: %s", f.Line, msg)
+}
@@ -0,0 +1,194 @@
+package automata
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// benchConfig is a config of roughly size bytes built from blocks the base rules
+// accept, plus one invalid line per block.
+func benchConfig(size int) string {
+	var b strings.Builder
+	b.WriteString("version 15.2\nhostname bench\nservice password-encryption\n")
+	for i := 0; b.Len() < size; i++ {
+		fmt.Fprintf(&b, "interface GigabitEthernet0/%d\n", i)
+		fmt.Fprintf(&b, " ip address 10.%d.%d.1 255.255.255.0\n", i/256%256, i%256)
+		b.WriteString(" duplex full\n speed 1000\n no shutdown\n frobnicate\n")
+		fmt.Fprintf(&b, "snmp-server location rack-%d\n", i)
+		b.WriteString("line vty 0 4\n login local\n transport input ssh\n")
+	}
+	return b.String()
+}
+
+// manyRules adds n generated rules to every state, as found in large rule packs,
+// ahead of the rules the config actually uses.
+func manyRules(t testing.TB, n int) map[string][]Rule {
+	rules, err := LoadRules("rules.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for state, list := range rules {
+		var extra []Rule
+		for i := 0; i < n; i++ {
+			extra = append(extra, Rule{Pattern: fmt.Sprintf("^%s-generated-%d( [0-9]+)?$", strings.ToLower(state), i)})
+		}
+		rules[state] = append(extra, list...)
+	}
+	return rules
+}
+
+func benchmarkProcess(b *testing.B, rules map[string][]Rule, config string, indexed bool) {
+	b.SetBytes(int64(len(config)))
+	b.ReportAllocs()
+	for b.Loop() {
+		fsm, err := NewFSM(rules)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if !indexed {
+			fsm.matchers = nil
+		}
+		scanner := bufio.NewScanner(strings.NewReader(config))
+		for n := 1; scanner.Scan(); n++ {
+			fsm.ProcessLine(scanner.Text(), n)
+		}
+	}
+}
+
+// BenchmarkProcessLine compares the per-state rule index with trying the rules one
+// at a time, for the base rules and for large rule packs.
+func BenchmarkProcessLine(b *testing.B) {
+	config := benchConfig(1 << 20)
+	for _, n := range []int{0, 50, 500} {
+		rules := manyRules(b, n)
+		for _, indexed := range []bool{true, false} {
+			name := fmt.Sprintf("extra=%d/per-rule", n)
+			if indexed {
+				name = fmt.Sprintf("extra=%d/indexed", n)
+			}
+			b.Run(name, func(b *testing.B) { benchmarkProcess(b, rules, config, indexed) })
+		}
+	}
+}
+
+// BenchmarkNewRun validates small configs, as a server does per request, compiling
+// the rules for each one or starting runs of one Machine from concurrent goroutines.
+func BenchmarkNewRun(b *testing.B) {
+	rules := manyRules(b, 50)
+	config := benchConfig(2 << 10)
+	validate := func(fsm *FSM) {
+		scanner := bufio.NewScanner(strings.NewReader(config))
+		for n := 1; scanner.Scan(); n++ {
+			fsm.ProcessLine(scanner.Text(), n)
+		}
+	}
+	b.Run("compile-each", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				fsm, err := NewFSM(rules)
+				if err != nil {
+					b.Error(err)
+					return
+				}
+				validate(fsm)
+			}
+		})
+	})
+	b.Run("shared-machine", func(b *testing.B) {
+		m, err := Compile(rules)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				validate(m.NewRun())
+			}
+		})
+	})
+}
+
+// TestExplainNearMiss checks that a typo is matched against the literal prefix of a
+// rule with a capture group, not only of rules that are entirely literal.
+func TestExplainNearMiss(t *testing.T) {
+	rules, err := LoadRules("rules.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, indexed := range []bool{true, false} {
+		fsm, err := NewFSM(rules)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !indexed {
+			fsm.matchers = nil
+		}
+		fsm.ProcessLine("interface GigabitEthernet0/1", 1)
+		e := fsm.Explain(" encapsulaton dot1Q 10", 2)
+		if e.Matched != "" {
+			t.Fatalf("indexed=%v: line matched %s", indexed, e.Matched)
+		}
+		if e.NearMiss == nil || e.NearMiss.Pattern != `^encapsulation dot1Q ([0-9]+).*$` {
+			t.Fatalf("indexed=%v: near miss = %+v, suggestion %q", indexed, e.NearMiss, e.Suggestion)
+		}
+	}
+}
+
+// TestMatcherEquivalence checks that the rule index picks the same rule as trying
+// every rule in order, for the built-in rules and roles, on the lines of the sample
+// configs and on lines built from each rule's prefix.
+func TestMatcherEquivalence(t *testing.T) {
+	var lines []string
+	for _, file := range []string{"../../test/sample_config.txt", "../../test/AP1141N-E-K9.conf"} {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, strings.Split(string(data), "\n")...)
+	}
+	lines = append(lines, strings.Split(benchConfig(4<<10), "\n")...)
+
+	for _, file := range []string{"rules.yaml", "roles/access.yaml", "roles/core.yaml", "roles/edge.yaml"} {
+		rules, err := LoadRules(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fsm, err := NewFSM(rules)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for state, compiled := range fsm.Rules {
+			m := fsm.matchers[state]
+			if m == nil {
+				t.Fatalf("%s: state %s has no index", file, state)
+			}
+			candidates := []string{""}
+			for _, line := range lines {
+				candidates = append(candidates, strings.TrimSpace(line))
+			}
+			for _, prefix := range m.prefixes {
+				candidates = append(candidates, prefix, prefix+"1", prefix+"x y", strings.TrimSuffix(prefix, " "))
+				if len(prefix) > 1 {
+					candidates = append(candidates, prefix[:len(prefix)-1], prefix[1:])
+				}
+			}
+			for _, line := range candidates {
+				var want *regexp.Regexp
+				for _, re := range compiled {
+					if re.MatchString(line) {
+						want = re
+						break
+					}
+				}
+				if got := m.match(line); got != want {
+					t.Errorf("%s: state %s, line %q: index matched %v, trying every rule matched %v", file, state, line, got, want)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package automata
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// stateMatcher finds the first rule of a state that matches a line without trying
+// every rule. Most rules are anchored keywords ("^hostname ...", "^ip address ..."),
+// so each rule's literal prefix is taken from its pattern and the rules are indexed by
+// the first byte of that prefix. A line is then only tried against the rules whose
+// prefix it starts with, plus the rules without a prefix, in rule order; the result
+// is the same rule as trying all of them one by one.
+type stateMatcher struct {
+	rules    []*regexp.Regexp
+	prefixes []string   // literal prefix of each rule, "" when it has none
+	byByte   [256][]int // rules that can match a line starting with the byte, in order
+	empty    []int      // rules that can match an empty line
+}
+
+func newStateMatcher(rules []*regexp.Regexp) *stateMatcher {
+	m := &stateMatcher{rules: rules, prefixes: make([]string, len(rules))}
+	for i, re := range rules {
+		m.prefixes[i] = rulePrefix(re)
+		prefix := m.prefixes[i]
+		if prefix == "" {
+			m.empty = append(m.empty, i)
+			for b := range m.byByte {
+				m.byByte[b] = append(m.byByte[b], i)
+			}
+			continue
+		}
+		m.byByte[prefix[0]] = append(m.byByte[prefix[0]], i)
+	}
+	return m
+}
+
+// match returns the first rule, in rule order, that matches line.
+func (m *stateMatcher) match(line string) *regexp.Regexp {
+	candidates := m.empty
+	if line != "" {
+		candidates = m.byByte[line[0]]
+	}
+	for _, i := range candidates {
+		if strings.HasPrefix(line, m.prefixes[i]) && m.rules[i].MatchString(line) {
+			return m.rules[i]
+		}
+	}
+	return nil
+}
+
+// rulePrefix returns the literal text every line a rule matches starts with, or "".
+func rulePrefix(re *regexp.Regexp) string {
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return ""
+	}
+	return anchoredPrefix(parsed)
+}
+
+// prefixes returns the rulePrefix of every rule of a state, in rule order.
+func (fsm *FSM) prefixes(state string) []string {
+	if m, ok := fsm.matchers[state]; ok && len(m.prefixes) == len(fsm.Rules[state]) {
+		return m.prefixes
+	}
+	prefixes := make([]string, len(fsm.Rules[state]))
+	for i, re := range fsm.Rules[state] {
+		prefixes[i] = rulePrefix(re)
+	}
+	return prefixes
+}
+
+// anchoredPrefix returns the literal text every match of re starts with when re is
+// anchored at the start of the line, such as "ip address " for `^ip address (\S+)`,
+// and "" otherwise.
+func anchoredPrefix(re *syntax.Regexp) string {
+	re = re.Simplify()
+	if re.Op != syntax.OpConcat || len(re.Sub) < 2 || re.Sub[0].Op != syntax.OpBeginText {
+		return ""
+	}
+	var prefix strings.Builder
+	for _, sub := range re.Sub[1:] {
+		if sub.Op != syntax.OpLiteral || sub.Flags&syntax.FoldCase != 0 {
+			break
+		}
+		prefix.WriteString(string(sub.Rune))
+	}
+	return prefix.String()
+}
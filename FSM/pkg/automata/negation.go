@@ -0,0 +1,123 @@
+package automata
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// How the FSM treats the no and default forms of commands, as a rules file sets it
+// with `negations:`.
+const (
+	NegationsOff    = "off"    // only rules that spell them out accept them; the default
+	NegationsAccept = "accept" // the forms of every command the rules accept are valid
+	NegationsCheck  = "check"  // accept, and warn about no forms of commands not set before
+)
+
+func checkNegations(mode string) error {
+	switch mode {
+	case "", NegationsOff, NegationsAccept, NegationsCheck:
+		return nil
+	}
+	return fmt.Errorf("unknown mode %q (off, accept, or check)", mode)
+}
+
+// negation splits the no or default form of a command into its keyword and the
+// command it negates, or returns "" for other lines.
+func negation(line string) (keyword, command string) {
+	for _, keyword := range []string{"no", "default"} {
+		if rest, ok := strings.CutPrefix(line, keyword+" "); ok && strings.TrimSpace(rest) != "" {
+			return keyword, strings.TrimSpace(rest)
+		}
+	}
+	return "", ""
+}
+
+// matchNegated reports whether the rules of the states accept the command a no or
+// default form negates, returning the rule that does, or nil for a command that
+// starts a block. IOS takes the no form without the arguments of the command, so
+// "no ip domain name" negates `^ip domain name \S+$`: a command starting with every
+// keyword of a rule's literal prefix is accepted as well.
+func (fsm *FSM) matchNegated(states []string, command string) (*regexp.Regexp, bool) {
+	if fsm.findStateTrigger(command) != "" {
+		return nil, true
+	}
+	for _, state := range states {
+		if re := fsm.matchRule(state, fsm.Rules[state], command); re != nil {
+			return re, true
+		}
+	}
+	for _, state := range states {
+		for _, re := range fsm.Rules[state] {
+			if negatesRule(re, command) {
+				return re, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// negatesRule reports whether a command starts with the keywords of a rule's literal
+// prefix; the last one may be cut short by the pattern, as in `^ip domain-(name|list)`.
+func negatesRule(re *regexp.Regexp, command string) bool {
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return false
+	}
+	prefix := anchoredPrefix(parsed)
+	keywords := strings.Fields(prefix)
+	if len(keywords) == 0 {
+		return false
+	}
+	words := strings.Fields(command)
+	if len(words) < len(keywords) {
+		return false
+	}
+	last := len(keywords) - 1
+	for i := 0; i < last; i++ {
+		if words[i] != keywords[i] {
+			return false
+		}
+	}
+	if strings.HasSuffix(prefix, " ") {
+		return words[last] == keywords[last]
+	}
+	return strings.HasPrefix(words[last], keywords[last])
+}
+
+// scope is where a command is set: the block the FSM is in, or "" in GLOBAL.
+func (fsm *FSM) scope() string {
+	if fsm.CurrentState == "GLOBAL" {
+		return ""
+	}
+	return fsm.block
+}
+
+// configure records a command the config sets, for NegationsCheck.
+func (fsm *FSM) configure(scope, command string) {
+	if fsm.lines.Negations != NegationsCheck {
+		return
+	}
+	if fsm.configured == nil {
+		fsm.configured = map[string][]string{}
+	}
+	fsm.configured[scope] = append(fsm.configured[scope], command)
+}
+
+// unconfigure removes the commands a no or default form negates from those set in
+// the scope, and reports whether there were any: the command itself, or, as no forms
+// drop arguments, commands it is the start of.
+func (fsm *FSM) unconfigure(scope, command string) bool {
+	found := false
+	kept := fsm.configured[scope][:0]
+	for _, c := range fsm.configured[scope] {
+		if c == command || strings.HasPrefix(c, command+" ") {
+			found = true
+			continue
+		}
+		kept = append(kept, c)
+	}
+	fsm.configured[scope] = kept
+	return found
+}
@@ -0,0 +1,262 @@
+package automata
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A rules file may build on other rules files. Besides the state lists it can have
+//
+//	schema:   the version of this format the file is written for, 1 when absent
+//	extends:  base file(s), relative to this file, merged in order
+//	override: states whose rules replace the inherited ones entirely
+//	remove:   patterns to drop from inherited states
+//	fallback: for a state, the states whose rules its lines may also match, in order
+//	comments, blank_lines: reset, ignore, or separator (see LineHandling)
+//	continuation: the marker ending a line that goes on on the next, such as \
+//	wrap_width: the width at which an export wrapped long lines
+//	negations: off, accept, or check, for no and default forms (see negation.go)
+//
+// Rules listed under a state are added to the inherited rules of that state; a rule
+// whose pattern is already inherited replaces it, so an overlay can attach a check
+// to a base rule.
+//
+// A line is validated against the rules of the state it is in, and nothing else,
+// unless the state falls back to others. IOS accepts many commands in several modes,
+// so fallback lets those live in one shared state, say COMMON, that INTERFACE and
+// LINE fall back to, without making every GLOBAL command valid in them. Fallbacks
+// are followed on through the states fallen back to. A file's fallbacks for a state
+// replace the inherited ones; an empty list removes them.
+type profile struct {
+	Schema   int
+	Extends  []string
+	Override map[string][]Rule
+	Remove   map[string][]string
+	Fallback map[string][]string
+	Lines    LineHandling
+	States   map[string][]Rule
+}
+
+// UnmarshalYAML separates the lowercase profile keys from the state lists.
+func (p *profile) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: rules file must be a mapping of states to rules", node.Line)
+	}
+	p.States = map[string][]Rule{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i].Value, node.Content[i+1]
+		var err error
+		switch key {
+		case "schema":
+			err = value.Decode(&p.Schema)
+		case "extends":
+			if value.Kind == yaml.ScalarNode {
+				p.Extends = []string{value.Value}
+			} else {
+				err = value.Decode(&p.Extends)
+			}
+		case "override":
+			err = value.Decode(&p.Override)
+		case "remove":
+			err = value.Decode(&p.Remove)
+		case "fallback":
+			err = value.Decode(&p.Fallback)
+		case "comments":
+			if err = value.Decode(&p.Lines.Comments); err == nil {
+				err = checkLineMode(p.Lines.Comments)
+			}
+		case "blank_lines":
+			if err = value.Decode(&p.Lines.BlankLines); err == nil {
+				err = checkLineMode(p.Lines.BlankLines)
+			}
+		case "negations":
+			if err = value.Decode(&p.Lines.Negations); err == nil {
+				err = checkNegations(p.Lines.Negations)
+			}
+		case "continuation":
+			err = value.Decode(&p.Lines.Continuation)
+		case "wrap_width":
+			if err = value.Decode(&p.Lines.WrapWidth); err == nil && p.Lines.WrapWidth < 0 {
+				err = fmt.Errorf("must not be negative")
+			}
+		default:
+			var rules []Rule
+			err = value.Decode(&rules)
+			p.States[key] = rules
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// SchemaVersion is the newest rules file schema this validator reads. Schema 2 adds
+// the since, deprecated, and replaced_by metadata of rules.
+const SchemaVersion = 2
+
+// Schema returns the schema a rules file declares, 1 when it declares none.
+func Schema(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var p struct {
+		Schema int `yaml:"schema"`
+	}
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return 0, fmt.Errorf("%s: %v", path, err)
+	}
+	return max(p.Schema, 1), nil
+}
+
+// RoleRules returns the rules file for a device role: roles/<role>.yaml next to the
+// base rules file. Role files normally extend the base file. An empty role selects
+// the base file itself.
+func RoleRules(rulesFile, role string) string {
+	if role == "" {
+		return rulesFile
+	}
+	return filepath.Join(filepath.Dir(rulesFile), "roles", role+".yaml")
+}
+
+// loadProfile loads a rules file. The files it extends are loaded first, so what it
+// sets of lines, when not nil, overrides what they set.
+func loadProfile(path string, seen []string, sources *[]string, lines *LineHandling) (map[string][]Rule, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range seen {
+		if s == abs {
+			return nil, fmt.Errorf("extends cycle: %s", strings.Join(append(seen, abs), " -> "))
+		}
+	}
+	seen = append(seen, abs)
+	if sources != nil {
+		*sources = append(*sources, abs)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p profile
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if p.Schema > SchemaVersion {
+		return nil, fmt.Errorf("%s: written for rules schema %d, this validator reads up to %d", path, p.Schema, SchemaVersion)
+	}
+	dir := filepath.Dir(abs)
+
+	rules := map[string][]Rule{}
+	for _, base := range p.Extends {
+		if !filepath.IsAbs(base) {
+			base = filepath.Join(dir, base)
+		}
+		inherited, err := loadProfile(base, seen, sources, lines)
+		if err != nil {
+			return nil, err
+		}
+		for state, list := range inherited {
+			rules[state] = mergeRules(rules[state], list)
+		}
+	}
+
+	if lines != nil {
+		if p.Lines.Comments != "" {
+			lines.Comments = p.Lines.Comments
+		}
+		if p.Lines.BlankLines != "" {
+			lines.BlankLines = p.Lines.BlankLines
+		}
+		if p.Lines.Continuation != "" {
+			lines.Continuation = p.Lines.Continuation
+		}
+		if p.Lines.WrapWidth != 0 {
+			lines.WrapWidth = p.Lines.WrapWidth
+		}
+		if p.Lines.Negations != "" {
+			lines.Negations = p.Lines.Negations
+		}
+	}
+
+	for state, list := range p.States {
+		rules[state] = mergeRules(rules[state], resolveChecks(list, dir))
+	}
+	for state, list := range p.Override {
+		rules[state] = resolveChecks(list, dir)
+	}
+	for state, patterns := range p.Remove {
+		for _, pattern := range patterns {
+			i := indexOf(rules[state], pattern)
+			if i < 0 {
+				return nil, fmt.Errorf("%s: remove: state %s has no rule '%s'", path, state, pattern)
+			}
+			rules[state] = append(rules[state][:i:i], rules[state][i+1:]...)
+		}
+	}
+	for state, targets := range p.Fallback {
+		if _, ok := rules[state]; !ok && len(targets) == 0 {
+			continue
+		}
+		list := rules[state][:0:0]
+		for _, r := range rules[state] {
+			if r.Fallback == "" {
+				list = append(list, r)
+			}
+		}
+		for _, target := range targets {
+			list = append(list, Rule{Fallback: target})
+		}
+		rules[state] = list
+	}
+	return rules, nil
+}
+
+// mergeRules adds rules to base, replacing base rules that have the same pattern.
+func mergeRules(base, rules []Rule) []Rule {
+	out := append([]Rule(nil), base...)
+	for _, r := range rules {
+		if i := indexOf(out, r.Pattern); i >= 0 {
+			out[i] = r
+		} else {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func indexOf(rules []Rule, pattern string) int {
+	for i, r := range rules {
+		if r.Pattern == pattern && r.Fallback == "" {
+			return i
+		}
+	}
+	return -1
+}
+
+// resolveChecks makes script and wasm paths absolute, relative to the file that
+// declares them, so inherited checks still resolve from an overlay in another directory.
+func resolveChecks(rules []Rule, dir string) []Rule {
+	out := make([]Rule, len(rules))
+	for i, r := range rules {
+		r.Script = resolveRef(r.Script, dir)
+		r.Wasm = resolveRef(r.Wasm, dir)
+		out[i] = r
+	}
+	return out
+}
+
+func resolveRef(ref, dir string) string {
+	file, name, ok := strings.Cut(ref, ":")
+	if !ok || file == "" || filepath.IsAbs(file) {
+		return ref
+	}
+	return filepath.Join(dir, file) + ":" + name
+}
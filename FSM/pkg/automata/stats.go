@@ -0,0 +1,136 @@
+package automata
+
+import (
+	"regexp"
+	"sort"
+)
+
+// Stats counts how a config exercised the rules, for tuning rule sets: states that
+// never activate and rules that never match are candidates for removal.
+type Stats struct {
+	Lines  int          `json:"lines"` // lines validated, without blanks and comments
+	States []StateStats `json:"states"`
+	Rules  []RuleStats  `json:"rules"`
+}
+
+// StateStats counts the lines validated in a state and how often its block was entered.
+type StateStats struct {
+	State   string `json:"state"`
+	Lines   int    `json:"lines"`
+	Entered int    `json:"entered"`
+}
+
+// RuleStats counts the lines a rule matched.
+type RuleStats struct {
+	State   string `json:"state"`
+	Pattern string `json:"pattern"`
+	Matches int    `json:"matches"`
+}
+
+// stats are the raw counters kept by ProcessLine.
+type stats struct {
+	lines   int
+	states  map[string]int
+	entered map[string]int
+	rules   map[*regexp.Regexp]int
+}
+
+func (s *stats) count(state string, entered bool, rule *regexp.Regexp) {
+	if s.states == nil {
+		s.states, s.entered, s.rules = map[string]int{}, map[string]int{}, map[*regexp.Regexp]int{}
+	}
+	s.lines++
+	s.states[state]++
+	if entered {
+		s.entered[state]++
+	}
+	if rule != nil {
+		s.rules[rule]++
+	}
+}
+
+// add adds the counters of another run of the same machine.
+func (s *stats) add(other stats) {
+	if other.states == nil {
+		return
+	}
+	if s.states == nil {
+		s.states, s.entered, s.rules = map[string]int{}, map[string]int{}, map[*regexp.Regexp]int{}
+	}
+	s.lines += other.lines
+	for state, n := range other.states {
+		s.states[state] += n
+	}
+	for state, n := range other.entered {
+		s.entered[state] += n
+	}
+	for rule, n := range other.rules {
+		s.rules[rule] += n
+	}
+}
+
+// Stats returns the counters for the lines processed so far. Every state and rule of
+// the rule set is listed, including those with zero counts.
+func (fsm *FSM) Stats() *Stats {
+	out := &Stats{Lines: fsm.stats.lines}
+	states := map[string]bool{"GLOBAL": true}
+	for state := range fsm.Rules {
+		states[state] = true
+	}
+	for state := range fsm.stats.states {
+		states[state] = true
+	}
+	for _, state := range sortedKeys(states) {
+		out.States = append(out.States, StateStats{State: state, Lines: fsm.stats.states[state], Entered: fsm.stats.entered[state]})
+		for _, re := range fsm.Rules[state] {
+			out.Rules = append(out.Rules, RuleStats{State: state, Pattern: re.String(), Matches: fsm.stats.rules[re]})
+		}
+	}
+	return out
+}
+
+// MergeStats adds up the stats of several configs, e.g. of a fleet, matching states
+// by name and rules by state and pattern.
+func MergeStats(all ...*Stats) *Stats {
+	out := &Stats{}
+	stateIndex := map[string]int{}
+	ruleIndex := map[[2]string]int{}
+	for _, s := range all {
+		if s == nil {
+			continue
+		}
+		out.Lines += s.Lines
+		for _, st := range s.States {
+			i, ok := stateIndex[st.State]
+			if !ok {
+				i = len(out.States)
+				stateIndex[st.State] = i
+				out.States = append(out.States, StateStats{State: st.State})
+			}
+			out.States[i].Lines += st.Lines
+			out.States[i].Entered += st.Entered
+		}
+		for _, r := range s.Rules {
+			key := [2]string{r.State, r.Pattern}
+			i, ok := ruleIndex[key]
+			if !ok {
+				i = len(out.Rules)
+				ruleIndex[key] = i
+				out.Rules = append(out.Rules, RuleStats{State: r.State, Pattern: r.Pattern})
+			}
+			out.Rules[i].Matches += r.Matches
+		}
+	}
+	sort.SliceStable(out.States, func(i, j int) bool { return out.States[i].State < out.States[j].State })
+	sort.SliceStable(out.Rules, func(i, j int) bool { return out.Rules[i].State < out.Rules[j].State })
+	return out
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,128 @@
+// Package baseline records the findings a team has accepted for now, so that later
+// runs report only the findings that are new since. This lets the validator be
+// adopted on legacy configs, fleets, and payload corpora without fixing everything
+// first: the baseline is recorded once, new findings fail the run, and the baseline
+// shrinks as old findings are fixed.
+package baseline
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"config-validator/pkg/automata"
+)
+
+// Entry is a finding of the baseline. Findings are matched by file, rule, and
+// command, not by line, so they stay matched when lines are added above them.
+// Findings without a catalog code are also matched by their message.
+type Entry struct {
+	File    string `json:"file"`
+	State   string `json:"state,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Command string `json:"command,omitempty"`
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"` // where it was when recorded
+}
+
+// String renders an entry the way reports render findings.
+func (e Entry) String() string {
+	return automata.FormatFinding(automata.Finding{Line: e.Line, Message: e.Message})
+}
+
+func (e Entry) key() string {
+	if e.Code != "" {
+		return e.Code + "\x00" + e.Command
+	}
+	return e.State + "\x00" + e.Command + "\x00" + e.Message
+}
+
+// Baseline is a recorded set of findings by file. Compare may be called from
+// several goroutines at once.
+type Baseline struct {
+	Created  time.Time `json:"created"`
+	Findings []Entry   `json:"findings"`
+
+	byFile map[string]map[string][]Entry // file → key → entries
+}
+
+// New returns an empty baseline to Add findings to.
+func New() *Baseline {
+	return &Baseline{Created: time.Now().UTC(), byFile: map[string]map[string][]Entry{}}
+}
+
+// Load reads a baseline file. A missing file is reported as os.ErrNotExist.
+func Load(path string) (*Baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b := New()
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("%s is not a baseline: %v", path, err)
+	}
+	for _, e := range b.Findings {
+		b.index(e)
+	}
+	return b, nil
+}
+
+// Add records the findings of a file.
+func (b *Baseline) Add(file string, findings []automata.Finding) {
+	for _, f := range findings {
+		e := Entry{File: file, State: f.State, Code: f.Code, Command: f.Command, Message: f.Message, Line: f.Line}
+		b.Findings = append(b.Findings, e)
+		b.index(e)
+	}
+}
+
+func (b *Baseline) index(e Entry) {
+	if b.byFile[e.File] == nil {
+		b.byFile[e.File] = map[string][]Entry{}
+	}
+	b.byFile[e.File][e.key()] = append(b.byFile[e.File][e.key()], e)
+}
+
+// Len is the number of findings in the baseline.
+func (b *Baseline) Len() int { return len(b.Findings) }
+
+// Write saves the baseline, sorted by file and line so it diffs well under
+// version control.
+func (b *Baseline) Write(path string) error {
+	sort.SliceStable(b.Findings, func(i, j int) bool {
+		if b.Findings[i].File != b.Findings[j].File {
+			return b.Findings[i].File < b.Findings[j].File
+		}
+		return b.Findings[i].Line < b.Findings[j].Line
+	})
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Compare returns the findings of a file that are not in the baseline, and the
+// baseline's findings of the file that no longer occur. A finding recorded twice
+// covers two occurrences.
+func (b *Baseline) Compare(file string, findings []automata.Finding) (fresh []automata.Finding, resolved []Entry) {
+	remaining := map[string]int{}
+	for key, entries := range b.byFile[file] {
+		remaining[key] = len(entries)
+	}
+	for _, f := range findings {
+		key := Entry{State: f.State, Code: f.Code, Command: f.Command, Message: f.Message}.key()
+		if remaining[key] > 0 {
+			remaining[key]--
+			continue
+		}
+		fresh = append(fresh, f)
+	}
+	for key, entries := range b.byFile[file] {
+		resolved = append(resolved, entries[len(entries)-remaining[key]:]...)
+	}
+	sort.Slice(resolved, func(i, j int) bool { return resolved[i].Line < resolved[j].Line })
+	return fresh, resolved
+}
@@ -0,0 +1,178 @@
+// Package bincheck validates binary payloads, CBOR (RFC 8949) and MessagePack: the
+// encoding of every item, lengths against the data left, nesting, and UTF-8 in text
+// strings. Well-formed payloads are also decoded to JSON values, so the checks for
+// JSON payloads (such as a protobuf message) can be applied to them.
+package bincheck
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strconv"
+	"unicode/utf8"
+
+	"config-validator/pkg/automata"
+)
+
+// States reported in findings.
+const (
+	StateCBOR    = "CBOR"
+	StateMsgPack = "MSGPACK"
+)
+
+// MaxDepth is how deeply arrays and maps may nest. Deeper payloads are rejected, as a
+// decoder's stack would be exhausted by a hostile one.
+const MaxDepth = 512
+
+// malformed is a problem after which the rest of the payload cannot be decoded.
+type malformed struct {
+	offset int
+	msg    string
+	path   string // innermost item the problem is in
+}
+
+func (e *malformed) Error() string { return e.msg }
+
+// within records that err happened in the item at path, unless an item inside it
+// was recorded already.
+func within(err error, path string) error {
+	if m, ok := err.(*malformed); ok && m.path == "" {
+		m.path = path
+	}
+	return err
+}
+
+// decoder holds what is shared by the CBOR and MessagePack decoders.
+type decoder struct {
+	state    string
+	data     []byte
+	pos      int
+	depth    int
+	findings []automata.Finding
+}
+
+func (d *decoder) add(offset int, path, severity, msg string) {
+	if path == "" {
+		path = "$"
+	}
+	d.findings = append(d.findings, automata.Finding{
+		Command:  path,
+		State:    d.state,
+		Message:  fmt.Sprintf("offset %d (%s): %s", offset, path, msg),
+		Severity: severity,
+	})
+}
+
+// take returns the next n bytes, or a malformed error naming what was being read.
+func (d *decoder) take(n uint64, what string) ([]byte, error) {
+	if left := uint64(len(d.data) - d.pos); n > left {
+		return nil, &malformed{offset: d.pos, msg: fmt.Sprintf("truncated: %s needs %d bytes, but only %d are left", what, n, left)}
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// uint reads a big-endian unsigned integer of size bytes.
+func (d *decoder) uint(size int, what string) (uint64, error) {
+	b, err := d.take(uint64(size), what)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+// enter and leave track the nesting of arrays and maps.
+func (d *decoder) enter(offset int) error {
+	if d.depth++; d.depth > MaxDepth {
+		return &malformed{offset: offset, msg: fmt.Sprintf("arrays and maps nest more than %d deep", MaxDepth)}
+	}
+	return nil
+}
+
+func (d *decoder) leave() { d.depth-- }
+
+// text checks that a text string is UTF-8.
+func (d *decoder) text(b []byte, offset int, path string) string {
+	if !utf8.Valid(b) {
+		d.add(offset, path, automata.SeverityError, "text string is not valid UTF-8; binary data belongs in a byte string")
+	}
+	return string(b)
+}
+
+// key turns a map key into a JSON object key, and reports duplicates.
+func (d *decoder) key(k any, offset int, path string, seen map[string]bool) string {
+	var s string
+	switch k := k.(type) {
+	case string:
+		s = k
+	case nil:
+		s = "null"
+	case []byte:
+		s = base64.StdEncoding.EncodeToString(k)
+	default:
+		s = fmt.Sprint(k)
+		if _, ok := k.(map[string]any); ok {
+			d.add(offset, path, automata.SeverityWarning, "map key is a map; it has no JSON form")
+		}
+		if _, ok := k.([]any); ok {
+			d.add(offset, path, automata.SeverityWarning, "map key is an array; it has no JSON form")
+		}
+	}
+	if seen[s] {
+		d.add(offset, path, automata.SeverityWarning, fmt.Sprintf("duplicate map key %s; decoders differ on which value they keep", strconv.Quote(s)))
+	}
+	seen[s] = true
+	return s
+}
+
+// float converts a float to a JSON value: NaN and infinities, which JSON cannot hold,
+// become the strings the protobuf JSON mapping uses.
+func float(f float64) any {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	return f
+}
+
+// run decodes the items of a payload with item. Unless sequence is set, the payload
+// must hold exactly one item. The decoded values are returned if no error was found.
+func (d *decoder) run(sequence bool, item func(path string) (any, error)) ([]automata.Finding, []any) {
+	var values []any
+	if len(d.data) == 0 {
+		d.add(0, "", automata.SeverityError, "payload is empty")
+		return d.findings, nil
+	}
+	for d.pos < len(d.data) {
+		path := ""
+		if sequence {
+			path = fmt.Sprintf("$[%d]", len(values))
+		}
+		v, err := item(path)
+		if err != nil {
+			e := within(err, path).(*malformed)
+			d.add(e.offset, e.path, automata.SeverityError, e.msg)
+			return d.findings, nil
+		}
+		values = append(values, v)
+		if !sequence && d.pos < len(d.data) {
+			d.add(d.pos, "", automata.SeverityError, fmt.Sprintf("%d bytes after the end of the top-level item (use -sequence if the payload holds several items)", len(d.data)-d.pos))
+			return d.findings, nil
+		}
+	}
+	for _, f := range d.findings {
+		if f.Severity == automata.SeverityError {
+			return d.findings, nil
+		}
+	}
+	return d.findings, values
+}
@@ -0,0 +1,265 @@
+package bincheck
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+
+	"config-validator/pkg/automata"
+)
+
+// breakByte ends an indefinite-length item.
+const breakByte = 0xff
+
+type cborDecoder struct{ decoder }
+
+// CheckCBOR checks a CBOR payload, or with sequence a CBOR sequence (RFC 8742), and
+// returns its findings and, when it has no errors, its items as JSON values.
+func CheckCBOR(content []byte, sequence bool) ([]automata.Finding, []any) {
+	d := &cborDecoder{decoder{state: StateCBOR, data: content}}
+	return d.run(sequence, d.item)
+}
+
+// head reads the initial byte of an item and its argument. indefinite is set for
+// additional information 31.
+func (d *cborDecoder) head() (major, info byte, arg uint64, indefinite bool, err error) {
+	offset := d.pos
+	b, err := d.take(1, "item")
+	if err != nil {
+		return 0, 0, 0, false, err
+	}
+	major, info = b[0]>>5, b[0]&0x1f
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info <= 27:
+		arg, err = d.uint(1<<(info-24), "argument")
+	case info < 31:
+		err = &malformed{offset: offset, msg: fmt.Sprintf("additional information %d is reserved (initial byte 0x%02x)", info, b[0])}
+	default:
+		indefinite = true
+		if major < 2 || major == 6 {
+			err = &malformed{offset: offset, msg: fmt.Sprintf("major type %d cannot have an indefinite length (initial byte 0x%02x)", major, b[0])}
+		}
+	}
+	return major, info, arg, indefinite, err
+}
+
+func (d *cborDecoder) item(path string) (any, error) {
+	offset := d.pos
+	major, info, arg, indefinite, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case 0:
+		return arg, nil
+	case 1:
+		if arg < math.MaxInt64 {
+			return -1 - int64(arg), nil
+		}
+		n := new(big.Int).SetUint64(arg)
+		return n.Sub(big.NewInt(-1), n), nil
+	case 2, 3:
+		b, err := d.str(major, arg, indefinite, path)
+		if err != nil || major == 2 {
+			return b, err
+		}
+		return d.text(b, offset, path), nil
+	case 4:
+		return d.array(arg, indefinite, offset, path)
+	case 5:
+		return d.dict(arg, indefinite, offset, path)
+	case 6:
+		return d.tag(arg, offset, path)
+	}
+
+	switch {
+	case indefinite:
+		return nil, &malformed{offset: offset, msg: "break (0xff) outside an indefinite-length item"}
+	case info == 20, info == 21:
+		return info == 21, nil
+	case info == 22, info == 23: // null, undefined
+		return nil, nil
+	case info == 24 && arg < 32:
+		return nil, &malformed{offset: offset, msg: fmt.Sprintf("simple value %d must be encoded in the initial byte", arg)}
+	case info == 25:
+		return float(float16(uint16(arg))), nil
+	case info == 26:
+		return float(float64(math.Float32frombits(uint32(arg)))), nil
+	case info == 27:
+		return float(math.Float64frombits(arg)), nil
+	}
+	d.add(offset, path, automata.SeverityWarning, fmt.Sprintf("simple value %d is unassigned; it is read as null", arg))
+	return nil, nil
+}
+
+// str reads a byte or text string. An indefinite-length string is a series of
+// definite-length chunks of the same type.
+func (d *cborDecoder) str(major byte, arg uint64, indefinite bool, path string) ([]byte, error) {
+	what := map[byte]string{2: "byte string", 3: "text string"}[major]
+	if !indefinite {
+		return d.take(arg, what)
+	}
+	var b []byte
+	for {
+		if d.pos >= len(d.data) {
+			return nil, &malformed{offset: d.pos, msg: fmt.Sprintf("indefinite-length %s is missing its break (0xff)", what)}
+		}
+		if d.data[d.pos] == breakByte {
+			d.pos++
+			return b, nil
+		}
+		offset := d.pos
+		chunkMajor, _, n, chunkIndefinite, err := d.head()
+		if err != nil {
+			return nil, err
+		}
+		if chunkMajor != major || chunkIndefinite {
+			return nil, &malformed{offset: offset, msg: fmt.Sprintf("chunks of an indefinite-length %s must be definite-length %ss", what, what)}
+		}
+		chunk, err := d.take(n, what+" chunk")
+		if err != nil {
+			return nil, err
+		}
+		if major == 3 {
+			d.text(chunk, offset, path) // each chunk must be UTF-8 on its own
+		}
+		b = append(b, chunk...)
+	}
+}
+
+// more reports whether an array or map has another entry: before its count runs out,
+// or before the break of an indefinite length.
+func (d *cborDecoder) more(i, count uint64, indefinite bool, what string) (bool, error) {
+	if !indefinite {
+		return i < count, nil
+	}
+	if d.pos >= len(d.data) {
+		return false, &malformed{offset: d.pos, msg: fmt.Sprintf("indefinite-length %s is missing its break (0xff)", what)}
+	}
+	if d.data[d.pos] == breakByte {
+		d.pos++
+		return false, nil
+	}
+	return true, nil
+}
+
+func (d *cborDecoder) array(count uint64, indefinite bool, offset int, path string) (any, error) {
+	if !indefinite && count > uint64(len(d.data)-d.pos) {
+		return nil, &malformed{offset: offset, msg: fmt.Sprintf("array of %d items, but only %d bytes are left", count, len(d.data)-d.pos)}
+	}
+	if err := d.enter(offset); err != nil {
+		return nil, err
+	}
+	defer d.leave()
+	items := []any{}
+	for i := uint64(0); ; i++ {
+		more, err := d.more(i, count, indefinite, "array")
+		if err != nil || !more {
+			return items, err
+		}
+		at := fmt.Sprintf("%s[%d]", root(path), i)
+		v, err := d.item(at)
+		if err != nil {
+			return nil, within(err, at)
+		}
+		items = append(items, v)
+	}
+}
+
+func (d *cborDecoder) dict(count uint64, indefinite bool, offset int, path string) (any, error) {
+	if !indefinite && count > uint64(len(d.data)-d.pos)/2 {
+		return nil, &malformed{offset: offset, msg: fmt.Sprintf("map of %d entries, but only %d bytes are left", count, len(d.data)-d.pos)}
+	}
+	if err := d.enter(offset); err != nil {
+		return nil, err
+	}
+	defer d.leave()
+	m := map[string]any{}
+	seen := map[string]bool{}
+	for i := uint64(0); ; i++ {
+		more, err := d.more(i, count, indefinite, "map")
+		if err != nil || !more {
+			return m, err
+		}
+		keyOffset := d.pos
+		k, err := d.item(root(path) + "{key}")
+		if err != nil {
+			return nil, within(err, root(path)+"{key}")
+		}
+		key := d.key(k, keyOffset, path, seen)
+		if indefinite && d.pos < len(d.data) && d.data[d.pos] == breakByte {
+			return nil, &malformed{offset: d.pos, msg: fmt.Sprintf("map key %q has no value before the break", key)}
+		}
+		if m[key], err = d.item(child(path, key)); err != nil {
+			return nil, within(err, child(path, key))
+		}
+	}
+}
+
+// tag reads a tagged item and checks the tags whose content RFC 8949 defines.
+func (d *cborDecoder) tag(number uint64, offset int, path string) (any, error) {
+	v, err := d.item(path)
+	if err != nil {
+		return nil, err
+	}
+	switch number {
+	case 0:
+		s, ok := v.(string)
+		if _, perr := time.Parse(time.RFC3339Nano, s); !ok || perr != nil {
+			d.add(offset, path, automata.SeverityError, "tag 0 (date/time) must hold an RFC 3339 text string")
+		}
+	case 1:
+		switch v.(type) {
+		case uint64, int64, float64, *big.Int:
+		default:
+			d.add(offset, path, automata.SeverityError, "tag 1 (epoch time) must hold a number")
+		}
+	case 2, 3:
+		b, ok := v.([]byte)
+		if !ok {
+			d.add(offset, path, automata.SeverityError, fmt.Sprintf("tag %d (bignum) must hold a byte string", number))
+			return v, nil
+		}
+		n := new(big.Int).SetBytes(b)
+		if number == 3 {
+			n.Sub(big.NewInt(-1), n)
+		}
+		return n, nil
+	}
+	return v, nil
+}
+
+// float16 decodes an IEEE 754 half-precision float.
+func float16(h uint16) float64 {
+	exp, mant := int(h>>10)&0x1f, float64(h&0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		f = math.Inf(1)
+		if mant != 0 {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
+
+func root(path string) string {
+	if path == "" {
+		return "$"
+	}
+	return path
+}
+
+func child(path, key string) string {
+	return root(path) + "." + key
+}
@@ -0,0 +1,187 @@
+package bincheck
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	"config-validator/pkg/automata"
+)
+
+// timestampExt is the extension type of MessagePack timestamps.
+const timestampExt = -1
+
+type msgpackDecoder struct{ decoder }
+
+// CheckMsgPack checks a MessagePack payload, or with sequence a stream of values, and
+// returns its findings and, when it has no errors, its values as JSON values.
+func CheckMsgPack(content []byte, sequence bool) ([]automata.Finding, []any) {
+	d := &msgpackDecoder{decoder{state: StateMsgPack, data: content}}
+	return d.run(sequence, d.item)
+}
+
+func (d *msgpackDecoder) item(path string) (any, error) {
+	offset := d.pos
+	b, err := d.take(1, "item")
+	if err != nil {
+		return nil, err
+	}
+	t := b[0]
+	switch {
+	case t <= 0x7f:
+		return uint64(t), nil
+	case t >= 0xe0:
+		return int64(int8(t)), nil
+	case t <= 0x8f:
+		return d.dict(uint64(t&0x0f), offset, path)
+	case t <= 0x9f:
+		return d.array(uint64(t&0x0f), offset, path)
+	case t <= 0xbf:
+		return d.str(uint64(t&0x1f), offset, path)
+	}
+
+	switch t {
+	case 0xc0:
+		return nil, nil
+	case 0xc1:
+		return nil, &malformed{offset: offset, msg: "type byte 0xc1 is never used in MessagePack"}
+	case 0xc2, 0xc3:
+		return t == 0xc3, nil
+	case 0xc4, 0xc5, 0xc6: // bin 8/16/32
+		n, err := d.uint(1<<(t-0xc4), "bin length")
+		if err != nil {
+			return nil, err
+		}
+		return d.take(n, "bin")
+	case 0xc7, 0xc8, 0xc9: // ext 8/16/32
+		n, err := d.uint(1<<(t-0xc7), "ext length")
+		if err != nil {
+			return nil, err
+		}
+		return d.ext(n, offset, path)
+	case 0xca:
+		v, err := d.uint(4, "float 32")
+		return float(float64(math.Float32frombits(uint32(v)))), err
+	case 0xcb:
+		v, err := d.uint(8, "float 64")
+		return float(math.Float64frombits(v)), err
+	case 0xcc, 0xcd, 0xce, 0xcf: // uint 8/16/32/64
+		return d.uint(1<<(t-0xcc), "uint")
+	case 0xd0, 0xd1, 0xd2, 0xd3: // int 8/16/32/64
+		size := 1 << (t - 0xd0)
+		v, err := d.uint(size, "int")
+		shift := 64 - 8*size
+		return int64(v<<shift) >> shift, err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8: // fixext 1/2/4/8/16
+		return d.ext(1<<(t-0xd4), offset, path)
+	case 0xd9, 0xda, 0xdb: // str 8/16/32
+		n, err := d.uint(1<<(t-0xd9), "str length")
+		if err != nil {
+			return nil, err
+		}
+		return d.str(n, offset, path)
+	case 0xdc, 0xdd: // array 16/32
+		n, err := d.uint(2<<(t-0xdc), "array length")
+		if err != nil {
+			return nil, err
+		}
+		return d.array(n, offset, path)
+	default: // 0xde, 0xdf: map 16/32
+		n, err := d.uint(2<<(t-0xde), "map length")
+		if err != nil {
+			return nil, err
+		}
+		return d.dict(n, offset, path)
+	}
+}
+
+func (d *msgpackDecoder) str(n uint64, offset int, path string) (any, error) {
+	b, err := d.take(n, "str")
+	if err != nil {
+		return nil, err
+	}
+	return d.text(b, offset, path), nil
+}
+
+func (d *msgpackDecoder) array(count uint64, offset int, path string) (any, error) {
+	if count > uint64(len(d.data)-d.pos) {
+		return nil, &malformed{offset: offset, msg: fmt.Sprintf("array of %d items, but only %d bytes are left", count, len(d.data)-d.pos)}
+	}
+	if err := d.enter(offset); err != nil {
+		return nil, err
+	}
+	defer d.leave()
+	items := make([]any, 0, count)
+	for i := uint64(0); i < count; i++ {
+		at := fmt.Sprintf("%s[%d]", root(path), i)
+		v, err := d.item(at)
+		if err != nil {
+			return nil, within(err, at)
+		}
+		items = append(items, v)
+	}
+	return items, nil
+}
+
+func (d *msgpackDecoder) dict(count uint64, offset int, path string) (any, error) {
+	if count > uint64(len(d.data)-d.pos)/2 {
+		return nil, &malformed{offset: offset, msg: fmt.Sprintf("map of %d entries, but only %d bytes are left", count, len(d.data)-d.pos)}
+	}
+	if err := d.enter(offset); err != nil {
+		return nil, err
+	}
+	defer d.leave()
+	m := make(map[string]any, count)
+	seen := map[string]bool{}
+	for i := uint64(0); i < count; i++ {
+		keyOffset := d.pos
+		k, err := d.item(root(path) + "{key}")
+		if err != nil {
+			return nil, within(err, root(path)+"{key}")
+		}
+		key := d.key(k, keyOffset, path, seen)
+		if m[key], err = d.item(child(path, key)); err != nil {
+			return nil, within(err, child(path, key))
+		}
+	}
+	return m, nil
+}
+
+// ext reads an extension value. Timestamps become RFC 3339 strings; other types an
+// object of their type and data.
+func (d *msgpackDecoder) ext(n uint64, offset int, path string) (any, error) {
+	t, err := d.take(1, "ext type")
+	if err != nil {
+		return nil, err
+	}
+	typ := int8(t[0])
+	data, err := d.take(n, "ext data")
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case typ == timestampExt:
+		var sec int64
+		var nsec uint32
+		switch len(data) {
+		case 4:
+			sec = int64(binary.BigEndian.Uint32(data))
+		case 8:
+			v := binary.BigEndian.Uint64(data)
+			nsec, sec = uint32(v>>34), int64(v&(1<<34-1))
+		case 12:
+			nsec, sec = binary.BigEndian.Uint32(data), int64(binary.BigEndian.Uint64(data[4:]))
+		default:
+			d.add(offset, path, automata.SeverityError, fmt.Sprintf("timestamp extension has %d bytes of data; it must have 4, 8, or 12", len(data)))
+			return nil, nil
+		}
+		if nsec >= 1e9 {
+			d.add(offset, path, automata.SeverityError, fmt.Sprintf("timestamp nanoseconds %d are not below 1e9", nsec))
+		}
+		return time.Unix(sec, int64(nsec)).UTC().Format(time.RFC3339Nano), nil
+	case typ < 0:
+		d.add(offset, path, automata.SeverityWarning, fmt.Sprintf("extension type %d is reserved by MessagePack", typ))
+	}
+	return map[string]any{"type": typ, "data": data}, nil
+}
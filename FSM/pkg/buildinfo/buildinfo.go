@@ -0,0 +1,49 @@
+// Package buildinfo describes the running binary, so results can be traced back to
+// the build and rules that produced them.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Version is the release version, set when building a release:
+//
+//	go build -ldflags "-X config-validator/pkg/buildinfo.Version=v1.4.0" ./cmd/config-validator
+//
+// Without it, the module version go install recorded is used, or "devel".
+var Version = ""
+
+// Info is what is known about the build.
+type Info struct {
+	Version      string `json:"version"`
+	GoVersion    string `json:"go_version"`
+	Revision     string `json:"revision,omitempty"`      // VCS commit the binary was built from
+	RevisionTime string `json:"revision_time,omitempty"` // its commit time
+	Modified     bool   `json:"modified,omitempty"`      // built from a tree with uncommitted changes
+	Platform     string `json:"platform"`
+}
+
+// Get returns the build information of the running binary.
+func Get() Info {
+	info := Info{Version: Version, GoVersion: runtime.Version(), Platform: runtime.GOOS + "/" + runtime.GOARCH}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				info.Revision = s.Value
+			case "vcs.time":
+				info.RevisionTime = s.Value
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "devel"
+	}
+	return info
+}
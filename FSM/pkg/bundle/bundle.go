@@ -0,0 +1,109 @@
+package bundle
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"config-validator/pkg/automata"
+)
+
+// magic starts every bundle, followed by the format version.
+const magic = "NVPBUNDLE1\n"
+
+// Bundle is a rules file with everything resolved at compile time: `extends`,
+// `override`, and `remove` applied, check references made absolute, and every
+// pattern checked to compile. Loading it skips YAML parsing and profile resolution;
+// the patterns are stored as text and compiled again at load.
+type Bundle struct {
+	Version  string // content hash of the sources, as config.RuleSet reports it
+	Compiled time.Time
+	Rules    map[string][]automata.Rule
+	Lines    automata.LineHandling
+	Sources  []Source
+}
+
+// Source is a file the bundle was compiled from, recorded so that a bundle older
+// than its sources is not used.
+type Source struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Path returns the bundle used in place of a rules file: next to it, with its
+// extension replaced by .bundle.
+func Path(rulesFile string) string {
+	return strings.TrimSuffix(rulesFile, filepath.Ext(rulesFile)) + ".bundle"
+}
+
+// IsBundle reports whether a rules reference names a bundle rather than a YAML file.
+func IsBundle(rulesFile string) bool {
+	return filepath.Ext(rulesFile) == ".bundle"
+}
+
+// Write stores the resolved rules of a rules file, and how it treats comment and
+// blank lines, as a bundle at path. The caller checks that the patterns compile.
+func Write(path, version string, rules map[string][]automata.Rule, lines automata.LineHandling, sources []string) error {
+	b := Bundle{Version: version, Compiled: time.Now().UTC(), Rules: rules, Lines: lines}
+	for _, file := range sources {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		b.Sources = append(b.Sources, Source{Path: file, Size: info.Size(), ModTime: info.ModTime()})
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(magic)
+	if err := gob.NewEncoder(&buf).Encode(&b); err != nil {
+		return fmt.Errorf("failed to encode bundle: %v", err)
+	}
+	// Write through a temporary file so a running validator never reads a partial bundle.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Read loads a bundle.
+func Read(path string) (*Bundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle: %v", err)
+	}
+	if !bytes.HasPrefix(data, []byte(magic)) {
+		return nil, fmt.Errorf("%s is not a rules bundle (or was compiled by an incompatible version)", path)
+	}
+	var b Bundle
+	if err := gob.NewDecoder(bytes.NewReader(data[len(magic):])).Decode(&b); err != nil {
+		return nil, fmt.Errorf("failed to decode bundle %s: %v", path, err)
+	}
+	return &b, nil
+}
+
+// Stale reports the first source that changed since the bundle was compiled, or ""
+// when the bundle is up to date.
+func (b *Bundle) Stale() string {
+	for _, s := range b.Sources {
+		info, err := os.Stat(s.Path)
+		if err != nil || info.Size() != s.Size || !info.ModTime().Equal(s.ModTime) {
+			return s.Path
+		}
+	}
+	return ""
+}
+
+// Files returns the paths of the bundle's sources.
+func (b *Bundle) Files() []string {
+	files := make([]string, len(b.Sources))
+	for i, s := range b.Sources {
+		files[i] = s.Path
+	}
+	return files
+}
@@ -0,0 +1,241 @@
+// Package capture reads packet captures, pcap and pcapng files, decodes the link,
+// IP, TCP, and UDP headers of their packets, and reassembles TCP connections into
+// the byte streams each side sent, so protocol validators can check traffic as it
+// was seen on the wire.
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Link types of the captures decoded.
+const (
+	LinkNull      = 0   // BSD loopback
+	LinkEthernet  = 1   // Ethernet II, with 802.1Q tags
+	LinkRaw       = 101 // IPv4 or IPv6 without a link header
+	LinkLinuxSLL  = 113 // Linux "any" device
+	LinkIPv4      = 228
+	LinkIPv6      = 229
+	LinkLinuxSLL2 = 276
+)
+
+// MaxPacket is the largest packet record read; larger ones make the file invalid.
+const MaxPacket = 256 << 10
+
+// Packet is one captured packet.
+type Packet struct {
+	Number int // 1-based position in the capture
+	Time   time.Time
+	Link   int // link type of Data
+	Data   []byte
+	Length int // length on the wire, which is more than len(Data) when truncated
+}
+
+// Reader reads the packets of a pcap or pcapng capture.
+type Reader struct {
+	r      *bufio.Reader
+	next   func() (Packet, error)
+	number int
+
+	// pcap
+	order binary.ByteOrder
+	nano  bool
+	link  int
+
+	// pcapng: the interfaces of the current section
+	ifaces []iface
+}
+
+type iface struct {
+	link   int
+	perSec uint64 // timestamp units per second
+}
+
+// IsCapture reports whether data starts like a pcap or pcapng file.
+func IsCapture(data []byte) bool {
+	if len(data) < 4 {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(data) {
+	case 0xa1b2c3d4, 0xd4c3b2a1, 0xa1b23c4d, 0x4d3cb2a1, 0x0a0d0d0a:
+		return true
+	}
+	return false
+}
+
+// NewReader reads the file header of a capture.
+func NewReader(r io.Reader) (*Reader, error) {
+	cr := &Reader{r: bufio.NewReaderSize(r, 64<<10)}
+	magic, err := cr.r.Peek(4)
+	if err != nil {
+		return nil, errors.New("not a pcap or pcapng file: too short")
+	}
+	if binary.LittleEndian.Uint32(magic) == 0x0a0d0d0a {
+		cr.next = cr.nextBlock
+		return cr, nil
+	}
+	var hdr [24]byte
+	if _, err := io.ReadFull(cr.r, hdr[:]); err != nil {
+		return nil, errors.New("not a pcap or pcapng file: truncated header")
+	}
+	switch binary.LittleEndian.Uint32(hdr[:]) {
+	case 0xa1b2c3d4:
+		cr.order = binary.LittleEndian
+	case 0xa1b23c4d:
+		cr.order, cr.nano = binary.LittleEndian, true
+	case 0xd4c3b2a1:
+		cr.order = binary.BigEndian
+	case 0x4d3cb2a1:
+		cr.order, cr.nano = binary.BigEndian, true
+	default:
+		return nil, errors.New("not a pcap or pcapng file: unknown magic number")
+	}
+	cr.link = int(cr.order.Uint32(hdr[20:]) & 0x0fffffff)
+	cr.next = cr.nextRecord
+	return cr, nil
+}
+
+// Next returns the next packet, or io.EOF after the last.
+func (r *Reader) Next() (Packet, error) {
+	p, err := r.next()
+	if err == nil {
+		r.number++
+		p.Number = r.number
+	}
+	return p, err
+}
+
+// nextRecord reads a pcap packet record.
+func (r *Reader) nextRecord() (Packet, error) {
+	var hdr [16]byte
+	if _, err := io.ReadFull(r.r, hdr[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return Packet{}, fmt.Errorf("packet %d: truncated record header", r.number+1)
+		}
+		return Packet{}, err
+	}
+	sec, frac := r.order.Uint32(hdr[0:]), r.order.Uint32(hdr[4:])
+	caplen, length := r.order.Uint32(hdr[8:]), r.order.Uint32(hdr[12:])
+	if caplen > MaxPacket {
+		return Packet{}, fmt.Errorf("packet %d: record of %d bytes is larger than %d", r.number+1, caplen, MaxPacket)
+	}
+	data := make([]byte, caplen)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return Packet{}, fmt.Errorf("packet %d: truncated record", r.number+1)
+	}
+	nsec := int64(frac) * 1000
+	if r.nano {
+		nsec = int64(frac)
+	}
+	return Packet{Time: time.Unix(int64(sec), nsec).UTC(), Link: r.link, Data: data, Length: int(length)}, nil
+}
+
+// nextBlock reads pcapng blocks up to the next packet.
+func (r *Reader) nextBlock() (Packet, error) {
+	for {
+		head, err := r.r.Peek(12)
+		if err != nil {
+			if len(head) == 0 {
+				return Packet{}, io.EOF
+			}
+			return Packet{}, errors.New("truncated pcapng block")
+		}
+		if binary.LittleEndian.Uint32(head) == 0x0a0d0d0a {
+			// A section header sets the byte order of the blocks that follow it
+			switch binary.LittleEndian.Uint32(head[8:]) {
+			case 0x1a2b3c4d:
+				r.order = binary.LittleEndian
+			case 0x4d3c2b1a:
+				r.order = binary.BigEndian
+			default:
+				return Packet{}, errors.New("pcapng section header has an unknown byte-order magic")
+			}
+			r.ifaces = nil
+		}
+		kind, total := r.order.Uint32(head), r.order.Uint32(head[4:])
+		if total < 12 || total%4 != 0 || total > MaxPacket+64 {
+			return Packet{}, fmt.Errorf("pcapng block has an invalid length %d", total)
+		}
+		block := make([]byte, total)
+		if _, err := io.ReadFull(r.r, block); err != nil {
+			return Packet{}, errors.New("truncated pcapng block")
+		}
+		body := block[8 : total-4]
+
+		switch kind {
+		case 1: // interface description
+			if len(body) < 8 {
+				return Packet{}, errors.New("pcapng interface block is too short")
+			}
+			ifc := iface{link: int(r.order.Uint16(body)), perSec: 1e6}
+			r.parseOptions(body[8:], func(code uint16, value []byte) {
+				if code == 9 && len(value) == 1 { // if_tsresol
+					ifc.perSec = resolution(value[0])
+				}
+			})
+			r.ifaces = append(r.ifaces, ifc)
+		case 6: // enhanced packet
+			if len(body) < 20 {
+				return Packet{}, errors.New("pcapng packet block is too short")
+			}
+			id := r.order.Uint32(body)
+			if int(id) >= len(r.ifaces) {
+				return Packet{}, fmt.Errorf("pcapng packet block names interface %d, which is not described", id)
+			}
+			ts := uint64(r.order.Uint32(body[4:]))<<32 | uint64(r.order.Uint32(body[8:]))
+			caplen, length := r.order.Uint32(body[12:]), r.order.Uint32(body[16:])
+			if int(caplen) > len(body)-20 {
+				return Packet{}, errors.New("pcapng packet block is shorter than its captured length")
+			}
+			ifc := r.ifaces[id]
+			nsec := ts % ifc.perSec * 1e9 / ifc.perSec
+			return Packet{Time: time.Unix(int64(ts/ifc.perSec), int64(nsec)).UTC(), Link: ifc.link,
+				Data: body[20 : 20+caplen], Length: int(length)}, nil
+		case 3: // simple packet
+			if len(body) < 4 || len(r.ifaces) == 0 {
+				return Packet{}, errors.New("pcapng simple packet block without an interface")
+			}
+			length := int(r.order.Uint32(body))
+			data := body[4:]
+			if length < len(data) {
+				data = data[:length]
+			}
+			return Packet{Link: r.ifaces[0].link, Data: data, Length: length}, nil
+		}
+	}
+}
+
+// parseOptions calls f for each option of a pcapng block.
+func (r *Reader) parseOptions(opts []byte, f func(code uint16, value []byte)) {
+	for len(opts) >= 4 {
+		code, n := r.order.Uint16(opts), int(r.order.Uint16(opts[2:]))
+		if code == 0 || 4+n > len(opts) {
+			return
+		}
+		f(code, opts[4:4+n])
+		opts = opts[4+(n+3)/4*4:]
+	}
+}
+
+// resolution decodes if_tsresol, the units per second of timestamps: a power of ten,
+// or of two when the high bit is set. Resolutions finer than a nanosecond are not
+// supported and read as microseconds.
+func resolution(v byte) uint64 {
+	var perSec uint64 = 1
+	for i := 0; i < int(v&0x7f); i++ {
+		if v&0x80 != 0 {
+			perSec *= 2
+		} else {
+			perSec *= 10
+		}
+	}
+	if perSec == 0 || perSec > 1<<30 {
+		return 1e6
+	}
+	return perSec
+}
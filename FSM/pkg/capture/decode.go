@@ -0,0 +1,281 @@
+package capture
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+)
+
+// EtherTypes of the frames decoded.
+const (
+	EtherIPv4  = 0x0800
+	EtherIPv6  = 0x86dd
+	EtherVLAN  = 0x8100
+	EtherQinQ  = 0x88a8
+	EtherEAPOL = 0x888e
+	EtherLLDP  = 0x88cc
+)
+
+// Frame is a packet's link layer: the EtherType of its payload and, for Ethernet,
+// the addresses. 802.3 frames carry an LLC header instead of an EtherType; with a
+// SNAP header, EtherType is the SNAP protocol id and OUI its organization.
+type Frame struct {
+	Packet
+	Src, Dst  net.HardwareAddr // nil without an Ethernet header
+	EtherType uint16
+	VLAN      int    // innermost 802.1Q VLAN ID, or -1
+	LLC       bool   // an 802.3 frame; without SNAP, EtherType is 0 and Payload starts with the LLC header
+	OUI       uint32 // the SNAP organization of an 802.3 frame
+	Payload   []byte
+}
+
+// DecodeFrame decodes the link header of a packet.
+func DecodeFrame(p Packet) (Frame, error) {
+	f := Frame{Packet: p, VLAN: -1}
+	d := p.Data
+	switch p.Link {
+	case LinkEthernet:
+		if len(d) < 14 {
+			return f, fmt.Errorf("Ethernet header is truncated")
+		}
+		f.Dst, f.Src = net.HardwareAddr(d[0:6]), net.HardwareAddr(d[6:12])
+		f.EtherType, d = binary.BigEndian.Uint16(d[12:]), d[14:]
+		for f.EtherType == EtherVLAN || f.EtherType == EtherQinQ {
+			if len(d) < 4 {
+				return f, fmt.Errorf("802.1Q tag is truncated")
+			}
+			f.VLAN = int(binary.BigEndian.Uint16(d) & 0x0fff)
+			f.EtherType, d = binary.BigEndian.Uint16(d[2:]), d[4:]
+		}
+		if f.EtherType < 0x0600 {
+			// An 802.3 length, which excludes the padding of short frames
+			f.LLC = true
+			if n := int(f.EtherType); n < len(d) {
+				d = d[:n]
+			}
+			f.EtherType = 0
+			if len(d) >= 8 && d[0] == 0xaa && d[1] == 0xaa && d[2] == 0x03 {
+				f.OUI = uint32(d[3])<<16 | uint32(d[4])<<8 | uint32(d[5])
+				f.EtherType, d = binary.BigEndian.Uint16(d[6:]), d[8:]
+			}
+		}
+	case LinkRaw, LinkIPv4, LinkIPv6:
+		if len(d) == 0 {
+			return f, fmt.Errorf("packet is empty")
+		}
+		f.EtherType = EtherIPv4
+		if d[0]>>4 == 6 {
+			f.EtherType = EtherIPv6
+		}
+	case LinkNull:
+		if len(d) < 4 {
+			return f, fmt.Errorf("loopback header is truncated")
+		}
+		// The address family is in the byte order of the capturing host
+		switch binary.LittleEndian.Uint32(d) | binary.BigEndian.Uint32(d) {
+		case 2:
+			f.EtherType = EtherIPv4
+		default:
+			f.EtherType = EtherIPv6 // 24, 28, or 30 depending on the BSD
+		}
+		d = d[4:]
+	case LinkLinuxSLL:
+		if len(d) < 16 {
+			return f, fmt.Errorf("Linux cooked header is truncated")
+		}
+		f.EtherType, d = binary.BigEndian.Uint16(d[14:]), d[16:]
+	case LinkLinuxSLL2:
+		if len(d) < 20 {
+			return f, fmt.Errorf("Linux cooked header is truncated")
+		}
+		f.EtherType, d = binary.BigEndian.Uint16(d[0:]), d[20:]
+	default:
+		return f, fmt.Errorf("link type %d is not supported", p.Link)
+	}
+	f.Payload = d
+	return f, nil
+}
+
+// Protocols of segments.
+const (
+	TCP = 6
+	UDP = 17
+)
+
+// Flow identifies the traffic of one direction of a conversation by its 5-tuple.
+type Flow struct {
+	Proto    int // TCP or UDP
+	Src, Dst netip.AddrPort
+}
+
+// Reverse returns the flow of the other direction.
+func (f Flow) Reverse() Flow { return Flow{Proto: f.Proto, Src: f.Dst, Dst: f.Src} }
+
+func (f Flow) String() string {
+	proto := "udp"
+	if f.Proto == TCP {
+		proto = "tcp"
+	}
+	return fmt.Sprintf("%s %s → %s", proto, f.Src, f.Dst)
+}
+
+// TCP flags.
+const (
+	FIN = 0x01
+	SYN = 0x02
+	RST = 0x04
+	ACK = 0x10
+)
+
+// Segment is a TCP segment or UDP datagram.
+type Segment struct {
+	Packet
+	Flow    Flow
+	Seq     uint32 // TCP only
+	Flags   uint8  // TCP only
+	Payload []byte
+}
+
+// Decode decodes the TCP or UDP segment a packet carries. ok is false for other
+// packets, and for IP fragments after the first, whose ports are unknown.
+func Decode(p Packet) (s Segment, ok bool, err error) {
+	f, err := DecodeFrame(p)
+	if err != nil {
+		return s, false, err
+	}
+	return decodeSegment(f)
+}
+
+// decodeSegment is Decode for a packet whose link header is decoded.
+func decodeSegment(f Frame) (s Segment, ok bool, err error) {
+	s.Packet = f.Packet
+	proto, src, dst, d, ok, err := ipLayer(f)
+	if !ok {
+		return s, false, err
+	}
+
+	switch proto {
+	case TCP:
+		if len(d) < 20 {
+			return s, false, fmt.Errorf("TCP header is truncated")
+		}
+		off := int(d[12]>>4) * 4
+		if off < 20 || off > len(d) {
+			return s, false, fmt.Errorf("TCP data offset %d is invalid", off)
+		}
+		s.Seq, s.Flags = binary.BigEndian.Uint32(d[4:]), d[13]
+		s.Payload = d[off:]
+	case UDP:
+		if len(d) < 8 {
+			return s, false, fmt.Errorf("UDP header is truncated")
+		}
+		if n := int(binary.BigEndian.Uint16(d[4:])); n >= 8 && n < len(d) {
+			d = d[:n]
+		}
+		s.Payload = d[8:]
+	default:
+		return s, false, nil
+	}
+	s.Flow = Flow{Proto: proto,
+		Src: netip.AddrPortFrom(src, binary.BigEndian.Uint16(d[0:])),
+		Dst: netip.AddrPortFrom(dst, binary.BigEndian.Uint16(d[2:]))}
+	return s, true, nil
+}
+
+// ipLayer decodes the IP header of a frame: the protocol it carries, its addresses,
+// and the rest of the packet. ok is false for frames that are not IP, and for IP
+// fragments after the first.
+func ipLayer(f Frame) (proto int, src, dst netip.Addr, d []byte, ok bool, err error) {
+	d = f.Payload
+	if f.OUI != 0 {
+		return 0, src, dst, nil, false, nil // a protocol id of the organization's own
+	}
+	switch f.EtherType {
+	case EtherIPv4:
+		if len(d) < 20 || d[0]>>4 != 4 {
+			return 0, src, dst, nil, false, fmt.Errorf("IPv4 header is truncated or malformed")
+		}
+		ihl := int(d[0]&0x0f) * 4
+		total := int(binary.BigEndian.Uint16(d[2:]))
+		if ihl < 20 || total < ihl || len(d) < ihl {
+			return 0, src, dst, nil, false, fmt.Errorf("IPv4 header lengths are inconsistent")
+		}
+		if binary.BigEndian.Uint16(d[6:])&0x1fff != 0 {
+			return 0, src, dst, nil, false, nil // not the first fragment
+		}
+		if total < len(d) {
+			d = d[:total] // Ethernet padding
+		}
+		proto = int(d[9])
+		src, dst = netip.AddrFrom4([4]byte(d[12:16])), netip.AddrFrom4([4]byte(d[16:20]))
+		d = d[ihl:]
+	case EtherIPv6:
+		if len(d) < 40 || d[0]>>4 != 6 {
+			return 0, src, dst, nil, false, fmt.Errorf("IPv6 header is truncated or malformed")
+		}
+		if n := 40 + int(binary.BigEndian.Uint16(d[4:])); n < len(d) {
+			d = d[:n]
+		}
+		proto = int(d[6])
+		src, dst = netip.AddrFrom16([16]byte(d[8:24])), netip.AddrFrom16([16]byte(d[24:40]))
+		d = d[40:]
+		// Skip the extension headers that may come before TCP or UDP
+		for proto == 0 || proto == 43 || proto == 60 {
+			if len(d) < 8 {
+				return 0, src, dst, nil, false, fmt.Errorf("IPv6 extension header is truncated")
+			}
+			n := (int(d[1]) + 1) * 8
+			if len(d) < n {
+				return 0, src, dst, nil, false, fmt.Errorf("IPv6 extension header is truncated")
+			}
+			proto, d = int(d[0]), d[n:]
+		}
+	default:
+		return 0, src, dst, nil, false, nil
+	}
+	return proto, src, dst, d, true, nil
+}
+
+// Frames reads a capture, passing the link layer of each packet to f in capture
+// order. Packets whose link header cannot be decoded are skipped.
+func Frames(r io.Reader, f func(Frame)) error {
+	cr, err := NewReader(r)
+	if err != nil {
+		return err
+	}
+	for {
+		p, err := cr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fr, err := DecodeFrame(p); err == nil {
+			f(fr)
+		}
+	}
+}
+
+// Segments reads a capture, passing each TCP segment and UDP datagram to f in
+// capture order. Packets that are neither or cannot be decoded are skipped.
+func Segments(r io.Reader, f func(Segment)) error {
+	cr, err := NewReader(r)
+	if err != nil {
+		return err
+	}
+	for {
+		p, err := cr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if s, ok, err := Decode(p); err == nil && ok {
+			f(s)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Filter selects packets with an expression in the syntax of tcpdump's filters
+// (pcap-filter), compiled to a predicate rather than to BPF. It supports the
+// primitives most used to cut a capture down to the traffic of interest:
+//
+//	[src|dst] host ADDR        [src|dst] net PREFIX
+//	[src|dst] port N           [src|dst] portrange N-M
+//	ether [src|dst] [host] MAC vlan [ID]
+//	tcp  udp  icmp  icmp6  ip  ip6  arp
+//
+// joined with and (&&), or (||), not (!), and parentheses. As in tcpdump, "tcp port
+// 80" is "tcp and port 80", "src 10.0.0.1" is "src host 10.0.0.1", and a bare
+// address is a host.
+type Filter struct {
+	expr  string
+	match func(*view) bool
+}
+
+// view is what a filter sees of a packet.
+type view struct {
+	fr           Frame
+	ip           bool
+	proto        int
+	src, dst     netip.Addr
+	ports        bool // TCP or UDP with its ports
+	sport, dport uint16
+}
+
+func newView(fr Frame) *view {
+	v := &view{fr: fr}
+	proto, src, dst, d, ok, _ := ipLayer(fr)
+	if !ok {
+		return v
+	}
+	v.ip, v.proto, v.src, v.dst = true, proto, src, dst
+	if (proto == TCP || proto == UDP) && len(d) >= 4 {
+		v.ports, v.sport, v.dport = true, binary.BigEndian.Uint16(d), binary.BigEndian.Uint16(d[2:])
+	}
+	return v
+}
+
+// ParseFilter compiles a filter expression. The empty expression matches every
+// packet.
+func ParseFilter(expr string) (*Filter, error) {
+	p := &filterParser{tokens: filterTokens(expr)}
+	if len(p.tokens) == 0 {
+		return &Filter{expr: expr, match: func(*view) bool { return true }}, nil
+	}
+	match, err := p.or()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("filter %q: %v", expr, err)
+	}
+	return &Filter{expr: expr, match: match}, nil
+}
+
+func (f *Filter) String() string { return f.expr }
+
+// Match reports whether a packet passes the filter.
+func (f *Filter) Match(fr Frame) bool {
+	return f.match(newView(fr))
+}
+
+func filterTokens(expr string) []string {
+	for _, op := range []string{"(", ")", "!"} {
+		expr = strings.ReplaceAll(expr, op, " "+op+" ")
+	}
+	fields := strings.Fields(expr)
+	for i, t := range fields {
+		switch t {
+		case "&&":
+			fields[i] = "and"
+		case "||":
+			fields[i] = "or"
+		case "!":
+			fields[i] = "not"
+		}
+	}
+	return fields
+}
+
+type filterParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *filterParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *filterParser) next() (string, error) {
+	if p.pos >= len(p.tokens) {
+		return "", fmt.Errorf("expression ends too early")
+	}
+	p.pos++
+	return p.tokens[p.pos-1], nil
+}
+
+func (p *filterParser) or() (func(*view) bool, error) {
+	left, err := p.and()
+	for err == nil && p.peek() == "or" {
+		p.pos++
+		var right func(*view) bool
+		if right, err = p.and(); err == nil {
+			l := left
+			left = func(v *view) bool { return l(v) || right(v) }
+		}
+	}
+	return left, err
+}
+
+func (p *filterParser) and() (func(*view) bool, error) {
+	left, err := p.not()
+	for err == nil && p.peek() == "and" {
+		p.pos++
+		var right func(*view) bool
+		if right, err = p.not(); err == nil {
+			l := left
+			left = func(v *view) bool { return l(v) && right(v) }
+		}
+	}
+	return left, err
+}
+
+func (p *filterParser) not() (func(*view) bool, error) {
+	switch p.peek() {
+	case "not":
+		p.pos++
+		m, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return func(v *view) bool { return !m(v) }, nil
+	case "(":
+		p.pos++
+		m, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if t, err := p.next(); err != nil || t != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		return m, nil
+	}
+	return p.primitive()
+}
+
+// ipProtocols are the protocol primitives matched on the IP header.
+var ipProtocols = map[string]int{"tcp": TCP, "udp": UDP, "icmp": 1, "icmp6": 58}
+
+func (p *filterParser) primitive() (func(*view) bool, error) {
+	t, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if proto, ok := ipProtocols[t]; ok {
+		m := func(v *view) bool { return v.ip && v.proto == proto }
+		switch p.peek() {
+		case "src", "dst", "port", "portrange":
+			// "tcp port 80": the protocol qualifies the port
+			ports, err := p.primitive()
+			if err != nil {
+				return nil, err
+			}
+			return func(v *view) bool { return m(v) && ports(v) }, nil
+		}
+		return m, nil
+	}
+	switch t {
+	case "ip":
+		return func(v *view) bool { return v.fr.EtherType == EtherIPv4 }, nil
+	case "ip6":
+		return func(v *view) bool { return v.fr.EtherType == EtherIPv6 }, nil
+	case "arp":
+		return func(v *view) bool { return v.fr.EtherType == 0x0806 }, nil
+	case "vlan":
+		if id, err := strconv.Atoi(p.peek()); err == nil {
+			p.pos++
+			return func(v *view) bool { return v.fr.VLAN == id }, nil
+		}
+		return func(v *view) bool { return v.fr.VLAN >= 0 }, nil
+	case "ether":
+		return p.ether()
+	}
+
+	dir := ""
+	if t == "src" || t == "dst" {
+		dir = t
+		if t, err = p.next(); err != nil {
+			return nil, err
+		}
+	}
+	switch t {
+	case "host":
+		if t, err = p.next(); err != nil {
+			return nil, err
+		}
+	case "net":
+		s, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("net %q is not an address prefix such as 10.0.0.0/8", s)
+		}
+		prefix = prefix.Masked()
+		return addrMatch(dir, prefix.Contains), nil
+	case "port", "portrange":
+		s, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		lo, hi, ok := portRange(s, t == "portrange")
+		if !ok {
+			return nil, fmt.Errorf("%s %q is not a valid %s", t, s, t)
+		}
+		in := func(port uint16) bool { return port >= lo && port <= hi }
+		return func(v *view) bool {
+			if !v.ports {
+				return false
+			}
+			switch dir {
+			case "src":
+				return in(v.sport)
+			case "dst":
+				return in(v.dport)
+			}
+			return in(v.sport) || in(v.dport)
+		}, nil
+	}
+	// A host: after "host" or a direction, or on its own
+	addr, err := netip.ParseAddr(t)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected %q", t)
+	}
+	return addrMatch(dir, func(a netip.Addr) bool { return a == addr }), nil
+}
+
+// addrMatch matches the source or destination address, or either.
+func addrMatch(dir string, match func(netip.Addr) bool) func(*view) bool {
+	return func(v *view) bool {
+		if !v.ip {
+			return false
+		}
+		switch dir {
+		case "src":
+			return match(v.src)
+		case "dst":
+			return match(v.dst)
+		}
+		return match(v.src) || match(v.dst)
+	}
+}
+
+func portRange(s string, isRange bool) (lo, hi uint16, ok bool) {
+	first, last, found := strings.Cut(s, "-")
+	if found != isRange {
+		return 0, 0, false
+	}
+	if !found {
+		last = first
+	}
+	a, err1 := strconv.ParseUint(first, 10, 16)
+	b, err2 := strconv.ParseUint(last, 10, 16)
+	if err1 != nil || err2 != nil || a > b {
+		return 0, 0, false
+	}
+	return uint16(a), uint16(b), true
+}
+
+// ether parses what follows "ether": [src|dst] [host] MAC.
+func (p *filterParser) ether() (func(*view) bool, error) {
+	dir := ""
+	if t := p.peek(); t == "src" || t == "dst" {
+		dir = t
+		p.pos++
+	}
+	if p.peek() == "host" {
+		p.pos++
+	}
+	s, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	mac, err := net.ParseMAC(s)
+	if err != nil {
+		return nil, fmt.Errorf("ether host %q is not a MAC address", s)
+	}
+	return func(v *view) bool {
+		if v.fr.Src == nil {
+			return false
+		}
+		switch dir {
+		case "src":
+			return bytes.Equal(v.fr.Src, mac)
+		case "dst":
+			return bytes.Equal(v.fr.Dst, mac)
+		}
+		return bytes.Equal(v.fr.Src, mac) || bytes.Equal(v.fr.Dst, mac)
+	}, nil
+}
@@ -0,0 +1,162 @@
+package capture
+
+import (
+	"io"
+)
+
+// Sampler thins out the traffic of a capture before it is validated, so the
+// validators can keep up with a busy link in bounded memory: packets that do not
+// match Filter are skipped, only SampleN of every SampleM flows are kept, and each
+// flow is cut off after MaxFlowPackets packets or MaxFlowBytes payload bytes. Flows
+// are sampled whole, in the order they start, as the validators follow each one's
+// state from its beginning. Stats counts what was kept and what was skipped.
+//
+// A nil Sampler keeps everything.
+type Sampler struct {
+	Filter           *Filter
+	MaxFlowPackets   int // 0 for no limit
+	MaxFlowBytes     int // 0 for no limit
+	SampleN, SampleM int // 0 of 0 keeps every flow
+	Stats            Stats
+
+	flows map[Flow]*flowCount // by the direction first seen
+}
+
+// flowCount is what a Sampler kept of a flow.
+type flowCount struct {
+	sampled        bool
+	capped         bool
+	packets, bytes int
+}
+
+// Stats counts the packets of a capture a Sampler kept and skipped, with their
+// captured bytes.
+type Stats struct {
+	Packets        int `json:"packets"`
+	Bytes          int `json:"bytes"`
+	Kept           int `json:"kept"`
+	KeptBytes      int `json:"kept_bytes"`
+	Filtered       int `json:"filtered"` // did not match the filter
+	FilteredBytes  int `json:"filtered_bytes"`
+	Unsampled      int `json:"unsampled"` // in flows sampling left out
+	UnsampledBytes int `json:"unsampled_bytes"`
+	Capped         int `json:"capped"` // over their flow's caps
+	CappedBytes    int `json:"capped_bytes"`
+	Other          int `json:"other"` // matched the filter, but carry no TCP or UDP flow
+	Flows          int `json:"flows"` // flows that matched the filter
+	SampledFlows   int `json:"sampled_flows"`
+	CappedFlows    int `json:"capped_flows"`
+}
+
+// Active reports whether the sampler leaves anything out.
+func (s *Sampler) Active() bool {
+	return s != nil && (s.Filter != nil || s.MaxFlowPackets > 0 || s.MaxFlowBytes > 0 || s.SampleM > 0)
+}
+
+// keepFrame applies the filter to a frame, counting it.
+func (s *Sampler) keepFrame(fr Frame) bool {
+	s.Stats.Packets++
+	s.Stats.Bytes += len(fr.Data)
+	if s.Filter != nil && !s.Filter.Match(fr) {
+		s.Stats.Filtered++
+		s.Stats.FilteredBytes += len(fr.Data)
+		return false
+	}
+	return true
+}
+
+// keepSegment applies the sampling and caps of seg's flow to a segment that passed
+// the filter, counting it.
+func (s *Sampler) keepSegment(seg Segment) bool {
+	if s.flows == nil {
+		s.flows = map[Flow]*flowCount{}
+	}
+	fc := s.flows[seg.Flow]
+	if fc == nil {
+		fc = s.flows[seg.Flow.Reverse()]
+	}
+	if fc == nil {
+		fc = &flowCount{sampled: s.SampleM == 0 || s.Stats.Flows%s.SampleM < s.SampleN}
+		s.flows[seg.Flow] = fc
+		s.Stats.Flows++
+		if fc.sampled {
+			s.Stats.SampledFlows++
+		}
+	}
+	size := len(seg.Data)
+	switch {
+	case !fc.sampled:
+		s.Stats.Unsampled++
+		s.Stats.UnsampledBytes += size
+		return false
+	case fc.capped, s.MaxFlowPackets > 0 && fc.packets >= s.MaxFlowPackets,
+		s.MaxFlowBytes > 0 && fc.bytes+len(seg.Payload) > s.MaxFlowBytes:
+		if !fc.capped {
+			fc.capped = true
+			s.Stats.CappedFlows++
+		}
+		s.Stats.Capped++
+		s.Stats.CappedBytes += size
+		return false
+	}
+	fc.packets++
+	fc.bytes += len(seg.Payload)
+	s.Stats.Kept++
+	s.Stats.KeptBytes += size
+	return true
+}
+
+// Frames is Frames with the filter applied. Frames have no flows to sample or cap.
+func (s *Sampler) Frames(r io.Reader, f func(Frame)) error {
+	if s == nil {
+		return Frames(r, f)
+	}
+	return Frames(r, func(fr Frame) {
+		if s.keepFrame(fr) {
+			s.Stats.Kept++
+			s.Stats.KeptBytes += len(fr.Data)
+			f(fr)
+		}
+	})
+}
+
+// Segments is Segments with the sampler applied.
+func (s *Sampler) Segments(r io.Reader, f func(Segment)) error {
+	if s == nil {
+		return Segments(r, f)
+	}
+	cr, err := NewReader(r)
+	if err != nil {
+		return err
+	}
+	for {
+		p, err := cr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fr, err := DecodeFrame(p)
+		if err != nil || !s.keepFrame(fr) {
+			continue
+		}
+		seg, ok, err := decodeSegment(fr)
+		if err != nil || !ok {
+			s.Stats.Other++
+			continue
+		}
+		if s.keepSegment(seg) {
+			f(seg)
+		}
+	}
+}
+
+// Conversations is Conversations with the sampler applied.
+func (s *Sampler) Conversations(r io.Reader) ([]*Conversation, error) {
+	a := NewAssembler()
+	if err := s.Segments(r, a.Add); err != nil {
+		return nil, err
+	}
+	return a.Conversations(), nil
+}
@@ -0,0 +1,146 @@
+package capture
+
+import (
+	"io"
+	"sort"
+	"time"
+)
+
+// Conversation is a TCP connection reassembled from a capture.
+type Conversation struct {
+	Flow           Flow // from the client: the side that sent the SYN, or else the first segment
+	Start, End     time.Time
+	Client, Server Stream
+}
+
+// Stream is what one side of a connection sent, in sequence order.
+type Stream struct {
+	Data    []byte
+	Gaps    []int // offsets in Data where bytes missing from the capture were skipped
+	Missing int   // bytes missing from the capture
+	Packets int
+	Marks   []Mark // where the data of each packet starts, to interleave the two sides
+
+	base     uint32 // sequence number of the first byte
+	haveBase bool
+	segments []piece
+}
+
+type piece struct {
+	off    uint32
+	data   []byte
+	number int
+}
+
+// Mark records that the data of a stream from Offset on came in packet Number.
+type Mark struct {
+	Offset, Number int
+}
+
+// Assembler collects TCP segments into conversations.
+type Assembler struct {
+	conns map[Flow]*Conversation // by the client's flow
+	order []*Conversation
+}
+
+// NewAssembler returns an empty assembler.
+func NewAssembler() *Assembler {
+	return &Assembler{conns: map[Flow]*Conversation{}}
+}
+
+// Add adds a segment; UDP segments are ignored.
+func (a *Assembler) Add(s Segment) {
+	if s.Flow.Proto != TCP {
+		return
+	}
+	c, client := a.conns[s.Flow], true
+	if c == nil {
+		if c = a.conns[s.Flow.Reverse()]; c != nil {
+			client = false
+		}
+	}
+	// A SYN on a connection that already had one starts a new connection on the
+	// same ports
+	if c != nil && s.Flags&(SYN|ACK) == SYN && c.Client.haveBase && c.Client.base != s.Seq+1 {
+		delete(a.conns, c.Flow)
+		c = nil
+	}
+	if c == nil {
+		flow := s.Flow
+		if s.Flags&(SYN|ACK) == SYN|ACK {
+			flow, client = flow.Reverse(), false // the SYN itself was not captured
+		}
+		c = &Conversation{Flow: flow, Start: s.Time}
+		a.conns[flow] = c
+		a.order = append(a.order, c)
+	}
+	c.End = s.Time
+
+	st := &c.Server
+	if client {
+		st = &c.Client
+	}
+	st.Packets++
+	if s.Flags&SYN != 0 {
+		st.base, st.haveBase = s.Seq+1, true
+		if len(s.Payload) > 0 {
+			st.segments = append(st.segments, piece{0, s.Payload, s.Number})
+		}
+		return
+	}
+	if len(s.Payload) == 0 {
+		return
+	}
+	if !st.haveBase {
+		st.base, st.haveBase = s.Seq, true
+	}
+	off := s.Seq - st.base
+	if off > 1<<31 {
+		return // before the first byte seen, such as a retransmission
+	}
+	st.segments = append(st.segments, piece{off, s.Payload, s.Number})
+}
+
+// Conversations returns the connections in the order they started, with their
+// streams reassembled. Retransmitted bytes are kept once.
+func (a *Assembler) Conversations() []*Conversation {
+	for _, c := range a.order {
+		c.Client.assemble()
+		c.Server.assemble()
+	}
+	return a.order
+}
+
+func (st *Stream) assemble() {
+	if st.segments == nil {
+		return
+	}
+	sort.SliceStable(st.segments, func(i, j int) bool { return st.segments[i].off < st.segments[j].off })
+	var next uint32
+	for _, p := range st.segments {
+		end := p.off + uint32(len(p.data))
+		if end <= next {
+			continue
+		}
+		if p.off > next {
+			st.Gaps = append(st.Gaps, len(st.Data))
+			st.Missing += int(p.off - next)
+		} else {
+			p.data = p.data[next-p.off:]
+		}
+		st.Marks = append(st.Marks, Mark{len(st.Data), p.number})
+		st.Data = append(st.Data, p.data...)
+		next = end
+	}
+	st.segments = nil
+}
+
+// Conversations reads a capture and reassembles its TCP connections. Packets that
+// are not TCP or cannot be decoded are skipped.
+func Conversations(r io.Reader) ([]*Conversation, error) {
+	a := NewAssembler()
+	if err := Segments(r, a.Add); err != nil {
+		return nil, err
+	}
+	return a.Conversations(), nil
+}
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"config-validator/pkg/automata"
+)
+
+// Document is a config that is validated again after every edit, as in an editor.
+// The FSM and the analysis passes validate each top-level block on its own (see
+// automata.StartsBlock), so a block's findings depend only on its own lines. A
+// Document keeps what the FSM and the passes found in each block of its last
+// validation, and the next validation only runs the blocks whose text changed; the
+// others' results are moved to their new lines. The checks of the passes that
+// compare blocks, such as an ACL applied in one block and defined in another, run
+// on the results of all blocks, and the findings, Stats, and deprecation warnings
+// are those of a full parse. Edits are found by comparing blocks rather than from
+// the edit ranges, so any number of edits, a whole new text, or a file changed
+// outside the editor are all handled alike.
+//
+// A Document is not safe for concurrent use.
+type Document struct {
+	rs     *RuleSet
+	blocks map[string]*block // results by block text
+
+	// Reused and Validated count the blocks of the last validation whose results
+	// were kept, and those that were run.
+	Reused, Validated int
+}
+
+// block is what validating a block found.
+type block struct {
+	fsm    *automata.FSM // a Fork that processed the block's lines
+	passes *passes
+	start  int // line number the block started at
+}
+
+// NewDocument returns a Document validated with the rule set. A rule set is never
+// modified, so after a reload a new Document is needed.
+func (rs *RuleSet) NewDocument() *Document {
+	return &Document{rs: rs}
+}
+
+// RuleSet is the rule set the document is validated with.
+func (d *Document) RuleSet() *RuleSet { return d.rs }
+
+// Validate validates the document's current text and returns its findings, as
+// Parse would.
+func (d *Document) Validate(ctx context.Context, text []byte) ([]automata.Finding, error) {
+	fsm, err := d.rs.parseContext(ctx, bytes.NewReader(text), d)
+	if err != nil {
+		return nil, err
+	}
+	return fsm.Findings, nil
+}
+
+// blockRun feeds the lines of one validation to the FSM and the passes a block at
+// a time.
+type blockRun struct {
+	doc    *Document
+	fsm    *automata.FSM
+	passes *passes           // the passes of the blocks so far
+	next   map[string]*block // the blocks of this validation
+	lines  []string
+	nums   []int // line numbers of the lines, which skip the lines joined onto others
+	start  int   // line number of the first line of the block being read
+}
+
+func (d *Document) begin(fsm *automata.FSM) *blockRun {
+	d.Reused, d.Validated = 0, 0
+	return &blockRun{doc: d, fsm: fsm, passes: &passes{}, next: map[string]*block{}}
+}
+
+// line adds a line, validating the block before it when the line starts a new one.
+func (b *blockRun) line(text string, lineNum int) {
+	if len(b.lines) == 0 || automata.StartsBlock(text) {
+		b.flush()
+		b.start = lineNum
+	}
+	b.lines = append(b.lines, text)
+	b.nums = append(b.nums, lineNum)
+}
+
+// flush validates the block read so far, or reuses what it found.
+func (b *blockRun) flush() {
+	if len(b.lines) == 0 {
+		return
+	}
+	key := strings.Join(b.lines, "\n")
+	if b.nums[len(b.nums)-1]-b.start != len(b.nums)-1 {
+		// Lines were joined: the same text split differently has its findings elsewhere
+		key += fmt.Sprint(relative(b.nums, b.start))
+	}
+	if b.passes.audit.InKey() {
+		// The audit reads the lines of an embedded key differently
+		key = "key\n" + key
+	}
+	blk, ok := b.next[key]
+	if !ok {
+		blk, ok = b.doc.blocks[key]
+	}
+	if ok {
+		b.doc.Reused++
+	} else {
+		b.doc.Validated++
+		blk = &block{fsm: b.fsm.Fork(), passes: b.passes.next(), start: b.start}
+		for i, text := range b.lines {
+			blk.fsm.ProcessLine(text, b.nums[i])
+			blk.passes.line(text, b.nums[i])
+		}
+	}
+	shift := b.start - blk.start
+	b.fsm.Absorb(blk.fsm, shift)
+	b.passes.append(blk.passes, shift)
+	b.next[key] = blk
+	b.lines, b.nums = b.lines[:0], b.nums[:0]
+}
+
+// relative returns line numbers relative to the first line of their block.
+func relative(nums []int, start int) []int {
+	out := make([]int, len(nums))
+	for i, n := range nums {
+		out[i] = n - start
+	}
+	return out
+}
+
+// finish validates the last block, keeps this validation's blocks for the next,
+// and returns the passes of all blocks.
+func (b *blockRun) finish() *passes {
+	b.flush()
+	b.doc.blocks = b.next
+	return b.passes
+}
@@ -1,29 +1,17 @@
 package config
 
 import (
-	"bufio"
 	"fmt"
+	"io"
 	"os"
 
 	"config-validator/pkg/automata"
+	"config-validator/pkg/template"
 )
 
 // ParseFile loads rules, creates a new Finite State Machine (FSM),
 // and processes a configuration file line by line to validate it.
 func ParseFile(inputFile string, rulesFile string) (*automata.FSM, error) {
-	// Load the raw rules from the YAML file.
-	rawRules, err := automata.LoadRules(rulesFile)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load rules from %s: %v", rulesFile, err)
-	}
-
-	// Create a new FSM instance. This now returns an FSM and an error.
-	// This is the section that was corrected to fix the compilation error.
-	fsm, err := automata.NewFSM(rawRules)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create FSM with provided rules: %v", err)
-	}
-
 	// Open the Cisco configuration file for reading.
 	file, err := os.Open(inputFile)
 	if err != nil {
@@ -31,19 +19,42 @@ func ParseFile(inputFile string, rulesFile string) (*automata.FSM, error) {
 	}
 	defer file.Close()
 
-	// Process the file line by line using the FSM.
-	scanner := bufio.NewScanner(file)
-	lineNum := 1
-	for scanner.Scan() {
-		fsm.ProcessLine(scanner.Text(), lineNum)
-		lineNum++
-	}
-
-	// Check for any errors that occurred during the scanning process.
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error reading config file: %v", err)
+	return ParseReader(file, rulesFile)
+}
+
+// Options control which kinds of rule checks may be loaded, and how input is read.
+type Options struct {
+	// Sandboxed refuses Starlark script checks and allows only WASM checks, for servers
+	// that run rule packs they do not trust.
+	Sandboxed bool
+	// Template, when set, renders Jinja2/ERB placeholders in the input before validation.
+	Template *template.Options
+	// MaxLineLength is the length in bytes above which a line is reported. Lines of
+	// any length are read; 0 uses DefaultMaxLineLength and a negative value disables the check.
+	MaxLineLength int
+	// Hardening also reports the settings a config as a whole lacks, such as service
+	// password-encryption or an NTP server (see remediation.Analyzer).
+	Hardening bool
+	// Trace, when set, is called with the explanation of every line the FSM validates
+	// (see automata.FSM.Trace).
+	Trace func(automata.Explanation)
+}
+
+// DefaultMaxLineLength is well above what IOS accepts on one line, so only runaway
+// lines, such as a certificate or banner pasted without line breaks, are reported.
+const DefaultMaxLineLength = 4096
+
+// ParseReader is like ParseFile but reads the configuration from r, which lets
+// configs retrieved from live devices be validated without going through disk.
+func ParseReader(r io.Reader, rulesFile string) (*automata.FSM, error) {
+	return ParseReaderOptions(r, rulesFile, Options{})
+}
+
+// ParseReaderOptions is ParseReader with control over the rule checks that may run.
+func ParseReaderOptions(r io.Reader, rulesFile string, opts Options) (*automata.FSM, error) {
+	rs, err := LoadRuleSet(rulesFile, opts)
+	if err != nil {
+		return nil, err
 	}
-
-	// Return the FSM, which now contains the results of the validation.
-	return fsm, nil
-}
\ No newline at end of file
+	return rs.Parse(r)
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"config-validator/pkg/acl"
+	"config-validator/pkg/addressing"
+	"config-validator/pkg/automata"
+	"config-validator/pkg/interfaces"
+	"config-validator/pkg/remediation"
+	"config-validator/pkg/routing"
+	"config-validator/pkg/security"
+	"config-validator/pkg/vrf"
+)
+
+// passes are the credential hygiene, ACL, addressing, routing, VRF, interface
+// reference, and hardening passes, which look at the same lines as the FSM.
+type passes struct {
+	audit     security.Auditor
+	acls      acl.Analyzer
+	addrs     addressing.Analyzer
+	routes    routing.Analyzer
+	vrfs      vrf.Analyzer
+	ifaces    interfaces.Analyzer
+	hardening remediation.Analyzer
+}
+
+func (p *passes) line(text string, lineNum int) {
+	p.audit.Line(text, lineNum)
+	p.acls.Line(text, lineNum)
+	p.addrs.Line(text, lineNum)
+	p.routes.Line(text, lineNum)
+	p.vrfs.Line(text, lineNum)
+	p.ifaces.Line(text, lineNum)
+	p.hardening.Line(text, lineNum)
+}
+
+// next returns passes for the lines after those p was fed, on their own. Only the
+// audit of an embedded key goes on across blocks (see automata.StartsBlock).
+func (p *passes) next() *passes {
+	return &passes{audit: *p.audit.Next()}
+}
+
+// append adds what block, a next of the passes fed the lines after p's, found, with
+// its line numbers moved by shift, as if p had been fed those lines.
+func (p *passes) append(block *passes, shift int) {
+	p.audit.Append(&block.audit, shift)
+	p.acls.Append(&block.acls, shift)
+	p.addrs.Append(&block.addrs, shift)
+	p.routes.Append(&block.routes, shift)
+	p.vrfs.Append(&block.vrfs, shift)
+	p.ifaces.Append(&block.ifaces, shift)
+	p.hardening.Append(&block.hardening, shift)
+}
+
+// finish runs the checks that need the whole config and adds the findings of every
+// pass to the FSM, redacting the secrets the audit found in the FSM's findings too.
+func (p *passes) finish(fsm *automata.FSM) {
+	for _, f := range p.acls.Finish() {
+		fsm.AddFinding(f)
+	}
+	for _, f := range p.addrs.Finish() {
+		fsm.AddFinding(f)
+	}
+	for _, f := range p.routes.Finish(p.addrs.Prefixes()) {
+		fsm.AddFinding(f)
+	}
+	for _, f := range p.vrfs.Finish() {
+		fsm.AddFinding(f)
+	}
+	for _, f := range p.ifaces.Finish() {
+		fsm.AddFinding(f)
+	}
+	for _, f := range p.hardening.Finish() {
+		fsm.AddFinding(f)
+	}
+	for lineNum, excerpt := range p.audit.Redacted {
+		fsm.RedactLine(lineNum, excerpt)
+	}
+	for _, f := range p.audit.Findings {
+		fsm.AddFinding(f)
+	}
+}
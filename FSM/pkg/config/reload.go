@@ -0,0 +1,162 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Reloader keeps the current RuleSet of a long-running server. A reload loads and
+// dry-runs the new rules before swapping them in, so an invalid update is rejected
+// and validation keeps using the previous set.
+type Reloader struct {
+	resolve func() (string, error) // returns the local rules file, fetching remote packs
+	opts    Options
+
+	current  atomic.Pointer[RuleSet]
+	mu       sync.Mutex // serializes reloads
+	modTimes map[string]time.Time
+
+	reloads   atomic.Int64
+	failures  atomic.Int64
+	lastError atomic.Pointer[string]
+}
+
+// NewReloader loads the initial rule set, which must be valid.
+func NewReloader(resolve func() (string, error), opts Options) (*Reloader, error) {
+	r := &Reloader{resolve: resolve, opts: opts}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Current returns the rule set in use.
+func (r *Reloader) Current() *RuleSet {
+	return r.current.Load()
+}
+
+// Reload resolves, loads, and dry-runs the rules, then swaps them in. On error the
+// current set stays in use.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rs, err := r.load()
+	if err != nil {
+		r.failures.Add(1)
+		msg := err.Error()
+		r.lastError.Store(&msg)
+		return err
+	}
+	r.current.Store(rs)
+	r.modTimes = modTimes(rs.Sources)
+	r.reloads.Add(1)
+	r.lastError.Store(nil)
+	return nil
+}
+
+func (r *Reloader) load() (*RuleSet, error) {
+	rulesFile, err := r.resolve()
+	if err != nil {
+		return nil, err
+	}
+	rs, err := LoadRuleSet(rulesFile, r.opts)
+	if err != nil {
+		return nil, err
+	}
+	// Loading scripts and wasm modules happens per validation; do it once here so a
+	// broken check is caught before the set goes live.
+	if _, err := rs.Parse(strings.NewReader("")); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// Watch reloads whenever one of the current set's files changes, checking every
+// interval until ctx is done.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		r.mu.Lock()
+		changed := !sameModTimes(r.modTimes, modTimes(r.Current().Sources))
+		r.mu.Unlock()
+		if !changed {
+			continue
+		}
+		old := r.Current().Version
+		if err := r.Reload(); err != nil {
+			log.Println("❌ Rules reload rejected, keeping version", old+":", err)
+			// Do not retry the same broken files every tick.
+			r.mu.Lock()
+			r.modTimes = modTimes(r.Current().Sources)
+			r.mu.Unlock()
+			continue
+		}
+		log.Printf("🔄 Rules reloaded: version %s -> %s", old, r.Current().Version)
+	}
+}
+
+// WriteMetrics writes the reload state in the Prometheus text format.
+func (r *Reloader) WriteMetrics(w io.Writer) {
+	rs := r.Current()
+	fmt.Fprintln(w, "# HELP config_validator_rules_info Rule set in use, labelled with its version.")
+	fmt.Fprintln(w, "# TYPE config_validator_rules_info gauge")
+	fmt.Fprintf(w, "config_validator_rules_info{version=%q,file=%q} 1\n", rs.Version, rs.File)
+	fmt.Fprintln(w, "# HELP config_validator_rules_loaded_timestamp_seconds When the rule set in use was loaded.")
+	fmt.Fprintln(w, "# TYPE config_validator_rules_loaded_timestamp_seconds gauge")
+	fmt.Fprintf(w, "config_validator_rules_loaded_timestamp_seconds %d\n", rs.LoadedAt.Unix())
+	fmt.Fprintln(w, "# HELP config_validator_rules_reloads_total Rule reloads by result.")
+	fmt.Fprintln(w, "# TYPE config_validator_rules_reloads_total counter")
+	fmt.Fprintf(w, "config_validator_rules_reloads_total{result=\"success\"} %d\n", r.reloads.Load())
+	fmt.Fprintf(w, "config_validator_rules_reloads_total{result=\"failure\"} %d\n", r.failures.Load())
+	failing := 0
+	if r.lastError.Load() != nil {
+		failing = 1
+	}
+	fmt.Fprintln(w, "# HELP config_validator_rules_last_reload_failed Whether the last reload was rejected.")
+	fmt.Fprintln(w, "# TYPE config_validator_rules_last_reload_failed gauge")
+	fmt.Fprintf(w, "config_validator_rules_last_reload_failed %d\n", failing)
+}
+
+// LastError returns why the last reload was rejected, or "" if it succeeded.
+func (r *Reloader) LastError() string {
+	if msg := r.lastError.Load(); msg != nil {
+		return *msg
+	}
+	return ""
+}
+
+func modTimes(files []string) map[string]time.Time {
+	out := make(map[string]time.Time, len(files))
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			out[file] = info.ModTime()
+		}
+	}
+	return out
+}
+
+func sameModTimes(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for file, t := range a {
+		if !b[file].Equal(t) {
+			return false
+		}
+	}
+	return true
+}
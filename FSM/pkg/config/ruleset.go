@@ -0,0 +1,375 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/bundle"
+	"config-validator/pkg/linereader"
+	"config-validator/pkg/script"
+	"config-validator/pkg/telemetry"
+	"config-validator/pkg/template"
+	"config-validator/pkg/wasm"
+)
+
+// RuleSet is a loaded rules file. It is never modified after loading, so servers can
+// share one between concurrent validations and swap in a new one on reload. Its
+// patterns are compiled once, at load; each Parse is a new run of that machine.
+type RuleSet struct {
+	File     string
+	Version  string // content hash of the rules file and everything it references
+	LoadedAt time.Time
+	Sources  []string // rules files (through extends) plus script and wasm files
+
+	opts    Options
+	rules   map[string][]automata.Rule
+	lines   automata.LineHandling
+	machine *automata.Machine
+	checked bool // whether any rule has a script or wasm check
+}
+
+// LoadRuleSet loads a rules file and checks that its patterns compile and that its
+// checks are allowed under opts. Scripts and wasm modules are loaded by Parse.
+// A compiled bundle is used instead of the YAML when rulesFile is one, or when an
+// up-to-date one sits next to it (see CompileBundle).
+func LoadRuleSet(rulesFile string, opts Options) (*RuleSet, error) {
+	rawRules, lines, sources, version, err := loadBundle(rulesFile)
+	if err != nil {
+		return nil, err
+	}
+	if rawRules == nil {
+		if rawRules, lines, sources, version, err = loadRules(rulesFile); err != nil {
+			return nil, err
+		}
+	}
+
+	checked := false
+	for state, rules := range rawRules {
+		for _, rule := range rules {
+			if rule.Script != "" && opts.Sandboxed {
+				return nil, fmt.Errorf("state %s: script check %s is not allowed in sandboxed mode, use a wasm check", state, rule.Script)
+			}
+			checked = checked || rule.Script != "" || rule.Wasm != ""
+		}
+	}
+	machine, err := automata.Compile(rawRules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create FSM with provided rules: %v", err)
+	}
+	return &RuleSet{File: rulesFile, Version: version, LoadedAt: time.Now(), Sources: sources, opts: opts, rules: rawRules,
+		lines: lines, machine: machine.WithLines(lines), checked: checked}, nil
+}
+
+// CompileBundle resolves a rules file and writes it as a bundle to out, which
+// LoadRuleSet then loads without parsing YAML or resolving `extends`.
+func CompileBundle(rulesFile, out string) error {
+	rawRules, lines, sources, version, err := loadRules(rulesFile)
+	if err != nil {
+		return err
+	}
+	if _, err := automata.Compile(rawRules); err != nil {
+		return fmt.Errorf("failed to create FSM with provided rules: %v", err)
+	}
+	return bundle.Write(out, version, rawRules, lines, sources)
+}
+
+// loadRules loads the rules of a YAML file, how it treats comment and blank lines,
+// the files they come from (including script and wasm files), and their content hash.
+func loadRules(rulesFile string) (map[string][]automata.Rule, automata.LineHandling, []string, string, error) {
+	rf, err := automata.LoadRuleFile(rulesFile)
+	if err != nil {
+		return nil, automata.LineHandling{}, nil, "", fmt.Errorf("failed to load rules from %s: %v", rulesFile, err)
+	}
+	rawRules, sources := rf.Rules, rf.Sources
+	for _, rules := range rawRules {
+		for _, rule := range rules {
+			for _, ref := range []string{rule.Script, rule.Wasm} {
+				if file, _, ok := strings.Cut(ref, ":"); ok && !contains(sources, file) {
+					sources = append(sources, file)
+				}
+			}
+		}
+	}
+	version, err := hashFiles(sources)
+	if err != nil {
+		return nil, automata.LineHandling{}, nil, "", err
+	}
+	return rawRules, rf.Lines, sources, version, nil
+}
+
+// loadBundle loads rulesFile if it is a bundle, or the bundle next to it if there is
+// one that is not older than its sources. It returns nil rules when there is no
+// bundle to use. The bundle itself is added to the sources, so reloaders watch it.
+func loadBundle(rulesFile string) (map[string][]automata.Rule, automata.LineHandling, []string, string, error) {
+	var none automata.LineHandling
+	path := rulesFile
+	if !bundle.IsBundle(rulesFile) {
+		path = bundle.Path(rulesFile)
+		if _, err := os.Stat(path); err != nil {
+			return nil, none, nil, "", nil
+		}
+	}
+	b, err := bundle.Read(path)
+	if err != nil {
+		if path != rulesFile {
+			log.Println("⚠️  Ignoring rules bundle:", err)
+			return nil, none, nil, "", nil
+		}
+		return nil, none, nil, "", err
+	}
+	if changed := b.Stale(); changed != "" {
+		if path != rulesFile {
+			log.Printf("⚠️  Rules bundle %s is older than %s, using the rules file", path, changed)
+			return nil, none, nil, "", nil
+		}
+		log.Printf("⚠️  Rules bundle %s is older than %s", path, changed)
+	}
+	return b.Rules, b.Lines, append(b.Files(), path), b.Version, nil
+}
+
+// Parse validates a configuration read from r against the rule set. Each call gets
+// its own script and wasm state, so Parse is safe for concurrent use.
+func (rs *RuleSet) Parse(r io.Reader) (*automata.FSM, error) {
+	return rs.ParseContext(context.Background(), r)
+}
+
+// ParseContext is Parse as part of the trace in ctx. The validate span it records has
+// a child span per pipeline stage: rule loading, then the time spent reading lines
+// (tokenize), in the FSM (automaton), and in the analysis passes (semantic). Those
+// three run line by line, interleaved, so their spans give each stage's total time.
+func (rs *RuleSet) ParseContext(ctx context.Context, r io.Reader) (*automata.FSM, error) {
+	return rs.parseContext(ctx, r, nil)
+}
+
+// parseContext is ParseContext, validating block by block for doc when it is not nil.
+func (rs *RuleSet) parseContext(ctx context.Context, r io.Reader, doc *Document) (*automata.FSM, error) {
+	ctx, span := telemetry.Start(ctx, "validate")
+	defer span.End()
+	span.SetAttr("validator.rules.version", rs.Version)
+	fsm, err := rs.parse(ctx, r, doc)
+	if doc != nil {
+		span.SetAttr("validator.blocks.reused", doc.Reused)
+		span.SetAttr("validator.blocks.validated", doc.Validated)
+	}
+	span.SetError(err)
+	if fsm != nil {
+		for _, f := range fsm.Findings {
+			severity := f.Severity
+			if severity == "" {
+				severity = automata.SeverityError
+			}
+			telemetry.Add(telemetry.FindingsCounter, "severity", severity, 1)
+		}
+		span.SetAttr("validator.findings", len(fsm.Findings))
+	}
+	return fsm, err
+}
+
+func (rs *RuleSet) parse(ctx context.Context, r io.Reader, doc *Document) (*automata.FSM, error) {
+	_, loadSpan := telemetry.Start(ctx, "rules.load")
+	defer loadSpan.EndStage() // on errors; the span ends before the lines are read otherwise
+	machine := rs.machine
+	if rs.checked {
+		rawRules := make(map[string][]automata.Rule, len(rs.rules))
+		for state, rules := range rs.rules {
+			rawRules[state] = append([]automata.Rule(nil), rules...)
+		}
+
+		// Compile the checks referenced by the rules; they live next to the rules file.
+		// Script and wasm state is not shared between runs, so each run loads its own.
+		dir := filepath.Dir(rs.File)
+		if !rs.opts.Sandboxed {
+			if err := script.NewLoader(dir).Attach(rawRules); err != nil {
+				return nil, fmt.Errorf("failed to load rule scripts: %v", err)
+			}
+		}
+		modules := wasm.NewLoader(dir)
+		defer modules.Close()
+		if err := modules.Attach(rawRules); err != nil {
+			return nil, fmt.Errorf("failed to load rule wasm modules: %v", err)
+		}
+		var err error
+		if machine, err = rs.machine.WithChecks(rawRules); err != nil {
+			return nil, fmt.Errorf("failed to create FSM with provided rules: %v", err)
+		}
+	}
+	fsm := machine.NewRun()
+	fsm.Trace = rs.opts.Trace
+
+	// Process the input line by line using the FSM, with the analysis passes looking at
+	// the same lines.
+	all := &passes{}
+	var tmpl *template.Processor
+	if rs.opts.Template != nil {
+		tmpl = template.NewProcessor(*rs.opts.Template)
+	}
+	// Templates, and checking no forms against the commands set before them, carry
+	// state across blocks, so such documents are not validated block by block
+	var blocks *blockRun
+	if doc != nil && tmpl == nil && rs.lines.Negations != automata.NegationsCheck {
+		blocks = doc.begin(fsm)
+	}
+	maxLen := rs.opts.MaxLineLength
+	if maxLen == 0 {
+		maxLen = DefaultMaxLineLength
+	}
+	loadSpan.EndStage()
+	// The stages are only timed when their spans are exported, as timing every line
+	// is not free.
+	timed := telemetry.Enabled()
+	var tokenize, automaton, semantic time.Duration
+	var mark time.Time
+	lap := func(stage *time.Duration) {
+		now := time.Now()
+		*stage += now.Sub(mark)
+		mark = now
+	}
+	stagesStart := time.Now()
+	mark = stagesStart
+
+	// Commands wrapped over several lines are validated as one, at their first line.
+	scanner := linereader.NewJoiner(linereader.NewScanner(r), rs.lines.Continuation, rs.lines.WrapWidth)
+	for scanner.Scan() {
+		if timed {
+			lap(&tokenize)
+		}
+		text, lineNum := scanner.Text(), scanner.Line()
+		if maxLen > 0 && len(text) > maxLen {
+			fsm.AddFinding(longLine(text, lineNum, maxLen))
+		}
+		if tmpl != nil {
+			// Template control lines are dropped, keeping the original line numbers. Lines
+			// with unresolved placeholders only go through the FSM, as wildcards.
+			line := tmpl.Line(text, lineNum)
+			if line.Skip {
+				continue
+			}
+			if line.Wildcards != nil {
+				fsm.ProcessTemplateLine(line.Text, lineNum, line.Wildcards)
+				if timed {
+					lap(&automaton)
+				}
+				continue
+			}
+			text = line.Text
+		}
+		if blocks != nil {
+			// The automaton and semantic stages of a document are timed together
+			blocks.line(text, lineNum)
+			if timed {
+				lap(&automaton)
+			}
+			continue
+		}
+		fsm.ProcessLine(text, lineNum)
+		if timed {
+			lap(&automaton)
+		}
+		all.line(text, lineNum)
+		if timed {
+			lap(&semantic)
+		}
+	}
+	if blocks != nil {
+		all = blocks.finish()
+	}
+	if timed {
+		lap(&tokenize)
+	}
+
+	// Check for any errors that occurred during the scanning process.
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading config file: %v", err)
+	}
+	fsm.Encoding = scanner.Encoding()
+
+	if tmpl != nil {
+		for _, f := range tmpl.Findings {
+			fsm.AddFinding(f)
+		}
+	}
+	all.hardening.Global = rs.opts.Hardening
+	all.finish(fsm)
+	if timed {
+		lap(&semantic)
+		parent := telemetry.FromContext(ctx)
+		next := telemetry.Stage(parent, "tokenize", stagesStart, tokenize)
+		next = telemetry.Stage(parent, "automaton", next, automaton)
+		telemetry.Stage(parent, "semantic", next, semantic)
+		telemetry.Add(telemetry.LinesCounter, "", "", int64(scanner.End()))
+	}
+
+	// Return the FSM, which now contains the results of the validation.
+	return fsm, nil
+}
+
+// longLine reports a line longer than max bytes, quoting only its start.
+func longLine(text string, lineNum, max int) automata.Finding {
+	excerpt := strings.TrimSpace(text)
+	if len(excerpt) > 40 {
+		excerpt = strings.ToValidUTF8(excerpt[:40], "") + "..."
+	}
+	return automata.Finding{
+		Line:     lineNum,
+		Command:  excerpt,
+		State:    "LINE_LENGTH",
+		Message:  fmt.Sprintf("line '%s' is %d bytes long, over the maximum of %d", excerpt, len(text), max),
+		Severity: automata.SeverityWarning,
+		Code:     "config.long-line",
+	}
+}
+
+// SourceHash is a file a rule set was loaded from and its SHA-256.
+type SourceHash struct {
+	File   string `json:"file"`
+	SHA256 string `json:"sha256"`
+}
+
+// SourceHashes hashes the files the rule set was loaded from, in load order, so a
+// report can name exactly which rules produced it.
+func (rs *RuleSet) SourceHashes() ([]SourceHash, error) {
+	out := make([]SourceHash, 0, len(rs.Sources))
+	for _, file := range rs.Sources {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		out = append(out, SourceHash{File: file, SHA256: hex.EncodeToString(sum[:])})
+	}
+	return out, nil
+}
+
+func hashFiles(files []string) (string, error) {
+	sorted := append([]string(nil), files...)
+	sort.Strings(sorted)
+	h := sha256.New()
+	for _, file := range sorted {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", file, len(data))
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12], nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,402 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/remediation"
+)
+
+// benchConfig is a config of n lines, mostly valid under the base rules, with a few
+// lines for each of the analysis passes to report.
+func benchConfig(n int) string {
+	var b strings.Builder
+	b.WriteString("hostname bench\nservice password-encryption\nntp server 192.0.2.1\n")
+	lines := 3
+	for i := 0; lines < n; i++ {
+		fmt.Fprintf(&b, "interface GigabitEthernet0/%d\n", i)
+		fmt.Fprintf(&b, " ip address 10.%d.%d.1 255.255.255.0\n", i/256%256, i%256)
+		b.WriteString(" duplex full\n speed 1000\n no shutdown\n")
+		fmt.Fprintf(&b, "ip route 172.16.%d.0 255.255.255.0 GigabitEthernet0/%d\n", i%256, i)
+		fmt.Fprintf(&b, "snmp-server location rack-%d\n", i)
+		b.WriteString("line vty 0 4\n login local\n transport input ssh\n")
+		lines += 10
+	}
+	return b.String()
+}
+
+// BenchmarkParse validates a 50k-line config with the base rules and every analysis pass.
+func BenchmarkParse(b *testing.B) {
+	rs, err := LoadRuleSet("../automata/rules.yaml", Options{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	config := benchConfig(50000)
+	b.SetBytes(int64(len(config)))
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := rs.Parse(strings.NewReader(config)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkLoadRuleSet loads and compiles the base rules, as every CLI run does.
+func BenchmarkLoadRuleSet(b *testing.B) {
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := LoadRuleSet("../automata/rules.yaml", Options{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDocumentEdit revalidates a 50k-line config after an edit to one block,
+// as the language server does on every change, to compare with BenchmarkParse.
+func BenchmarkDocumentEdit(b *testing.B) {
+	rs, err := LoadRuleSet("../automata/rules.yaml", Options{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	config := benchConfig(50000)
+	edited := strings.Replace(config, " speed 1000\n", " speed 100\n", 1)
+	doc := rs.NewDocument()
+	if _, err := doc.Validate(context.Background(), []byte(config)); err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(config)))
+	b.ReportAllocs()
+	for i := 0; b.Loop(); i++ {
+		text := config
+		if i%2 == 0 {
+			text = edited
+		}
+		if _, err := doc.Validate(context.Background(), []byte(text)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// vrfConfig uses VRFs in interfaces and BGP address-families. The built-in rules
+// accept every line of it, so the only findings are those of the VRF pass.
+const vrfConfig = `hostname pe1
+service password-encryption
+sntp server 192.0.2.123
+vrf definition RED
+ rd 65000:1
+ route-target both 65000:1
+ address-family ipv4
+ exit-address-family
+!
+vrf definition BLUE
+ address-family ipv4
+ exit-address-family
+!
+interface GigabitEthernet0/1
+ vrf forwarding RED
+ ip address 10.1.1.1 255.255.255.0
+!
+interface GigabitEthernet0/2
+ vrf forwarding GREEN
+ ip address 10.2.1.1 255.255.255.0
+!
+router bgp 65000
+ bgp router-id 1.1.1.1
+ bgp log-neighbor-changes
+ neighbor 192.0.2.1 remote-as 65001
+ !
+ address-family ipv4
+  neighbor 192.0.2.1 activate
+ exit-address-family
+ !
+ address-family ipv4 vrf RED
+  neighbor 10.1.1.2 remote-as 65002
+  neighbor 10.1.1.2 activate
+  neighbor 192.0.2.1 activate
+ exit-address-family
+`
+
+// TestVRFConfig validates vrfConfig against the built-in rules and each role.
+func TestVRFConfig(t *testing.T) {
+	want := []string{
+		"Line 10: [warning] vrf BLUE has no route-distinguisher",
+		"Line 19: [warning] vrf GREEN is not defined",
+		"Line 34: [warning] neighbor 192.0.2.1 is activated in vrf RED, address-family ipv4 unicast, but declared in the global table (line 25)",
+	}
+	for _, rules := range []string{"rules.yaml", "roles/access.yaml", "roles/core.yaml", "roles/edge.yaml"} {
+		rs, err := LoadRuleSet("../automata/"+rules, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fsm, err := rs.Parse(strings.NewReader(vrfConfig))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(fsm.Errors, "\n"); got != strings.Join(want, "\n") {
+			t.Errorf("%s: got findings\n%s\nwant\n%s", rules, got, strings.Join(want, "\n"))
+		}
+	}
+}
+
+// hardeningConfig lacks every hardening setting with a known fix.
+const hardeningConfig = `hostname edge1
+line con 0
+ exec-timeout 0 0
+ logging synchronous
+line vty 0 4
+ login local
+ transport input ssh
+end
+`
+
+// TestHardeningFixes applies the fixes of the hardening findings, in place as the
+// language server does and as a pasted remediation snippet, and validates the result
+// against the built-in rules, which must accept every fix.
+func TestHardeningFixes(t *testing.T) {
+	rs, err := LoadRuleSet("../automata/rules.yaml", Options{Hardening: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsm, err := rs.Parse(strings.NewReader(hardeningConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var codes []string
+	for _, f := range fsm.Findings {
+		codes = append(codes, f.Code)
+	}
+	want := "hardening.exec-timeout-disabled hardening.exec-timeout-missing hardening.password-encryption hardening.ntp"
+	if got := strings.Join(codes, " "); got != want {
+		t.Fatalf("got findings %s, want %s", got, want)
+	}
+	opts := remediation.Options{NTPServer: "192.0.2.123"}
+
+	snippet := remediation.Snippet("edge1", fsm.Findings, opts)
+	fixed, err := rs.Parse(strings.NewReader(snippet))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixed.Errors) > 0 {
+		t.Errorf("the remediation snippet\n%s\nhas findings\n%s", snippet, strings.Join(fixed.Errors, "\n"))
+	}
+
+	config := []byte(hardeningConfig)
+	for range fsm.Findings {
+		current, err := rs.Parse(strings.NewReader(string(config)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(current.Findings) == 0 {
+			break
+		}
+		edit, ok := remediation.EditFor(config, current.Findings[0], opts)
+		if !ok {
+			t.Fatalf("no edit for %s", current.Errors[0])
+		}
+		config = append(config[:edit.Offset:edit.Offset], append([]byte(edit.Text), config[edit.Offset+edit.Length:]...)...)
+	}
+	fixed, err = rs.Parse(strings.NewReader(string(config)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixed.Errors) > 0 {
+		t.Errorf("the fixed config\n%s\nhas findings\n%s", config, strings.Join(fixed.Errors, "\n"))
+	}
+
+	// Without Hardening, the settings of the whole config are not reported.
+	rs, err = LoadRuleSet("../automata/rules.yaml", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fsm, err = rs.Parse(strings.NewReader(hardeningConfig)); err != nil {
+		t.Fatal(err)
+	}
+	if len(fsm.Findings) != 2 {
+		t.Errorf("got findings\n%s\nwant only the exec-timeout ones", strings.Join(fsm.Errors, "\n"))
+	}
+}
+
+// vrfLiteConfig reuses a subnet in two VRFs, as VRF-lite configs do, and overlaps a
+// subnet within one VRF.
+const vrfLiteConfig = `hostname ce1
+vrf definition RED
+ rd 65000:1
+!
+vrf definition BLUE
+ rd 65000:2
+!
+interface GigabitEthernet0/1
+ vrf forwarding RED
+ ip address 10.1.1.1 255.255.255.0
+!
+interface GigabitEthernet0/2
+ ip address 10.1.1.1 255.255.255.0
+ vrf forwarding BLUE
+!
+interface GigabitEthernet0/3
+ vrf forwarding BLUE
+ ip address 10.1.1.129 255.255.255.128
+!
+interface GigabitEthernet0/4
+ ip address 10.1.1.2 255.255.255.0
+`
+
+// TestVRFOverlap checks that subnets only overlap within a VRF, in a full validation
+// and in a document revalidated block by block.
+func TestVRFOverlap(t *testing.T) {
+	want := "18: subnet 10.1.1.128/25 on GigabitEthernet0/3 overlaps 10.1.1.0/24 on GigabitEthernet0/2 (line 13)"
+	rs, err := LoadRuleSet("../automata/rules.yaml", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsm, err := rs.Parse(strings.NewReader(vrfLiteConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := rs.NewDocument()
+	if _, err := doc.Validate(context.Background(), []byte(strings.Replace(vrfLiteConfig, "BLUE", "RED", 1))); err != nil {
+		t.Fatal(err)
+	}
+	incremental, err := doc.Validate(context.Background(), []byte(vrfLiteConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, run := range map[string][]automata.Finding{"full": fsm.Findings, "incremental": incremental} {
+		var overlaps []string
+		for _, f := range run {
+			if f.Code == "addressing.overlap" {
+				overlaps = append(overlaps, fmt.Sprintf("%d: %s", f.Line, f.Message))
+			}
+		}
+		if got := strings.Join(overlaps, "\n"); got != want {
+			t.Errorf("%s: got overlaps\n%s\nwant\n%s", name, got, want)
+		}
+	}
+}
+
+// findingsText lists findings one per line with their code, to compare runs.
+func findingsText(findings []automata.Finding) string {
+	var b strings.Builder
+	for _, f := range findings {
+		fmt.Fprintf(&b, "%d %s %s %s: %s\n", f.Line, f.State, f.Code, f.Severity, f.Message)
+	}
+	return b.String()
+}
+
+// TestParallelParse parses configs concurrently with one RuleSet, and so one compiled
+// Machine, and checks each result against a serial run. Run it with -race.
+func TestParallelParse(t *testing.T) {
+	rs, err := LoadRuleSet("../automata/rules.yaml", Options{Hardening: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	configs := []string{benchConfig(300), vrfConfig, hardeningConfig, vrfLiteConfig}
+	want := make([]string, len(configs))
+	for i, config := range configs {
+		fsm, err := rs.Parse(strings.NewReader(config))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want[i] = findingsText(fsm.Findings)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 2*len(configs); n++ {
+				i := (w + n) % len(configs)
+				fsm, err := rs.Parse(strings.NewReader(configs[i]))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if got := findingsText(fsm.Findings); got != want[i] {
+					t.Errorf("config %d: parallel run found\n%s\nserial run found\n%s", i, got, want[i])
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// editLines are the lines TestDocumentRandomEdits inserts: block starts, lines valid
+// in one state only, comments, findings for each analysis pass, and lines that join
+// or split blocks.
+var editLines = []string{
+	"interface GigabitEthernet0/9",
+	" ip address 10.1.1.1 255.255.255.0",
+	" ip address 10.1.1.129 255.255.255.128",
+	" vrf forwarding BLUE",
+	" ip access-group MISSING in",
+	" shutdown",
+	" frobnicate",
+	"frobnicate",
+	"!",
+	" !",
+	"",
+	"vrf definition GREEN",
+	" rd 65000:3",
+	"line vty 0 4",
+	" exec-timeout 0 0",
+	" transport input telnet",
+	"router bgp 65000",
+	" neighbor 192.0.2.9 remote-as 65009",
+	"service password-encryption",
+	"ntp server 192.0.2.1",
+	"username admin password 0 secret",
+	"end",
+}
+
+// TestDocumentRandomEdits applies random line edits to a config and checks after
+// each that a Document, revalidating only the changed blocks, finds what a full
+// parse of the text finds.
+func TestDocumentRandomEdits(t *testing.T) {
+	rs, err := LoadRuleSet("../automata/rules.yaml", Options{Hardening: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for seed := uint64(1); seed <= 5; seed++ {
+		rng := rand.New(rand.NewPCG(seed, 0))
+		lines := strings.Split(benchConfig(100)+vrfConfig+vrfLiteConfig+hardeningConfig, "\n")
+		doc := rs.NewDocument()
+		for step := 0; step < 60; step++ {
+			for n := rng.IntN(3); n >= 0; n-- {
+				i := rng.IntN(len(lines))
+				switch rng.IntN(4) {
+				case 0:
+					lines[i] = editLines[rng.IntN(len(editLines))]
+				case 1:
+					lines = slices.Insert(lines, i, editLines[rng.IntN(len(editLines))])
+				case 2:
+					lines = slices.Delete(lines, i, i+1)
+				default:
+					lines = slices.Insert(lines, i, lines[rng.IntN(len(lines))])
+				}
+			}
+			text := strings.Join(lines, "\n")
+			incremental, err := doc.Validate(context.Background(), []byte(text))
+			if err != nil {
+				t.Fatal(err)
+			}
+			fsm, err := rs.Parse(strings.NewReader(text))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := findingsText(incremental), findingsText(fsm.Findings); got != want {
+				t.Fatalf("seed %d, step %d: document found\n%s\nfull parse found\n%s", seed, step, got, want)
+			}
+		}
+		if doc.Reused == 0 {
+			t.Errorf("seed %d: the last validation reused no block", seed)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+// Package csvcheck validates CSV files against RFC 4180: quoting, the same number of
+// fields in every row, and optionally a schema of column names and types. The file is
+// read as a stream, one record at a time, by a small state machine over the bytes, so
+// inventories of any size can be checked and findings are reported as rows are read.
+package csvcheck
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"config-validator/pkg/automata"
+)
+
+// State is the state reported in CSV findings.
+const State = "CSV"
+
+// excerptLength is how much of a record a finding shows.
+const excerptLength = 80
+
+// Options control how a CSV file is read and checked.
+type Options struct {
+	Comma    byte    // field delimiter; ',' when zero
+	NoHeader bool    // the first record is data, not column names
+	Schema   *Schema // columns the file must have; nil checks structure only
+}
+
+// parser states, following the RFC 4180 grammar.
+const (
+	fieldStart = iota // at the start of a field
+	unquoted          // in a field without quotes
+	quoted            // in a quoted field
+	quoteSeen         // a quote in a quoted field: the end of the field, or an escaped quote
+)
+
+// record is a record as it is read.
+type record struct {
+	line   int // line it starts on
+	fields []string
+	raw    strings.Builder
+	issues []string // quoting problems, reported once the record is complete
+	open   bool     // a quoted field ran to the end of the file
+}
+
+// checker holds the state carried from one record to the next.
+type checker struct {
+	opts    Options
+	emit    func(automata.Finding)
+	rows    int
+	width   int // fields each record must have; 0 until the first record
+	widthAt int // line of the record that set width
+	columns []*Column
+}
+
+// Check reads a CSV file from r and calls emit for every finding, in the order of the
+// rows. It returns the first error reading r.
+func Check(r io.Reader, opts Options, emit func(automata.Finding)) error {
+	if opts.Comma == 0 {
+		opts.Comma = ','
+	}
+	c := &checker{opts: opts, emit: emit}
+	br := bufio.NewReader(r)
+	line := 1
+	rec := &record{line: line}
+	state := fieldStart
+	var field strings.Builder
+
+	endField := func() {
+		rec.fields = append(rec.fields, field.String())
+		field.Reset()
+	}
+	endRecord := func() {
+		endField()
+		c.record(rec)
+		rec = &record{line: line}
+		state = fieldStart
+	}
+
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		// A CRLF line ending is read as its LF; a bare CR ends a line as well.
+		if b == '\r' {
+			if next, err := br.Peek(1); err == nil && next[0] == '\n' {
+				continue
+			}
+			b = '\n'
+		}
+		if b != '\n' && rec.raw.Len() < excerptLength {
+			rec.raw.WriteByte(b)
+		}
+
+		switch state {
+		case fieldStart, unquoted:
+			switch {
+			case b == '"' && state == fieldStart:
+				state = quoted
+			case b == c.opts.Comma:
+				endField()
+				state = fieldStart
+			case b == '\n':
+				line++
+				endRecord()
+			default:
+				if b == '"' {
+					rec.issue(fmt.Sprintf("quote inside unquoted field %d; quote the whole field and double the quote (\"\")", len(rec.fields)+1))
+				}
+				field.WriteByte(b)
+				state = unquoted
+			}
+		case quoted:
+			if b == '"' {
+				state = quoteSeen
+				continue
+			}
+			if b == '\n' {
+				line++
+			}
+			field.WriteByte(b)
+		case quoteSeen:
+			switch {
+			case b == '"':
+				field.WriteByte('"')
+				state = quoted
+			case b == c.opts.Comma:
+				endField()
+				state = fieldStart
+			case b == '\n':
+				line++
+				endRecord()
+			default:
+				rec.issue(fmt.Sprintf("unexpected %q after the closing quote of field %d; the delimiter or a line end must follow", b, len(rec.fields)+1))
+				field.WriteByte(b)
+				state = unquoted
+			}
+		}
+	}
+
+	// The last record need not end with a line break.
+	if state == quoted {
+		rec.issue(fmt.Sprintf("quoted field %d is not closed before the end of the file", len(rec.fields)+1))
+		rec.open = true
+	}
+	if state != fieldStart || len(rec.fields) > 0 || field.Len() > 0 {
+		endField()
+		c.record(rec)
+	}
+	return nil
+}
+
+func (r *record) issue(msg string) {
+	for _, m := range r.issues {
+		if m == msg {
+			return
+		}
+	}
+	r.issues = append(r.issues, msg)
+}
+
+func (c *checker) add(rec *record, severity, msg string) {
+	c.emit(automata.Finding{
+		Line:     rec.line,
+		Command:  rec.raw.String(),
+		State:    State,
+		Message:  msg,
+		Severity: severity,
+	})
+}
+
+// record checks a complete record.
+func (c *checker) record(rec *record) {
+	if len(rec.fields) == 1 && rec.fields[0] == "" && rec.raw.Len() == 0 {
+		c.add(rec, automata.SeverityWarning, "blank line; RFC 4180 has no empty records")
+		return
+	}
+	c.rows++
+	for _, msg := range rec.issues {
+		c.add(rec, automata.SeverityError, fmt.Sprintf("row %d: %s", c.rows, msg))
+	}
+	if rec.open {
+		return // the rest of the file is in the open field; its fields mean nothing
+	}
+
+	if c.width == 0 {
+		c.width, c.widthAt = len(rec.fields), rec.line
+		if !c.opts.NoHeader {
+			c.header(rec)
+			return
+		}
+		c.columns = c.opts.Schema.positional()
+	} else if len(rec.fields) != c.width {
+		first := "the first row"
+		if !c.opts.NoHeader {
+			first = "the header"
+		}
+		c.add(rec, automata.SeverityError, fmt.Sprintf("row %d has %d fields, expected %d as in %s on line %d",
+			c.rows, len(rec.fields), c.width, first, c.widthAt))
+	}
+
+	for i, col := range c.columns {
+		if col == nil {
+			continue
+		}
+		value := ""
+		if i < len(rec.fields) {
+			value = rec.fields[i]
+		}
+		if msg := col.check(value); msg != "" {
+			c.add(rec, automata.SeverityError, fmt.Sprintf("row %d, column %s: %s", c.rows, col.Name, msg))
+		}
+	}
+}
+
+// header checks the column names and matches them to the schema.
+func (c *checker) header(rec *record) {
+	seen := map[string]int{}
+	for i, name := range rec.fields {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "":
+			c.add(rec, automata.SeverityWarning, fmt.Sprintf("column %d has no name in the header", i+1))
+		case seen[name] > 0:
+			c.add(rec, automata.SeverityError, fmt.Sprintf("column name %q is used by columns %d and %d", name, seen[name], i+1))
+		default:
+			seen[name] = i + 1
+		}
+	}
+	if c.opts.Schema == nil {
+		return
+	}
+
+	c.columns = make([]*Column, len(rec.fields))
+	for i := range c.opts.Schema.Columns {
+		col := &c.opts.Schema.Columns[i]
+		if pos := seen[col.Name]; pos > 0 {
+			c.columns[pos-1] = col
+		} else if col.Required {
+			c.add(rec, automata.SeverityError, fmt.Sprintf("required column %q is missing from the header", col.Name))
+		} else {
+			c.add(rec, automata.SeverityWarning, fmt.Sprintf("column %q of the schema is missing from the header", col.Name))
+		}
+	}
+	if c.opts.Schema.Strict {
+		for i, name := range rec.fields {
+			name = strings.TrimSpace(name)
+			if c.columns[i] == nil && name != "" && seen[name] == i+1 {
+				c.add(rec, automata.SeverityError, fmt.Sprintf("column %q is not in the schema", name))
+			}
+		}
+	}
+}
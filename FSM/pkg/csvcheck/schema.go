@@ -0,0 +1,135 @@
+package csvcheck
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Schema describes the columns of a CSV file. With a header, columns are matched by
+// name; without one, by position.
+type Schema struct {
+	Columns []Column `yaml:"columns"`
+	Strict  bool     `yaml:"strict"` // columns not in the schema are errors
+}
+
+// Column is one column of a schema. Required columns must be in the header and have
+// a value in every row; empty values of other columns are not checked.
+type Column struct {
+	Name     string   `yaml:"name"`
+	Type     string   `yaml:"type"` // string (default), integer, number, boolean, date, ip, cidr, mac
+	Required bool     `yaml:"required"`
+	Values   []string `yaml:"values"`  // allowed values, if set
+	Pattern  string   `yaml:"pattern"` // regular expression the whole value must match, if set
+
+	pattern *regexp.Regexp
+}
+
+var macRe = regexp.MustCompile(`^([0-9A-Fa-f]{2}[:-]){5}[0-9A-Fa-f]{2}$|^([0-9A-Fa-f]{4}\.){2}[0-9A-Fa-f]{4}$`)
+
+// types checks a value of each column type and describes what was expected.
+var types = map[string]func(string) bool{
+	"string":  func(string) bool { return true },
+	"integer": func(v string) bool { _, err := strconv.ParseInt(v, 10, 64); return err == nil },
+	"number":  func(v string) bool { _, err := strconv.ParseFloat(v, 64); return err == nil },
+	"boolean": func(v string) bool {
+		switch strings.ToLower(v) {
+		case "true", "false", "yes", "no", "1", "0":
+			return true
+		}
+		return false
+	},
+	"date": func(v string) bool {
+		if _, err := time.Parse(time.DateOnly, v); err == nil {
+			return true
+		}
+		_, err := time.Parse(time.RFC3339, v)
+		return err == nil
+	},
+	"ip":   func(v string) bool { _, err := netip.ParseAddr(v); return err == nil },
+	"cidr": func(v string) bool { _, err := netip.ParsePrefix(v); return err == nil },
+	"mac":  macRe.MatchString,
+}
+
+var typeNames = map[string]string{
+	"integer": "an integer", "number": "a number", "boolean": "a boolean (true/false, yes/no, 1/0)",
+	"date": "a date (YYYY-MM-DD or RFC 3339)", "ip": "an IP address", "cidr": "a prefix (address/length)",
+	"mac": "a MAC address",
+}
+
+// LoadSchema reads a CSV schema (YAML) and compiles its patterns.
+func LoadSchema(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV schema: %v", err)
+	}
+	var s Schema
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse CSV schema %s: %v", path, err)
+	}
+	if len(s.Columns) == 0 {
+		return nil, fmt.Errorf("CSV schema %s has no columns", path)
+	}
+	for i := range s.Columns {
+		col := &s.Columns[i]
+		if col.Name == "" {
+			return nil, fmt.Errorf("CSV schema %s: column %d needs a name", path, i+1)
+		}
+		if col.Type == "" {
+			col.Type = "string"
+		}
+		if types[col.Type] == nil {
+			return nil, fmt.Errorf("CSV schema %s: column %s has unknown type %q", path, col.Name, col.Type)
+		}
+		if col.Pattern != "" {
+			if col.pattern, err = regexp.Compile("^(?:" + col.Pattern + ")$"); err != nil {
+				return nil, fmt.Errorf("CSV schema %s: column %s: invalid pattern: %v", path, col.Name, err)
+			}
+		}
+	}
+	return &s, nil
+}
+
+// positional returns the schema's columns in order, for a file without a header.
+func (s *Schema) positional() []*Column {
+	if s == nil {
+		return nil
+	}
+	columns := make([]*Column, len(s.Columns))
+	for i := range s.Columns {
+		columns[i] = &s.Columns[i]
+	}
+	return columns
+}
+
+// check returns what is wrong with a value of the column, or "".
+func (col *Column) check(value string) string {
+	if value == "" {
+		if col.Required {
+			return "value is required"
+		}
+		return ""
+	}
+	if !types[col.Type](value) {
+		return fmt.Sprintf("%q is not %s", value, typeNames[col.Type])
+	}
+	if len(col.Values) > 0 {
+		found := false
+		for _, v := range col.Values {
+			found = found || v == value
+		}
+		if !found {
+			return fmt.Sprintf("%q is not one of %s", value, strings.Join(col.Values, ", "))
+		}
+	}
+	if col.pattern != nil && !col.pattern.MatchString(value) {
+		return fmt.Sprintf("%q does not match %s", value, col.Pattern)
+	}
+	return ""
+}
@@ -0,0 +1,31 @@
+// Package demo holds the demo inputs compiled into the binary, which commands
+// validate when they are run without an input file.
+package demo
+
+import (
+	_ "embed"
+	"os"
+)
+
+// Config is a short Cisco config with an invalid IP address, router ID, and VLAN.
+//
+//go:embed sample_config.txt
+var Config []byte
+
+// Name is how reports refer to the demo config.
+const Name = "demo:sample_config.txt"
+
+// WriteConfig writes the demo config to a temporary file, for commands that read
+// their input from disk, and returns its path and a function removing it.
+func WriteConfig() (string, func(), error) {
+	f, err := os.CreateTemp("", "config-validator-demo-*.txt")
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	if _, err := f.Write(Config); err != nil {
+		os.Remove(f.Name())
+		return "", nil, err
+	}
+	return f.Name(), func() { os.Remove(f.Name()) }, nil
+}
@@ -0,0 +1,64 @@
+package device
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Target describes a network device and how to log into it to retrieve its configuration.
+type Target struct {
+	Host       string
+	Port       int
+	Transport  string
+	Username   string
+	Password   string
+	KeyFile    string
+	KnownHosts string
+	Insecure   bool
+	Timeout    time.Duration
+	Path       string // RESTCONF resource path; defaults to the IOS-XE native model
+}
+
+// Fetch retrieves the running configuration of a device using the transport named in the target.
+// The returned config has device banners (e.g. "Building configuration...") stripped so it can
+// be fed straight into the FSM.
+func Fetch(t Target) ([]byte, error) {
+	if t.Host == "" {
+		return nil, fmt.Errorf("no host given")
+	}
+
+	var raw []byte
+	var err error
+	switch t.Transport {
+	case "", "ssh":
+		raw, err = fetchSSH(t)
+	case "netconf":
+		raw, err = fetchNETCONF(t)
+	case "restconf":
+		raw, err = fetchRESTCONF(t)
+	default:
+		return nil, fmt.Errorf("unsupported transport '%s'", t.Transport)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cleanRunningConfig(raw), nil
+}
+
+// cleanRunningConfig removes the preamble that IOS prints before the configuration itself.
+func cleanRunningConfig(raw []byte) []byte {
+	lines := strings.Split(strings.ReplaceAll(string(raw), "\r\n", "\n"), "\n")
+	start := 0
+	for start < len(lines) {
+		line := strings.TrimSpace(lines[start])
+		if line == "" ||
+			strings.HasPrefix(line, "Building configuration") ||
+			strings.HasPrefix(line, "Current configuration") {
+			start++
+			continue
+		}
+		break
+	}
+	return []byte(strings.Join(lines[start:], "\n"))
+}
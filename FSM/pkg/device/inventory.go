@@ -0,0 +1,186 @@
+package device
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Device is a single inventory entry.
+type Device struct {
+	Name        string `yaml:"name"`
+	Host        string `yaml:"host"`
+	Port        int    `yaml:"port"`
+	Transport   string `yaml:"transport"`
+	Vendor      string `yaml:"vendor"`
+	Profile     string `yaml:"profile"`     // rules file used for this device
+	Role        string `yaml:"role"`        // selects roles/<role>.yaml when there is no profile
+	Credentials string `yaml:"credentials"` // name of an entry in Inventory.Credentials
+}
+
+// Credential is a named set of login details that devices refer to by name,
+// so that secrets never have to be written into the inventory itself.
+type Credential struct {
+	Username    string `yaml:"username"`
+	PasswordEnv string `yaml:"password_env"` // environment variable holding the password
+	KeyFile     string `yaml:"key_file"`
+}
+
+// Inventory lists the devices to validate and the credentials they use.
+type Inventory struct {
+	Credentials map[string]Credential `yaml:"credentials"`
+	Devices     []Device              `yaml:"devices"`
+}
+
+// LoadInventory reads an inventory from a YAML file, or from a CSV file when the
+// extension is .csv. CSV inventories have a header row naming the Device fields
+// (name, host, port, transport, vendor, profile, role, credentials).
+func LoadInventory(path string) (*Inventory, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var inv *Inventory
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		inv, err = readCSVInventory(file)
+	} else {
+		inv = &Inventory{}
+		err = yaml.NewDecoder(file).Decode(inv)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inventory %s: %v", path, err)
+	}
+
+	// Each device's config and reports go to a directory named after it, so two names
+	// with the same FileSafeName, even only in case, would overwrite each other's.
+	dirs := map[string]string{}
+	for i, d := range inv.Devices {
+		if d.Host == "" {
+			return nil, fmt.Errorf("inventory %s: device %d has no host", path, i+1)
+		}
+		if d.Name == "" {
+			d.Name = d.Host
+			inv.Devices[i].Name = d.Name
+		}
+		dir := strings.ToLower(FileSafeName(d.Name))
+		if other, ok := dirs[dir]; ok {
+			if other == d.Name {
+				return nil, fmt.Errorf("inventory %s: device %d: duplicate name '%s'", path, i+1, d.Name)
+			}
+			return nil, fmt.Errorf("inventory %s: device %d: name '%s' has the same output directory as '%s'", path, i+1, d.Name, other)
+		}
+		dirs[dir] = d.Name
+	}
+	return inv, nil
+}
+
+// FileSafeName turns a device name or address into something usable as a file name.
+// Path separators become underscores, and so do the dots of "." and "..", which would
+// otherwise name the output directory or its parent.
+func FileSafeName(name string) string {
+	name = strings.NewReplacer(":", "_", "/", "_", "\\", "_").Replace(name)
+	if name == "" || strings.Trim(name, ".") == "" {
+		return strings.Repeat("_", max(len(name), 1))
+	}
+	return name
+}
+
+// LoadCredentials reads a YAML file containing only a `credentials:` map. It is used
+// alongside CSV inventories, which have no place to declare credential sets.
+func LoadCredentials(path string) (map[string]Credential, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var creds struct {
+		Credentials map[string]Credential `yaml:"credentials"`
+	}
+	if err := yaml.Unmarshal(data, &creds); err != nil {
+		return nil, fmt.Errorf("failed to read credentials %s: %v", path, err)
+	}
+	return creds.Credentials, nil
+}
+
+// Target resolves a device's credential reference and returns the Target used to fetch it.
+func (inv *Inventory) Target(d Device) (Target, error) {
+	t := Target{
+		Host:      d.Host,
+		Port:      d.Port,
+		Transport: d.Transport,
+	}
+	if d.Credentials == "" {
+		return t, nil
+	}
+	cred, ok := inv.Credentials[d.Credentials]
+	if !ok {
+		return t, fmt.Errorf("device %s refers to unknown credentials '%s'", d.Name, d.Credentials)
+	}
+	t.Username = cred.Username
+	t.KeyFile = expandHome(cred.KeyFile)
+	if cred.PasswordEnv != "" {
+		t.Password = os.Getenv(cred.PasswordEnv)
+	}
+	return t, nil
+}
+
+func readCSVInventory(r io.Reader) (*Inventory, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return &Inventory{}, nil
+	}
+
+	columns := make(map[string]int)
+	for i, name := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	field := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	inv := &Inventory{}
+	for n, row := range rows[1:] {
+		d := Device{
+			Name:        field(row, "name"),
+			Host:        field(row, "host"),
+			Transport:   field(row, "transport"),
+			Vendor:      field(row, "vendor"),
+			Profile:     field(row, "profile"),
+			Role:        field(row, "role"),
+			Credentials: field(row, "credentials"),
+		}
+		if port := field(row, "port"); port != "" {
+			d.Port, err = strconv.Atoi(port)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: invalid port '%s'", n+2, port)
+			}
+		}
+		inv.Devices = append(inv.Devices, d)
+	}
+	return inv, nil
+}
+
+// expandHome resolves a leading "~/" since inventory paths are not expanded by a shell.
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
@@ -0,0 +1,54 @@
+package device
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// defaultRESTCONFPath is the IOS-XE native model, which holds the whole device config.
+const defaultRESTCONFPath = "/restconf/data/Cisco-IOS-XE-native:native"
+
+// fetchRESTCONF retrieves the running config as YANG XML over RESTCONF and converts it to CLI-like lines.
+func fetchRESTCONF(t Target) ([]byte, error) {
+	port := t.Port
+	if port == 0 {
+		port = 443
+	}
+	path := t.Path
+	if path == "" {
+		path = defaultRESTCONFPath
+	}
+	url := "https://" + net.JoinHostPort(t.Host, strconv.Itoa(port)) + path
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/yang-data+xml")
+	req.SetBasicAuth(t.Username, t.Password)
+
+	client := &http.Client{
+		Timeout: t.Timeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: t.Insecure},
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response from %s: %v", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("RESTCONF request to %s failed: %s", url, resp.Status)
+	}
+	return xmlToCLI(body)
+}
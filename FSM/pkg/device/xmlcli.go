@@ -0,0 +1,137 @@
+package device
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// xmlNode is a minimal element tree used to flatten YANG-modelled XML.
+type xmlNode struct {
+	Name     string
+	Text     string
+	Children []*xmlNode
+}
+
+// xmlToCLI converts YANG-modelled config XML (e.g. Cisco-IOS-XE-native) into CLI-like lines
+// so it can run through the same FSM rules as screen-scraped configs. The conversion is
+// generic rather than model-aware:
+//   - a leaf becomes "<path> <value>", e.g. <hostname>r1</hostname> -> "hostname r1"
+//   - a container whose children are all leaves collapses onto one line
+//   - a list entry keyed by <name> that has nested containers opens an indented block,
+//     e.g. interface/GigabitEthernet[name=1] -> "interface GigabitEthernet1"
+//
+// Rules written for device CLI output may need extending to cover the flattened forms.
+func xmlToCLI(data []byte) ([]byte, error) {
+	root, err := parseXMLTree(data)
+	if err != nil {
+		return nil, fmt.Errorf("malformed config XML: %v", err)
+	}
+
+	// Unwrap model roots so that top-level commands start at column zero.
+	nodes := root.Children
+	for len(nodes) == 1 && isModelRoot(nodes[0].Name) {
+		nodes = nodes[0].Children
+	}
+
+	var out bytes.Buffer
+	for _, n := range nodes {
+		writeCLI(&out, n, nil, "")
+	}
+	return out.Bytes(), nil
+}
+
+func isModelRoot(name string) bool {
+	return name == "data" || name == "config" || name == "native"
+}
+
+// parseXMLTree returns a synthetic root whose children are the document's top-level elements.
+func parseXMLTree(data []byte) (*xmlNode, error) {
+	root := &xmlNode{}
+	stack := []*xmlNode{root}
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{Name: tok.Name.Local}
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			cur := stack[len(stack)-1]
+			cur.Text += strings.TrimSpace(string(tok))
+		}
+	}
+	if len(stack) != 1 {
+		return nil, fmt.Errorf("unexpected end of document")
+	}
+	return root, nil
+}
+
+func writeCLI(out *bytes.Buffer, n *xmlNode, prefix []string, indent string) {
+	words := append(append([]string{}, prefix...), n.Name)
+
+	// Leaf: "<path> <value>" (or just "<path>" for presence leaves like <shutdown/>).
+	if len(n.Children) == 0 {
+		if n.Text != "" {
+			words = append(words, n.Text)
+		}
+		fmt.Fprintf(out, "%s%s\n", indent, strings.Join(words, " "))
+		return
+	}
+
+	allLeaves := true
+	var key string
+	for _, c := range n.Children {
+		if len(c.Children) > 0 {
+			allLeaves = false
+		} else if c.Name == "name" {
+			key = c.Text
+		}
+	}
+
+	// Container of leaves: one line with every leaf name and value.
+	if allLeaves {
+		for _, c := range n.Children {
+			words = append(words, c.Name)
+			if c.Text != "" {
+				words = append(words, c.Text)
+			}
+		}
+		fmt.Fprintf(out, "%s%s\n", indent, strings.Join(words, " "))
+		return
+	}
+
+	// Keyed list entry: open a block, e.g. "interface GigabitEthernet1".
+	if key != "" {
+		header := strings.Join(words, " ")
+		if len(prefix) > 0 && prefix[len(prefix)-1] == "interface" {
+			header += key
+		} else {
+			header += " " + key
+		}
+		fmt.Fprintf(out, "%s%s\n", indent, header)
+		for _, c := range n.Children {
+			if c.Name != "name" {
+				writeCLI(out, c, nil, indent+" ")
+			}
+		}
+		return
+	}
+
+	// Plain container: its name becomes part of every child's command path.
+	for _, c := range n.Children {
+		writeCLI(out, c, words, indent)
+	}
+}
@@ -0,0 +1,161 @@
+package discovery
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/capture"
+)
+
+// CDPState is the state reported in CDP findings.
+const CDPState = "CDP"
+
+// CDP is carried in SNAP frames with Cisco's OUI and this protocol id.
+const (
+	CDPOUI = 0x00000c
+	CDPPID = 0x2000
+)
+
+// cdpAddress is the multicast address CDP is sent to.
+var cdpAddress = net.HardwareAddr{0x01, 0x00, 0x0c, 0xcc, 0xcc, 0xcc}
+
+// CDP TLV types, with the fixed length of the value where there is one.
+const (
+	cdpDeviceID     = 0x01
+	cdpAddresses    = 0x02
+	cdpPortID       = 0x03
+	cdpCapabilities = 0x04
+	cdpNativeVLAN   = 0x0a
+	cdpDuplex       = 0x0b
+)
+
+var cdpNames = map[int]string{
+	cdpDeviceID: "Device ID", cdpAddresses: "Addresses", cdpPortID: "Port ID", cdpCapabilities: "Capabilities",
+	0x05: "Software Version", 0x06: "Platform", 0x09: "VTP Management Domain", cdpNativeVLAN: "Native VLAN",
+	cdpDuplex: "Duplex", 0x16: "Management Addresses",
+}
+
+var cdpLengths = map[int]int{cdpCapabilities: 4, cdpNativeVLAN: 2, cdpDuplex: 1}
+
+func cdpName(t int) string {
+	if name, ok := cdpNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("TLV type %#04x", t)
+}
+
+// IsCDP reports whether a frame carries CDP.
+func IsCDP(fr capture.Frame) bool {
+	return fr.LLC && fr.OUI == CDPOUI && fr.EtherType == CDPPID
+}
+
+// CheckCDP checks a CDP packet, the payload of a SNAP frame with Cisco's OUI and
+// protocol id 0x2000: a version, TTL, and checksum, then TLVs. Offsets in findings
+// count from the start of the CDP packet.
+func CheckCDP(fr capture.Frame) []automata.Finding {
+	var findings []automata.Finding
+	f := frame{where: where(fr), state: CDPState, findings: &findings}
+	if fr.Dst != nil && !bytes.Equal(fr.Dst, cdpAddress) {
+		f.add(0, "", automata.SeverityWarning, "destination %s is not the CDP multicast address", fr.Dst)
+	}
+	d := fr.Payload
+	if len(d) < 4 {
+		f.add(0, "", automata.SeverityError, "CDP header is truncated")
+		return findings
+	}
+	if v := d[0]; v != 1 && v != 2 {
+		f.add(0, "", automata.SeverityError, "CDP version %d is not 1 or 2", v)
+	}
+	if d[1] == 0 {
+		f.add(1, "", automata.SeverityWarning, "TTL 0 makes neighbors drop the advertisement at once")
+	}
+	if !cdpChecksum(d) {
+		f.add(2, "", automata.SeverityError, "checksum %#04x does not match the packet", binary.BigEndian.Uint16(d[2:]))
+	}
+	seen := map[int]bool{}
+	pos := 4
+	for pos < len(d) {
+		if len(d)-pos < 4 {
+			f.add(pos, "", automata.SeverityError, "%d bytes after the last TLV are too few for a TLV header", len(d)-pos)
+			break
+		}
+		typ, length := int(binary.BigEndian.Uint16(d[pos:])), int(binary.BigEndian.Uint16(d[pos+2:]))
+		name := cdpName(typ)
+		if length < 4 || pos+length > len(d) {
+			f.add(pos, name, automata.SeverityError, "%s TLV length %d does not fit the packet", name, length)
+			break
+		}
+		v := d[pos+4 : pos+length]
+		if seen[typ] {
+			f.add(pos, name, automata.SeverityWarning, "more than one %s TLV", name)
+		}
+		seen[typ] = true
+		if want, fixed := cdpLengths[typ]; fixed && len(v) != want {
+			f.add(pos, name, automata.SeverityError, "%s TLV value is %d bytes; it must be %d", name, len(v), want)
+		}
+		if typ == cdpAddresses || typ == 0x16 {
+			if msg := cdpAddressList(v); msg != "" {
+				f.add(pos, name, automata.SeverityError, "%s TLV %s", name, msg)
+			}
+		}
+		if (typ == cdpDeviceID || typ == cdpPortID) && len(v) == 0 {
+			f.add(pos, name, automata.SeverityError, "%s TLV is empty", name)
+		}
+		pos += length
+	}
+	for _, typ := range []int{cdpDeviceID, cdpPortID} {
+		if !seen[typ] {
+			f.add(pos, cdpName(typ), automata.SeverityError, "packet has no %s TLV", cdpName(typ))
+		}
+	}
+	return findings
+}
+
+// cdpAddressList checks an address list: a count, then entries of a protocol type,
+// protocol length, protocol, address length, and address.
+func cdpAddressList(v []byte) string {
+	if len(v) < 4 {
+		return "is too short for an address count"
+	}
+	count := int(binary.BigEndian.Uint32(v))
+	v = v[4:]
+	for i := 0; i < count; i++ {
+		if len(v) < 2 || len(v) < 2+int(v[1])+2 {
+			return fmt.Sprintf("address %d of %d is truncated", i+1, count)
+		}
+		v = v[2+int(v[1]):]
+		n := int(binary.BigEndian.Uint16(v))
+		if len(v) < 2+n {
+			return fmt.Sprintf("address %d of %d is truncated", i+1, count)
+		}
+		v = v[2+n:]
+	}
+	if len(v) > 0 {
+		return fmt.Sprintf("has %d bytes after its %d addresses", len(v), count)
+	}
+	return ""
+}
+
+// cdpChecksum verifies the checksum of a CDP packet, the Internet checksum. Cisco
+// devices sum the last byte of an odd-length packet as the low byte of a word, not
+// the high one, so either way is accepted.
+func cdpChecksum(d []byte) bool {
+	var sum uint32
+	for i := 0; i+1 < len(d); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(d[i:]))
+	}
+	fold := func(sum uint32) bool {
+		for sum>>16 != 0 {
+			sum = sum&0xffff + sum>>16
+		}
+		return sum == 0xffff
+	}
+	if len(d)%2 == 0 {
+		return fold(sum)
+	}
+	last := d[len(d)-1]
+	return fold(sum+uint32(last)<<8) || fold(sum+uint32(last)) || fold(sum+uint32(int32(int8(last))&0xffff))
+}
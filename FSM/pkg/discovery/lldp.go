@@ -0,0 +1,193 @@
+// Package discovery validates the advertisements of link-layer discovery protocols,
+// LLDP (IEEE 802.1AB) and CDP, as captured from the wire. Each frame is a chain of
+// TLVs, checked for the order and presence of the mandatory ones, their lengths,
+// and how the chain ends, since malformed advertisements confuse the tools that
+// build network maps from them.
+package discovery
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/capture"
+)
+
+// LLDPState is the state reported in LLDP findings.
+const LLDPState = "LLDP"
+
+// LLDP TLV types.
+const (
+	lldpEnd          = 0
+	lldpChassisID    = 1
+	lldpPortID       = 2
+	lldpTTL          = 3
+	lldpCapabilities = 7
+	lldpManagement   = 8
+	lldpOrganization = 127
+)
+
+var lldpNames = map[int]string{
+	lldpEnd: "End", lldpChassisID: "Chassis ID", lldpPortID: "Port ID", lldpTTL: "TTL",
+	4: "Port Description", 5: "System Name", 6: "System Description", lldpCapabilities: "System Capabilities",
+	lldpManagement: "Management Address", lldpOrganization: "Organizationally Specific",
+}
+
+// lldpAddresses are the destination addresses of LLDP: nearest bridge, nearest
+// non-TPMR bridge, and nearest customer bridge.
+var lldpAddresses = []net.HardwareAddr{
+	{0x01, 0x80, 0xc2, 0x00, 0x00, 0x0e},
+	{0x01, 0x80, 0xc2, 0x00, 0x00, 0x03},
+	{0x01, 0x80, 0xc2, 0x00, 0x00, 0x00},
+}
+
+// frame is the context of a frame being checked.
+type frame struct {
+	where    string
+	state    string
+	findings *[]automata.Finding
+}
+
+func (f frame) add(offset int, command, severity, format string, args ...any) {
+	*f.findings = append(*f.findings, automata.Finding{Command: command, State: f.state, Severity: severity,
+		Message: fmt.Sprintf("%s: offset %d: %s", f.where, offset, fmt.Sprintf(format, args...))})
+}
+
+// where names a frame in findings by its number and source.
+func where(fr capture.Frame) string {
+	if fr.Src == nil {
+		return fmt.Sprintf("packet %d", fr.Number)
+	}
+	return fmt.Sprintf("packet %d (from %s)", fr.Number, fr.Src)
+}
+
+func lldpName(t int) string {
+	if name, ok := lldpNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("TLV type %d", t)
+}
+
+// CheckLLDP checks an LLDPDU, the payload of a frame of EtherType 0x88cc. Offsets
+// in findings count from the start of the LLDPDU.
+func CheckLLDP(fr capture.Frame) []automata.Finding {
+	var findings []automata.Finding
+	f := frame{where: where(fr), state: LLDPState, findings: &findings}
+	if fr.Dst != nil {
+		known := false
+		for _, a := range lldpAddresses {
+			known = known || bytes.Equal(fr.Dst, a)
+		}
+		if !known {
+			f.add(0, "", automata.SeverityWarning, "destination %s is not an LLDP multicast address, so bridges may forward the frame", fr.Dst)
+		}
+	}
+	d := fr.Payload
+	seen := map[int]bool{}
+	n := 0 // TLVs read
+	for pos := 0; ; n++ {
+		if len(d)-pos < 2 {
+			f.add(pos, "", automata.SeverityError, "LLDPDU ends without an End TLV")
+			return findings
+		}
+		typ, length := int(d[pos]>>1), int(binary.BigEndian.Uint16(d[pos:])&0x1ff)
+		name := lldpName(typ)
+		if len(d)-pos-2 < length {
+			f.add(pos, name, automata.SeverityError, "%s TLV length %d runs past the end of the frame", name, length)
+			return findings
+		}
+		v := d[pos+2 : pos+2+length]
+		// The first three TLVs are Chassis ID, Port ID, and TTL, in that order
+		if n < 3 && typ != n+1 {
+			f.add(pos, name, automata.SeverityError, "%s TLV is where the mandatory %s TLV must be", name, lldpName(n+1))
+			if typ == lldpEnd {
+				return findings
+			}
+		} else if n >= 3 && typ >= lldpChassisID && typ <= lldpTTL {
+			f.add(pos, name, automata.SeverityError, "%s TLV after the mandatory TLVs", name)
+		}
+		if typ >= lldpChassisID && typ <= lldpCapabilities {
+			if seen[typ] {
+				f.add(pos, name, automata.SeverityError, "more than one %s TLV", name)
+			}
+			seen[typ] = true
+		}
+		if msg := lldpValue(typ, v); msg != "" {
+			f.add(pos, name, automata.SeverityError, "%s TLV %s", name, msg)
+		}
+		pos += 2 + length
+		if typ == lldpEnd {
+			if !allZero(d[pos:]) {
+				f.add(pos, "", automata.SeverityWarning, "%d bytes after the End TLV are not padding", len(d)-pos)
+			}
+			return findings
+		}
+	}
+}
+
+// lldpValue checks the value of a TLV, returning what is wrong with it.
+func lldpValue(typ int, v []byte) string {
+	switch typ {
+	case lldpEnd:
+		if len(v) != 0 {
+			return fmt.Sprintf("has length %d; it must be 0", len(v))
+		}
+	case lldpChassisID, lldpPortID:
+		switch {
+		case len(v) < 2 || len(v) > 256:
+			return fmt.Sprintf("length %d is not 2 to 256", len(v))
+		case v[0] == 0 || v[0] > 7:
+			return fmt.Sprintf("subtype %d is reserved", v[0])
+		case v[0] == 4 && typ == lldpChassisID || v[0] == 3 && typ == lldpPortID:
+			if len(v) != 7 {
+				return fmt.Sprintf("MAC address is %d bytes rather than 6", len(v)-1)
+			}
+		}
+	case lldpTTL:
+		if len(v) != 2 {
+			return fmt.Sprintf("has length %d; it must be 2", len(v))
+		}
+	case 4, 5, 6:
+		if len(v) > 255 {
+			return fmt.Sprintf("length %d is over 255", len(v))
+		}
+	case lldpCapabilities:
+		if len(v) != 4 {
+			return fmt.Sprintf("has length %d; it must be 4", len(v))
+		}
+		system, enabled := binary.BigEndian.Uint16(v), binary.BigEndian.Uint16(v[2:])
+		if enabled&^system != 0 {
+			return fmt.Sprintf("enables capabilities %#04x the system does not have (%#04x)", enabled, system)
+		}
+	case lldpManagement:
+		if len(v) < 9 || len(v) > 167 {
+			return fmt.Sprintf("length %d is not 9 to 167", len(v))
+		}
+		addrLen := int(v[0])
+		if addrLen < 2 || addrLen > 32 || 1+addrLen+6 > len(v) {
+			return fmt.Sprintf("address string length %d does not fit the TLV", addrLen)
+		}
+		oidLen := int(v[1+addrLen+5])
+		if 1+addrLen+6+oidLen != len(v) {
+			return fmt.Sprintf("object identifier length %d does not match the TLV length", oidLen)
+		}
+	case lldpOrganization:
+		if len(v) < 4 {
+			return fmt.Sprintf("length %d is too short for an OUI and subtype", len(v))
+		}
+	default:
+		return "type is reserved"
+	}
+	return ""
+}
+
+func allZero(d []byte) bool {
+	for _, b := range d {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
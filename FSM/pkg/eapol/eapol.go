@@ -0,0 +1,301 @@
+// Package eapol validates 802.1X authentication exchanges captured from the wire:
+// the EAPOL frames between a supplicant and an authenticator, and the EAP (RFC
+// 3748) requests and responses they carry. Each supplicant's exchange is a state
+// machine, from EAPOL-Start or the first Request/Identity, through the
+// authentication method's requests and responses, to Success or Failure.
+package eapol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/capture"
+)
+
+// State is the state reported in EAPOL findings.
+const State = "EAPOL"
+
+// EAPOL packet types.
+const (
+	typeEAP    = 0
+	typeStart  = 1
+	typeLogoff = 2
+	typeKey    = 3
+)
+
+var typeNames = map[int]string{
+	typeEAP: "EAP-Packet", typeStart: "EAPOL-Start", typeLogoff: "EAPOL-Logoff", typeKey: "EAPOL-Key",
+	4: "EAPOL-Encapsulated-ASF-Alert", 5: "EAPOL-MKA", 6: "EAPOL-Announcement (Generic)",
+	7: "EAPOL-Announcement (Specific)", 8: "EAPOL-Announcement-Req",
+}
+
+// EAP codes.
+const (
+	codeRequest  = 1
+	codeResponse = 2
+	codeSuccess  = 3
+	codeFailure  = 4
+)
+
+var codeNames = map[int]string{codeRequest: "Request", codeResponse: "Response", codeSuccess: "Success", codeFailure: "Failure", 5: "Initiate", 6: "Finish"}
+
+// EAP method types.
+const (
+	eapIdentity     = 1
+	eapNotification = 2
+	eapNak          = 3
+	eapExpanded     = 254
+)
+
+var methodNames = map[int]string{
+	eapIdentity: "Identity", eapNotification: "Notification", eapNak: "Nak", 4: "MD5-Challenge", 5: "OTP", 6: "GTC",
+	13: "EAP-TLS", 17: "LEAP", 18: "EAP-SIM", 21: "EAP-TTLS", 23: "EAP-AKA", 25: "PEAP", 26: "MSCHAPv2",
+	43: "EAP-FAST", 49: "EAP-IKEv2", 50: "EAP-AKA'", 52: "EAP-PWD", 55: "TEAP", eapExpanded: "Expanded",
+}
+
+func name(names map[int]string, v int) string {
+	if n, ok := names[v]; ok {
+		return n
+	}
+	return fmt.Sprintf("type %d", v)
+}
+
+// exchange is the authentication of one supplicant.
+type exchange struct {
+	supplicant net.HardwareAddr
+	start      string // where it started, for findings at the end
+	request    *eapMessage
+	answered   bool // the last Request has a Response
+	lastID     int  // identifier of the last Response, or -1
+	done       bool // Success, Failure, or Logoff ended it
+	failed     bool
+}
+
+type eapMessage struct {
+	where string
+	code  int
+	id    int
+	typ   int // for Requests and Responses
+	data  []byte
+}
+
+// Checker checks the EAPOL frames of a capture in order.
+type Checker struct {
+	exchanges map[string]*exchange
+	order     []*exchange
+	findings  []automata.Finding
+	Frames    int // EAPOL frames checked
+}
+
+// NewChecker returns a checker with no exchanges seen.
+func NewChecker() *Checker {
+	return &Checker{exchanges: map[string]*exchange{}}
+}
+
+// Exchanges returns the number of supplicants whose exchanges were seen.
+func (c *Checker) Exchanges() int { return len(c.order) }
+
+func (c *Checker) add(where, command, severity, format string, args ...any) {
+	c.findings = append(c.findings, automata.Finding{Command: command, State: State, Severity: severity,
+		Message: fmt.Sprintf("%s: %s", where, fmt.Sprintf(format, args...))})
+}
+
+func (c *Checker) exchange(mac net.HardwareAddr, where string) *exchange {
+	x := c.exchanges[mac.String()]
+	if x == nil || x.done {
+		x = &exchange{supplicant: mac, start: where, lastID: -1}
+		c.exchanges[mac.String()] = x
+		c.order = append(c.order, x)
+	}
+	return x
+}
+
+// Frame checks a frame of EtherType 0x888e.
+func (c *Checker) Frame(fr capture.Frame) {
+	c.Frames++
+	where := fmt.Sprintf("packet %d", fr.Number)
+	if fr.Src != nil {
+		where = fmt.Sprintf("packet %d (%s → %s)", fr.Number, fr.Src, fr.Dst)
+	}
+	d := fr.Payload
+	if len(d) < 4 {
+		c.add(where, "", automata.SeverityError, "EAPOL header is truncated")
+		return
+	}
+	version, typ, length := int(d[0]), int(d[1]), int(binary.BigEndian.Uint16(d[2:]))
+	cmd := name(typeNames, typ)
+	if version < 1 || version > 3 {
+		c.add(where, cmd, automata.SeverityError, "protocol version %d is not 1, 2, or 3", version)
+	}
+	if length > len(d)-4 {
+		c.add(where, cmd, automata.SeverityError, "body length %d is more than the %d bytes in the frame", length, len(d)-4)
+		return
+	}
+	body := d[4 : 4+length] // the rest is padding
+	switch typ {
+	case typeEAP:
+		c.eap(fr, where, body)
+	case typeStart:
+		if length > 0 && version < 3 {
+			c.add(where, cmd, automata.SeverityWarning, "EAPOL-Start has a body of %d bytes, which only version 3 defines", length)
+		}
+		if fr.Src != nil {
+			c.exchange(fr.Src, where)
+		}
+	case typeLogoff:
+		if length > 0 {
+			c.add(where, cmd, automata.SeverityError, "EAPOL-Logoff has a body of %d bytes; it has none", length)
+		}
+		if fr.Src != nil {
+			if x := c.exchanges[fr.Src.String()]; x != nil {
+				x.done = true
+			}
+		}
+	case typeKey:
+		c.key(fr, where, body)
+	default:
+		if _, ok := typeNames[typ]; !ok {
+			c.add(where, cmd, automata.SeverityError, "packet type %d is not defined", typ)
+		}
+	}
+}
+
+// eap checks an EAP packet and follows the supplicant's exchange with it.
+func (c *Checker) eap(fr capture.Frame, where string, body []byte) {
+	if len(body) < 4 {
+		c.add(where, "EAP", automata.SeverityError, "EAP header is truncated")
+		return
+	}
+	m := &eapMessage{where: where, code: int(body[0]), id: int(body[1]), typ: -1}
+	length := int(binary.BigEndian.Uint16(body[2:]))
+	cmd := fmt.Sprintf("EAP %s id %d", name(codeNames, m.code), m.id)
+	switch {
+	case length > len(body):
+		c.add(where, cmd, automata.SeverityError, "EAP length %d is more than the EAPOL body of %d bytes", length, len(body))
+		return
+	case length < 4:
+		c.add(where, cmd, automata.SeverityError, "EAP length %d is shorter than its header", length)
+		return
+	case length < len(body):
+		c.add(where, cmd, automata.SeverityWarning, "EAP length %d is less than the EAPOL body of %d bytes", length, len(body))
+	}
+	body = body[:length]
+	switch m.code {
+	case codeRequest, codeResponse:
+		if length < 5 {
+			c.add(where, cmd, automata.SeverityError, "%s has no type", name(codeNames, m.code))
+			return
+		}
+		m.typ, m.data = int(body[4]), body[5:]
+		cmd += " " + name(methodNames, m.typ)
+	case codeSuccess, codeFailure:
+		if length != 4 {
+			c.add(where, cmd, automata.SeverityError, "%s has length %d; it must be 4", name(codeNames, m.code), length)
+		}
+	case 5, 6:
+		return // EAP re-authentication (RFC 6696), not followed
+	default:
+		c.add(where, cmd, automata.SeverityError, "EAP code %d is not defined", m.code)
+		return
+	}
+	if fr.Src == nil {
+		return // no addresses to tell the supplicant by
+	}
+	switch m.code {
+	case codeRequest:
+		c.eapRequest(c.exchange(fr.Dst, where), m, cmd)
+	case codeResponse:
+		c.eapResponse(c.exchange(fr.Src, where), m, cmd)
+	default:
+		x := c.exchange(fr.Dst, where)
+		if x.lastID < 0 {
+			c.add(where, cmd, automata.SeverityWarning, "%s before any Response from the supplicant", name(codeNames, m.code))
+		} else if m.id != x.lastID {
+			c.add(where, cmd, automata.SeverityWarning, "%s identifier %d does not match the last Response's %d", name(codeNames, m.code), m.id, x.lastID)
+		}
+		x.done, x.failed = true, m.code == codeFailure
+	}
+}
+
+func (c *Checker) eapRequest(x *exchange, m *eapMessage, cmd string) {
+	if m.typ == eapNak {
+		c.add(m.where, cmd, automata.SeverityError, "Nak is only sent in Responses")
+	}
+	if prev := x.request; prev != nil {
+		switch {
+		case !x.answered && m.id == prev.id:
+			// a retransmission
+		case !x.answered:
+			c.add(m.where, cmd, automata.SeverityWarning, "Request %d is sent while Request %d is unanswered", m.id, prev.id)
+		case m.id == prev.id:
+			c.add(m.where, cmd, automata.SeverityError, "new Request reuses identifier %d of the Request already answered", m.id)
+		}
+	}
+	if m.typ == eapIdentity && x.request != nil && x.answered && x.request.typ != eapIdentity {
+		c.add(m.where, cmd, automata.SeverityWarning, "Request/Identity in the middle of an authentication method")
+	}
+	x.request, x.answered = m, false
+}
+
+func (c *Checker) eapResponse(x *exchange, m *eapMessage, cmd string) {
+	req := x.request
+	switch {
+	case req == nil:
+		c.add(m.where, cmd, automata.SeverityError, "Response without a Request from the authenticator")
+	case m.id != req.id:
+		c.add(m.where, cmd, automata.SeverityError, "Response identifier %d does not match the Request's %d", m.id, req.id)
+	case m.typ == eapNak && req.typ < 4:
+		c.add(m.where, cmd, automata.SeverityError, "Nak answers a Request of type %s; only authentication methods may be refused", name(methodNames, req.typ))
+	case m.typ != req.typ && m.typ != eapNak && !(m.typ == eapExpanded && req.typ == eapExpanded):
+		c.add(m.where, cmd, automata.SeverityError, "Response type %s does not match the Request's %s", name(methodNames, m.typ), name(methodNames, req.typ))
+	case x.answered:
+		c.add(m.where, cmd, automata.SeverityWarning, "Request %d is answered again", m.id)
+	}
+	switch m.typ {
+	case eapIdentity:
+		if len(m.data) == 0 {
+			c.add(m.where, cmd, automata.SeverityWarning, "Response/Identity is empty")
+		}
+	case eapNak:
+		if len(m.data) == 0 {
+			c.add(m.where, cmd, automata.SeverityError, "Nak lists no desired methods; 0 stands for none")
+		}
+		for _, t := range m.data {
+			if t != 0 && t < 4 {
+				c.add(m.where, cmd, automata.SeverityError, "Nak proposes %s, which is not an authentication method", name(methodNames, int(t)))
+			}
+		}
+	}
+	x.answered, x.lastID = true, m.id
+}
+
+// key checks an EAPOL-Key frame's descriptor type. Keys follow a successful
+// authentication, unless the network uses a pre-shared key and no EAP at all.
+func (c *Checker) key(fr capture.Frame, where string, body []byte) {
+	if len(body) < 1 {
+		c.add(where, "EAPOL-Key", automata.SeverityError, "EAPOL-Key has no descriptor type")
+		return
+	}
+	switch t := body[0]; t {
+	case 1, 2, 254:
+	default:
+		c.add(where, "EAPOL-Key", automata.SeverityError, "key descriptor type %d is not RC4 (1), IEEE 802.11 (2), or WPA (254)", t)
+	}
+	for _, mac := range []net.HardwareAddr{fr.Src, fr.Dst} {
+		if x := c.exchanges[mac.String()]; mac != nil && x != nil && x.failed {
+			c.add(where, "EAPOL-Key", automata.SeverityError, "EAPOL-Key after the authentication of %s failed", mac)
+		}
+	}
+}
+
+// Close checks the exchanges that never ended, and returns the findings.
+func (c *Checker) Close() []automata.Finding {
+	for _, x := range c.order {
+		if !x.done {
+			c.add(x.start, "", automata.SeverityWarning, "authentication of %s does not end with Success or Failure in the capture", x.supplicant)
+		}
+	}
+	return c.findings
+}
@@ -0,0 +1,236 @@
+package fleet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/baseline"
+	"config-validator/pkg/config"
+	"config-validator/pkg/device"
+	"config-validator/pkg/i18n"
+	"config-validator/pkg/ignore"
+	"config-validator/pkg/ownership"
+	"config-validator/pkg/progress"
+	"config-validator/pkg/remediation"
+	"config-validator/pkg/seal"
+	"config-validator/pkg/validation"
+)
+
+// Options control how a fleet run fetches and validates devices.
+type Options struct {
+	RulesFile  string // base rules for devices without a profile; roles resolve next to it
+	OutDir     string // each device gets its own subdirectory for config and report
+	Workers    int
+	Timeout    time.Duration
+	KnownHosts string
+	Insecure   bool
+	Sandboxed  bool // only allow WASM rule checks, see config.Options
+	Hardening  bool // also report the settings a config as a whole lacks, see config.Options
+	// Rules, when set, is the already loaded RulesFile, e.g. the daemon's hot-reloaded
+	// set. The role and profile rules are loaded once per run either way.
+	Rules *config.RuleSet
+	// Remediation fills in the per-device remediation snippets.
+	Remediation remediation.Options
+	// Messages, when set, localizes the findings of the reports.
+	Messages *i18n.Catalog
+	// Progress, when set, counts the devices as they finish.
+	Progress *progress.Reporter
+	// Baseline, when set, leaves the findings it records for a device, by name, out of
+	// the device's report, remediation snippet, and score.
+	Baseline *baseline.Baseline
+	// Owners, when set, annotates the findings with their owner, by device name.
+	Owners *ownership.Map
+	// Redact, when set, masks its matches in the findings, see validation.Redact.
+	Redact *regexp.Regexp
+	// Ignore, when set, drops the findings its rule entries exclude for a device, by
+	// name, from the device's report, remediation snippet, and score.
+	Ignore *ignore.Matcher
+	// Sealer, when set, signs and encrypts every file saved for a device, see pkg/seal.
+	Sealer *seal.Sealer
+}
+
+// Run fetches and validates every device in the inventory concurrently and
+// returns the per-device results in inventory order.
+func Run(inv *device.Inventory, opts Options) []validation.DeviceResult {
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	rules := &ruleSets{base: opts.Rules, baseFile: opts.RulesFile, options: config.Options{Sandboxed: opts.Sandboxed, Hardening: opts.Hardening}, sets: map[string]*ruleSet{}}
+	results := make([]validation.DeviceResult, len(inv.Devices))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = validateDevice(inv, inv.Devices[i], opts, rules)
+				opts.Progress.Done(len(results[i].Errors))
+			}
+		}()
+	}
+	for i := range inv.Devices {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// ruleSets loads each rules file of a run, the base rules, a role's, or a profile,
+// once for all the devices that use it. A rule set is safe for concurrent use.
+type ruleSets struct {
+	base     *config.RuleSet // Options.Rules, already loaded from baseFile
+	baseFile string
+	options  config.Options
+	mu       sync.Mutex
+	sets     map[string]*ruleSet
+}
+
+type ruleSet struct {
+	once sync.Once
+	rs   *config.RuleSet
+	err  error
+}
+
+// get returns the rule set of a rules file, loading it the first time. A file that
+// fails to load fails every device using it, with the same error.
+func (r *ruleSets) get(file string) (*config.RuleSet, error) {
+	if r.base != nil && file == r.baseFile {
+		return r.base, nil
+	}
+	r.mu.Lock()
+	set, ok := r.sets[file]
+	if !ok {
+		set = &ruleSet{}
+		r.sets[file] = set
+	}
+	r.mu.Unlock()
+	set.once.Do(func() {
+		set.rs, set.err = config.LoadRuleSet(file, r.options)
+	})
+	return set.rs, set.err
+}
+
+// validateDevice fetches, stores, and validates a single device.
+func validateDevice(inv *device.Inventory, d device.Device, opts Options, rules *ruleSets) validation.DeviceResult {
+	result := validation.DeviceResult{
+		Name:   d.Name,
+		Host:   d.Host,
+		Vendor: d.Vendor,
+	}
+
+	target, err := inv.Target(d)
+	if err != nil {
+		result.Status = "unreachable"
+		result.Error = err.Error()
+		return result
+	}
+	target.Timeout = opts.Timeout
+	target.KnownHosts = opts.KnownHosts
+	target.Insecure = opts.Insecure
+
+	running, err := device.Fetch(target)
+	if err != nil {
+		result.Status = "unreachable"
+		result.Error = err.Error()
+		return result
+	}
+
+	dir := filepath.Join(opts.OutDir, device.FileSafeName(d.Name))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		result.Status = "failed"
+		result.Error = err.Error()
+		return result
+	}
+	result.ConfigFile = filepath.Join(dir, "running-config.txt")
+	sum := sha256.Sum256(running)
+	result.ConfigSHA256 = hex.EncodeToString(sum[:])
+	// Running configs hold secrets, so only the owner may read them
+	if err := opts.Sealer.WriteFile(result.ConfigFile, running, 0600); err != nil {
+		result.Status = "failed"
+		result.Error = err.Error()
+		return result
+	}
+
+	rulesFile := d.Profile
+	if rulesFile == "" {
+		rulesFile = automata.RoleRules(opts.RulesFile, d.Role)
+	}
+	result.RulesFile = rulesFile
+	rs, err := rules.get(rulesFile)
+	if err != nil {
+		result.Status = "failed"
+		result.Error = err.Error()
+		return result
+	}
+	fsm, err := rs.Parse(bytes.NewReader(running))
+	if err != nil {
+		result.Status = "failed"
+		result.Error = err.Error()
+		return result
+	}
+
+	if opts.Messages != nil {
+		opts.Messages.LocalizeFSM(fsm)
+	}
+	validation.RedactFSM(fsm, opts.Redact)
+	if opts.Ignore != nil {
+		fsm.Findings = opts.Ignore.Filter(d.Name, fsm.Findings)
+		fsm.Errors = validation.FormatFindings(fsm.Findings)
+	}
+	// Baseline findings are matched after localization, as most are matched by code
+	if opts.Baseline != nil {
+		fresh, resolved := opts.Baseline.Compare(d.Name, fsm.Findings)
+		result.Baselined = len(fsm.Findings) - len(fresh)
+		fsm.Findings, fsm.Errors = fresh, validation.FormatFindings(fresh)
+		for _, e := range resolved {
+			result.Resolved = append(result.Resolved, e.String())
+		}
+	}
+	opts.Owners.Annotate(d.Name, fsm.Findings)
+	result.Owners = validation.FindingsByOwner(fsm.Findings)
+	result.ReportFile = filepath.Join(dir, "report.json")
+	data, err := validation.ReportJSON(fsm)
+	if err == nil {
+		err = opts.Sealer.WriteFile(result.ReportFile, data, 0644)
+	}
+	if err != nil {
+		result.Status = "failed"
+		result.Error = err.Error()
+		return result
+	}
+
+	fixFile := remediation.File(result.ReportFile)
+	written, err := remediation.Write(fixFile, d.Name, fsm.Findings, opts.Remediation, opts.Sealer)
+	if err != nil {
+		result.Status = "failed"
+		result.Error = err.Error()
+		return result
+	}
+	if written {
+		result.RemediationFile = fixFile
+	}
+
+	result.Errors = fsm.Errors
+	result.Findings = fsm.Findings
+	score := validation.Score(fsm.Findings)
+	result.Score, result.Grade = &score, validation.Grade(score)
+	result.Stats = fsm.Stats()
+	if len(fsm.Errors) == 0 {
+		result.Status = "success"
+	} else {
+		result.Status = "failed"
+	}
+	return result
+}
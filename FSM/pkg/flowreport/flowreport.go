@@ -0,0 +1,258 @@
+// Package flowreport builds the report of a validation driven by captured traffic.
+// The report for a config or document file is one list of findings for the file;
+// a capture holds many flows, so here findings are grouped by flow (its 5-tuple
+// and when it was seen), each flow's by layer (the transport, then the protocol
+// validated), and each layer's by the packet they are about, with a summary of
+// the flows that were valid and those that failed.
+package flowreport
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/capture"
+)
+
+// Flow statuses.
+const (
+	StatusValid  = "valid"
+	StatusFailed = "failed"
+)
+
+// Report is the JSON report of a capture, by flow.
+type Report struct {
+	Kind      string    `json:"kind"` // the subcommand that validated the capture, e.g. "ssh"
+	File      string    `json:"file"`
+	Generated time.Time `json:"generated"`
+	Summary   Summary   `json:"summary"`
+	Flows     []*Flow   `json:"flows"`
+	// Unattributed are the findings about no flow of the capture.
+	Unattributed []automata.Finding `json:"unattributed,omitempty"`
+	// Sampling counts the traffic validated and skipped when the capture was
+	// filtered, sampled, or capped.
+	Sampling *capture.Stats `json:"sampling,omitempty"`
+}
+
+// Summary counts the flows validated and their findings.
+type Summary struct {
+	Flows    int `json:"flows"`
+	Valid    int `json:"valid"`
+	Failed   int `json:"failed"`
+	Findings int `json:"findings"`
+}
+
+// Flow is a connection or an exchange of datagrams, both directions of a 5-tuple.
+type Flow struct {
+	Proto   string    `json:"proto"`  // tcp or udp
+	Client  string    `json:"client"` // address and port of the side that opened the flow, or sent first
+	Server  string    `json:"server"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Packets int       `json:"packets"`
+	Bytes   int       `json:"bytes"`  // payload bytes, both directions
+	Status  string    `json:"status"` // StatusFailed when the flow has findings
+	Layers  []*Layer  `json:"layers,omitempty"`
+
+	layers map[string]*Layer
+}
+
+// Layer holds the findings about a flow at one layer, such as "tcp" for missing
+// bytes or "ssh" for the protocol validated.
+type Layer struct {
+	Name     string             `json:"name"`
+	Findings []automata.Finding `json:"findings,omitempty"` // about the layer of the flow as a whole
+	Messages []*Message         `json:"messages,omitempty"`
+
+	messages map[int]*Message
+}
+
+// Message holds the findings about one packet of a flow.
+type Message struct {
+	Packet   int                `json:"packet"`
+	Side     string             `json:"side"` // client or server
+	Findings []automata.Finding `json:"findings"`
+}
+
+// Builder collects the flows of a capture and the findings about them. A nil
+// Builder ignores everything, so callers need not check whether a report was asked
+// for.
+type Builder struct {
+	kind, file   string
+	flows        map[capture.Flow]*Flow // by the client's direction
+	order        []*Flow
+	packets      map[int]packet // by packet number
+	unattributed []automata.Finding
+}
+
+// packet is where a packet of the capture belongs.
+type packet struct {
+	flow   *Flow
+	client bool // sent by the client
+}
+
+// NewBuilder returns a builder for the report of kind's validation of file.
+func NewBuilder(kind, file string) *Builder {
+	return &Builder{kind: kind, file: file, flows: map[capture.Flow]*Flow{}, packets: map[int]packet{}}
+}
+
+// flow returns the flow of either direction of f, adding it when it is new, and
+// whether f is the client's direction.
+func (b *Builder) flow(f capture.Flow) (*Flow, bool) {
+	if fl := b.flows[f]; fl != nil {
+		return fl, true
+	}
+	if fl := b.flows[f.Reverse()]; fl != nil {
+		return fl, false
+	}
+	proto := "udp"
+	if f.Proto == capture.TCP {
+		proto = "tcp"
+	}
+	fl := &Flow{Proto: proto, Client: f.Src.String(), Server: f.Dst.String(), layers: map[string]*Layer{}}
+	b.flows[f] = fl
+	b.order = append(b.order, fl)
+	return fl, true
+}
+
+// seen widens the time a flow was seen to include t.
+func (fl *Flow) seen(t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	if fl.Start.IsZero() || t.Before(fl.Start) {
+		fl.Start = t
+	}
+	if t.After(fl.End) {
+		fl.End = t
+	}
+}
+
+// Conversation adds a reassembled TCP connection, with the packets that carried
+// its data.
+func (b *Builder) Conversation(c *capture.Conversation) {
+	if b == nil {
+		return
+	}
+	fl, client := b.flow(c.Flow)
+	fl.seen(c.Start)
+	fl.seen(c.End)
+	fl.Packets += c.Client.Packets + c.Server.Packets
+	fl.Bytes += len(c.Client.Data) + len(c.Server.Data)
+	for _, m := range c.Client.Marks {
+		b.packets[m.Number] = packet{flow: fl, client: client}
+	}
+	for _, m := range c.Server.Marks {
+		b.packets[m.Number] = packet{flow: fl, client: !client}
+	}
+}
+
+// Segment adds a TCP segment or UDP datagram to its flow. fromClient says whether
+// the client sent it, which orients the flow when the segment is its first.
+func (b *Builder) Segment(s capture.Segment, fromClient bool) {
+	if b == nil {
+		return
+	}
+	f := s.Flow
+	if !fromClient {
+		f = f.Reverse()
+	}
+	fl, _ := b.flow(f)
+	client := b.flows[s.Flow] == fl
+	fl.seen(s.Time)
+	fl.Packets++
+	fl.Bytes += len(s.Payload)
+	b.packets[s.Number] = packet{flow: fl, client: client}
+}
+
+// Add adds findings about a flow, given in either direction, at a layer.
+func (b *Builder) Add(f capture.Flow, layer string, findings []automata.Finding) {
+	if b == nil {
+		return
+	}
+	fl, _ := b.flow(f)
+	for _, finding := range findings {
+		b.add(fl, layer, finding)
+	}
+}
+
+// AddPackets adds findings at a layer to the flows of the packets they are about.
+// Findings about no packet of a flow are unattributed.
+func (b *Builder) AddPackets(layer string, findings []automata.Finding) {
+	if b == nil {
+		return
+	}
+	for _, finding := range findings {
+		if p, ok := b.packets[finding.Packet]; ok && finding.Packet > 0 {
+			b.add(p.flow, layer, finding)
+		} else {
+			b.unattributed = append(b.unattributed, finding)
+		}
+	}
+}
+
+func (b *Builder) add(fl *Flow, name string, finding automata.Finding) {
+	l := fl.layers[name]
+	if l == nil {
+		l = &Layer{Name: name, messages: map[int]*Message{}}
+		fl.layers[name] = l
+		fl.Layers = append(fl.Layers, l)
+	}
+	if finding.Packet == 0 {
+		l.Findings = append(l.Findings, finding)
+		return
+	}
+	m := l.messages[finding.Packet]
+	if m == nil {
+		m = &Message{Packet: finding.Packet, Side: "server"}
+		if p, ok := b.packets[finding.Packet]; !ok || p.client {
+			m.Side = "client"
+		}
+		l.messages[finding.Packet] = m
+		l.Messages = append(l.Messages, m)
+	}
+	m.Findings = append(m.Findings, finding)
+}
+
+// Report returns the report of the flows added so far.
+func (b *Builder) Report() *Report {
+	r := &Report{Kind: b.kind, File: b.file, Generated: time.Now().UTC(), Flows: b.order, Unattributed: b.unattributed}
+	if r.Flows == nil {
+		r.Flows = []*Flow{}
+	}
+	for _, fl := range b.order {
+		n := 0
+		for _, l := range fl.Layers {
+			sort.Slice(l.Messages, func(i, j int) bool { return l.Messages[i].Packet < l.Messages[j].Packet })
+			n += len(l.Findings)
+			for _, m := range l.Messages {
+				n += len(m.Findings)
+			}
+		}
+		if n > 0 {
+			fl.Status = StatusFailed
+			r.Summary.Failed++
+		} else {
+			fl.Status = StatusValid
+			r.Summary.Valid++
+		}
+		r.Summary.Findings += n
+	}
+	r.Summary.Flows = len(b.order)
+	r.Summary.Findings += len(b.unattributed)
+	return r
+}
+
+// JSON returns a report as indented JSON.
+func JSON(r *Report) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false) // findings quote commands such as "RCPT TO:<a@example.com>"
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
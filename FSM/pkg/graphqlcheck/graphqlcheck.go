@@ -0,0 +1,247 @@
+// Package graphqlcheck validates GraphQL query documents: the literal grammar of
+// names, numbers, and strings, brackets balanced with a stack as the PDA validator
+// does, the grammar of operations, fragments, selections, arguments, and variable
+// definitions, and the rules tying them together, such as every variable an
+// operation uses being defined. GraphQL payloads travel over the same HTTP
+// requests as the JSON bodies already validated.
+package graphqlcheck
+
+import (
+	"fmt"
+	"sort"
+
+	"config-validator/pkg/automata"
+)
+
+// State is the state reported in GraphQL findings.
+const State = "GRAPHQL"
+
+// Check returns the findings for a GraphQL executable document. Lexical and
+// bracket errors are all reported; the grammar is checked only when there are none,
+// and up to its first error, as every later token would be misread.
+func Check(doc []byte) []automata.Finding {
+	tokens, findings := lex(string(doc))
+	findings = append(findings, checkBrackets(tokens)...)
+	if len(findings) > 0 {
+		return findings
+	}
+
+	p := &parser{tokens: tokens}
+	d, err := p.document()
+	if err != nil {
+		return append(p.findings, *err)
+	}
+	findings = append(p.findings, d.validate()...)
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Line < findings[j].Line })
+	return findings
+}
+
+func finding(line int, command, msg string) automata.Finding {
+	return automata.Finding{Line: line, Command: command, State: State, Message: msg, Severity: automata.SeverityError}
+}
+
+// checkBrackets matches the brackets of the document with a stack, reporting the
+// first closing bracket that does not match and the brackets left open.
+func checkBrackets(tokens []token) []automata.Finding {
+	pairs := map[string]string{")": "(", "]": "[", "}": "{"}
+	var stack []token
+	for _, t := range tokens {
+		if t.kind != punct {
+			continue
+		}
+		switch t.text {
+		case "(", "[", "{":
+			stack = append(stack, t)
+		case ")", "]", "}":
+			if len(stack) == 0 {
+				return []automata.Finding{finding(t.line, t.text, fmt.Sprintf("unmatched '%s'", t.text))}
+			}
+			open := stack[len(stack)-1]
+			if open.text != pairs[t.text] {
+				return []automata.Finding{finding(t.line, t.text,
+					fmt.Sprintf("'%s' closes '%s' opened on line %d", t.text, open.text, open.line))}
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+	var findings []automata.Finding
+	for _, open := range stack {
+		findings = append(findings, finding(open.line, open.text, fmt.Sprintf("'%s' is never closed", open.text)))
+	}
+	return findings
+}
+
+// document is what the parser collected for the document-level rules.
+type document struct {
+	operations []*operation
+	fragments  []*fragment
+}
+
+type operation struct {
+	name      string // empty for anonymous operations
+	line      int
+	variables []variable // defined
+	uses      []variable // used directly in its selections
+	spreads   []spread
+}
+
+type fragment struct {
+	name    string
+	line    int
+	uses    []variable
+	spreads []spread
+}
+
+type variable struct {
+	name string
+	line int
+}
+
+type spread struct {
+	name string
+	line int
+}
+
+// validate applies the rules that span definitions: unique operation and fragment
+// names, a lone anonymous operation, spreads of defined fragments without cycles,
+// fragments that are used, and variables that are defined and used.
+func (d *document) validate() []automata.Finding {
+	var findings []automata.Finding
+	ops := map[string]bool{}
+	for _, op := range d.operations {
+		if op.name == "" {
+			if len(d.operations) > 1 {
+				findings = append(findings, finding(op.line, "", "an anonymous operation must be the only operation in the document"))
+			}
+			continue
+		}
+		if ops[op.name] {
+			findings = append(findings, finding(op.line, op.name, fmt.Sprintf("operation %s is defined more than once", op.name)))
+		}
+		ops[op.name] = true
+	}
+
+	frags := map[string]*fragment{}
+	for _, f := range d.fragments {
+		if frags[f.name] != nil {
+			findings = append(findings, finding(f.line, f.name, fmt.Sprintf("fragment %s is defined more than once", f.name)))
+			continue
+		}
+		frags[f.name] = f
+	}
+	for _, f := range d.fragments {
+		if frags[f.name] == f && reaches(frags, f.spreads, f.name, map[string]bool{}) {
+			findings = append(findings, finding(f.line, f.name, fmt.Sprintf("fragment %s spreads itself", f.name)))
+		}
+	}
+
+	used := map[string]bool{}
+	check := func(spreads []spread) {
+		for _, s := range spreads {
+			if frags[s.name] == nil {
+				findings = append(findings, finding(s.line, "..."+s.name, fmt.Sprintf("fragment %s is not defined", s.name)))
+			}
+		}
+	}
+	for _, f := range d.fragments {
+		check(f.spreads)
+	}
+	for _, op := range d.operations {
+		check(op.spreads)
+		findings = append(findings, op.validateVariables(frags, used)...)
+	}
+	for _, f := range d.fragments {
+		if !used[f.name] && frags[f.name] == f {
+			findings = append(findings, finding(f.line, f.name, fmt.Sprintf("fragment %s is never used", f.name)))
+		}
+	}
+	return findings
+}
+
+// reaches reports whether spreads lead, through the fragments they name, to target.
+func reaches(frags map[string]*fragment, spreads []spread, target string, seen map[string]bool) bool {
+	for _, s := range spreads {
+		if s.name == target {
+			return true
+		}
+		if f := frags[s.name]; f != nil && !seen[s.name] {
+			seen[s.name] = true
+			if reaches(frags, f.spreads, target, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validateVariables checks that the variables the operation uses, directly or in
+// the fragments it spreads, are defined once, and that it uses those it defines. The
+// fragments reached are marked in used.
+func (op *operation) validateVariables(frags map[string]*fragment, used map[string]bool) []automata.Finding {
+	var findings []automata.Finding
+	defined := map[string]bool{}
+	for _, v := range op.variables {
+		if defined[v.name] {
+			findings = append(findings, finding(v.line, "$"+v.name, fmt.Sprintf("variable $%s is defined more than once", v.name)))
+		}
+		defined[v.name] = true
+	}
+
+	uses := append([]variable{}, op.uses...)
+	queue := append([]spread{}, op.spreads...)
+	seen := map[string]bool{}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		f := frags[s.name]
+		if f == nil || seen[s.name] {
+			continue
+		}
+		seen[s.name] = true
+		used[s.name] = true
+		uses = append(uses, f.uses...)
+		queue = append(queue, f.spreads...)
+	}
+
+	name := op.name
+	if name == "" {
+		name = "the anonymous operation"
+	}
+	referenced := map[string]bool{}
+	reported := map[string]bool{}
+	for _, v := range uses {
+		referenced[v.name] = true
+		if !defined[v.name] && !reported[v.name] {
+			reported[v.name] = true
+			findings = append(findings, finding(v.line, "$"+v.name, fmt.Sprintf("variable $%s is not defined by %s", v.name, name)))
+		}
+	}
+	for _, v := range op.variables {
+		if !referenced[v.name] {
+			findings = append(findings, finding(v.line, "$"+v.name, fmt.Sprintf("variable $%s is defined by %s but never used", v.name, name)))
+		}
+	}
+	return findings
+}
+
+// describe names a token for error messages.
+func describe(t token) string {
+	switch t.kind {
+	case eof:
+		return "end of document"
+	case str, blockStr:
+		return "string " + t.text
+	case name:
+		return "'" + t.text + "'"
+	case intValue, floatValue:
+		return "number " + t.text
+	}
+	return "'" + t.text + "'"
+}
+
+// typeSystemKeywords start definitions of a schema, which a query document cannot
+// hold.
+var typeSystemKeywords = map[string]bool{
+	"schema": true, "scalar": true, "type": true, "interface": true, "union": true,
+	"enum": true, "input": true, "directive": true, "extend": true,
+}
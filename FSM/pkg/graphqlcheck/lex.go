@@ -0,0 +1,278 @@
+package graphqlcheck
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"config-validator/pkg/automata"
+)
+
+type tokenKind int
+
+const (
+	eof tokenKind = iota
+	punct
+	name
+	intValue
+	floatValue
+	str
+	blockStr
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	line int
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z'
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isNameContinue(c byte) bool { return isNameStart(c) || isDigit(c) }
+
+// unexpected reports whether c starts no token, whitespace, or comment.
+func unexpected(c byte) bool {
+	return !isNameContinue(c) && strings.IndexByte(" \t,\n\r#.\"-!$&():=@[]{|}", c) < 0
+}
+
+// maxLexFindings caps the malformed tokens reported for a document, so that a body
+// that is not GraphQL at all, such as binary data, gets a short report.
+const maxLexFindings = 50
+
+// lex splits a document into tokens. Whitespace, line terminators, commas, and
+// comments are ignored, as GraphQL does. Malformed tokens are reported and skipped,
+// so that the rest of the document is still checked.
+func lex(src string) ([]token, []automata.Finding) {
+	var tokens []token
+	var findings []automata.Finding
+	line := 1
+	bad := func(text, msg string) {
+		switch {
+		case len(findings) < maxLexFindings:
+			findings = append(findings, finding(line, text, msg))
+		case len(findings) == maxLexFindings:
+			findings = append(findings, finding(line, "", fmt.Sprintf("more than %d malformed tokens; the rest are not reported", maxLexFindings)))
+		}
+	}
+	src = strings.TrimPrefix(src, "\ufeff")
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == ',':
+			i++
+		case c == '\n':
+			line++
+			i++
+		case c == '\r':
+			line++
+			i++
+			if i < len(src) && src[i] == '\n' {
+				i++
+			}
+		case c == '#':
+			for i < len(src) && src[i] != '\n' && src[i] != '\r' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "..."):
+			tokens = append(tokens, token{punct, "...", line})
+			i += 3
+		case strings.ContainsRune("!$&():=@[]{|}", rune(c)):
+			tokens = append(tokens, token{punct, string(c), line})
+			i++
+		case c == '.':
+			j := i
+			for j < len(src) && src[j] == '.' {
+				j++
+			}
+			bad(src[i:j], fmt.Sprintf("'%s' is not a token; spreads are written '...'", src[i:j]))
+			i = j
+		case isNameStart(c):
+			j := i + 1
+			for j < len(src) && isNameContinue(src[j]) {
+				j++
+			}
+			tokens = append(tokens, token{name, src[i:j], line})
+			i = j
+		case c == '-' || isDigit(c):
+			t, n, msg := lexNumber(src[i:])
+			if msg != "" {
+				bad(src[i:i+n], msg)
+			} else {
+				t.line = line
+				tokens = append(tokens, t)
+			}
+			i += n
+		case strings.HasPrefix(src[i:], `"""`):
+			start := line
+			j := i + 3
+			closed := false
+			for j < len(src) {
+				if strings.HasPrefix(src[j:], `\"""`) {
+					j += 4
+					continue
+				}
+				if strings.HasPrefix(src[j:], `"""`) {
+					j += 3
+					closed = true
+					break
+				}
+				if src[j] == '\n' || src[j] == '\r' && (j+1 == len(src) || src[j+1] != '\n') {
+					line++
+				}
+				j++
+			}
+			if !closed {
+				findings = append(findings, finding(start, `"""`, "block string is never closed"))
+			} else {
+				tokens = append(tokens, token{blockStr, src[i:j], start})
+			}
+			i = j
+		case c == '"':
+			n, msg := lexString(src[i:])
+			if msg != "" {
+				bad(src[i:i+n], msg)
+			} else {
+				tokens = append(tokens, token{str, src[i : i+n], line})
+			}
+			i += n
+		default:
+			// A run of unexpected characters is one finding. Invalid UTF-8 decodes as
+			// U+FFFD of one byte.
+			r, size := utf8.DecodeRuneInString(src[i:])
+			j := i + size
+			for j < len(src) && unexpected(src[j]) {
+				j++
+			}
+			if n := utf8.RuneCountInString(src[i:j]); n > 1 {
+				bad(src[i:i+size], fmt.Sprintf("%d unexpected characters, starting with %q", n, r))
+			} else {
+				bad(src[i:i+size], fmt.Sprintf("unexpected character %q", r))
+			}
+			i = j
+		}
+	}
+	tokens = append(tokens, token{eof, "", line})
+	return tokens, findings
+}
+
+// lexNumber reads an IntValue or FloatValue at the start of s. It returns the
+// length read and, for malformed numbers, why; the length then covers the whole
+// malformed literal, so lexing resumes after it.
+func lexNumber(s string) (token, int, string) {
+	i := 0
+	if s[i] == '-' {
+		i++
+	}
+	if i == len(s) || !isDigit(s[i]) {
+		return token{}, i, "'-' must be followed by a digit"
+	}
+	leadingZero := s[i] == '0' && i+1 < len(s) && isDigit(s[i+1])
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	kind := intValue
+	var msg string
+	if i < len(s) && s[i] == '.' {
+		kind = floatValue
+		i++
+		if i == len(s) || !isDigit(s[i]) {
+			msg = "a decimal point must be followed by digits"
+		}
+		for i < len(s) && isDigit(s[i]) {
+			i++
+		}
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		kind = floatValue
+		i++
+		if i < len(s) && (s[i] == '+' || s[i] == '-') {
+			i++
+		}
+		if (i == len(s) || !isDigit(s[i])) && msg == "" {
+			msg = "an exponent must have digits"
+		}
+		for i < len(s) && isDigit(s[i]) {
+			i++
+		}
+	}
+	// A number may not run into a name or another '.', as in 12abc or 1.2.3
+	if i < len(s) && (isNameStart(s[i]) || s[i] == '.') {
+		for i < len(s) && (isNameContinue(s[i]) || s[i] == '.') {
+			i++
+		}
+		return token{}, i, fmt.Sprintf("invalid number %s", s[:i])
+	}
+	if msg != "" {
+		return token{}, i, fmt.Sprintf("invalid number %s: %s", s[:i], msg)
+	}
+	if leadingZero {
+		return token{}, i, fmt.Sprintf("invalid number %s: leading zeros are not allowed", s[:i])
+	}
+	return token{kind: kind, text: s[:i]}, i, ""
+}
+
+// lexString reads a quoted string at the start of s, which may not span lines. It
+// returns the length read and, for malformed strings, why. A bad escape does not end
+// the string, so lexing resumes after its closing quote.
+func lexString(s string) (int, string) {
+	var msg string
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return i + 1, msg
+		case '\n', '\r':
+			return i, "string is not closed before the end of the line; use a block string (\"\"\") for multi-line text"
+		case '\\':
+			if i+1 == len(s) {
+				return i + 1, "string is never closed"
+			}
+			switch e := s[i+1]; e {
+			case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+				i++
+			case 'u':
+				n := unicodeEscape(s[i+2:])
+				if n == 0 && msg == "" {
+					msg = fmt.Sprintf("invalid unicode escape %s", s[i:min(i+6, len(s))])
+				}
+				i += 1 + n
+			default:
+				if msg == "" {
+					msg = fmt.Sprintf("invalid escape sequence \\%c", e)
+				}
+				i++
+			}
+		}
+	}
+	return len(s), "string is never closed"
+}
+
+// unicodeEscape returns the length of the escape after \u: four hex digits, or a
+// braced code point such as {1F600}; 0 when it is malformed.
+func unicodeEscape(s string) int {
+	isHex := func(c byte) bool { return isDigit(c) || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F' }
+	if strings.HasPrefix(s, "{") {
+		end := strings.IndexByte(s, '}')
+		if end < 2 || end > 7 {
+			return 0
+		}
+		for i := 1; i < end; i++ {
+			if !isHex(s[i]) {
+				return 0
+			}
+		}
+		return end + 1
+	}
+	if len(s) < 4 {
+		return 0
+	}
+	for i := 0; i < 4; i++ {
+		if !isHex(s[i]) {
+			return 0
+		}
+	}
+	return 4
+}
@@ -0,0 +1,304 @@
+package graphqlcheck
+
+import (
+	"fmt"
+
+	"config-validator/pkg/automata"
+)
+
+// parser is a recursive-descent parser of executable documents. It records what the
+// document-level rules need, and findings that do not stop parsing, such as
+// duplicate argument names.
+type parser struct {
+	tokens   []token
+	pos      int
+	findings []automata.Finding
+
+	uses    *[]variable // of the operation or fragment being parsed
+	spreads *[]spread
+}
+
+// syntaxError stops the parse at its first error.
+type syntaxError struct{ automata.Finding }
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != eof {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) fail(t token, format string, args ...any) {
+	panic(syntaxError{finding(t.line, t.text, fmt.Sprintf(format, args...))})
+}
+
+func (p *parser) is(kind tokenKind, text string) bool {
+	t := p.peek()
+	return t.kind == kind && t.text == text
+}
+
+// expect consumes the punctuator text, failing when the next token is another.
+func (p *parser) expect(text, what string) token {
+	t := p.next()
+	if t.kind != punct || t.text != text {
+		p.fail(t, "expected '%s' %s, found %s", text, what, describe(t))
+	}
+	return t
+}
+
+func (p *parser) name(what string) token {
+	t := p.next()
+	if t.kind != name {
+		p.fail(t, "expected %s, found %s", what, describe(t))
+	}
+	return t
+}
+
+// document parses the whole document, returning the first syntax error.
+func (p *parser) document() (d *document, err *automata.Finding) {
+	defer func() {
+		if r := recover(); r != nil {
+			se, ok := r.(syntaxError)
+			if !ok {
+				panic(r)
+			}
+			err = &se.Finding
+		}
+	}()
+
+	d = &document{}
+	if p.peek().kind == eof {
+		p.fail(p.peek(), "document has no operations")
+	}
+	for p.peek().kind != eof {
+		t := p.peek()
+		switch {
+		case t.kind == punct && t.text == "{":
+			op := &operation{line: t.line}
+			p.track(&op.uses, &op.spreads)
+			p.selectionSet()
+			d.operations = append(d.operations, op)
+		case t.kind == name && (t.text == "query" || t.text == "mutation" || t.text == "subscription"):
+			d.operations = append(d.operations, p.operation())
+		case t.kind == name && t.text == "fragment":
+			d.fragments = append(d.fragments, p.fragment())
+		case t.kind == name && typeSystemKeywords[t.text], t.kind == str || t.kind == blockStr:
+			p.fail(t, "type system definitions such as %s are not allowed in a query document", describe(t))
+		default:
+			p.fail(t, "expected an operation or a fragment, found %s", describe(t))
+		}
+	}
+	return d, nil
+}
+
+// track directs the variables and spreads found from now on to an operation or
+// fragment.
+func (p *parser) track(uses *[]variable, spreads *[]spread) {
+	p.uses, p.spreads = uses, spreads
+}
+
+func (p *parser) operation() *operation {
+	t := p.next() // query, mutation, or subscription
+	op := &operation{line: t.line}
+	if p.peek().kind == name {
+		op.name = p.next().text
+	}
+	// Variable definitions are parsed before uses are tracked, so that default
+	// values, which may not use variables, are not taken for uses
+	if p.is(punct, "(") {
+		op.variables = p.variableDefinitions()
+	}
+	p.track(&op.uses, &op.spreads)
+	p.directives(false)
+	if !p.is(punct, "{") {
+		p.fail(p.peek(), "expected the selection set of %s, found %s", t.text, describe(p.peek()))
+	}
+	p.selectionSet()
+	return op
+}
+
+func (p *parser) fragment() *fragment {
+	p.next() // fragment
+	n := p.name("a fragment name")
+	if n.text == "on" {
+		p.fail(n, "a fragment cannot be named 'on'")
+	}
+	f := &fragment{name: n.text, line: n.line}
+	p.track(&f.uses, &f.spreads)
+	if t := p.name("'on' and a type condition"); t.text != "on" {
+		p.fail(t, "expected 'on' after fragment %s, found %s", f.name, describe(t))
+	}
+	p.name("the type the fragment applies to")
+	p.directives(false)
+	if !p.is(punct, "{") {
+		p.fail(p.peek(), "expected the selection set of fragment %s, found %s", f.name, describe(p.peek()))
+	}
+	p.selectionSet()
+	return f
+}
+
+// variableDefinitions parses ($name: Type = default @directive, ...).
+func (p *parser) variableDefinitions() []variable {
+	open := p.expect("(", "")
+	if p.is(punct, ")") {
+		p.fail(p.peek(), "variable definitions must not be empty; leave out the parentheses")
+	}
+	var vars []variable
+	for !p.is(punct, ")") {
+		if !p.is(punct, "$") {
+			p.fail(p.peek(), "expected a variable definition ($name: Type), found %s", describe(p.peek()))
+		}
+		p.next()
+		n := p.name("a variable name after '$'")
+		vars = append(vars, variable{n.text, n.line})
+		p.expect(":", "and the type of $"+n.text)
+		p.typeRef()
+		if p.is(punct, "=") {
+			p.next()
+			p.value(true)
+		}
+		p.directives(true)
+		if p.peek().kind == eof {
+			p.fail(open, "variable definitions are never closed")
+		}
+	}
+	p.next()
+	return vars
+}
+
+// typeRef parses Name, [Type], and either followed by '!'.
+func (p *parser) typeRef() {
+	if p.is(punct, "[") {
+		p.next()
+		p.typeRef()
+		p.expect("]", "to close the list type")
+	} else {
+		p.name("a type")
+	}
+	if p.is(punct, "!") {
+		p.next()
+	}
+}
+
+func (p *parser) directives(isConst bool) {
+	for p.is(punct, "@") {
+		p.next()
+		p.name("a directive name after '@'")
+		if p.is(punct, "(") {
+			p.arguments(isConst)
+		}
+	}
+}
+
+// selectionSet parses { selection ... }.
+func (p *parser) selectionSet() {
+	open := p.expect("{", "")
+	if p.is(punct, "}") {
+		p.fail(p.peek(), "selection set must not be empty")
+	}
+	for !p.is(punct, "}") {
+		if p.peek().kind == eof {
+			p.fail(open, "selection set is never closed")
+		}
+		p.selection()
+	}
+	p.next()
+}
+
+func (p *parser) selection() {
+	if p.is(punct, "...") {
+		p.next()
+		t := p.peek()
+		switch {
+		case t.kind == name && t.text != "on":
+			p.next()
+			*p.spreads = append(*p.spreads, spread{t.text, t.line})
+			p.directives(false)
+		case t.kind == name: // on Type
+			p.next()
+			p.name("the type after 'on'")
+			p.directives(false)
+			p.selectionSet()
+		case t.kind == punct && (t.text == "@" || t.text == "{"):
+			p.directives(false)
+			p.selectionSet()
+		default:
+			p.fail(t, "expected a fragment name or an inline fragment after '...', found %s", describe(t))
+		}
+		return
+	}
+
+	p.name("a field")
+	if p.is(punct, ":") { // alias: field
+		p.next()
+		p.name("a field after the alias")
+	}
+	if p.is(punct, "(") {
+		p.arguments(false)
+	}
+	p.directives(false)
+	if p.is(punct, "{") {
+		p.selectionSet()
+	}
+}
+
+// arguments parses (name: value, ...), reporting names given twice.
+func (p *parser) arguments(isConst bool) {
+	p.expect("(", "")
+	if p.is(punct, ")") {
+		p.fail(p.peek(), "arguments must not be empty; leave out the parentheses")
+	}
+	seen := map[string]bool{}
+	for !p.is(punct, ")") {
+		n := p.name("an argument name")
+		if seen[n.text] {
+			p.findings = append(p.findings, finding(n.line, n.text, fmt.Sprintf("argument %s is given more than once", n.text)))
+		}
+		seen[n.text] = true
+		p.expect(":", "after argument "+n.text)
+		p.value(isConst)
+	}
+	p.next()
+}
+
+// value parses a literal, a list, an object, or, unless isConst, a variable.
+func (p *parser) value(isConst bool) {
+	t := p.next()
+	switch {
+	case t.kind == punct && t.text == "$":
+		n := p.name("a variable name after '$'")
+		if isConst {
+			p.fail(n, "variable $%s cannot be used in a default value or a definition's directive", n.text)
+		}
+		if p.uses != nil {
+			*p.uses = append(*p.uses, variable{n.text, n.line})
+		}
+	case t.kind == intValue, t.kind == floatValue, t.kind == str, t.kind == blockStr, t.kind == name:
+		// true, false, null, and enum values are names
+	case t.kind == punct && t.text == "[":
+		for !p.is(punct, "]") {
+			if p.peek().kind == eof {
+				p.fail(t, "list is never closed")
+			}
+			p.value(isConst)
+		}
+		p.next()
+	case t.kind == punct && t.text == "{":
+		seen := map[string]bool{}
+		for !p.is(punct, "}") {
+			n := p.name("an input object field")
+			if seen[n.text] {
+				p.findings = append(p.findings, finding(n.line, n.text, fmt.Sprintf("input object field %s is given more than once", n.text)))
+			}
+			seen[n.text] = true
+			p.expect(":", "after field "+n.text)
+			p.value(isConst)
+		}
+		p.next()
+	default:
+		p.fail(t, "expected a value, found %s", describe(t))
+	}
+}
@@ -0,0 +1,96 @@
+package graphqlcheck
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+
+	"config-validator/pkg/automata"
+)
+
+// requestMembers are the members of a GraphQL-over-HTTP request body.
+var requestMembers = map[string]bool{"query": true, "variables": true, "operationName": true, "extensions": true}
+
+var operationNameRe = regexp.MustCompile(`\b(?:query|mutation|subscription)\s+([_A-Za-z][_0-9A-Za-z]*)`)
+
+// CheckRequest validates a JSON body that is a GraphQL request: an object with a
+// "query" string and no members but those of GraphQL over HTTP. Findings about the
+// query are reported on the line of its member, with the line within the query in
+// the message. It returns nil for well-formed JSON bodies that are not GraphQL
+// requests; other JSON is left to the JSON check.
+func CheckRequest(body []byte) []automata.Finding {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil
+	}
+	members := map[string]json.RawMessage{}
+	lines := map[string]int{}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+		key, _ := t.(string)
+		if !requestMembers[key] {
+			return nil
+		}
+		offset := dec.InputOffset()
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return nil
+		}
+		members[key] = v
+		lines[key] = bytes.Count(body[:offset], []byte("\n")) + 1
+	}
+	if _, err := dec.Token(); err != nil && err != io.EOF {
+		return nil
+	}
+	var query string
+	if err := json.Unmarshal(members["query"], &query); err != nil {
+		return nil
+	}
+
+	var findings []automata.Finding
+	for _, f := range Check([]byte(query)) {
+		f.Message = fmt.Sprintf("query line %d: %s", f.Line, f.Message)
+		f.Line = lines["query"]
+		findings = append(findings, f)
+	}
+	if v, ok := members["variables"]; ok && !isKind(v, '{') {
+		findings = append(findings, finding(lines["variables"], "variables", "\"variables\" must be an object or null"))
+	}
+	if v, ok := members["extensions"]; ok && !isKind(v, '{') {
+		findings = append(findings, finding(lines["extensions"], "extensions", "\"extensions\" must be an object or null"))
+	}
+	if v, ok := members["operationName"]; ok && !isNull(v) {
+		var name string
+		if err := json.Unmarshal(v, &name); err != nil {
+			findings = append(findings, finding(lines["operationName"], "operationName", "\"operationName\" must be a string or null"))
+		} else if !hasOperation(query, name) {
+			findings = append(findings, finding(lines["operationName"], name, fmt.Sprintf("\"operationName\" %s names no operation of the query", name)))
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Line < findings[j].Line })
+	return findings
+}
+
+// hasOperation reports whether the query defines an operation with the name.
+func hasOperation(query, name string) bool {
+	for _, m := range operationNameRe.FindAllStringSubmatch(query, -1) {
+		if m[1] == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isNull(v json.RawMessage) bool { return string(bytes.TrimSpace(v)) == "null" }
+
+// isKind reports whether v is null or a JSON value starting with c.
+func isKind(v json.RawMessage, c byte) bool {
+	v = bytes.TrimSpace(v)
+	return isNull(v) || len(v) > 0 && v[0] == c
+}
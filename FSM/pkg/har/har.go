@@ -0,0 +1,247 @@
+// Package har reads HAR archives (HTTP Archive 1.2), as exported by browsers and
+// proxies, and validates the request and response of every entry with the HTTP and
+// body validators.
+package har
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/httpbody"
+	"config-validator/pkg/httpmsg"
+)
+
+// State is the state reported in findings about the archive itself.
+const State = "HAR"
+
+type header struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type entry struct {
+	Request *struct {
+		Method      string   `json:"method"`
+		URL         string   `json:"url"`
+		HTTPVersion string   `json:"httpVersion"`
+		Headers     []header `json:"headers"`
+		PostData    *struct {
+			MimeType string `json:"mimeType"`
+			Text     string `json:"text"`
+		} `json:"postData"`
+	} `json:"request"`
+	Response *struct {
+		Status      int      `json:"status"`
+		HTTPVersion string   `json:"httpVersion"`
+		Headers     []header `json:"headers"`
+		Content     struct {
+			MimeType string `json:"mimeType"`
+			Text     string `json:"text"`
+			Encoding string `json:"encoding"`
+		} `json:"content"`
+	} `json:"response"`
+}
+
+// Entry is an entry of an archive, with the line it starts on.
+type Entry struct {
+	Index int
+	Line  int
+	entry
+}
+
+// Result is the outcome of checking one entry: the per-entry report.
+type Result struct {
+	Index    int                `json:"index"`
+	Line     int                `json:"line"`
+	Method   string             `json:"method"`
+	URL      string             `json:"url"`
+	Status   int                `json:"status"`
+	Valid    bool               `json:"valid"`
+	Findings []automata.Finding `json:"findings"`
+}
+
+// Parse reads the entries of an archive. Problems with the archive's structure are
+// returned as findings; entries that can be read are returned even so.
+func Parse(content []byte) ([]Entry, []automata.Finding) {
+	var findings []automata.Finding
+	fail := func(line int, msg string) ([]Entry, []automata.Finding) {
+		findings = append(findings, automata.Finding{Line: line, State: State, Message: msg, Severity: automata.SeverityError})
+		return nil, findings
+	}
+
+	// The entries are read one at a time so each has the line it starts on.
+	dec := json.NewDecoder(bytes.NewReader(content))
+	if !enter(dec) {
+		return fail(1, "a HAR archive is a JSON object with a \"log\" member")
+	}
+	if !seek(dec, "log") || !enter(dec) {
+		return fail(1, "archive has no \"log\" object")
+	}
+	var entries []Entry
+	found := false
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return fail(lineAt(content, dec.InputOffset()), fmt.Sprintf("archive is not valid JSON: %v", err))
+		}
+		if key == "version" {
+			var version string
+			if dec.Decode(&version) != nil || (version != "1.1" && version != "1.2") {
+				findings = append(findings, automata.Finding{Line: lineAt(content, dec.InputOffset()), State: State,
+					Message: fmt.Sprintf("log.version is %q; HAR versions are 1.1 and 1.2", version), Severity: automata.SeverityWarning})
+			}
+			continue
+		}
+		if key != "entries" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return fail(lineAt(content, dec.InputOffset()), fmt.Sprintf("archive is not valid JSON: %v", err))
+			}
+			continue
+		}
+		found = true
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+			return fail(lineAt(content, dec.InputOffset()), "log.entries must be an array")
+		}
+		for dec.More() {
+			e := Entry{Index: len(entries) + 1, Line: lineAt(content, valueStart(content, dec.InputOffset()))}
+			if err := dec.Decode(&e.entry); err != nil {
+				return fail(e.Line, fmt.Sprintf("entry %d is not a valid HAR entry: %v", e.Index, err))
+			}
+			entries = append(entries, e)
+		}
+		dec.Token() // ]
+	}
+	if !found {
+		return fail(1, "archive has no log.entries array")
+	}
+	return entries, findings
+}
+
+// enter reads the start of an object.
+func enter(dec *json.Decoder) bool {
+	tok, err := dec.Token()
+	return err == nil && tok == json.Delim('{')
+}
+
+// seek reads members of the current object up to the one with the key.
+func seek(dec *json.Decoder, key string) bool {
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return false
+		}
+		if tok == key {
+			return true
+		}
+		var skip json.RawMessage
+		if dec.Decode(&skip) != nil {
+			return false
+		}
+	}
+	return false
+}
+
+// valueStart skips the separators between the end of a token and the next value.
+func valueStart(content []byte, offset int64) int64 {
+	for offset < int64(len(content)) && strings.IndexByte(" \t\r\n,", content[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
+
+func lineAt(content []byte, offset int64) int {
+	return bytes.Count(content[:min(offset, int64(len(content)))], []byte("\n")) + 1
+}
+
+// Check validates the request and response of an entry, and runs any further checks
+// on the request. Findings are on the entry's line; a finding inside a body says
+// which line of the body it is on.
+func Check(e Entry, checks ...func(*httpmsg.Message) []automata.Finding) Result {
+	r := Result{Index: e.Index, Line: e.Line}
+	add := func(part string, f automata.Finding, bodyLine bool) {
+		msg := fmt.Sprintf("entry %d: %s", e.Index, f.Message)
+		if part != "" {
+			msg = fmt.Sprintf("entry %d %s: %s", e.Index, part, f.Message)
+		}
+		if bodyLine && f.Line > 0 {
+			msg = fmt.Sprintf("entry %d %s body line %d: %s", e.Index, part, f.Line, f.Message)
+		}
+		f.Line, f.Message = e.Line, msg
+		r.Findings = append(r.Findings, f)
+	}
+	if e.Request == nil {
+		add("", automata.Finding{State: State, Message: "has no request", Severity: automata.SeverityError}, false)
+		return r
+	}
+	req := e.Request
+	r.Method, r.URL = req.Method, req.URL
+
+	msg := &httpmsg.Message{Request: true, Method: req.Method, Target: req.URL, Version: req.HTTPVersion, BodyLine: 1}
+	msg.StartLine = strings.TrimSpace(req.Method + " " + req.URL + " " + req.HTTPVersion)
+	checkHeaders("request", req.Headers, msg, add)
+	if req.PostData != nil {
+		msg.Body = []byte(req.PostData.Text)
+		defaultType(msg, req.PostData.MimeType)
+	}
+	findings := httpbody.CheckMessage(msg)
+	for _, check := range checks {
+		findings = append(findings, check(msg)...)
+	}
+	for _, f := range findings {
+		add("request", f, true)
+	}
+
+	// A response with status 0 was never received (blocked or failed).
+	if resp := e.Response; resp != nil && resp.Status != 0 {
+		r.Status = resp.Status
+		msg := &httpmsg.Message{Status: resp.Status, Version: resp.HTTPVersion, BodyLine: 1}
+		msg.StartLine = fmt.Sprintf("%s %d", resp.HTTPVersion, resp.Status)
+		checkHeaders("response", resp.Headers, msg, add)
+		// Archives hold the decoded content, so content codings do not apply to it.
+		msg.Body = []byte(resp.Content.Text)
+		if resp.Content.Encoding == "base64" {
+			body, err := base64.StdEncoding.DecodeString(resp.Content.Text)
+			if err != nil {
+				add("response", automata.Finding{State: State, Message: fmt.Sprintf("content is not valid base64: %v", err), Severity: automata.SeverityError}, false)
+			}
+			msg.Body = body
+		}
+		defaultType(msg, resp.Content.MimeType)
+		for _, f := range httpbody.CheckMessage(msg) {
+			add("response", f, true)
+		}
+	}
+	r.Valid = len(r.Findings) == 0
+	return r
+}
+
+// checkHeaders checks the header names of a request or response, and adds the headers
+// to the message. HTTP/2 pseudo-headers, such as :authority, are skipped.
+func checkHeaders(part string, headers []header, msg *httpmsg.Message, add func(string, automata.Finding, bool)) {
+	for _, h := range headers {
+		if strings.HasPrefix(h.Name, ":") {
+			continue
+		}
+		parsed, problem := httpmsg.ParseHeader(h.Name + ": " + h.Value)
+		if problem != "" {
+			add(part, automata.Finding{Command: h.Name + ": " + h.Value, State: httpmsg.State, Message: problem, Severity: automata.SeverityError}, false)
+		}
+		if parsed.Name != "" {
+			msg.Headers = append(msg.Headers, parsed)
+		}
+	}
+}
+
+// defaultType gives a message without a Content-Type header the archive's MIME type,
+// which exporters fill in from the header or from sniffing. Placeholders such as
+// Chrome's "x-unknown" are not media types and are ignored.
+func defaultType(msg *httpmsg.Message, mimeType string) {
+	if _, ok := msg.Get("Content-Type"); !ok && strings.Contains(mimeType, "/") {
+		msg.Headers = append(msg.Headers, httpmsg.Header{Name: "Content-Type", Value: mimeType})
+	}
+}
@@ -0,0 +1,182 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"config-validator/pkg/validation"
+)
+
+// Run is one scheduled validation of the whole inventory.
+type Run struct {
+	ID       string                  `json:"id"`
+	Started  time.Time               `json:"started"`
+	Finished time.Time               `json:"finished"`
+	Report   *validation.FleetReport `json:"report"`
+}
+
+// DeviceStatus is the outcome for one device in one run.
+type DeviceStatus struct {
+	RunID     string    `json:"run_id"`
+	CheckedAt time.Time `json:"checked_at"`
+	validation.DeviceResult
+}
+
+// Retention limits the runs a Store keeps (see Prune). A zero field sets no limit.
+type Retention struct {
+	MaxRuns int           // runs kept, newest first
+	MaxAge  time.Duration // runs started longer ago than this are dropped
+}
+
+// Store persists runs as JSON files in a directory and keeps an in-memory index
+// of the latest status per device for the REST API.
+type Store struct {
+	dir  string
+	keep Retention
+
+	mu     sync.RWMutex
+	runs   []*Run
+	latest map[string]DeviceStatus
+}
+
+// Open loads every run previously recorded in dir, creating the directory if needed.
+// Runs beyond keep stay until the next Prune.
+func Open(dir string, keep Retention) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &Store{dir: dir, keep: keep, latest: make(map[string]DeviceStatus)}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var run Run
+		if err := json.Unmarshal(data, &run); err != nil {
+			return nil, fmt.Errorf("corrupt history file %s: %v", e.Name(), err)
+		}
+		s.runs = append(s.runs, &run)
+	}
+	sort.Slice(s.runs, func(i, j int) bool { return s.runs[i].Started.Before(s.runs[j].Started) })
+	s.reindex()
+	return s, nil
+}
+
+// Record persists a finished run and makes it the latest status for its devices.
+func (s *Store) Record(run *Run) error {
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, run.ID+".json"), data, 0644); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runs = append(s.runs, run)
+	sort.SliceStable(s.runs, func(i, j int) bool { return s.runs[i].Started.Before(s.runs[j].Started) })
+	s.reindex()
+	return nil
+}
+
+// Prune deletes the runs beyond the store's retention, oldest first, and returns
+// their IDs. The newest run is always kept, so Latest never empties.
+func (s *Store) Prune() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	drop := 0
+	if s.keep.MaxRuns > 0 && len(s.runs) > s.keep.MaxRuns {
+		drop = len(s.runs) - s.keep.MaxRuns
+	}
+	if s.keep.MaxAge > 0 {
+		cutoff := time.Now().Add(-s.keep.MaxAge)
+		for drop < len(s.runs)-1 && s.runs[drop].Started.Before(cutoff) {
+			drop++
+		}
+	}
+	if drop >= len(s.runs) {
+		drop = len(s.runs) - 1
+	}
+	var pruned []string
+	for drop > 0 {
+		run := s.runs[0]
+		if err := os.Remove(filepath.Join(s.dir, run.ID+".json")); err != nil && !os.IsNotExist(err) {
+			s.reindex()
+			return pruned, err
+		}
+		s.runs, drop = s.runs[1:], drop-1
+		pruned = append(pruned, run.ID)
+	}
+	s.reindex()
+	return pruned, nil
+}
+
+// reindex sets the latest status of every device from the newest run with a report.
+// Each run validates the whole inventory, so devices removed from it drop out with
+// the first run after their removal. Callers must hold the write lock (or own s
+// exclusively).
+func (s *Store) reindex() {
+	s.latest = make(map[string]DeviceStatus)
+	for i := len(s.runs) - 1; i >= 0; i-- {
+		run := s.runs[i]
+		if run.Report == nil {
+			continue
+		}
+		for _, d := range run.Report.Devices {
+			s.latest[d.Name] = DeviceStatus{RunID: run.ID, CheckedAt: run.Finished, DeviceResult: d}
+		}
+		return
+	}
+}
+
+// Latest returns the status of every device in the newest run, sorted by name.
+func (s *Store) Latest() []DeviceStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]DeviceStatus, 0, len(s.latest))
+	for _, d := range s.latest {
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Device returns every recorded status of one device, oldest first.
+func (s *Store) Device(name string) []DeviceStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []DeviceStatus
+	for _, run := range s.runs {
+		if run.Report == nil {
+			continue
+		}
+		for _, d := range run.Report.Devices {
+			if d.Name == name {
+				out = append(out, DeviceStatus{RunID: run.ID, CheckedAt: run.Finished, DeviceResult: d})
+			}
+		}
+	}
+	return out
+}
+
+// Runs returns every recorded run, oldest first.
+func (s *Store) Runs() []*Run {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]*Run(nil), s.runs...)
+}
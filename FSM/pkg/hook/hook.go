@@ -0,0 +1,125 @@
+package hook
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// File is a file as it will be committed or as it was pushed, read from git rather
+// than from the working tree.
+type File struct {
+	Path    string
+	Content []byte
+	Rev     string // the pushed revision, "" for the index
+}
+
+// zeroRev is the object name git uses for a missing side of a ref update.
+const zeroRev = "0000000000000000000000000000000000000000"
+
+// Match reports whether a repository path matches any of the glob patterns.
+// Patterns without a slash match against the file's base name, so "*.cfg"
+// covers every directory while "configs/*.cfg" only covers configs/.
+func Match(p string, patterns []string) bool {
+	for _, pattern := range patterns {
+		target := p
+		if !strings.Contains(pattern, "/") {
+			target = path.Base(p)
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// StagedFiles returns the added, copied, modified, and renamed files in the index
+// (for pre-commit hooks) whose paths are accepted by match.
+func StagedFiles(match func(path string) bool) ([]File, error) {
+	names, err := git("diff", "--cached", "--name-only", "--diff-filter=ACMR", "-z")
+	if err != nil {
+		return nil, err
+	}
+	var files []File
+	for _, name := range splitNUL(names) {
+		if !match(name) {
+			continue
+		}
+		content, err := git("show", ":"+name)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, File{Path: name, Content: content})
+	}
+	return files, nil
+}
+
+// ReadFile reads a file from a revision, or from the index when rev is "", so that
+// files such as .nvpignore are taken from what is being committed or pushed.
+func ReadFile(rev, name string) ([]byte, error) {
+	return git("show", rev+":"+name)
+}
+
+// PushedFiles reads pre-receive input ("<old> <new> <ref>" per line) and returns the
+// changed files of every updated ref whose paths are accepted by match, as of the new revision.
+func PushedFiles(r io.Reader, match func(path string) bool) ([]File, error) {
+	var files []File
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		oldRev, newRev := fields[0], fields[1]
+		if newRev == zeroRev {
+			continue // ref deletion
+		}
+
+		var names []byte
+		var err error
+		if oldRev == zeroRev {
+			names, err = git("ls-tree", "-r", "--name-only", "-z", newRev)
+		} else {
+			names, err = git("diff", "--name-only", "--diff-filter=ACMR", "-z", oldRev, newRev)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range splitNUL(names) {
+			if !match(name) {
+				continue
+			}
+			content, err := git("show", newRev+":"+name)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, File{Path: name, Content: content, Rev: newRev})
+		}
+	}
+	return files, scanner.Err()
+}
+
+func git(args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func splitNUL(b []byte) []string {
+	var out []string
+	for _, s := range strings.Split(string(b), "\x00") {
+		if s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,103 @@
+package httpbody
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/mediatype"
+)
+
+// FormState is the state reported in findings about URL-encoded form bodies.
+const FormState = "FORM"
+
+// mustEncode are the ASCII characters a form serializer always percent-encodes and
+// that parsers disagree on when they are sent raw.
+const mustEncode = " \"<>\\^`{|}"
+
+// form checks an application/x-www-form-urlencoded body: name=value pairs joined by
+// '&', percent-encoding, the characters that must be encoded, and repeated names.
+// Findings give the column of the pair within its line of the body.
+func form(m mediatype.MediaType, body []byte) []automata.Finding {
+	var findings []automata.Finding
+	text := strings.TrimRight(string(body), "\r\n")
+	if text == "" {
+		return nil
+	}
+	checkUTF8 := m.Params["charset"] == "" || strings.EqualFold(m.Params["charset"], "utf-8")
+	add := func(offset int, severity, pair, msg string) {
+		line := strings.Count(text[:offset], "\n") + 1
+		column := offset - strings.LastIndexByte(text[:offset], '\n')
+		findings = append(findings, automata.Finding{Line: line, Command: pair, State: FormState,
+			Message: fmt.Sprintf("column %d: %s", column, msg), Severity: severity})
+	}
+
+	seen := map[string]int{} // decoded name -> column of its first pair
+	offset := 0
+	for _, pair := range strings.Split(text, "&") {
+		start := offset
+		offset += len(pair) + 1
+		if pair == "" {
+			add(start, automata.SeverityWarning, pair, "empty pair; '&' is repeated or trails the form")
+			continue
+		}
+
+		rawName, rawValue, hasValue := strings.Cut(pair, "=")
+		if rawName == "" {
+			add(start, automata.SeverityError, pair, "pair has no name")
+		}
+		if !hasValue {
+			add(start, automata.SeverityWarning, pair, fmt.Sprintf("pair %q has no '=', so its value is empty", pair))
+		}
+		if strings.Contains(rawValue, "=") {
+			add(start, automata.SeverityWarning, pair, fmt.Sprintf("value of %q holds a raw '='; encode it as %%3D", rawName))
+		}
+
+		bad := false
+		for j := 0; j < len(pair) && !bad; j++ {
+			c := pair[j]
+			switch {
+			case c == '%':
+				if j+2 >= len(pair) || !isHex(pair[j+1]) || !isHex(pair[j+2]) {
+					add(start+j, automata.SeverityError, pair, fmt.Sprintf("invalid percent-encoding %q; '%%' must be followed by two hex digits", pair[j:min(j+3, len(pair))]))
+					bad = true
+				}
+			case c < 0x20 || c == 0x7f:
+				add(start+j, automata.SeverityError, pair, fmt.Sprintf("control character %q must be percent-encoded", c))
+				bad = true
+			case c >= 0x80:
+				add(start+j, automata.SeverityError, pair, "non-ASCII characters must be percent-encoded")
+				bad = true
+			case strings.IndexByte(mustEncode, c) >= 0:
+				what := fmt.Sprintf("%q", c)
+				if c == ' ' {
+					what = "space (use '+' or %20)"
+				}
+				add(start+j, automata.SeverityError, pair, fmt.Sprintf("%s must be percent-encoded", what))
+				bad = true
+			}
+		}
+		if bad {
+			continue
+		}
+
+		name, _ := url.QueryUnescape(rawName)
+		value, _ := url.QueryUnescape(rawValue)
+		if checkUTF8 && (!utf8.ValidString(name) || !utf8.ValidString(value)) {
+			add(start, automata.SeverityError, pair, "pair decodes to invalid UTF-8")
+		}
+		// name[] is the convention for sending a list, so it may repeat
+		if first, ok := seen[name]; ok && !strings.HasSuffix(name, "[]") && name != "" {
+			add(start, automata.SeverityWarning, pair, fmt.Sprintf("name %q is repeated (first at column %d); servers disagree on which value wins", name, first))
+		} else if !ok {
+			seen[name] = start - strings.LastIndexByte(text[:start], '\n')
+		}
+	}
+	return findings
+}
+
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
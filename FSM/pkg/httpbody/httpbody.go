@@ -0,0 +1,185 @@
+// Package httpbody validates an HTTP body with the validator its media type calls
+// for: JSON, XML, YAML, TOML, CSV, CBOR, MessagePack, JWT, GraphQL, URL-encoded forms,
+// event streams, session descriptions (SDP), or multipart, whose parts are validated
+// by their own media types in turn.
+package httpbody
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/bincheck"
+	"config-validator/pkg/csvcheck"
+	"config-validator/pkg/graphqlcheck"
+	"config-validator/pkg/httpmsg"
+	"config-validator/pkg/jwtcheck"
+	"config-validator/pkg/mediatype"
+	"config-validator/pkg/sdpcheck"
+	"config-validator/pkg/ssecheck"
+	"config-validator/pkg/tomlcheck"
+	"config-validator/pkg/validation"
+	"config-validator/pkg/xmlcheck"
+	"config-validator/pkg/yamlcheck"
+)
+
+// State is the state reported in findings about a body as a whole.
+const State = "BODY"
+
+// maxDepth is how deeply multipart bodies may nest.
+const maxDepth = 8
+
+// Kind returns the validator a media type selects, or "" when its bodies are not
+// checked.
+func Kind(m mediatype.MediaType) string {
+	switch essence, suffix := m.Essence(), m.Suffix(); {
+	case essence == "application/json", essence == "text/json", suffix == "json":
+		return "json"
+	case essence == "application/xml", essence == "text/xml", suffix == "xml":
+		return "xml"
+	case essence == "application/yaml", essence == "application/x-yaml", essence == "text/yaml", suffix == "yaml":
+		return "yaml"
+	case essence == "application/toml":
+		return "toml"
+	case essence == "text/csv":
+		return "csv"
+	case essence == "application/cbor", suffix == "cbor":
+		return "cbor"
+	case essence == "application/msgpack", essence == "application/x-msgpack", essence == "application/vnd.msgpack":
+		return "msgpack"
+	case essence == "application/jwt", suffix == "jwt":
+		return "jwt"
+	case essence == "application/graphql":
+		return "graphql"
+	case essence == "application/x-www-form-urlencoded":
+		return "form"
+	case essence == "text/event-stream":
+		return "event-stream"
+	case essence == "application/sdp":
+		return "sdp"
+	case m.Type == "multipart":
+		return "multipart"
+	case m.Type == "text":
+		return "text"
+	}
+	return ""
+}
+
+// Check validates a body of media type m. line is the line the body starts on, so
+// findings point into the file holding it.
+func Check(m mediatype.MediaType, body []byte, line int) []automata.Finding {
+	return check(m, body, line, 0)
+}
+
+func check(m mediatype.MediaType, body []byte, line, depth int) []automata.Finding {
+	var findings []automata.Finding
+	switch Kind(m) {
+	case "json":
+		if !utf8.Valid(body) {
+			findings = append(findings, finding(1, automata.SeverityError, "JSON body is not valid UTF-8"))
+		}
+		findings = append(findings, validation.CheckJSON(body)...)
+		if len(findings) == 0 {
+			// GraphQL over HTTP sends the query as a member of a JSON body
+			findings = graphqlcheck.CheckRequest(body)
+		}
+	case "graphql":
+		findings = graphqlcheck.Check(body)
+	case "form":
+		findings = form(m, body)
+	case "event-stream":
+		if cs := m.Params["charset"]; cs != "" && !strings.EqualFold(cs, "utf-8") {
+			findings = append(findings, finding(1, automata.SeverityError, fmt.Sprintf("event streams are always UTF-8, not charset %s", cs)))
+		}
+		findings = append(findings, ssecheck.Check(body)...)
+	case "sdp":
+		findings = sdpcheck.Check(body)
+	case "xml":
+		findings = xmlcheck.Findings(xmlcheck.Check(body))
+	case "yaml":
+		findings = yamlcheck.Check(body)
+	case "toml":
+		findings = tomlcheck.Check(body)
+	case "csv":
+		csvcheck.Check(bytes.NewReader(body), csvcheck.Options{NoHeader: m.Params["header"] == "absent"}, func(f automata.Finding) {
+			findings = append(findings, f)
+		})
+	case "cbor":
+		findings, _ = bincheck.CheckCBOR(body, false)
+		return findings // offsets, not lines
+	case "msgpack":
+		findings, _ = bincheck.CheckMsgPack(body, false)
+		return findings
+	case "jwt":
+		return jwtcheck.Check(jwtcheck.Token{Line: line, Value: strings.TrimSpace(string(body))}, jwtcheck.Options{})
+	case "multipart":
+		if depth >= maxDepth {
+			return []automata.Finding{finding(line, automata.SeverityError, fmt.Sprintf("multipart bodies nest more than %d deep", maxDepth))}
+		}
+		return multipart(m, body, line, depth)
+	case "text":
+		if strings.EqualFold(m.Params["charset"], "utf-8") && !utf8.Valid(body) {
+			findings = append(findings, finding(1, automata.SeverityError, "body is not valid UTF-8, as its charset says"))
+		}
+	}
+	for i := range findings {
+		if findings[i].Line > 0 {
+			findings[i].Line += line - 1
+		}
+	}
+	return findings
+}
+
+func finding(line int, severity, msg string) automata.Finding {
+	return automata.Finding{Line: line, State: State, Message: msg, Severity: severity}
+}
+
+// Sniff guesses the media type of a body that has none from its first byte: JSON
+// starts with '{' or '[', XML with '<'.
+func Sniff(body []byte) (mediatype.MediaType, bool) {
+	trimmed := bytes.TrimLeft(bytes.TrimPrefix(body, []byte("\ufeff")), " \t\r\n")
+	switch {
+	case len(trimmed) == 0:
+	case trimmed[0] == '{' || trimmed[0] == '[':
+		return mediatype.MediaType{Type: "application", Subtype: "json", Params: map[string]string{}}, true
+	case trimmed[0] == '<':
+		return mediatype.MediaType{Type: "application", Subtype: "xml", Params: map[string]string{}}, true
+	}
+	return mediatype.MediaType{}, false
+}
+
+// CheckMessage validates the Content-Type of a parsed HTTP message and its body by
+// that type. A bare body, without headers, is checked by what it looks like.
+func CheckMessage(msg *httpmsg.Message) []automata.Finding {
+	if msg.Opaque || len(bytes.TrimSpace(msg.Body)) == 0 {
+		return nil
+	}
+	var findings []automata.Finding
+	types := msg.Values("Content-Type")
+	if len(types) == 0 {
+		m, ok := Sniff(msg.Body)
+		if msg.StartLine != "" {
+			text := "message has a body but no Content-Type header"
+			if ok {
+				text += "; checking it as " + m.Essence()
+			}
+			findings = append(findings, finding(msg.BodyLine, automata.SeverityWarning, text))
+		}
+		if !ok {
+			return findings
+		}
+		return append(findings, Check(m, msg.Body, msg.BodyLine)...)
+	}
+	for _, h := range types[1:] {
+		findings = append(findings, automata.Finding{Line: h.Line, Command: h.Name + ": " + h.Value, State: mediatype.State,
+			Message: "Content-Type is given more than once", Severity: automata.SeverityError})
+	}
+	m, typeFindings := mediatype.Parse(types[0].Value, types[0].Line)
+	findings = append(findings, typeFindings...)
+	if m.Type == "" {
+		return findings
+	}
+	return append(findings, Check(m, msg.Body, msg.BodyLine)...)
+}
@@ -0,0 +1,170 @@
+package httpbody
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/httpmsg"
+	"config-validator/pkg/mediatype"
+)
+
+// MultipartState is the state reported in findings about multipart framing.
+const MultipartState = "MULTIPART"
+
+// bodyLine is a line of a body with the offsets of its start and its line ending.
+type bodyLine struct {
+	text       string
+	start, end int // end is where the line ending starts
+}
+
+func splitLines(body []byte) []bodyLine {
+	var lines []bodyLine
+	for pos := 0; pos < len(body); {
+		next := len(body)
+		end := len(body)
+		if i := bytes.IndexByte(body[pos:], '\n'); i >= 0 {
+			end, next = pos+i, pos+i+1
+			if end > pos && body[end-1] == '\r' {
+				end--
+			}
+		}
+		lines = append(lines, bodyLine{text: string(body[pos:end]), start: pos, end: end})
+		pos = next
+	}
+	return lines
+}
+
+// multipart checks the framing of a multipart body (RFC 2046 section 5.1) and
+// validates each part by its own Content-Type.
+func multipart(m mediatype.MediaType, body []byte, line, depth int) []automata.Finding {
+	var findings []automata.Finding
+	add := func(n int, severity, msg string) {
+		findings = append(findings, automata.Finding{Line: n, State: MultipartState, Message: msg, Severity: severity})
+	}
+	boundary, ok := m.Params["boundary"]
+	if !ok || boundary == "" {
+		return nil // reported with the Content-Type
+	}
+	delimiter, closing := "--"+boundary, "--"+boundary+"--"
+
+	lines := splitLines(body)
+	// kind returns 1 for a delimiter line, 2 for the close delimiter, and 0 otherwise.
+	kind := func(text string) int {
+		text = strings.TrimRight(text, " \t")
+		switch {
+		case text == closing:
+			return 2
+		case text == delimiter:
+			return 1
+		}
+		return 0
+	}
+
+	i := 0
+	for i < len(lines) && kind(lines[i].text) == 0 {
+		i++ // the preamble
+	}
+	if i == len(lines) {
+		add(line, automata.SeverityError, fmt.Sprintf("body has no %q delimiter line", delimiter))
+		return findings
+	}
+	if kind(lines[i].text) == 2 {
+		add(line+i, automata.SeverityError, "multipart body has no parts")
+		return findings
+	}
+
+	parts := 0
+	for closed := false; !closed; {
+		open := i
+		i++
+		// The part's headers run up to an empty line.
+		var headers []httpmsg.Header
+		for ; i < len(lines) && lines[i].text != "" && kind(lines[i].text) == 0; i++ {
+			h, msg := httpmsg.ParseHeader(lines[i].text)
+			if msg != "" {
+				add(line+i, automata.SeverityError, "part header: "+msg)
+			}
+			if h.Name != "" {
+				h.Line = line + i
+				headers = append(headers, h)
+			}
+		}
+		bodyStart := i + 1
+		if i >= len(lines) || lines[i].text != "" {
+			add(line+open, automata.SeverityError, "part headers do not end with an empty line")
+			bodyStart = i
+		}
+		j := bodyStart
+		for j < len(lines) && kind(lines[j].text) == 0 {
+			j++
+		}
+		if j == len(lines) {
+			add(line+len(lines)-1, automata.SeverityError, fmt.Sprintf("body does not end with the close delimiter %q", closing))
+			closed = true
+		} else {
+			closed = kind(lines[j].text) == 2
+		}
+		parts++
+
+		// The line ending before a delimiter belongs to the delimiter.
+		var content []byte
+		if bodyStart < j {
+			content = body[lines[bodyStart].start:lines[j-1].end]
+		} else if bodyStart < len(lines) && j == len(lines) {
+			content = body[lines[bodyStart].start:]
+		}
+		findings = append(findings, part(m, headers, content, line+open, line+bodyStart, depth)...)
+		i = j
+	}
+	return findings
+}
+
+// part validates one part of a multipart body.
+func part(m mediatype.MediaType, headers []httpmsg.Header, content []byte, line, bodyLine, depth int) []automata.Finding {
+	var findings []automata.Finding
+	var contentType, disposition *httpmsg.Header
+	for k := range headers {
+		switch h := &headers[k]; strings.ToLower(h.Name) {
+		case "content-type":
+			if contentType != nil {
+				findings = append(findings, automata.Finding{Line: h.Line, Command: h.Name + ": " + h.Value, State: MultipartState,
+					Message: "part has more than one Content-Type", Severity: automata.SeverityError})
+			}
+			contentType = h
+		case "content-disposition":
+			disposition = h
+		}
+	}
+
+	if m.Subtype == "form-data" {
+		// A disposition value has the same grammar as a media type's parameters.
+		switch {
+		case disposition == nil:
+			findings = append(findings, automata.Finding{Line: line, State: MultipartState,
+				Message: "multipart/form-data parts need a Content-Disposition: form-data; name=\"...\" header", Severity: automata.SeverityError})
+		default:
+			d, _ := mediatype.Parse("x/"+disposition.Value, disposition.Line)
+			if !strings.EqualFold(strings.TrimSpace(strings.Split(disposition.Value, ";")[0]), "form-data") {
+				findings = append(findings, automata.Finding{Line: disposition.Line, Command: disposition.Name + ": " + disposition.Value, State: MultipartState,
+					Message: "Content-Disposition of a form-data part must be form-data", Severity: automata.SeverityError})
+			} else if _, ok := d.Params["name"]; !ok {
+				findings = append(findings, automata.Finding{Line: disposition.Line, Command: disposition.Name + ": " + disposition.Value, State: MultipartState,
+					Message: "Content-Disposition of a form-data part needs a name parameter", Severity: automata.SeverityError})
+			}
+		}
+	}
+
+	// Parts without a Content-Type are text/plain (RFC 2046 section 5.1).
+	pm := mediatype.MediaType{Type: "text", Subtype: "plain", Params: map[string]string{"charset": "us-ascii"}}
+	if contentType != nil {
+		var typeFindings []automata.Finding
+		pm, typeFindings = mediatype.Parse(contentType.Value, contentType.Line)
+		findings = append(findings, typeFindings...)
+	}
+	if len(content) == 0 {
+		return findings
+	}
+	return append(findings, check(pm, content, bodyLine, depth+1)...)
+}
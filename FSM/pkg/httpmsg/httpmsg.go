@@ -0,0 +1,400 @@
+// Package httpmsg parses HTTP/1.x messages as captured in files: the start line, the
+// header fields, and the body, which is de-chunked and decompressed so it can be
+// validated by its media type. Framing problems, including the ones request smuggling
+// relies on, are reported as findings.
+package httpmsg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"config-validator/pkg/automata"
+)
+
+// State is the state reported in HTTP findings.
+const State = "HTTP"
+
+// Header is a header field and the line it is on.
+type Header struct {
+	Name  string
+	Value string
+	Line  int
+}
+
+// Message is a parsed HTTP message. StartLine is empty when the input was a bare
+// body without a start line or headers.
+type Message struct {
+	StartLine string
+	Request   bool
+	Method    string
+	Target    string
+	Status    int
+	Version   string
+	Headers   []Header
+	Body      []byte // de-chunked and decompressed
+	BodyLine  int    // line the body starts on
+	Opaque    bool   // the body could not be decoded, so it is not checked
+}
+
+// Get returns the first header field with the name, ignoring case.
+func (m *Message) Get(name string) (Header, bool) {
+	for _, h := range m.Headers {
+		if strings.EqualFold(h.Name, name) {
+			return h, true
+		}
+	}
+	return Header{}, false
+}
+
+// Values returns every header field with the name, ignoring case.
+func (m *Message) Values(name string) []Header {
+	var hs []Header
+	for _, h := range m.Headers {
+		if strings.EqualFold(h.Name, name) {
+			hs = append(hs, h)
+		}
+	}
+	return hs
+}
+
+var (
+	statusRe  = regexp.MustCompile(`^HTTP/(\d\.\d) (\d{3})(?: (.*))?$`)
+	versionRe = regexp.MustCompile(`^HTTP/\d\.\d$`)
+)
+
+type parser struct {
+	src      []byte
+	pos      int
+	line     int
+	findings []automata.Finding
+}
+
+func (p *parser) add(line int, command, severity, msg string) {
+	p.findings = append(p.findings, automata.Finding{
+		Line: line, Command: command, State: State, Message: msg, Severity: severity,
+	})
+}
+
+// next returns the next line without its line ending, and false at the end.
+func (p *parser) next() (string, bool) {
+	if p.pos >= len(p.src) {
+		return "", false
+	}
+	p.line++
+	end := bytes.IndexByte(p.src[p.pos:], '\n')
+	if end < 0 {
+		line := p.src[p.pos:]
+		p.pos = len(p.src)
+		return string(line), true
+	}
+	line := p.src[p.pos : p.pos+end]
+	p.pos += end + 1
+	return strings.TrimSuffix(string(line), "\r"), true
+}
+
+// Parse parses an HTTP/1.x request or response. Input that starts with '{', '[', or
+// '<' is taken as a bare body.
+func Parse(content []byte) (*Message, []automata.Finding) {
+	p := &parser{src: content}
+	m := &Message{}
+
+	// A request may be preceded by empty lines (RFC 9112 section 2.2).
+	start, ok := "", false
+	for {
+		mark, line := p.pos, p.line
+		if start, ok = p.next(); !ok || strings.TrimSpace(start) != "" {
+			if trimmed := strings.TrimSpace(start); strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") || strings.HasPrefix(trimmed, "<") {
+				p.pos, p.line = mark, line
+				m.Body, m.BodyLine = content[mark:], line+1
+				return m, nil
+			}
+			break
+		}
+	}
+	if !ok {
+		p.add(0, "", automata.SeverityError, "message is empty")
+		return m, p.findings
+	}
+	m.StartLine = start
+	p.startLine(m, start)
+	p.headers(m)
+	m.BodyLine = p.line + 1
+	p.body(m, content[p.pos:])
+	return m, p.findings
+}
+
+func (p *parser) startLine(m *Message, line string) {
+	if strings.HasPrefix(line, "HTTP/") {
+		sm := statusRe.FindStringSubmatch(line)
+		if sm == nil {
+			p.add(p.line, line, automata.SeverityError, "status line must be HTTP/x.y SP 3-digit status SP reason")
+			return
+		}
+		m.Version = "HTTP/" + sm[1]
+		m.Status, _ = strconv.Atoi(sm[2])
+		if m.Status < 100 {
+			p.add(p.line, line, automata.SeverityError, fmt.Sprintf("status %d is not in the range 100-599", m.Status))
+		}
+		return
+	}
+
+	m.Request = true
+	parts := strings.Split(line, " ")
+	if len(parts) != 3 {
+		p.add(p.line, line, automata.SeverityError, "request line must be METHOD SP target SP HTTP/x.y, with single spaces")
+		return
+	}
+	m.Method, m.Target, m.Version = parts[0], parts[1], parts[2]
+	switch {
+	case !isToken(m.Method):
+		p.add(p.line, line, automata.SeverityError, fmt.Sprintf("method %q is not a token", m.Method))
+	case strings.ToUpper(m.Method) != m.Method && isStandardMethod(strings.ToUpper(m.Method)):
+		p.add(p.line, line, automata.SeverityError, fmt.Sprintf("methods are case-sensitive: %s, not %s", strings.ToUpper(m.Method), m.Method))
+	}
+	if m.Target == "" || strings.ContainsAny(m.Target, "\t") {
+		p.add(p.line, line, automata.SeverityError, "request target is empty or has whitespace")
+	}
+	if !versionRe.MatchString(m.Version) {
+		p.add(p.line, line, automata.SeverityError, fmt.Sprintf("%q is not an HTTP/1.x version; HTTP/2 and HTTP/3 have no text form", m.Version))
+	}
+}
+
+func (p *parser) headers(m *Message) {
+	for {
+		line, ok := p.next()
+		if !ok {
+			if len(m.Headers) > 0 || m.StartLine != "" {
+				p.add(p.line, "", automata.SeverityWarning, "headers do not end with an empty line")
+			}
+			return
+		}
+		if line == "" {
+			return
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			p.add(p.line, line, automata.SeverityError, "obsolete line folding: header values may not continue on the next line (RFC 9112 section 5.2)")
+			if n := len(m.Headers); n > 0 {
+				m.Headers[n-1].Value += " " + strings.TrimSpace(line)
+			}
+			continue
+		}
+		h, msg := ParseHeader(line)
+		if msg != "" {
+			p.add(p.line, line, automata.SeverityError, msg)
+			if h.Name == "" {
+				continue
+			}
+		}
+		h.Line = p.line
+		m.Headers = append(m.Headers, h)
+	}
+}
+
+// ParseHeader parses a "Name: value" header line and says what is wrong with it.
+func ParseHeader(line string) (Header, string) {
+	name, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return Header{}, "header line has no ':'"
+	}
+	h := Header{Name: name, Value: strings.Trim(value, " \t")}
+	if strings.TrimRight(name, " \t") != name {
+		// A proxy and a server that disagree on this name can be made to frame the
+		// message differently.
+		h.Name = strings.TrimRight(name, " \t")
+		return h, fmt.Sprintf("whitespace between header name %q and ':' is not allowed (RFC 9112 section 5.1)", h.Name)
+	}
+	if !isToken(name) {
+		return Header{}, fmt.Sprintf("header name %q is not a token", name)
+	}
+	for i := 0; i < len(h.Value); i++ {
+		if c := h.Value[i]; (c < 0x20 && c != '\t') || c == 0x7f {
+			return h, fmt.Sprintf("header %s has control character 0x%02x in its value", name, c)
+		}
+	}
+	return h, ""
+}
+
+// body checks the framing headers against the body, and decodes it.
+func (p *parser) body(m *Message, body []byte) {
+	hosts := m.Values("Host")
+	if m.Request && m.Version == "HTTP/1.1" && len(hosts) == 0 {
+		p.add(1, m.StartLine, automata.SeverityError, "HTTP/1.1 requests need a Host header")
+	}
+	if len(hosts) > 1 {
+		p.add(hosts[1].Line, "Host: "+hosts[1].Value, automata.SeverityError, "Host header is given more than once")
+	}
+
+	te := m.Values("Transfer-Encoding")
+	lengths := m.Values("Content-Length")
+	length := -1
+	for _, h := range lengths {
+		cmd := "Content-Length: " + h.Value
+		n, err := strconv.Atoi(h.Value)
+		switch {
+		case err != nil || n < 0 || strings.ContainsAny(h.Value, "+-"):
+			p.add(h.Line, cmd, automata.SeverityError, "Content-Length must be a non-negative decimal number")
+		case length >= 0 && n != length:
+			p.add(h.Line, cmd, automata.SeveritySecurity, "Content-Length is given twice with different values: request smuggling risk")
+		default:
+			length = n
+		}
+	}
+	if len(te) > 0 && len(lengths) > 0 {
+		p.add(te[0].Line, "Transfer-Encoding: "+te[0].Value, automata.SeveritySecurity,
+			"both Transfer-Encoding and Content-Length are given: request smuggling risk (RFC 9112 section 6.1)")
+	}
+	if !m.Request && (m.Status < 200 || m.Status == 204 || m.Status == 304) && len(bytes.TrimSpace(body)) > 0 {
+		p.add(m.BodyLine, "", automata.SeverityError, fmt.Sprintf("%d responses have no body", m.Status))
+	}
+
+	switch {
+	case len(te) > 0:
+		var codings []string
+		for _, h := range te {
+			for _, c := range strings.Split(h.Value, ",") {
+				codings = append(codings, strings.ToLower(strings.TrimSpace(c)))
+			}
+		}
+		if codings[len(codings)-1] != "chunked" {
+			if m.Request {
+				p.add(te[0].Line, "Transfer-Encoding: "+te[0].Value, automata.SeverityError, "the last transfer coding of a request must be chunked")
+			}
+			m.Body = body
+			break
+		}
+		// A body whose chunks cannot be framed is not checked further, as its errors
+		// would follow from the framing.
+		before := len(p.findings)
+		m.Body = p.dechunk(body)
+		m.Opaque = len(p.findings) > before
+	case length >= 0:
+		// A file usually ends with a newline that is not part of the body.
+		trimmed := body
+		for _, end := range []string{"\r\n", "\n"} {
+			if len(body) == length+len(end) && bytes.HasSuffix(body, []byte(end)) {
+				trimmed = body[:length]
+			}
+		}
+		if len(trimmed) != length {
+			p.add(lengths[0].Line, "Content-Length: "+lengths[0].Value, automata.SeverityError,
+				fmt.Sprintf("Content-Length is %d, but the body has %d bytes", length, len(body)))
+		}
+		m.Body = trimmed
+	default:
+		m.Body = body
+	}
+	p.decode(m)
+}
+
+// dechunk decodes a chunked body (RFC 9112 section 7.1).
+func (p *parser) dechunk(body []byte) []byte {
+	var out []byte
+	p.src, p.pos = body, 0
+	for {
+		line, ok := p.next()
+		if !ok {
+			p.add(p.line, "", automata.SeverityError, "chunked body ends without the last chunk (0)")
+			return out
+		}
+		sizeText, _, _ := strings.Cut(line, ";") // chunk extensions
+		size, err := strconv.ParseUint(strings.TrimSpace(sizeText), 16, 31)
+		if err != nil {
+			p.add(p.line, line, automata.SeverityError, fmt.Sprintf("invalid chunk size %q: it must be hexadecimal", sizeText))
+			return out
+		}
+		if size == 0 {
+			for { // trailer fields, up to an empty line
+				trailer, ok := p.next()
+				if !ok || trailer == "" {
+					break
+				}
+				if _, msg := ParseHeader(trailer); msg != "" {
+					p.add(p.line, trailer, automata.SeverityError, "trailer: "+msg)
+				}
+			}
+			if rest := bytes.TrimSpace(p.src[p.pos:]); len(rest) > 0 {
+				p.add(p.line+1, "", automata.SeverityError, fmt.Sprintf("%d bytes after the end of the chunked body", len(rest)))
+			}
+			return out
+		}
+		if uint64(len(p.src)-p.pos) < size {
+			p.add(p.line, line, automata.SeverityError, fmt.Sprintf("chunk of %d bytes, but only %d are left", size, len(p.src)-p.pos))
+			return out
+		}
+		data := p.src[p.pos : p.pos+int(size)]
+		out = append(out, data...)
+		p.pos += int(size)
+		p.line += bytes.Count(data, []byte("\n"))
+		if end, _ := p.next(); end != "" {
+			p.add(p.line, line, automata.SeverityError, fmt.Sprintf("chunk data is not followed by a line break: the chunk size %d does not match the data", size))
+			return out
+		}
+	}
+}
+
+// Decode undoes the content codings of the body of a message that was not read by
+// Parse, such as one built from a net/http request.
+func Decode(m *Message) []automata.Finding {
+	p := &parser{}
+	p.decode(m)
+	return p.findings
+}
+
+// decode undoes the content codings of the body.
+func (p *parser) decode(m *Message) {
+	h, ok := m.Get("Content-Encoding")
+	if !ok || len(m.Body) == 0 {
+		return
+	}
+	for _, coding := range strings.Split(h.Value, ",") {
+		var r io.Reader
+		var err error
+		switch strings.ToLower(strings.TrimSpace(coding)) {
+		case "identity", "":
+			continue
+		case "gzip", "x-gzip":
+			r, err = gzip.NewReader(bytes.NewReader(m.Body))
+		case "deflate":
+			r, err = zlib.NewReader(bytes.NewReader(m.Body))
+		default:
+			p.add(h.Line, "Content-Encoding: "+h.Value, automata.SeverityWarning, fmt.Sprintf("body is %s-encoded, which cannot be decoded here, so it is not checked", coding))
+			m.Opaque = true
+			return
+		}
+		if err == nil {
+			m.Body, err = io.ReadAll(r)
+		}
+		if err != nil {
+			p.add(h.Line, "Content-Encoding: "+h.Value, automata.SeverityError, fmt.Sprintf("body is not valid %s data: %v", coding, err))
+			m.Opaque = true
+			return
+		}
+	}
+}
+
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func isStandardMethod(method string) bool {
+	switch method {
+	case "GET", "HEAD", "POST", "PUT", "DELETE", "CONNECT", "OPTIONS", "TRACE", "PATCH":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package httpmsg
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// requestLineRe matches a line that starts a request, for telling where one message
+// of several ends. Lines that merely look wrong are left to Parse.
+var requestLineRe = regexp.MustCompile(`^[A-Za-z]+ \S+ HTTP/\d\.\d$`)
+
+// Part is one of the messages of an input that holds several back to back.
+type Part struct {
+	Data   []byte
+	Line   int // input line its start line is on
+	Offset int // input byte offset its start line is at
+}
+
+// Split splits an input into the HTTP messages it holds back to back, as pipes and
+// log extracts do. A message ends where its framing says: after Content-Length bytes
+// of body, after the last chunk of a chunked body, or, without either, right after
+// the headers. A message whose framing is missing or wrong runs up to the next line
+// that starts a request or a response, so a body is never taken for a message. Empty
+// lines between messages belong to neither. Input that is one message, or a bare
+// body, is returned as one part.
+func Split(content []byte) []Part {
+	whole := []Part{{Data: content, Line: 1}}
+	var parts []Part
+	pos := skipEmptyLines(content, 0)
+	if pos == len(content) || !startsMessage(content[pos:]) {
+		return whole
+	}
+	for pos < len(content) {
+		bodyStart, headers := readHeaders(content, pos)
+		end := bodyStart
+		if framed := frameEnd(content, bodyStart, headers); framed >= 0 {
+			end = framed
+		}
+		next := skipEmptyLines(content, end)
+		if next < len(content) && !startsMessage(content[next:]) {
+			// The framing does not hold: the message runs to the next one
+			next = nextMessage(content, bodyStart)
+			end = bodyStart + len(bytes.TrimRight(content[bodyStart:next], "\r\n"))
+		}
+		if next == len(content) {
+			end = len(content) // the last message keeps its final line break, as Parse expects
+		}
+		parts = append(parts, Part{Data: content[pos:end], Line: bytes.Count(content[:pos], []byte("\n")) + 1, Offset: pos})
+		pos = next
+	}
+	if len(parts) == 1 {
+		return whole
+	}
+	return parts
+}
+
+// startsMessage reports whether data starts with a request or status line.
+func startsMessage(data []byte) bool {
+	line := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		line = data[:i]
+	}
+	s := strings.TrimSuffix(string(line), "\r")
+	return statusRe.MatchString(s) || requestLineRe.MatchString(s)
+}
+
+// skipEmptyLines returns the offset of the first line from pos on with text on it.
+func skipEmptyLines(content []byte, pos int) int {
+	for pos < len(content) {
+		end := len(content)
+		if i := bytes.IndexByte(content[pos:], '\n'); i >= 0 {
+			end = pos + i + 1
+		}
+		if len(bytes.TrimSpace(content[pos:end])) > 0 {
+			return pos
+		}
+		pos = end
+	}
+	return pos
+}
+
+// nextMessage returns the offset of the next line from pos on that starts a message,
+// or the end of the content.
+func nextMessage(content []byte, pos int) int {
+	for pos < len(content) {
+		if startsMessage(content[pos:]) {
+			return pos
+		}
+		i := bytes.IndexByte(content[pos:], '\n')
+		if i < 0 {
+			break
+		}
+		pos += i + 1
+	}
+	return len(content)
+}
+
+// readHeaders reads the start line and headers of the message at pos, and returns
+// where its body starts and its framing headers.
+func readHeaders(content []byte, pos int) (int, []Header) {
+	p := &parser{src: content, pos: pos}
+	p.next() // the start line
+	var headers []Header
+	for {
+		line, ok := p.next()
+		if !ok || line == "" {
+			return p.pos, headers
+		}
+		if h, _ := ParseHeader(line); h.Name != "" {
+			headers = append(headers, h)
+		}
+	}
+}
+
+// frameEnd returns where the body starting at pos ends by the framing headers, or -1
+// when they do not frame it.
+func frameEnd(content []byte, pos int, headers []Header) int {
+	m := &Message{Headers: headers}
+	if te := m.Values("Transfer-Encoding"); len(te) > 0 {
+		codings := strings.Split(te[len(te)-1].Value, ",")
+		if !strings.EqualFold(strings.TrimSpace(codings[len(codings)-1]), "chunked") {
+			return -1
+		}
+		return chunkedEnd(content, pos)
+	}
+	if h, ok := m.Get("Content-Length"); ok {
+		n, err := strconv.Atoi(h.Value)
+		if err != nil || n < 0 || pos+n > len(content) {
+			return -1
+		}
+		return pos + n
+	}
+	return pos
+}
+
+// chunkedEnd returns where the chunked body starting at pos ends, after its trailer
+// fields and the empty line, or -1 when its chunks cannot be framed.
+func chunkedEnd(content []byte, pos int) int {
+	p := &parser{src: content, pos: pos}
+	for {
+		line, ok := p.next()
+		if !ok {
+			return -1
+		}
+		sizeText, _, _ := strings.Cut(line, ";")
+		size, err := strconv.ParseUint(strings.TrimSpace(sizeText), 16, 31)
+		if err != nil {
+			return -1
+		}
+		if size == 0 {
+			for {
+				trailer, ok := p.next()
+				if !ok || trailer == "" {
+					return p.pos
+				}
+			}
+		}
+		if uint64(len(content)-p.pos) < size {
+			return -1
+		}
+		p.pos += int(size)
+		if end, ok := p.next(); !ok || end != "" {
+			return -1
+		}
+	}
+}
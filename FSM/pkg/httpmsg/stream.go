@@ -0,0 +1,134 @@
+package httpmsg
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"config-validator/pkg/automata"
+)
+
+// Stream reads the client side of an HTTP/1.1 connection: requests pipelined back to
+// back, as a server reads them. Unlike Split, it frames the requests strictly: a
+// request has a body only when Content-Length or Transfer-Encoding declares one
+// (RFC 9112 section 6.3), so undeclared body bytes are read as the next request and
+// put the stream out of sync, which is where reading stops. It returns the requests
+// it could frame, and findings about the stream: framing, requests the server would
+// never read after a connection closes or switches protocols, and pipelining after a
+// request that is not idempotent. Findings give the index and offset of their
+// request, which Label formats for the findings of the requests themselves.
+func Stream(content []byte) ([]Part, []automata.Finding) {
+	var parts []Part
+	var findings []automata.Finding
+	add := func(part Part, index int, severity, msg string) {
+		findings = append(findings, automata.Finding{Line: part.Line, State: State, Severity: severity, Message: Label(index, part.Offset) + msg})
+	}
+
+	var closedBy, switchedBy, unsafeBy string // the earlier request that ends or breaks off pipelining
+	pos := 0
+	for index := 1; ; index++ {
+		empty := 0
+		for pos < len(content) && (content[pos] == '\n' || bytes.HasPrefix(content[pos:], []byte("\r\n"))) {
+			pos += 1 + bytes.IndexByte(content[pos:], '\n')
+			empty++
+		}
+		if pos >= len(content) {
+			return parts, findings
+		}
+		part := Part{Line: bytes.Count(content[:pos], []byte("\n")) + 1, Offset: pos}
+		line, _, _ := bytes.Cut(content[pos:], []byte("\n"))
+		startLine := strings.TrimSuffix(string(line), "\r")
+		if statusRe.MatchString(startLine) {
+			add(part, index, automata.SeverityError, "a client stream holds requests only, but this is a status line")
+			return parts, findings
+		}
+		if !requestLineRe.MatchString(startLine) {
+			msg := fmt.Sprintf("stream is out of sync: %q is not a request line", truncate(startLine, 40))
+			if index > 1 {
+				msg += fmt.Sprintf("; it follows the end of request %d as framed, so that request has a body sent without Content-Length or Transfer-Encoding, or longer than declared", index-1)
+			}
+			add(part, index, automata.SeverityError, msg)
+			return parts, findings
+		}
+		if empty > 1 {
+			add(part, index, automata.SeverityWarning, fmt.Sprintf("%d empty lines before the request line; servers need only ignore one (RFC 9112 section 2.2)", empty))
+		}
+
+		m := &Message{Request: true}
+		m.Method, _, _ = strings.Cut(startLine, " ")
+		m.Version = startLine[strings.LastIndexByte(startLine, ' ')+1:]
+		label := fmt.Sprintf("%s request %d", m.Method, index)
+		switch {
+		case closedBy != "":
+			add(part, index, automata.SeverityError, fmt.Sprintf("sent after %s, which closes the connection, so the server never reads it", closedBy))
+		case switchedBy != "":
+			add(part, index, automata.SeverityWarning, fmt.Sprintf("sent after %s, which switches protocols, so once the server agrees the connection no longer speaks HTTP/1.1", switchedBy))
+		case unsafeBy != "":
+			add(part, index, automata.SeverityWarning, fmt.Sprintf("pipelined after %s, which is not idempotent; clients should wait for its response first (RFC 9112 section 9.3.2)", unsafeBy))
+		}
+
+		bodyStart, headers := readHeaders(content, pos)
+		m.Headers = headers
+		end := frameEnd(content, bodyStart, headers)
+		if end < 0 {
+			part.Data = content[pos:]
+			parts = append(parts, part)
+			add(part, index, automata.SeverityError, "the body cannot be framed by its Content-Length or Transfer-Encoding, so the rest of the stream is not read")
+			return parts, findings
+		}
+		part.Data = content[pos:end]
+		parts = append(parts, part)
+		pos = end
+
+		connection := strings.ToLower(headerList(m, "Connection"))
+		switch {
+		case closedBy != "" || switchedBy != "": // the first one counts
+		case strings.Contains(connection, "close"):
+			closedBy = label + " (Connection: close)"
+		case m.Version == "HTTP/1.0" && !strings.Contains(connection, "keep-alive"):
+			closedBy = label + " (HTTP/1.0 without keep-alive)"
+		case m.Method == "CONNECT":
+			switchedBy = label
+		case strings.Contains(connection, "upgrade"):
+			if h, ok := m.Get("Upgrade"); ok {
+				switchedBy = label + " (Upgrade: " + h.Value + ")"
+			}
+		}
+		unsafeBy = "" // warned about on the request right after it only
+		if !isIdempotent(m.Method) {
+			unsafeBy = label
+		}
+	}
+}
+
+// Label prefixes the message of a finding of a request of a stream with its index
+// and offset.
+func Label(index, offset int) string {
+	return fmt.Sprintf("request %d at offset %d: ", index, offset)
+}
+
+// headerList joins the values of every header field with the name, as a list.
+func headerList(m *Message, name string) string {
+	var values []string
+	for _, h := range m.Values(name) {
+		values = append(values, h.Value)
+	}
+	return strings.Join(values, ", ")
+}
+
+// isIdempotent reports whether repeating a request has the same effect as sending
+// it once (RFC 9110 section 9.2.2), which makes it safe to pipeline after.
+func isIdempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-3]) + "..."
+	}
+	return s
+}
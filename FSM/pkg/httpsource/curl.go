@@ -0,0 +1,567 @@
+package httpsource
+
+import (
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"config-validator/pkg/automata"
+)
+
+// CurlState is the state reported in findings about curl command lines.
+const CurlState = "CURL"
+
+// formBoundary is the boundary of the multipart bodies -F builds.
+const formBoundary = "------------------------configvalidator"
+
+// command is a curl command line split into words, as a POSIX shell would.
+type command struct {
+	line  int
+	words []string
+	err   string
+}
+
+// curlLong maps curl's short options to their long names.
+var curlLong = map[byte]string{
+	'X': "request", 'H': "header", 'd': "data", 'F': "form", 'u': "user", 'A': "user-agent",
+	'e': "referer", 'b': "cookie", 'o': "output", 'w': "write-out", 'm': "max-time", 'x': "proxy",
+	'E': "cert", 'T': "upload-file", 'r': "range", 'c': "cookie-jar", 'K': "config", 'I': "head",
+	'G': "get", 'L': "location", 'k': "insecure", 's': "silent", 'S': "show-error", 'v': "verbose",
+	'i': "include", 'f': "fail", 'g': "globoff", 'N': "no-buffer", 'O': "remote-name", 'q': "disable",
+	'0': "http1.0", '4': "ipv4", '6': "ipv6", 'j': "junk-session-cookies", 'J': "remote-header-name",
+	'Z': "parallel", 'n': "netrc", 'C': "continue-at", 'U': "proxy-user", 'Y': "speed-limit", 'y': "speed-time",
+}
+
+// curlArgs are the long options that take an argument.
+var curlArgs = map[string]bool{
+	"request": true, "header": true, "data": true, "data-ascii": true, "data-binary": true, "data-raw": true,
+	"data-urlencode": true, "json": true, "form": true, "form-string": true, "user": true, "user-agent": true,
+	"referer": true, "cookie": true, "output": true, "write-out": true, "max-time": true, "proxy": true,
+	"cert": true, "key": true, "cacert": true, "capath": true, "upload-file": true, "range": true,
+	"cookie-jar": true, "config": true, "url": true, "connect-timeout": true, "retry": true,
+	"retry-delay": true, "retry-max-time": true, "resolve": true, "connect-to": true, "interface": true,
+	"oauth2-bearer": true, "max-redirs": true, "continue-at": true, "proxy-user": true, "speed-limit": true,
+	"speed-time": true, "limit-rate": true, "trace": true, "trace-ascii": true, "dump-header": true,
+	"unix-socket": true, "aws-sigv4": true, "ciphers": true, "pinnedpubkey": true,
+}
+
+// curlFlags are the long options without an argument that do not change the request.
+var curlFlags = map[string]bool{
+	"location": true, "insecure": true, "silent": true, "show-error": true, "verbose": true, "include": true,
+	"fail": true, "fail-with-body": true, "globoff": true, "no-buffer": true, "remote-name": true,
+	"disable": true, "ipv4": true, "ipv6": true, "junk-session-cookies": true, "remote-header-name": true,
+	"parallel": true, "netrc": true, "http1.1": true, "http2": true, "http2-prior-knowledge": true,
+	"http3": true, "location-trusted": true, "progress-bar": true, "no-progress-meter": true,
+	"path-as-is": true, "tlsv1.2": true, "tlsv1.3": true, "ssl-reqd": true, "raw": true, "no-keepalive": true,
+}
+
+// Curl builds the requests of the curl commands in content. Commands may span lines
+// with backslash continuations; # comment lines are skipped. dir is the directory
+// that @file arguments are relative to.
+func Curl(content []byte, dir string) []Request {
+	var requests []Request
+	for _, cmd := range splitCommands(string(content)) {
+		requests = append(requests, curlRequest(cmd, dir))
+	}
+	return requests
+}
+
+// splitCommands splits text into shell command lines and their words: quoting with
+// '...', "...", and $'...', backslash escapes, and backslash-newline continuations.
+func splitCommands(s string) []command {
+	var commands []command
+	line := 1
+	cur := command{line: 1}
+	var word strings.Builder
+	inWord := false
+	endWord := func() {
+		if inWord {
+			cur.words = append(cur.words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	endCommand := func() {
+		endWord()
+		if len(cur.words) > 0 || cur.err != "" {
+			commands = append(commands, cur)
+		}
+		cur = command{line: line}
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '#' && !inWord && len(cur.words) == 0:
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+			i--
+		case c == '\\' && i+1 < len(s) && (s[i+1] == '\n' || strings.HasPrefix(s[i+1:], "\r\n")):
+			endWord()
+			if s[i+1] == '\r' {
+				i++
+			}
+			i++
+			line++
+		case c == '\\' && i+1 < len(s):
+			i++
+			word.WriteByte(s[i])
+			inWord = true
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				cur.err = "quote ' is not closed"
+				i = len(s)
+				break
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			line += strings.Count(s[i+1:i+1+end], "\n")
+			i += end + 1
+			inWord = true
+		case c == '$' && i+1 < len(s) && s[i+1] == '\'':
+			n, text, ok := ansiC(s[i+2:])
+			if !ok {
+				cur.err = "quote $' is not closed"
+				i = len(s)
+				break
+			}
+			word.WriteString(text)
+			line += strings.Count(s[i+2:i+2+n], "\n")
+			i += n + 1
+			inWord = true
+		case c == '"':
+			j := i + 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' && j+1 < len(s) && strings.IndexByte("$`\"\\\n", s[j+1]) >= 0 {
+					j++
+					if s[j] == '\n' {
+						line++
+						continue
+					}
+				} else if s[j] == '\n' {
+					line++
+				}
+				word.WriteByte(s[j])
+			}
+			if j == len(s) {
+				cur.err = "quote \" is not closed"
+			}
+			i = j
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\r':
+			endWord()
+		case c == '\n':
+			line++
+			endCommand()
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	endCommand()
+	return commands
+}
+
+// ansiC reads the rest of a $'...' string: how many bytes it takes up to and
+// including the closing quote, and its text.
+func ansiC(s string) (int, string, bool) {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\'':
+			return i + 1, sb.String(), true
+		case c == '\\' && i+1 < len(s):
+			i++
+			switch e := s[i]; e {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			case 'x', 'u', 'U':
+				digits := map[byte]int{'x': 2, 'u': 4, 'U': 8}[e]
+				end := i + 1
+				for end < len(s) && end < i+1+digits && strings.IndexByte("0123456789abcdefABCDEF", s[end]) >= 0 {
+					end++
+				}
+				n, err := strconv.ParseUint(s[i+1:end], 16, 32)
+				if err != nil {
+					sb.WriteByte('\\')
+					sb.WriteByte(e)
+					break
+				}
+				if e == 'x' {
+					sb.WriteByte(byte(n))
+				} else {
+					sb.WriteRune(rune(n))
+				}
+				i = end - 1
+			default:
+				sb.WriteByte(e) // \\, \', \", and others
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return 0, "", false
+}
+
+// curlRequest builds the request a curl command sends.
+func curlRequest(cmd command, dir string) Request {
+	var findings []automata.Finding
+	add := func(severity, msg string) {
+		findings = append(findings, finding(cmd.line, CurlState, severity, msg))
+	}
+	words := cmd.words
+	if len(words) > 0 && words[0] == "$" {
+		words = words[1:] // a copied shell prompt
+	}
+	if cmd.err != "" {
+		add(automata.SeverityError, cmd.err)
+		return Request{Line: cmd.line, Findings: findings}
+	}
+	if len(words) == 0 || filepath.Base(words[0]) != "curl" {
+		add(automata.SeverityError, fmt.Sprintf("not a curl command: %q", strings.Join(words, " ")))
+		return Request{Line: cmd.line, Findings: findings}
+	}
+
+	var (
+		method, rawURL, version string
+		headers                 []string
+		data                    []string
+		form                    []string
+		upload                  string
+		head, get, sendJSON     bool
+	)
+	option := func(name, arg string) {
+		switch name {
+		case "request":
+			method = arg
+		case "header":
+			headers = append(headers, arg)
+		case "user-agent":
+			headers = append(headers, "User-Agent: "+arg)
+		case "referer":
+			headers = append(headers, "Referer: "+arg)
+		case "cookie":
+			if !strings.Contains(arg, "=") {
+				add(automata.SeverityWarning, fmt.Sprintf("-b %s reads cookies from a file, which is not sent as written", arg))
+				return
+			}
+			headers = append(headers, "Cookie: "+arg)
+		case "range":
+			headers = append(headers, "Range: bytes="+arg)
+		case "user":
+			headers = append(headers, "Authorization: Basic "+base64.StdEncoding.EncodeToString([]byte(arg)))
+		case "oauth2-bearer":
+			headers = append(headers, "Authorization: Bearer "+arg)
+		case "data", "data-ascii", "data-binary", "data-raw", "json":
+			text, err := dataArg(name, arg, dir)
+			if err != nil {
+				add(automata.SeverityError, err.Error())
+			}
+			data = append(data, text)
+			sendJSON = sendJSON || name == "json"
+		case "data-urlencode":
+			text, err := urlencodeArg(arg, dir)
+			if err != nil {
+				add(automata.SeverityError, err.Error())
+			}
+			data = append(data, text)
+		case "form", "form-string":
+			form = append(form, arg)
+		case "upload-file":
+			upload = arg
+		case "url":
+			rawURL = arg
+		case "head":
+			head = true
+		case "get":
+			get = true
+		case "http1.0":
+			version = "HTTP/1.0"
+		case "compressed":
+			headers = append(headers, "Accept-Encoding: deflate, gzip")
+		}
+	}
+
+	for i := 1; i < len(words); i++ {
+		w := words[i]
+		next := func() (string, bool) {
+			if i+1 >= len(words) {
+				add(automata.SeverityError, fmt.Sprintf("option %s needs an argument", w))
+				return "", false
+			}
+			i++
+			return words[i], true
+		}
+		switch {
+		case w == "--":
+			if i+1 < len(words) {
+				rawURL = words[i+1]
+			}
+			i = len(words)
+		case strings.HasPrefix(w, "--"):
+			name := strings.TrimPrefix(w, "--")
+			switch {
+			case curlArgs[name]:
+				if arg, ok := next(); ok {
+					option(name, arg)
+				}
+			case curlFlags[name], name == "compressed", name == "head", name == "get", name == "http1.0":
+				option(name, "")
+			case strings.HasPrefix(name, "no-"):
+			default:
+				add(automata.SeverityWarning, fmt.Sprintf("curl option %s is not understood; it is ignored", w))
+			}
+		case strings.HasPrefix(w, "-") && len(w) > 1:
+			// Short options may be grouped, and the last may have its argument attached.
+			for j := 1; j < len(w); j++ {
+				name, known := curlLong[w[j]]
+				if !known {
+					add(automata.SeverityWarning, fmt.Sprintf("curl option -%c is not understood; it is ignored", w[j]))
+					continue
+				}
+				if !curlArgs[name] {
+					option(name, "")
+					continue
+				}
+				if j+1 < len(w) {
+					option(name, w[j+1:])
+				} else if arg, ok := next(); ok {
+					option(name, arg)
+				}
+				break
+			}
+		default:
+			if rawURL != "" {
+				add(automata.SeverityWarning, fmt.Sprintf("only the first URL is checked; %s is not", w))
+				continue
+			}
+			rawURL = w
+		}
+	}
+
+	if rawURL == "" {
+		add(automata.SeverityError, "curl command has no URL")
+		return Request{Line: cmd.line, Findings: findings}
+	}
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL // as curl assumes
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		add(automata.SeverityError, fmt.Sprintf("URL %q is not valid: %v", rawURL, err))
+		return Request{Line: cmd.line, Findings: findings}
+	}
+
+	var body []byte
+	contentType := ""
+	switch {
+	case len(form) > 0:
+		var msgs []string
+		body, msgs = formBody(form, dir)
+		for _, msg := range msgs {
+			add(automata.SeverityError, msg)
+		}
+		contentType = "multipart/form-data; boundary=" + formBoundary
+		if len(data) > 0 {
+			add(automata.SeverityError, "-F and -d cannot be combined: curl refuses to send both")
+		}
+	case len(data) > 0 && get:
+		joined := strings.Join(data, "&")
+		if u.RawQuery != "" {
+			u.RawQuery += "&" + joined
+		} else {
+			u.RawQuery = joined
+		}
+	case len(data) > 0:
+		body = []byte(strings.Join(data, "&"))
+		contentType = "application/x-www-form-urlencoded"
+		if sendJSON {
+			contentType = "application/json"
+			headers = append([]string{"Accept: application/json"}, headers...)
+		}
+	case upload != "":
+		var err error
+		if body, err = os.ReadFile(filepath.Join(dir, upload)); err != nil {
+			add(automata.SeverityError, fmt.Sprintf("-T %s: %v", upload, err))
+		}
+	}
+
+	if method == "" {
+		switch {
+		case head:
+			method = "HEAD"
+		case get:
+			method = "GET"
+		case upload != "":
+			method = "PUT"
+		case body != nil:
+			method = "POST"
+		default:
+			method = "GET"
+		}
+	}
+	if body != nil && (method == "GET" || method == "HEAD") {
+		add(automata.SeverityWarning, fmt.Sprintf("-X %s with data sends a body with %s; use -G to send the data in the query string", method, method))
+	}
+	if version == "" {
+		version = "HTTP/1.1"
+	}
+
+	// Headers given with -H replace curl's own; "Name:" removes one, and "Name;"
+	// sends it empty.
+	type field struct{ name, value string }
+	fields := []field{{"Host", u.Host}, {"User-Agent", "curl"}, {"Accept", "*/*"}}
+	if contentType != "" {
+		fields = append(fields, field{"Content-Type", contentType})
+	}
+	set := func(name, value string, remove bool) {
+		for k := range fields {
+			if strings.EqualFold(fields[k].name, name) {
+				if remove {
+					fields = append(fields[:k], fields[k+1:]...)
+				} else {
+					fields[k].value = value
+				}
+				return
+			}
+		}
+		if !remove {
+			fields = append(fields, field{name, value})
+		}
+	}
+	var raw []string // headers that are not name: value, passed on for the HTTP checks
+	for _, h := range headers {
+		name, value, ok := strings.Cut(h, ":")
+		switch {
+		case !ok && strings.HasSuffix(h, ";"):
+			set(strings.TrimSuffix(h, ";"), "", false)
+		case !ok:
+			raw = append(raw, h)
+		case strings.TrimSpace(value) == "":
+			set(name, "", true)
+		default:
+			set(name, strings.TrimSpace(value), false)
+		}
+	}
+	if body != nil {
+		set("Content-Length", strconv.Itoa(len(body)), false)
+	}
+
+	b := &builder{}
+	b.line(fmt.Sprintf("%s %s %s", method, u.RequestURI(), version), cmd.line)
+	for _, f := range fields {
+		b.line(f.name+": "+f.value, cmd.line)
+	}
+	for _, h := range raw {
+		b.line(h, cmd.line)
+	}
+	b.line("", cmd.line)
+	b.body(body, cmd.line, false)
+	return b.request(cmd.line, findings)
+}
+
+// dataArg reads the argument of -d and its variants. @file reads a file; -d and
+// --data-ascii drop its line breaks, as curl does.
+func dataArg(name, arg, dir string) (string, error) {
+	if name == "data-raw" || !strings.HasPrefix(arg, "@") {
+		return arg, nil
+	}
+	path := arg[1:]
+	if path == "-" {
+		return "", fmt.Errorf("--%s @- reads standard input, which cannot be checked", name)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, path))
+	if err != nil {
+		return "", fmt.Errorf("--%s %s: %v", name, arg, err)
+	}
+	if name == "data" || name == "data-ascii" {
+		return strings.NewReplacer("\r", "", "\n", "").Replace(string(content)), nil
+	}
+	return string(content), nil
+}
+
+// urlencodeArg reads the argument of --data-urlencode: content, =content,
+// name=content, @file, or name@file, of which the content is URL-encoded.
+func urlencodeArg(arg, dir string) (string, error) {
+	name, content := "", arg
+	if i := strings.IndexAny(arg, "=@"); i >= 0 {
+		name, content = arg[:i], arg[i+1:]
+		if arg[i] == '@' {
+			data, err := os.ReadFile(filepath.Join(dir, content))
+			if err != nil {
+				return "", fmt.Errorf("--data-urlencode %s: %v", arg, err)
+			}
+			content = string(data)
+		}
+	}
+	if name != "" {
+		return name + "=" + url.QueryEscape(content), nil
+	}
+	return url.QueryEscape(content), nil
+}
+
+// formBody builds the multipart/form-data body of -F arguments: name=value,
+// name=@file (a file upload), and name=<file (a value read from a file), each with an
+// optional ;type= and ;filename=.
+func formBody(form []string, dir string) ([]byte, []string) {
+	var sb strings.Builder
+	var problems []string
+	for _, arg := range form {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			problems = append(problems, fmt.Sprintf("-F %s is not name=content", arg))
+			continue
+		}
+		contentType, filename := "", ""
+		parts := strings.Split(value, ";")
+		value = parts[0]
+		for _, p := range parts[1:] {
+			k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+			switch k {
+			case "type":
+				contentType = v
+			case "filename":
+				filename = v
+			}
+		}
+		if strings.HasPrefix(value, "@") || strings.HasPrefix(value, "<") {
+			path := value[1:]
+			data, err := os.ReadFile(filepath.Join(dir, path))
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("-F %s: %v", arg, err))
+			}
+			if value[0] == '@' {
+				if filename == "" {
+					filename = filepath.Base(path)
+				}
+				if contentType == "" {
+					if contentType = mime.TypeByExtension(filepath.Ext(path)); contentType == "" {
+						contentType = "application/octet-stream"
+					}
+				}
+			}
+			value = string(data)
+		}
+		sb.WriteString("--" + formBoundary + "\r\n")
+		disposition := fmt.Sprintf("Content-Disposition: form-data; name=%q", name)
+		if filename != "" {
+			disposition += fmt.Sprintf("; filename=%q", filename)
+		}
+		sb.WriteString(disposition + "\r\n")
+		if contentType != "" {
+			sb.WriteString("Content-Type: " + contentType + "\r\n")
+		}
+		sb.WriteString("\r\n" + value + "\r\n")
+	}
+	sb.WriteString("--" + formBoundary + "--\r\n")
+	return []byte(sb.String()), problems
+}
@@ -0,0 +1,182 @@
+package httpsource
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/linereader"
+)
+
+// HTTPFileState is the state reported in findings about .http request files.
+const HTTPFileState = "HTTP_FILE"
+
+var (
+	// fileVarRe matches a file variable definition: @name = value.
+	fileVarRe = regexp.MustCompile(`^@([A-Za-z_][\w.-]*)\s*=\s*(.*)$`)
+	// varRe matches a variable reference: {{name}}.
+	varRe = regexp.MustCompile(`\{\{\s*([^{}]*?)\s*\}\}`)
+	// requestLineRe matches a request line: an optional method, the URL, and an
+	// optional version.
+	requestLineRe = regexp.MustCompile(`^(?:([A-Za-z]+)\s+)?(\S+)(?:\s+(HTTP/\S+))?$`)
+)
+
+// HTTPFile builds the requests of a .http request file, in the format of the VS Code
+// REST Client and JetBrains HTTP Client: requests separated by ### lines, # and //
+// comments, @name = value file variables used as {{name}}, and "< path" bodies read
+// from files relative to dir. Response handlers (> {% ... %} and > path) are skipped.
+func HTTPFile(content []byte, dir string) []Request {
+	var lines []string
+	scanner := linereader.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimSuffix(scanner.Text(), "\r"))
+	}
+
+	vars := map[string]string{}
+	var requests []Request
+	start := 0
+	for i := 0; i <= len(lines); i++ {
+		if i == len(lines) || strings.HasPrefix(lines[i], "###") {
+			if r, ok := httpFileRequest(lines, start, i, vars, dir); ok {
+				requests = append(requests, r)
+			}
+			start = i + 1
+		}
+	}
+	return requests
+}
+
+// httpFileRequest builds the request in lines[from:to], if there is one. File
+// variables defined before the request line are added to vars.
+func httpFileRequest(lines []string, from, to int, vars map[string]string, dir string) (Request, bool) {
+	var findings []automata.Finding
+	add := func(n int, severity, msg string) {
+		findings = append(findings, finding(n+1, HTTPFileState, severity, msg))
+	}
+	undefined := map[string]bool{}
+	expand := func(n int, s string) string {
+		return varRe.ReplaceAllStringFunc(s, func(ref string) string {
+			name := varRe.FindStringSubmatch(ref)[1]
+			if v, ok := vars[name]; ok {
+				return v
+			}
+			// Dynamic ({{$uuid}}), environment, and response variables are only known
+			// when the request is sent.
+			if !strings.HasPrefix(name, "$") && !undefined[name] {
+				undefined[name] = true
+				add(n, automata.SeverityWarning, fmt.Sprintf("variable {{%s}} is not defined in this file; it is checked as written", name))
+			}
+			return ref
+		})
+	}
+	comment := func(s string) bool {
+		t := strings.TrimSpace(s)
+		return strings.HasPrefix(t, "#") || strings.HasPrefix(t, "//")
+	}
+
+	i := from
+	for ; i < to; i++ {
+		line := strings.TrimSpace(lines[i])
+		if m := fileVarRe.FindStringSubmatch(line); m != nil {
+			vars[m[1]] = expand(i, m[2])
+			continue
+		}
+		if line != "" && !comment(line) {
+			break
+		}
+	}
+	if i == to {
+		return Request{}, false
+	}
+	reqLine := i
+	m := requestLineRe.FindStringSubmatch(strings.TrimSpace(expand(i, lines[i])))
+	if m == nil {
+		add(i, automata.SeverityError, fmt.Sprintf("request line %q is not [METHOD] URL [HTTP/version]", strings.TrimSpace(lines[i])))
+		return Request{Line: i + 1, Findings: findings}, true
+	}
+	method, target, version := m[1], m[2], m[3]
+	if method == "" {
+		method = "GET"
+	}
+	if version == "" {
+		version = "HTTP/1.1"
+	}
+	// The query may continue on indented lines starting with ? or &.
+	for i+1 < to {
+		next := strings.TrimSpace(lines[i+1])
+		if next == "" || (next[0] != '?' && next[0] != '&') || lines[i+1][0] != ' ' && lines[i+1][0] != '\t' {
+			break
+		}
+		i++
+		target += expand(i, next)
+	}
+
+	host := ""
+	if strings.Contains(target, "://") {
+		u, err := url.Parse(target)
+		if err != nil || u.Host == "" {
+			add(reqLine, automata.SeverityError, fmt.Sprintf("URL %q is not valid: %v", target, err))
+		} else {
+			host, target = u.Host, u.RequestURI()
+		}
+	}
+
+	b := &builder{}
+	b.line(fmt.Sprintf("%s %s %s", method, target, version), reqLine+1)
+	var headerLines []int
+	i++
+	for ; i < to && strings.TrimSpace(lines[i]) != ""; i++ {
+		if comment(lines[i]) {
+			continue
+		}
+		headerLines = append(headerLines, i)
+	}
+	hasHost := false
+	for _, n := range headerLines {
+		name, _, _ := strings.Cut(lines[n], ":")
+		hasHost = hasHost || strings.EqualFold(strings.TrimSpace(name), "Host")
+	}
+	if host != "" && !hasHost {
+		b.line("Host: "+host, reqLine+1)
+	}
+	for _, n := range headerLines {
+		b.line(expand(n, lines[n]), n+1)
+	}
+	b.line("", i+1)
+
+	// The body runs to the next request, without response handlers and the empty
+	// lines before the separator.
+	i++
+	end := to
+	for k := i; k < to; k++ {
+		if t := strings.TrimSpace(lines[k]); strings.HasPrefix(t, "> ") || strings.HasPrefix(t, "<> ") {
+			end = k
+			break
+		}
+	}
+	for end > i && strings.TrimSpace(lines[end-1]) == "" {
+		end--
+	}
+	if end > i {
+		if t := strings.TrimSpace(lines[i]); end == i+1 && strings.HasPrefix(t, "< ") {
+			path := strings.TrimSpace(expand(i, t[2:]))
+			data, err := os.ReadFile(filepath.Join(dir, path))
+			if err != nil {
+				add(i, automata.SeverityError, fmt.Sprintf("body file: %v", err))
+			}
+			b.body(data, i+1, false)
+		} else {
+			body := make([]string, 0, end-i)
+			for k := i; k < end; k++ {
+				body = append(body, expand(k, lines[k]))
+			}
+			b.body([]byte(strings.Join(body, "\n")), i+1, true)
+		}
+	}
+	return b.request(reqLine+1, findings), true
+}
@@ -0,0 +1,84 @@
+// Package httpsource builds raw HTTP messages from the forms developers write requests
+// in, curl command lines and .http request files, so the requests can be validated
+// as they are sent, and takes them out of the JSON test fixtures that embed them.
+// Each line of a built message remembers the input line it came from, so findings
+// point into the input.
+package httpsource
+
+import (
+	"bytes"
+	"fmt"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/httpbody"
+	"config-validator/pkg/httpmsg"
+)
+
+// Request is an HTTP request built from an input.
+type Request struct {
+	Line     int                // input line the request starts on
+	Message  []byte             // the raw HTTP/1.1 message
+	Lines    []int              // input line of each line of Message
+	Findings []automata.Finding // problems found while building the message
+	Path     string             // JSONPath of the string the message was taken from, see JSONField
+}
+
+// Check validates the built message and its body, and any further checks of the
+// message, and returns the findings on input lines, after the problems found while
+// building it.
+func (r Request) Check(checks ...func(*httpmsg.Message) []automata.Finding) []automata.Finding {
+	msg, findings := httpmsg.Parse(r.Message)
+	findings = append(findings, httpbody.CheckMessage(msg)...)
+	for _, check := range checks {
+		findings = append(findings, check(msg)...)
+	}
+	for i := range findings {
+		if r.Path != "" { // the message is on one line of the input, so say where in it
+			if n := findings[i].Line; n >= 1 {
+				findings[i].Message = fmt.Sprintf("%s line %d: %s", r.Path, n, findings[i].Message)
+			} else {
+				findings[i].Message = fmt.Sprintf("%s: %s", r.Path, findings[i].Message)
+			}
+		}
+		if n := findings[i].Line; n >= 1 && n <= len(r.Lines) {
+			findings[i].Line = r.Lines[n-1]
+		} else {
+			findings[i].Line = r.Line
+		}
+	}
+	return append(append([]automata.Finding(nil), r.Findings...), findings...)
+}
+
+// builder writes a message and the input line of each of its lines.
+type builder struct {
+	buf   bytes.Buffer
+	lines []int
+}
+
+// line writes a line of the start line or headers.
+func (b *builder) line(text string, src int) {
+	b.buf.WriteString(text)
+	b.buf.WriteString("\r\n")
+	b.lines = append(b.lines, src)
+}
+
+// body writes the body. With step, its lines came from consecutive input lines
+// starting at src; otherwise all of them are attributed to src.
+func (b *builder) body(data []byte, src int, step bool) {
+	b.buf.Write(data)
+	for i := 0; i <= bytes.Count(data, []byte("\n")); i++ {
+		if step {
+			b.lines = append(b.lines, src+i)
+		} else {
+			b.lines = append(b.lines, src)
+		}
+	}
+}
+
+func (b *builder) request(line int, findings []automata.Finding) Request {
+	return Request{Line: line, Message: b.buf.Bytes(), Lines: b.lines, Findings: findings}
+}
+
+func finding(line int, state, severity, msg string) automata.Finding {
+	return automata.Finding{Line: line, State: state, Message: msg, Severity: severity}
+}
@@ -0,0 +1,212 @@
+package httpsource
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"config-validator/pkg/automata"
+)
+
+// JSONFieldState is the state reported in findings about JSON fixtures.
+const JSONFieldState = "JSON_FIELD"
+
+// identifierRe matches the keys a JSONPath can name without brackets.
+var identifierRe = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$-]*$`)
+
+// step is a step of a JSONPath: a member key, an array index, or a wildcard, and
+// with deep, at any depth below the previous step.
+type step struct {
+	key   string
+	index int // -1 for a member key
+	any   bool
+	deep  bool
+}
+
+// segment is a step of the path of a value in a document: a key, or an index.
+type segment struct {
+	key   string
+	index int // -1 for a member key
+}
+
+func (s step) matches(seg segment) bool {
+	return s.any || (s.index < 0 && seg.index < 0 && s.key == seg.key) || (s.index >= 0 && s.index == seg.index)
+}
+
+// parseJSONPath reads the subset of JSONPath that names fields of fixtures: $ for
+// the root, .name and ['name'] for members, [n] for array elements, * and [*] for
+// all of them, and .. before any of these for any depth.
+func parseJSONPath(path string) ([]step, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("JSONPath %q does not start with $", path)
+	}
+	var steps []step
+	for rest := path[1:]; rest != ""; {
+		s := step{index: -1}
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			s.deep, rest = true, rest[2:]
+			if strings.HasPrefix(rest, "[") {
+				break
+			}
+			fallthrough
+		case strings.HasPrefix(rest, "."):
+			rest = strings.TrimPrefix(rest, ".")
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			if name == "" {
+				return nil, fmt.Errorf("JSONPath %q has an empty name", path)
+			}
+			s.key, s.any, rest = name, name == "*", rest[end:]
+			steps = append(steps, s)
+			continue
+		case !strings.HasPrefix(rest, "["):
+			return nil, fmt.Errorf("JSONPath %q: expected . or [ at %q", path, rest)
+		}
+		end := strings.IndexByte(rest, ']')
+		if end < 0 {
+			return nil, fmt.Errorf("JSONPath %q has an unclosed [", path)
+		}
+		inner := strings.TrimSpace(rest[1:end])
+		rest = rest[end+1:]
+		switch {
+		case inner == "*":
+			s.any = true
+		case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+			s.key = inner[1 : len(inner)-1]
+		default:
+			n, err := strconv.Atoi(inner)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("JSONPath %q: [%s] is not an index, a quoted name, or *", path, inner)
+			}
+			s.index = n
+		}
+		steps = append(steps, s)
+	}
+	return steps, nil
+}
+
+// matchSteps reports whether a JSONPath selects the value at a path.
+func matchSteps(steps []step, path []segment) bool {
+	if len(steps) == 0 {
+		return len(path) == 0
+	}
+	if steps[0].deep {
+		for i := range path {
+			if steps[0].matches(path[i]) && matchSteps(steps[1:], path[i+1:]) {
+				return true
+			}
+		}
+		return false
+	}
+	return len(path) > 0 && steps[0].matches(path[0]) && matchSteps(steps[1:], path[1:])
+}
+
+// JSONField extracts the HTTP messages test fixtures hold in a JSON document, as
+// strings such as {"request": "GET / HTTP/1.1\r\nHost: ..."}: one from each string a
+// JSONPath selects. Each request is on the line of its string in the document, and
+// its Path names the string, so findings give both that line and the line within
+// the message. Selected values that are not strings, and a document that is not
+// valid JSON, are findings.
+func JSONField(content []byte, path string) ([]Request, []automata.Finding, error) {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	w := &jsonWalk{content: content, steps: steps, dec: json.NewDecoder(bytes.NewReader(content))}
+	if err := w.value("$", nil); err != nil {
+		line := lineAt(content, w.dec.InputOffset())
+		w.findings = append(w.findings, finding(line, JSONFieldState, automata.SeverityError, fmt.Sprintf("fixture is not valid JSON: %v", err)))
+	}
+	return w.requests, w.findings, nil
+}
+
+// jsonWalk reads a document value by value, with the offset each starts at, and
+// takes the messages of the values the JSONPath selects.
+type jsonWalk struct {
+	content  []byte
+	steps    []step
+	dec      *json.Decoder
+	requests []Request
+	findings []automata.Finding
+}
+
+func (w *jsonWalk) value(path string, segments []segment) error {
+	if matchSteps(w.steps, segments) {
+		return w.take(path)
+	}
+	tok, err := w.dec.Token()
+	if err != nil {
+		return err
+	}
+	switch tok {
+	case json.Delim('{'):
+		for w.dec.More() {
+			key, err := w.dec.Token()
+			if err != nil {
+				return err
+			}
+			k, _ := key.(string)
+			if err := w.value(memberPath(path, k), append(segments, segment{key: k, index: -1})); err != nil {
+				return err
+			}
+		}
+		_, err = w.dec.Token()
+	case json.Delim('['):
+		for i := 0; w.dec.More(); i++ {
+			if err := w.value(fmt.Sprintf("%s[%d]", path, i), append(segments, segment{index: i})); err != nil {
+				return err
+			}
+		}
+		_, err = w.dec.Token()
+	}
+	return err
+}
+
+// take reads a selected value: a string is a message, anything else a finding.
+func (w *jsonWalk) take(path string) error {
+	line := lineAt(w.content, valueStart(w.content, w.dec.InputOffset()))
+	var raw json.RawMessage
+	if err := w.dec.Decode(&raw); err != nil {
+		return err
+	}
+	var message string
+	if err := json.Unmarshal(raw, &message); err != nil {
+		kind := map[byte]string{'{': "an object", '[': "an array", 't': "a boolean", 'f': "a boolean", 'n': "null"}[raw[0]]
+		if kind == "" {
+			kind = "a number"
+		}
+		w.findings = append(w.findings, finding(line, JSONFieldState, automata.SeverityError,
+			fmt.Sprintf("%s is %s, not a string holding an HTTP message", path, kind)))
+		return nil
+	}
+	w.requests = append(w.requests, Request{Line: line, Path: path, Message: []byte(message)})
+	return nil
+}
+
+// memberPath is the path of an object member: $.name, or $['a b'] for keys that are
+// not identifiers.
+func memberPath(parent, key string) string {
+	if identifierRe.MatchString(key) {
+		return parent + "." + key
+	}
+	return parent + "['" + strings.ReplaceAll(key, "'", `\'`) + "']"
+}
+
+// valueStart skips the separators between the end of a token and the next value.
+func valueStart(content []byte, offset int64) int64 {
+	for offset < int64(len(content)) && strings.IndexByte(" \t\r\n,:", content[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
+
+func lineAt(content []byte, offset int64) int {
+	return bytes.Count(content[:min(offset, int64(len(content)))], []byte("\n")) + 1
+}
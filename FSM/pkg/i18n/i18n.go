@@ -0,0 +1,203 @@
+// Package i18n translates finding messages for reports delivered to operations
+// teams in other languages. The validators keep reporting in English, giving each
+// finding the id of its English template in catalog/en.yaml as its code; a catalog
+// takes the values out of the message with that template and renders the message in
+// the chosen language with them. Findings without a code, such as those of rule
+// scripts, are matched against every template and given the code of the one that
+// matches. Messages no template matches stay in English.
+package i18n
+
+import (
+	"embed"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"config-validator/pkg/automata"
+)
+
+//go:embed catalog/*.yaml
+var catalogs embed.FS
+
+// English is the language the validators report in.
+const English = "en"
+
+// Catalog localizes findings into one language.
+type Catalog struct {
+	Lang      string
+	templates []template
+	byID      map[string]template
+	messages  map[string]string // id -> translated template
+	terms     map[string]string
+}
+
+type template struct {
+	id     string
+	re     *regexp.Regexp
+	fields []string
+}
+
+var placeholderRe = regexp.MustCompile(`\{(\w+)\}`)
+
+// Languages returns the languages there is a catalog for.
+func Languages() []string {
+	entries, _ := catalogs.ReadDir("catalog")
+	var langs []string
+	for _, e := range entries {
+		langs = append(langs, strings.TrimSuffix(e.Name(), ".yaml"))
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Load returns the catalog of a language, given as a tag such as "es", "es-MX", or
+// a locale such as "ta_IN.UTF-8"; empty means English.
+func Load(lang string) (*Catalog, error) {
+	lang = normalize(lang)
+	var en struct {
+		Messages []struct {
+			ID   string `yaml:"id"`
+			Text string `yaml:"text"`
+		} `yaml:"messages"`
+	}
+	if err := readCatalog(English, &en); err != nil {
+		return nil, err
+	}
+	c := &Catalog{Lang: lang, byID: map[string]template{}, messages: map[string]string{}, terms: map[string]string{}}
+	for _, m := range en.Messages {
+		t := compile(m.ID, m.Text)
+		c.templates = append(c.templates, t)
+		c.byID[m.ID] = t
+		c.messages[m.ID] = m.Text
+	}
+	if lang == English {
+		return c, nil
+	}
+
+	var tr struct {
+		Messages map[string]string `yaml:"messages"`
+		Terms    map[string]string `yaml:"terms"`
+	}
+	if err := readCatalog(lang, &tr); err != nil {
+		return nil, fmt.Errorf("no messages for language %q (available: %s)", lang, strings.Join(Languages(), ", "))
+	}
+	for id, text := range tr.Messages {
+		english, ok := c.messages[id]
+		if !ok {
+			return nil, fmt.Errorf("catalog %s: unknown message id %q", lang, id)
+		}
+		for _, p := range placeholderRe.FindAllString(text, -1) {
+			if !strings.Contains(english, p) {
+				return nil, fmt.Errorf("catalog %s: message %s uses %s, which the English message has not", lang, id, p)
+			}
+		}
+		c.messages[id] = text
+	}
+	c.terms = tr.Terms
+	return c, nil
+}
+
+func readCatalog(lang string, v any) error {
+	data, err := catalogs.ReadFile("catalog/" + lang + ".yaml")
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("catalog %s: %w", lang, err)
+	}
+	return nil
+}
+
+// normalize reduces a language tag or locale to its primary language.
+func normalize(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if i := strings.IndexAny(lang, "-_.@"); i >= 0 {
+		lang = lang[:i]
+	}
+	if lang == "" || lang == "c" || lang == "posix" {
+		return English
+	}
+	return lang
+}
+
+// compile turns a template into a regexp capturing its placeholders.
+func compile(id, text string) template {
+	t := template{id: id}
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	last := 0
+	for _, m := range placeholderRe.FindAllStringSubmatchIndex(text, -1) {
+		pattern.WriteString(regexp.QuoteMeta(text[last:m[0]]))
+		pattern.WriteString("(.+?)")
+		t.fields = append(t.fields, text[m[2]:m[3]])
+		last = m[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(text[last:]))
+	pattern.WriteString("$")
+	t.re = regexp.MustCompile(pattern.String())
+	return t
+}
+
+// Localize returns the finding with its code set and its message translated.
+func (c *Catalog) Localize(f automata.Finding) automata.Finding {
+	if f.Code != "" {
+		t, ok := c.byID[f.Code]
+		if !ok {
+			return f
+		}
+		if m := t.re.FindStringSubmatch(f.Message); m != nil {
+			f.Message = c.render(t, m, f.Message)
+		}
+		return f
+	}
+	for _, t := range c.templates {
+		m := t.re.FindStringSubmatch(f.Message)
+		if m == nil {
+			continue
+		}
+		f.Code = t.id
+		f.Message = c.render(t, m, f.Message)
+		return f
+	}
+	return f
+}
+
+// render renders the message of a template in the catalog's language, with the
+// values the English template matched in msg.
+func (c *Catalog) render(t template, m []string, msg string) string {
+	if c.Lang == English {
+		return msg
+	}
+	values := map[string]string{}
+	for i, field := range t.fields {
+		values[field] = m[i+1]
+		if term, ok := c.terms[m[i+1]]; ok {
+			values[field] = term
+		}
+	}
+	return placeholderRe.ReplaceAllStringFunc(c.messages[t.id], func(p string) string {
+		return values[p[1:len(p)-1]]
+	})
+}
+
+// LocalizeAll localizes findings in place and returns them.
+func (c *Catalog) LocalizeAll(findings []automata.Finding) []automata.Finding {
+	for i, f := range findings {
+		findings[i] = c.Localize(f)
+	}
+	return findings
+}
+
+// LocalizeFSM localizes the findings of a validation run, and the Errors entries
+// rendered from them.
+func (c *Catalog) LocalizeFSM(fsm *automata.FSM) {
+	c.LocalizeAll(fsm.Findings)
+	if len(fsm.Errors) == len(fsm.Findings) {
+		for i, f := range fsm.Findings {
+			fsm.Errors[i] = automata.FormatFinding(f)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// Package ics validates industrial control system protocols carried over TCP, such
+// as Modbus/TCP, from the bytes each side of a connection sent. Each protocol is an
+// entry in Protocols, so others, such as DNP3, are added without changing callers.
+package ics
+
+import (
+	"fmt"
+	"sort"
+
+	"config-validator/pkg/automata"
+)
+
+// Protocol is an industrial protocol carried over TCP.
+type Protocol struct {
+	Name string
+	Port int // well-known server port
+	// Check validates a connection from what the client (master) and the server
+	// (outstation) sent. A side that was not captured is nil; messages are then
+	// checked without being paired.
+	Check func(client, server []byte) (clientFindings, serverFindings []automata.Finding)
+}
+
+// Protocols are the protocols validated, by name.
+var Protocols = map[string]Protocol{
+	"modbus": {Name: "Modbus/TCP", Port: 502, Check: CheckModbus},
+}
+
+// Names returns the names of the protocols, sorted.
+func Names() []string {
+	var names []string
+	for name := range Protocols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// findings collects the findings about one side of a connection, which are checked
+// in passes but reported in stream order.
+type findings struct {
+	state   string
+	list    []automata.Finding
+	offsets []int
+}
+
+func (f *findings) add(offset int, command, severity, format string, args ...any) {
+	f.list = append(f.list, automata.Finding{Command: command, State: f.state, Severity: severity,
+		Message: fmt.Sprintf("offset %d: %s", offset, fmt.Sprintf(format, args...))})
+	f.offsets = append(f.offsets, offset)
+}
+
+// sorted returns the findings by offset.
+func (f *findings) sorted() []automata.Finding {
+	sort.Stable(f)
+	return f.list
+}
+
+func (f *findings) Len() int           { return len(f.list) }
+func (f *findings) Less(i, j int) bool { return f.offsets[i] < f.offsets[j] }
+func (f *findings) Swap(i, j int) {
+	f.list[i], f.list[j] = f.list[j], f.list[i]
+	f.offsets[i], f.offsets[j] = f.offsets[j], f.offsets[i]
+}
@@ -0,0 +1,383 @@
+package ics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"config-validator/pkg/automata"
+)
+
+// ModbusState is the state reported in Modbus findings.
+const ModbusState = "MODBUS"
+
+// maxModbusLength is the largest MBAP length: the unit id and a PDU of 253 bytes,
+// for an ADU of 260.
+const maxModbusLength = 254
+
+// modbusFunctions are the public function codes, with those defined only for serial
+// lines marked.
+var modbusFunctions = map[byte]struct {
+	name   string
+	serial bool
+}{
+	1:  {"Read Coils", false},
+	2:  {"Read Discrete Inputs", false},
+	3:  {"Read Holding Registers", false},
+	4:  {"Read Input Registers", false},
+	5:  {"Write Single Coil", false},
+	6:  {"Write Single Register", false},
+	7:  {"Read Exception Status", true},
+	8:  {"Diagnostics", true},
+	11: {"Get Comm Event Counter", true},
+	12: {"Get Comm Event Log", true},
+	15: {"Write Multiple Coils", false},
+	16: {"Write Multiple Registers", false},
+	17: {"Report Server ID", true},
+	20: {"Read File Record", false},
+	21: {"Write File Record", false},
+	22: {"Mask Write Register", false},
+	23: {"Read/Write Multiple Registers", false},
+	24: {"Read FIFO Queue", false},
+	43: {"Encapsulated Interface Transport", false},
+}
+
+// modbusExceptions are the exception codes of exception responses.
+var modbusExceptions = map[byte]string{
+	1: "Illegal Function", 2: "Illegal Data Address", 3: "Illegal Data Value",
+	4: "Server Device Failure", 5: "Acknowledge", 6: "Server Device Busy",
+	8: "Memory Parity Error", 10: "Gateway Path Unavailable", 11: "Gateway Target Device Failed to Respond",
+}
+
+// adu is a Modbus/TCP application data unit: the MBAP header and the PDU.
+type adu struct {
+	offset int
+	tid    uint16
+	unit   byte
+	pdu    []byte // function code and data
+}
+
+// CheckModbus validates a Modbus/TCP connection: the MBAP header of each ADU, the
+// function codes and the format of requests and responses, and that every response
+// answers a request with the same transaction, unit, and function.
+func CheckModbus(client, server []byte) (clientFindings, serverFindings []automata.Finding) {
+	c, s := &findings{state: ModbusState}, &findings{state: ModbusState}
+	requests := modbusADUs(client, c)
+	responses := modbusADUs(server, s)
+
+	pending := map[uint16][]adu{} // outstanding requests by transaction
+	for _, a := range requests {
+		if p := pending[a.tid]; len(p) > 0 {
+			c.add(a.offset, modbusName(a.pdu[0]), automata.SeverityWarning,
+				"transaction %d is reused while its request at offset %d is outstanding", a.tid, p[0].offset)
+		}
+		checkModbusRequest(a, c)
+		pending[a.tid] = append(pending[a.tid], a)
+	}
+	for _, a := range responses {
+		var req *adu
+		if client != nil {
+			if p := pending[a.tid]; len(p) > 0 {
+				req = &p[0]
+				pending[a.tid] = p[1:]
+			} else {
+				s.add(a.offset, modbusName(a.pdu[0]&0x7f), automata.SeverityError, "response to transaction %d, which no request started", a.tid)
+			}
+		}
+		checkModbusResponse(a, req, s)
+	}
+	if server != nil {
+		for _, a := range requests {
+			if p := pending[a.tid]; len(p) > 0 && p[0].offset == a.offset {
+				c.add(a.offset, modbusName(a.pdu[0]), automata.SeverityWarning, "request of transaction %d got no response", a.tid)
+				pending[a.tid] = p[1:]
+			}
+		}
+	}
+	return c.sorted(), s.sorted()
+}
+
+// modbusADUs frames a stream into ADUs by their MBAP length, checking the header.
+func modbusADUs(data []byte, f *findings) []adu {
+	var adus []adu
+	for pos := 0; pos < len(data); {
+		if len(data)-pos < 8 {
+			f.add(pos, "", automata.SeverityWarning, "stream ends inside an MBAP header")
+			break
+		}
+		tid := binary.BigEndian.Uint16(data[pos:])
+		proto := binary.BigEndian.Uint16(data[pos+2:])
+		length := int(binary.BigEndian.Uint16(data[pos+4:]))
+		if proto != 0 {
+			f.add(pos, "", automata.SeverityError, "protocol identifier is %d; Modbus is 0", proto)
+		}
+		if length < 2 {
+			f.add(pos, "", automata.SeverityError, "MBAP length %d leaves no function code, so the stream cannot be framed further", length)
+			break
+		}
+		if length > maxModbusLength {
+			f.add(pos, "", automata.SeverityError, "MBAP length %d is more than %d; ADUs are at most 260 bytes", length, maxModbusLength)
+		}
+		if len(data)-pos-6 < length {
+			f.add(pos, "", automata.SeverityWarning, "stream ends inside an ADU of MBAP length %d", length)
+			break
+		}
+		adus = append(adus, adu{offset: pos, tid: tid, unit: data[pos+6], pdu: data[pos+7 : pos+6+length]})
+		pos += 6 + length
+	}
+	return adus
+}
+
+func modbusName(fc byte) string {
+	if fn, ok := modbusFunctions[fc]; ok {
+		return fn.name
+	}
+	return fmt.Sprintf("function %d", fc)
+}
+
+// userDefined reports whether fc is in the ranges left to vendors.
+func userDefined(fc byte) bool { return fc >= 65 && fc <= 72 || fc >= 100 && fc <= 110 }
+
+// checkModbusRequest checks a request's function code and format.
+func checkModbusRequest(a adu, f *findings) {
+	fc, d := a.pdu[0], a.pdu[1:]
+	name := modbusName(fc)
+	fn, known := modbusFunctions[fc]
+	switch {
+	case fc >= 0x80:
+		f.add(a.offset, name, automata.SeverityError, "function code %d has the exception bit set, which only responses may", fc)
+		return
+	case userDefined(fc):
+		f.add(a.offset, name, automata.SeverityWarning, "function code %d is user-defined; its format is not checked", fc)
+		return
+	case !known:
+		f.add(a.offset, name, automata.SeverityError, "function code %d is not defined by Modbus", fc)
+		return
+	case fn.serial:
+		f.add(a.offset, name, automata.SeverityWarning, "%s (%d) is defined for serial lines, not Modbus/TCP", name, fc)
+	}
+	if problem := modbusRequestFormat(fc, d); problem != "" {
+		f.add(a.offset, name, automata.SeverityError, "%s request: %s", name, problem)
+	}
+}
+
+// modbusRequestFormat checks the data of a request, returning the problem found.
+func modbusRequestFormat(fc byte, d []byte) string {
+	u16 := func(i int) int { return int(binary.BigEndian.Uint16(d[i:])) }
+	quantity := func(max int) string {
+		if n := u16(2); n < 1 || n > max {
+			return fmt.Sprintf("quantity %d is outside 1 to %d", n, max)
+		} else if u16(0)+n > 65536 {
+			return fmt.Sprintf("address %d plus quantity %d runs past 65535", u16(0), n)
+		}
+		return ""
+	}
+	size := func(n int) string {
+		if len(d) != n {
+			return fmt.Sprintf("data is %d bytes; it must be %d", len(d), n)
+		}
+		return ""
+	}
+	switch fc {
+	case 1, 2:
+		if p := size(4); p != "" {
+			return p
+		}
+		return quantity(2000)
+	case 3, 4:
+		if p := size(4); p != "" {
+			return p
+		}
+		return quantity(125)
+	case 5:
+		if p := size(4); p != "" {
+			return p
+		}
+		if v := u16(2); v != 0 && v != 0xff00 {
+			return fmt.Sprintf("coil value 0x%04X is neither 0x0000 (off) nor 0xFF00 (on)", v)
+		}
+	case 6:
+		return size(4)
+	case 7, 11, 12, 17:
+		return size(0)
+	case 8:
+		if len(d) < 2 {
+			return "sub-function is missing"
+		}
+	case 15, 16:
+		if len(d) < 5 {
+			return fmt.Sprintf("data is %d bytes; it needs at least 5", len(d))
+		}
+		max, per := 1968, 0
+		if fc == 16 {
+			max, per = 123, 2
+		}
+		if p := quantity(max); p != "" {
+			return p
+		}
+		want := (u16(2) + 7) / 8
+		if per > 0 {
+			want = u16(2) * per
+		}
+		if int(d[4]) != want {
+			return fmt.Sprintf("byte count %d does not match quantity %d, which needs %d", d[4], u16(2), want)
+		}
+		if len(d) != 5+want {
+			return fmt.Sprintf("byte count %d does not match the %d bytes of values", d[4], len(d)-5)
+		}
+	case 20, 21:
+		if len(d) < 1 || int(d[0]) != len(d)-1 {
+			return "byte count does not match the data"
+		}
+		if d[0] < 7 || d[0] > 0xf5 || fc == 20 && d[0]%7 != 0 {
+			return fmt.Sprintf("byte count %d is not a valid size of sub-requests", d[0])
+		}
+	case 22:
+		return size(6)
+	case 23:
+		if len(d) < 9 {
+			return fmt.Sprintf("data is %d bytes; it needs at least 9", len(d))
+		}
+		if n := u16(2); n < 1 || n > 125 {
+			return fmt.Sprintf("read quantity %d is outside 1 to 125", n)
+		}
+		if n := u16(6); n < 1 || n > 121 {
+			return fmt.Sprintf("write quantity %d is outside 1 to 121", n)
+		}
+		if int(d[8]) != 2*u16(6) || len(d) != 9+int(d[8]) {
+			return fmt.Sprintf("byte count %d does not match write quantity %d", d[8], u16(6))
+		}
+	case 24:
+		return size(2)
+	case 43:
+		if len(d) < 1 {
+			return "MEI type is missing"
+		}
+		switch d[0] {
+		case 13:
+		case 14:
+			if len(d) != 3 {
+				return fmt.Sprintf("Read Device Identification data is %d bytes; it must be 3", len(d))
+			}
+			if d[1] < 1 || d[1] > 4 {
+				return fmt.Sprintf("read device ID code %d is outside 1 to 4", d[1])
+			}
+		default:
+			return fmt.Sprintf("MEI type %d is neither 13 (CANopen) nor 14 (device identification)", d[0])
+		}
+	}
+	return ""
+}
+
+// checkModbusResponse checks a response, against its request when it is known.
+func checkModbusResponse(a adu, req *adu, f *findings) {
+	fc, d := a.pdu[0], a.pdu[1:]
+	base := fc & 0x7f
+	name := modbusName(base)
+	if req != nil {
+		if req.unit != a.unit {
+			f.add(a.offset, name, automata.SeverityError, "response to transaction %d comes from unit %d, but the request was for unit %d", a.tid, a.unit, req.unit)
+		}
+		if req.pdu[0] != base {
+			f.add(a.offset, name, automata.SeverityError, "response to transaction %d is for function %d, but the request was function %d", a.tid, base, req.pdu[0])
+			return
+		}
+	}
+	if fc&0x80 != 0 {
+		if len(d) != 1 {
+			f.add(a.offset, name, automata.SeverityError, "exception response has %d bytes after the function code; it must have 1", len(d))
+		} else if _, ok := modbusExceptions[d[0]]; !ok {
+			f.add(a.offset, name, automata.SeverityError, "exception code %d is not defined by Modbus", d[0])
+		}
+		return
+	}
+	if _, known := modbusFunctions[fc]; !known {
+		if !userDefined(fc) {
+			f.add(a.offset, name, automata.SeverityError, "function code %d is not defined by Modbus", fc)
+		}
+		return
+	}
+	var rd []byte
+	if req != nil {
+		rd = req.pdu[1:]
+	}
+	if problem := modbusResponseFormat(fc, d, rd); problem != "" {
+		f.add(a.offset, name, automata.SeverityError, "%s response: %s", name, problem)
+	}
+}
+
+// modbusResponseFormat checks the data of a response, given the data of its request
+// when it is known and well-formed enough to compare with.
+func modbusResponseFormat(fc byte, d, req []byte) string {
+	counted := func() string {
+		if len(d) < 1 || int(d[0]) != len(d)-1 {
+			return "byte count does not match the data"
+		}
+		return ""
+	}
+	echo := func(n int) string {
+		if len(d) != n {
+			return fmt.Sprintf("data is %d bytes; it must be %d", len(d), n)
+		}
+		if len(req) >= n && !bytes.Equal(d, req[:n]) {
+			return fmt.Sprintf("it does not echo the first %d bytes of the request", n)
+		}
+		return ""
+	}
+	switch fc {
+	case 1, 2, 3, 4, 23:
+		if p := counted(); p != "" {
+			return p
+		}
+		if len(req) < 4 {
+			return ""
+		}
+		n := int(binary.BigEndian.Uint16(req[2:])) // the read quantity
+		want := 2 * n
+		if fc <= 2 {
+			want = (n + 7) / 8
+		}
+		if int(d[0]) != want {
+			return fmt.Sprintf("byte count %d does not match the quantity %d requested, which needs %d", d[0], n, want)
+		}
+		if fc == 3 || fc == 4 || fc == 23 {
+			if d[0]%2 != 0 {
+				return fmt.Sprintf("byte count %d is odd; registers are 2 bytes", d[0])
+			}
+		}
+	case 5, 6, 15, 16:
+		return echo(4)
+	case 8:
+		if len(d) < 2 {
+			return "sub-function is missing"
+		}
+	case 22:
+		return echo(6)
+	case 7:
+		if len(d) != 1 {
+			return fmt.Sprintf("data is %d bytes; it must be 1", len(d))
+		}
+	case 11:
+		if len(d) != 4 {
+			return fmt.Sprintf("data is %d bytes; it must be 4", len(d))
+		}
+	case 12, 17, 20:
+		return counted()
+	case 21:
+		if len(req) > 0 && !bytes.Equal(d, req) {
+			return "it does not echo the request"
+		}
+	case 24:
+		if len(d) < 4 || int(binary.BigEndian.Uint16(d)) != len(d)-2 {
+			return "byte count does not match the data"
+		}
+		if n := binary.BigEndian.Uint16(d[2:]); n > 31 {
+			return fmt.Sprintf("FIFO count %d is more than 31", n)
+		}
+	case 43:
+		if len(d) < 1 || len(req) > 0 && d[0] != req[0] {
+			return "MEI type does not match the request"
+		}
+	}
+	return ""
+}
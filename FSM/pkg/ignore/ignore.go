@@ -0,0 +1,236 @@
+package ignore
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"strings"
+	"sync"
+
+	"config-validator/pkg/automata"
+)
+
+// FileName is the ignore file looked up in the repository root and every directory
+// above a validated file.
+const FileName = ".nvpignore"
+
+// An ignore file has one entry per line, with # comments:
+//
+//	templates/          skip a directory
+//	**/*.j2             skip files anywhere below this directory
+//	!archive/keep.cfg   validate a file an earlier pattern skipped
+//	rule HARDENING      drop findings of a rule (a finding state) for every file here
+//	rule ACL edge/*.cfg ...or only for the files matching the globs
+//	rule hardening.ntp  rules can also be named by the finding code, or by a glob
+//
+// Patterns follow .gitignore: they are relative to the directory of the ignore file,
+// patterns without a slash match a name at any depth, and the last matching entry wins,
+// with entries in deeper directories read after those above them.
+type entry struct {
+	dir     string // directory of the ignore file, "" for the root
+	pattern string
+	negate  bool
+	dirOnly bool
+	rule    string   // set for rule exclusions, a state or code glob
+	globs   []string // files a rule exclusion applies to; all when empty
+}
+
+// Matcher answers ignore questions for repository paths, reading each directory's
+// ignore file once through read. read returns an error for a missing file. A Matcher
+// is safe for concurrent use, and a nil Matcher ignores nothing.
+type Matcher struct {
+	read  func(path string) ([]byte, error)
+	mu    sync.Mutex
+	cache map[string][]entry
+}
+
+// NewMatcher returns a Matcher that reads ignore files with read, which is given
+// repository paths such as ".nvpignore" or "configs/.nvpignore".
+func NewMatcher(read func(path string) ([]byte, error)) *Matcher {
+	return &Matcher{read: read, cache: map[string][]entry{}}
+}
+
+// Ignored reports whether the file at p should not be validated.
+func (m *Matcher) Ignored(p string) bool {
+	if m == nil {
+		return false
+	}
+	ignored := false
+	for _, e := range m.entries(p) {
+		if e.rule == "" && e.matches(p) {
+			ignored = !e.negate
+		}
+	}
+	return ignored
+}
+
+// Filter drops the findings for the file at p whose rule is excluded for it, by the
+// finding's state or code.
+func (m *Matcher) Filter(p string, findings []automata.Finding) []automata.Finding {
+	if m == nil {
+		return findings
+	}
+	var excluded []string
+	for _, e := range m.entries(p) {
+		if e.rule != "" && e.appliesTo(p) {
+			excluded = append(excluded, e.rule)
+		}
+	}
+	if len(excluded) == 0 {
+		return findings
+	}
+	var out []automata.Finding
+	for _, f := range findings {
+		if !excludes(excluded, f) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// excludes reports whether one of the rule globs matches the finding's state or code.
+func excludes(rules []string, f automata.Finding) bool {
+	for _, rule := range rules {
+		for _, name := range []string{f.State, f.Code} {
+			if ok, _ := path.Match(rule, name); ok && name != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// entries returns the entries of every ignore file from the root down to p's directory.
+func (m *Matcher) entries(p string) []entry {
+	var dirs []string
+	for dir := path.Dir(p); ; dir = path.Dir(dir) {
+		if dir == "." || dir == "/" {
+			dirs = append(dirs, "")
+			break
+		}
+		dirs = append(dirs, dir)
+	}
+	var all []entry
+	for i := len(dirs) - 1; i >= 0; i-- {
+		all = append(all, m.load(dirs[i])...)
+	}
+	return all
+}
+
+func (m *Matcher) load(dir string) []entry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if entries, ok := m.cache[dir]; ok {
+		return entries
+	}
+	data, err := m.read(path.Join(dir, FileName))
+	var entries []entry
+	if err == nil {
+		entries = parse(dir, data)
+	}
+	m.cache[dir] = entries
+	return entries
+}
+
+func parse(dir string, data []byte) []entry {
+	var entries []entry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if fields := strings.Fields(line); fields[0] == "rule" && len(fields) > 1 {
+			entries = append(entries, entry{dir: dir, rule: fields[1], globs: fields[2:]})
+			continue
+		}
+		e := entry{dir: dir}
+		if strings.HasPrefix(line, "!") {
+			e.negate, line = true, line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			e.dirOnly, line = true, strings.TrimSuffix(line, "/")
+		}
+		e.pattern = line
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// matches reports whether the entry's pattern covers p, directly or, for directory
+// patterns, through one of p's parent directories.
+func (e entry) matches(p string) bool {
+	rel, ok := relative(e.dir, p)
+	if !ok {
+		return false
+	}
+	// Patterns cover everything below a matching directory, and directory patterns
+	// match nothing but directories.
+	segments := strings.Split(rel, "/")
+	for n := 1; n <= len(segments); n++ {
+		if e.dirOnly && n == len(segments) {
+			break
+		}
+		if matchSegments(e.pattern, segments[:n]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e entry) appliesTo(p string) bool {
+	if len(e.globs) == 0 {
+		_, ok := relative(e.dir, p)
+		return ok
+	}
+	for _, g := range e.globs {
+		if (entry{dir: e.dir, pattern: g}).matches(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches a pattern against the leading path segments. Patterns without
+// a slash match the last segment alone; otherwise they are anchored, with ** standing
+// for any number of segments.
+func matchSegments(pattern string, segments []string) bool {
+	pattern = strings.TrimPrefix(pattern, "/")
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, segments[len(segments)-1])
+		return ok
+	}
+	return matchParts(strings.Split(pattern, "/"), segments)
+}
+
+func matchParts(parts, segments []string) bool {
+	if len(parts) == 0 {
+		return len(segments) == 0
+	}
+	if parts[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchParts(parts[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(parts[0], segments[0]); !ok {
+		return false
+	}
+	return matchParts(parts[1:], segments[1:])
+}
+
+// relative returns p relative to dir, and whether p is below dir at all.
+func relative(dir, p string) (string, bool) {
+	if dir == "" {
+		return p, true
+	}
+	if !strings.HasPrefix(p, dir+"/") {
+		return "", false
+	}
+	return strings.TrimPrefix(p, dir+"/"), true
+}
@@ -0,0 +1,83 @@
+// Package inicheck validates INI files: section headers, key = value (or key: value)
+// lines, and duplicate sections and keys. INI has no single standard, so what the
+// common parsers disagree on, such as repeated keys, is reported as a warning.
+package inicheck
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/linereader"
+)
+
+// State is the state reported in INI findings.
+const State = "INI"
+
+// Check returns the findings for an INI file.
+func Check(content []byte) []automata.Finding {
+	var findings []automata.Finding
+	add := func(n int, line, msg, severity string) {
+		findings = append(findings, automata.Finding{
+			Line: n, Command: strings.TrimSpace(line), State: State, Message: msg, Severity: severity,
+		})
+	}
+
+	sections := map[string]int{} // section -> line it was first defined on
+	keys := map[string]int{}     // key in the current section -> line
+	section := ""
+	continued := false // the previous line was a key, so indented lines continue its value
+	scanner := linereader.NewScanner(bytes.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			continued = false
+		case strings.HasPrefix(trimmed, ";") || strings.HasPrefix(trimmed, "#"):
+		case continued && (line[0] == ' ' || line[0] == '\t'):
+		case strings.HasPrefix(trimmed, "["):
+			continued = false
+			end := strings.IndexByte(trimmed, ']')
+			if end < 0 {
+				add(n, line, "section header is missing its closing ]", automata.SeverityError)
+				continue
+			}
+			if rest := strings.TrimSpace(trimmed[end+1:]); rest != "" && rest[0] != ';' && rest[0] != '#' {
+				add(n, line, fmt.Sprintf("unexpected %q after the section header", rest), automata.SeverityError)
+			}
+			name := strings.TrimSpace(trimmed[1:end])
+			if name == "" {
+				add(n, line, "section name is empty", automata.SeverityError)
+			}
+			if first, ok := sections[strings.ToLower(name)]; ok {
+				add(n, line, fmt.Sprintf("section [%s] is defined more than once, first on line %d", name, first), automata.SeverityWarning)
+			} else {
+				sections[strings.ToLower(name)] = n
+			}
+			section, keys = name, map[string]int{}
+		default:
+			sep := strings.IndexAny(trimmed, "=:")
+			if sep < 0 {
+				add(n, line, "expected key = value (or key: value)", automata.SeverityError)
+				continued = false
+				continue
+			}
+			key := strings.TrimSpace(trimmed[:sep])
+			if key == "" {
+				add(n, line, "key is empty", automata.SeverityError)
+			} else if first, ok := keys[strings.ToLower(key)]; ok {
+				where := "section [" + section + "]"
+				if section == "" {
+					where = "the global section"
+				}
+				add(n, line, fmt.Sprintf("key '%s' is defined more than once in %s, first on line %d", key, where, first), automata.SeverityWarning)
+			} else {
+				keys[strings.ToLower(key)] = n
+			}
+			continued = true
+		}
+	}
+	return findings
+}
@@ -0,0 +1,262 @@
+package interfaces
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"config-validator/pkg/automata"
+)
+
+var (
+	interfaceRe    = regexp.MustCompile(`^interface (.+)$`)
+	channelGroupRe = regexp.MustCompile(`^channel-group (\d+)`)
+	staticRouteRe  = regexp.MustCompile(`^ip route (?:vrf \S+ )?\S+ \S+ (\S+)`)
+	monitorRe      = regexp.MustCompile(`^monitor session \d+ (?:source|destination) interface (.+)$`)
+	// Statements naming the interface whose address is used as the source of traffic.
+	sourceRe  = regexp.MustCompile(`(?:source-interface|trap-source|update-source|^ntp source|^tunnel source) (\S+(?: \d\S*)?)`)
+	passiveRe = regexp.MustCompile(`^(?:no )?passive-interface (\S+(?: \d\S*)?)$`)
+)
+
+// types lists interface type names in the order abbreviations are resolved, so that
+// "Gi0/1", "gig 0/1", and "GigabitEthernet0/1" all name the same interface.
+var types = []string{
+	"GigabitEthernet", "FastEthernet", "TenGigabitEthernet", "TwentyFiveGigE",
+	"FortyGigabitEthernet", "HundredGigE", "Ethernet", "Port-channel", "Loopback",
+	"Vlan", "Tunnel", "Serial", "BDI", "Dialer", "Virtual-Template", "Dot11Radio",
+	"BVI", "Null",
+}
+
+// memberSettings are the settings every member of a port-channel must agree on.
+var memberSettings = []string{
+	"switchport mode", "switchport access vlan", "switchport trunk native vlan",
+	"switchport trunk allowed vlan", "speed", "duplex", "mtu",
+}
+
+// Analyzer checks that interfaces referenced by other statements exist, and that the
+// members of each port-channel agree on their switching and link settings. Missing
+// interfaces are errors; member mismatches are warnings.
+type Analyzer struct {
+	Findings []automata.Finding
+
+	current    *iface
+	interfaces map[string]*iface
+	refs       []reference
+}
+
+type iface struct {
+	name     string
+	line     int
+	group    *reference // channel-group statement, if any
+	settings map[string]setting
+}
+
+type setting struct {
+	line int
+	text string
+}
+
+type reference struct {
+	name string // canonical interface name
+	line int
+	text string
+	what string // how the line refers to the interface
+}
+
+// Line feeds one line of the config to the analyzer.
+func (a *Analyzer) Line(originalLine string, lineNum int) {
+	if a.interfaces == nil {
+		a.interfaces = map[string]*iface{}
+	}
+	line := strings.TrimSpace(originalLine)
+	if line == "" || strings.HasPrefix(line, "!") {
+		a.current = nil
+		return
+	}
+	if !strings.HasPrefix(originalLine, " ") {
+		a.current = nil
+		if m := interfaceRe.FindStringSubmatch(line); m != nil {
+			name := Canonical(m[1])
+			a.current = &iface{name: name, line: lineNum, settings: map[string]setting{}}
+			a.interfaces[strings.ToLower(name)] = a.current
+			return
+		}
+	}
+
+	if a.current != nil {
+		if m := channelGroupRe.FindStringSubmatch(line); m != nil {
+			a.current.group = &reference{name: "Port-channel" + m[1], line: lineNum, text: line, what: "channel-group " + m[1]}
+			a.refs = append(a.refs, *a.current.group)
+			return
+		}
+		for _, key := range memberSettings {
+			if line == key || strings.HasPrefix(line, key+" ") {
+				a.current.settings[key] = setting{lineNum, line}
+			}
+		}
+	}
+
+	switch {
+	case staticRouteRe.MatchString(line):
+		target := staticRouteRe.FindStringSubmatch(line)[1]
+		if _, err := netip.ParseAddr(target); err != nil && target != "dhcp" {
+			a.ref(target, lineNum, line, "static route")
+		}
+	case monitorRe.MatchString(line):
+		for _, name := range expand(monitorRe.FindStringSubmatch(line)[1]) {
+			a.ref(name, lineNum, line, "monitor session")
+		}
+	case sourceRe.MatchString(line):
+		target := sourceRe.FindStringSubmatch(line)[1]
+		if _, err := netip.ParseAddr(target); err != nil {
+			a.ref(target, lineNum, line, "source interface")
+		}
+	case passiveRe.MatchString(line):
+		if target := passiveRe.FindStringSubmatch(line)[1]; target != "default" {
+			a.ref(target, lineNum, line, "passive-interface")
+		}
+	}
+}
+
+func (a *Analyzer) ref(name string, lineNum int, line, what string) {
+	a.refs = append(a.refs, reference{name: Canonical(name), line: lineNum, text: line, what: what})
+}
+
+// Finish reports references to missing interfaces and disagreeing port-channel members.
+func (a *Analyzer) Finish() []automata.Finding {
+	for _, r := range a.refs {
+		if strings.HasPrefix(r.name, "Null") {
+			continue
+		}
+		if _, ok := a.interfaces[strings.ToLower(r.name)]; !ok {
+			a.add(r.line, r.text, automata.SeverityError, "interfaces.unknown", fmt.Sprintf("%s refers to interface %s, which is not configured", r.what, r.name))
+		}
+	}
+
+	groups := map[string][]*iface{}
+	for _, i := range a.interfaces {
+		if i.group != nil {
+			groups[i.group.name] = append(groups[i.group.name], i)
+		}
+	}
+	for channel, members := range groups {
+		sort.Slice(members, func(i, j int) bool { return members[i].line < members[j].line })
+		first := members[0]
+		for _, m := range members[1:] {
+			for _, key := range memberSettings {
+				want, have := first.settings[key], m.settings[key]
+				if want.text == have.text {
+					continue
+				}
+				line, text := have.line, have.text
+				if text == "" {
+					line, text = m.group.line, m.group.text
+				}
+				a.add(line, text, automata.SeverityWarning, "interfaces.member-mismatch", fmt.Sprintf("%s member %s has %s but %s (line %d) has %s",
+					channel, m.name, describe(have, key), first.name, first.line, describe(want, key)))
+			}
+		}
+	}
+	sort.SliceStable(a.Findings, func(i, j int) bool { return a.Findings[i].Line < a.Findings[j].Line })
+	return a.Findings
+}
+
+func describe(s setting, key string) string {
+	if s.text == "" {
+		return "no '" + key + "'"
+	}
+	return "'" + s.text + "'"
+}
+
+// Canonical expands an abbreviated interface name such as "Gi0/1" or "po 10" to the
+// full form used in `interface` statements.
+func Canonical(name string) string {
+	name = strings.Join(strings.Fields(name), "")
+	i := strings.IndexFunc(name, func(r rune) bool { return r >= '0' && r <= '9' })
+	if i <= 0 {
+		return name
+	}
+	prefix := strings.ToLower(name[:i])
+	for _, t := range types {
+		if strings.HasPrefix(strings.ToLower(t), prefix) {
+			return t + name[i:]
+		}
+	}
+	return name
+}
+
+// expand splits a monitor session interface list such as "Gi0/1 , Gi0/3 - 5 rx"
+// into single interface names.
+func expand(list string) []string {
+	list = strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(list, " rx"), " tx"), " both")
+	var names []string
+	for _, part := range strings.Split(list, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		first = Canonical(first)
+		if !isRange {
+			names = append(names, first)
+			continue
+		}
+		// "Gi0/3 - 5" ranges over the last number of the first name.
+		cut := strings.LastIndexAny(first, "/.") + 1
+		if cut == 0 {
+			cut = strings.IndexFunc(first, func(r rune) bool { return r >= '0' && r <= '9' })
+		}
+		from, err1 := strconv.Atoi(first[cut:])
+		to, err2 := strconv.Atoi(strings.TrimSpace(last))
+		if err1 != nil || err2 != nil || to < from {
+			names = append(names, first)
+			continue
+		}
+		for n := from; n <= to; n++ {
+			names = append(names, first[:cut]+strconv.Itoa(n))
+		}
+	}
+	return names
+}
+
+func (a *Analyzer) add(lineNum int, line, severity, code, msg string) {
+	a.Findings = append(a.Findings, automata.Finding{
+		Line:     lineNum,
+		Command:  line,
+		State:    "INTERFACES",
+		Message:  msg,
+		Severity: severity,
+		Code:     code,
+	})
+}
+
+// Append adds the interfaces and references of other, an analyzer fed the lines
+// after a's on their own, with their line numbers moved by shift, as if a had been
+// fed those lines: an interface configured again replaces the one before. other is
+// not modified.
+func (a *Analyzer) Append(other *Analyzer, shift int) {
+	if a.interfaces == nil {
+		a.interfaces = map[string]*iface{}
+	}
+	for key, i := range other.interfaces {
+		moved := &iface{name: i.name, line: i.line + shift, settings: make(map[string]setting, len(i.settings))}
+		if i.group != nil {
+			group := *i.group
+			group.line += shift
+			moved.group = &group
+		}
+		for k, s := range i.settings {
+			s.line += shift
+			moved.settings[k] = s
+		}
+		a.interfaces[key] = moved
+	}
+	for _, r := range other.refs {
+		r.line += shift
+		a.refs = append(a.refs, r)
+	}
+	for _, f := range other.Findings {
+		f.Line += shift
+		a.Findings = append(a.Findings, f)
+	}
+	a.current = nil
+}
@@ -0,0 +1,255 @@
+// Package jwtcheck validates JSON Web Tokens (RFC 7519): the three base64url parts,
+// the JSON of the header and claims, the types of the registered claims, and, given a
+// key, the signature. Tokens are found in captured Authorization headers and logs, so
+// findings never show more of a token than its start.
+package jwtcheck
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/linereader"
+	"config-validator/pkg/validation"
+)
+
+// State is the state reported in JWT findings.
+const State = "JWT"
+
+// Options control the checks that depend on more than the token.
+type Options struct {
+	Key any       // verification key from LoadKey; signatures are not verified when nil
+	Now time.Time // for exp, nbf, and iat; time.Now when zero
+}
+
+// Token is a token found in a file, with its line.
+type Token struct {
+	Line  int
+	Value string
+}
+
+var (
+	// headerRe strips a captured Authorization header down to its credentials.
+	headerRe = regexp.MustCompile(`(?i)^\s*(?:(?:proxy-)?authorization\s*:\s*)?(?:bearer\s+)?`)
+	// tokenRe finds tokens inside other text, such as a log line: a JWT header starts
+	// with the base64url of `{"`.
+	tokenRe = regexp.MustCompile(`eyJ[A-Za-z0-9_\-+/=]*(?:\.[A-Za-z0-9_\-+/=]*)+`)
+)
+
+// Tokens finds the tokens in content: a token per line, alone or as an Authorization
+// header, or tokens anywhere in lines of other text. Blank lines and # comments are
+// skipped.
+func Tokens(content []byte) []Token {
+	var tokens []Token
+	scanner := linereader.NewScanner(bytes.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if rest := line[len(headerRe.FindString(line)):]; rest != "" && !strings.ContainsAny(rest, " \t") {
+			tokens = append(tokens, Token{Line: n, Value: rest})
+			continue
+		}
+		for _, t := range tokenRe.FindAllString(line, -1) {
+			tokens = append(tokens, Token{Line: n, Value: t})
+		}
+	}
+	return tokens
+}
+
+type checker struct {
+	token    Token
+	findings []automata.Finding
+}
+
+func (c *checker) add(severity, msg string) {
+	c.findings = append(c.findings, automata.Finding{
+		Line:     c.token.Line,
+		Command:  redact(c.token.Value),
+		State:    State,
+		Message:  msg,
+		Severity: severity,
+	})
+}
+
+// Check validates one token.
+func Check(token Token, opts Options) []automata.Finding {
+	c := &checker{token: token}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	parts := strings.Split(token.Value, ".")
+	switch len(parts) {
+	case 3:
+	case 5:
+		c.add(automata.SeverityError, "token has 5 parts: it is an encrypted JWE, which cannot be checked without decrypting it")
+		return c.findings
+	default:
+		c.add(automata.SeverityError, fmt.Sprintf("token has %d parts; a JWT has 3 (header.payload.signature)", len(parts)))
+		return c.findings
+	}
+
+	// The parts are checked independently, so one bad part does not hide the others.
+	header, headerErr := c.decode("header", parts[0])
+	payload, payloadErr := c.decode("payload", parts[1])
+	sig, sigErr := c.decode("signature", parts[2])
+	alg := ""
+	if headerErr == nil {
+		if h, ok := c.object("header", header); ok {
+			alg = c.header(h)
+		}
+	}
+	if payloadErr == nil {
+		if claims, ok := c.object("payload", payload); ok {
+			c.claims(claims, opts.Now)
+		}
+	}
+	if sigErr == nil && alg != "" {
+		c.signature(alg, parts[0]+"."+parts[1], sig, opts.Key)
+	}
+	return c.findings
+}
+
+// decode decodes a base64url part, which must not be padded.
+func (c *checker) decode(name, part string) ([]byte, error) {
+	if part == "" && name != "signature" {
+		c.add(automata.SeverityError, fmt.Sprintf("%s is empty", name))
+		return nil, fmt.Errorf("empty")
+	}
+	if strings.HasSuffix(part, "=") {
+		c.add(automata.SeverityError, fmt.Sprintf("%s is padded with '='; JWTs use base64url without padding", name))
+		part = strings.TrimRight(part, "=")
+	}
+	if strings.ContainsAny(part, "+/") {
+		c.add(automata.SeverityError, fmt.Sprintf("%s uses the base64 alphabet ('+' or '/'); JWTs use base64url ('-' and '_')", name))
+		part = strings.NewReplacer("+", "-", "/", "_").Replace(part)
+	}
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		c.add(automata.SeverityError, fmt.Sprintf("%s is not base64url: %v", name, err))
+	}
+	return b, err
+}
+
+// object parses a part as a JSON object, reporting syntax errors as the JSON
+// validator does.
+func (c *checker) object(name string, data []byte) (map[string]any, bool) {
+	for _, f := range validation.CheckJSON(data) {
+		c.add(automata.SeverityError, fmt.Sprintf("%s is not valid JSON: %s", name, f.Message))
+		return nil, false
+	}
+	var obj map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&obj); err != nil || obj == nil {
+		c.add(automata.SeverityError, fmt.Sprintf("%s must be a JSON object", name))
+		return nil, false
+	}
+	return obj, true
+}
+
+// header checks the JOSE header and returns its algorithm.
+func (c *checker) header(h map[string]any) string {
+	alg, ok := h["alg"].(string)
+	switch {
+	case !ok:
+		c.add(automata.SeverityError, "header has no \"alg\" string")
+	case alg == "none":
+		c.add(automata.SeveritySecurity, "alg is \"none\": the token is unsigned and anyone can forge it")
+	case algorithms[alg] == nil:
+		c.add(automata.SeverityError, fmt.Sprintf("alg %q is not a JWS algorithm of RFC 7518 or 8037", alg))
+	}
+	for _, name := range []string{"typ", "cty", "kid"} {
+		if v, ok := h[name]; ok {
+			if _, isString := v.(string); !isString {
+				c.add(automata.SeverityError, fmt.Sprintf("header %q must be a string", name))
+			}
+		}
+	}
+	if crit, ok := h["crit"]; ok {
+		list, isList := crit.([]any)
+		if !isList || len(list) == 0 {
+			c.add(automata.SeverityError, "header \"crit\" must be a non-empty array of header names")
+		}
+		for _, name := range list {
+			s, _ := name.(string)
+			if _, present := h[s]; !present {
+				c.add(automata.SeverityError, fmt.Sprintf("header \"crit\" lists %v, which is not in the header", name))
+			}
+		}
+	}
+	return alg
+}
+
+// claims checks the types of the registered claims, and the token's validity period.
+func (c *checker) claims(claims map[string]any, now time.Time) {
+	for _, name := range []string{"iss", "sub", "jti"} {
+		if v, ok := claims[name]; ok {
+			if _, isString := v.(string); !isString {
+				c.add(automata.SeverityError, fmt.Sprintf("claim %q must be a string", name))
+			}
+		}
+	}
+	if aud, ok := claims["aud"]; ok {
+		valid := false
+		switch aud := aud.(type) {
+		case string:
+			valid = true
+		case []any:
+			valid = true
+			for _, a := range aud {
+				_, isString := a.(string)
+				valid = valid && isString
+			}
+		}
+		if !valid {
+			c.add(automata.SeverityError, "claim \"aud\" must be a string or an array of strings")
+		}
+	}
+
+	dates := map[string]time.Time{}
+	for _, name := range []string{"exp", "nbf", "iat"} {
+		v, ok := claims[name]
+		if !ok {
+			continue
+		}
+		n, isNumber := v.(json.Number)
+		seconds, err := n.Float64()
+		if !isNumber || err != nil {
+			c.add(automata.SeverityError, fmt.Sprintf("claim %q must be a NumericDate (seconds since the epoch as a JSON number), got %v", name, v))
+			continue
+		}
+		whole, frac := math.Modf(seconds)
+		dates[name] = time.Unix(int64(whole), int64(frac*1e9)).UTC()
+	}
+	if exp, ok := dates["exp"]; ok && !now.Before(exp) {
+		c.add(automata.SeverityWarning, fmt.Sprintf("token expired at %s", exp.Format(time.RFC3339)))
+	}
+	if nbf, ok := dates["nbf"]; ok && now.Before(nbf) {
+		c.add(automata.SeverityWarning, fmt.Sprintf("token is not valid before %s", nbf.Format(time.RFC3339)))
+	}
+	if iat, ok := dates["iat"]; ok && now.Add(time.Minute).Before(iat) {
+		c.add(automata.SeverityWarning, fmt.Sprintf("token was issued in the future, at %s", iat.Format(time.RFC3339)))
+	}
+	if exp, ok := dates["exp"]; ok {
+		if iat, ok := dates["iat"]; ok && exp.Before(iat) {
+			c.add(automata.SeverityError, "claim \"exp\" is before \"iat\": the token expired before it was issued")
+		}
+	}
+}
+
+// redact shortens a token to its start: enough to tell tokens apart, too little to
+// replay it.
+func redact(token string) string {
+	if len(token) <= 16 {
+		return token
+	}
+	return token[:16] + "…"
+}
@@ -0,0 +1,213 @@
+package jwtcheck
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+
+	_ "crypto/sha256" // hashes of the algorithms
+	_ "crypto/sha512"
+
+	"config-validator/pkg/automata"
+)
+
+// algorithm is a JWS signature algorithm of RFC 7518 (and EdDSA of RFC 8037).
+type algorithm struct {
+	kind  string // hmac, rsa, pss, ecdsa, or eddsa
+	hash  crypto.Hash
+	curve elliptic.Curve // for ecdsa
+}
+
+var algorithms = map[string]*algorithm{
+	"HS256": {kind: "hmac", hash: crypto.SHA256},
+	"HS384": {kind: "hmac", hash: crypto.SHA384},
+	"HS512": {kind: "hmac", hash: crypto.SHA512},
+	"RS256": {kind: "rsa", hash: crypto.SHA256},
+	"RS384": {kind: "rsa", hash: crypto.SHA384},
+	"RS512": {kind: "rsa", hash: crypto.SHA512},
+	"PS256": {kind: "pss", hash: crypto.SHA256},
+	"PS384": {kind: "pss", hash: crypto.SHA384},
+	"PS512": {kind: "pss", hash: crypto.SHA512},
+	"ES256": {kind: "ecdsa", hash: crypto.SHA256, curve: elliptic.P256()},
+	"ES384": {kind: "ecdsa", hash: crypto.SHA384, curve: elliptic.P384()},
+	"ES512": {kind: "ecdsa", hash: crypto.SHA512, curve: elliptic.P521()},
+	"EdDSA": {kind: "eddsa"},
+}
+
+// keyNames describe what each kind of algorithm verifies with.
+var keyNames = map[string]string{
+	"hmac": "a shared secret", "rsa": "an RSA public key", "pss": "an RSA public key",
+	"ecdsa": "an ECDSA public key", "eddsa": "an Ed25519 public key",
+}
+
+// minRSABits is the smallest RSA key RFC 7518 allows.
+const minRSABits = 2048
+
+// LoadKey reads a verification key: a PEM public key, certificate, or private key
+// (whose public half is used), or else the file's bytes as an HMAC secret.
+func LoadKey(path string) (any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		if bytes.Contains(data, []byte("-----BEGIN")) {
+			return nil, fmt.Errorf("failed to decode PEM key %s", path)
+		}
+		return bytes.TrimRight(data, "\r\n"), nil
+	}
+	var key any
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			key = cert.PublicKey
+		}
+	case "PRIVATE KEY":
+		if key, err = x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+			key = key.(crypto.Signer).Public()
+		}
+	case "RSA PRIVATE KEY":
+		var priv *rsa.PrivateKey
+		if priv, err = x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+			key = priv.Public()
+		}
+	case "EC PRIVATE KEY":
+		var priv *ecdsa.PrivateKey
+		if priv, err = x509.ParseECPrivateKey(block.Bytes); err == nil {
+			key = priv.Public()
+		}
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q in %s", block.Type, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key %s: %v", path, err)
+	}
+	return key, nil
+}
+
+// signature checks the signature's length for the algorithm and, given a key,
+// verifies it over the signing input (the encoded header and payload).
+func (c *checker) signature(alg, input string, sig []byte, key any) {
+	a := algorithms[alg]
+	switch {
+	case alg == "none":
+		if len(sig) > 0 {
+			c.add(automata.SeverityError, "alg is \"none\" but the token has a signature")
+		}
+		return
+	case a == nil:
+		return
+	case len(sig) == 0:
+		c.add(automata.SeveritySecurity, fmt.Sprintf("signature is empty, but alg is %s", alg))
+		return
+	}
+
+	want := 0
+	switch a.kind {
+	case "hmac":
+		want = a.hash.Size()
+	case "ecdsa":
+		want = 2 * ((a.curve.Params().BitSize + 7) / 8)
+	case "eddsa":
+		want = ed25519.SignatureSize
+	}
+	if want > 0 && len(sig) != want {
+		msg := fmt.Sprintf("%s signature has %d bytes; it must have %d", alg, len(sig), want)
+		if a.kind == "ecdsa" && len(sig) > 0 && sig[0] == 0x30 {
+			msg += " (it looks DER-encoded; JWS uses the raw R || S form)"
+		}
+		c.add(automata.SeverityError, msg)
+		return
+	}
+	if key == nil {
+		return
+	}
+
+	var digest []byte
+	if a.hash != 0 {
+		h := a.hash.New()
+		h.Write([]byte(input))
+		digest = h.Sum(nil)
+	}
+	verified := false
+	switch k := key.(type) {
+	case []byte:
+		if a.kind != "hmac" {
+			break
+		}
+		if len(k) < a.hash.Size() {
+			c.add(automata.SeveritySecurity, fmt.Sprintf("%s secret has %d bytes; RFC 7518 requires at least %d", alg, len(k), a.hash.Size()))
+		}
+		mac := hmac.New(a.hash.New, k)
+		mac.Write([]byte(input))
+		verified = hmac.Equal(mac.Sum(nil), sig)
+	case *rsa.PublicKey:
+		if a.kind != "rsa" && a.kind != "pss" {
+			break
+		}
+		if k.N.BitLen() < minRSABits {
+			c.add(automata.SeveritySecurity, fmt.Sprintf("RSA key has %d bits; RFC 7518 requires at least %d", k.N.BitLen(), minRSABits))
+		}
+		if a.kind == "rsa" {
+			verified = rsa.VerifyPKCS1v15(k, a.hash, digest, sig) == nil
+		} else {
+			verified = rsa.VerifyPSS(k, a.hash, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		}
+	case *ecdsa.PublicKey:
+		if a.kind != "ecdsa" {
+			break
+		}
+		if k.Curve != a.curve {
+			c.add(automata.SeverityError, fmt.Sprintf("%s needs a %s key, but the key is on %s", alg, a.curve.Params().Name, k.Curve.Params().Name))
+			return
+		}
+		half := len(sig) / 2
+		r, s := new(big.Int).SetBytes(sig[:half]), new(big.Int).SetBytes(sig[half:])
+		verified = ecdsa.Verify(k, digest, r, s)
+	case ed25519.PublicKey:
+		if a.kind != "eddsa" {
+			break
+		}
+		verified = ed25519.Verify(k, []byte(input), sig)
+	default:
+		c.add(automata.SeverityError, fmt.Sprintf("unsupported key type %T", key))
+		return
+	}
+	if !verified && !matches(a.kind, key) {
+		c.add(automata.SeverityError, fmt.Sprintf("alg %s is verified with %s, which the given key is not", alg, keyNames[a.kind]))
+		return
+	}
+	if !verified {
+		c.add(automata.SeveritySecurity, "signature does not verify with the given key")
+	}
+}
+
+// matches reports whether key is of the kind an algorithm verifies with.
+func matches(kind string, key any) bool {
+	switch key.(type) {
+	case []byte:
+		return kind == "hmac"
+	case *rsa.PublicKey:
+		return kind == "rsa" || kind == "pss"
+	case *ecdsa.PublicKey:
+		return kind == "ecdsa"
+	case ed25519.PublicKey:
+		return kind == "eddsa"
+	}
+	return false
+}
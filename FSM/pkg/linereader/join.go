@@ -0,0 +1,79 @@
+package linereader
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Joiner reads the logical lines of a config whose long commands span several
+// physical lines, as some tools export them:
+//   - with a continuation marker, such as a trailing \, the marker is dropped and
+//     the next line is joined on with a space, its indentation removed;
+//   - wrapped at a terminal width, a line exactly that many characters long is
+//     joined with the next one as is.
+//
+// Either is off when empty or zero, and the Joiner then reads the lines as the
+// Scanner does. Line and End give the physical lines a logical line came from, so
+// findings point at where the command starts.
+type Joiner struct {
+	*Scanner
+	marker    string
+	width     int
+	text      string
+	line, end int
+}
+
+// NewJoiner returns a Joiner reading the lines of s.
+func NewJoiner(s *Scanner, marker string, width int) *Joiner {
+	return &Joiner{Scanner: s, marker: marker, width: width}
+}
+
+// Scan advances to the next logical line, which is then available through Text.
+func (j *Joiner) Scan() bool {
+	if !j.Scanner.Scan() {
+		return false
+	}
+	j.end++
+	j.line = j.end
+	physical := j.Scanner.Text()
+	text := physical
+	for {
+		switch {
+		case j.marker != "" && strings.HasSuffix(strings.TrimRight(physical, " \t"), j.marker):
+			text = strings.TrimRight(strings.TrimSuffix(strings.TrimRight(text, " \t"), j.marker), " \t")
+			if !j.Scanner.Scan() {
+				j.text = text
+				return true
+			}
+			j.end++
+			physical = j.Scanner.Text()
+			text += " " + strings.TrimLeft(physical, " \t")
+		case j.width > 0 && utf8.RuneCountInString(physical) == j.width:
+			if !j.Scanner.Scan() {
+				j.text = text
+				return true
+			}
+			j.end++
+			physical = j.Scanner.Text()
+			text += physical
+		default:
+			j.text = text
+			return true
+		}
+	}
+}
+
+// Text returns the current logical line.
+func (j *Joiner) Text() string {
+	return j.text
+}
+
+// Line returns the number of the first physical line of the current logical line.
+func (j *Joiner) Line() int {
+	return j.line
+}
+
+// End returns the number of the last physical line of the current logical line.
+func (j *Joiner) End() int {
+	return j.end
+}
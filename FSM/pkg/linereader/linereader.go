@@ -0,0 +1,185 @@
+// Package linereader reads configs line by line without a limit on line length,
+// whatever their encoding and line endings.
+package linereader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encodings reported by Scanner.Encoding.
+const (
+	UTF8    = "utf-8"
+	UTF8BOM = "utf-8 (bom)"
+	UTF16LE = "utf-16le"
+	UTF16BE = "utf-16be"
+	Latin1  = "latin-1"
+)
+
+// Scanner has the Scan/Text/Err API of bufio.Scanner, but reads lines of any length.
+// bufio.Scanner fails on lines over 64KB, which configs with certificates or long
+// banners can have.
+//
+// Exports from some tools are not plain UTF-8, so the Scanner also normalizes the
+// input: a BOM is dropped, UTF-16 (with a BOM, or detected from its zero bytes) is
+// converted to UTF-8, lines that are not valid UTF-8 are read as Latin-1, and lines
+// may end in LF, CRLF, or CR.
+type Scanner struct {
+	r        *bufio.Reader
+	scanner  *bufio.Scanner
+	text     string
+	encoding string
+}
+
+// NewScanner returns a Scanner reading from r.
+func NewScanner(r io.Reader) *Scanner {
+	return &Scanner{r: bufio.NewReader(r)}
+}
+
+// Scan advances to the next line, which is then available through Text. It returns
+// false at the end of the input or on a read error.
+func (s *Scanner) Scan() bool {
+	if s.scanner == nil {
+		s.start()
+	}
+	if !s.scanner.Scan() {
+		return false
+	}
+	line := s.scanner.Bytes()
+	if utf8.Valid(line) {
+		s.text = string(line)
+		return true
+	}
+	// Not UTF-8: every byte is a Latin-1 character.
+	runes := make([]rune, len(line))
+	for i, b := range line {
+		runes[i] = rune(b)
+	}
+	s.text = string(runes)
+	if s.encoding == UTF8 {
+		s.encoding = Latin1
+	}
+	return true
+}
+
+// start detects the encoding from the start of the input and sets up the line scanner.
+func (s *Scanner) start() {
+	var src io.Reader = s.r
+	head, _ := s.r.Peek(4)
+	switch {
+	case bytes.HasPrefix(head, []byte{0xEF, 0xBB, 0xBF}):
+		s.r.Discard(3)
+		s.encoding = UTF8BOM
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE}):
+		s.r.Discard(2)
+		s.encoding, src = UTF16LE, &utf16Reader{r: s.r, order: binary.LittleEndian}
+	case bytes.HasPrefix(head, []byte{0xFE, 0xFF}):
+		s.r.Discard(2)
+		s.encoding, src = UTF16BE, &utf16Reader{r: s.r, order: binary.BigEndian}
+	case len(head) == 4 && head[0] != 0 && head[1] == 0 && head[2] != 0 && head[3] == 0:
+		s.encoding, src = UTF16LE, &utf16Reader{r: s.r, order: binary.LittleEndian}
+	case len(head) == 4 && head[0] == 0 && head[1] != 0 && head[2] == 0 && head[3] != 0:
+		s.encoding, src = UTF16BE, &utf16Reader{r: s.r, order: binary.BigEndian}
+	default:
+		s.encoding = UTF8
+	}
+	s.scanner = bufio.NewScanner(src)
+	s.scanner.Buffer(nil, math.MaxInt)
+	s.scanner.Split(scanLines)
+}
+
+// Text returns the current line without its line ending.
+func (s *Scanner) Text() string {
+	return s.text
+}
+
+// Err returns the first read error, or nil at the end of the input.
+func (s *Scanner) Err() error {
+	if s.scanner == nil {
+		return nil
+	}
+	return s.scanner.Err()
+}
+
+// Encoding returns the encoding of the input read so far: UTF8, UTF8BOM, UTF16LE,
+// UTF16BE, or Latin1 once a line was not valid UTF-8.
+func (s *Scanner) Encoding() string {
+	return s.encoding
+}
+
+// scanLines is bufio.ScanLines that also ends lines at a CR not followed by LF.
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if atEOF {
+			return i + 1, data[:i], nil
+		}
+		return 0, nil, nil // need the next byte to tell CR from CRLF
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// utf16Reader converts UTF-16 to UTF-8.
+type utf16Reader struct {
+	r     *bufio.Reader
+	order binary.ByteOrder
+	out   []byte // converted bytes not yet returned
+	err   error
+}
+
+func (u *utf16Reader) Read(p []byte) (int, error) {
+	for len(u.out) == 0 && u.err == nil {
+		u.fill()
+	}
+	if len(u.out) == 0 {
+		return 0, u.err
+	}
+	n := copy(p, u.out)
+	u.out = u.out[n:]
+	return n, nil
+}
+
+// fill converts the next chunk of input.
+func (u *utf16Reader) fill() {
+	var units []uint16
+	var pair [2]byte
+	for len(units) < 2048 {
+		if _, err := io.ReadFull(u.r, pair[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF // a trailing odd byte is dropped
+			}
+			u.err = err
+			break
+		}
+		units = append(units, u.order.Uint16(pair[:]))
+	}
+	// Keep a high surrogate at the end of the chunk for the next one.
+	if n := len(units); n > 0 && u.err == nil && utf16.IsSurrogate(rune(units[n-1])) && units[n-1] < 0xDC00 {
+		var next [2]byte
+		if _, err := io.ReadFull(u.r, next[:]); err == nil {
+			units = append(units, u.order.Uint16(next[:]))
+		}
+	}
+	for _, r := range utf16.Decode(units) {
+		u.out = utf8.AppendRune(u.out, r)
+	}
+}
@@ -0,0 +1,392 @@
+// Package lsp is a Language Server Protocol server that publishes the validators'
+// findings as diagnostics while a document is edited, so editors show them inline
+// without an extension of their own. It speaks the base protocol over a stream,
+// usually the editor's pipe to the process's stdin and stdout.
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf16"
+
+	"config-validator/pkg/automata"
+)
+
+// Validator validates a document. uri and languageID are as the editor sent them;
+// ok is false for documents the server has nothing to say about, whose
+// diagnostics are then left empty.
+type Validator func(uri, languageID string, text []byte) (findings []automata.Finding, ok bool)
+
+// Fixer returns the quick fixes of a finding of a document, for code actions.
+type Fixer func(uri, languageID string, text []byte, f automata.Finding) []Fix
+
+// Fix is a quick fix: the replacement of Length bytes at Offset with Text.
+type Fix struct {
+	Title  string
+	Offset int
+	Length int
+	Text   string
+}
+
+// Server is a language server for one client connection.
+type Server struct {
+	Validate Validator
+	Fixes    Fixer // optional; without it no code actions are offered
+	// Closed, if set, is called when the editor closes a document, so state kept
+	// for it between validations can be dropped.
+	Closed  func(uri string)
+	Name    string // reported to the client, and as the source of diagnostics
+	Version string
+
+	mu          sync.Mutex
+	docs        map[string]*document
+	initialized bool
+	shutdown    bool
+}
+
+// document is an open document and its latest findings.
+type document struct {
+	languageID string
+	version    int
+	text       string
+	findings   []automata.Finding
+}
+
+// Serve handles the connection until the client sends exit or closes the stream.
+// It returns nil after a shutdown and exit, as the protocol expects.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	c := newConn(r, w)
+	for {
+		m, err := c.read()
+		if err == io.EOF {
+			if s.shutdown {
+				return nil
+			}
+			return fmt.Errorf("client closed the connection without shutting down")
+		}
+		if err != nil {
+			return err
+		}
+		if m.Error != nil && m.Method == "" && m.ID == nil {
+			// The content was not JSON, so there is no ID to reply to
+			c.replyError(json.RawMessage("null"), m.Error.Code, m.Error.Message)
+			continue
+		}
+		if m.Method == "exit" {
+			if s.shutdown {
+				return nil
+			}
+			return fmt.Errorf("exit before shutdown")
+		}
+		if err := s.handle(c, m); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(c *conn, m *message) error {
+	isRequest := m.ID != nil
+	if !s.initialized && m.Method != "initialize" {
+		if isRequest {
+			return c.replyError(m.ID, codeServerNotInitialized, "initialize first")
+		}
+		return nil
+	}
+	if s.shutdown && isRequest {
+		return c.replyError(m.ID, codeInvalidRequest, "server is shutting down")
+	}
+
+	switch m.Method {
+	case "initialize":
+		s.initialized = true
+		if s.docs == nil {
+			s.docs = map[string]*document{}
+		}
+		return c.reply(m.ID, map[string]any{
+			"capabilities": s.capabilities(),
+			"serverInfo":   map[string]any{"name": s.Name, "version": s.Version},
+		})
+	case "initialized":
+		return nil
+	case "shutdown":
+		s.shutdown = true
+		return c.reply(m.ID, nil)
+
+	case "textDocument/didOpen":
+		var p struct {
+			TextDocument struct {
+				URI        string `json:"uri"`
+				LanguageID string `json:"languageId"`
+				Version    int    `json:"version"`
+				Text       string `json:"text"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(m.Params, &p); err != nil {
+			log.Println("❌ Invalid didOpen:", err)
+			return nil
+		}
+		d := &document{languageID: p.TextDocument.LanguageID, version: p.TextDocument.Version, text: p.TextDocument.Text}
+		s.mu.Lock()
+		s.docs[p.TextDocument.URI] = d
+		s.mu.Unlock()
+		return s.publish(c, p.TextDocument.URI, d)
+	case "textDocument/didChange":
+		var p struct {
+			TextDocument struct {
+				URI     string `json:"uri"`
+				Version int    `json:"version"`
+			} `json:"textDocument"`
+			ContentChanges []struct {
+				Range *lspRange `json:"range"`
+				Text  string    `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if err := json.Unmarshal(m.Params, &p); err != nil {
+			log.Println("❌ Invalid didChange:", err)
+			return nil
+		}
+		s.mu.Lock()
+		d, ok := s.docs[p.TextDocument.URI]
+		if ok {
+			for _, ch := range p.ContentChanges {
+				if ch.Range == nil {
+					d.text = ch.Text
+				} else {
+					d.text = applyEdit(d.text, *ch.Range, ch.Text)
+				}
+			}
+			d.version = p.TextDocument.Version
+		}
+		s.mu.Unlock()
+		if !ok {
+			return nil
+		}
+		return s.publish(c, p.TextDocument.URI, d)
+	case "textDocument/didSave":
+		return nil
+	case "textDocument/codeAction":
+		var p struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+			Range lspRange `json:"range"`
+		}
+		if err := json.Unmarshal(m.Params, &p); err != nil {
+			return c.replyError(m.ID, codeInvalidParams, err.Error())
+		}
+		return c.reply(m.ID, s.codeActions(p.TextDocument.URI, p.Range))
+	case "textDocument/didClose":
+		var p struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(m.Params, &p); err != nil {
+			return nil
+		}
+		s.mu.Lock()
+		delete(s.docs, p.TextDocument.URI)
+		s.mu.Unlock()
+		if s.Closed != nil {
+			s.Closed(p.TextDocument.URI)
+		}
+		// Diagnostics of a closed document are cleared, as it is no longer validated
+		return c.notify("textDocument/publishDiagnostics", map[string]any{"uri": p.TextDocument.URI, "diagnostics": []any{}})
+	}
+
+	if isRequest {
+		return c.replyError(m.ID, codeMethodNotFound, "method not supported: "+m.Method)
+	}
+	// Notifications the server does not handle ($/cancelRequest, $/setTrace, ...) are ignored
+	return nil
+}
+
+func (s *Server) capabilities() map[string]any {
+	capabilities := map[string]any{
+		// Incremental: the client sends ranges that changed, not the whole document
+		"textDocumentSync": map[string]any{"openClose": true, "change": 2, "save": true},
+	}
+	if s.Fixes != nil {
+		capabilities["codeActionProvider"] = map[string]any{"codeActionKinds": []string{"quickfix"}}
+	}
+	return capabilities
+}
+
+// publish validates the document and sends its findings as diagnostics.
+func (s *Server) publish(c *conn, uri string, d *document) error {
+	s.mu.Lock()
+	text, languageID, version := d.text, d.languageID, d.version
+	s.mu.Unlock()
+
+	findings, ok := s.Validate(uri, languageID, []byte(text))
+	if !ok {
+		findings = nil
+	}
+	s.mu.Lock()
+	d.findings = findings
+	s.mu.Unlock()
+
+	lines := strings.Split(text, "\n")
+	diagnostics := make([]diagnostic, 0, len(findings))
+	for _, f := range findings {
+		diagnostics = append(diagnostics, s.diagnostic(f, lines))
+	}
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		return diagnostics[i].Range.Start.Line < diagnostics[j].Range.Start.Line
+	})
+	return c.notify("textDocument/publishDiagnostics", map[string]any{
+		"uri":         uri,
+		"version":     version,
+		"diagnostics": diagnostics,
+	})
+}
+
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"` // in UTF-16 code units, the protocol's default
+}
+
+type lspRange struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+type diagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Code     string   `json:"code,omitempty"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+// LSP diagnostic severities.
+const (
+	severityError   = 1
+	severityWarning = 2
+)
+
+// diagnostic covers the finding's line from its first to its last non-blank
+// character; findings about the whole document (line 0) are shown on the first line.
+func (s *Server) diagnostic(f automata.Finding, lines []string) diagnostic {
+	line := f.Line - 1
+	if line < 0 {
+		line = 0
+	}
+	if line >= len(lines) {
+		line = len(lines) - 1
+	}
+	text := strings.TrimRight(lines[line], "\r")
+	start := utf16Len(text[:len(text)-len(strings.TrimLeft(text, " \t"))])
+	end := utf16Len(strings.TrimRight(text, " \t"))
+	if end <= start {
+		start, end = 0, utf16Len(text)
+	}
+
+	severity := severityError
+	if f.Severity == automata.SeverityWarning {
+		severity = severityWarning
+	}
+	message := f.Message
+	if f.Severity == automata.SeveritySecurity {
+		message = "security: " + message
+	}
+	return diagnostic{
+		Range:    lspRange{Start: position{line, start}, End: position{line, end}},
+		Severity: severity,
+		Code:     f.State,
+		Source:   s.Name,
+		Message:  message,
+	}
+}
+
+// applyEdit replaces a range of text, as incremental didChange notifications send.
+func applyEdit(text string, r lspRange, newText string) string {
+	start, end := offset(text, r.Start), offset(text, r.End)
+	if end < start {
+		start, end = end, start
+	}
+	return text[:start] + newText + text[end:]
+}
+
+// offset converts a position to a byte offset in text, clamping it to the text.
+func offset(text string, p position) int {
+	i := 0
+	for line := 0; line < p.Line; line++ {
+		next := strings.IndexByte(text[i:], '\n')
+		if next < 0 {
+			return len(text)
+		}
+		i += next + 1
+	}
+	units := 0
+	for j, r := range text[i:] {
+		if units >= p.Character || r == '\n' {
+			return i + j
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	return len(text)
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += len(utf16.Encode([]rune{r}))
+	}
+	return n
+}
+
+// codeActions returns the quick fixes of the findings whose diagnostics are within
+// the lines of r.
+func (s *Server) codeActions(uri string, r lspRange) []any {
+	actions := []any{}
+	s.mu.Lock()
+	d, ok := s.docs[uri]
+	var text, languageID string
+	var findings []automata.Finding
+	if ok {
+		text, languageID, findings = d.text, d.languageID, d.findings
+	}
+	s.mu.Unlock()
+	if !ok || s.Fixes == nil {
+		return actions
+	}
+
+	lines := strings.Split(text, "\n")
+	for _, f := range findings {
+		diag := s.diagnostic(f, lines)
+		if diag.Range.Start.Line < r.Start.Line || diag.Range.Start.Line > r.End.Line {
+			continue
+		}
+		fixes := s.Fixes(uri, languageID, []byte(text), f)
+		for _, fix := range fixes {
+			edit := map[string]any{
+				"range":   lspRange{Start: positionOf(text, fix.Offset), End: positionOf(text, fix.Offset+fix.Length)},
+				"newText": fix.Text,
+			}
+			actions = append(actions, map[string]any{
+				"title":       fix.Title,
+				"kind":        "quickfix",
+				"diagnostics": []diagnostic{diag},
+				"isPreferred": len(fixes) == 1,
+				"edit":        map[string]any{"changes": map[string]any{uri: []any{edit}}},
+			})
+		}
+	}
+	return actions
+}
+
+// positionOf converts a byte offset in text to a position.
+func positionOf(text string, offset int) position {
+	if offset > len(text) {
+		offset = len(text)
+	}
+	line := strings.Count(text[:offset], "\n")
+	start := strings.LastIndexByte(text[:offset], '\n') + 1
+	return position{Line: line, Character: utf16Len(text[start:offset])}
+}
@@ -0,0 +1,374 @@
+package mailcheck
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/session"
+)
+
+// IMAPState is the state reported in IMAP findings.
+const IMAPState = "IMAP"
+
+// IMAPLiteralMinus is the largest non-synchronizing literal LITERAL- allows.
+const IMAPLiteralMinus = 4096
+
+// IMAP session states.
+const (
+	imapGreeting         = "GREETING"
+	imapNotAuthenticated = "NOT AUTHENTICATED"
+	imapAuthenticated    = "AUTHENTICATED"
+	imapSelected         = "SELECTED"
+	imapLogout           = "LOGOUT"
+	imapTLS              = "TLS"
+)
+
+// imapInitials maps states to the initials used in imapCommands to states.
+var imapInitials = map[string]string{
+	imapNotAuthenticated: "N",
+	imapAuthenticated:    "A",
+	imapSelected:         "S",
+}
+
+// imapCommand describes a command: the states it is valid in, by initial, and the
+// state a successful completion moves the session to, if any.
+type imapCommand struct {
+	states string
+	next   string
+}
+
+var imapCommands = map[string]imapCommand{
+	"CAPABILITY":   {states: "NAS"},
+	"NOOP":         {states: "NAS"},
+	"LOGOUT":       {states: "NAS", next: imapLogout},
+	"ID":           {states: "NAS"},
+	"STARTTLS":     {states: "N", next: imapTLS},
+	"AUTHENTICATE": {states: "N", next: imapAuthenticated},
+	"LOGIN":        {states: "N", next: imapAuthenticated},
+	"ENABLE":       {states: "A"},
+	"SELECT":       {states: "AS", next: imapSelected},
+	"EXAMINE":      {states: "AS", next: imapSelected},
+	"CREATE":       {states: "AS"},
+	"DELETE":       {states: "AS"},
+	"RENAME":       {states: "AS"},
+	"SUBSCRIBE":    {states: "AS"},
+	"UNSUBSCRIBE":  {states: "AS"},
+	"LIST":         {states: "AS"},
+	"LSUB":         {states: "AS"},
+	"NAMESPACE":    {states: "AS"},
+	"STATUS":       {states: "AS"},
+	"APPEND":       {states: "AS"},
+	"IDLE":         {states: "AS"},
+	"GETQUOTA":     {states: "AS"},
+	"GETQUOTAROOT": {states: "AS"},
+	"SETQUOTA":     {states: "AS"},
+	"GETACL":       {states: "AS"},
+	"SETACL":       {states: "AS"},
+	"GETMETADATA":  {states: "AS"},
+	"SETMETADATA":  {states: "AS"},
+	"CLOSE":        {states: "S", next: imapAuthenticated},
+	"UNSELECT":     {states: "S", next: imapAuthenticated},
+	"EXPUNGE":      {states: "S"},
+	"CHECK":        {states: "S"},
+	"SEARCH":       {states: "S"},
+	"FETCH":        {states: "S"},
+	"STORE":        {states: "S"},
+	"COPY":         {states: "S"},
+	"MOVE":         {states: "S"},
+	"SORT":         {states: "S"},
+	"THREAD":       {states: "S"},
+	"UID":          {states: "S"},
+}
+
+// imapUID are the commands UID prefixes.
+var imapUID = map[string]bool{"FETCH": true, "STORE": true, "COPY": true, "MOVE": true, "SEARCH": true, "EXPUNGE": true, "SORT": true, "THREAD": true}
+
+// imapUntagged are the untagged responses that are not status responses, with
+// whether they follow a message number.
+var imapUntagged = map[string]bool{
+	"CAPABILITY": false, "ENABLED": false, "LIST": false, "LSUB": false, "STATUS": false, "SEARCH": false,
+	"ESEARCH": false, "FLAGS": false, "NAMESPACE": false, "ID": false, "QUOTA": false, "QUOTAROOT": false,
+	"ACL": false, "LISTRIGHTS": false, "MYRIGHTS": false, "METADATA": false, "SORT": false, "THREAD": false,
+	"VANISHED": false,
+	"EXISTS":   true, "RECENT": true, "EXPUNGE": true, "FETCH": true,
+}
+
+// imapTag matches a tag: astring characters except '+'.
+var imapTag = regexp.MustCompile(`^[!#$&',-\[^-z|}~]+$`)
+
+// imapCapabilities finds capabilities in a CAPABILITY response or response code.
+var imapCapabilities = regexp.MustCompile(`(?i)^\* CAPABILITY (.*)$|\[CAPABILITY ([^\]]*)\]`)
+
+// imapPending is a command in progress.
+type imapPending struct {
+	tag, name string
+	next      string // state its success moves to
+	ev        session.Event
+}
+
+// imapSession is the state of an IMAP session being checked.
+type imapSession struct {
+	state   string
+	expect  string // the state once the commands in progress succeed
+	pending map[string]*imapPending
+	order   []*imapPending
+	caps    map[string]bool // nil until the server announces them
+	bye     bool
+
+	// Client side
+	command    *imapPending // command whose line goes on after a literal
+	syncWait   *imapPending // command waiting for a continuation request to send a literal
+	idle       *imapPending // IDLE command the server accepted; DONE ends it
+	idleWait   *imapPending // IDLE command sent, waiting for the server
+	sasl       *imapPending // AUTHENTICATE exchange in progress
+	serverCont bool         // the server's line goes on after a literal
+
+	findings []automata.Finding
+}
+
+func (s *imapSession) add(ev session.Event, command, severity, msg string) {
+	s.findings = append(s.findings, ev.Finding(IMAPState, command, severity, msg))
+}
+
+// CheckIMAP checks the events of an IMAP session, split with literals, from its
+// greeting on.
+func CheckIMAP(events []session.Event) []automata.Finding {
+	s := &imapSession{state: imapGreeting, expect: imapGreeting, pending: map[string]*imapPending{}}
+	for _, ev := range events {
+		if s.state == imapTLS {
+			break // the rest is TLS
+		}
+		if ev.BareLF {
+			s.add(ev, excerpt(ev.Text), automata.SeverityError, "line ends in LF without CR")
+		}
+		if ev.Partial {
+			what := "line"
+			if ev.Literal {
+				what = "literal"
+			}
+			s.add(ev, excerpt(ev.Text), automata.SeverityWarning, "session ends in the middle of a "+what)
+			continue
+		}
+		switch {
+		case ev.Client && ev.Literal:
+			if s.syncWait != nil {
+				s.add(ev, s.syncWait.name, automata.SeverityError, "literal data is sent before the server's continuation request")
+				s.syncWait = nil
+			}
+		case ev.Client:
+			s.client(ev)
+		case ev.Literal:
+			s.serverCont = true
+		default:
+			s.server(ev)
+		}
+	}
+	for _, p := range s.order {
+		if s.pending[p.tag] == p {
+			s.add(p.ev, p.name, automata.SeverityWarning, fmt.Sprintf("%s (tag %s) has no tagged completion", p.name, p.tag))
+		}
+	}
+	return s.findings
+}
+
+func (s *imapSession) client(ev session.Event) {
+	switch {
+	case s.idle != nil:
+		if !strings.EqualFold(ev.Text, "DONE") {
+			s.add(ev, excerpt(ev.Text), automata.SeverityError, "line other than DONE sent while idling")
+		}
+		s.idle = nil
+		return
+	case s.sasl != nil && s.command == nil:
+		return // a SASL response, or '*' to cancel
+	}
+	p := s.command
+	s.command = nil
+	if p == nil {
+		p = s.begin(ev)
+		if p == nil {
+			return
+		}
+	}
+	if ev.LiteralSize < 0 {
+		return
+	}
+	s.command = p
+	switch {
+	case !ev.NonSync:
+		s.syncWait = p
+	case s.caps == nil:
+	case s.caps["LITERAL+"] || s.caps["IMAP4REV2"] && ev.LiteralSize <= IMAPLiteralMinus:
+	case s.caps["LITERAL-"] || s.caps["IMAP4REV2"]:
+		if ev.LiteralSize > IMAPLiteralMinus {
+			s.add(ev, p.name, automata.SeverityError, fmt.Sprintf("non-synchronizing literal of %d octets is over the %d LITERAL- allows", ev.LiteralSize, IMAPLiteralMinus))
+		}
+	default:
+		s.add(ev, p.name, automata.SeverityError, "non-synchronizing literal {n+} is sent, but the server did not announce LITERAL+ or LITERAL-")
+	}
+}
+
+// begin checks the line that starts a command, returning it.
+func (s *imapSession) begin(ev session.Event) *imapPending {
+	tag, rest, _ := strings.Cut(ev.Text, " ")
+	name, args, _ := strings.Cut(rest, " ")
+	name = strings.ToUpper(name)
+	if !imapTag.MatchString(tag) {
+		s.add(ev, excerpt(ev.Text), automata.SeverityError, fmt.Sprintf("command tag %q has characters a tag cannot hold", tag))
+	}
+	if name == "" {
+		s.add(ev, excerpt(ev.Text), automata.SeverityError, "line has a tag but no command")
+		return nil
+	}
+	if s.pending[tag] != nil {
+		s.add(ev, name, automata.SeverityError, "tag "+tag+" is already used by a command in progress")
+	}
+	cmd, known := imapCommands[name]
+	if name == "UID" {
+		sub, _, _ := strings.Cut(args, " ")
+		if !imapUID[strings.ToUpper(sub)] {
+			s.add(ev, name, automata.SeverityError, fmt.Sprintf("UID cannot prefix %q", sub))
+		}
+	}
+	switch {
+	case s.state == imapGreeting:
+		s.add(ev, name, automata.SeverityError, name+" is sent before the server greeting")
+	case s.expect == imapLogout:
+		s.add(ev, name, automata.SeverityError, name+" is sent after LOGOUT")
+	case !known:
+		s.add(ev, name, automata.SeverityWarning, "unknown command "+name+"; it may be an extension")
+	case !strings.Contains(cmd.states, imapInitials[s.expect]):
+		s.add(ev, name, automata.SeverityError, name+" is not allowed in the "+s.expect+" state")
+	}
+	p := &imapPending{tag: tag, name: name, next: cmd.next, ev: ev}
+	s.pending[tag] = p
+	s.order = append(s.order, p)
+	if cmd.next != "" && cmd.next != imapTLS {
+		s.expect = cmd.next
+	}
+	switch name {
+	case "AUTHENTICATE":
+		s.sasl = p
+	case "IDLE":
+		s.idleWait = p
+	}
+	return p
+}
+
+func (s *imapSession) server(ev session.Event) {
+	if s.serverCont {
+		s.serverCont = ev.LiteralSize >= 0
+		return // the rest of a response after a literal
+	}
+	s.serverCont = ev.LiteralSize >= 0
+	if m := imapCapabilities.FindStringSubmatch(ev.Text); m != nil {
+		s.caps = map[string]bool{}
+		for _, c := range strings.Fields(m[1] + m[2]) {
+			s.caps[strings.ToUpper(c)] = true
+		}
+	}
+	tag, rest, _ := strings.Cut(ev.Text, " ")
+	switch tag {
+	case "+":
+		s.continuation(ev)
+	case "*":
+		s.untagged(ev, rest)
+	default:
+		s.tagged(ev, tag, rest)
+	}
+}
+
+// continuation checks a continuation request, which a command must be waiting for.
+func (s *imapSession) continuation(ev session.Event) {
+	switch {
+	case s.syncWait != nil:
+		s.syncWait = nil // the literal may be sent
+	case s.idleWait != nil:
+		s.idle, s.idleWait = s.idleWait, nil
+	case s.sasl != nil:
+	default:
+		s.add(ev, excerpt(ev.Text), automata.SeverityError, "continuation request while no command is waiting for one")
+	}
+}
+
+// untagged checks an untagged response: the greeting, a status, or data.
+func (s *imapSession) untagged(ev session.Event, rest string) {
+	word, _, _ := strings.Cut(rest, " ")
+	word = strings.ToUpper(word)
+	if s.state == imapGreeting {
+		switch word {
+		case "OK":
+			s.state, s.expect = imapNotAuthenticated, imapNotAuthenticated
+		case "PREAUTH":
+			s.state, s.expect = imapAuthenticated, imapAuthenticated
+		case "BYE":
+			s.state, s.expect = imapLogout, imapLogout
+		default:
+			s.add(ev, excerpt(ev.Text), automata.SeverityError, "greeting is not * OK, * PREAUTH, or * BYE")
+			s.state, s.expect = imapNotAuthenticated, imapNotAuthenticated
+		}
+		return
+	}
+	switch word {
+	case "OK", "NO", "BAD":
+	case "BYE":
+		s.bye = true
+	case "PREAUTH":
+		s.add(ev, word, automata.SeverityError, "PREAUTH is only sent as the greeting")
+	default:
+		if _, err := strconv.ParseUint(word, 10, 32); err == nil {
+			_, after, _ := strings.Cut(rest, " ")
+			word, _, _ = strings.Cut(after, " ")
+			word = strings.ToUpper(word)
+			if numbered, known := imapUntagged[word]; known && !numbered {
+				s.add(ev, word, automata.SeverityError, word+" does not follow a message number")
+			} else if !known {
+				s.add(ev, word, automata.SeverityWarning, "unknown untagged response "+word)
+			}
+			return
+		}
+		if numbered, known := imapUntagged[word]; !known {
+			s.add(ev, word, automata.SeverityWarning, "unknown untagged response "+word)
+		} else if numbered {
+			s.add(ev, word, automata.SeverityError, word+" must follow a message number")
+		}
+	}
+}
+
+// tagged checks the completion of a command.
+func (s *imapSession) tagged(ev session.Event, tag, rest string) {
+	status, _, _ := strings.Cut(rest, " ")
+	status = strings.ToUpper(status)
+	p := s.pending[tag]
+	if p == nil {
+		s.add(ev, excerpt(ev.Text), automata.SeverityError, "tagged response for "+tag+", which no command in progress carries")
+		return
+	}
+	delete(s.pending, tag)
+	for _, w := range []**imapPending{&s.command, &s.syncWait, &s.idle, &s.idleWait, &s.sasl} {
+		if *w == p {
+			*w = nil
+		}
+	}
+	if status != "OK" && status != "NO" && status != "BAD" {
+		s.add(ev, p.name, automata.SeverityError, fmt.Sprintf("tagged response status %q is not OK, NO, or BAD", status))
+		return
+	}
+	switch {
+	case status == "OK" && p.next == imapLogout:
+		if !s.bye {
+			s.add(ev, p.name, automata.SeverityError, "LOGOUT completes without an untagged BYE first")
+		}
+		s.state = imapLogout
+	case status == "OK" && p.next != "":
+		s.state = p.next
+	case p.name == "SELECT" || p.name == "EXAMINE":
+		s.state = imapAuthenticated // a failed SELECT closes the mailbox selected before
+	}
+	if status != "OK" || p.next == imapTLS {
+		s.expect = s.state
+	}
+}
@@ -0,0 +1,233 @@
+// Package mailcheck validates mail access sessions, POP3 (RFC 1939) and IMAP
+// (RFC 9051), by running each protocol's state machine over the lines of a session:
+// which commands each state allows, how responses pair with commands, and how
+// multi-line responses and literals are framed.
+package mailcheck
+
+import (
+	"regexp"
+	"strings"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/session"
+)
+
+// POP3State is the state reported in POP3 findings.
+const POP3State = "POP3"
+
+// POP3 line limits: commands may be 255 octets with the CRLF (RFC 2449), responses
+// 512.
+const (
+	POP3MaxCommand  = 255
+	POP3MaxResponse = 512
+)
+
+// POP3 session states.
+const (
+	pop3Greeting      = "GREETING"
+	pop3Authorization = "AUTHORIZATION"
+	pop3Transaction   = "TRANSACTION"
+	pop3Update        = "UPDATE"
+	pop3TLS           = "TLS"
+)
+
+// pop3Command describes a command: the states it is valid in, its arguments, and
+// whether a successful response to it is multi-line.
+type pop3Command struct {
+	states  string // initials of the states: A for AUTHORIZATION, T for TRANSACTION
+	args    *regexp.Regexp
+	usage   string
+	multi   func(args string) bool
+	changes bool // a successful response leaves the AUTHORIZATION state
+}
+
+var (
+	pop3None    = regexp.MustCompile(`^$`)
+	pop3Msg     = regexp.MustCompile(`^[1-9][0-9]*$`)
+	pop3OptMsg  = regexp.MustCompile(`^([1-9][0-9]*)?$`)
+	pop3Any     = regexp.MustCompile(`^.+$`)
+	pop3APOP    = regexp.MustCompile(`^\S+ [0-9a-fA-F]{32}$`)
+	pop3Top     = regexp.MustCompile(`^[1-9][0-9]* [0-9]+$`)
+	pop3Auth    = regexp.MustCompile(`^([A-Za-z0-9_-]+( \S+)?)?$`)
+	pop3Always  = func(string) bool { return true }
+	pop3Listing = func(args string) bool { return args == "" }
+)
+
+var pop3Commands = map[string]pop3Command{
+	"USER": {states: "A", args: pop3Any, usage: "USER name"},
+	"PASS": {states: "A", args: regexp.MustCompile(`^.*$`), usage: "PASS string", changes: true},
+	"APOP": {states: "A", args: pop3APOP, usage: "APOP name digest, with a 32-digit hex MD5 digest", changes: true},
+	"AUTH": {states: "A", args: pop3Auth, usage: "AUTH mechanism [initial-response]", multi: pop3Listing, changes: true},
+	"STLS": {states: "A", args: pop3None, usage: "STLS"},
+	"CAPA": {states: "AT", args: pop3None, usage: "CAPA", multi: pop3Always},
+	"QUIT": {states: "AT", args: pop3None, usage: "QUIT"},
+	"STAT": {states: "T", args: pop3None, usage: "STAT"},
+	"LIST": {states: "T", args: pop3OptMsg, usage: "LIST [msg]", multi: pop3Listing},
+	"UIDL": {states: "T", args: pop3OptMsg, usage: "UIDL [msg]", multi: pop3Listing},
+	"RETR": {states: "T", args: pop3Msg, usage: "RETR msg", multi: pop3Always},
+	"TOP":  {states: "T", args: pop3Top, usage: "TOP msg n", multi: pop3Always},
+	"DELE": {states: "T", args: pop3Msg, usage: "DELE msg"},
+	"NOOP": {states: "T", args: pop3None, usage: "NOOP"},
+	"RSET": {states: "T", args: pop3None, usage: "RSET"},
+	"UTF8": {states: "A", args: pop3None, usage: "UTF8"},
+	"LANG": {states: "AT", args: regexp.MustCompile(`^(\S+)?$`), usage: "LANG [tag]", multi: pop3Listing},
+}
+
+// pop3Pending is a command waiting for its response.
+type pop3Pending struct {
+	name, args string
+	cmd        pop3Command
+	state      string // state it was sent in
+	ev         session.Event
+}
+
+// pop3Session is the state of a POP3 session being checked.
+type pop3Session struct {
+	state    string
+	expect   string // the state once the commands in progress succeed, as pipelining clients assume
+	pending  []pop3Pending
+	multi    *pop3Pending // command whose multi-line response is being read
+	sasl     bool         // an AUTH exchange is in progress
+	user     bool         // the last command was USER, and was not refused
+	quit     bool
+	findings []automata.Finding
+}
+
+func (s *pop3Session) add(ev session.Event, command, severity, msg string) {
+	s.findings = append(s.findings, ev.Finding(POP3State, command, severity, msg))
+}
+
+// CheckPOP3 checks the events of a POP3 session, from its greeting on.
+func CheckPOP3(events []session.Event) []automata.Finding {
+	s := &pop3Session{state: pop3Greeting, expect: pop3Greeting}
+	for _, ev := range events {
+		if s.state == pop3TLS {
+			break // the rest is TLS
+		}
+		if ev.BareLF {
+			s.add(ev, excerpt(ev.Text), automata.SeverityError, "line ends in LF without CR")
+		}
+		if ev.Partial {
+			s.add(ev, excerpt(ev.Text), automata.SeverityWarning, "session ends in the middle of a line")
+			continue
+		}
+		if ev.Client {
+			s.client(ev)
+		} else {
+			s.server(ev)
+		}
+	}
+	for _, p := range s.pending {
+		s.add(p.ev, p.name, automata.SeverityWarning, p.name+" has no response")
+	}
+	if s.multi != nil {
+		s.add(s.multi.ev, s.multi.name, automata.SeverityError, "multi-line response to "+s.multi.name+" is not terminated by a line holding only '.'")
+	}
+	return s.findings
+}
+
+func (s *pop3Session) client(ev session.Event) {
+	if len(ev.Text)+2 > POP3MaxCommand {
+		s.add(ev, excerpt(ev.Text), automata.SeverityWarning, "command is longer than 255 octets")
+	}
+	if s.sasl {
+		return // a SASL response, or '*' to cancel
+	}
+	name, args, _ := strings.Cut(ev.Text, " ")
+	name = strings.ToUpper(name)
+	cmd, known := pop3Commands[name]
+	switch {
+	case s.quit:
+		s.add(ev, name, automata.SeverityError, name+" is sent after QUIT")
+	case s.state == pop3Greeting:
+		s.add(ev, name, automata.SeverityError, name+" is sent before the server greeting")
+	case !known:
+		s.add(ev, name, automata.SeverityWarning, "unknown command "+name+"; it may be an extension")
+	case !strings.Contains(cmd.states, s.expect[:1]):
+		s.add(ev, name, automata.SeverityError, name+" is not allowed in the "+s.expect+" state")
+	case name == "PASS" && !s.user:
+		s.add(ev, name, automata.SeverityError, "PASS must directly follow a successful USER")
+	}
+	if known && !cmd.args.MatchString(args) {
+		s.add(ev, name, automata.SeverityError, "arguments do not match "+cmd.usage)
+	}
+	s.user = name == "USER"
+	if name == "AUTH" && args != "" {
+		s.sasl = true
+	}
+	if name == "QUIT" {
+		s.quit = true
+	}
+	s.pending = append(s.pending, pop3Pending{name: name, args: args, cmd: cmd, state: s.expect, ev: ev})
+	if cmd.changes && s.expect == pop3Authorization && (name != "AUTH" || args != "") {
+		s.expect = pop3Transaction
+	}
+}
+
+func (s *pop3Session) server(ev session.Event) {
+	if s.multi != nil {
+		switch {
+		case ev.Text == ".":
+			s.multi = nil
+		case strings.HasPrefix(ev.Text, ".") && !strings.HasPrefix(ev.Text, ".."):
+			s.add(ev, excerpt(ev.Text), automata.SeverityError, "line of a multi-line response starting with '.' is not byte-stuffed")
+		}
+		return
+	}
+	if len(ev.Text)+2 > POP3MaxResponse {
+		s.add(ev, excerpt(ev.Text), automata.SeverityWarning, "response is longer than 512 octets")
+	}
+	ok := ev.Text == "+OK" || strings.HasPrefix(ev.Text, "+OK ")
+	if s.sasl && !ok && strings.HasPrefix(ev.Text, "+") {
+		return // a SASL challenge
+	}
+	if !ok && ev.Text != "-ERR" && !strings.HasPrefix(ev.Text, "-ERR ") {
+		s.add(ev, excerpt(ev.Text), automata.SeverityError, "response does not start with +OK or -ERR")
+		ok = strings.HasPrefix(ev.Text, "+")
+	}
+	if s.state == pop3Greeting {
+		if ok {
+			s.state, s.expect = pop3Authorization, pop3Authorization
+		} else {
+			s.quit = true
+		}
+		return
+	}
+	if len(s.pending) == 0 {
+		s.add(ev, excerpt(ev.Text), automata.SeverityError, "response without a command")
+		return
+	}
+	p := s.pending[0]
+	s.pending = s.pending[1:]
+	if p.name == "AUTH" {
+		s.sasl = false
+	}
+	if !ok {
+		if p.name == "USER" {
+			s.user = false
+		}
+		s.expect = s.state
+		return
+	}
+	if p.cmd.states != "" && (p.state == pop3Greeting || !strings.Contains(p.cmd.states, p.state[:1])) {
+		s.add(ev, p.name, automata.SeverityError, "server accepted "+p.name+", which is not valid in the "+p.state+" state")
+	}
+	switch {
+	case p.cmd.changes && p.state == pop3Authorization && (p.name != "AUTH" || p.args != ""):
+		s.state = pop3Transaction
+	case p.name == "STLS":
+		s.state = pop3TLS
+	case p.name == "QUIT" && p.state == pop3Transaction:
+		s.state = pop3Update
+	}
+	if p.cmd.multi != nil && p.cmd.multi(p.args) {
+		s.multi = &p
+	}
+}
+
+func excerpt(s string) string {
+	if len(s) > 60 {
+		return s[:57] + "..."
+	}
+	return s
+}
@@ -0,0 +1,226 @@
+// Package mediatype parses and validates media types, the values of Content-Type
+// headers (RFC 9110 section 8.3, RFC 6838): type and subtype tokens, parameters and
+// their quoting, charset names, and multipart boundaries.
+package mediatype
+
+import (
+	"fmt"
+	"strings"
+
+	"config-validator/pkg/automata"
+)
+
+// State is the state reported in media type findings.
+const State = "MEDIA_TYPE"
+
+// MediaType is a parsed media type.
+type MediaType struct {
+	Type    string
+	Subtype string
+	Params  map[string]string // by lowercase name
+}
+
+// Essence returns "type/subtype" in lowercase.
+func (m MediaType) Essence() string { return m.Type + "/" + m.Subtype }
+
+// Suffix returns the structured syntax suffix of the subtype, such as "json" for
+// application/vnd.api+json, or "".
+func (m MediaType) Suffix() string {
+	if i := strings.LastIndexByte(m.Subtype, '+'); i >= 0 {
+		return m.Subtype[i+1:]
+	}
+	return ""
+}
+
+// topLevel are the registered top-level types.
+var topLevel = map[string]bool{
+	"application": true, "audio": true, "example": true, "font": true, "haptics": true, "image": true,
+	"message": true, "model": true, "multipart": true, "text": true, "video": true,
+}
+
+// charsets are common registered charset names. Others are warnings, not errors, as
+// the registry is long.
+var charsets = map[string]bool{
+	"utf-8": true, "us-ascii": true, "utf-16": true, "utf-16le": true, "utf-16be": true, "utf-32": true,
+	"iso-8859-1": true, "iso-8859-2": true, "iso-8859-3": true, "iso-8859-4": true, "iso-8859-5": true,
+	"iso-8859-6": true, "iso-8859-7": true, "iso-8859-8": true, "iso-8859-9": true, "iso-8859-10": true,
+	"iso-8859-13": true, "iso-8859-14": true, "iso-8859-15": true, "iso-8859-16": true,
+	"windows-1250": true, "windows-1251": true, "windows-1252": true, "windows-1253": true,
+	"windows-1254": true, "windows-1255": true, "windows-1256": true, "windows-1257": true,
+	"windows-1258": true, "shift_jis": true, "euc-jp": true, "iso-2022-jp": true, "euc-kr": true,
+	"gb2312": true, "gbk": true, "gb18030": true, "big5": true, "koi8-r": true, "koi8-u": true,
+}
+
+// charsetTypos maps common misspellings to the registered name.
+var charsetTypos = map[string]string{
+	"utf8": "utf-8", "utf_8": "utf-8", "latin1": "iso-8859-1", "latin-1": "iso-8859-1",
+	"ascii": "us-ascii", "utf16": "utf-16", "sjis": "shift_jis", "cp1252": "windows-1252",
+}
+
+// isToken reports whether s is a token: one or more tchars.
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isTchar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isTchar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+}
+
+// Parse parses a Content-Type value. It returns the media type, as far as it could
+// be read, and the problems found, as findings on the given line.
+func Parse(value string, line int) (MediaType, []automata.Finding) {
+	var findings []automata.Finding
+	add := func(severity, msg string) {
+		findings = append(findings, automata.Finding{
+			Line: line, Command: value, State: State, Message: msg, Severity: severity,
+		})
+	}
+
+	m := MediaType{Params: map[string]string{}}
+	essence, rest, _ := strings.Cut(value, ";")
+	essence = strings.TrimSpace(essence)
+	typ, subtype, ok := strings.Cut(essence, "/")
+	switch {
+	case essence == "":
+		add(automata.SeverityError, "media type is empty")
+		return m, findings
+	case !ok:
+		add(automata.SeverityError, fmt.Sprintf("media type %q has no '/': it must be type/subtype, such as application/json", essence))
+		return m, findings
+	case !isToken(typ) || !isToken(subtype):
+		add(automata.SeverityError, fmt.Sprintf("media type %q is not type/subtype of token characters", essence))
+	}
+	m.Type, m.Subtype = strings.ToLower(typ), strings.ToLower(subtype)
+	if isToken(m.Type) && !topLevel[m.Type] {
+		add(automata.SeverityWarning, fmt.Sprintf("%q is not a registered top-level type", m.Type))
+	}
+
+	seen := map[string]bool{}
+	for rest != "" {
+		var param string
+		param, rest = nextParam(rest)
+		param = strings.TrimSpace(param)
+		if param == "" {
+			continue // RFC 9110 allows empty parameters
+		}
+		name, val, ok := strings.Cut(param, "=")
+		name = strings.ToLower(name)
+		switch {
+		case !ok:
+			add(automata.SeverityError, fmt.Sprintf("parameter %q has no '=value'", param))
+			continue
+		case !isToken(name):
+			add(automata.SeverityError, fmt.Sprintf("parameter name %q is not a token (no spaces around '=')", name))
+			continue
+		case seen[name]:
+			add(automata.SeverityError, fmt.Sprintf("parameter %q is given more than once", name))
+			continue
+		}
+		seen[name] = true
+		v, msg := paramValue(val)
+		if msg != "" {
+			add(automata.SeverityError, fmt.Sprintf("parameter %s: %s", name, msg))
+		}
+		m.Params[name] = v
+	}
+
+	if charset, ok := m.Params["charset"]; ok {
+		c := strings.ToLower(charset)
+		switch {
+		case charsetTypos[c] != "":
+			add(automata.SeverityWarning, fmt.Sprintf("charset %q is not a registered name; use %s", charset, charsetTypos[c]))
+		case !charsets[c]:
+			add(automata.SeverityWarning, fmt.Sprintf("charset %q is not a common registered charset", charset))
+		}
+		if m.Essence() == "application/json" || m.Suffix() == "json" {
+			add(automata.SeverityWarning, "JSON has no charset parameter (RFC 8259): it is always UTF-8")
+		}
+	}
+	if m.Type == "multipart" {
+		if b, ok := m.Params["boundary"]; !ok {
+			add(automata.SeverityError, "multipart media types need a boundary parameter")
+		} else if msg := checkBoundary(b); msg != "" {
+			add(automata.SeverityError, "boundary "+msg)
+		}
+	}
+	return m, findings
+}
+
+// nextParam splits off the next parameter, honoring quoted strings.
+func nextParam(s string) (string, string) {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quoted && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == ';' && !quoted:
+			return s[:i], s[i+1:]
+		}
+	}
+	return s, ""
+}
+
+// paramValue reads a token or quoted-string value and says what is wrong with it.
+func paramValue(v string) (string, string) {
+	if !strings.HasPrefix(v, `"`) {
+		if v == "" {
+			return v, "value is empty; use \"\" for an empty value"
+		}
+		if !isToken(v) {
+			return v, fmt.Sprintf("value %q has characters that are not allowed in a token, so it must be quoted", v)
+		}
+		return v, ""
+	}
+	var sb strings.Builder
+	for i := 1; i < len(v); i++ {
+		switch c := v[i]; {
+		case c == '\\' && i+1 < len(v):
+			i++
+			sb.WriteByte(v[i])
+		case c == '"':
+			if rest := strings.TrimSpace(v[i+1:]); rest != "" {
+				return sb.String(), fmt.Sprintf("unexpected %q after the closing quote", rest)
+			}
+			return sb.String(), ""
+		case c < 0x20 && c != '\t', c == 0x7f:
+			return sb.String(), "quoted value has a control character"
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String(), "quoted value is not closed"
+}
+
+// checkBoundary checks a multipart boundary (RFC 2046 section 5.1.1).
+func checkBoundary(b string) string {
+	const bchars = "'()+_,-./:=? "
+	switch {
+	case b == "":
+		return "is empty"
+	case len(b) > 70:
+		return fmt.Sprintf("has %d characters; at most 70 are allowed", len(b))
+	case strings.HasSuffix(b, " "):
+		return "must not end with a space"
+	}
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte(bchars, c) >= 0) {
+			return fmt.Sprintf("has %q, which RFC 2046 does not allow", c)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,194 @@
+// Package netflow validates flow export packets: NetFlow v5, NetFlow v9 (RFC 3954),
+// and IPFIX (RFC 7011). Each packet's header and flowsets are checked, templates are
+// tracked per exporter so data records are checked against the template declared
+// for them, and sequence numbers are followed across a capture to find the packets
+// or records that were lost.
+package netflow
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"config-validator/pkg/automata"
+)
+
+// State is the state reported in flow export findings.
+const State = "NETFLOW"
+
+// Checker checks the packets of a capture in order, keeping the templates and
+// sequence numbers of each exporter.
+type Checker struct {
+	exporters map[exporterKey]*exporter
+	findings  []automata.Finding
+	Packets   int         // packets checked
+	Versions  map[int]int // packets checked by version
+}
+
+// exporterKey identifies an exporting process: its address, and the source id of
+// NetFlow v9, the observation domain of IPFIX, or the engine of NetFlow v5.
+type exporterKey struct {
+	addr    string
+	version int
+	domain  uint32
+}
+
+type exporter struct {
+	templates map[uint16]*template
+	next      uint32 // expected sequence number
+	started   bool
+}
+
+// template is a declared template: the lengths of its fields in order, with
+// variableLength for IPFIX fields of variable length.
+type template struct {
+	fields  []field
+	options bool
+	scope   int // scope fields, for options templates
+}
+
+type field struct {
+	id     uint16
+	length uint16
+}
+
+const variableLength = 65535
+
+// minLength is the smallest record the template describes.
+func (t *template) minLength() int {
+	n := 0
+	for _, f := range t.fields {
+		if f.length == variableLength {
+			n++
+		} else {
+			n += int(f.length)
+		}
+	}
+	return n
+}
+
+func (t *template) equal(o *template) bool {
+	if len(t.fields) != len(o.fields) || t.scope != o.scope {
+		return false
+	}
+	for i := range t.fields {
+		if t.fields[i] != o.fields[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// NewChecker returns a checker with no exporters seen.
+func NewChecker() *Checker {
+	return &Checker{exporters: map[exporterKey]*exporter{}, Versions: map[int]int{}}
+}
+
+// Findings returns the findings of the packets checked so far.
+func (c *Checker) Findings() []automata.Finding { return c.findings }
+
+// packet is the context of the packet being checked.
+type packet struct {
+	c     *Checker
+	where string
+}
+
+func (p packet) add(severity, format string, args ...any) {
+	p.c.findings = append(p.c.findings, automata.Finding{Command: p.where, State: State, Severity: severity,
+		Message: fmt.Sprintf("%s: %s", p.where, fmt.Sprintf(format, args...))})
+}
+
+func (c *Checker) exporter(key exporterKey) *exporter {
+	e := c.exporters[key]
+	if e == nil {
+		e = &exporter{templates: map[uint16]*template{}}
+		c.exporters[key] = e
+	}
+	return e
+}
+
+// Packet checks one export packet. where names it in findings, such as its number in
+// the capture; addr is the exporter's address.
+func (c *Checker) Packet(where, addr string, data []byte) {
+	p := packet{c: c, where: where}
+	if len(data) < 2 {
+		p.add(automata.SeverityError, "packet is too short to hold a version")
+		return
+	}
+	version := int(binary.BigEndian.Uint16(data))
+	c.Packets++
+	c.Versions[version]++
+	switch version {
+	case 5:
+		c.v5(p, addr, data)
+	case 9:
+		c.v9(p, addr, data)
+	case 10:
+		c.ipfix(p, addr, data)
+	default:
+		p.add(automata.SeverityError, "version %d is not NetFlow v5, v9, or IPFIX (10)", version)
+	}
+}
+
+// sequence follows an exporter's sequence numbers. seq is the packet's, and next
+// what the packet after it should carry. unit names what the numbers count.
+func (e *exporter) sequence(p packet, seq, next uint32, unit string) {
+	if e.started && seq != e.next {
+		if d := seq - e.next; d < 1<<31 {
+			p.add(automata.SeverityWarning, "sequence number %d, expected %d: %d %s were lost or not captured", seq, e.next, d, unit)
+		} else {
+			p.add(automata.SeverityWarning, "sequence number %d goes back from %d: the exporter restarted or packets were reordered", seq, e.next)
+		}
+	}
+	e.started, e.next = true, next
+}
+
+// v5 checks a NetFlow v5 packet: a 24-byte header and count records of 48 bytes.
+func (c *Checker) v5(p packet, addr string, data []byte) {
+	if len(data) < 24 {
+		p.add(automata.SeverityError, "NetFlow v5 header is truncated")
+		return
+	}
+	count := int(binary.BigEndian.Uint16(data[2:]))
+	seq := binary.BigEndian.Uint32(data[16:])
+	if count < 1 || count > 30 {
+		p.add(automata.SeverityError, "NetFlow v5 count %d is outside 1 to 30", count)
+	}
+	if want := 24 + 48*count; len(data) != want {
+		p.add(automata.SeverityError, "NetFlow v5 packet is %d bytes, but a count of %d needs %d", len(data), count, want)
+		count = min(count, (len(data)-24)/48)
+	}
+	if mode := data[22] >> 6; mode > 2 {
+		p.add(automata.SeverityError, "NetFlow v5 sampling mode %d is not defined", mode)
+	}
+	key := exporterKey{addr: addr, version: 5, domain: uint32(data[20])<<8 | uint32(data[21])}
+	c.exporter(key).sequence(p, seq, seq+uint32(count), "flows")
+	for i := 0; i < count; i++ {
+		r := data[24+48*i:]
+		first, last := binary.BigEndian.Uint32(r[24:]), binary.BigEndian.Uint32(r[28:])
+		if first > last {
+			p.add(automata.SeverityWarning, "record %d: flow starts (%d ms) after it ends (%d ms)", i+1, first, last)
+		}
+		if binary.BigEndian.Uint32(r[16:]) == 0 {
+			p.add(automata.SeverityWarning, "record %d: flow has no packets", i+1)
+		}
+	}
+}
+
+// File checks a file of IPFIX messages written back to back (RFC 5655), which
+// export collectors and tools save flows in.
+func (c *Checker) File(data []byte) {
+	for pos, n := 0, 1; pos < len(data); n++ {
+		where := fmt.Sprintf("message %d at offset %d", n, pos)
+		if len(data)-pos < 4 || binary.BigEndian.Uint16(data[pos:]) != 10 {
+			packet{c: c, where: where}.add(automata.SeverityError, "not an IPFIX message header; a file holds IPFIX messages back to back")
+			return
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 16 || pos+length > len(data) {
+			packet{c: c, where: where}.add(automata.SeverityError, "IPFIX message length %d does not fit the file", length)
+			return
+		}
+		c.Packet(where, "", data[pos:pos+length])
+		pos += length
+	}
+}
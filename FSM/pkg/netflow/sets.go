@@ -0,0 +1,274 @@
+package netflow
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"config-validator/pkg/automata"
+)
+
+// v9 checks a NetFlow v9 packet: a 20-byte header and flowsets. Sequence numbers
+// count packets, and the header count is the number of template and data records.
+func (c *Checker) v9(p packet, addr string, data []byte) {
+	if len(data) < 20 {
+		p.add(automata.SeverityError, "NetFlow v9 header is truncated")
+		return
+	}
+	count := int(binary.BigEndian.Uint16(data[2:]))
+	seq := binary.BigEndian.Uint32(data[12:])
+	e := c.exporter(exporterKey{addr: addr, version: 9, domain: binary.BigEndian.Uint32(data[16:])})
+	e.sequence(p, seq, seq+1, "packets")
+	records, templates, complete := c.sets(p, e, data[20:], 20, false)
+	if complete && records+templates != count {
+		p.add(automata.SeverityWarning, "header count is %d, but the packet holds %d records", count, records+templates)
+	}
+}
+
+// ipfix checks an IPFIX message: a 16-byte header whose length is the message's,
+// and sets. Sequence numbers count the data records sent before the message.
+func (c *Checker) ipfix(p packet, addr string, data []byte) {
+	if len(data) < 16 {
+		p.add(automata.SeverityError, "IPFIX header is truncated")
+		return
+	}
+	length := int(binary.BigEndian.Uint16(data[2:]))
+	switch {
+	case length < 16:
+		p.add(automata.SeverityError, "IPFIX message length %d is shorter than its header", length)
+		return
+	case length > len(data):
+		p.add(automata.SeverityError, "IPFIX message length %d is more than the %d bytes received", length, len(data))
+		return
+	case length < len(data):
+		p.add(automata.SeverityError, "IPFIX message length %d is less than the %d bytes received", length, len(data))
+		data = data[:length]
+	}
+	seq := binary.BigEndian.Uint32(data[8:])
+	e := c.exporter(exporterKey{addr: addr, version: 10, domain: binary.BigEndian.Uint32(data[12:])})
+	records, _, complete := c.sets(p, e, data[16:], 16, true)
+	e.sequence(p, seq, seq+uint32(records), "data records")
+	if !complete {
+		e.started = false // the records of unknown templates were not counted
+	}
+}
+
+// sets checks the sets of a packet body that starts at offset base. It returns the
+// data and template records found, and whether every data set could be decoded.
+func (c *Checker) sets(p packet, e *exporter, body []byte, base int, ipfix bool) (records, templates int, complete bool) {
+	complete = true
+	templateSet, optionsSet := uint16(0), uint16(1)
+	if ipfix {
+		templateSet, optionsSet = 2, 3
+	}
+	for pos := 0; pos < len(body); {
+		if len(body)-pos < 4 {
+			p.add(automata.SeverityError, "offset %d: %d bytes after the last set are too few for a set header", base+pos, len(body)-pos)
+			return records, templates, false
+		}
+		id := binary.BigEndian.Uint16(body[pos:])
+		length := int(binary.BigEndian.Uint16(body[pos+2:]))
+		if length < 4 || pos+length > len(body) {
+			p.add(automata.SeverityError, "offset %d: set %d has length %d, which does not fit the packet", base+pos, id, length)
+			return records, templates, false
+		}
+		s := set{packet: p, offset: base + pos, id: id, data: body[pos+4 : pos+length], ipfix: ipfix}
+		switch {
+		case id == templateSet:
+			templates += s.templates(e, false)
+		case id == optionsSet:
+			templates += s.templates(e, true)
+		case id >= 256:
+			n, ok := s.dataRecords(e)
+			records += n
+			complete = complete && ok
+		default:
+			p.add(automata.SeverityError, "offset %d: set id %d is reserved", s.offset, id)
+		}
+		if !ipfix && length%4 != 0 {
+			p.add(automata.SeverityWarning, "offset %d: flowset length %d is not padded to a multiple of 4", s.offset, length)
+		}
+		pos += length
+	}
+	return records, templates, complete
+}
+
+// set is a set being checked.
+type set struct {
+	packet
+	offset int
+	id     uint16
+	data   []byte
+	ipfix  bool
+}
+
+func (s set) add(severity, format string, args ...any) {
+	s.packet.add(severity, "offset %d: set %d: %s", s.offset, s.id, fmt.Sprintf(format, args...))
+}
+
+// templates declares the template records of a template or options template set,
+// returning how many there were.
+func (s set) templates(e *exporter, options bool) int {
+	d, n := s.data, 0
+	for len(d) >= 4 {
+		if allZero(d) {
+			break // padding
+		}
+		t := &template{options: options}
+		id, count := binary.BigEndian.Uint16(d), int(binary.BigEndian.Uint16(d[2:]))
+		var err string
+		switch {
+		case count == 0 && s.ipfix:
+			d = d[4:] // a withdrawal, which has no scope field count
+		case options && !s.ipfix:
+			// template id, scope length, and option length, in bytes
+			if len(d) < 6 {
+				err = "options template header is truncated"
+				break
+			}
+			scopeLen, optLen := count, int(binary.BigEndian.Uint16(d[4:]))
+			d = d[6:]
+			if scopeLen%4 != 0 || optLen%4 != 0 {
+				err = fmt.Sprintf("scope length %d and option length %d must be multiples of 4", scopeLen, optLen)
+				break
+			}
+			if scopeLen == 0 {
+				s.add(automata.SeverityError, "options template %d has no scope fields", id)
+			}
+			t.scope, count = scopeLen/4, (scopeLen+optLen)/4
+		case options:
+			if len(d) < 6 {
+				err = "options template header is truncated"
+				break
+			}
+			t.scope = int(binary.BigEndian.Uint16(d[4:]))
+			d = d[6:]
+			if t.scope < 1 || t.scope > count {
+				s.add(automata.SeverityError, "options template %d has scope field count %d; it must be 1 to its field count %d", id, t.scope, count)
+			}
+		default:
+			d = d[4:]
+		}
+		if err == "" {
+			d, err = t.parseFields(d, count, s.ipfix)
+		}
+		if err != "" {
+			s.add(automata.SeverityError, "template %d: %s", id, err)
+			return n
+		}
+		n++
+		if count == 0 && s.ipfix && id == s.id {
+			for tid, old := range e.templates { // withdraws all templates of the set's kind
+				if old.options == options {
+					delete(e.templates, tid)
+				}
+			}
+			continue
+		}
+		if id < 256 {
+			s.add(automata.SeverityError, "template id %d is below 256, which are reserved for set ids", id)
+			continue
+		}
+		if count == 0 {
+			if s.ipfix {
+				delete(e.templates, id) // a withdrawal
+				continue
+			}
+			s.add(automata.SeverityError, "template %d has no fields", id)
+			continue
+		}
+		if old := e.templates[id]; old != nil && !old.equal(t) {
+			s.add(automata.SeverityWarning, "template %d is redefined with different fields without being withdrawn", id)
+		}
+		e.templates[id] = t
+	}
+	if len(d) > 0 && !allZero(d) {
+		s.add(automata.SeverityError, "%d bytes after the last template are not zero padding", len(d))
+	}
+	return n
+}
+
+// parseFields reads count field specifiers.
+func (t *template) parseFields(d []byte, count int, ipfix bool) ([]byte, string) {
+	for i := 0; i < count; i++ {
+		if len(d) < 4 {
+			return d, fmt.Sprintf("field %d of %d is truncated", i+1, count)
+		}
+		f := field{id: binary.BigEndian.Uint16(d), length: binary.BigEndian.Uint16(d[2:])}
+		d = d[4:]
+		if ipfix && f.id&0x8000 != 0 {
+			if len(d) < 4 {
+				return d, fmt.Sprintf("enterprise number of field %d is truncated", i+1)
+			}
+			d = d[4:]
+		}
+		switch {
+		case f.length == 0:
+			return d, fmt.Sprintf("field %d (type %d) has length 0", i+1, f.id&0x7fff)
+		case f.length == variableLength && !ipfix:
+			return d, fmt.Sprintf("field %d (type %d) has variable length, which NetFlow v9 does not support", i+1, f.id)
+		}
+		t.fields = append(t.fields, f)
+	}
+	return d, ""
+}
+
+// dataRecords checks a data set against its template, returning the records in it
+// and whether the template was known.
+func (s set) dataRecords(e *exporter) (int, bool) {
+	t := e.templates[s.id]
+	if t == nil {
+		s.add(automata.SeverityError, "data set for template %d, which was not declared before it (it may have been sent before the capture started)", s.id)
+		return 0, false
+	}
+	d, n := s.data, 0
+	minLen := t.minLength()
+	for len(d) >= minLen {
+		rest, ok := t.record(d)
+		if !ok {
+			s.add(automata.SeverityError, "record %d: a variable-length field runs past the end of the set", n+1)
+			return n, true
+		}
+		n++
+		d = rest
+	}
+	if len(d) > 0 && !allZero(d) {
+		s.add(automata.SeverityError, "%d bytes after the last record are neither a record of template %d nor zero padding", len(d), s.id)
+	}
+	if n == 0 {
+		s.add(automata.SeverityWarning, "data set holds no records")
+	}
+	return n, true
+}
+
+// record reads one record, returning the data after it.
+func (t *template) record(d []byte) ([]byte, bool) {
+	for _, f := range t.fields {
+		n := int(f.length)
+		if f.length == variableLength {
+			if len(d) < 1 {
+				return d, false
+			}
+			n, d = int(d[0]), d[1:]
+			if n == 255 {
+				if len(d) < 2 {
+					return d, false
+				}
+				n, d = int(binary.BigEndian.Uint16(d)), d[2:]
+			}
+		}
+		if len(d) < n {
+			return d, false
+		}
+		d = d[n:]
+	}
+	return d, true
+}
+
+func allZero(d []byte) bool {
+	for _, b := range d {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
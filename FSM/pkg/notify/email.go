@@ -0,0 +1,137 @@
+package notify
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Email is how an email sink delivers: the SMTP server, the addresses, and whether
+// the report is mailed as plain text or HTML. Mail goes out with STARTTLS when the
+// server offers it, which the server must for a password to be sent.
+type Email struct {
+	SMTP        string   `yaml:"smtp"` // host:port of the SMTP server
+	From        string   `yaml:"from"`
+	To          []string `yaml:"to"`
+	Username    string   `yaml:"username"`     // for SMTP authentication; none when empty
+	PasswordEnv string   `yaml:"password_env"` // environment variable holding the password
+	Format      string   `yaml:"format"`       // text (the default) or html
+}
+
+// defaultEmailTemplate is the text report mailed by email sinks: every finding, not
+// just the top ones, as the mail is the report.
+const defaultEmailTemplate = `Validation of {{.Subject}}: {{.Status}}{{with .PreviousStatus}} (was {{.}}){{end}}
+{{if .Findings}}
+{{len .Findings}} finding(s){{with .NewFindings}}, {{len .}} new{{end}}:
+{{range .Findings}}  - {{.}}
+{{end}}{{end}}{{with .Owners}}
+By owner:
+{{range $owner, $findings := .}}  {{$owner}}: {{len $findings}}
+{{end}}{{end}}{{with .ReportURL}}
+Report: {{.}}
+{{end}}
+Validated at {{.Time.Format "2006-01-02 15:04:05 MST"}}.
+`
+
+// defaultEmailHTML is the HTML form of defaultEmailTemplate, with new findings marked.
+const defaultEmailHTML = `<html><body style="font-family: sans-serif">
+<h2>{{if eq .Status "success"}}&#x2705;{{else}}&#x274C;{{end}} {{.Subject}}: {{.Status}}</h2>
+{{with .PreviousStatus}}<p>Previous run: {{.}}</p>{{end}}
+{{if .Findings}}<p>{{len .Findings}} finding(s){{with .NewFindings}}, {{len .}} new{{end}}:</p>
+<ul>{{range .Findings}}<li>{{if isNew .}}<b>new</b> {{end}}<code>{{.}}</code></li>{{end}}</ul>{{end}}
+{{with .Owners}}<table border="1" cellpadding="4" style="border-collapse: collapse"><tr><th>Owner</th><th>Findings</th></tr>
+{{range $owner, $findings := .}}<tr><td>{{$owner}}</td><td>{{len $findings}}</td></tr>{{end}}</table>{{end}}
+{{with .ReportURL}}<p><a href="{{.}}">Report</a></p>{{end}}
+<p style="color: gray">Validated at {{.Time.Format "2006-01-02 15:04:05 MST"}}.</p>
+</body></html>
+`
+
+// parseEmailHTML parses an HTML email template, whose isNew function tells the new
+// findings from the others.
+func parseEmailHTML(tmpl string, newFindings []string) (*htmltemplate.Template, error) {
+	isNew := make(map[string]bool)
+	for _, f := range newFindings {
+		isNew[f] = true
+	}
+	return htmltemplate.New("email").Funcs(htmltemplate.FuncMap{"isNew": func(f string) bool { return isNew[f] }}).Parse(tmpl)
+}
+
+func (m Email) check() error {
+	if m.SMTP == "" || m.From == "" || len(m.To) == 0 {
+		return errors.New("email sinks need smtp, from, and to")
+	}
+	if _, _, err := net.SplitHostPort(m.SMTP); err != nil {
+		return fmt.Errorf("smtp %q is not host:port", m.SMTP)
+	}
+	switch m.Format {
+	case "", "text", "html":
+	default:
+		return fmt.Errorf("unknown email format '%s': use text or html", m.Format)
+	}
+	return nil
+}
+
+// send mails the event, rendered with the sink's template when it has one.
+func (m Email) send(e *Event, tmpl string) error {
+	body, err := m.render(e, tmpl)
+	if err != nil {
+		return err
+	}
+	contentType := "text/plain"
+	if m.Format == "html" {
+		contentType = "text/html"
+	}
+	subject := fmt.Sprintf("Validation %s: %s", e.Status, e.Subject)
+	if len(e.NewFindings) > 0 && e.Status != "success" {
+		subject += fmt.Sprintf(" (%d new finding(s))", len(e.NewFindings))
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", m.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: %s; charset=utf-8\r\n", contentType)
+	fmt.Fprintf(&msg, "Content-Transfer-Encoding: 8bit\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, _ := net.SplitHostPort(m.SMTP)
+		auth = smtp.PlainAuth("", m.Username, os.Getenv(m.PasswordEnv), host)
+	}
+	return smtp.SendMail(m.SMTP, auth, m.From, m.To, msg.Bytes())
+}
+
+func (m Email) render(e *Event, tmpl string) (string, error) {
+	var b strings.Builder
+	if m.Format == "html" {
+		if tmpl == "" {
+			tmpl = defaultEmailHTML
+		}
+		t, err := parseEmailHTML(tmpl, e.NewFindings)
+		if err != nil {
+			return "", err
+		}
+		err = t.Execute(&b, e)
+		return b.String(), err
+	}
+	if tmpl == "" {
+		tmpl = defaultEmailTemplate
+	}
+	t, err := template.New("email").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+	err = t.Execute(&b, e)
+	return b.String(), err
+}
@@ -0,0 +1,335 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"config-validator/pkg/store"
+)
+
+// Config is the notification configuration file.
+type Config struct {
+	// ReportURL is a template for the link included in messages, e.g.
+	// "http://validator:8080/api/v1/devices/{{.Subject}}".
+	ReportURL   string `yaml:"report_url"`
+	TopFindings int    `yaml:"top_findings"`
+	// MinSeverity is the least severity of the findings that make a run have new
+	// findings: "warning", "error" (the default, leaving out warnings), or "security".
+	MinSeverity string `yaml:"min_severity"`
+	Sinks       []Sink `yaml:"sinks"`
+}
+
+// severityRank orders the severities of findings for MinSeverity.
+var severityRank = map[string]int{"warning": 1, "error": 2, "security": 3}
+
+// Sink is one notification destination.
+type Sink struct {
+	Type     string `yaml:"type"`     // webhook, slack, teams, or email
+	URL      string `yaml:"url"`      // destination URL
+	URLEnv   string `yaml:"url_env"`  // environment variable holding the URL, for secret webhook URLs
+	Template string `yaml:"template"` // optional text/template overriding the default message
+	// When is which runs are sent: "changes" (the default) for runs that start failing
+	// or have new findings, "failure" for every failed run, or "always".
+	When string `yaml:"when"`
+	// Owners, when set, routes to the sink only the findings of these owners (see
+	// pkg/ownership), and no event without any of them.
+	Owners []string `yaml:"owners"`
+	// Email is the delivery of email sinks.
+	Email Email `yaml:",inline"`
+}
+
+// Event describes a run, and why it is worth notifying about.
+type Event struct {
+	Subject        string    `json:"subject"`
+	Reason         string    `json:"reason"` // "pass-to-fail", "new-findings", "failed", or "passed"
+	PreviousStatus string    `json:"previous_status,omitempty"`
+	Status         string    `json:"status"`
+	Findings       []string  `json:"findings"`
+	NewFindings    []string  `json:"new_findings,omitempty"`
+	TopFindings    []string  `json:"top_findings"`
+	ReportURL      string    `json:"report_url,omitempty"`
+	Time           time.Time `json:"time"`
+	// Owners lists the findings by owner when the run used an owners file.
+	Owners map[string][]string `json:"owners,omitempty"`
+}
+
+const defaultTemplate = `{{if eq .Reason "passed"}}✅ {{.Subject}}: validation passed
+{{else}}❌ {{.Subject}}: {{if eq .Reason "pass-to-fail"}}validation changed from {{or .PreviousStatus "unknown"}} to {{.Status}}{{else if eq .Reason "new-findings"}}{{len .NewFindings}} new finding(s){{else}}validation failed{{end}} ({{len .Findings}} total){{end}}
+{{range .TopFindings}}• {{.}}
+{{end}}{{with .Owners}}Owners:{{range $owner, $findings := .}} {{$owner}} ({{len $findings}}){{end}}
+{{end}}{{with .ReportURL}}Report: {{.}}{{end}}`
+
+// LoadConfig reads a notification configuration from a YAML file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to read notification config %s: %v", path, err)
+	}
+	if cfg.TopFindings == 0 {
+		cfg.TopFindings = 5
+	}
+	if cfg.MinSeverity == "" {
+		cfg.MinSeverity = "error"
+	}
+	if _, ok := severityRank[cfg.MinSeverity]; !ok {
+		return nil, fmt.Errorf("unknown min_severity '%s': use warning, error, or security", cfg.MinSeverity)
+	}
+	for i, s := range cfg.Sinks {
+		switch s.Type {
+		case "webhook", "slack", "teams":
+		case "email":
+			if err := s.Email.check(); err != nil {
+				return nil, fmt.Errorf("notification sink %d: %v", i+1, err)
+			}
+		default:
+			return nil, fmt.Errorf("notification sink %d: unknown type '%s'", i+1, s.Type)
+		}
+		switch s.When {
+		case "", "changes", "failure", "always":
+		default:
+			return nil, fmt.Errorf("notification sink %d: unknown when '%s': use changes, failure, or always", i+1, s.When)
+		}
+		if s.Type == "email" && s.Email.Format == "html" && s.Template != "" {
+			if _, err := parseEmailHTML(s.Template, nil); err != nil {
+				return nil, fmt.Errorf("notification sink %d: invalid template: %v", i+1, err)
+			}
+		} else if s.Template != "" {
+			if _, err := template.New("sink").Parse(s.Template); err != nil {
+				return nil, fmt.Errorf("notification sink %d: invalid template: %v", i+1, err)
+			}
+		}
+	}
+	return &cfg, nil
+}
+
+// Evaluate compares a run with the previous run of the same subject and returns its
+// event, for Send to deliver to the sinks that want it. A run changed for the worse
+// when it goes from passing (or never seen) to failing, or when it has findings of
+// MinSeverity or worse that the previous run did not have. Findings are compared
+// without their line numbers so that edits elsewhere in a config do not make
+// existing findings look new.
+func (c *Config) Evaluate(subject, prevStatus string, prevFindings []store.Finding, status string, findings []store.Finding) *Event {
+	e := &Event{
+		Subject:        subject,
+		PreviousStatus: prevStatus,
+		Status:         status,
+		Findings:       store.Messages(findings),
+		Time:           time.Now(),
+	}
+
+	seen := make(map[string]bool)
+	for _, f := range prevFindings {
+		seen[withoutLine(f.Message)] = true
+	}
+	for _, f := range findings {
+		if !seen[withoutLine(f.Message)] && c.severe(f) {
+			e.NewFindings = append(e.NewFindings, f.Message)
+		}
+	}
+
+	switch {
+	case status == "success":
+		e.Reason = "passed"
+	case prevStatus == "" || prevStatus == "success":
+		e.Reason = "pass-to-fail"
+	case len(e.NewFindings) > 0:
+		e.Reason = "new-findings"
+	default:
+		e.Reason = "failed"
+	}
+
+	e.TopFindings = topFindings(e.NewFindings, e.Findings, c.TopFindings)
+
+	if c.ReportURL != "" {
+		if t, err := template.New("url").Parse(c.ReportURL); err == nil {
+			var b strings.Builder
+			if t.Execute(&b, e) == nil {
+				e.ReportURL = b.String()
+			}
+		}
+	}
+	return e
+}
+
+// severe reports whether a finding is of MinSeverity or worse. Findings recorded
+// without a severity count as errors.
+func (c *Config) severe(f store.Finding) bool {
+	severity := f.Severity
+	if severity == "" {
+		severity = "error"
+	}
+	return severityRank[severity] >= severityRank[c.MinSeverity]
+}
+
+// Send delivers the event to every configured sink that wants it and returns the
+// combined delivery errors.
+func (c *Config) Send(e *Event) error {
+	var errs []error
+	for _, s := range c.Sinks {
+		if !s.wants(e) {
+			continue
+		}
+		e := e.forOwners(s.Owners, c.TopFindings)
+		if e == nil {
+			continue
+		}
+		if err := s.send(e); err != nil {
+			errs = append(errs, fmt.Errorf("%s sink: %v", s.Type, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// forOwners narrows an event to the findings of some owners, listing the top n of
+// them, or returns nil when it has none of theirs, or none new of theirs for a
+// new-findings event. It returns the event itself when owners is empty.
+func (e *Event) forOwners(owners []string, n int) *Event {
+	if len(owners) == 0 {
+		return e
+	}
+	owned := make(map[string]bool)
+	narrowed := *e
+	narrowed.Findings, narrowed.Owners = nil, map[string][]string{}
+	for _, owner := range owners {
+		if findings, ok := e.Owners[owner]; ok {
+			narrowed.Owners[owner] = findings
+			narrowed.Findings = append(narrowed.Findings, findings...)
+			for _, f := range findings {
+				owned[f] = true
+			}
+		}
+	}
+	if len(narrowed.Findings) == 0 {
+		return nil
+	}
+	narrowed.NewFindings = nil
+	for _, f := range e.NewFindings {
+		if owned[f] {
+			narrowed.NewFindings = append(narrowed.NewFindings, f)
+		}
+	}
+	if e.Reason == "new-findings" && len(narrowed.NewFindings) == 0 {
+		return nil // nothing new for these owners
+	}
+	narrowed.TopFindings = topFindings(narrowed.NewFindings, narrowed.Findings, n)
+	return &narrowed
+}
+
+// topFindings picks the n findings a message lists: what is new first, filled up
+// with the remaining findings.
+func topFindings(newFindings, findings []string, n int) []string {
+	var top []string
+	seen := make(map[string]bool)
+	for _, f := range append(append([]string{}, newFindings...), findings...) {
+		if len(top) == n {
+			break
+		}
+		if !seen[f] {
+			seen[f] = true
+			top = append(top, f)
+		}
+	}
+	return top
+}
+
+// wants reports whether the sink is sent the event of a run, by its When.
+func (s Sink) wants(e *Event) bool {
+	switch s.When {
+	case "always":
+		return true
+	case "failure":
+		return e.Reason != "passed"
+	}
+	return e.Reason == "pass-to-fail" || e.Reason == "new-findings"
+}
+
+func (s Sink) send(e *Event) error {
+	if s.Type == "email" {
+		return s.Email.send(e, s.Template)
+	}
+	url := s.URL
+	if s.URLEnv != "" {
+		url = os.Getenv(s.URLEnv)
+	}
+	if url == "" {
+		return fmt.Errorf("no URL configured")
+	}
+
+	text, err := s.render(e)
+	if err != nil {
+		return err
+	}
+
+	var payload any
+	switch s.Type {
+	case "slack":
+		payload = map[string]string{"text": text}
+	case "teams":
+		summary := "Validation failure: "
+		if e.Reason == "passed" {
+			summary = "Validation passed: "
+		}
+		payload = map[string]string{
+			"@type":    "MessageCard",
+			"@context": "https://schema.org/extensions",
+			"summary":  summary + e.Subject,
+			"text":     strings.ReplaceAll(text, "\n", "\n\n"), // Teams cards need blank lines for breaks
+		}
+	default:
+		payload = struct {
+			*Event
+			Message string `json:"message"`
+		}{e, text}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response %s", resp.Status)
+	}
+	return nil
+}
+
+func (s Sink) render(e *Event) (string, error) {
+	text := s.Template
+	if text == "" {
+		text = defaultTemplate
+	}
+	t, err := template.New("message").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, e); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+var linePrefix = regexp.MustCompile(`^Line \d+: `)
+
+func withoutLine(finding string) string {
+	return linePrefix.ReplaceAllString(finding, "")
+}
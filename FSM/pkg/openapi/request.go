@@ -0,0 +1,330 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/httpbody"
+	"config-validator/pkg/mediatype"
+)
+
+// ignoredHeaders are header parameters that OpenAPI says are ignored: they are
+// described by the content types and security schemes instead.
+var ignoredHeaders = map[string]bool{"accept": true, "content-type": true, "authorization": true}
+
+// parameters checks the path, query, header, and cookie parameters. Parameters of
+// the operation override those of its path item with the same name and location.
+func (c *checker) parameters(query url.Values) {
+	type key struct{ name, in string }
+	params := map[key]map[string]any{}
+	var order []key
+	for _, list := range []any{c.op.item["parameters"], c.op.op["parameters"]} {
+		items, _ := list.([]any)
+		for _, item := range items {
+			p := c.spec.resolve(item)
+			name, _ := p["name"].(string)
+			in, _ := p["in"].(string)
+			k := key{name, in}
+			if _, seen := params[k]; !seen {
+				order = append(order, k)
+			}
+			params[k] = p
+		}
+	}
+
+	cookies := map[string]string{}
+	for _, h := range c.msg.Values("Cookie") {
+		for _, pair := range strings.Split(h.Value, ";") {
+			if name, value, ok := strings.Cut(strings.TrimSpace(pair), "="); ok {
+				cookies[name] = value
+			}
+		}
+	}
+
+	for _, k := range order {
+		p := params[k]
+		required := p["required"] == true || k.in == "path"
+		line := 1
+		var values []string
+		switch k.in {
+		case "path":
+			if v, ok := c.op.params[k.name]; ok {
+				values = []string{v}
+			}
+		case "query":
+			values = query[k.name]
+			if len(values) == 0 && style(p) == "deepObject" {
+				// deepObject parameters are sent as name[key]=value.
+				for qk, qv := range query {
+					if strings.HasPrefix(qk, k.name+"[") {
+						values = append(values, qv...)
+					}
+				}
+			}
+		case "header":
+			if ignoredHeaders[strings.ToLower(k.name)] {
+				continue
+			}
+			for _, h := range c.msg.Values(k.name) {
+				values = append(values, h.Value)
+				line = h.Line
+			}
+		case "cookie":
+			if v, ok := cookies[k.name]; ok {
+				values = []string{v}
+			}
+		default:
+			continue
+		}
+		what := fmt.Sprintf("%s parameter %q", k.in, k.name)
+		if len(values) == 0 {
+			if required {
+				c.add(line, automata.SeverityError, fmt.Sprintf("required %s is missing", what))
+			}
+			continue
+		}
+		if p["deprecated"] == true {
+			c.add(line, automata.SeverityWarning, fmt.Sprintf("%s is deprecated", what))
+		}
+		schema := c.spec.resolve(p["schema"])
+		if schema == nil || style(p) == "deepObject" {
+			continue
+		}
+		for _, v := range c.spec.paramValue(schema, p, values) {
+			c.add(line, automata.SeverityError, fmt.Sprintf("%s%s", what, v))
+		}
+	}
+}
+
+// style returns the serialization style of a parameter, or its default.
+func style(p map[string]any) string {
+	if s, ok := p["style"].(string); ok {
+		return s
+	}
+	switch p["in"] {
+	case "query", "cookie":
+		return "form"
+	}
+	return "simple"
+}
+
+// paramValue checks the values of a parameter against its schema, and returns what
+// is wrong as message suffixes.
+func (s *Spec) paramValue(schema, p map[string]any, values []string) []string {
+	var value any
+	if types(schema)["array"] {
+		items := s.resolve(schema["items"])
+		explode := style(p) == "form"
+		if e, ok := p["explode"].(bool); ok {
+			explode = e
+		}
+		// Exploded query arrays repeat the parameter; the others delimit the items.
+		if !explode || p["in"] != "query" {
+			sep := ","
+			switch style(p) {
+			case "spaceDelimited":
+				sep = " "
+			case "pipeDelimited":
+				sep = "|"
+			}
+			values = strings.Split(strings.Join(values, sep), sep)
+		}
+		list := make([]any, len(values))
+		for i, v := range values {
+			list[i] = coerce(items, v)
+		}
+		value = list
+	} else {
+		if len(values) > 1 {
+			return []string{fmt.Sprintf(" is given %d times, but it is not an array", len(values))}
+		}
+		value = coerce(schema, values[0])
+	}
+	var out []string
+	for _, v := range s.validate(schema, value, "") {
+		if v.path != "" {
+			out = append(out, fmt.Sprintf(" %s: %s", v.path, v.msg))
+		} else {
+			out = append(out, ": "+v.msg)
+		}
+	}
+	return out
+}
+
+// coerce turns the text of a parameter into the JSON value its schema asks for, so
+// the schema can check it. Text that is not of the type stays a string, which the
+// type check then reports.
+func coerce(schema map[string]any, s string) any {
+	t := types(schema)
+	switch {
+	case t["integer"] || t["number"]:
+		if _, err := strconv.ParseFloat(s, 64); err == nil {
+			return json.Number(s)
+		}
+	case t["boolean"]:
+		if b, err := strconv.ParseBool(s); err == nil && (s == "true" || s == "false") {
+			return b
+		}
+	case t["null"] && s == "":
+		return nil
+	}
+	return s
+}
+
+// body checks the request body against the operation's requestBody.
+func (c *checker) body() {
+	rb := c.spec.resolve(c.op.op["requestBody"])
+	body := c.msg.Body
+	hasBody := len(bytes.TrimSpace(body)) > 0
+	switch {
+	case rb == nil && hasBody:
+		c.add(c.msg.BodyLine, automata.SeverityWarning, "request has a body, but the operation declares no requestBody")
+		return
+	case rb == nil:
+		return
+	case !hasBody:
+		if rb["required"] == true {
+			c.add(1, automata.SeverityError, "request body is required, but the request has none")
+		}
+		return
+	}
+
+	content := mapOf(rb["content"])
+	declared := make([]string, 0, len(content))
+	for mt := range content {
+		declared = append(declared, mt)
+	}
+	sort.Strings(declared)
+	h, ok := c.msg.Get("Content-Type")
+	if !ok {
+		if len(declared) > 0 {
+			c.add(1, automata.SeverityError, fmt.Sprintf("request has no Content-Type; the operation accepts %s", strings.Join(declared, ", ")))
+		}
+		return
+	}
+	m, _ := mediatype.Parse(h.Value, h.Line) // its syntax is reported by the HTTP checks
+	media := matchMedia(content, m)
+	if media == nil {
+		c.add(h.Line, automata.SeverityError, fmt.Sprintf("Content-Type %s is not accepted; the operation accepts %s", m.Essence(), strings.Join(declared, ", ")))
+		return
+	}
+	schema := c.spec.resolve(media["schema"])
+	if schema == nil {
+		return
+	}
+
+	var value any
+	var lines map[string]int
+	switch {
+	case httpbody.Kind(m) == "json":
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if dec.Decode(&value) != nil {
+			return // the syntax error is reported by the JSON validator
+		}
+		lines = locate(body)
+	case m.Essence() == "application/x-www-form-urlencoded":
+		form, err := url.ParseQuery(strings.TrimSpace(string(body)))
+		if err != nil {
+			c.add(c.msg.BodyLine, automata.SeverityError, fmt.Sprintf("form body is not URL-encoded: %v", err))
+			return
+		}
+		props := mapOf(schema["properties"])
+		obj := map[string]any{}
+		for name, values := range form {
+			ps := c.spec.resolve(props[name])
+			if types(ps)["array"] {
+				list := make([]any, len(values))
+				for i, v := range values {
+					list[i] = coerce(c.spec.resolve(ps["items"]), v)
+				}
+				obj[name] = list
+			} else {
+				obj[name] = coerce(ps, values[0])
+			}
+		}
+		value = obj
+	default:
+		return // other bodies are checked for their syntax only
+	}
+
+	for _, v := range c.spec.validate(schema, value, "$") {
+		line := c.msg.BodyLine
+		if n, ok := lines[v.path]; ok {
+			line += n - 1
+		}
+		c.add(line, automata.SeverityError, fmt.Sprintf("request body %s: %s", v.path, v.msg))
+	}
+}
+
+// matchMedia finds the content entry for a media type: the exact type wins over
+// type/* and */*.
+func matchMedia(content map[string]any, m mediatype.MediaType) map[string]any {
+	var best map[string]any
+	bestRank := -1
+	for key, media := range content {
+		declared, _ := mediatype.Parse(key, 0)
+		rank := -1
+		switch {
+		case declared.Essence() == m.Essence():
+			rank = 2
+		case declared.Type == m.Type && declared.Subtype == "*":
+			rank = 1
+		case declared.Type == "*" && declared.Subtype == "*":
+			rank = 0
+		}
+		if rank > bestRank {
+			best, bestRank = mapOf(media), rank
+			if best == nil {
+				best = map[string]any{}
+			}
+		}
+	}
+	return best
+}
+
+// locate maps the JSON path of every value in a document to its line.
+func locate(body []byte) map[string]int {
+	lines := map[string]int{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	lineAt := func() int {
+		return bytes.Count(body[:dec.InputOffset()], []byte("\n")) + 1
+	}
+	var walk func(path string) bool
+	walk = func(path string) bool {
+		tok, err := dec.Token()
+		if err != nil {
+			return false
+		}
+		lines[path] = lineAt()
+		switch tok {
+		case json.Delim('{'):
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return false
+				}
+				if !walk(childPath(path, key.(string))) {
+					return false
+				}
+			}
+			_, err = dec.Token()
+		case json.Delim('['):
+			for i := 0; dec.More(); i++ {
+				if !walk(fmt.Sprintf("%s[%d]", path, i)) {
+					return false
+				}
+			}
+			_, err = dec.Token()
+		}
+		return err == nil
+	}
+	walk("$")
+	return lines
+}
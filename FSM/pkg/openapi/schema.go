@@ -0,0 +1,431 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// violation is a value that its schema does not allow, at a JSON path.
+type violation struct {
+	path string
+	msg  string
+}
+
+// maxSchemaDepth bounds recursion through self-referencing schemas.
+const maxSchemaDepth = 64
+
+var (
+	patternsMu sync.Mutex
+	patterns   = map[string]*regexp.Regexp{}
+
+	uuidRe     = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hostnameRe = regexp.MustCompile(`^(?i)[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)*$`)
+	identRe    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	base64Re   = regexp.MustCompile(`^[A-Za-z0-9+/]*={0,2}$`)
+)
+
+// validate checks a JSON value (decoded with UseNumber) against a schema, with the
+// keywords of OpenAPI 3.0 and 3.1 schemas that constrain values.
+func (s *Spec) validate(schema map[string]any, v any, path string) []violation {
+	var out []violation
+	s.check(schema, v, path, &out, 0)
+	return out
+}
+
+func (s *Spec) check(schema map[string]any, v any, path string, out *[]violation, depth int) {
+	schema = s.resolve(schema)
+	if schema == nil || depth > maxSchemaDepth {
+		return
+	}
+	add := func(format string, args ...any) {
+		*out = append(*out, violation{path, fmt.Sprintf(format, args...)})
+	}
+
+	for _, sub := range list(schema["allOf"]) {
+		s.check(mapOf(sub), v, path, out, depth+1)
+	}
+	if alts := list(schema["anyOf"]); len(alts) > 0 && s.matching(alts, v, path, depth, 1) == 0 {
+		add("matches none of the anyOf schemas")
+	}
+	if alts := list(schema["oneOf"]); len(alts) > 0 {
+		if sub := s.discriminated(schema, v); sub != nil {
+			s.check(sub, v, path, out, depth+1)
+		} else if n := s.matching(alts, v, path, depth, 2); n != 1 {
+			add("matches %d of the oneOf schemas; exactly one must match", n)
+		}
+	}
+	if not := mapOf(schema["not"]); not != nil && len(s.validate(not, v, path)) == 0 {
+		add("matches the schema it must not match")
+	}
+
+	if v == nil && schema["nullable"] == true {
+		return
+	}
+	kind := kindOf(v)
+	if t := types(schema); len(t) > 0 && !t[kind] && !(kind == "integer" && t["number"]) {
+		want := make([]string, 0, len(t))
+		for name := range t {
+			want = append(want, name)
+		}
+		sort.Strings(want)
+		add("must be %s, not %s", strings.Join(want, " or "), kind)
+		return
+	}
+	if enum := list(schema["enum"]); len(enum) > 0 {
+		found := false
+		for _, e := range enum {
+			found = found || equal(e, v)
+		}
+		if !found {
+			add("%s is not one of the allowed values %s", show(v), show(enum))
+		}
+	}
+	if c, ok := schema["const"]; ok && !equal(c, v) {
+		add("must be %s", show(c))
+	}
+
+	switch v := v.(type) {
+	case string:
+		s.checkString(schema, v, add)
+	case json.Number:
+		f, _ := v.Float64()
+		checkNumber(schema, f, kind, add)
+	case []any:
+		if n, ok := number(schema["minItems"]); ok && float64(len(v)) < n {
+			add("has %d items; at least %v are required", len(v), n)
+		}
+		if n, ok := number(schema["maxItems"]); ok && float64(len(v)) > n {
+			add("has %d items; at most %v are allowed", len(v), n)
+		}
+		if schema["uniqueItems"] == true {
+		outer:
+			for i := range v {
+				for j := 0; j < i; j++ {
+					if equal(v[i], v[j]) {
+						add("items %d and %d are equal, but items must be unique", j, i)
+						break outer
+					}
+				}
+			}
+		}
+		if items := mapOf(schema["items"]); items != nil {
+			for i, item := range v {
+				s.check(items, item, fmt.Sprintf("%s[%d]", path, i), out, depth+1)
+			}
+		}
+	case map[string]any:
+		s.checkObject(schema, v, path, out, depth)
+	}
+}
+
+// matching counts the alternatives a value matches, stopping at limit.
+func (s *Spec) matching(alts []any, v any, path string, depth, limit int) int {
+	n := 0
+	for _, alt := range alts {
+		var errs []violation
+		s.check(mapOf(alt), v, path, &errs, depth+1)
+		if len(errs) == 0 {
+			if n++; n == limit {
+				break
+			}
+		}
+	}
+	return n
+}
+
+// discriminated returns the oneOf alternative an object's discriminator property
+// selects, so its errors can be reported rather than just "matches none".
+func (s *Spec) discriminated(schema map[string]any, v any) map[string]any {
+	d := mapOf(schema["discriminator"])
+	obj, isObject := v.(map[string]any)
+	name, _ := d["propertyName"].(string)
+	if d == nil || !isObject || name == "" {
+		return nil
+	}
+	value, _ := obj[name].(string)
+	if value == "" {
+		return nil
+	}
+	ref := "#/components/schemas/" + value
+	if mapped, ok := mapOf(d["mapping"])[value].(string); ok {
+		ref = mapped
+		if !strings.HasPrefix(ref, "#") {
+			ref = "#/components/schemas/" + ref
+		}
+	}
+	return s.resolve(map[string]any{"$ref": ref})
+}
+
+func (s *Spec) checkString(schema map[string]any, v string, add func(string, ...any)) {
+	n := float64(utf8.RuneCountInString(v))
+	if min, ok := number(schema["minLength"]); ok && n < min {
+		add("has %v characters; at least %v are required", n, min)
+	}
+	if max, ok := number(schema["maxLength"]); ok && n > max {
+		add("has %v characters; at most %v are allowed", n, max)
+	}
+	if p, ok := schema["pattern"].(string); ok {
+		if re := pattern(p); re != nil && !re.MatchString(v) {
+			add("%q does not match the pattern %s", v, p)
+		}
+	}
+	if format, ok := schema["format"].(string); ok && !validFormat(format, v) {
+		add("%q is not a valid %s", v, format)
+	}
+}
+
+func checkNumber(schema map[string]any, f float64, kind string, add func(string, ...any)) {
+	// OpenAPI 3.0 has boolean exclusiveMinimum and exclusiveMaximum modifying minimum
+	// and maximum; 3.1 has numeric ones of their own.
+	if min, ok := number(schema["minimum"]); ok {
+		if schema["exclusiveMinimum"] == true && f <= min {
+			add("%v must be greater than %v", f, min)
+		} else if f < min {
+			add("%v is less than the minimum %v", f, min)
+		}
+	}
+	if max, ok := number(schema["maximum"]); ok {
+		if schema["exclusiveMaximum"] == true && f >= max {
+			add("%v must be less than %v", f, max)
+		} else if f > max {
+			add("%v is greater than the maximum %v", f, max)
+		}
+	}
+	if min, ok := number(schema["exclusiveMinimum"]); ok && f <= min {
+		add("%v must be greater than %v", f, min)
+	}
+	if max, ok := number(schema["exclusiveMaximum"]); ok && f >= max {
+		add("%v must be less than %v", f, max)
+	}
+	if m, ok := number(schema["multipleOf"]); ok && m > 0 {
+		if q := f / m; math.Abs(q-math.Round(q)) > 1e-9 {
+			add("%v is not a multiple of %v", f, m)
+		}
+	}
+	if kind == "integer" {
+		switch schema["format"] {
+		case "int32":
+			if f < math.MinInt32 || f > math.MaxInt32 {
+				add("%v does not fit in an int32", f)
+			}
+		case "int64":
+			if f < math.MinInt64 || f > math.MaxInt64 {
+				add("%v does not fit in an int64", f)
+			}
+		}
+	}
+}
+
+func (s *Spec) checkObject(schema, v map[string]any, path string, out *[]violation, depth int) {
+	add := func(format string, args ...any) {
+		*out = append(*out, violation{path, fmt.Sprintf(format, args...)})
+	}
+	props := mapOf(schema["properties"])
+	for _, name := range list(schema["required"]) {
+		if n, ok := name.(string); ok {
+			if _, present := v[n]; !present {
+				add("required property %q is missing", n)
+			}
+		}
+	}
+	if n, ok := number(schema["minProperties"]); ok && float64(len(v)) < n {
+		add("has %d properties; at least %v are required", len(v), n)
+	}
+	if n, ok := number(schema["maxProperties"]); ok && float64(len(v)) > n {
+		add("has %d properties; at most %v are allowed", len(v), n)
+	}
+
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		child := childPath(path, name)
+		if ps, ok := props[name]; ok {
+			if p := s.resolve(ps); p["readOnly"] == true {
+				*out = append(*out, violation{child, "is read-only and must not be sent in requests"})
+			}
+			s.check(mapOf(ps), v[name], child, out, depth+1)
+			continue
+		}
+		switch extra := schema["additionalProperties"].(type) {
+		case bool:
+			if !extra {
+				add("property %q is not allowed", name)
+			}
+		case map[string]any:
+			s.check(extra, v[name], child, out, depth+1)
+		}
+	}
+}
+
+// types returns the types a schema allows: OpenAPI 3.1 allows a list of them.
+func types(schema map[string]any) map[string]bool {
+	t := map[string]bool{}
+	switch v := schema["type"].(type) {
+	case string:
+		t[v] = true
+	case []any:
+		for _, name := range v {
+			if s, ok := name.(string); ok {
+				t[s] = true
+			}
+		}
+	}
+	return t
+}
+
+// kindOf returns the JSON Schema type of a value.
+func kindOf(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if f, err := v.Float64(); err == nil && f == math.Trunc(f) && !math.IsInf(f, 0) {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// number reads a number from the document, which YAML decodes as int or float64.
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// equal compares a value from the document with a value from a body: numbers are
+// compared by value.
+func equal(a, b any) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+	switch a := a.(type) {
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k := range a {
+			if !equal(a[k], b[k]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func list(v any) []any {
+	l, _ := v.([]any)
+	return l
+}
+
+func show(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// childPath returns the JSON path of an object member.
+func childPath(path, name string) string {
+	if identRe.MatchString(name) {
+		return path + "." + name
+	}
+	return path + "[" + strconv.Quote(name) + "]"
+}
+
+// pattern compiles a schema pattern once. Patterns Go cannot compile (ECMA-262
+// lookarounds) are not checked.
+func pattern(p string) *regexp.Regexp {
+	patternsMu.Lock()
+	defer patternsMu.Unlock()
+	re, ok := patterns[p]
+	if !ok {
+		re, _ = regexp.Compile(p)
+		patterns[p] = re
+	}
+	return re
+}
+
+// validFormat checks the string formats of JSON Schema and OpenAPI. Unknown formats
+// are annotations and always pass.
+func validFormat(format, v string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339Nano, v)
+		return err == nil
+	case "date":
+		_, err := time.Parse(time.DateOnly, v)
+		return err == nil
+	case "time":
+		_, err := time.Parse("15:04:05Z07:00", v)
+		return err == nil
+	case "email":
+		a, err := mail.ParseAddress(v)
+		return err == nil && a.Address == v
+	case "uuid":
+		return uuidRe.MatchString(v)
+	case "ipv4":
+		ip := net.ParseIP(v)
+		return ip != nil && ip.To4() != nil && !strings.Contains(v, ":")
+	case "ipv6":
+		return net.ParseIP(v) != nil && strings.Contains(v, ":")
+	case "hostname":
+		return len(v) <= 253 && hostnameRe.MatchString(v)
+	case "uri":
+		u, err := url.Parse(v)
+		return err == nil && u.Scheme != ""
+	case "byte":
+		return base64Re.MatchString(v) && len(v)%4 == 0
+	}
+	return true
+}
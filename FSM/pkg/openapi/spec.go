@@ -0,0 +1,212 @@
+// Package openapi checks HTTP requests against an OpenAPI 3 contract: the request
+// must match a declared operation by path template and method, carry the operation's
+// required parameters with values its schemas allow, and send a body of a declared
+// content type that satisfies the referenced schema.
+package openapi
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/httpmsg"
+)
+
+// State is the state reported in contract findings.
+const State = "OPENAPI"
+
+// methods are the operations a path item may declare.
+var methods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// Spec is a loaded OpenAPI 3 document.
+type Spec struct {
+	root  map[string]any
+	bases []string // base paths of the servers, longest first
+}
+
+// Load reads an OpenAPI 3.0 or 3.1 document in YAML or JSON.
+func Load(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OpenAPI document: %v", err)
+	}
+	return Parse(data)
+}
+
+// Parse parses an OpenAPI 3.0 or 3.1 document in YAML or JSON.
+func Parse(data []byte) (*Spec, error) {
+	var root map[string]any
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI document: %v", err)
+	}
+	version, _ := root["openapi"].(string)
+	if !strings.HasPrefix(version, "3.") {
+		if _, ok := root["swagger"]; ok {
+			return nil, fmt.Errorf("swagger 2.0 documents are not supported; convert the document to OpenAPI 3")
+		}
+		return nil, fmt.Errorf("not an OpenAPI 3 document: it has no openapi: 3.x field")
+	}
+	if _, ok := root["paths"].(map[string]any); !ok {
+		return nil, fmt.Errorf("OpenAPI document has no paths")
+	}
+	s := &Spec{root: root}
+	servers, _ := root["servers"].([]any)
+	for _, server := range servers {
+		raw, _ := mapOf(server)["url"].(string)
+		if u, err := url.Parse(raw); err == nil && !strings.Contains(raw, "{") {
+			if base := strings.TrimSuffix(u.Path, "/"); base != "" {
+				s.bases = append(s.bases, base)
+			}
+		}
+	}
+	sort.Slice(s.bases, func(i, j int) bool { return len(s.bases[i]) > len(s.bases[j]) })
+	return s, nil
+}
+
+func mapOf(v any) map[string]any {
+	m, _ := v.(map[string]any)
+	return m
+}
+
+// resolve follows local $refs (#/components/...). A reference that cannot be
+// followed resolves to nil.
+func (s *Spec) resolve(v any) map[string]any {
+	m := mapOf(v)
+	for depth := 0; m != nil && depth < 32; depth++ {
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			return m
+		}
+		if !strings.HasPrefix(ref, "#/") {
+			return nil // external references are not followed
+		}
+		var cur any = s.root
+		for _, token := range strings.Split(ref[2:], "/") {
+			token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+			cur = mapOf(cur)[token]
+		}
+		m = mapOf(cur)
+	}
+	return m
+}
+
+// operation is a matched operation and the values of its path parameters.
+type operation struct {
+	template string
+	method   string
+	item     map[string]any
+	op       map[string]any
+	params   map[string]string
+}
+
+// match finds the path item for a request path: concrete paths win over templated
+// ones, and fewer template segments win over more.
+func (s *Spec) match(path string) (string, map[string]any, map[string]string) {
+	for _, base := range s.bases {
+		if path == base || strings.HasPrefix(path, base+"/") {
+			path = strings.TrimPrefix(path, base)
+			break
+		}
+	}
+	if path == "" {
+		path = "/"
+	}
+	segments := strings.Split(path, "/")
+	best, bestScore := "", -1
+	var bestParams map[string]string
+	for template := range mapOf(s.root["paths"]) {
+		parts := strings.Split(template, "/")
+		if len(parts) != len(segments) {
+			continue
+		}
+		params := map[string]string{}
+		score := 0
+		for i, part := range parts {
+			// A segment may mix literal text and a parameter, as in {id}.json.
+			if open, close := strings.IndexByte(part, '{'), strings.IndexByte(part, '}'); open >= 0 && close > open {
+				prefix, suffix, seg := part[:open], part[close+1:], segments[i]
+				if !strings.HasPrefix(seg, prefix) || !strings.HasSuffix(seg, suffix) || len(seg) <= len(prefix)+len(suffix) {
+					score = -1
+					break
+				}
+				value, _ := url.PathUnescape(seg[len(prefix) : len(seg)-len(suffix)])
+				params[part[open+1:close]] = value
+				continue
+			}
+			if part != segments[i] {
+				score = -1
+				break
+			}
+			score++
+		}
+		if score > bestScore || (score == bestScore && template < best) {
+			best, bestScore, bestParams = template, score, params
+		}
+	}
+	if bestScore < 0 {
+		return "", nil, nil
+	}
+	return best, mapOf(mapOf(s.root["paths"])[best]), bestParams
+}
+
+// Check checks a request against the contract. Responses are not checked, as the
+// operation they answer is not known from the response alone. Findings are on lines
+// of the message.
+func (s *Spec) Check(msg *httpmsg.Message) []automata.Finding {
+	if !msg.Request || msg.Method == "" {
+		return nil
+	}
+	c := &checker{spec: s, msg: msg}
+	u, err := url.Parse(msg.Target)
+	if err != nil {
+		c.add(1, automata.SeverityError, fmt.Sprintf("request target %q is not a valid URL: %v", msg.Target, err))
+		return c.findings
+	}
+	template, item, params := s.match(u.Path)
+	if item == nil {
+		c.add(1, automata.SeverityError, fmt.Sprintf("no path of the API matches %s", u.Path))
+		return c.findings
+	}
+	method := strings.ToLower(msg.Method)
+	op := mapOf(item[method])
+	if op == nil {
+		var allowed []string
+		for _, m := range methods {
+			if item[m] != nil {
+				allowed = append(allowed, strings.ToUpper(m))
+			}
+		}
+		c.add(1, automata.SeverityError, fmt.Sprintf("%s is not an operation of %s; it declares %s", msg.Method, template, strings.Join(allowed, ", ")))
+		return c.findings
+	}
+	c.op = &operation{template: template, method: msg.Method, item: item, op: op, params: params}
+	if op["deprecated"] == true {
+		c.add(1, automata.SeverityWarning, fmt.Sprintf("%s %s is deprecated", msg.Method, template))
+	}
+	c.parameters(u.Query())
+	c.body()
+	return c.findings
+}
+
+type checker struct {
+	spec     *Spec
+	msg      *httpmsg.Message
+	op       *operation
+	findings []automata.Finding
+}
+
+func (c *checker) add(line int, severity, msg string) {
+	command := ""
+	if c.op != nil {
+		command = c.op.method + " " + c.op.template
+		if id, ok := c.op.op["operationId"].(string); ok {
+			command += " (" + id + ")"
+		}
+	}
+	c.findings = append(c.findings, automata.Finding{Line: line, Command: command, State: State, Message: msg, Severity: severity})
+}
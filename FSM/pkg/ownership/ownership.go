@@ -0,0 +1,143 @@
+// Package ownership maps findings to the team or person that owns them, so reports
+// and notifications of a fleet can be routed to whoever has to act on them. An
+// owners file names owners by the files or devices they are responsible for, and
+// optionally by rule:
+//
+//	default: netops
+//	owners:
+//	  - match: ["core-*", "configs/core/**"]
+//	    owner: core-network
+//	  - match: ["**"]
+//	    rules: ["SECURITY", "hardening.*"]
+//	    owner: secops
+//
+// The first entry matching both the subject and the finding wins.
+package ownership
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"config-validator/pkg/automata"
+)
+
+// Entry assigns the findings of the matching subjects to an owner.
+type Entry struct {
+	// Match are globs of the file paths or device names the owner is responsible for.
+	// Globs without a slash match the last path segment, so "core-*" matches device
+	// core-1 and file configs/core-1.cfg; others are anchored, with ** standing for
+	// any number of segments.
+	Match []string `yaml:"match"`
+	// Rules, when set, narrows the entry to findings of these rules, named by state or
+	// catalog code as for -only-rules.
+	Rules []string `yaml:"rules"`
+	Owner string   `yaml:"owner"`
+}
+
+// Map is an owners file.
+type Map struct {
+	Default string  `yaml:"default"` // owner of findings no entry matches, none when empty
+	Owners  []Entry `yaml:"owners"`
+}
+
+// Load reads an owners file.
+func Load(file string) (*Map, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var m Map
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to read owners file %s: %v", file, err)
+	}
+	for i, e := range m.Owners {
+		if e.Owner == "" {
+			return nil, fmt.Errorf("owners entry %d: no owner", i+1)
+		}
+		if len(e.Match) == 0 {
+			return nil, fmt.Errorf("owners entry %d: no match patterns", i+1)
+		}
+		for _, glob := range append(append([]string{}, e.Match...), e.Rules...) {
+			if _, err := path.Match(glob, ""); err != nil {
+				return nil, fmt.Errorf("owners entry %d: pattern %q: %v", i+1, glob, err)
+			}
+		}
+	}
+	return &m, nil
+}
+
+// Owner returns the owner of a finding of a file or device, or "" when there is none.
+func (m *Map) Owner(subject string, f automata.Finding) string {
+	segments := strings.Split(strings.TrimPrefix(filepath.ToSlash(subject), "./"), "/")
+	for _, e := range m.Owners {
+		if matchesAny(e.Match, segments) && (len(e.Rules) == 0 || matchesRule(e.Rules, f)) {
+			return e.Owner
+		}
+	}
+	return m.Default
+}
+
+// Annotate sets the owner of the findings of a file or device, in place. Findings
+// that already have an owner keep it. A nil map does nothing.
+func (m *Map) Annotate(subject string, findings []automata.Finding) {
+	if m == nil {
+		return
+	}
+	for i := range findings {
+		if findings[i].Owner == "" {
+			findings[i].Owner = m.Owner(subject, findings[i])
+		}
+	}
+}
+
+func matchesAny(globs, segments []string) bool {
+	for _, glob := range globs {
+		glob = strings.TrimPrefix(glob, "/")
+		if !strings.Contains(glob, "/") {
+			if ok, _ := path.Match(glob, segments[len(segments)-1]); ok {
+				return true
+			}
+		} else if matchParts(strings.Split(glob, "/"), segments) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchParts(parts, segments []string) bool {
+	if len(parts) == 0 {
+		return len(segments) == 0
+	}
+	if parts[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchParts(parts[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(parts[0], segments[0]); !ok {
+		return false
+	}
+	return matchParts(parts[1:], segments[1:])
+}
+
+// matchesRule reports whether a glob matches the finding's state or code.
+func matchesRule(globs []string, f automata.Finding) bool {
+	for _, glob := range globs {
+		for _, name := range []string{f.State, f.Code} {
+			if ok, _ := path.Match(glob, name); ok && name != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/hook"
+)
+
+// Executable plugins speak a simple JSON protocol:
+//
+//	<plugin> describe
+//	    -> {"name": "acme-proto", "patterns": ["*.acme"], "content_regex": "^ACME/1"}
+//	<plugin> validate   (request on stdin)
+//	    <- {"path": "configs/x.acme", "content": "..."}
+//	    -> {"findings": [{"line": 3, "state": "HEADER", "message": "bad field"}]}
+//
+// Detect is answered in-process from the describe output: the file name must match one
+// of the patterns (globs without a slash match the base name) and, if given, the
+// content must match content_regex. A non-zero exit from validate is an error.
+
+const execTimeout = 30 * time.Second
+
+type execDescription struct {
+	Name         string   `json:"name"`
+	Patterns     []string `json:"patterns"`
+	ContentRegex string   `json:"content_regex"`
+}
+
+type execRequest struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+type execResponse struct {
+	Findings []automata.Finding `json:"findings"`
+}
+
+type execPlugin struct {
+	path    string
+	desc    execDescription
+	content *regexp.Regexp
+}
+
+func openExecPlugin(exe string) (Validator, error) {
+	out, err := runPlugin(exe, nil, "describe")
+	if err != nil {
+		return nil, err
+	}
+	p := &execPlugin{path: exe}
+	if err := json.Unmarshal(out, &p.desc); err != nil {
+		return nil, fmt.Errorf("invalid describe output: %v", err)
+	}
+	if p.desc.Name == "" {
+		return nil, fmt.Errorf("describe output has no name")
+	}
+	if p.desc.ContentRegex != "" {
+		if p.content, err = regexp.Compile(p.desc.ContentRegex); err != nil {
+			return nil, fmt.Errorf("invalid content_regex: %v", err)
+		}
+	}
+	return p, nil
+}
+
+func (p *execPlugin) Name() string { return p.desc.Name }
+
+func (p *execPlugin) Detect(file string, content []byte) bool {
+	if !hook.Match(file, p.desc.Patterns) {
+		return false
+	}
+	return p.content == nil || p.content.Match(content)
+}
+
+func (p *execPlugin) Validate(file string, content []byte) ([]automata.Finding, error) {
+	req, err := json.Marshal(execRequest{Path: file, Content: string(content)})
+	if err != nil {
+		return nil, err
+	}
+	out, err := runPlugin(p.path, req, "validate")
+	if err != nil {
+		return nil, err
+	}
+	var resp execResponse
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return nil, fmt.Errorf("plugin %s returned invalid output: %v", p.desc.Name, err)
+	}
+	return resp.Findings, nil
+}
+
+func runPlugin(exe string, stdin []byte, arg string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), execTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, exe, arg)
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("%s %s timed out after %s", exe, arg, execTimeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %v: %s", exe, arg, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
@@ -0,0 +1,30 @@
+package plugin
+
+import (
+	"fmt"
+	goplugin "plugin"
+)
+
+// openGoPlugin loads a Go plugin built with `go build -buildmode=plugin` against this
+// module. The plugin must export `var Validator plugin.Validator = ...`.
+func openGoPlugin(path string) (Validator, error) {
+	p, err := goplugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup("Validator")
+	if err != nil {
+		return nil, err
+	}
+	switch v := sym.(type) {
+	case *Validator:
+		if *v == nil {
+			return nil, fmt.Errorf("exported Validator is nil")
+		}
+		return *v, nil
+	case Validator:
+		return v, nil
+	default:
+		return nil, fmt.Errorf("exported Validator has type %T, want plugin.Validator", sym)
+	}
+}
@@ -0,0 +1,121 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"config-validator/pkg/automata"
+)
+
+// Validator is implemented by third-party protocol checks. Detect decides whether the
+// validator handles a file (by name and/or content), and Validate returns its findings.
+//
+// Go plugins export it as a package-level variable named "Validator". Executable
+// plugins implement it over the JSON protocol described in exec.go.
+type Validator interface {
+	Name() string
+	Detect(path string, content []byte) bool
+	Validate(path string, content []byte) ([]automata.Finding, error)
+}
+
+// Info describes an installed plugin for `plugins list`.
+type Info struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"` // "go" or "exec"
+	Path string `json:"path"`
+}
+
+type loaded struct {
+	Validator
+	info Info
+}
+
+// Registry holds the plugins loaded from a plugin directory.
+type Registry struct {
+	plugins []loaded
+}
+
+// DefaultDir returns $CONFIG_VALIDATOR_PLUGINS, or ~/.config-validator/plugins.
+func DefaultDir() string {
+	if dir := os.Getenv("CONFIG_VALIDATOR_PLUGINS"); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config-validator", "plugins")
+}
+
+// Load loads every plugin in dir: *.so files as Go plugins and other executable files
+// as exec plugins. A missing directory yields an empty registry. Plugins that fail to
+// load are skipped and reported in the returned errors.
+func Load(dir string) (*Registry, []error) {
+	r := &Registry{}
+	if dir == "" {
+		return r, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return r, []error{err}
+	}
+
+	var errs []error
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+
+		var v Validator
+		var kind string
+		if strings.HasSuffix(e.Name(), ".so") {
+			v, err = openGoPlugin(path)
+			kind = "go"
+		} else {
+			info, statErr := e.Info()
+			if statErr != nil || info.Mode()&0o111 == 0 {
+				continue // not executable, e.g. a README next to the plugins
+			}
+			v, err = openExecPlugin(path)
+			kind = "exec"
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("plugin %s: %v", e.Name(), err))
+			continue
+		}
+		r.plugins = append(r.plugins, loaded{Validator: v, info: Info{Name: v.Name(), Kind: kind, Path: path}})
+	}
+	sort.Slice(r.plugins, func(i, j int) bool { return r.plugins[i].info.Name < r.plugins[j].info.Name })
+	return r, errs
+}
+
+// Detect returns the first plugin that claims the file, or nil.
+func (r *Registry) Detect(path string, content []byte) Validator {
+	for _, p := range r.plugins {
+		if p.Detect(path, content) {
+			return p.Validator
+		}
+	}
+	return nil
+}
+
+// Empty reports whether no plugins are installed.
+func (r *Registry) Empty() bool {
+	return len(r.plugins) == 0
+}
+
+// List describes the installed plugins, ordered by name.
+func (r *Registry) List() []Info {
+	out := make([]Info, len(r.plugins))
+	for i, p := range r.plugins {
+		out[i] = p.info
+	}
+	return out
+}
@@ -0,0 +1,251 @@
+package policy
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/linereader"
+	"config-validator/pkg/security"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Pack is a policy pack: optional rules plus the controls of one or more compliance
+// frameworks, each backed by checks against the config and its findings.
+type Pack struct {
+	Name        string    `yaml:"name"`
+	Version     string    `yaml:"version"`
+	Description string    `yaml:"description"`
+	Rules       string    `yaml:"rules"` // rules file used with the pack, relative to the pack
+	Controls    []Control `yaml:"controls"`
+}
+
+// Control is one framework control, e.g. PCI-DSS 2.2.7 or NIST 800-53 AC-17(2).
+type Control struct {
+	Framework string  `yaml:"framework"`
+	ID        string  `yaml:"id"`
+	Title     string  `yaml:"title"`
+	Checks    []Check `yaml:"checks"`
+}
+
+// Check is one piece of evidence for a control. Require needs a matching line (in every
+// Block, if set), Forbid must match no line, and Findings fails the check when the
+// validation produced findings in any of the listed states (e.g. SECURITY, ACL).
+// Fix, if set, is the config that makes a failed check pass (see pkg/remediation).
+type Check struct {
+	ID          string   `yaml:"id"`
+	Description string   `yaml:"description"`
+	Block       string   `yaml:"block"`
+	Require     string   `yaml:"require"`
+	Forbid      string   `yaml:"forbid"`
+	Findings    []string `yaml:"findings"`
+	Fix         string   `yaml:"fix"`
+
+	block, require, forbid *regexp.Regexp
+}
+
+// Matrix is the per-control compliance result of a run.
+type Matrix struct {
+	Pack     string          `json:"pack"`
+	Version  string          `json:"version,omitempty"`
+	Passed   int             `json:"passed"`
+	Failed   int             `json:"failed"`
+	Controls []ControlResult `json:"controls"`
+}
+
+// ControlResult records whether a control is met, and the evidence for each check.
+type ControlResult struct {
+	Framework string        `json:"framework"`
+	ID        string        `json:"id"`
+	Title     string        `json:"title,omitempty"`
+	Status    string        `json:"status"` // "pass" or "fail"
+	Checks    []CheckResult `json:"checks"`
+}
+
+// CheckResult is the outcome of one check with the lines or findings it is based on.
+type CheckResult struct {
+	ID          string   `json:"id"`
+	Description string   `json:"description,omitempty"`
+	Status      string   `json:"status"`
+	Evidence    []string `json:"evidence,omitempty"`
+}
+
+// Load reads a policy pack and compiles its checks. A relative rules path is resolved
+// against the pack's directory.
+func Load(path string) (*Pack, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy pack: %v", err)
+	}
+	var p Pack
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse policy pack %s: %v", path, err)
+	}
+	if p.Name == "" {
+		p.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if p.Rules != "" && !filepath.IsAbs(p.Rules) {
+		p.Rules = filepath.Join(filepath.Dir(path), p.Rules)
+	}
+	for i := range p.Controls {
+		c := &p.Controls[i]
+		if c.Framework == "" || c.ID == "" {
+			return nil, fmt.Errorf("policy pack %s: control %d needs a framework and an id", path, i+1)
+		}
+		for j := range c.Checks {
+			if err := c.Checks[j].compile(); err != nil {
+				return nil, fmt.Errorf("policy pack %s: %s %s: %v", path, c.Framework, c.ID, err)
+			}
+		}
+	}
+	return &p, nil
+}
+
+func (c *Check) compile() error {
+	if c.Require == "" && c.Forbid == "" && len(c.Findings) == 0 {
+		return fmt.Errorf("check %s has nothing to check (require, forbid, or findings)", c.ID)
+	}
+	for _, field := range []struct {
+		src string
+		re  **regexp.Regexp
+	}{{c.Block, &c.block}, {c.Require, &c.require}, {c.Forbid, &c.forbid}} {
+		if field.src == "" {
+			continue
+		}
+		re, err := regexp.Compile(field.src)
+		if err != nil {
+			return fmt.Errorf("check %s: %v", c.ID, err)
+		}
+		*field.re = re
+	}
+	return nil
+}
+
+type line struct {
+	num   int
+	text  string // trimmed
+	shown string // text with secrets redacted, for evidence
+	block int    // line number of the enclosing top-level line, or its own number
+}
+
+// Evaluate runs the pack against a config and the findings validation produced for
+// it. It returns the compliance matrix and one finding per failed check. Evidence
+// lines carrying secrets are redacted.
+func (p *Pack) Evaluate(r io.Reader, findings []automata.Finding) (*Matrix, []automata.Finding, error) {
+	var lines []line
+	var audit security.Auditor
+	scanner := linereader.NewScanner(r)
+	block := 0
+	for num := 1; scanner.Scan(); num++ {
+		text := scanner.Text()
+		audit.Line(text, num)
+		if !strings.HasPrefix(text, " ") {
+			block = num
+		}
+		lines = append(lines, line{num: num, text: strings.TrimSpace(text), block: block})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error reading config file: %v", err)
+	}
+	for i, l := range lines {
+		lines[i].shown = l.text
+		if excerpt, ok := audit.Redacted[l.num]; ok {
+			lines[i].shown = excerpt
+		}
+	}
+
+	m := &Matrix{Pack: p.Name, Version: p.Version}
+	var failures []automata.Finding
+	for _, c := range p.Controls {
+		result := ControlResult{Framework: c.Framework, ID: c.ID, Title: c.Title, Status: "pass"}
+		for _, check := range c.Checks {
+			cr, lineNum := check.evaluate(lines, findings)
+			if cr.Status == "fail" {
+				result.Status = "fail"
+				failures = append(failures, automata.Finding{
+					Line:     lineNum,
+					State:    "POLICY",
+					Message:  fmt.Sprintf("%s %s (%s): %s", c.Framework, c.ID, check.ID, check.Description),
+					Severity: automata.SeverityError,
+					Fix:      strings.TrimSpace(check.Fix),
+				})
+			}
+			result.Checks = append(result.Checks, cr)
+		}
+		if result.Status == "pass" {
+			m.Passed++
+		} else {
+			m.Failed++
+		}
+		m.Controls = append(m.Controls, result)
+	}
+	return m, failures, nil
+}
+
+// evaluate runs one check, returning its result and the line a failure points at.
+func (c *Check) evaluate(lines []line, findings []automata.Finding) (CheckResult, int) {
+	var matched, failed []string
+	failLine := 0
+	fail := func(lineNum int, evidence string) {
+		if len(failed) == 0 {
+			failLine = lineNum
+		}
+		failed = append(failed, evidence)
+	}
+
+	// With a Block, only the lines inside matching top-level blocks are looked at, and
+	// Require must match in each of them.
+	satisfied := map[int]bool{}
+	var blocks []line
+	if c.block != nil {
+		for _, l := range lines {
+			if l.num == l.block && c.block.MatchString(l.text) {
+				satisfied[l.num] = false
+				blocks = append(blocks, l)
+			}
+		}
+	}
+	for _, l := range lines {
+		if c.block != nil {
+			if _, ok := satisfied[l.block]; !ok || l.num == l.block {
+				continue
+			}
+		}
+		if c.forbid != nil && c.forbid.MatchString(l.text) {
+			fail(l.num, fmt.Sprintf("Line %d: %s", l.num, l.shown))
+		}
+		if c.require != nil && c.require.MatchString(l.text) {
+			satisfied[l.block] = true
+			matched = append(matched, fmt.Sprintf("Line %d: %s", l.num, l.shown))
+		}
+	}
+	if c.require != nil {
+		if c.block == nil && len(matched) == 0 {
+			fail(0, fmt.Sprintf("no line matches %q", c.Require))
+		}
+		for _, b := range blocks {
+			if !satisfied[b.num] {
+				fail(b.num, fmt.Sprintf("Line %d: %s has no line matching %q", b.num, b.shown, c.Require))
+			}
+		}
+	}
+
+	for _, f := range findings {
+		for _, state := range c.Findings {
+			if f.State == state {
+				fail(f.Line, automata.FormatFinding(f))
+			}
+		}
+	}
+
+	// A failed check only shows what is wrong, so auditors see what to fix.
+	if len(failed) > 0 {
+		return CheckResult{ID: c.ID, Description: c.Description, Status: "fail", Evidence: failed}, failLine
+	}
+	return CheckResult{ID: c.ID, Description: c.Description, Status: "pass", Evidence: matched}, 0
+}
@@ -0,0 +1,128 @@
+// Package progress reports how far a batch run is, on stderr, so that validating
+// hundreds of files or devices is not a silent wait. On a terminal it redraws one
+// status line with a bar; elsewhere, such as in CI logs, it prints a line every
+// Interval.
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redrawInterval limits how often the terminal status line is redrawn, for runs that
+// finish thousands of small items a second.
+const redrawInterval = 100 * time.Millisecond
+
+// Reporter counts finished items. A nil *Reporter reports nothing, so callers need
+// not check whether progress was asked for.
+type Reporter struct {
+	// Interval between progress lines when the output is not a terminal.
+	Interval time.Duration
+
+	mu       sync.Mutex
+	w        io.Writer
+	tty      bool
+	what     string // what is counted, e.g. "devices"
+	total    int    // 0 when unknown, as while walking an archive
+	done     int
+	findings int
+	started  time.Time
+	last     time.Time // of the last line printed
+	width    int       // of the status line drawn on the terminal
+}
+
+// New returns a reporter writing to w, for total items (0 if unknown).
+func New(w io.Writer, what string, total int) *Reporter {
+	now := time.Now()
+	return &Reporter{Interval: 10 * time.Second, w: w, tty: isTerminal(w), what: what, total: total, started: now, last: now}
+}
+
+// isTerminal reports whether w is a character device, where a line can be redrawn.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Done records a finished item and its number of findings.
+func (r *Reporter) Done(findings int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.done++
+	r.findings += findings
+	now := time.Now()
+	switch {
+	case r.tty:
+		if now.Sub(r.last) >= redrawInterval {
+			r.draw(r.status(now, true))
+			r.last = now
+		}
+	case now.Sub(r.last) >= r.Interval:
+		fmt.Fprintln(r.w, r.status(now, false))
+		r.last = now
+	}
+}
+
+// Finish prints the final count and ends the terminal status line. Runs short
+// enough that no progress was shown stay silent.
+func (r *Reporter) Finish() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.last.Equal(r.started) {
+		return
+	}
+	line := r.status(time.Now(), false)
+	if r.tty {
+		r.draw(line)
+		fmt.Fprintln(r.w)
+		return
+	}
+	fmt.Fprintln(r.w, line)
+}
+
+// draw replaces the terminal status line.
+func (r *Reporter) draw(line string) {
+	pad := ""
+	if n := len([]rune(line)); n < r.width {
+		pad = strings.Repeat(" ", r.width-n)
+	}
+	r.width = len([]rune(line))
+	fmt.Fprint(r.w, "\r", line, pad)
+}
+
+// status is the progress line: done, findings so far, elapsed time, and the time
+// left at the rate so far when the total is known.
+func (r *Reporter) status(now time.Time, bar bool) string {
+	elapsed := now.Sub(r.started)
+	var b strings.Builder
+	b.WriteString("⏳ ")
+	if r.total > 0 {
+		if bar {
+			const width = 20
+			filled := r.done * width / r.total
+			b.WriteString("[" + strings.Repeat("█", filled) + strings.Repeat("░", width-filled) + "] ")
+		}
+		fmt.Fprintf(&b, "%d/%d %s (%d%%)", r.done, r.total, r.what, r.done*100/r.total)
+	} else {
+		fmt.Fprintf(&b, "%d %s", r.done, r.what)
+	}
+	fmt.Fprintf(&b, ", %d findings, %s elapsed", r.findings, elapsed.Round(time.Second))
+	if r.total > 0 && r.done > 0 && r.done < r.total {
+		eta := elapsed / time.Duration(r.done) * time.Duration(r.total-r.done)
+		fmt.Fprintf(&b, ", ETA %s", eta.Round(time.Second))
+	}
+	return b.String()
+}
@@ -0,0 +1,331 @@
+// Package protocheck validates JSON payloads against protobuf messages, following the
+// proto3 JSON mapping: field names, value types, enum values, and oneof exclusivity.
+// Messages come from a compiled descriptor set (protoc --descriptor_set_out), which is
+// decoded here from the protobuf wire format directly.
+package protocheck
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Field types and labels of descriptor.proto.
+const (
+	typeDouble   = 1
+	typeFloat    = 2
+	typeInt64    = 3
+	typeUint64   = 4
+	typeInt32    = 5
+	typeFixed64  = 6
+	typeFixed32  = 7
+	typeBool     = 8
+	typeString   = 9
+	typeGroup    = 10
+	typeMessage  = 11
+	typeBytes    = 12
+	typeUint32   = 13
+	typeEnum     = 14
+	typeSfixed32 = 15
+	typeSfixed64 = 16
+	typeSint32   = 17
+	typeSint64   = 18
+
+	labelRequired = 2
+	labelRepeated = 3
+)
+
+// Field is a field of a message.
+type Field struct {
+	Name     string
+	JSONName string
+	Number   int32
+	label    int32
+	typ      int32
+	typeName string // full name of a message or enum type, without the leading dot
+	oneof    int    // index into the message's oneofs, or -1
+	optional bool   // proto3 optional: its oneof is synthetic
+}
+
+// Message is a message type.
+type Message struct {
+	FullName string
+	Fields   []*Field
+	oneofs   []string
+	mapEntry bool
+}
+
+// Enum is an enum type.
+type Enum struct {
+	FullName string
+	values   map[string]int32
+	numbers  map[int32]bool
+}
+
+// Descriptors are the message and enum types of a descriptor set, by full name.
+type Descriptors struct {
+	messages map[string]*Message
+	enums    map[string]*Enum
+}
+
+// LoadDescriptors reads a FileDescriptorSet, as written by protoc --descriptor_set_out.
+// Include the imports (--include_imports) so every referenced type is known.
+func LoadDescriptors(path string) (*Descriptors, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read descriptor set: %v", err)
+	}
+	d, err := ParseDescriptors(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse descriptor set %s: %v", path, err)
+	}
+	return d, nil
+}
+
+// ParseDescriptors decodes a serialized FileDescriptorSet.
+func ParseDescriptors(data []byte) (*Descriptors, error) {
+	d := &Descriptors{messages: map[string]*Message{}, enums: map[string]*Enum{}}
+	err := fields(data, func(num int, wire int, v uint64, b []byte) error {
+		if num == 1 && wire == 2 { // FileDescriptorSet.file
+			return d.file(b)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(d.messages) == 0 {
+		return nil, fmt.Errorf("no message types found")
+	}
+	return d, nil
+}
+
+// Message returns the message type with the given full name (e.g. acme.v1.Device).
+func (d *Descriptors) Message(name string) (*Message, error) {
+	name = strings.TrimPrefix(name, ".")
+	if m := d.messages[name]; m != nil {
+		return m, nil
+	}
+	var similar []string
+	for full := range d.messages {
+		if full == name || strings.HasSuffix(full, "."+name) {
+			similar = append(similar, full)
+		}
+	}
+	sort.Strings(similar)
+	if len(similar) > 0 {
+		return nil, fmt.Errorf("no message %s in the descriptor set (use the full name: %s)", name, strings.Join(similar, ", "))
+	}
+	return nil, fmt.Errorf("no message %s in the descriptor set", name)
+}
+
+func (d *Descriptors) file(data []byte) error {
+	var pkg string
+	var messages, enums [][]byte
+	err := fields(data, func(num int, wire int, v uint64, b []byte) error {
+		switch {
+		case num == 2 && wire == 2:
+			pkg = string(b)
+		case num == 4 && wire == 2:
+			messages = append(messages, b)
+		case num == 5 && wire == 2:
+			enums = append(enums, b)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, b := range messages {
+		if err := d.message(pkg, b); err != nil {
+			return err
+		}
+	}
+	for _, b := range enums {
+		if err := d.enum(pkg, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Descriptors) message(scope string, data []byte) error {
+	m := &Message{}
+	var nested, enums [][]byte
+	err := fields(data, func(num int, wire int, v uint64, b []byte) error {
+		switch {
+		case num == 1 && wire == 2:
+			m.FullName = qualify(scope, string(b))
+		case num == 2 && wire == 2:
+			f, err := parseField(b)
+			if err != nil {
+				return err
+			}
+			m.Fields = append(m.Fields, f)
+		case num == 3 && wire == 2:
+			nested = append(nested, b)
+		case num == 4 && wire == 2:
+			enums = append(enums, b)
+		case num == 7 && wire == 2: // MessageOptions
+			return fields(b, func(num int, wire int, v uint64, b []byte) error {
+				if num == 7 && wire == 0 {
+					m.mapEntry = v != 0
+				}
+				return nil
+			})
+		case num == 8 && wire == 2: // OneofDescriptorProto
+			return fields(b, func(num int, wire int, v uint64, b []byte) error {
+				if num == 1 && wire == 2 {
+					m.oneofs = append(m.oneofs, string(b))
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	d.messages[m.FullName] = m
+	for _, b := range nested {
+		if err := d.message(m.FullName, b); err != nil {
+			return err
+		}
+	}
+	for _, b := range enums {
+		if err := d.enum(m.FullName, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseField(data []byte) (*Field, error) {
+	f := &Field{oneof: -1}
+	err := fields(data, func(num int, wire int, v uint64, b []byte) error {
+		switch {
+		case num == 1 && wire == 2:
+			f.Name = string(b)
+		case num == 3 && wire == 0:
+			f.Number = int32(v)
+		case num == 4 && wire == 0:
+			f.label = int32(v)
+		case num == 5 && wire == 0:
+			f.typ = int32(v)
+		case num == 6 && wire == 2:
+			f.typeName = strings.TrimPrefix(string(b), ".")
+		case num == 9 && wire == 0:
+			f.oneof = int(v)
+		case num == 10 && wire == 2:
+			f.JSONName = string(b)
+		case num == 17 && wire == 0:
+			f.optional = v != 0
+		}
+		return nil
+	})
+	if f.JSONName == "" {
+		f.JSONName = jsonName(f.Name)
+	}
+	return f, err
+}
+
+func (d *Descriptors) enum(scope string, data []byte) error {
+	e := &Enum{values: map[string]int32{}, numbers: map[int32]bool{}}
+	err := fields(data, func(num int, wire int, v uint64, b []byte) error {
+		switch {
+		case num == 1 && wire == 2:
+			e.FullName = qualify(scope, string(b))
+		case num == 2 && wire == 2: // EnumValueDescriptorProto
+			var name string
+			var number int32
+			err := fields(b, func(num int, wire int, v uint64, b []byte) error {
+				switch {
+				case num == 1 && wire == 2:
+					name = string(b)
+				case num == 2 && wire == 0:
+					number = int32(v)
+				}
+				return nil
+			})
+			e.values[name] = number
+			e.numbers[number] = true
+			return err
+		}
+		return nil
+	})
+	d.enums[e.FullName] = e
+	return err
+}
+
+// fields walks the fields of an encoded message. Varint and fixed-size values are
+// passed in v, length-delimited ones in b.
+func fields(data []byte, fn func(num int, wire int, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return fmt.Errorf("truncated field key")
+		}
+		data = data[n:]
+		num, wire := int(key>>3), int(key&7)
+		var v uint64
+		var b []byte
+		switch wire {
+		case 0:
+			if v, n = binary.Uvarint(data); n <= 0 {
+				return fmt.Errorf("truncated varint in field %d", num)
+			}
+			data = data[n:]
+		case 1:
+			if len(data) < 8 {
+				return fmt.Errorf("truncated fixed64 in field %d", num)
+			}
+			v, data = binary.LittleEndian.Uint64(data), data[8:]
+		case 2:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || size > uint64(len(data)-n) {
+				return fmt.Errorf("truncated bytes in field %d", num)
+			}
+			b, data = data[n:n+int(size)], data[n+int(size):]
+		case 5:
+			if len(data) < 4 {
+				return fmt.Errorf("truncated fixed32 in field %d", num)
+			}
+			v, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		default:
+			return fmt.Errorf("unsupported wire type %d in field %d", wire, num)
+		}
+		if err := fn(num, wire, v, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func qualify(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
+
+// jsonName is protoc's lowerCamelCase JSON name of a field, for descriptor sets
+// written without json_name.
+func jsonName(name string) string {
+	var sb strings.Builder
+	upper := false
+	for _, r := range name {
+		if r == '_' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
@@ -0,0 +1,498 @@
+package protocheck
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"config-validator/pkg/automata"
+)
+
+// State is the state reported in protobuf findings.
+const State = "PROTO"
+
+// node is a JSON value with the line it starts on.
+type node struct {
+	kind  byte // '{', '[', '"' (string), 'n' (number), 'b' (boolean), '0' (null)
+	line  int
+	text  string // a string's value or a number's literal
+	keys  []string
+	lines []int // line of each key
+	items []*node
+}
+
+var kindNames = map[byte]string{'{': "an object", '[': "an array", '"': "a string", 'n': "a number", 'b': "a boolean", '0': "null"}
+
+var durationRe = regexp.MustCompile(`^-?[0-9]+(\.[0-9]{1,9})?s$`)
+
+// wrappers are the well-known wrapper messages, written in JSON as their value.
+var wrappers = map[string]int32{
+	"google.protobuf.DoubleValue": typeDouble, "google.protobuf.FloatValue": typeFloat,
+	"google.protobuf.Int64Value": typeInt64, "google.protobuf.UInt64Value": typeUint64,
+	"google.protobuf.Int32Value": typeInt32, "google.protobuf.UInt32Value": typeUint32,
+	"google.protobuf.BoolValue": typeBool, "google.protobuf.StringValue": typeString,
+	"google.protobuf.BytesValue": typeBytes,
+}
+
+// specialTypes are the other well-known types with a JSON form of their own.
+var specialTypes = map[string]bool{
+	"google.protobuf.Timestamp": true, "google.protobuf.Duration": true, "google.protobuf.FieldMask": true,
+	"google.protobuf.Struct": true, "google.protobuf.ListValue": true, "google.protobuf.Value": true,
+	"google.protobuf.Empty": true,
+}
+
+type validator struct {
+	d        *Descriptors
+	findings []automata.Finding
+}
+
+// Check validates a JSON payload against a message type of d.
+func Check(content []byte, d *Descriptors, m *Message) []automata.Finding {
+	v := &validator{d: d}
+	lines := newLineIndex(content)
+	root, err := parseJSON(content, lines)
+	if err != nil {
+		var syntax *json.SyntaxError
+		f := automata.Finding{State: State, Message: "invalid JSON: " + err.Error(), Severity: automata.SeverityError}
+		if errors.As(err, &syntax) {
+			f.Line = lines.line(syntax.Offset)
+		}
+		return []automata.Finding{f}
+	}
+	v.message(m.FullName, root, "")
+	return v.findings
+}
+
+func (v *validator) add(line int, path, severity, msg string) {
+	if path != "" {
+		msg = path + ": " + msg
+	}
+	v.findings = append(v.findings, automata.Finding{Line: line, Command: path, State: State, Message: msg, Severity: severity})
+}
+
+// message checks a value of the named message type.
+func (v *validator) message(name string, n *node, path string) {
+	if v.wellKnown(name, n, path) {
+		return
+	}
+	m := v.d.messages[name]
+	if m == nil {
+		v.add(n.line, path, automata.SeverityWarning, fmt.Sprintf("type %s is not in the descriptor set, so its value is not checked (compile with --include_imports)", name))
+		return
+	}
+	if n.kind != '{' {
+		v.add(n.line, path, automata.SeverityError, fmt.Sprintf("expected an object for message %s, got %s", name, kindNames[n.kind]))
+		return
+	}
+	v.object(m, n, path, nil)
+}
+
+// object checks the fields of a message. skip lists keys that are not fields.
+func (v *validator) object(m *Message, n *node, path string, skip map[string]bool) {
+	byName := map[string]*Field{}
+	for _, f := range m.Fields {
+		byName[f.Name] = f
+		byName[f.JSONName] = f
+	}
+	seen := map[*Field]string{}
+	oneofs := map[int]string{}
+	for i, key := range n.keys {
+		if skip[key] {
+			continue
+		}
+		value, line, child := n.items[i], n.lines[i], join(path, key)
+		f := byName[key]
+		if f == nil {
+			v.add(line, child, automata.SeverityError, fmt.Sprintf("unknown field %q in %s%s", key, m.FullName, suggest(key, m)))
+			continue
+		}
+		if prev, ok := seen[f]; ok {
+			v.add(line, child, automata.SeverityError, fmt.Sprintf("field %s is set twice, as %q and %q", f.Name, prev, key))
+			continue
+		}
+		seen[f] = key
+		if value.kind == '0' && f.typeName != "google.protobuf.Value" {
+			continue // null is the default value
+		}
+		if f.oneof >= 0 && !f.optional {
+			if prev, ok := oneofs[f.oneof]; ok {
+				v.add(line, child, automata.SeverityError, fmt.Sprintf("%s and %s are both set, but only one field of oneof %s may be", prev, key, m.oneofs[f.oneof]))
+			}
+			oneofs[f.oneof] = key
+		}
+		v.field(f, value, child)
+	}
+	for _, f := range m.Fields {
+		if _, ok := seen[f]; !ok && f.label == labelRequired {
+			v.add(n.line, path, automata.SeverityError, fmt.Sprintf("required field %s of %s is missing", f.JSONName, m.FullName))
+		}
+	}
+}
+
+// field checks the value of a field: a map, a list, or a single value.
+func (v *validator) field(f *Field, n *node, path string) {
+	if entry := v.d.messages[f.typeName]; f.typ == typeMessage && entry != nil && entry.mapEntry && len(entry.Fields) == 2 {
+		if n.kind != '{' {
+			v.add(n.line, path, automata.SeverityError, fmt.Sprintf("map field %s must be an object, got %s", f.Name, kindNames[n.kind]))
+			return
+		}
+		key, value := entry.Fields[0], entry.Fields[1]
+		if key.Number != 1 {
+			key, value = value, key
+		}
+		for i, k := range n.keys {
+			child := fmt.Sprintf("%s[%q]", path, k)
+			if msg := mapKey(key.typ, k); msg != "" {
+				v.add(n.lines[i], child, automata.SeverityError, "map key "+msg)
+			}
+			if n.items[i].kind == '0' && value.typeName != "google.protobuf.Value" {
+				v.add(n.lines[i], child, automata.SeverityError, "map values may not be null")
+				continue
+			}
+			v.single(value, n.items[i], child)
+		}
+		return
+	}
+	if f.label == labelRepeated {
+		if n.kind != '[' {
+			v.add(n.line, path, automata.SeverityError, fmt.Sprintf("repeated field %s must be an array, got %s", f.Name, kindNames[n.kind]))
+			return
+		}
+		for i, item := range n.items {
+			child := fmt.Sprintf("%s[%d]", path, i)
+			if item.kind == '0' && f.typeName != "google.protobuf.Value" {
+				v.add(item.line, child, automata.SeverityError, "elements of a repeated field may not be null")
+				continue
+			}
+			v.single(f, item, child)
+		}
+		return
+	}
+	v.single(f, n, path)
+}
+
+// single checks one value of a field's type.
+func (v *validator) single(f *Field, n *node, path string) {
+	switch f.typ {
+	case typeMessage, typeGroup:
+		v.message(f.typeName, n, path)
+	case typeEnum:
+		v.enum(f.typeName, n, path)
+	default:
+		if msg := scalar(f.typ, n); msg != "" {
+			v.add(n.line, path, automata.SeverityError, msg)
+		}
+	}
+}
+
+func (v *validator) enum(name string, n *node, path string) {
+	e := v.d.enums[name]
+	switch {
+	case name == "google.protobuf.NullValue" && (n.kind == '0' || n.text == "NULL_VALUE"):
+	case n.kind == '"':
+		if e != nil {
+			if _, ok := e.values[n.text]; !ok {
+				v.add(n.line, path, automata.SeverityError, fmt.Sprintf("%q is not a value of enum %s (%s)", n.text, name, e.names()))
+			}
+		}
+	case n.kind == 'n':
+		if msg := integer(n.text, true, 32); msg != "" {
+			v.add(n.line, path, automata.SeverityError, msg)
+		} else if number, _ := strconv.ParseInt(n.text, 10, 32); e != nil && !e.numbers[int32(number)] {
+			v.add(n.line, path, automata.SeverityWarning, fmt.Sprintf("%s is not a number of enum %s; it is kept as an unknown value", n.text, name))
+		}
+	default:
+		v.add(n.line, path, automata.SeverityError, fmt.Sprintf("enum %s must be a value name or number, got %s", name, kindNames[n.kind]))
+	}
+}
+
+// wellKnown checks the well-known types, which have their own JSON forms. It reports
+// whether name is one of them.
+func (v *validator) wellKnown(name string, n *node, path string) bool {
+	expect := func(kind byte, what string) {
+		if n.kind != kind {
+			v.add(n.line, path, automata.SeverityError, fmt.Sprintf("%s must be %s, got %s", name, what, kindNames[n.kind]))
+		}
+	}
+	if typ, ok := wrappers[name]; ok {
+		if msg := scalar(typ, n); msg != "" {
+			v.add(n.line, path, automata.SeverityError, msg)
+		}
+		return true
+	}
+	switch name {
+	case "google.protobuf.Timestamp":
+		expect('"', "an RFC 3339 string")
+		if _, err := time.Parse(time.RFC3339Nano, n.text); n.kind == '"' && err != nil {
+			v.add(n.line, path, automata.SeverityError, fmt.Sprintf("%q is not an RFC 3339 timestamp (e.g. 2024-01-02T15:04:05Z)", n.text))
+		}
+	case "google.protobuf.Duration":
+		expect('"', "a string of seconds like \"1.5s\"")
+		if n.kind == '"' && !durationRe.MatchString(n.text) {
+			v.add(n.line, path, automata.SeverityError, fmt.Sprintf("%q is not a duration in seconds (e.g. \"1.5s\")", n.text))
+		}
+	case "google.protobuf.FieldMask":
+		expect('"', "a string of comma-separated paths")
+	case "google.protobuf.Struct":
+		expect('{', "an object")
+	case "google.protobuf.ListValue":
+		expect('[', "an array")
+	case "google.protobuf.Value":
+	case "google.protobuf.Empty":
+		expect('{', "an empty object")
+		if n.kind == '{' && len(n.keys) > 0 {
+			v.add(n.line, path, automata.SeverityError, "google.protobuf.Empty must be {}")
+		}
+	case "google.protobuf.Any":
+		v.any(n, path)
+	default:
+		return false
+	}
+	return true
+}
+
+// any checks a google.protobuf.Any: its @type names the message of the other fields.
+func (v *validator) any(n *node, path string) {
+	if n.kind != '{' {
+		v.add(n.line, path, automata.SeverityError, fmt.Sprintf("google.protobuf.Any must be an object, got %s", kindNames[n.kind]))
+		return
+	}
+	var typeURL *node
+	for i, k := range n.keys {
+		if k == "@type" {
+			typeURL = n.items[i]
+		}
+	}
+	if typeURL == nil || typeURL.kind != '"' {
+		v.add(n.line, path, automata.SeverityError, "google.protobuf.Any needs an \"@type\" string")
+		return
+	}
+	name := typeURL.text[strings.LastIndex(typeURL.text, "/")+1:]
+	if _, wrapper := wrappers[name]; wrapper || specialTypes[name] {
+		for i, k := range n.keys {
+			if k == "value" {
+				v.message(name, n.items[i], join(path, "value"))
+			}
+		}
+		return
+	}
+	m := v.d.messages[name]
+	if m == nil {
+		v.add(typeURL.line, join(path, "@type"), automata.SeverityWarning, fmt.Sprintf("type %s is not in the descriptor set, so the Any value is not checked", name))
+		return
+	}
+	v.object(m, n, path, map[string]bool{"@type": true})
+}
+
+// scalar returns what is wrong with a value of a scalar type, or "".
+func scalar(typ int32, n *node) string {
+	switch typ {
+	case typeBool:
+		if n.kind != 'b' {
+			return fmt.Sprintf("expected a boolean, got %s", kindNames[n.kind])
+		}
+		return ""
+	case typeString:
+		if n.kind != '"' {
+			return fmt.Sprintf("expected a string, got %s", kindNames[n.kind])
+		}
+		return ""
+	case typeBytes:
+		if n.kind != '"' {
+			return fmt.Sprintf("expected base64 bytes, got %s", kindNames[n.kind])
+		}
+		for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+			if _, err := enc.DecodeString(n.text); err == nil {
+				return ""
+			}
+		}
+		return fmt.Sprintf("%q is not base64", n.text)
+	}
+
+	if n.kind != 'n' && n.kind != '"' {
+		return fmt.Sprintf("expected a number, got %s", kindNames[n.kind])
+	}
+	switch typ {
+	case typeDouble, typeFloat:
+		if n.kind == '"' && (n.text == "NaN" || n.text == "Infinity" || n.text == "-Infinity") {
+			return ""
+		}
+		bits := 64
+		if typ == typeFloat {
+			bits = 32
+		}
+		if _, err := strconv.ParseFloat(n.text, bits); err != nil {
+			if errors.Is(err, strconv.ErrRange) {
+				return fmt.Sprintf("%s is out of range for a %s", n.text, map[int]string{32: "float", 64: "double"}[bits])
+			}
+			return fmt.Sprintf("%q is not a number", n.text)
+		}
+		return ""
+	case typeInt32, typeSint32, typeSfixed32:
+		return integer(n.text, true, 32)
+	case typeInt64, typeSint64, typeSfixed64:
+		return integer(n.text, true, 64)
+	case typeUint32, typeFixed32:
+		return integer(n.text, false, 32)
+	default: // uint64, fixed64
+		return integer(n.text, false, 64)
+	}
+}
+
+// mapKey returns what is wrong with a map key of the given type, or "". Keys are
+// always JSON strings; bool and integer keys hold their value as text.
+func mapKey(typ int32, key string) string {
+	if typ == typeBool {
+		if key != "true" && key != "false" {
+			return fmt.Sprintf("%q is not true or false", key)
+		}
+		return ""
+	}
+	return scalar(typ, &node{kind: '"', text: key})
+}
+
+// integer returns what is wrong with an integer literal of the given size, or "".
+// Exponent notation is accepted when the value is whole.
+func integer(text string, signed bool, bits int) string {
+	kind := fmt.Sprintf("int%d", bits)
+	if !signed {
+		kind = "u" + kind
+	}
+	var err error
+	if signed {
+		_, err = strconv.ParseInt(text, 10, bits)
+	} else {
+		_, err = strconv.ParseUint(text, 10, bits)
+	}
+	if err == nil {
+		return ""
+	}
+	if errors.Is(err, strconv.ErrRange) {
+		return fmt.Sprintf("%s is out of range for %s", text, kind)
+	}
+	f, ferr := strconv.ParseFloat(text, 64)
+	switch {
+	case ferr != nil:
+		return fmt.Sprintf("%q is not an integer", text)
+	case f != math.Trunc(f) || math.IsInf(f, 0):
+		return fmt.Sprintf("%s is not an integer", text)
+	case !signed && f < 0,
+		signed && (f < -math.Pow(2, float64(bits-1)) || f >= math.Pow(2, float64(bits-1))),
+		!signed && f >= math.Pow(2, float64(bits)):
+		return fmt.Sprintf("%s is out of range for %s", text, kind)
+	}
+	return ""
+}
+
+func (e *Enum) names() string {
+	names := make([]string, 0, len(e.values))
+	for name := range e.values {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return e.values[names[i]] < e.values[names[j]] })
+	return strings.Join(names, ", ")
+}
+
+// suggest names a field that differs from key only in case or underscores.
+func suggest(key string, m *Message) string {
+	norm := func(s string) string { return strings.ToLower(strings.ReplaceAll(s, "_", "")) }
+	for _, f := range m.Fields {
+		if norm(f.Name) == norm(key) {
+			return fmt.Sprintf("; did you mean %q?", f.JSONName)
+		}
+	}
+	return ""
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// parseJSON parses content into nodes that remember their lines.
+func parseJSON(content []byte, lines lineIndex) (*node, error) {
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.UseNumber()
+	line := func() int { return lines.line(dec.InputOffset() - 1) }
+
+	var value func() (*node, error)
+	value = func() (*node, error) {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		n := &node{line: line()}
+		switch t := tok.(type) {
+		case json.Delim:
+			n.kind = byte(t)
+			for dec.More() {
+				if t == '{' {
+					key, err := dec.Token()
+					if err != nil {
+						return nil, err
+					}
+					n.keys = append(n.keys, key.(string))
+					n.lines = append(n.lines, line())
+				}
+				item, err := value()
+				if err != nil {
+					return nil, err
+				}
+				n.items = append(n.items, item)
+			}
+			if _, err := dec.Token(); err != nil { // the closing delimiter
+				return nil, err
+			}
+		case string:
+			n.kind, n.text = '"', t
+		case json.Number:
+			n.kind, n.text = 'n', string(t)
+		case bool:
+			n.kind, n.text = 'b', strconv.FormatBool(t)
+		case nil:
+			n.kind = '0'
+		}
+		return n, nil
+	}
+
+	root, err := value()
+	if err == io.EOF {
+		return nil, fmt.Errorf("empty payload")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("data after the JSON value on line %d", line())
+	}
+	return root, nil
+}
+
+// lineIndex holds the offset of every newline, to turn offsets into line numbers.
+type lineIndex []int64
+
+func newLineIndex(content []byte) lineIndex {
+	var idx lineIndex
+	for i, b := range content {
+		if b == '\n' {
+			idx = append(idx, int64(i))
+		}
+	}
+	return idx
+}
+
+// line returns the line of the byte at offset, counting from 1.
+func (idx lineIndex) line(offset int64) int {
+	return sort.Search(len(idx), func(i int) bool { return idx[i] >= offset }) + 1
+}
@@ -0,0 +1,285 @@
+// Package proxy is a reverse proxy that validates the HTTP traffic it forwards: every
+// request and response body is checked by its media type, and requests by any further
+// checks such as an OpenAPI contract. Event streams, which do not end, are validated
+// as they are forwarded. Findings are tagged with the transaction they belong to, and
+// messages that fail can be rejected instead of forwarded.
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/httpbody"
+	"config-validator/pkg/httpmsg"
+	"config-validator/pkg/mediatype"
+	"config-validator/pkg/ssecheck"
+)
+
+// DefaultMaxBody is the largest body that is validated; larger bodies are forwarded
+// unchecked.
+const DefaultMaxBody = 10 << 20
+
+// Options configure a proxy.
+type Options struct {
+	Upstream *url.URL
+	Checks   []func(*httpmsg.Message) []automata.Finding // further checks of requests
+	Reject   bool                                        // reject failing messages instead of forwarding them
+	MaxBody  int64                                       // DefaultMaxBody when zero
+	Report   func(Transaction)                           // called when a transaction ends
+	Stream   func(Transaction, automata.Finding)         // called for each event stream finding as it is found
+}
+
+// Transaction is a request and its response as seen by the proxy.
+type Transaction struct {
+	ID       uint64             `json:"id"`
+	Time     time.Time          `json:"time"`
+	Method   string             `json:"method"`
+	Target   string             `json:"target"`
+	Status   int                `json:"status,omitempty"`
+	Request  []automata.Finding `json:"request_findings,omitempty"`
+	Response []automata.Finding `json:"response_findings,omitempty"`
+	Rejected string             `json:"rejected,omitempty"` // "request" or "response"
+	Error    string             `json:"error,omitempty"`    // the upstream could not be reached
+}
+
+// Proxy is the validating reverse proxy.
+type Proxy struct {
+	opts    Options
+	reverse *httputil.ReverseProxy
+	next    atomic.Uint64
+}
+
+type txKey struct{}
+
+// New returns a proxy forwarding to opts.Upstream.
+func New(opts Options) *Proxy {
+	if opts.MaxBody == 0 {
+		opts.MaxBody = DefaultMaxBody
+	}
+	p := &Proxy{opts: opts}
+	p.reverse = &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(opts.Upstream)
+			r.SetXForwarded()
+		},
+		ModifyResponse: p.response,
+		ErrorHandler:   p.failed,
+	}
+	return p
+}
+
+// ServeHTTP validates the request, forwards it, and validates the response.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tx := &Transaction{ID: p.next.Add(1), Time: time.Now(), Method: r.Method, Target: r.RequestURI}
+	defer func() {
+		if p.opts.Report != nil {
+			p.opts.Report(*tx)
+		}
+	}()
+
+	msg := &httpmsg.Message{
+		StartLine: fmt.Sprintf("%s %s %s", r.Method, r.RequestURI, r.Proto),
+		Request:   true,
+		Method:    r.Method,
+		Target:    r.RequestURI,
+		Version:   r.Proto,
+		Headers:   headers(r.Host, r.Header),
+	}
+	msg.BodyLine = len(msg.Headers) + 3
+	var complete bool
+	msg.Body, r.Body, complete = capture(r.Body, p.opts.MaxBody)
+	if complete {
+		tx.Request = p.check(msg, true)
+	} else {
+		tx.Request = []automata.Finding{bodyTooLarge(p.opts.MaxBody)}
+	}
+	if p.opts.Reject && fails(tx.Request) {
+		tx.Rejected, tx.Status = "request", http.StatusBadRequest
+		reject(w, tx, http.StatusBadRequest, tx.Request)
+		return
+	}
+	p.reverse.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), txKey{}, tx)))
+}
+
+// response validates a response from the upstream. A failing response is replaced by
+// a 502 when rejecting.
+func (p *Proxy) response(resp *http.Response) error {
+	tx := resp.Request.Context().Value(txKey{}).(*Transaction)
+	tx.Status = resp.StatusCode
+	msg := &httpmsg.Message{
+		StartLine: fmt.Sprintf("%s %s", resp.Proto, resp.Status),
+		Status:    resp.StatusCode,
+		Version:   resp.Proto,
+		Headers:   headers("", resp.Header),
+	}
+	msg.BodyLine = len(msg.Headers) + 3
+	resp.Header.Set("X-Validation-Transaction", fmt.Sprint(tx.ID))
+	if m, _ := mediatype.Parse(resp.Header.Get("Content-Type"), 0); httpbody.Kind(m) == "event-stream" {
+		p.stream(tx, resp, msg.BodyLine)
+		return nil
+	}
+	var complete bool
+	msg.Body, resp.Body, complete = capture(resp.Body, p.opts.MaxBody)
+	if complete {
+		tx.Response = p.check(msg, false)
+	} else {
+		tx.Response = []automata.Finding{bodyTooLarge(p.opts.MaxBody)}
+	}
+	resp.Header.Set("X-Validation-Findings", fmt.Sprint(len(tx.Request)+len(tx.Response)))
+	if p.opts.Reject && fails(tx.Response) {
+		resp.Body.Close()
+		tx.Rejected = "response"
+		return errRejected
+	}
+	return nil
+}
+
+// stream validates an event stream as it is forwarded, as it never ends. Its findings
+// are passed to Options.Stream as they are found and added to the transaction. They
+// come after the headers were sent, so the stream is never rejected.
+func (p *Proxy) stream(tx *Transaction, resp *http.Response, bodyLine int) {
+	if coding := resp.Header.Get("Content-Encoding"); coding != "" && !strings.EqualFold(coding, "identity") {
+		tx.Response = append(tx.Response, automata.Finding{State: ssecheck.State, Severity: automata.SeverityWarning,
+			Message: fmt.Sprintf("event stream is %s-encoded, so it is forwarded without validation", coding)})
+		return
+	}
+	checker := ssecheck.NewChecker(func(f automata.Finding) {
+		f.Line += bodyLine - 1
+		tx.Response = append(tx.Response, f)
+		if p.opts.Stream != nil {
+			p.opts.Stream(*tx, f)
+		}
+	})
+	resp.Body = &streamBody{ReadCloser: resp.Body, checker: checker}
+}
+
+// streamBody passes what is read from an event stream to its checker, and ends the
+// stream for it when the body is closed.
+type streamBody struct {
+	io.ReadCloser
+	checker *ssecheck.Checker
+	once    sync.Once
+}
+
+func (b *streamBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.checker.Write(p[:n])
+	if err == io.EOF {
+		b.once.Do(b.checker.Close)
+	}
+	return n, err
+}
+
+// Close does not report an event left open: the client went away, so the stream was
+// cut rather than ended by the server.
+func (b *streamBody) Close() error {
+	b.once.Do(func() {})
+	return b.ReadCloser.Close()
+}
+
+var errRejected = fmt.Errorf("response failed validation")
+
+// failed answers when the upstream cannot be reached or its response was rejected.
+func (p *Proxy) failed(w http.ResponseWriter, r *http.Request, err error) {
+	tx := r.Context().Value(txKey{}).(*Transaction)
+	if err == errRejected {
+		tx.Status = http.StatusBadGateway
+		reject(w, tx, http.StatusBadGateway, tx.Response)
+		return
+	}
+	tx.Status, tx.Error = http.StatusBadGateway, err.Error()
+	log.Printf("❌ tx %d: upstream failed: %v", tx.ID, err)
+	w.WriteHeader(http.StatusBadGateway)
+}
+
+// check validates a message: the content coding and body by media type, and for
+// requests, the further checks.
+func (p *Proxy) check(msg *httpmsg.Message, request bool) []automata.Finding {
+	findings := httpmsg.Decode(msg)
+	findings = append(findings, httpbody.CheckMessage(msg)...)
+	if request {
+		for _, check := range p.opts.Checks {
+			findings = append(findings, check(msg)...)
+		}
+	}
+	return findings
+}
+
+// capture reads a body up to max bytes. It returns what it read, a body to forward in
+// place of the one read, and whether the whole body was read.
+func capture(body io.ReadCloser, max int64) ([]byte, io.ReadCloser, bool) {
+	if body == nil || body == http.NoBody {
+		return nil, body, true
+	}
+	data, err := io.ReadAll(io.LimitReader(body, max+1))
+	if err != nil || int64(len(data)) > max {
+		return nil, struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), body), body}, false
+	}
+	body.Close()
+	return data, io.NopCloser(bytes.NewReader(data)), true
+}
+
+// headers lists header fields in a stable order, with Host first. Lines are numbered
+// as in the serialized message, after the start line.
+func headers(host string, h http.Header) []httpmsg.Header {
+	var out []httpmsg.Header
+	if host != "" {
+		out = append(out, httpmsg.Header{Name: "Host", Value: host, Line: 2})
+	}
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range h[name] {
+			out = append(out, httpmsg.Header{Name: name, Value: v, Line: len(out) + 2})
+		}
+	}
+	return out
+}
+
+// fails reports whether findings include more than warnings.
+func fails(findings []automata.Finding) bool {
+	for _, f := range findings {
+		if f.Severity != automata.SeverityWarning {
+			return true
+		}
+	}
+	return false
+}
+
+func bodyTooLarge(max int64) automata.Finding {
+	return automata.Finding{State: httpbody.State, Severity: automata.SeverityWarning,
+		Message: fmt.Sprintf("body is larger than %d bytes, so it was forwarded without validation", max)}
+}
+
+// reject answers with the findings that failed a message.
+func reject(w http.ResponseWriter, tx *Transaction, status int, findings []automata.Finding) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Validation-Transaction", fmt.Sprint(tx.ID))
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(map[string]any{
+		"transaction": tx.ID,
+		"rejected":    tx.Rejected,
+		"findings":    findings,
+	})
+}
@@ -0,0 +1,136 @@
+// Package queue is a bounded queue with a policy for when it is full, so a burst of
+// work waits in bounded memory instead of piling up.
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// Policy says what Put does when the queue is full.
+type Policy string
+
+const (
+	// Block waits for room, pushing back on the producer.
+	Block Policy = "block"
+	// Drop refuses the new item.
+	Drop Policy = "drop"
+	// ShedOldest removes the item that has waited longest to make room for the new one.
+	ShedOldest Policy = "shed-oldest"
+)
+
+// Policies are the valid policies, for help texts and completion.
+var Policies = []Policy{Block, Drop, ShedOldest}
+
+// ParsePolicy checks a policy name.
+func ParsePolicy(s string) (Policy, error) {
+	for _, p := range Policies {
+		if string(p) == s {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("unknown overflow policy %q (want block, drop, or shed-oldest)", s)
+}
+
+// ErrFull is returned by Put when the Drop policy refused an item.
+var ErrFull = errors.New("queue is full")
+
+// Queue is a FIFO of at most a fixed number of items. It is safe for concurrent use.
+type Queue[T any] struct {
+	ch     chan T
+	policy Policy
+	shed   func(T)
+
+	enqueued, dropped, shedded, blocked atomic.Int64
+}
+
+// Stats counts what happened to the items put in a queue.
+type Stats struct {
+	Depth    int   `json:"depth"`
+	Len      int   `json:"len"`
+	Enqueued int64 `json:"enqueued"`
+	Dropped  int64 `json:"dropped"` // refused by the Drop policy
+	Shed     int64 `json:"shed"`    // removed by the ShedOldest policy
+	Blocked  int64 `json:"blocked"` // had to wait for room with the Block policy
+}
+
+// New returns a queue of depth items, at least one. shed, if not nil, is called
+// with each item the ShedOldest policy removes, so its producer can be told.
+func New[T any](depth int, policy Policy, shed func(T)) *Queue[T] {
+	if depth < 1 {
+		depth = 1
+	}
+	return &Queue[T]{ch: make(chan T, depth), policy: policy, shed: shed}
+}
+
+// Put adds an item as the policy says when the queue is full. It fails with
+// ErrFull when the item was dropped, and with the context's error when the context
+// ends while blocked.
+func (q *Queue[T]) Put(ctx context.Context, v T) error {
+	select {
+	case q.ch <- v:
+		q.enqueued.Add(1)
+		return nil
+	default:
+	}
+	switch q.policy {
+	case Drop:
+		q.dropped.Add(1)
+		return ErrFull
+	case ShedOldest:
+		for {
+			select {
+			case q.ch <- v:
+				q.enqueued.Add(1)
+				return nil
+			default:
+			}
+			// Another producer may shed or a consumer take the oldest first; then the
+			// send is simply retried.
+			select {
+			case old := <-q.ch:
+				q.shedded.Add(1)
+				if q.shed != nil {
+					q.shed(old)
+				}
+			default:
+			}
+		}
+	}
+	q.blocked.Add(1)
+	select {
+	case q.ch <- v:
+		q.enqueued.Add(1)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Get takes the oldest item, waiting for one until the context ends.
+func (q *Queue[T]) Get(ctx context.Context) (T, error) {
+	select {
+	case v := <-q.ch:
+		return v, nil
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// Len is the number of items waiting.
+func (q *Queue[T]) Len() int { return len(q.ch) }
+
+// Stats returns the queue's counters.
+func (q *Queue[T]) Stats() Stats {
+	return Stats{
+		Depth:    cap(q.ch),
+		Len:      len(q.ch),
+		Enqueued: q.enqueued.Load(),
+		Dropped:  q.dropped.Load(),
+		Shed:     q.shedded.Load(),
+		Blocked:  q.blocked.Load(),
+	}
+}
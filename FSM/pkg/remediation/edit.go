@@ -0,0 +1,112 @@
+package remediation
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"config-validator/pkg/automata"
+)
+
+// Edit applies a finding's fix to the config in place, for editors offering it as a
+// quick fix: the replacement of Length bytes at Offset with Text.
+type Edit struct {
+	Title  string
+	Offset int
+	Length int
+	Text   string
+}
+
+// EditFor returns the edit that applies the fix of f to config. A fix under a block
+// line is inserted at the end of the block, or replaces the finding's line when that
+// line is inside the block (such as a disabled exec-timeout). A global fix is added
+// before the final end, or at the end of the config. It returns false when f has no
+// fix or its line no longer matches the config.
+func EditFor(config []byte, f automata.Finding, opts Options) (Edit, bool) {
+	fix := f.Fix
+	if fix == "" {
+		return Edit{}, false
+	}
+	if opts.NTPServer != "" {
+		fix = strings.ReplaceAll(fix, NTPPlaceholder, opts.NTPServer)
+	}
+	head, body, _ := strings.Cut(fix, "\n")
+	starts := lineStarts(config)
+	line := func(n int) string { // 1-based, without the line break
+		end := len(config)
+		if n < len(starts) {
+			end = starts[n] - 1
+		}
+		return strings.TrimRight(string(config[starts[n-1]:end]), "\r")
+	}
+
+	if f.Line == 0 || body == "" {
+		offset := len(config)
+		for n := len(starts); n >= 1; n-- {
+			text := strings.TrimSpace(line(n))
+			if text == "end" {
+				offset = starts[n-1]
+				break
+			}
+			if text != "" {
+				break
+			}
+		}
+		text := fix + "\n"
+		if offset == len(config) && offset > 0 && config[offset-1] != '\n' {
+			text = "\n" + text
+		}
+		return Edit{Title: fmt.Sprintf("Add '%s'", firstLine(fix)), Offset: offset, Text: text}, true
+	}
+	if f.Line > len(starts) || strings.TrimSpace(line(f.Line)) != f.Command {
+		return Edit{}, false
+	}
+
+	if f.Command != head {
+		// The finding is a line inside the block; the fix's body replaces it
+		end := starts[f.Line-1] + len(line(f.Line))
+		return Edit{
+			Title:  fmt.Sprintf("Replace with '%s'", strings.TrimSpace(firstLine(body))),
+			Offset: starts[f.Line-1],
+			Length: end - starts[f.Line-1],
+			Text:   body,
+		}, true
+	}
+	// The block continues over the indented lines after its head
+	n := f.Line + 1
+	for n <= len(starts) && strings.HasPrefix(line(n), " ") {
+		n++
+	}
+	offset := len(config)
+	if n <= len(starts) {
+		offset = starts[n-1]
+	}
+	text := body + "\n"
+	if offset == len(config) && config[offset-1] != '\n' {
+		text = "\n" + text
+	}
+	return Edit{
+		Title:  fmt.Sprintf("Add '%s' under '%s'", strings.TrimSpace(firstLine(body)), head),
+		Offset: offset,
+		Text:   text,
+	}, true
+}
+
+// lineStarts returns the byte offset of every line of config.
+func lineStarts(config []byte) []int {
+	starts := []int{0}
+	for i := bytes.IndexByte(config, '\n'); i >= 0 && i+1 < len(config); {
+		starts = append(starts, i+1)
+		next := bytes.IndexByte(config[i+1:], '\n')
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return starts
+}
+
+func firstLine(s string) string {
+	first, _, _ := strings.Cut(s, "\n")
+	return first
+}
@@ -0,0 +1,126 @@
+package remediation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"config-validator/pkg/automata"
+)
+
+// NTPPlaceholder stands for the NTP server in fixes until Snippet fills it in.
+const NTPPlaceholder = "<ntp-server>"
+
+var (
+	lineRe        = regexp.MustCompile(`^line (con|vty|aux) .+$`)
+	execTimeoutRe = regexp.MustCompile(`^exec-timeout (\d+)(?: (\d+))?$`)
+	ntpRe         = regexp.MustCompile(`^s?ntp server `)
+)
+
+// Analyzer looks for missing hardening settings that have a known fix: management
+// lines without an idle timeout and, with Global, unencrypted stored passwords and no
+// time source. Its findings are warnings carrying the commands that fix them.
+type Analyzer struct {
+	Findings []automata.Finding
+	// Global also reports the settings a config as a whole lacks. They are a matter
+	// of site policy rather than mistakes in the config, and any finding fails it, so
+	// they are opt-in (see config.Options.Hardening).
+	Global bool
+
+	lines              []*lineBlock
+	current            *lineBlock
+	passwordEncryption bool
+	ntp                bool
+}
+
+type lineBlock struct {
+	line    int
+	text    string
+	timeout string // the exec-timeout line, if any
+	tline   int
+}
+
+// Line feeds one line of the config to the analyzer.
+func (a *Analyzer) Line(originalLine string, lineNum int) {
+	line := strings.TrimSpace(originalLine)
+	if line == "" || strings.HasPrefix(line, "!") {
+		a.current = nil
+		return
+	}
+	if !strings.HasPrefix(originalLine, " ") {
+		a.current = nil
+		switch {
+		case lineRe.MatchString(line):
+			a.current = &lineBlock{line: lineNum, text: line}
+			a.lines = append(a.lines, a.current)
+		case line == "service password-encryption":
+			a.passwordEncryption = true
+		case ntpRe.MatchString(line):
+			a.ntp = true
+		}
+		return
+	}
+	if a.current != nil && execTimeoutRe.MatchString(line) {
+		a.current.timeout, a.current.tline = line, lineNum
+	}
+}
+
+// Finish reports the missing settings with their fixes.
+func (a *Analyzer) Finish() []automata.Finding {
+	for _, b := range a.lines {
+		fix := b.text + "\n exec-timeout 10 0"
+		if b.timeout == "" {
+			a.add(b.line, b.text, "hardening.exec-timeout-missing", fmt.Sprintf("'%s' has no exec-timeout, so idle sessions stay open", b.text), fix)
+			continue
+		}
+		m := execTimeoutRe.FindStringSubmatch(b.timeout)
+		if m[1] == "0" && (m[2] == "" || m[2] == "0") {
+			a.add(b.tline, b.timeout, "hardening.exec-timeout-disabled", fmt.Sprintf("'%s' under '%s' disables the idle timeout", b.timeout, b.text), fix)
+		}
+	}
+	if !a.Global {
+		return a.Findings
+	}
+	if !a.passwordEncryption {
+		a.add(0, "", "hardening.password-encryption", "service password-encryption is not enabled, so type 0 passwords are stored in clear text",
+			"service password-encryption")
+	}
+	if !a.ntp {
+		a.add(0, "", "hardening.ntp", "no NTP server is configured, so log and certificate times cannot be trusted",
+			"ntp server "+NTPPlaceholder)
+	}
+	return a.Findings
+}
+
+func (a *Analyzer) add(lineNum int, line, code, msg, fix string) {
+	a.Findings = append(a.Findings, automata.Finding{
+		Line:     lineNum,
+		Command:  line,
+		State:    "HARDENING",
+		Message:  msg,
+		Severity: automata.SeverityWarning,
+		Fix:      fix,
+		Code:     code,
+	})
+}
+
+// Append adds what other, an analyzer fed the lines after a's on their own, found,
+// with its line numbers moved by shift, as if a had been fed those lines. other is
+// not modified.
+func (a *Analyzer) Append(other *Analyzer, shift int) {
+	for _, b := range other.lines {
+		moved := *b
+		moved.line += shift
+		if moved.timeout != "" {
+			moved.tline += shift
+		}
+		a.lines = append(a.lines, &moved)
+	}
+	a.passwordEncryption = a.passwordEncryption || other.passwordEncryption
+	a.ntp = a.ntp || other.ntp
+	for _, f := range other.Findings {
+		f.Line += shift
+		a.Findings = append(a.Findings, f)
+	}
+	a.current = nil
+}
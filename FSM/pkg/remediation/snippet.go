@@ -0,0 +1,92 @@
+package remediation
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/seal"
+)
+
+// Options fill in the site-specific parts of fixes.
+type Options struct {
+	NTPServer string // replaces NTPPlaceholder when set
+}
+
+// Snippet renders the fixes of findings as a config snippet that can be pasted into
+// configuration mode. Fixes for the same block are merged under one block line, and
+// identical commands are only given once. It returns "" when no finding has a fix.
+func Snippet(name string, findings []automata.Finding, opts Options) string {
+	var order []string
+	blocks := map[string][]string{}
+	for _, f := range findings {
+		if f.Fix == "" {
+			continue
+		}
+		fix := f.Fix
+		if opts.NTPServer != "" {
+			fix = strings.ReplaceAll(fix, NTPPlaceholder, opts.NTPServer)
+		}
+		head, body, _ := strings.Cut(fix, "\n")
+		if _, ok := blocks[head]; !ok {
+			order = append(order, head)
+			blocks[head] = nil
+		}
+		for _, cmd := range strings.Split(body, "\n") {
+			if cmd != "" && !contains(blocks[head], cmd) {
+				blocks[head] = append(blocks[head], cmd)
+			}
+		}
+	}
+	if len(order) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "! Remediation for %s generated by config-validator\n", name)
+	if opts.NTPServer == "" && strings.Contains(strings.Join(order, "\n"), NTPPlaceholder) {
+		fmt.Fprintf(&b, "! Replace %s with your NTP server (or pass -ntp-server) before applying.\n", NTPPlaceholder)
+	}
+	for _, head := range order {
+		b.WriteString(head + "\n")
+		for _, cmd := range blocks[head] {
+			b.WriteString(cmd + "\n")
+		}
+		if len(blocks[head]) > 0 {
+			b.WriteString("!\n")
+		}
+	}
+	b.WriteString("end\n")
+	return b.String()
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// File returns where the remediation snippet for a report goes: next to the report,
+// with its extension replaced by .remediation.cfg.
+func File(reportFile string) string {
+	return strings.TrimSuffix(reportFile, filepath.Ext(reportFile)) + ".remediation.cfg"
+}
+
+// Write writes the snippet for findings to file, sealed with sealer when it is set, as
+// the report next to it is. When nothing needs fixing, a snippet left by an earlier
+// run is removed instead. It reports whether a snippet was written.
+func Write(file, name string, findings []automata.Finding, opts Options, sealer *seal.Sealer) (bool, error) {
+	snippet := Snippet(name, findings, opts)
+	if snippet == "" {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+		return false, nil
+	}
+	return true, sealer.WriteFile(file, []byte(snippet), 0644)
+}
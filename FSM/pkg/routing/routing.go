@@ -0,0 +1,233 @@
+package routing
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strings"
+
+	"config-validator/pkg/automata"
+)
+
+var (
+	routerRe       = regexp.MustCompile(`^router (ospf|bgp|eigrp) (\S+)`)
+	networkRe      = regexp.MustCompile(`^network (\S+)(?: (\S+))?(?: area \S+)?$`)
+	routerIDRe     = regexp.MustCompile(`^(?:bgp |eigrp )?router-id (\S+)$`)
+	redistributeRe = regexp.MustCompile(`^redistribute \S+`)
+	neighborRe     = regexp.MustCompile(`^neighbor (\S+) (\S+)(?: (\S+))?`)
+)
+
+// Analyzer checks OSPF, EIGRP, and BGP configuration for consistency with itself and
+// with the interface addressing: network statements that cover no interface, BGP
+// neighbors without a remote-as, duplicate router-ids, and redistribution without a
+// route-map.
+type Analyzer struct {
+	Findings []automata.Finding
+
+	process   *process
+	processes []*process
+}
+
+type process struct {
+	protocol  string // ospf, bgp, or eigrp
+	id        string
+	line      int
+	routerID  statement
+	networks  []statement
+	neighbors map[string]*neighbor
+	order     []string // neighbor addresses and peer-groups in order of appearance
+}
+
+type neighbor struct {
+	first     statement
+	remoteAs  bool
+	peerGroup string
+	isGroup   bool // declared with `neighbor NAME peer-group`
+}
+
+type statement struct {
+	line int
+	text string
+	args []string
+}
+
+// Line feeds one line of the config to the analyzer.
+func (a *Analyzer) Line(originalLine string, lineNum int) {
+	line := strings.TrimSpace(originalLine)
+	if line == "" || strings.HasPrefix(line, "!") {
+		a.process = nil
+		return
+	}
+	if !strings.HasPrefix(originalLine, " ") {
+		a.process = nil
+		if m := routerRe.FindStringSubmatch(line); m != nil {
+			a.process = &process{protocol: m[1], id: m[2], line: lineNum, neighbors: map[string]*neighbor{}}
+			a.processes = append(a.processes, a.process)
+		}
+		return
+	}
+	p := a.process
+	if p == nil {
+		return
+	}
+	// BGP address-family blocks are indented further but still belong to the process.
+	line = strings.TrimPrefix(line, "address-family ")
+
+	switch {
+	case routerIDRe.MatchString(line):
+		m := routerIDRe.FindStringSubmatch(line)
+		p.routerID = statement{lineNum, line, m[1:]}
+	case p.protocol != "bgp" && networkRe.MatchString(line):
+		m := networkRe.FindStringSubmatch(line)
+		p.networks = append(p.networks, statement{lineNum, line, m[1:]})
+	case redistributeRe.MatchString(line):
+		if !strings.Contains(line, " route-map ") {
+			a.add(lineNum, line, "routing.redistribute-no-route-map", fmt.Sprintf("%s: '%s' has no route-map, so every route is redistributed", p.name(), line))
+		}
+	case p.protocol == "bgp" && neighborRe.MatchString(line):
+		m := neighborRe.FindStringSubmatch(line)
+		n, ok := p.neighbors[m[1]]
+		if !ok {
+			n = &neighbor{first: statement{lineNum, line, m[1:]}}
+			p.neighbors[m[1]] = n
+			p.order = append(p.order, m[1])
+		}
+		switch {
+		case m[2] == "remote-as":
+			n.remoteAs = true
+		case m[2] == "peer-group" && m[3] == "":
+			n.isGroup = true
+		case m[2] == "peer-group":
+			n.peerGroup = m[3]
+		}
+	}
+}
+
+// Finish runs the checks over the whole config; interfaces are the interface
+// addresses with their prefix lengths, as collected by the addressing pass.
+func (a *Analyzer) Finish(interfaces []netip.Prefix) []automata.Finding {
+	routerIDs := map[string]*process{}
+	for _, p := range a.processes {
+		if p.routerID.text != "" {
+			a.checkRouterID(p, routerIDs)
+		}
+		for _, n := range p.networks {
+			a.checkNetwork(p, n, interfaces)
+		}
+		for _, name := range p.order {
+			n := p.neighbors[name]
+			if n.isGroup || n.remoteAs {
+				continue
+			}
+			if group, ok := p.neighbors[n.peerGroup]; ok && group.remoteAs {
+				continue
+			}
+			a.add(n.first.line, n.first.text, "routing.neighbor-no-remote-as", fmt.Sprintf("%s: neighbor %s has no remote-as (directly or through a peer-group)", p.name(), name))
+		}
+	}
+	sort.SliceStable(a.Findings, func(i, j int) bool { return a.Findings[i].Line < a.Findings[j].Line })
+	return a.Findings
+}
+
+func (a *Analyzer) checkRouterID(p *process, seen map[string]*process) {
+	id := p.routerID.args[0]
+	addr, err := netip.ParseAddr(id)
+	if err != nil || !addr.Is4() {
+		a.add(p.routerID.line, p.routerID.text, "routing.router-id-invalid", fmt.Sprintf("%s: router-id %s is not a valid IPv4 address", p.name(), id))
+		return
+	}
+	// The same ID on two processes of one protocol breaks adjacency and path selection;
+	// sharing it between OSPF and BGP is normal.
+	key := p.protocol + " " + id
+	if other, ok := seen[key]; ok {
+		a.add(p.routerID.line, p.routerID.text, "routing.router-id-duplicate", fmt.Sprintf("%s: router-id %s duplicates %s (line %d)", p.name(), id, other.name(), other.routerID.line))
+		return
+	}
+	seen[key] = p
+}
+
+func (a *Analyzer) checkNetwork(p *process, n statement, interfaces []netip.Prefix) {
+	addr, err := netip.ParseAddr(n.args[0])
+	if err != nil || !addr.Is4() {
+		return // reported by the addressing pass
+	}
+	wildcard := classfulWildcard(addr)
+	if n.args[1] != "" {
+		if wildcard, err = netip.ParseAddr(n.args[1]); err != nil || !wildcard.Is4() {
+			return
+		}
+	}
+	for _, iface := range interfaces {
+		if matches(iface.Addr(), addr, wildcard) {
+			return
+		}
+	}
+	a.add(n.line, n.text, "routing.network-unused", fmt.Sprintf("%s: network %s %s covers no interface address", p.name(), addr, wildcard))
+}
+
+// matches reports whether addr equals network on every bit not set in wildcard.
+func matches(addr, network, wildcard netip.Addr) bool {
+	x, n, w := addr.As4(), network.As4(), wildcard.As4()
+	for i := range x {
+		if x[i]&^w[i] != n[i]&^w[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// classfulWildcard is the wildcard EIGRP (and RIP) assume when a network statement has none.
+func classfulWildcard(addr netip.Addr) netip.Addr {
+	switch b := addr.As4()[0]; {
+	case b < 128:
+		return netip.AddrFrom4([4]byte{0, 255, 255, 255})
+	case b < 192:
+		return netip.AddrFrom4([4]byte{0, 0, 255, 255})
+	default:
+		return netip.AddrFrom4([4]byte{0, 0, 0, 255})
+	}
+}
+
+func (p *process) name() string {
+	return "router " + p.protocol + " " + p.id
+}
+
+func (a *Analyzer) add(lineNum int, line, code, msg string) {
+	a.Findings = append(a.Findings, automata.Finding{
+		Line:     lineNum,
+		Command:  line,
+		State:    "ROUTING",
+		Message:  msg,
+		Severity: automata.SeverityWarning,
+		Code:     code,
+	})
+}
+
+// Append adds the processes of other, an analyzer fed the lines after a's on their
+// own, with their line numbers moved by shift, as if a had been fed those lines.
+// other is not modified.
+func (a *Analyzer) Append(other *Analyzer, shift int) {
+	for _, p := range other.processes {
+		moved := *p
+		moved.line += shift
+		moved.routerID.line += shift
+		moved.networks = make([]statement, len(p.networks))
+		for i, n := range p.networks {
+			n.line += shift
+			moved.networks[i] = n
+		}
+		moved.neighbors = make(map[string]*neighbor, len(p.neighbors))
+		for name, n := range p.neighbors {
+			m := *n
+			m.first.line += shift
+			moved.neighbors[name] = &m
+		}
+		a.processes = append(a.processes, &moved)
+	}
+	for _, f := range other.Findings {
+		f.Line += shift
+		a.Findings = append(a.Findings, f)
+	}
+	a.process = nil
+}
@@ -0,0 +1,375 @@
+// Package rtspcheck validates RTSP (RFC 2326 and RFC 7826) streams: the framing of
+// the requests and responses each side sends, interleaved binary data, the CSeq
+// numbers that pair responses with requests, and the Session a server hands out in
+// reply to SETUP. Bodies, such as the SDP a DESCRIBE returns, are validated by their
+// media type.
+package rtspcheck
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/httpbody"
+	"config-validator/pkg/httpmsg"
+	"config-validator/pkg/mediatype"
+)
+
+// State is the state reported in RTSP findings.
+const State = "RTSP"
+
+// Port is the well-known RTSP port.
+const Port = 554
+
+// Message is a request or response of an RTSP stream.
+type Message struct {
+	Line    int // line its start line is on, counting from the start of the stream
+	Request bool
+	Method  string
+	URI     string
+	Status  int
+	Version string
+	Headers []httpmsg.Header
+	Body    []byte
+	CSeq    int // -1 when missing or malformed
+}
+
+// Get returns the first header field with the name, ignoring case.
+func (m *Message) Get(name string) (httpmsg.Header, bool) {
+	for _, h := range m.Headers {
+		if strings.EqualFold(h.Name, name) {
+			return h, true
+		}
+	}
+	return httpmsg.Header{}, false
+}
+
+// Methods are the methods of RTSP 1.0 and 2.0.
+var Methods = map[string]bool{
+	"DESCRIBE": true, "ANNOUNCE": true, "GET_PARAMETER": true, "OPTIONS": true, "PAUSE": true, "PLAY": true,
+	"PLAY_NOTIFY": true, "RECORD": true, "REDIRECT": true, "SETUP": true, "SET_PARAMETER": true, "TEARDOWN": true,
+}
+
+// sessionMethods are the methods that act on a session SETUP created.
+var sessionMethods = map[string]bool{"PLAY": true, "PAUSE": true, "RECORD": true, "TEARDOWN": true}
+
+var (
+	requestRe = regexp.MustCompile(`^([A-Z_]+) (\S+) (RTSP/\d\.\d)$`)
+	statusRe  = regexp.MustCompile(`^(RTSP/\d\.\d) (\d{3}) ?(.*)$`)
+	headerRe  = regexp.MustCompile("^([!#$%&'*+.^_`|~0-9A-Za-z-]+):[ \t]*(.*?)[ \t]*$")
+)
+
+// parser splits a stream into messages.
+type parser struct {
+	data     []byte
+	pos      int
+	line     int
+	findings []automata.Finding
+}
+
+func (p *parser) add(line int, command, severity, msg string) {
+	p.findings = append(p.findings, automata.Finding{Line: line, Command: command, State: State, Message: msg, Severity: severity})
+}
+
+// next returns the next line without its line ending, and false when the stream
+// ends before a line ending.
+func (p *parser) next() (string, bool) {
+	i := bytes.IndexByte(p.data[p.pos:], '\n')
+	if i < 0 {
+		return "", false
+	}
+	line := p.data[p.pos : p.pos+i]
+	p.pos += i + 1
+	p.line++
+	if !bytes.HasSuffix(line, []byte("\r")) {
+		p.add(p.line, excerpt(string(line)), automata.SeverityError, "line ends in LF without CR")
+	}
+	return string(bytes.TrimSuffix(line, []byte("\r"))), true
+}
+
+// Parse splits what one side of a connection sent into messages, checking their
+// framing. Interleaved binary data ('$', a channel, and a 16-bit length) between
+// messages is skipped.
+func Parse(data []byte) ([]Message, []automata.Finding) {
+	p := &parser{data: data}
+	var msgs []Message
+	for p.pos < len(data) {
+		if data[p.pos] == '$' {
+			if len(data)-p.pos < 4 {
+				p.add(p.line+1, "$", automata.SeverityWarning, "stream ends in an interleaved frame header")
+				break
+			}
+			n := int(data[p.pos+2])<<8 | int(data[p.pos+3])
+			if len(data)-p.pos-4 < n {
+				p.add(p.line+1, "$", automata.SeverityWarning, fmt.Sprintf("stream ends in an interleaved frame of %d bytes", n))
+				break
+			}
+			p.line += bytes.Count(data[p.pos:p.pos+4+n], []byte("\n"))
+			p.pos += 4 + n
+			continue
+		}
+		m, ok := p.message()
+		if !ok {
+			break
+		}
+		if m != nil {
+			msgs = append(msgs, *m)
+		}
+	}
+	return msgs, p.findings
+}
+
+// message reads one message. It returns nil for lines that start no message, and
+// false when the stream ends in the middle of one.
+func (p *parser) message() (*Message, bool) {
+	start, ok := p.next()
+	if !ok {
+		p.add(p.line+1, excerpt(string(p.data[p.pos:])), automata.SeverityWarning, "stream ends in the middle of a line")
+		return nil, false
+	}
+	if start == "" {
+		return nil, true // CRLF between messages is tolerated
+	}
+	m := &Message{Line: p.line, CSeq: -1}
+	if sm := statusRe.FindStringSubmatch(start); sm != nil {
+		m.Version = sm[1]
+		m.Status, _ = strconv.Atoi(sm[2])
+		if m.Status < 100 || m.Status > 599 {
+			p.add(p.line, start, automata.SeverityError, fmt.Sprintf("status %d is not in the range 100-599", m.Status))
+		}
+	} else if rm := requestRe.FindStringSubmatch(start); rm != nil {
+		m.Request, m.Method, m.URI, m.Version = true, rm[1], rm[2], rm[3]
+		if !Methods[m.Method] {
+			p.add(p.line, m.Method, automata.SeverityWarning, "unknown method "+m.Method)
+		}
+		if m.URI != "*" && !strings.Contains(m.URI, "://") {
+			p.add(p.line, m.URI, automata.SeverityError, "request URI must be absolute (rtsp://...) or *")
+		}
+	} else {
+		p.add(p.line, excerpt(start), automata.SeverityError, "line is neither an RTSP request line (METHOD SP URI SP RTSP/x.y) nor a status line")
+		for {
+			// skip the rest of what is taken to be a header block
+			line, ok := p.next()
+			if !ok || line == "" {
+				return nil, ok
+			}
+		}
+	}
+	if m.Version != "RTSP/1.0" && m.Version != "RTSP/2.0" {
+		p.add(p.line, m.Version, automata.SeverityError, "version "+m.Version+" is not RTSP/1.0 or RTSP/2.0")
+	}
+	for {
+		line, ok := p.next()
+		if !ok {
+			p.add(p.line+1, "", automata.SeverityWarning, "stream ends in the middle of the header")
+			return nil, false
+		}
+		if line == "" {
+			break
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if len(m.Headers) == 0 {
+				p.add(p.line, excerpt(line), automata.SeverityError, "continuation line before any header field")
+				continue
+			}
+			if m.Version == "RTSP/2.0" {
+				p.add(p.line, excerpt(line), automata.SeverityError, "RTSP/2.0 does not allow header fields folded over lines")
+			}
+			m.Headers[len(m.Headers)-1].Value += " " + strings.TrimSpace(line)
+			continue
+		}
+		hm := headerRe.FindStringSubmatch(line)
+		if hm == nil {
+			p.add(p.line, excerpt(line), automata.SeverityError, "header field must be name: value")
+			continue
+		}
+		m.Headers = append(m.Headers, httpmsg.Header{Name: hm[1], Value: hm[2], Line: p.line})
+	}
+	p.cseq(m)
+	p.body(m)
+	return m, true
+}
+
+// cseq reads the message's CSeq, which every request and response carries.
+func (p *parser) cseq(m *Message) {
+	var cseqs []httpmsg.Header
+	for _, h := range m.Headers {
+		if strings.EqualFold(h.Name, "CSeq") {
+			cseqs = append(cseqs, h)
+		}
+	}
+	switch {
+	case len(cseqs) == 0:
+		p.add(m.Line, "CSeq", automata.SeverityError, "message has no CSeq header field")
+		return
+	case len(cseqs) > 1:
+		p.add(cseqs[1].Line, "CSeq", automata.SeverityError, "message has more than one CSeq header field")
+	}
+	n, err := strconv.ParseUint(cseqs[0].Value, 10, 31)
+	if err != nil {
+		p.add(cseqs[0].Line, "CSeq: "+cseqs[0].Value, automata.SeverityError, "CSeq must be a number")
+		return
+	}
+	m.CSeq = int(n)
+}
+
+// body reads the body Content-Length gives, and validates it by its Content-Type.
+func (p *parser) body(m *Message) {
+	h, ok := m.Get("Content-Length")
+	if !ok {
+		return // no body
+	}
+	n, err := strconv.Atoi(h.Value)
+	if err != nil || n < 0 {
+		p.add(h.Line, "Content-Length: "+h.Value, automata.SeverityError, "Content-Length must be a non-negative number")
+		return
+	}
+	if len(p.data)-p.pos < n {
+		p.add(h.Line, "Content-Length: "+h.Value, automata.SeverityWarning, fmt.Sprintf("stream ends after %d of the body's %d bytes", len(p.data)-p.pos, n))
+		n = len(p.data) - p.pos
+	}
+	m.Body = p.data[p.pos : p.pos+n]
+	bodyLine := p.line + 1
+	p.pos += n
+	p.line += bytes.Count(m.Body, []byte("\n"))
+	if n == 0 {
+		return
+	}
+	ct, ok := m.Get("Content-Type")
+	if !ok {
+		p.add(m.Line, "Content-Type", automata.SeverityError, "message has a body but no Content-Type")
+		return
+	}
+	mt, findings := mediatype.Parse(ct.Value, ct.Line)
+	p.findings = append(p.findings, findings...)
+	p.findings = append(p.findings, httpbody.Check(mt, m.Body, bodyLine)...)
+}
+
+// Pair checks the requests of each side against the responses of the other: each
+// side numbers its requests with CSeq one after another, and each response carries
+// the CSeq of a request it answers. It also follows the session SETUP creates.
+func Pair(client, server []Message) (clientFindings, serverFindings []automata.Finding) {
+	clientFindings, serverFindings = sequence(client), sequence(server)
+	requests, responses := answer(client, server)
+	clientFindings, serverFindings = append(clientFindings, requests...), append(serverFindings, responses...)
+	requests, responses = answer(server, client)
+	serverFindings, clientFindings = append(serverFindings, requests...), append(clientFindings, responses...)
+	requests, responses = sessions(client, server)
+	return append(clientFindings, requests...), append(serverFindings, responses...)
+}
+
+func finding(line int, command, severity, msg string) automata.Finding {
+	return automata.Finding{Line: line, Command: command, State: State, Message: msg, Severity: severity}
+}
+
+// sequence checks that the CSeq of a side's requests go up by one.
+func sequence(msgs []Message) []automata.Finding {
+	var findings []automata.Finding
+	last := -1
+	for _, m := range msgs {
+		if !m.Request || m.CSeq < 0 {
+			continue
+		}
+		cmd := fmt.Sprintf("%s CSeq %d", m.Method, m.CSeq)
+		switch {
+		case last < 0:
+		case m.CSeq == last:
+			findings = append(findings, finding(m.Line, cmd, automata.SeverityError, fmt.Sprintf("CSeq %d is reused by another request", m.CSeq)))
+		case m.CSeq < last:
+			findings = append(findings, finding(m.Line, cmd, automata.SeverityError, fmt.Sprintf("CSeq %d goes back from %d", m.CSeq, last)))
+		case m.CSeq != last+1:
+			findings = append(findings, finding(m.Line, cmd, automata.SeverityWarning, fmt.Sprintf("CSeq %d skips from %d; each request should increment it by one", m.CSeq, last)))
+		}
+		last = m.CSeq
+	}
+	return findings
+}
+
+// answer checks the responses one side sent to the requests of the other, returning
+// findings about the requests never answered and about the responses. A side that
+// sent nothing is taken as not captured.
+func answer(requests, responses []Message) (unanswered, findings []automata.Finding) {
+	open := map[int]*Message{}
+	for i := range requests {
+		if m := &requests[i]; m.Request && m.CSeq >= 0 {
+			open[m.CSeq] = m
+		}
+	}
+	if len(responses) == 0 {
+		return nil, nil
+	}
+	for _, r := range responses {
+		if r.Request || r.CSeq < 0 {
+			continue
+		}
+		req := open[r.CSeq]
+		cmd := fmt.Sprintf("%d CSeq %d", r.Status, r.CSeq)
+		switch {
+		case req == nil:
+			findings = append(findings, finding(r.Line, cmd, automata.SeverityError, fmt.Sprintf("response with CSeq %d, which no unanswered request carries", r.CSeq)))
+			continue
+		case r.Version != req.Version:
+			findings = append(findings, finding(r.Line, cmd, automata.SeverityError, fmt.Sprintf("response is %s, but the request was %s", r.Version, req.Version)))
+		}
+		if r.Status >= 200 {
+			delete(open, r.CSeq)
+		}
+	}
+	for i := range requests {
+		if m := &requests[i]; m.Request && m.CSeq >= 0 && open[m.CSeq] == m {
+			unanswered = append(unanswered, finding(m.Line, fmt.Sprintf("%s CSeq %d", m.Method, m.CSeq), automata.SeverityWarning, m.Method+" has no final response"))
+		}
+	}
+	return unanswered, findings
+}
+
+// sessions checks that requests acting on a session carry the Session a successful
+// SETUP response gave, and that such responses give one. It returns the findings
+// about the client's requests and the server's responses.
+func sessions(client, server []Message) (findings, responses []automata.Finding) {
+	setups := map[int]bool{}
+	ids := map[string]bool{}
+	for _, m := range client {
+		if m.Request && m.Method == "SETUP" {
+			setups[m.CSeq] = true
+			if _, ok := m.Get("Transport"); !ok {
+				findings = append(findings, finding(m.Line, "SETUP", automata.SeverityError, "SETUP has no Transport header field"))
+			}
+		}
+	}
+	for _, r := range server {
+		if r.Request || r.Status < 200 || r.Status >= 300 || !setups[r.CSeq] {
+			continue
+		}
+		if h, ok := r.Get("Session"); ok {
+			id, _, _ := strings.Cut(h.Value, ";")
+			ids[strings.TrimSpace(id)] = true
+		} else {
+			responses = append(responses, finding(r.Line, "SETUP", automata.SeverityError, "successful SETUP response has no Session header field"))
+		}
+	}
+	for _, m := range client {
+		if !m.Request || !sessionMethods[m.Method] {
+			continue
+		}
+		h, ok := m.Get("Session")
+		id, _, _ := strings.Cut(h.Value, ";")
+		switch {
+		case !ok:
+			findings = append(findings, finding(m.Line, m.Method, automata.SeverityError, m.Method+" has no Session header field"))
+		case len(ids) > 0 && !ids[strings.TrimSpace(id)]:
+			findings = append(findings, finding(h.Line, "Session: "+h.Value, automata.SeverityError, "session "+strings.TrimSpace(id)+" was not given by a SETUP response"))
+		}
+	}
+	return findings, responses
+}
+
+func excerpt(s string) string {
+	if len(s) > 60 {
+		return s[:57] + "..."
+	}
+	return s
+}
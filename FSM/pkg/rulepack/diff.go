@@ -0,0 +1,252 @@
+package rulepack
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"config-validator/pkg/automata"
+)
+
+// Change is a difference between two versions of a pack: a rule of a state added,
+// removed, or changed, or a file the rules use (a script, a wasm module) added,
+// removed, or changed.
+type Change struct {
+	File    string // relative to the pack root
+	State   string // empty for a file change
+	Pattern string
+	Kind    string // added, removed, or changed
+	Detail  string // what changed, for a changed rule
+}
+
+func (c Change) String() string {
+	sign := map[string]string{"added": "+", "removed": "-", "changed": "~"}[c.Kind]
+	if c.State == "" && c.Detail != "" {
+		return fmt.Sprintf("%s %s (%s)", sign, c.File, c.Detail)
+	}
+	if c.State == "" {
+		return fmt.Sprintf("%s %s (%s)", sign, c.File, c.Kind)
+	}
+	s := fmt.Sprintf("%s %s [%s] %s", sign, c.File, c.State, c.Pattern)
+	if c.Detail != "" {
+		s += " (" + c.Detail + ")"
+	}
+	return s
+}
+
+// Diff compares two versions of a pack, given the directories their rules.yaml is
+// in. Rules are compared as they load, extends resolved, in rules.yaml and each role
+// file; other files are compared byte for byte.
+func Diff(oldRoot, newRoot string) ([]Change, error) {
+	var changes []Change
+	oldFiles, err := packFiles(oldRoot)
+	if err != nil {
+		return nil, err
+	}
+	newFiles, err := packFiles(newRoot)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range union(oldFiles, newFiles) {
+		_, inOld := oldFiles[file]
+		_, inNew := newFiles[file]
+		if isRulesFile(file) {
+			before, err := loadIf(oldRoot, file, inOld)
+			if err != nil {
+				return nil, err
+			}
+			after, err := loadIf(newRoot, file, inNew)
+			if err != nil {
+				return nil, err
+			}
+			if detail := linesDetail(before.Lines, after.Lines); inOld && inNew && detail != "" {
+				changes = append(changes, Change{File: file, Kind: "changed", Detail: detail})
+			}
+			changes = append(changes, diffRules(file, before.Rules, after.Rules)...)
+			continue
+		}
+		switch {
+		case !inOld:
+			changes = append(changes, Change{File: file, Kind: "added"})
+		case !inNew:
+			changes = append(changes, Change{File: file, Kind: "removed"})
+		case !bytes.Equal(oldFiles[file], newFiles[file]):
+			changes = append(changes, Change{File: file, Kind: "changed"})
+		}
+	}
+	return changes, nil
+}
+
+// packFiles reads the files of a pack by their slash path relative to its root,
+// leaving out what the cache stores next to them.
+func packFiles(root string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		rel = filepath.ToSlash(rel)
+		switch {
+		case d.IsDir() && rel == "pack.d":
+			return filepath.SkipDir
+		case d.IsDir() || rel == "pack" || rel == "pack.sig" || rel == "meta.json":
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		files[rel] = data
+		return err
+	})
+	return files, err
+}
+
+func isRulesFile(file string) bool {
+	return file == "rules.yaml" || (strings.HasPrefix(file, "roles/") && strings.HasSuffix(file, ".yaml") && !strings.Contains(file[len("roles/"):], "/"))
+}
+
+// loadIf loads a rules file of a pack, with script and wasm references relative to
+// its root, or an empty one when the pack does not have the file.
+func loadIf(root, file string, ok bool) (*automata.RuleFile, error) {
+	if !ok {
+		return &automata.RuleFile{}, nil
+	}
+	rf, err := automata.LoadRuleFile(filepath.Join(root, filepath.FromSlash(file)))
+	if err != nil {
+		return nil, err
+	}
+	for _, rs := range rf.Rules {
+		for i := range rs {
+			rs[i].Script = relativeRef(rs[i].Script, root)
+			rs[i].Wasm = relativeRef(rs[i].Wasm, root)
+		}
+	}
+	return rf, nil
+}
+
+// linesDetail describes how the handling of comment, blank, and continued lines
+// changed, or returns "".
+func linesDetail(old, l automata.LineHandling) string {
+	var details []string
+	for _, f := range []struct{ name, a, b string }{
+		{"comments", old.Comments, l.Comments},
+		{"blank_lines", old.BlankLines, l.BlankLines},
+	} {
+		a, b := f.a, f.b
+		if a == "" {
+			a = automata.LinesReset
+		}
+		if b == "" {
+			b = automata.LinesReset
+		}
+		if a != b {
+			details = append(details, fmt.Sprintf("%s %s → %s", f.name, a, b))
+		}
+	}
+	if old.Continuation != l.Continuation {
+		details = append(details, fmt.Sprintf("continuation %q → %q", old.Continuation, l.Continuation))
+	}
+	if old.Negations != l.Negations {
+		details = append(details, fmt.Sprintf("negations %q → %q", old.Negations, l.Negations))
+	}
+	if old.WrapWidth != l.WrapWidth {
+		details = append(details, fmt.Sprintf("wrap_width %d → %d", old.WrapWidth, l.WrapWidth))
+	}
+	return strings.Join(details, ", ")
+}
+
+func relativeRef(ref, root string) string {
+	file, name, ok := strings.Cut(ref, ":")
+	if !ok || !filepath.IsAbs(file) {
+		return ref
+	}
+	if rel, err := filepath.Rel(root, file); err == nil {
+		file = filepath.ToSlash(rel)
+	}
+	return file + ":" + name
+}
+
+// diffRules compares the rules of each state, matching rules by their pattern.
+func diffRules(file string, oldRules, newRules map[string][]automata.Rule) []Change {
+	var changes []Change
+	states := map[string]bool{}
+	for s := range oldRules {
+		states[s] = true
+	}
+	for s := range newRules {
+		states[s] = true
+	}
+	for state := range states {
+		before := map[string]automata.Rule{}
+		for _, r := range oldRules[state] {
+			before[ruleName(r)] = r
+		}
+		after := map[string]automata.Rule{}
+		for _, r := range newRules[state] {
+			after[ruleName(r)] = r
+			old, ok := before[ruleName(r)]
+			if !ok {
+				changes = append(changes, Change{File: file, State: state, Pattern: ruleName(r), Kind: "added"})
+			} else if detail := ruleDetail(old, r); detail != "" {
+				changes = append(changes, Change{File: file, State: state, Pattern: ruleName(r), Kind: "changed", Detail: detail})
+			}
+		}
+		for _, r := range oldRules[state] {
+			if _, ok := after[ruleName(r)]; !ok {
+				changes = append(changes, Change{File: file, State: state, Pattern: ruleName(r), Kind: "removed"})
+			}
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].State != changes[j].State {
+			return changes[i].State < changes[j].State
+		}
+		return changes[i].Pattern < changes[j].Pattern
+	})
+	return changes
+}
+
+// ruleName is the pattern of a rule, or for the fallback entry of a state, the state
+// it falls back to.
+func ruleName(r automata.Rule) string {
+	if r.Fallback != "" {
+		return "fallback to " + r.Fallback
+	}
+	return r.Pattern
+}
+
+// ruleDetail describes how a rule with the same pattern changed, or returns "".
+func ruleDetail(old, r automata.Rule) string {
+	var details []string
+	field := func(name, a, b string) {
+		if a != b {
+			details = append(details, fmt.Sprintf("%s %q → %q", name, a, b))
+		}
+	}
+	field("next", old.Next, r.Next)
+	field("script", old.Script, r.Script)
+	field("wasm", old.Wasm, r.Wasm)
+	field("deprecated", old.Deprecated, r.Deprecated)
+	field("replaced_by", old.ReplacedBy, r.ReplacedBy)
+	if old.Weight != r.Weight {
+		details = append(details, fmt.Sprintf("weight %d → %d", old.Weight, r.Weight))
+	}
+	return strings.Join(details, ", ")
+}
+
+func union(a, b map[string][]byte) []string {
+	var keys []string
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
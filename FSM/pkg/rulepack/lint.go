@@ -0,0 +1,118 @@
+package rulepack
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"config-validator/pkg/automata"
+)
+
+// Issue is a problem Lint finds in a pack. State and Pattern are empty for one about
+// the pack as a whole.
+type Issue struct {
+	File     string
+	State    string
+	Pattern  string
+	Severity string // automata.SeverityError or automata.SeverityWarning
+	Message  string
+}
+
+func (i Issue) String() string {
+	if i.Pattern == "" {
+		return fmt.Sprintf("%s: %s", i.File, i.Message)
+	}
+	return fmt.Sprintf("%s [%s] '%s': %s", i.File, i.State, i.Pattern, i.Message)
+}
+
+// Lint checks a pack: its rules file, the role files next to it, and every file they
+// extend. The files must be written for the same schema, and the version metadata
+// of the rules must hold together: a replacement is a rule of the same state that is
+// not deprecated itself, and no rule is deprecated before it was added.
+func Lint(rulesFile string) ([]Issue, error) {
+	roles, _ := filepath.Glob(filepath.Join(filepath.Dir(rulesFile), "roles", "*.yaml"))
+	var issues []Issue
+	seen := map[string]bool{}
+	schemas := map[string]int{}
+	var files []string
+	for _, file := range append([]string{rulesFile}, roles...) {
+		rules, sources, err := automata.LoadRulesSources(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, source := range sources {
+			if _, ok := schemas[source]; ok {
+				continue
+			}
+			if schemas[source], err = automata.Schema(source); err != nil {
+				return nil, err
+			}
+			files = append(files, source)
+		}
+		for _, issue := range lintRules(rules) {
+			issue.File = file
+			if key := issue.State + "\x00" + issue.Pattern + "\x00" + issue.Message; !seen[key] {
+				seen[key] = true // role files repeat the issues of the rules they inherit
+				issues = append(issues, issue)
+			}
+		}
+	}
+
+	var mixed []string
+	for _, file := range files {
+		if schemas[file] != schemas[files[0]] {
+			mixed = files
+			break
+		}
+	}
+	if mixed != nil {
+		root, _ := filepath.Abs(filepath.Dir(rulesFile))
+		var parts []string
+		for _, file := range mixed {
+			rel, err := filepath.Rel(root, file)
+			if err != nil {
+				rel = file
+			}
+			parts = append(parts, fmt.Sprintf("%s is %d", rel, schemas[file]))
+		}
+		issues = append([]Issue{{File: rulesFile, Severity: automata.SeverityError,
+			Message: "the pack mixes rules schemas: " + strings.Join(parts, ", ")}}, issues...)
+	}
+	return issues, nil
+}
+
+// lintRules checks the version metadata of the rules of one rules file.
+func lintRules(rules map[string][]automata.Rule) []Issue {
+	var issues []Issue
+	states := make([]string, 0, len(rules))
+	for state := range rules {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+	for _, state := range states {
+		byPattern := map[string]automata.Rule{}
+		for _, r := range rules[state] {
+			byPattern[r.Pattern] = r
+		}
+		for _, r := range rules[state] {
+			add := func(severity, format string, args ...any) {
+				issues = append(issues, Issue{State: state, Pattern: r.Pattern, Severity: severity, Message: fmt.Sprintf(format, args...)})
+			}
+			if r.ReplacedBy != "" {
+				switch replacement, ok := byPattern[r.ReplacedBy]; {
+				case !ok:
+					add(automata.SeverityError, "replaced_by '%s' is not a rule of state %s", r.ReplacedBy, state)
+				case r.ReplacedBy == r.Pattern:
+					add(automata.SeverityError, "the rule is replaced by itself")
+				case replacement.Deprecated != "":
+					add(automata.SeverityWarning, "replaced_by '%s' is deprecated as well", r.ReplacedBy)
+				}
+			}
+			if r.Since != "" && r.Deprecated != "" && r.Deprecated != "true" && CompareVersions(r.Deprecated, r.Since) < 0 {
+				add(automata.SeverityError, "deprecated in %s, before it was added in %s", r.Deprecated, r.Since)
+			}
+		}
+	}
+	return issues
+}
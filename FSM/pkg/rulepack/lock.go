@@ -0,0 +1,181 @@
+package rulepack
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Packs installed from a registry live in a pack directory, one directory per pack
+// and version, and a lockfile records which version of each is in use:
+//
+//	registry: https://rules.example.com/index.yaml
+//	packs:
+//	  - name: cisco-ios
+//	    pin: "3"          # stay on 3.x; empty for the latest release
+//	    version: 3.2.0
+//	    url: https://rules.example.com/cisco-ios/3.2.0/rules.tgz
+//	    sha256: 9f2c...
+//	    previous: {version: 3.1.4, url: ..., sha256: ...}
+//
+// The version in use and the one before it are kept, so an update can be rolled
+// back. -rules pack:<name> names the version in use.
+
+// LockFileName is the lockfile of a pack directory.
+const LockFileName = "rules.lock"
+
+// PackPrefix starts a -rules reference to an installed pack.
+const PackPrefix = "pack:"
+
+// Lock is the lockfile of a pack directory.
+type Lock struct {
+	Registry string   `yaml:"registry,omitempty"`
+	Packs    []Locked `yaml:"packs"`
+}
+
+// Locked is a pack of a lockfile: its pin, the release in use, and the release it
+// replaced.
+type Locked struct {
+	Name     string `yaml:"name"`
+	Pin      string `yaml:"pin,omitempty"`
+	Release  `yaml:",inline"`
+	Previous *Release `yaml:"previous,omitempty"`
+}
+
+// DefaultPackDir returns $CONFIG_VALIDATOR_PACKS, or config-validator/packs in the
+// user config directory.
+func DefaultPackDir() string {
+	if dir := os.Getenv("CONFIG_VALIDATOR_PACKS"); dir != "" {
+		return dir
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "config-validator", "packs")
+	}
+	return filepath.Join(dir, "config-validator", "packs")
+}
+
+// ReadLock reads the lockfile of a pack directory; a missing one is empty.
+func ReadLock(dir string) (*Lock, error) {
+	data, err := os.ReadFile(filepath.Join(dir, LockFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return &Lock{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var l Lock
+	if err := yaml.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("%s: %v", filepath.Join(dir, LockFileName), err)
+	}
+	return &l, nil
+}
+
+// Write writes the lockfile to a pack directory.
+func (l *Lock) Write(dir string) error {
+	data, err := yaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, LockFileName+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, LockFileName))
+}
+
+// Find returns the pack of the lockfile with the name, or nil.
+func (l *Lock) Find(name string) *Locked {
+	for i := range l.Packs {
+		if l.Packs[i].Name == name {
+			return &l.Packs[i]
+		}
+	}
+	return nil
+}
+
+// ValidName reports whether a pack name or version can name its directory.
+func ValidName(s string) bool {
+	return s != "" && s != "." && s != ".." && !strings.ContainsAny(s, `/\:`)
+}
+
+// VersionDir is where a version of a pack is installed.
+func VersionDir(dir, name, version string) string {
+	return filepath.Join(dir, name, version)
+}
+
+// InstalledRules returns the rules file of an installed version of a pack.
+func InstalledRules(dir, name, version string) (string, error) {
+	vdir := VersionDir(dir, name, version)
+	m, err := readMeta(vdir)
+	if err != nil {
+		return "", fmt.Errorf("rule pack %s %s is not installed in %s", name, version, dir)
+	}
+	if m.Archive {
+		return filepath.Join(vdir, "pack.d", "rules.yaml"), nil
+	}
+	return filepath.Join(vdir, "rules.yaml"), nil
+}
+
+// Install downloads a release into dir, normally its VersionDir, and returns its
+// rules file and the sha256 of the pack.
+func Install(dir string, r Release, opts Options) (string, string, error) {
+	dl, err := fetchRelease(r, opts)
+	if err != nil {
+		return "", "", err
+	}
+	if err := store(dir, dl); err != nil {
+		return "", "", fmt.Errorf("failed to install %s: %v", r.URL, err)
+	}
+	sum := sha256.Sum256(dl.data)
+	rulesFile := filepath.Join(dir, "rules.yaml")
+	if dl.meta.Archive {
+		rulesFile = filepath.Join(dir, "pack.d", "rules.yaml")
+	}
+	return rulesFile, hex.EncodeToString(sum[:]), nil
+}
+
+// Prune removes the installed versions of a pack other than the one in use and the
+// one before it.
+func Prune(dir string, p Locked) error {
+	entries, err := os.ReadDir(filepath.Join(dir, p.Name))
+	if err != nil {
+		return nil
+	}
+	for _, e := range entries {
+		if !e.IsDir() || e.Name() == p.Version || (p.Previous != nil && e.Name() == p.Previous.Version) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, p.Name, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolvePack returns the rules file of the version in use of an installed pack.
+func resolvePack(ref string, opts Options) (string, error) {
+	name := strings.TrimPrefix(ref, PackPrefix)
+	dir := opts.PackDir
+	if dir == "" {
+		dir = DefaultPackDir()
+	}
+	l, err := ReadLock(dir)
+	if err != nil {
+		return "", err
+	}
+	p := l.Find(name)
+	if p == nil || p.Version == "" {
+		return "", fmt.Errorf("rule pack %s is not installed in %s; run config-validator rules update %s", name, dir, name)
+	}
+	return InstalledRules(dir, name, p.Version)
+}
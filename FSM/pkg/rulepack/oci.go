@@ -0,0 +1,190 @@
+package rulepack
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// OCI packs are stored as an artifact whose first layer is the pack (a rules.yaml, or
+// a tar+gzip bundle when the media type says so), as pushed by e.g.
+//
+//	oras push registry.example.com/netops/rules:v3 rules.tar.gz:application/vnd.oci.image.layer.v1.tar+gzip
+//
+// A signature is taken from the layer's SignatureAnnotation. Registries are accessed
+// anonymously, following the registry's bearer token challenge when it has one.
+const SignatureAnnotation = "network-protocol-validator/signature"
+
+const manifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+type ociManifest struct {
+	Layers []ociDescriptor `json:"layers"`
+}
+
+type ociRegistry struct {
+	client *http.Client
+	base   string // scheme://host/v2/repository
+	token  string
+}
+
+func fetchOCI(client *http.Client, ref string, cached *meta) (*download, error) {
+	registry, repo, reference, err := parseOCIRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	scheme := "https"
+	if strings.HasPrefix(registry, "localhost") || strings.HasPrefix(registry, "127.0.0.1") {
+		scheme = "http" // local test registries rarely have TLS
+	}
+	r := &ociRegistry{client: client, base: scheme + "://" + registry + "/v2/" + repo}
+
+	// The manifest digest identifies the pack, so an unchanged digest means the
+	// cached copy is current without downloading the layer.
+	resp, err := r.get("/manifests/"+reference, manifestMediaType)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if cached != nil && digest != "" && digest == cached.Digest {
+		return nil, nil
+	}
+	var manifest ociManifest
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %v", err)
+	}
+	if len(manifest.Layers) == 0 {
+		return nil, fmt.Errorf("manifest %s has no layers", reference)
+	}
+	layer := manifest.Layers[0]
+
+	blob, err := r.get("/blobs/"+layer.Digest, "")
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Body.Close()
+	data, err := io.ReadAll(blob.Body)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	if want := "sha256:" + hex.EncodeToString(sum[:]); layer.Digest != want {
+		return nil, fmt.Errorf("layer digest mismatch: got %s, want %s", want, layer.Digest)
+	}
+
+	return &download{
+		data:      data,
+		signature: []byte(layer.Annotations[SignatureAnnotation]),
+		meta: meta{
+			Ref:     ref,
+			Digest:  digest,
+			Archive: strings.Contains(layer.MediaType, "tar") || isArchive(layer.Annotations["org.opencontainers.image.title"]),
+			Fetched: time.Now(),
+		},
+	}, nil
+}
+
+// parseOCIRef splits oci://registry/repository[:tag|@digest], defaulting to :latest.
+func parseOCIRef(ref string) (registry, repo, reference string, err error) {
+	rest := strings.TrimPrefix(ref, "oci://")
+	registry, repo, ok := strings.Cut(rest, "/")
+	if !ok || registry == "" || repo == "" {
+		return "", "", "", fmt.Errorf("invalid OCI reference '%s', want oci://registry/repository:tag", ref)
+	}
+	if name, digest, ok := strings.Cut(repo, "@"); ok {
+		return registry, name, digest, nil
+	}
+	reference = "latest"
+	if i := strings.LastIndex(repo, ":"); i >= 0 {
+		repo, reference = repo[:i], repo[i+1:]
+	}
+	return registry, repo, reference, nil
+}
+
+// get performs a GET against the repository, answering a bearer token challenge once.
+func (r *ociRegistry) get(path, accept string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(http.MethodGet, r.base+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if r.token != "" {
+			req.Header.Set("Authorization", "Bearer "+r.token)
+		}
+		resp, err := r.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			challenge := resp.Header.Get("WWW-Authenticate")
+			resp.Body.Close()
+			if r.token, err = r.fetchToken(challenge); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("GET %s: %s", r.base+path, resp.Status)
+		}
+		return resp, nil
+	}
+}
+
+// fetchToken requests an anonymous token for a `Bearer realm=...,service=...,scope=...` challenge.
+func (r *ociRegistry) fetchToken(challenge string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", fmt.Errorf("unsupported registry authentication '%s'", challenge)
+	}
+	fields := map[string]string{}
+	for _, part := range strings.Split(params, ",") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(part), "="); ok {
+			fields[k] = strings.Trim(v, `"`)
+		}
+	}
+	if fields["realm"] == "" {
+		return "", fmt.Errorf("registry challenge has no realm")
+	}
+	query := url.Values{}
+	for _, k := range []string{"service", "scope"} {
+		if fields[k] != "" {
+			query.Set(k, fields[k])
+		}
+	}
+	resp, err := r.client.Get(fields["realm"] + "?" + query.Encode())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry token request: %s", resp.Status)
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	return body.AccessToken, nil
+}
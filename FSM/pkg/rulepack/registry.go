@@ -0,0 +1,207 @@
+package rulepack
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A registry publishes the versions of named rule packs in an index, a YAML (or
+// JSON) file at an https:// URL or a local path:
+//
+//	packs:
+//	  cisco-ios:
+//	    - version: 3.2.0
+//	      url: cisco-ios/3.2.0/rules.tgz   # relative to the index, or https:// or oci://
+//	      sha256: 9f2c...
+//
+// Packs are fetched as -rules fetches them, with the same signatures, and checked
+// against the sha256 the index gives.
+
+// Release is a published version of a pack.
+type Release struct {
+	Version string `yaml:"version"`
+	URL     string `yaml:"url"`
+	SHA256  string `yaml:"sha256"`
+}
+
+// Index is a registry's list of packs and their releases.
+type Index struct {
+	Packs map[string][]Release `yaml:"packs"`
+}
+
+// LoadIndex reads a registry index, resolving the URLs of its releases.
+func LoadIndex(ref string, client *http.Client) (*Index, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(ref, "oci://") {
+		return nil, fmt.Errorf("registry index %s: an index is an https:// URL or a file", ref)
+	}
+	if IsRemote(ref) {
+		data, err = get(client, ref)
+	} else {
+		ref, _ = filepath.Abs(ref) // so release paths hold wherever the lockfile is used
+		data, err = os.ReadFile(ref)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry index %s: %v", ref, err)
+	}
+	var ix Index
+	if err := yaml.Unmarshal(data, &ix); err != nil {
+		return nil, fmt.Errorf("registry index %s: %v", ref, err)
+	}
+	for name, releases := range ix.Packs {
+		if !ValidName(name) {
+			return nil, fmt.Errorf("registry index %s: invalid pack name %q", ref, name)
+		}
+		for i, r := range releases {
+			if !ValidName(r.Version) || r.URL == "" {
+				return nil, fmt.Errorf("registry index %s: release %d of %s needs a valid version and a url", ref, i+1, name)
+			}
+			releases[i].URL = resolveURL(ref, r.URL)
+		}
+	}
+	return &ix, nil
+}
+
+// Latest returns the newest release of a pack that the pin allows.
+func (ix *Index) Latest(name, pin string) (Release, error) {
+	releases, ok := ix.Packs[name]
+	if !ok {
+		return Release{}, fmt.Errorf("the registry has no pack %s", name)
+	}
+	var best *Release
+	for i, r := range releases {
+		if MatchesPin(r.Version, pin) && (best == nil || CompareVersions(r.Version, best.Version) > 0) {
+			best = &releases[i]
+		}
+	}
+	if best == nil {
+		return Release{}, fmt.Errorf("the registry has no release of %s matching pin %s", name, pin)
+	}
+	return *best, nil
+}
+
+// MatchesPin reports whether a version is allowed by a pin: an exact version, or a
+// prefix of one such as 3 or 3.2. An empty pin, or "latest", allows any version.
+func MatchesPin(version, pin string) bool {
+	if pin == "" || pin == "latest" {
+		return true
+	}
+	v, p := versionParts(version), versionParts(pin)
+	if len(p) > len(v) {
+		return false
+	}
+	for i := range p {
+		if p[i] != v[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// CompareVersions compares dotted versions, numerically where both parts are
+// numbers, so 3.10.0 is newer than 3.9.1. A leading v is ignored.
+func CompareVersions(a, b string) int {
+	pa, pb := versionParts(a), versionParts(b)
+	for i := 0; i < max(len(pa), len(pb)); i++ {
+		x, y := "0", "0"
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		xi, errx := strconv.Atoi(x)
+		yi, erry := strconv.Atoi(y)
+		switch {
+		case errx == nil && erry == nil && xi != yi:
+			if xi < yi {
+				return -1
+			}
+			return 1
+		case (errx != nil || erry != nil) && x != y:
+			return strings.Compare(x, y)
+		}
+	}
+	return 0
+}
+
+func versionParts(v string) []string {
+	return strings.Split(strings.TrimPrefix(v, "v"), ".")
+}
+
+// resolveURL resolves the URL of a release against the index it is listed in.
+func resolveURL(index, ref string) string {
+	if IsRemote(ref) || filepath.IsAbs(ref) {
+		return ref
+	}
+	if IsRemote(index) {
+		if base, err := url.Parse(index); err == nil {
+			if u, err := base.Parse(ref); err == nil {
+				return u.String()
+			}
+		}
+		return ref
+	}
+	return filepath.Join(filepath.Dir(index), filepath.FromSlash(ref))
+}
+
+// fetchRelease downloads a release, checking it against its sha256 when the index
+// gives one, and against its signature when a public key is configured.
+func fetchRelease(r Release, opts Options) (*download, error) {
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 60 * time.Second}
+	}
+	var dl *download
+	var err error
+	switch {
+	case strings.HasPrefix(r.URL, "oci://"):
+		dl, err = fetchOCI(opts.Client, r.URL, nil)
+	case IsRemote(r.URL):
+		dl, err = fetchHTTP(opts.Client, r.URL, nil)
+	default:
+		dl = &download{meta: meta{Ref: r.URL, Archive: isArchive(r.URL), Fetched: time.Now()}}
+		if dl.data, err = os.ReadFile(r.URL); err == nil {
+			dl.signature, _ = os.ReadFile(r.URL + ".sig")
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %v", r.URL, err)
+	}
+	sum := sha256.Sum256(dl.data)
+	if got := hex.EncodeToString(sum[:]); r.SHA256 != "" && !strings.EqualFold(got, r.SHA256) {
+		return nil, fmt.Errorf("%s has sha256 %s, but %s is expected", r.URL, got, r.SHA256)
+	}
+	if opts.PublicKey != "" {
+		if err := Verify(dl.data, dl.signature, opts.PublicKey); err != nil {
+			return nil, fmt.Errorf("rules %s: %v", r.URL, err)
+		}
+	}
+	return dl, nil
+}
+
+func get(client *http.Client, ref string) ([]byte, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 60 * time.Second}
+	}
+	resp, err := client.Get(ref)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", ref, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
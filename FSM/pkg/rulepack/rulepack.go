@@ -0,0 +1,283 @@
+package rulepack
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"config-validator/pkg/automata"
+)
+
+// A rules reference is a local path, an http(s) URL, an OCI reference
+// (oci://registry/repository:tag), "builtin" for the rules compiled into the
+// binary (see automata.WriteBuiltinRules), or pack:<name> for a pack installed from
+// a registry (see Lock). Remote packs are either a single rules.yaml or a
+// .tar.gz/.tgz bundle with rules.yaml at its root next to the files it extends and
+// the scripts it references.
+//
+// Downloads are cached per reference and revalidated with ETag / Last-Modified (or
+// the manifest digest for OCI), so unchanged packs are not transferred again and the
+// last good copy is used when the source is unreachable.
+
+// Options configure fetching of remote rule packs.
+type Options struct {
+	CacheDir  string // defaults to DefaultCacheDir()
+	PublicKey string // PEM ed25519 public key; when set, packs must carry a valid signature
+	PackDir   string // of installed packs, for pack: references; defaults to DefaultPackDir()
+	Client    *http.Client
+}
+
+// meta is what is remembered about a cached pack.
+type meta struct {
+	Ref          string    `json:"ref"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Digest       string    `json:"digest,omitempty"` // OCI manifest digest
+	Archive      bool      `json:"archive"`
+	Fetched      time.Time `json:"fetched"`
+}
+
+// download is a freshly fetched pack, or nil when the cached copy is current.
+type download struct {
+	data      []byte
+	signature []byte
+	meta      meta
+}
+
+// IsRemote reports whether ref names a remote pack rather than a local file.
+func IsRemote(ref string) bool {
+	return strings.HasPrefix(ref, "https://") || strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "oci://")
+}
+
+// DefaultCacheDir returns $CONFIG_VALIDATOR_CACHE, or config-validator/rules in the
+// user cache directory.
+func DefaultCacheDir() string {
+	if dir := os.Getenv("CONFIG_VALIDATOR_CACHE"); dir != "" {
+		return dir
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "config-validator", "rules")
+	}
+	return filepath.Join(dir, "config-validator", "rules")
+}
+
+// Builtin is the reference to the rules compiled into the binary.
+const Builtin = "builtin"
+
+// Resolve returns a local rules file for ref, fetching and caching remote packs,
+// writing out the built-in rules, and looking up installed packs (see Lock). Local
+// paths are returned unchanged.
+func Resolve(ref string, opts Options) (string, error) {
+	if strings.HasPrefix(ref, PackPrefix) {
+		return resolvePack(ref, opts)
+	}
+	if ref != Builtin && !IsRemote(ref) {
+		return ref, nil
+	}
+	if opts.CacheDir == "" {
+		opts.CacheDir = DefaultCacheDir()
+	}
+	if ref == Builtin {
+		rulesFile, err := automata.WriteBuiltinRules(opts.CacheDir)
+		if err != nil {
+			return "", fmt.Errorf("failed to write built-in rules: %v", err)
+		}
+		return rulesFile, nil
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 60 * time.Second}
+	}
+	sum := sha256.Sum256([]byte(ref))
+	dir := filepath.Join(opts.CacheDir, hex.EncodeToString(sum[:8]))
+
+	cached, _ := readMeta(dir)
+	var dl *download
+	var err error
+	if strings.HasPrefix(ref, "oci://") {
+		dl, err = fetchOCI(opts.Client, ref, cached)
+	} else {
+		dl, err = fetchHTTP(opts.Client, ref, cached)
+	}
+	if err != nil {
+		if cached == nil {
+			return "", fmt.Errorf("failed to fetch rules %s: %v", ref, err)
+		}
+		log.Printf("⚠️  Could not refresh rules %s, using cached copy from %s: %v", ref, cached.Fetched.Format(time.RFC3339), err)
+	}
+
+	if dl != nil {
+		if opts.PublicKey != "" {
+			if err := Verify(dl.data, dl.signature, opts.PublicKey); err != nil {
+				return "", fmt.Errorf("rules %s: %v", ref, err)
+			}
+		}
+		if err := store(dir, dl); err != nil {
+			return "", fmt.Errorf("failed to cache rules %s: %v", ref, err)
+		}
+		cached = &dl.meta
+	} else if opts.PublicKey != "" {
+		// Re-check the cached pack, which may have been stored before a key was configured.
+		data, _ := os.ReadFile(filepath.Join(dir, "pack"))
+		signature, _ := os.ReadFile(filepath.Join(dir, "pack.sig"))
+		if err := Verify(data, signature, opts.PublicKey); err != nil {
+			return "", fmt.Errorf("cached rules %s: %v", ref, err)
+		}
+	}
+
+	if cached.Archive {
+		return filepath.Join(dir, "pack.d", "rules.yaml"), nil
+	}
+	return filepath.Join(dir, "rules.yaml"), nil
+}
+
+func fetchHTTP(client *http.Client, ref string, cached *meta) (*download, error) {
+	req, err := http.NewRequest(http.MethodGet, ref, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", ref, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	dl := &download{data: data, meta: meta{
+		Ref:          ref,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Archive:      isArchive(ref),
+		Fetched:      time.Now(),
+	}}
+	// Signatures are published next to the pack as <url>.sig; a missing one only
+	// matters when a public key is configured.
+	if sig, err := client.Get(ref + ".sig"); err == nil {
+		if sig.StatusCode == http.StatusOK {
+			dl.signature, _ = io.ReadAll(sig.Body)
+		}
+		sig.Body.Close()
+	}
+	return dl, nil
+}
+
+func isArchive(name string) bool {
+	return strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz")
+}
+
+func readMeta(dir string) (*meta, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "meta.json"))
+	if err != nil {
+		return nil, err
+	}
+	var m meta
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// store replaces the cached pack with dl.
+func store(dir string, dl *download) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "pack"), dl.data, 0o644); err != nil {
+		return err
+	}
+	if len(dl.signature) > 0 {
+		if err := os.WriteFile(filepath.Join(dir, "pack.sig"), dl.signature, 0o644); err != nil {
+			return err
+		}
+	}
+	if dl.meta.Archive {
+		if err := extract(dl.data, filepath.Join(dir, "pack.d")); err != nil {
+			return err
+		}
+	} else if err := os.WriteFile(filepath.Join(dir, "rules.yaml"), dl.data, 0o644); err != nil {
+		return err
+	}
+	// meta.json is written last, so an interrupted store is not mistaken for a cache hit.
+	data, err := json.MarshalIndent(dl.meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "meta.json"), data, 0o644)
+}
+
+// extract unpacks a .tar.gz bundle into dir, refusing entries that escape it.
+func extract(data []byte, dir string) error {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.Clean(hdr.Name)
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("archive entry %s escapes the bundle", hdr.Name)
+		}
+		target := filepath.Join(dir, name)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "rules.yaml")); err != nil {
+		return fmt.Errorf("bundle has no rules.yaml at its root")
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package rulepack
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Verify checks an ed25519 signature over a pack. The signature is base64 encoded, as
+// written by `openssl pkeyutl -sign -rawin ... | base64`. keyFile is a PEM public key.
+func Verify(data, signature []byte, keyFile string) error {
+	if len(signature) == 0 {
+		return fmt.Errorf("pack is not signed")
+	}
+	pemData, err := os.ReadFile(keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to read public key: %v", err)
+	}
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return fmt.Errorf("public key %s is not PEM encoded", keyFile)
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse public key: %v", err)
+	}
+	key, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		return fmt.Errorf("public key %s is %T, want ed25519", keyFile, parsed)
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return fmt.Errorf("signature is not base64: %v", err)
+	}
+	if !ed25519.Verify(key, data, sig) {
+		return fmt.Errorf("signature verification failed")
+	}
+	return nil
+}
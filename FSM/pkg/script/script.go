@@ -0,0 +1,149 @@
+package script
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"go.starlark.net/lib/math"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+
+	"config-validator/pkg/automata"
+)
+
+// maxSteps bounds the work a single check may do, so a buggy script cannot hang validation.
+const maxSteps = 1_000_000
+
+// Checks are Starlark functions taking one argument, ctx, with the fields
+//
+//	ctx.line            the trimmed line
+//	ctx.line_num        its line number
+//	ctx.state           the FSM state the line was validated in
+//	ctx.groups          the rule's regex submatches, groups[0] being the whole line
+//	ctx.vrf             the VRF the line is in, "" for the global routing table
+//	ctx.address_family  the address-family it is in, such as "ipv4 unicast", or ""
+//	ctx.model           a dict shared by every check for the whole config, for cross-line logic
+//
+// and returning None, a message string, or a list of message strings.
+var fileOptions = &syntax.FileOptions{Set: true, While: true, TopLevelControl: true, GlobalReassign: true}
+
+// Loader resolves the script references in a rule set. Each script file is executed
+// once, and all checks share one model, so a Loader belongs to a single validation run.
+type Loader struct {
+	dir     string
+	model   *starlark.Dict
+	modules map[string]starlark.StringDict
+}
+
+// NewLoader returns a Loader resolving script paths relative to dir, normally the
+// directory of the rules file.
+func NewLoader(dir string) *Loader {
+	return &Loader{dir: dir, model: starlark.NewDict(0), modules: map[string]starlark.StringDict{}}
+}
+
+// Attach sets Check on every rule that references a script.
+func (l *Loader) Attach(rules map[string][]automata.Rule) error {
+	for state, list := range rules {
+		for i := range list {
+			if list[i].Script == "" {
+				continue
+			}
+			check, err := l.Check(list[i].Script)
+			if err != nil {
+				return fmt.Errorf("state %s: %v", state, err)
+			}
+			list[i].Check = check
+		}
+	}
+	return nil
+}
+
+// Check returns the check named by ref, written "file.star:function".
+func (l *Loader) Check(ref string) (automata.Check, error) {
+	file, name, ok := strings.Cut(ref, ":")
+	if !ok || file == "" || name == "" {
+		return nil, fmt.Errorf("invalid script reference '%s', want file.star:function", ref)
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(l.dir, file)
+	}
+	globals, err := l.module(file)
+	if err != nil {
+		return nil, err
+	}
+	fn, ok := globals[name].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("script %s has no function %s", file, name)
+	}
+
+	return func(c automata.CheckContext) ([]string, error) {
+		groups := make(starlark.Tuple, len(c.Groups))
+		for i, g := range c.Groups {
+			groups[i] = starlark.String(g)
+		}
+		ctx := starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+			"line":           starlark.String(c.Line),
+			"line_num":       starlark.MakeInt(c.LineNum),
+			"state":          starlark.String(c.State),
+			"groups":         groups,
+			"vrf":            starlark.String(c.Context.VRF),
+			"address_family": starlark.String(c.Context.AddressFamily),
+			"model":          l.model,
+		})
+		result, err := starlark.Call(newThread(ref), fn, starlark.Tuple{ctx}, nil)
+		if err != nil {
+			return nil, err
+		}
+		return messages(result)
+	}, nil
+}
+
+func (l *Loader) module(file string) (starlark.StringDict, error) {
+	if globals, ok := l.modules[file]; ok {
+		return globals, nil
+	}
+	predeclared := starlark.StringDict{
+		"struct": starlark.NewBuiltin("struct", starlarkstruct.Make),
+		"math":   math.Module,
+	}
+	globals, err := starlark.ExecFileOptions(fileOptions, newThread(file), file, nil, predeclared)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load script %s: %v", file, err)
+	}
+	l.modules[file] = globals
+	return globals, nil
+}
+
+func newThread(name string) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name:  name,
+		Print: func(_ *starlark.Thread, msg string) { log.Printf("%s: %s", name, msg) },
+	}
+	thread.SetMaxExecutionSteps(maxSteps)
+	return thread
+}
+
+// messages converts a check's return value into finding messages.
+func messages(v starlark.Value) ([]string, error) {
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.String:
+		return []string{string(v)}, nil
+	case starlark.Indexable: // list or tuple
+		var out []string
+		for i := 0; i < v.Len(); i++ {
+			s, ok := starlark.AsString(v.Index(i))
+			if !ok {
+				return nil, fmt.Errorf("check returned a list containing %s, want strings", v.Index(i).Type())
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("check returned %s, want None, a string, or a list of strings", v.Type())
+	}
+}
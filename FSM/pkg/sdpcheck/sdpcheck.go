@@ -0,0 +1,307 @@
+// Package sdpcheck validates session descriptions (SDP, RFC 8866), as carried in RTSP,
+// SIP, and HTTP bodies. A description is a finite-state machine over its lines: the
+// session section's v=, o=, s=, ... t=, ... a= lines come in a fixed order, followed
+// by media sections that each start with an m= line and have an order of their own.
+// The values of the lines, and the payload types the attributes refer to, are
+// checked too.
+package sdpcheck
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"config-validator/pkg/automata"
+)
+
+// State is the state reported in SDP findings.
+const State = "SDP"
+
+// The order of the lines of each section, and the types that may repeat.
+const (
+	sessionOrder  = "vosiuepcbtrzka"
+	sessionRepeat = "epbtra"
+	mediaOrder    = "micbka"
+	mediaRepeat   = "cba"
+)
+
+var (
+	lineRe    = regexp.MustCompile(`^([a-z])=(.*)$`)
+	bandwidth = regexp.MustCompile(`^[A-Za-z0-9-]+:[0-9]+$`)
+	attribute = regexp.MustCompile(`^[A-Za-z0-9!#$%&'*+.^_` + "`" + `{|}~-]+(:.*)?$`)
+	rtpmap    = regexp.MustCompile(`^([0-9]+) [^/ ]+/[0-9]+(/\S+)?$`)
+	typedTime = regexp.MustCompile(`^-?[0-9]+[dhms]?$`)
+)
+
+// mediaTypes are the media of m= lines (RFC 8866 and the IANA registry).
+var mediaTypes = map[string]bool{"audio": true, "video": true, "text": true, "application": true, "message": true, "image": true}
+
+// directions are the attributes that set the direction of media; a section has one.
+var directions = map[string]bool{"sendrecv": true, "sendonly": true, "recvonly": true, "inactive": true}
+
+// section is the session section or a media section being checked.
+type section struct {
+	line       int    // line of its m=, or 1
+	order      string // the order of its lines
+	repeat     string
+	pos        int // position in order of the last line
+	connection bool
+	direction  string
+	rtp        bool            // the m= line's protocol is RTP, so its formats are payload types
+	formats    map[string]bool // formats of the m= line
+	list       []string        // the same, in order
+	mapped     map[string]bool // payload types given an rtpmap
+}
+
+type checker struct {
+	findings []automata.Finding
+	session  *section
+	media    *section // nil in the session section
+	seen     map[byte]bool
+}
+
+func (c *checker) add(line int, command, severity, msg string) {
+	c.findings = append(c.findings, automata.Finding{Line: line, Command: command, State: State, Message: msg, Severity: severity})
+}
+
+// Check validates a session description.
+func Check(body []byte) []automata.Finding {
+	c := &checker{session: &section{line: 1, order: sessionOrder, repeat: sessionRepeat, pos: -1}, seen: map[byte]bool{}}
+	if !utf8.Valid(body) {
+		c.add(1, "", automata.SeverityError, "session description is not valid UTF-8")
+	}
+	lines := bytes.Split(body, []byte("\n"))
+	if len(lines) > 1 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	} else if len(body) > 0 {
+		c.add(len(lines), "", automata.SeverityWarning, "last line does not end in CRLF")
+	}
+	ended := bytes.HasSuffix(body, []byte("\n"))
+	bareLF := false
+	for i, raw := range lines {
+		n := i + 1
+		if !bytes.HasSuffix(raw, []byte("\r")) && (ended || i < len(lines)-1) && !bareLF {
+			c.add(n, "", automata.SeverityWarning, "lines end in LF rather than CRLF")
+			bareLF = true
+		}
+		line := string(bytes.TrimSuffix(raw, []byte("\r")))
+		if line == "" {
+			c.add(n, "", automata.SeverityError, "blank line in a session description")
+			continue
+		}
+		m := lineRe.FindStringSubmatch(line)
+		if m == nil {
+			c.add(n, excerpt(line), automata.SeverityError, "line is not <type>=<value> with a lowercase type letter and no space around '='")
+			continue
+		}
+		if n == 1 && m[1] != "v" {
+			c.add(n, excerpt(line), automata.SeverityError, "a session description starts with v=")
+		}
+		c.line(n, m[1][0], m[2], line)
+	}
+	for _, t := range "vost" {
+		if !c.seen[byte(t)] {
+			c.add(1, string(t)+"=", automata.SeverityError, fmt.Sprintf("session description has no %c= line", t))
+		}
+	}
+	c.endMedia()
+	return c.findings
+}
+
+// line checks the order of a line, then its value.
+func (c *checker) line(n int, typ byte, value, text string) {
+	cmd := excerpt(text)
+	if typ == 'm' {
+		c.endMedia()
+		if !c.seen['t'] {
+			c.add(n, cmd, automata.SeverityError, "m= line comes before the session section's t= line")
+		}
+		c.media = &section{line: n, order: mediaOrder, repeat: mediaRepeat, pos: -1, formats: map[string]bool{}, mapped: map[string]bool{}}
+	}
+	s := c.session
+	if c.media != nil {
+		s = c.media
+	}
+	pos := strings.IndexByte(s.order, typ)
+	switch {
+	case pos < 0 && strings.IndexByte(sessionOrder+mediaOrder, typ) >= 0:
+		c.add(n, cmd, automata.SeverityError, fmt.Sprintf("%c= line is not allowed in a media section", typ))
+		return
+	case pos < 0:
+		c.add(n, cmd, automata.SeverityError, fmt.Sprintf("unknown line type %c=; parsers must reject descriptions with types they do not know", typ))
+		return
+	case typ == 't' && s.pos == strings.IndexByte(s.order, 'r'):
+		// a new time description after repeat times
+	case typ == 'r' && s.pos != strings.IndexByte(s.order, 't') && s.pos != pos:
+		c.add(n, cmd, automata.SeverityError, "r= line must follow a t= line")
+	case pos < s.pos:
+		c.add(n, cmd, automata.SeverityError, fmt.Sprintf("%c= line is out of order: it comes after %c=", typ, s.order[s.pos]))
+	case pos == s.pos && strings.IndexByte(s.repeat, typ) < 0:
+		c.add(n, cmd, automata.SeverityError, fmt.Sprintf("more than one %c= line in the section", typ))
+	}
+	s.pos = max(s.pos, pos)
+	if typ == 't' {
+		s.pos = pos
+	}
+	c.seen[typ] = true
+	c.value(n, s, typ, value, cmd)
+}
+
+// value checks the value of a line.
+func (c *checker) value(n int, s *section, typ byte, value, cmd string) {
+	fields := strings.Split(value, " ")
+	switch typ {
+	case 'v':
+		if value != "0" {
+			c.add(n, cmd, automata.SeverityError, "protocol version must be 0")
+		}
+	case 'o':
+		if len(fields) != 6 {
+			c.add(n, cmd, automata.SeverityError, "o= must be <username> <sess-id> <sess-version> <nettype> <addrtype> <unicast-address>")
+			return
+		}
+		for _, f := range fields[1:3] {
+			if _, err := strconv.ParseUint(f, 10, 64); err != nil {
+				c.add(n, cmd, automata.SeverityError, fmt.Sprintf("session id and version must be numbers, not %q", f))
+			}
+		}
+		c.address(n, cmd, fields[3], fields[4])
+	case 's':
+		if value == "" {
+			c.add(n, cmd, automata.SeverityError, "session name must not be empty; a single space or '-' stands for none")
+		}
+	case 'c':
+		if len(fields) != 3 {
+			c.add(n, cmd, automata.SeverityError, "c= must be <nettype> <addrtype> <connection-address>")
+			return
+		}
+		c.address(n, cmd, fields[0], fields[1])
+		s.connection = true
+	case 'b':
+		if !bandwidth.MatchString(value) {
+			c.add(n, cmd, automata.SeverityError, "b= must be <bwtype>:<bandwidth>")
+		}
+	case 't':
+		if len(fields) != 2 {
+			c.add(n, cmd, automata.SeverityError, "t= must be <start-time> <stop-time>")
+			return
+		}
+		start, err1 := strconv.ParseUint(fields[0], 10, 64)
+		stop, err2 := strconv.ParseUint(fields[1], 10, 64)
+		switch {
+		case err1 != nil || err2 != nil:
+			c.add(n, cmd, automata.SeverityError, "start and stop times must be NTP seconds")
+		case stop != 0 && stop < start:
+			c.add(n, cmd, automata.SeverityError, "stop time is before the start time")
+		}
+	case 'r', 'z':
+		for _, f := range fields {
+			if !typedTime.MatchString(f) {
+				c.add(n, cmd, automata.SeverityError, fmt.Sprintf("%q is not a time", f))
+				return
+			}
+		}
+	case 'm':
+		c.mediaLine(n, s, fields, cmd)
+	case 'a':
+		c.attribute(n, s, value, cmd)
+	}
+}
+
+// address checks the network and address types of o= and c= lines.
+func (c *checker) address(n int, cmd, nettype, addrtype string) {
+	if nettype != "IN" {
+		c.add(n, cmd, automata.SeverityWarning, fmt.Sprintf("network type %q is not IN", nettype))
+	}
+	if addrtype != "IP4" && addrtype != "IP6" {
+		c.add(n, cmd, automata.SeverityError, fmt.Sprintf("address type %q is not IP4 or IP6", addrtype))
+	}
+}
+
+// mediaLine checks an m= line: <media> <port>[/<count>] <proto> <fmt> ...
+func (c *checker) mediaLine(n int, s *section, fields []string, cmd string) {
+	if len(fields) < 4 {
+		c.add(n, cmd, automata.SeverityError, "m= must be <media> <port> <proto> <fmt> ...")
+		return
+	}
+	if !mediaTypes[fields[0]] {
+		c.add(n, cmd, automata.SeverityWarning, fmt.Sprintf("media type %q is not registered", fields[0]))
+	}
+	port, count, _ := strings.Cut(fields[1], "/")
+	if p, err := strconv.Atoi(port); err != nil || p < 0 || p > 65535 {
+		c.add(n, cmd, automata.SeverityError, fmt.Sprintf("port %q is not 0 to 65535", port))
+	}
+	if k, err := strconv.Atoi(count); count != "" && (err != nil || k < 1) {
+		c.add(n, cmd, automata.SeverityError, fmt.Sprintf("port count %q is not a positive number", count))
+	}
+	s.rtp = strings.Contains(fields[2], "RTP/")
+	for _, f := range fields[3:] {
+		s.formats[f] = true
+		s.list = append(s.list, f)
+		if pt, err := strconv.Atoi(f); s.rtp && (err != nil || pt < 0 || pt > 127) {
+			c.add(n, cmd, automata.SeverityError, fmt.Sprintf("format %q of an RTP stream is not a payload type 0 to 127", f))
+		}
+	}
+}
+
+// attribute checks an a= line.
+func (c *checker) attribute(n int, s *section, value, cmd string) {
+	if !attribute.MatchString(value) {
+		c.add(n, cmd, automata.SeverityError, "a= must be <attribute> or <attribute>:<value>")
+		return
+	}
+	name, arg, _ := strings.Cut(value, ":")
+	if directions[name] {
+		if s.direction != "" {
+			c.add(n, cmd, automata.SeverityError, fmt.Sprintf("%s conflicts with %s in the same section", name, s.direction))
+		}
+		s.direction = name
+	}
+	if name != "rtpmap" && name != "fmtp" {
+		return
+	}
+	if s.formats == nil {
+		c.add(n, cmd, automata.SeverityWarning, name+" is at session level, where no payload types are defined")
+		return
+	}
+	pt, _, _ := strings.Cut(arg, " ")
+	if name == "rtpmap" {
+		if !rtpmap.MatchString(arg) {
+			c.add(n, cmd, automata.SeverityError, "rtpmap must be <payload type> <encoding name>/<clock rate>[/<parameters>]")
+			return
+		}
+		s.mapped[pt] = true
+	}
+	if !s.formats[pt] {
+		c.add(n, cmd, automata.SeverityError, fmt.Sprintf("%s for payload type %s, which the m= line does not list", name, pt))
+	}
+}
+
+// endMedia checks a media section once all its lines are read.
+func (c *checker) endMedia() {
+	s := c.media
+	if s == nil {
+		return
+	}
+	if !s.connection && !c.session.connection {
+		c.add(s.line, "m=", automata.SeverityError, "media section has no c= line, and neither has the session section")
+	}
+	if s.rtp {
+		for _, f := range s.list {
+			if pt, err := strconv.Atoi(f); err == nil && pt >= 96 && pt <= 127 && !s.mapped[f] {
+				c.add(s.line, "m=", automata.SeverityError, fmt.Sprintf("dynamic payload type %d has no rtpmap", pt))
+			}
+		}
+	}
+	c.media = nil
+}
+
+func excerpt(s string) string {
+	if len(s) > 60 {
+		return s[:57] + "..."
+	}
+	return s
+}
@@ -0,0 +1,259 @@
+// Package seal signs and encrypts saved reports, for environments where reports are
+// evidence. A sealed report is signed with an ed25519 key into a detached signature
+// next to it, <report>.sig, base64 encoded as rule pack signatures are, so it can
+// also be checked with openssl. Encryption saves the report in a form only the holder
+// of an X25519 private key can read: an ephemeral X25519 key agreement, HKDF-SHA256,
+// and AES-256-GCM. The report is encrypted before it is written, so the plain report
+// never reaches the disk, and the signature covers the file as saved and can be
+// verified without the decryption key. Any other file a run saves, such as a fetched
+// config or a remediation snippet, is sealed the same way.
+//
+// Keys are PEM files, as written by openssl:
+//
+//	openssl genpkey -algorithm ed25519 -out sign.pem
+//	openssl pkey -in sign.pem -pubout -out sign.pub.pem
+//	openssl genpkey -algorithm x25519 -out decrypt.pem
+//	openssl pkey -in decrypt.pem -pubout -out encrypt.pub.pem
+package seal
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// magic starts an encrypted report, followed by the ephemeral public key, the nonce,
+// and the ciphertext.
+const magic = "config-validator encrypted report v1\n"
+
+// SignatureFile is where the signature of a report is saved.
+func SignatureFile(report string) string { return report + ".sig" }
+
+// Sealer signs and encrypts report files. A nil *Sealer leaves them as they are.
+type Sealer struct {
+	signKey   ed25519.PrivateKey // nil when not signing
+	recipient *ecdh.PublicKey    // nil when not encrypting
+}
+
+// New loads the keys to sign reports with and encrypt them to; either may be empty.
+// It returns nil when both are.
+func New(signKeyFile, recipientFile string) (*Sealer, error) {
+	if signKeyFile == "" && recipientFile == "" {
+		return nil, nil
+	}
+	s := &Sealer{}
+	if signKeyFile != "" {
+		key, err := loadPrivateKey(signKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		if s.signKey, ok = key.(ed25519.PrivateKey); !ok {
+			return nil, fmt.Errorf("signing key %s is %T, want ed25519", signKeyFile, key)
+		}
+	}
+	if recipientFile != "" {
+		key, err := loadPublicKey(recipientFile)
+		if err != nil {
+			return nil, err
+		}
+		pub, ok := key.(*ecdh.PublicKey)
+		if !ok || pub.Curve() != ecdh.X25519() {
+			return nil, fmt.Errorf("encryption key %s is %T, want x25519", recipientFile, key)
+		}
+		s.recipient = pub
+	}
+	return s, nil
+}
+
+// WriteFile saves a report as os.WriteFile does, encrypted first when the Sealer has a
+// recipient, and then signs it into SignatureFile(path). A nil Sealer writes the
+// report as it is.
+func (s *Sealer) WriteFile(path string, data []byte, perm os.FileMode) error {
+	if s == nil {
+		return os.WriteFile(path, data, perm)
+	}
+	if s.recipient != nil {
+		var err error
+		if data, err = encrypt(data, s.recipient); err != nil {
+			return err
+		}
+	}
+	if err := writeAtomic(path, data, perm); err != nil {
+		return err
+	}
+	if s.signKey != nil {
+		sig := base64.StdEncoding.EncodeToString(ed25519.Sign(s.signKey, data))
+		if err := os.WriteFile(SignatureFile(path), []byte(sig+"\n"), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Verify checks the detached signature of a report against an ed25519 public key.
+func Verify(data, signature []byte, publicKeyFile string) error {
+	key, err := loadPublicKey(publicKeyFile)
+	if err != nil {
+		return err
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return fmt.Errorf("public key %s is %T, want ed25519", publicKeyFile, key)
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return fmt.Errorf("signature is not base64: %v", err)
+	}
+	if !ed25519.Verify(pub, data, sig) {
+		return errors.New("signature verification failed: the report was changed or signed with another key")
+	}
+	return nil
+}
+
+// IsEncrypted reports whether data is an encrypted report.
+func IsEncrypted(data []byte) bool { return bytes.HasPrefix(data, []byte(magic)) }
+
+// Decrypt returns the report an encrypted report holds, with the X25519 private key
+// it was encrypted to.
+func Decrypt(data []byte, privateKeyFile string) ([]byte, error) {
+	key, err := loadPrivateKey(privateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(*ecdh.PrivateKey)
+	if !ok || priv.Curve() != ecdh.X25519() {
+		return nil, fmt.Errorf("decryption key %s is %T, want x25519", privateKeyFile, key)
+	}
+	if !IsEncrypted(data) {
+		return nil, errors.New("the report is not encrypted")
+	}
+	data = data[len(magic):]
+	if len(data) < 32 {
+		return nil, errors.New("the encrypted report is truncated")
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(data[:32])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(priv, ephemeral, ephemeral, priv.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+	data = data[32:]
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("the encrypted report is truncated")
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(magic))
+	if err != nil {
+		return nil, errors.New("decryption failed: the report was changed or encrypted to another key")
+	}
+	return plain, nil
+}
+
+func encrypt(plain []byte, recipient *ecdh.PublicKey) ([]byte, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(ephemeral, recipient, ephemeral.PublicKey(), recipient)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append([]byte(magic), ephemeral.PublicKey().Bytes()...)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, plain, []byte(magic)), nil
+}
+
+// newAEAD derives the AES-256-GCM key of a report from the key agreement of priv and
+// peer, bound to the ephemeral and recipient public keys.
+func newAEAD(priv *ecdh.PrivateKey, peer, ephemeral, recipient *ecdh.PublicKey) (cipher.AEAD, error) {
+	shared, err := priv.ECDH(peer)
+	if err != nil {
+		return nil, err
+	}
+	info := append(append([]byte(magic), ephemeral.Bytes()...), recipient.Bytes()...)
+	key, err := hkdf.Key(sha256.New, shared, nil, string(info), 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// writeAtomic replaces a file, so a reader never sees it half written.
+func writeAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func loadPEM(file string) ([]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %s is not PEM encoded", file)
+	}
+	return block.Bytes, nil
+}
+
+func loadPrivateKey(file string) (any, error) {
+	der, err := loadPEM(file)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key %s: %v", file, err)
+	}
+	return key, nil
+}
+
+func loadPublicKey(file string) (any, error) {
+	der, err := loadPEM(file)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key %s: %v", file, err)
+	}
+	return key, nil
+}
@@ -0,0 +1,138 @@
+package security
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"config-validator/pkg/automata"
+)
+
+// Auditor is the credential hygiene pass. It sees every line of a config, independently
+// of the FSM rules, and reports secrets that are stored in plaintext or in a reversible
+// form, default SNMP communities, and embedded private keys. Excerpts in its findings
+// have the secret replaced by "<redacted>".
+type Auditor struct {
+	Findings []automata.Finding
+	// Redacted maps the number of each line holding a secret to its redacted form, so
+	// other findings on those lines can be redacted too.
+	Redacted map[int]string
+	inKey    bool // inside an embedded private key
+}
+
+// secretCheck matches a credential line. The "type" submatch is the Cisco encryption
+// type (empty or "0" for plaintext, "7" for the reversible type 7), "secret" the secret.
+type secretCheck struct {
+	re   *regexp.Regexp
+	what string
+}
+
+var secretChecks = []secretCheck{
+	{regexp.MustCompile(`^enable password(?: level \d+)?(?: (?P<type>\d))? (?P<secret>\S+)$`), "enable password"},
+	{regexp.MustCompile(`^username \S+(?: privilege \d+)? password(?: (?P<type>\d))? (?P<secret>\S+)$`), "user password"},
+	{regexp.MustCompile(`^password(?: (?P<type>\d))? (?P<secret>\S+)$`), "line password"},
+	{regexp.MustCompile(`^(?:tacacs-server |radius-server )?key(?: (?P<type>\d))? (?P<secret>\S+)$`), "AAA server key"},
+	{regexp.MustCompile(`^wpa-psk (?:ascii|hex)(?: (?P<type>\d))? (?P<secret>\S+)$`), "WPA pre-shared key"},
+	{regexp.MustCompile(`^crypto isakmp key(?: (?P<type>\d))? (?P<secret>\S+) .+$`), "IKE pre-shared key"},
+	{regexp.MustCompile(`^ntp authentication-key \d+ md5 (?P<secret>\S+)(?: (?P<type>\d))?$`), "NTP key"},
+}
+
+var (
+	communityRe  = regexp.MustCompile(`^snmp-server community (\S+)`)
+	keyBeginRe   = regexp.MustCompile(`^-----BEGIN (?:[A-Z]+ )?PRIVATE KEY-----$`)
+	keyEndRe     = regexp.MustCompile(`^-----END (?:[A-Z]+ )?PRIVATE KEY-----$`)
+	defaultSNMP  = map[string]bool{"public": true, "private": true, "cisco": true, "community": true, "snmp": true}
+	weakPassword = map[string]bool{"cisco": true, "cisco123": true, "admin": true, "password": true, "123456": true, "changeme": true, "secret": true, "letmein": true}
+)
+
+// Line audits one line of a config.
+func (a *Auditor) Line(originalLine string, lineNum int) {
+	line := strings.TrimSpace(originalLine)
+
+	if a.inKey {
+		if keyEndRe.MatchString(line) {
+			a.inKey = false
+		} else {
+			a.redact(lineNum, "<redacted>")
+		}
+		return
+	}
+	if keyBeginRe.MatchString(line) {
+		a.inKey = true
+		a.add(lineNum, line, "security.private-key", "private key embedded in config")
+		return
+	}
+
+	if m := communityRe.FindStringSubmatch(line); m != nil && defaultSNMP[strings.ToLower(m[1])] {
+		a.add(lineNum, strings.Replace(line, m[1], "<redacted>", 1), "security.snmp-community", fmt.Sprintf("default SNMP community '%s'", m[1]))
+		return
+	}
+
+	for _, c := range secretChecks {
+		m := c.re.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		encType, secret := m[c.re.SubexpIndex("type")], m[c.re.SubexpIndex("secret")]
+		switch encType {
+		case "", "0":
+			a.add(lineNum, strings.Replace(line, secret, "<redacted>", 1), "security.plaintext", "plaintext "+c.what)
+		case "7":
+			code, msg := "security.type7", c.what+" uses reversible type 7 encoding"
+			if plain, err := DecodeType7(secret); err == nil && isWeak(plain) {
+				code, msg = "security.type7-weak", msg+fmt.Sprintf(" and decodes to a weak %d-character password", len(plain))
+			}
+			a.add(lineNum, strings.Replace(line, secret, "<redacted>", 1), code, msg)
+		}
+		return
+	}
+}
+
+// isWeak reports whether a recovered password is short or a well-known default.
+func isWeak(password string) bool {
+	return len(password) < 8 || weakPassword[strings.ToLower(password)]
+}
+
+func (a *Auditor) redact(lineNum int, excerpt string) {
+	if a.Redacted == nil {
+		a.Redacted = map[int]string{}
+	}
+	a.Redacted[lineNum] = excerpt
+}
+
+func (a *Auditor) add(lineNum int, excerpt, code, msg string) {
+	a.redact(lineNum, excerpt)
+	a.Findings = append(a.Findings, automata.Finding{
+		Line:     lineNum,
+		Command:  excerpt,
+		State:    "SECURITY",
+		Message:  fmt.Sprintf("%s: %s", msg, excerpt),
+		Severity: automata.SeveritySecurity,
+		Code:     code,
+	})
+}
+
+// Next returns an Auditor for the lines after those a was fed, on their own: it goes
+// on inside an embedded key when a stopped in one (see Append).
+func (a *Auditor) Next() *Auditor {
+	return &Auditor{inKey: a.inKey}
+}
+
+// InKey reports whether the lines fed so far end inside an embedded private key.
+func (a *Auditor) InKey() bool {
+	return a.inKey
+}
+
+// Append adds what other, a Next of the auditor fed the lines after a's, found, with
+// its line numbers moved by shift, as if a had been fed those lines. other is not
+// modified.
+func (a *Auditor) Append(other *Auditor, shift int) {
+	for _, f := range other.Findings {
+		f.Line += shift
+		a.Findings = append(a.Findings, f)
+	}
+	for lineNum, excerpt := range other.Redacted {
+		a.redact(lineNum+shift, excerpt)
+	}
+	a.inKey = other.inKey
+}
@@ -0,0 +1,30 @@
+package security
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// type7Key is the fixed key behind Cisco's "password 7" obfuscation.
+const type7Key = "dsfd;kfoA,.iyewrkldJKDHSUBsgvca69834ncxv9873254k;fg87"
+
+// DecodeType7 reverses a Cisco type 7 password: two decimal digits giving the starting
+// offset into the key, followed by one hex byte per character XORed with the key.
+func DecodeType7(encoded string) (string, error) {
+	if len(encoded) < 4 || len(encoded)%2 != 0 {
+		return "", fmt.Errorf("invalid type 7 string length")
+	}
+	seed, err := strconv.Atoi(encoded[:2])
+	if err != nil || seed >= len(type7Key) {
+		return "", fmt.Errorf("invalid type 7 seed '%s'", encoded[:2])
+	}
+	out := make([]byte, 0, (len(encoded)-2)/2)
+	for i := 2; i < len(encoded); i += 2 {
+		b, err := strconv.ParseUint(encoded[i:i+2], 16, 8)
+		if err != nil {
+			return "", fmt.Errorf("invalid type 7 byte '%s'", encoded[i:i+2])
+		}
+		out = append(out, byte(b)^type7Key[(seed+len(out))%len(type7Key)])
+	}
+	return string(out), nil
+}
@@ -0,0 +1,129 @@
+// Package selftest runs built-in sample inputs, valid and invalid, through the
+// validators and checks that they report exactly the expected findings, so an
+// installation or a rules update can be confirmed healthy before it is trusted.
+package selftest
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/config"
+	"config-validator/pkg/httpbody"
+	"config-validator/pkg/httpmsg"
+	"config-validator/pkg/validation"
+)
+
+//go:embed samples
+var samples embed.FS
+
+// Case is a sample input and the findings it must produce.
+type Case struct {
+	Name   string     `yaml:"name"`
+	Kind   string     `yaml:"kind"` // cisco-config, json, or http
+	Input  string     `yaml:"input"`
+	Expect []Expected `yaml:"expect"`
+}
+
+// Expected is a finding a case must produce: its line, and text its message contains.
+type Expected struct {
+	Line     int    `yaml:"line"`
+	Contains string `yaml:"contains"`
+}
+
+// Result is the outcome of one case.
+type Result struct {
+	Name     string        `json:"name"`
+	Kind     string        `json:"kind"`
+	Passed   bool          `json:"passed"`
+	Problems []string      `json:"problems,omitempty"` // why it failed
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// Cases returns the built-in cases.
+func Cases() ([]Case, error) {
+	data, err := samples.ReadFile("samples/cases.yaml")
+	if err != nil {
+		return nil, err
+	}
+	var cases []Case
+	if err := yaml.Unmarshal(data, &cases); err != nil {
+		return nil, fmt.Errorf("failed to parse self-test cases: %v", err)
+	}
+	return cases, nil
+}
+
+// Run runs every built-in case, validating Cisco configs with rules.
+func Run(rules *config.RuleSet) ([]Result, error) {
+	cases, err := Cases()
+	if err != nil {
+		return nil, err
+	}
+	results := make([]Result, 0, len(cases))
+	for _, c := range cases {
+		started := time.Now()
+		findings, err := validate(c, rules)
+		r := Result{Name: c.Name, Kind: c.Kind}
+		if err != nil {
+			r.Problems = []string{err.Error()}
+		} else {
+			r.Problems = compare(c.Expect, findings)
+		}
+		r.Passed = len(r.Problems) == 0
+		r.Duration = time.Since(started)
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+func validate(c Case, rules *config.RuleSet) ([]automata.Finding, error) {
+	content, err := samples.ReadFile(path.Join("samples", c.Input))
+	if err != nil {
+		return nil, err
+	}
+	switch c.Kind {
+	case "cisco-config":
+		fsm, err := rules.Parse(bytes.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+		return fsm.Findings, nil
+	case "json":
+		return validation.CheckJSON(content), nil
+	case "http":
+		msg, findings := httpmsg.Parse(content)
+		return append(findings, httpbody.CheckMessage(msg)...), nil
+	default:
+		return nil, fmt.Errorf("unknown self-test kind %q", c.Kind)
+	}
+}
+
+// compare matches the error and security findings against the expected ones, and
+// describes every expected finding that is missing and every finding not expected.
+func compare(expect []Expected, findings []automata.Finding) []string {
+	var problems []string
+	matched := make([]bool, len(findings))
+	for _, e := range expect {
+		found := false
+		for i, f := range findings {
+			if f.Line == e.Line && strings.Contains(f.Message, e.Contains) {
+				matched[i], found = true, true
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("expected a finding on line %d containing %q", e.Line, e.Contains))
+		}
+	}
+	for i, f := range findings {
+		if !matched[i] && f.Severity != automata.SeverityWarning {
+			problems = append(problems, "unexpected finding: "+automata.FormatFinding(f))
+		}
+	}
+	return problems
+}
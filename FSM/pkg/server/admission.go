@@ -0,0 +1,181 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"config-validator/pkg/config"
+	"config-validator/pkg/validation"
+)
+
+// ProtocolAnnotation selects how the payloads of an annotated ConfigMap or Secret are
+// validated: "cisco-config" runs every value through the FSM, "json" checks JSON syntax.
+// Objects without the annotation are always admitted.
+const ProtocolAnnotation = "network-protocol-validator/protocol"
+
+// KeysAnnotation optionally restricts validation to a comma-separated list of data keys.
+const KeysAnnotation = "network-protocol-validator/keys"
+
+// admissionReview mirrors the parts of admission.k8s.io/v1 AdmissionReview we use,
+// so that the webhook does not need the Kubernetes client libraries.
+type admissionReview struct {
+	APIVersion string             `json:"apiVersion"`
+	Kind       string             `json:"kind"`
+	Request    *admissionRequest  `json:"request,omitempty"`
+	Response   *admissionResponse `json:"response,omitempty"`
+}
+
+type admissionRequest struct {
+	UID       string                `json:"uid"`
+	Kind      struct{ Kind string } `json:"kind"`
+	Operation string                `json:"operation"`
+	Object    json.RawMessage       `json:"object"`
+}
+
+type admissionResponse struct {
+	UID     string           `json:"uid"`
+	Allowed bool             `json:"allowed"`
+	Status  *admissionStatus `json:"status,omitempty"`
+}
+
+type admissionStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// payloadObject covers both ConfigMaps (data as strings) and Secrets (data as base64,
+// which encoding/json decodes into []byte for us).
+type payloadObject struct {
+	Metadata struct {
+		Name        string            `json:"name"`
+		Namespace   string            `json:"namespace"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+	Data       map[string]json.RawMessage `json:"data"`
+	BinaryData map[string][]byte          `json:"binaryData"`
+}
+
+// AdmissionHandler is a validating admission webhook for ConfigMaps and Secrets.
+type AdmissionHandler struct {
+	Rules *config.Reloader // rules for cisco-config payloads, swapped on reload
+}
+
+func (h *AdmissionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var review admissionReview
+	if err := json.NewDecoder(r.Body).Decode(&review); err != nil || review.Request == nil {
+		http.Error(w, "expected an AdmissionReview request", http.StatusBadRequest)
+		return
+	}
+
+	resp := &admissionResponse{UID: review.Request.UID, Allowed: true}
+	if problems, err := h.review(review.Request); err != nil {
+		resp.Allowed = false
+		resp.Status = &admissionStatus{Code: http.StatusBadRequest, Message: err.Error()}
+	} else if len(problems) > 0 {
+		resp.Allowed = false
+		resp.Status = &admissionStatus{
+			Code:    http.StatusUnprocessableEntity,
+			Message: "payload validation failed: " + strings.Join(problems, "; "),
+		}
+	}
+
+	writeJSON(w, http.StatusOK, admissionReview{
+		APIVersion: "admission.k8s.io/v1",
+		Kind:       "AdmissionReview",
+		Response:   resp,
+	})
+}
+
+// review validates the selected payloads of the object and returns one message per finding.
+func (h *AdmissionHandler) review(req *admissionRequest) ([]string, error) {
+	if req.Operation == "DELETE" || len(req.Object) == 0 {
+		return nil, nil
+	}
+	var obj payloadObject
+	if err := json.Unmarshal(req.Object, &obj); err != nil {
+		return nil, fmt.Errorf("cannot decode %s: %v", req.Kind.Kind, err)
+	}
+	protocol := obj.Metadata.Annotations[ProtocolAnnotation]
+	if protocol == "" {
+		return nil, nil
+	}
+
+	payloads, err := decodePayloads(req.Kind.Kind, obj)
+	if err != nil {
+		return nil, err
+	}
+	if keys := obj.Metadata.Annotations[KeysAnnotation]; keys != "" {
+		selected := make(map[string][]byte)
+		for _, k := range strings.Split(keys, ",") {
+			k = strings.TrimSpace(k)
+			if v, ok := payloads[k]; ok {
+				selected[k] = v
+			}
+		}
+		payloads = selected
+	}
+
+	names := make([]string, 0, len(payloads))
+	for k := range payloads {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var problems []string
+	for _, key := range names {
+		findings, err := h.validatePayload(protocol, payloads[key])
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range findings {
+			problems = append(problems, key+": "+f)
+		}
+	}
+	return problems, nil
+}
+
+func decodePayloads(kind string, obj payloadObject) (map[string][]byte, error) {
+	payloads := make(map[string][]byte)
+	for k, raw := range obj.Data {
+		if kind == "Secret" {
+			var b []byte
+			if err := json.Unmarshal(raw, &b); err != nil {
+				return nil, fmt.Errorf("secret key %s is not base64: %v", k, err)
+			}
+			payloads[k] = b
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, fmt.Errorf("configmap key %s is not a string: %v", k, err)
+		}
+		payloads[k] = []byte(s)
+	}
+	for k, b := range obj.BinaryData {
+		payloads[k] = b
+	}
+	return payloads, nil
+}
+
+func (h *AdmissionHandler) validatePayload(protocol string, payload []byte) ([]string, error) {
+	switch protocol {
+	case "cisco-config":
+		fsm, err := h.Rules.Current().Parse(bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		return fsm.Errors, nil
+	case "json":
+		var problems []string
+		for _, f := range validation.CheckJSON(payload) {
+			problems = append(problems, fmt.Sprintf("Line %d: %s", f.Line, f.Message))
+		}
+		return problems, nil
+	default:
+		return nil, fmt.Errorf("unknown %s '%s'", ProtocolAnnotation, protocol)
+	}
+}
@@ -0,0 +1,305 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// GuardOptions make a server safe to expose beyond localhost.
+type GuardOptions struct {
+	APIKeys    []APIKey  // clients may authenticate with one of these keys
+	ClientCert bool      // clients may authenticate with a verified TLS client certificate
+	Rate       float64   // requests per minute per client; unlimited when zero
+	Burst      int       // requests a client may make at once; Rate/6 (10 seconds' worth) when zero
+	AddrRate   float64   // requests per minute per remote address, before authentication; unlimited when zero
+	MaxBody    int64     // largest request body in bytes; unlimited when zero
+	Audit      io.Writer // receives a JSON line per request
+	// Public are paths served without authentication, rate limiting, or auditing, such
+	// as the health probes of an orchestrator.
+	Public []string
+}
+
+// APIKey is a key a client authenticates with, by name. The key is stored as its
+// SHA-256 so the keys file does not hold usable secrets.
+type APIKey struct {
+	Client string `yaml:"client"`
+	Key    string `yaml:"key"`        // the key itself, or
+	SHA256 string `yaml:"key_sha256"` // the hex SHA-256 of the key
+}
+
+// LoadAPIKeys reads a YAML list of API keys: client, and key or key_sha256.
+func LoadAPIKeys(path string) ([]APIKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys: %v", err)
+	}
+	var keys []APIKey
+	if err := yaml.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse API keys: %v", err)
+	}
+	for i, k := range keys {
+		switch {
+		case k.Client == "":
+			return nil, fmt.Errorf("API key %d has no client name", i+1)
+		case k.Key != "":
+			sum := sha256.Sum256([]byte(k.Key))
+			keys[i].SHA256, keys[i].Key = hex.EncodeToString(sum[:]), ""
+		case len(k.SHA256) != 64:
+			return nil, fmt.Errorf("API key of %s needs key or a 64-digit key_sha256", k.Client)
+		}
+		keys[i].SHA256 = strings.ToLower(keys[i].SHA256)
+	}
+	return keys, nil
+}
+
+// ClientTLSConfig requires clients to present a certificate signed by one of the CAs
+// in caFile.
+func ClientTLSConfig(caFile string) (*tls.Config, error) {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no PEM certificates in %s", caFile)
+	}
+	return &tls.Config{ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven, MinVersion: tls.VersionTLS12}, nil
+}
+
+// Guard wraps a handler with per-address rate limiting, authentication, per-client
+// rate limiting, a request size limit, and an audit log. The per-address limit comes
+// before authentication, so that guessing API keys is throttled too; an address may
+// make AddrRate/6 requests at once. When neither API keys nor client certificates are
+// configured, clients are told apart by address and every request is allowed.
+func Guard(next http.Handler, opts GuardOptions) http.Handler {
+	if opts.Burst == 0 {
+		opts.Burst = max(1, int(math.Ceil(opts.Rate/6)))
+	}
+	return &guard{
+		next:    next,
+		opts:    opts,
+		addrs:   newLimiter(opts.AddrRate, max(1, int(math.Ceil(opts.AddrRate/6)))),
+		clients: newLimiter(opts.Rate, opts.Burst),
+	}
+}
+
+type guard struct {
+	next    http.Handler
+	opts    GuardOptions
+	mu      sync.Mutex
+	addrs   *limiter // by remote address, before authentication
+	clients *limiter // by authenticated client
+}
+
+// limiter keeps a token bucket per key.
+type limiter struct {
+	rate    float64 // per minute; unlimited when zero
+	burst   int
+	buckets map[string]*bucket
+}
+
+func newLimiter(rate float64, burst int) *limiter {
+	return &limiter{rate: rate, burst: burst, buckets: map[string]*bucket{}}
+}
+
+// maxBuckets is how many clients or addresses are tracked before idle ones are forgotten.
+const maxBuckets = 10000
+
+// bucket is a token bucket: tokens refill at the rate, up to the burst.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// auditEntry records who made a request and what it carried.
+type auditEntry struct {
+	Time       time.Time `json:"time"`
+	Client     string    `json:"client"`
+	Auth       string    `json:"auth"` // api-key, client-cert, or none
+	RemoteAddr string    `json:"remote_addr"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	BodyBytes  int64     `json:"body_bytes"`
+	BodySHA256 string    `json:"body_sha256,omitempty"` // identifies what was validated without keeping it
+	DurationMS int64     `json:"duration_ms"`
+}
+
+func (g *guard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, p := range g.opts.Public {
+		if r.URL.Path == p {
+			g.next.ServeHTTP(w, r)
+			return
+		}
+	}
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	entry := auditEntry{Time: time.Now(), RemoteAddr: r.RemoteAddr, Method: r.Method, Path: r.URL.Path}
+	body := &countingBody{ReadCloser: r.Body, hash: sha256.New()}
+	defer func() {
+		entry.Status = rec.status
+		entry.BodyBytes = body.n
+		if body.n > 0 {
+			entry.BodySHA256 = hex.EncodeToString(body.hash.Sum(nil))
+		}
+		entry.DurationMS = time.Since(entry.Time).Milliseconds()
+		g.audit(entry)
+	}()
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if wait, allowed := g.allow(g.addrs, host); !allowed {
+		g.tooMany(rec, wait)
+		return
+	}
+	client, auth, ok := g.authenticate(r, host)
+	entry.Client, entry.Auth = client, auth
+	if !ok {
+		rec.Header().Set("WWW-Authenticate", `Bearer realm="config-validator"`)
+		writeJSON(rec, http.StatusUnauthorized, map[string]string{"error": "authentication required: send an API key or a client certificate"})
+		return
+	}
+	if wait, allowed := g.allow(g.clients, client); !allowed {
+		g.tooMany(rec, wait)
+		return
+	}
+	if g.opts.MaxBody > 0 {
+		if r.ContentLength > g.opts.MaxBody {
+			writeJSON(rec, http.StatusRequestEntityTooLarge, map[string]string{"error": fmt.Sprintf("request body is larger than %d bytes", g.opts.MaxBody)})
+			return
+		}
+		body.ReadCloser = http.MaxBytesReader(rec, r.Body, g.opts.MaxBody)
+	}
+	if r.Body != nil {
+		r.Body = body
+	}
+	g.next.ServeHTTP(rec, r)
+}
+
+// tooMany answers a request over a rate limit.
+func (g *guard) tooMany(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+	writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": "rate limit exceeded"})
+}
+
+// authenticate identifies the client. Without configured credentials every client is
+// allowed and named by its address, host.
+func (g *guard) authenticate(r *http.Request, host string) (client, auth string, ok bool) {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 && g.opts.ClientCert {
+		// The TLS handshake has verified the certificate against the client CAs.
+		cert := r.TLS.PeerCertificates[0]
+		name := cert.Subject.CommonName
+		if name == "" && len(cert.DNSNames) > 0 {
+			name = cert.DNSNames[0]
+		}
+		return name, "client-cert", true
+	}
+	if key := apiKey(r); key != "" && len(g.opts.APIKeys) > 0 {
+		sum := sha256.Sum256([]byte(key))
+		given := hex.EncodeToString(sum[:])
+		for _, k := range g.opts.APIKeys {
+			if subtle.ConstantTimeCompare([]byte(given), []byte(k.SHA256)) == 1 {
+				return k.Client, "api-key", true
+			}
+		}
+		return "", "api-key", false
+	}
+	return host, "none", len(g.opts.APIKeys) == 0 && !g.opts.ClientCert
+}
+
+// apiKey reads the key from "Authorization: Bearer <key>" or X-API-Key.
+func apiKey(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// allow takes a token from the bucket of key in l, or says how long until one is there.
+func (g *guard) allow(l *limiter, key string) (time.Duration, bool) {
+	if l.rate <= 0 {
+		return 0, true
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	perSecond := l.rate / 60
+	if len(l.buckets) >= maxBuckets {
+		// Buckets that have refilled are no different from new ones.
+		for name, b := range l.buckets {
+			if now.Sub(b.last).Seconds()*perSecond >= float64(l.burst) {
+				delete(l.buckets, name)
+			}
+		}
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(l.burst), b.tokens+now.Sub(b.last).Seconds()*perSecond)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / perSecond * float64(time.Second)), false
+	}
+	b.tokens--
+	return 0, true
+}
+
+func (g *guard) audit(entry auditEntry) {
+	if g.opts.Audit == nil {
+		return
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, err := g.opts.Audit.Write(append(line, '\n')); err != nil {
+		log.Println("❌ Error writing audit log:", err)
+	}
+}
+
+// statusRecorder remembers the status a handler answered with.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// countingBody counts and hashes the request body as the handler reads it.
+type countingBody struct {
+	io.ReadCloser
+	hash hash.Hash
+	n    int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	b.hash.Write(p[:n])
+	return n, err
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"net/http"
+
+	"config-validator/pkg/buildinfo"
+	"config-validator/pkg/config"
+)
+
+// HealthHandler answers liveness probes (GET /healthz): the process is up and serving.
+func HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+}
+
+// ReadyHandler answers readiness probes (GET /readyz): the server is ready once its
+// rules are loaded and compiled, which the Reloader dry-runs before swapping a set
+// in. A rejected reload leaves the previous rules in use, so it does not make the
+// server unready, but it is reported.
+func ReadyHandler(rules *config.Reloader) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rs := rules.Current()
+		if rs == nil {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "not ready", "error": "no rules loaded"})
+			return
+		}
+		body := map[string]any{"status": "ready", "rules_version": rs.Version}
+		if err := rules.LastError(); err != "" {
+			body["last_reload_error"] = err
+		}
+		writeJSON(w, http.StatusOK, body)
+	})
+}
+
+// BuildInfo is the answer to GET /buildinfo and the output of the version command.
+type BuildInfo struct {
+	buildinfo.Info
+	Rules *RulesBuild `json:"rules,omitempty"`
+}
+
+// RulesBuild identifies the rules in use down to their files' hashes.
+type RulesBuild struct {
+	File    string              `json:"file"`
+	Version string              `json:"version"`
+	Sources []config.SourceHash `json:"sources"`
+	Error   string              `json:"error,omitempty"` // why the sources could not be hashed
+}
+
+// BuildInfoHandler describes the binary and the rules in use (GET /buildinfo).
+func BuildInfoHandler(rules *config.Reloader) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, NewBuildInfo(rules.Current()))
+	})
+}
+
+// NewBuildInfo describes the binary and, when rs is not nil, the rules it loaded.
+func NewBuildInfo(rs *config.RuleSet) BuildInfo {
+	info := BuildInfo{Info: buildinfo.Get()}
+	if rs != nil {
+		info.Rules = &RulesBuild{File: rs.File, Version: rs.Version}
+		sources, err := rs.SourceHashes()
+		if err != nil {
+			info.Rules.Error = err.Error()
+		}
+		info.Rules.Sources = sources
+	}
+	return info
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+
+	"gopkg.in/yaml.v3"
+)
+
+// OpenAPISpec is the OpenAPI 3 document describing the REST API. It is the contract
+// clients are generated from (see the Makefile), so keep it in step with the handlers.
+//
+//go:embed openapi.yaml
+var OpenAPISpec []byte
+
+// openAPIJSON is OpenAPISpec converted to JSON, for tools that do not read YAML.
+var openAPIJSON = func() []byte {
+	var doc any
+	if err := yaml.Unmarshal(OpenAPISpec, &doc); err != nil {
+		panic("server: invalid openapi.yaml: " + err.Error())
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		panic("server: openapi.yaml does not convert to JSON: " + err.Error())
+	}
+	return data
+}()
+
+// OpenAPIHandler serves the OpenAPI document, as YAML or JSON (GET /openapi.yaml,
+// GET /openapi.json).
+func OpenAPIHandler(asJSON bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if asJSON {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(openAPIJSON)
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(OpenAPISpec)
+	})
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"config-validator/pkg/queue"
+	"config-validator/pkg/telemetry"
+)
+
+// QueueOptions bound the requests a server works on and holds at once, so a burst
+// of traffic is answered with 503s or waits instead of exhausting memory.
+type QueueOptions struct {
+	Workers int          // requests handled at once
+	Depth   int          // requests waiting for a worker; Workers when zero
+	Policy  queue.Policy // what happens to a request that finds the queue full
+	// Public are paths served without queueing, such as the health probes of an
+	// orchestrator, which must answer while the server is busy.
+	Public []string
+}
+
+// RequestQueue admits requests to a handler through a bounded queue. A nil
+// RequestQueue admits every request at once.
+type RequestQueue struct {
+	opts     QueueOptions
+	q        *queue.Queue[*queuedRequest]
+	busy     atomic.Int64
+	served   atomic.Int64
+	lastWarn atomic.Int64 // unix nanoseconds of the last overflow warning
+}
+
+// queuedRequest is a request waiting for a worker.
+type queuedRequest struct {
+	turn chan bool     // true when a worker takes the request, false when it is shed
+	done chan struct{} // closed when the request has been answered
+}
+
+// overflowWarnEvery is how often a full queue is logged while it overflows.
+const overflowWarnEvery = 10 * time.Second
+
+// NewRequestQueue starts the workers of a request queue.
+func NewRequestQueue(opts QueueOptions) *RequestQueue {
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	if opts.Depth < 1 {
+		opts.Depth = opts.Workers
+	}
+	if opts.Policy == "" {
+		opts.Policy = queue.Block
+	}
+	rq := &RequestQueue{opts: opts}
+	rq.q = queue.New(opts.Depth, opts.Policy, func(req *queuedRequest) { req.turn <- false })
+	for i := 0; i < opts.Workers; i++ {
+		go rq.work()
+	}
+	return rq
+}
+
+func (rq *RequestQueue) work() {
+	for {
+		req, _ := rq.q.Get(context.Background())
+		req.turn <- true
+		rq.busy.Add(1)
+		<-req.done
+		rq.busy.Add(-1)
+	}
+}
+
+// Wrap queues the requests to a handler.
+func (rq *RequestQueue) Wrap(next http.Handler) http.Handler {
+	if rq == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, p := range rq.opts.Public {
+			if r.URL.Path == p {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		req := &queuedRequest{turn: make(chan bool, 1), done: make(chan struct{})}
+		// A worker that takes a request whose client gave up finds it done at once.
+		defer close(req.done)
+		if err := rq.q.Put(r.Context(), req); err != nil {
+			if errors.Is(err, queue.ErrFull) {
+				rq.overflow(w, "server is busy: the request queue is full")
+			}
+			return
+		}
+		select {
+		case run := <-req.turn:
+			if !run {
+				rq.overflow(w, "server is busy: the request was shed for newer ones")
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		rq.served.Add(1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// overflow answers a request the queue had no room for, counting it and warning
+// now and then while the queue overflows.
+func (rq *RequestQueue) overflow(w http.ResponseWriter, msg string) {
+	telemetry.Add(telemetry.QueueOverflowCounter, "policy", string(rq.opts.Policy), 1)
+	now, last := time.Now().UnixNano(), rq.lastWarn.Load()
+	if now-last >= int64(overflowWarnEvery) && rq.lastWarn.CompareAndSwap(last, now) {
+		st := rq.q.Stats()
+		log.Printf("⚠️  Request queue full (%d workers, %d waiting): %d dropped and %d shed so far", rq.opts.Workers, st.Len, st.Dropped, st.Shed)
+	}
+	w.Header().Set("Retry-After", "1")
+	writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": msg})
+}
+
+// WriteMetrics writes the queue's gauges and counters in the Prometheus text format.
+func (rq *RequestQueue) WriteMetrics(w io.Writer) {
+	if rq == nil {
+		return
+	}
+	st := rq.q.Stats()
+	fmt.Fprintln(w, "# HELP config_validator_queue_workers Requests handled at once.")
+	fmt.Fprintln(w, "# TYPE config_validator_queue_workers gauge")
+	fmt.Fprintf(w, "config_validator_queue_workers %d\n", rq.opts.Workers)
+	fmt.Fprintln(w, "# HELP config_validator_queue_busy_workers Workers handling a request.")
+	fmt.Fprintln(w, "# TYPE config_validator_queue_busy_workers gauge")
+	fmt.Fprintf(w, "config_validator_queue_busy_workers %d\n", rq.busy.Load())
+	fmt.Fprintln(w, "# HELP config_validator_queue_depth Requests that may wait for a worker.")
+	fmt.Fprintln(w, "# TYPE config_validator_queue_depth gauge")
+	fmt.Fprintf(w, "config_validator_queue_depth %d\n", st.Depth)
+	fmt.Fprintln(w, "# HELP config_validator_queue_waiting Requests waiting for a worker.")
+	fmt.Fprintln(w, "# TYPE config_validator_queue_waiting gauge")
+	fmt.Fprintf(w, "config_validator_queue_waiting %d\n", st.Len)
+	fmt.Fprintln(w, "# HELP config_validator_queue_requests_total Queued requests by what became of them.")
+	fmt.Fprintln(w, "# TYPE config_validator_queue_requests_total counter")
+	fmt.Fprintf(w, "config_validator_queue_requests_total{result=\"served\"} %d\n", rq.served.Load())
+	fmt.Fprintf(w, "config_validator_queue_requests_total{result=\"dropped\"} %d\n", st.Dropped)
+	fmt.Fprintf(w, "config_validator_queue_requests_total{result=\"shed\"} %d\n", st.Shed)
+	fmt.Fprintln(w, "# HELP config_validator_queue_blocked_total Requests that waited for room in the queue.")
+	fmt.Fprintln(w, "# TYPE config_validator_queue_blocked_total counter")
+	fmt.Fprintf(w, "config_validator_queue_blocked_total %d\n", st.Blocked)
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"net/http"
+
+	"config-validator/pkg/config"
+)
+
+// ReloadHandler reloads the rules on request (POST /-/reload). It answers with the
+// version in use, and 422 with the reason when the new rules were rejected.
+func ReloadHandler(rules *config.Reloader) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := rules.Reload()
+		rs := rules.Current()
+		body := map[string]any{"version": rs.Version, "file": rs.File, "loaded_at": rs.LoadedAt}
+		if err != nil {
+			body["error"] = err.Error()
+			writeJSON(w, http.StatusUnprocessableEntity, body)
+			return
+		}
+		writeJSON(w, http.StatusOK, body)
+	})
+}
+
+// MetricsHandler serves the rules reload metrics, and those of the request queue
+// when there is one, in the Prometheus text format.
+func MetricsHandler(rules *config.Reloader, queue *RequestQueue) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		rules.WriteMetrics(w)
+		queue.WriteMetrics(w)
+	})
+}
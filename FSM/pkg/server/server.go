@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"config-validator/pkg/history"
+)
+
+// Server exposes validation results over a small read-only REST API.
+type Server struct {
+	store *history.Store
+	mux   *http.ServeMux
+}
+
+// runSummary is a run without its per-device drill-down.
+type runSummary struct {
+	ID          string    `json:"id"`
+	Started     time.Time `json:"started"`
+	Finished    time.Time `json:"finished"`
+	Status      string    `json:"status"`
+	Total       int       `json:"total"`
+	Passed      int       `json:"passed"`
+	Failed      int       `json:"failed"`
+	Unreachable int       `json:"unreachable"`
+}
+
+// New returns a Server that answers from the given history store.
+func New(store *history.Store) *Server {
+	s := &Server{store: store, mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /api/v1/devices", s.handleDevices)
+	s.mux.HandleFunc("GET /api/v1/devices/{name}", s.handleDevice)
+	s.mux.HandleFunc("GET /api/v1/runs", s.handleRuns)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// handleDevices returns the latest status of every device.
+func (s *Server) handleDevices(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.store.Latest())
+}
+
+// handleDevice returns the latest status of one device plus its full history.
+func (s *Server) handleDevice(w http.ResponseWriter, r *http.Request) {
+	statuses := s.store.Device(r.PathValue("name"))
+	if len(statuses) == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown device"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"latest":  statuses[len(statuses)-1],
+		"history": statuses,
+	})
+}
+
+// handleRuns lists every recorded run with its fleet-level totals.
+func (s *Server) handleRuns(w http.ResponseWriter, r *http.Request) {
+	runs := s.store.Runs()
+	out := make([]runSummary, 0, len(runs))
+	for _, run := range runs {
+		sum := runSummary{ID: run.ID, Started: run.Started, Finished: run.Finished}
+		if run.Report != nil {
+			sum.Status = run.Report.Status
+			sum.Total = run.Report.Total
+			sum.Passed = run.Report.Passed
+			sum.Failed = run.Report.Failed
+			sum.Unreachable = run.Report.Unreachable
+		}
+		out = append(out, sum)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
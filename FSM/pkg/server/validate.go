@@ -0,0 +1,98 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/config"
+	"config-validator/pkg/telemetry"
+	"config-validator/pkg/validation"
+)
+
+// validateResult is the answer to POST /api/v1/validate.
+type validateResult struct {
+	Status       string             `json:"status"` // success or failed
+	Protocol     string             `json:"protocol"`
+	Score        int                `json:"score"`
+	Grade        string             `json:"grade"`
+	Errors       []string           `json:"errors"`
+	Findings     []automata.Finding `json:"findings"`
+	RulesVersion string             `json:"rules_version,omitempty"` // for cisco-config
+}
+
+// rulesInfo is the answer to GET /api/v1/rules.
+type rulesInfo struct {
+	File      string    `json:"file"`
+	Version   string    `json:"version"`
+	LoadedAt  time.Time `json:"loaded_at"`
+	Sources   []string  `json:"sources"`
+	LastError string    `json:"last_error,omitempty"` // why the last reload was rejected
+}
+
+// ValidateHandler validates the request body (POST /api/v1/validate). The protocol
+// query parameter selects how: cisco-config (the default) runs it through the FSM
+// with the current rules, json checks JSON syntax.
+func ValidateHandler(rules *config.Reloader) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "failed to read body: " + err.Error()})
+			return
+		}
+		ctx, span := telemetry.StartKind(telemetry.WithTraceparent(r.Context(), r.Header.Get("traceparent")), "POST /api/v1/validate", telemetry.KindServer)
+		defer span.End()
+		result := validateResult{Protocol: r.URL.Query().Get("protocol")}
+		span.SetAttr("validator.protocol", result.Protocol)
+		switch result.Protocol {
+		case "", "cisco-config":
+			rs := rules.Current()
+			fsm, err := rs.ParseContext(ctx, bytes.NewReader(body))
+			if err != nil {
+				span.SetError(err)
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+				return
+			}
+			result.Protocol, result.RulesVersion, result.Findings = "cisco-config", rs.Version, fsm.Findings
+		case "json":
+			_, checkSpan := telemetry.Start(ctx, "json.check")
+			result.Findings = validation.CheckJSON(body)
+			checkSpan.EndStage()
+		default:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unknown protocol '" + result.Protocol + "', want cisco-config or json"})
+			return
+		}
+		if result.Findings == nil {
+			result.Findings = []automata.Finding{}
+		}
+		result.Errors = validation.FormatFindings(result.Findings)
+		if result.Errors == nil {
+			result.Errors = []string{}
+		}
+		result.Status = "success"
+		if len(result.Findings) > 0 {
+			result.Status = "failed"
+		}
+		result.Score = validation.Score(result.Findings)
+		result.Grade = validation.Grade(result.Score)
+		_, encodeSpan := telemetry.Start(ctx, "report.encode")
+		writeJSON(w, http.StatusOK, result)
+		encodeSpan.EndStage()
+	})
+}
+
+// RulesHandler describes the rule set in use (GET /api/v1/rules).
+func RulesHandler(rules *config.Reloader) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rs := rules.Current()
+		writeJSON(w, http.StatusOK, rulesInfo{
+			File:      rs.File,
+			Version:   rs.Version,
+			LoadedAt:  rs.LoadedAt,
+			Sources:   rs.Sources,
+			LastError: rules.LastError(),
+		})
+	})
+}
@@ -0,0 +1,130 @@
+package session
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/script"
+)
+
+// MachineStart is the state a session machine starts in, as the config FSM starts
+// in GLOBAL.
+const MachineStart = "GLOBAL"
+
+// Machine is the state machine of a session protocol, declared in a YAML file in
+// the format of rules.yaml and loaded with the same loader, so `extends:`,
+// `override:`, `remove:`, and script checks work as they do for configs. Each state
+// lists the events it allows; an event is a line prefixed with the side that sent
+// it, as in a transcript ("C: MAIL FROM:<a@example.com>", "S: 354 go ahead"), and a
+// rule's `next:` moves the session to another state when it matches. The first
+// rule that matches in the current state applies. A client line no rule of the
+// state allows is a finding; server lines that match nothing are ignored, as
+// servers send much that the order of a session does not depend on.
+//
+//	GLOBAL:
+//	  - {pattern: "^S: 220 ", next: READY}
+//	READY:
+//	  - {pattern: "^C: (?i)QUIT$", next: CLOSING}
+//	CLOSING: []
+type Machine struct {
+	Name   string // from the file name, for reports
+	states map[string][]transition
+}
+
+type transition struct {
+	re    *regexp.Regexp
+	next  string
+	check automata.Check
+}
+
+// LoadMachine loads a session machine from a YAML file, with the scripts its rules
+// reference, and checks that it has a GLOBAL state and that every `next:` names one
+// of its states.
+func LoadMachine(path string) (*Machine, error) {
+	rules, err := automata.LoadRules(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session machine from %s: %v", path, err)
+	}
+	if err := script.NewLoader(filepath.Dir(path)).Attach(rules); err != nil {
+		return nil, fmt.Errorf("failed to load rule scripts: %v", err)
+	}
+	if _, ok := rules[MachineStart]; !ok {
+		return nil, fmt.Errorf("%s: session machine has no %s state to start in", path, MachineStart)
+	}
+	states := make([]string, 0, len(rules))
+	for state := range rules {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+	m := &Machine{Name: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), states: map[string][]transition{}}
+	for _, state := range states {
+		m.states[state] = []transition{} // states without rules still exist
+		for _, rule := range rules[state] {
+			if rule.Fallback != "" {
+				return nil, fmt.Errorf("%s: state %s falls back to %s, which session machines do not do", path, state, rule.Fallback)
+			}
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compile regex '%s' for state '%s': %v", rule.Pattern, state, err)
+			}
+			if _, ok := rules[rule.Next]; rule.Next != "" && !ok {
+				return nil, fmt.Errorf("%s: rule '%s' of state %s moves to state %s, which is not defined", path, rule.Pattern, state, rule.Next)
+			}
+			if rule.Wasm != "" {
+				return nil, fmt.Errorf("%s: rule '%s' of state %s has a wasm check, which session machines do not run", path, rule.Pattern, state)
+			}
+			m.states[state] = append(m.states[state], transition{re: re, next: rule.Next, check: rule.Check})
+		}
+	}
+	return m, nil
+}
+
+// Check runs the machine over the events of a session and returns its findings.
+// Literals are not events of their own; they belong to the line announcing them.
+func (m *Machine) Check(events []Event) []automata.Finding {
+	var findings []automata.Finding
+	state := MachineStart
+	for _, e := range events {
+		if e.Literal {
+			continue
+		}
+		text := "S: " + e.Text
+		if e.Client {
+			text = "C: " + e.Text
+		}
+		t, groups := m.match(state, text)
+		if t == nil {
+			if e.Client {
+				findings = append(findings, e.Finding(state, excerpt(e.Text), automata.SeverityError,
+					fmt.Sprintf("%q is not allowed in the %s state", excerpt(e.Text), state)))
+			}
+			continue
+		}
+		if t.check != nil {
+			msgs, err := t.check(automata.CheckContext{Line: text, LineNum: e.Line, State: state, Groups: groups})
+			if err != nil {
+				msgs = append(msgs, fmt.Sprintf("check failed: %v", err))
+			}
+			for _, msg := range msgs {
+				findings = append(findings, e.Finding(state, excerpt(e.Text), automata.SeverityError, msg))
+			}
+		}
+		if t.next != "" {
+			state = t.next
+		}
+	}
+	return findings
+}
+
+func (m *Machine) match(state, text string) (*transition, []string) {
+	for i, t := range m.states[state] {
+		if groups := t.re.FindStringSubmatch(text); groups != nil {
+			return &m.states[state][i], groups
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,174 @@
+// Package session turns a conversation of a text protocol, from a transcript or a
+// TCP connection reassembled from a capture, into the lines each side sent in the
+// order they were sent. Validators of session protocols such as POP3 and IMAP run
+// their state machines over these events.
+package session
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/capture"
+)
+
+// State is the state reported in findings about transcripts.
+const State = "TRANSCRIPT"
+
+// Chunk is data one side sent.
+type Chunk struct {
+	Client bool
+	Data   []byte
+	Line   int // line of the transcript it came from, or 0
+	Packet int // number of the captured packet it came in, or 0
+}
+
+// Event is a line, or the data of a literal, sent by one side.
+type Event struct {
+	Client bool
+	Text   string // without the line ending
+	Line   int    // where it started, as in Chunk
+	Packet int
+
+	Literal     bool // Text is the data of a literal announced by the line before
+	LiteralSize int  // size of the literal the line announces, or -1
+	NonSync     bool // the literal is non-synchronizing ({n+}), so sent without waiting
+	BareLF      bool // the line ends in LF without CR
+	Partial     bool // the conversation ended before the line or literal did
+}
+
+// Where describes where an event came from for findings that have no line.
+func (e Event) Where() string {
+	if e.Packet > 0 {
+		return fmt.Sprintf("packet %d", e.Packet)
+	}
+	return ""
+}
+
+// Finding returns a finding about the event.
+func (e Event) Finding(state, command, severity, msg string) automata.Finding {
+	if where := e.Where(); where != "" {
+		msg = where + ": " + msg
+	}
+	return automata.Finding{Line: e.Line, Command: command, State: state, Message: msg, Severity: severity, Packet: e.Packet}
+}
+
+// ParseTranscript reads a transcript in the style of the RFCs: each line starts with
+// "C:" for the client or "S:" for the server, followed by an optional space and what
+// was sent. Blank lines and lines starting with '#' are skipped.
+func ParseTranscript(content []byte) ([]Chunk, []automata.Finding) {
+	var chunks []Chunk
+	var findings []automata.Finding
+	for i, line := range bytes.Split(content, []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if len(bytes.TrimSpace(line)) == 0 || line[0] == '#' {
+			continue
+		}
+		var client bool
+		switch {
+		case bytes.HasPrefix(line, []byte("C:")):
+			client = true
+		case bytes.HasPrefix(line, []byte("S:")):
+		default:
+			findings = append(findings, automata.Finding{Line: i + 1, Command: excerpt(string(line)), State: State,
+				Severity: automata.SeverityError, Message: "transcript line does not start with C: or S:"})
+			continue
+		}
+		data := bytes.TrimPrefix(line[2:], []byte(" "))
+		chunks = append(chunks, Chunk{Client: client, Data: append(append([]byte{}, data...), '\r', '\n'), Line: i + 1})
+	}
+	return chunks, findings
+}
+
+// FromConversation interleaves the two sides of a captured connection in the order
+// their packets were captured.
+func FromConversation(c *capture.Conversation) []Chunk {
+	var chunks []Chunk
+	for _, side := range []struct {
+		st     *capture.Stream
+		client bool
+	}{{&c.Client, true}, {&c.Server, false}} {
+		for i, m := range side.st.Marks {
+			end := len(side.st.Data)
+			if i+1 < len(side.st.Marks) {
+				end = side.st.Marks[i+1].Offset
+			}
+			chunks = append(chunks, Chunk{Client: side.client, Data: side.st.Data[m.Offset:end], Packet: m.Number})
+		}
+	}
+	sort.SliceStable(chunks, func(i, j int) bool { return chunks[i].Packet < chunks[j].Packet })
+	return chunks
+}
+
+// literalRe matches the literal a line ends with: {n}, {n+}, and the binary ~{n}.
+var literalRe = regexp.MustCompile(`~?\{([0-9]+)(\+?)\}$`)
+
+// side is the splitting state of one side.
+type side struct {
+	buf          []byte
+	line, packet int // where buf started
+	literal      int // bytes of literal data still to come
+	inLiteral    bool
+}
+
+// Events splits the chunks into lines, in the order the chunks were sent. With
+// literals, a line ending in {n} is followed by n bytes of literal data, as in IMAP;
+// the data is an event of its own, and the line goes on after it as another event.
+func Events(chunks []Chunk, literals bool) []Event {
+	var events []Event
+	sides := map[bool]*side{true: {}, false: {}}
+	for _, c := range chunks {
+		s := sides[c.Client]
+		if len(s.buf) == 0 {
+			s.line, s.packet = c.Line, c.Packet
+		}
+		s.buf = append(s.buf, c.Data...)
+		for {
+			e := Event{Client: c.Client, Line: s.line, Packet: s.packet, LiteralSize: -1}
+			if s.inLiteral {
+				if len(s.buf) < s.literal {
+					break
+				}
+				e.Text, e.Literal = string(s.buf[:s.literal]), true
+				s.buf, s.inLiteral = s.buf[s.literal:], false
+			} else {
+				i := bytes.IndexByte(s.buf, '\n')
+				if i < 0 {
+					break
+				}
+				line := s.buf[:i]
+				s.buf = s.buf[i+1:]
+				if !bytes.HasSuffix(line, []byte("\r")) {
+					e.BareLF = true
+				}
+				e.Text = string(bytes.TrimSuffix(line, []byte("\r")))
+				if m := literalRe.FindStringSubmatch(e.Text); literals && m != nil {
+					n, err := strconv.Atoi(m[1])
+					if err == nil {
+						e.LiteralSize, e.NonSync = n, m[2] == "+"
+						s.literal, s.inLiteral = n, true
+					}
+				}
+			}
+			events = append(events, e)
+			s.line, s.packet = c.Line, c.Packet
+		}
+	}
+	for _, client := range []bool{true, false} {
+		if s := sides[client]; len(s.buf) > 0 || s.inLiteral {
+			events = append(events, Event{Client: client, Text: string(s.buf), Line: s.line, Packet: s.packet,
+				Literal: s.inLiteral, LiteralSize: -1, Partial: true})
+		}
+	}
+	return events
+}
+
+func excerpt(s string) string {
+	if len(s) > 60 {
+		return s[:57] + "..."
+	}
+	return s
+}
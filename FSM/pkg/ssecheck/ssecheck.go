@@ -0,0 +1,183 @@
+// Package ssecheck validates Server-Sent Events streams (text/event-stream): field
+// lines, the values of the fields browsers interpret, and events separated by blank
+// lines. A Checker validates a stream as it arrives, so a live stream proxied to a
+// client is checked without buffering it or waiting for it to end.
+package ssecheck
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"config-validator/pkg/automata"
+)
+
+// State is the state reported in event stream findings.
+const State = "SSE"
+
+// MaxLine is the longest line checked; the rest of a longer line is skipped.
+const MaxLine = 1 << 20
+
+// Checker validates an event stream written to it in chunks of any size.
+type Checker struct {
+	report  func(automata.Finding)
+	line    int    // number of the line being read
+	buf     []byte // the line being read
+	skip    bool   // the line being read is over MaxLine
+	afterCR bool   // the last chunk ended with CR, so a leading LF ends no line
+	started bool   // the first line was read, past any byte order mark
+
+	// The event being read
+	eventLine int // its first line; 0 between events
+	hasData   bool
+	eventType string
+}
+
+// NewChecker returns a checker passing each finding to report as soon as it is found.
+func NewChecker(report func(automata.Finding)) *Checker {
+	return &Checker{report: report, line: 1}
+}
+
+// Check returns the findings for a whole event stream.
+func Check(body []byte) []automata.Finding {
+	var findings []automata.Finding
+	c := NewChecker(func(f automata.Finding) { findings = append(findings, f) })
+	c.Write(body)
+	c.Close()
+	return findings
+}
+
+func (c *Checker) add(line int, command, severity, msg string) {
+	c.report(automata.Finding{Line: line, Command: command, State: State, Message: msg, Severity: severity})
+}
+
+// Write checks the lines a chunk completes. It never fails.
+func (c *Checker) Write(p []byte) (int, error) {
+	n := len(p)
+	if c.afterCR && len(p) > 0 && p[0] == '\n' {
+		p = p[1:]
+	}
+	c.afterCR = false
+	for len(p) > 0 {
+		i := bytes.IndexAny(p, "\r\n")
+		if i < 0 {
+			c.append(p)
+			break
+		}
+		c.append(p[:i])
+		if p[i] == '\r' {
+			if i+1 == len(p) {
+				c.afterCR = true
+			} else if p[i+1] == '\n' {
+				i++
+			}
+		}
+		p = p[i+1:]
+		c.endLine()
+	}
+	return n, nil
+}
+
+func (c *Checker) append(p []byte) {
+	if c.skip {
+		return
+	}
+	if len(c.buf)+len(p) > MaxLine {
+		c.add(c.line, "", automata.SeverityWarning, fmt.Sprintf("line is longer than %d bytes; the rest of it is not checked", MaxLine))
+		c.buf = append(c.buf, p[:MaxLine-len(c.buf)]...)
+		c.skip = true
+		return
+	}
+	c.buf = append(c.buf, p...)
+}
+
+// Close ends the stream, reporting an event it leaves undispatched.
+func (c *Checker) Close() {
+	if len(c.buf) > 0 || c.skip {
+		// A last line without a line ending is never processed by browsers
+		c.add(c.line, excerpt(c.buf), automata.SeverityWarning, "stream ends in the middle of a line, which is discarded")
+		c.buf, c.skip = nil, false
+	}
+	if c.eventLine > 0 {
+		c.add(c.eventLine, "", automata.SeverityWarning, "stream ends before the blank line that dispatches the last event, so it is never dispatched")
+		c.eventLine = 0
+	}
+}
+
+// endLine processes the line read.
+func (c *Checker) endLine() {
+	line, n := c.buf, c.line
+	c.buf, c.skip = c.buf[:0], false
+	c.line++
+	if !c.started {
+		c.started = true
+		line = bytes.TrimPrefix(line, []byte("\ufeff"))
+	}
+	text := string(line)
+	if !utf8.Valid(line) {
+		c.add(n, excerpt(line), automata.SeverityError, "line is not valid UTF-8, which event streams must be")
+		text = strings.ToValidUTF8(text, "\uFFFD")
+	}
+
+	if text == "" {
+		c.dispatch(n)
+		return
+	}
+	if text[0] == ':' {
+		return // a comment, often sent as a keep-alive
+	}
+	if c.eventLine == 0 {
+		c.eventLine = n
+	}
+
+	name, value, hasColon := strings.Cut(text, ":")
+	value = strings.TrimPrefix(value, " ")
+	switch name {
+	case "data":
+		c.hasData = true
+	case "event":
+		c.eventType = value
+		if value == "" {
+			c.add(n, text, automata.SeverityWarning, "empty event type; the event is dispatched as \"message\"")
+		}
+	case "id":
+		if strings.ContainsRune(value, 0) {
+			c.add(n, text, automata.SeverityError, "event id contains NUL, so browsers ignore it")
+		}
+	case "retry":
+		if value == "" || strings.Trim(value, "0123456789") != "" {
+			c.add(n, text, automata.SeverityError, fmt.Sprintf("retry must be an integer number of milliseconds, not %q; browsers ignore it", value))
+		}
+	default:
+		switch {
+		case strings.TrimLeft(name, " \t") != name && isField(strings.TrimLeft(name, " \t")):
+			c.add(n, text, automata.SeverityError, fmt.Sprintf("field %q starts with whitespace, so it is not recognized", strings.TrimLeft(name, " \t")))
+		case !hasColon:
+			c.add(n, text, automata.SeverityWarning, fmt.Sprintf("line %q has no ':', so it is an unknown field and ignored", excerpt(line)))
+		default:
+			c.add(n, text, automata.SeverityWarning, fmt.Sprintf("unknown field %q is ignored; fields are data, event, id, and retry", name))
+		}
+	}
+}
+
+// dispatch ends the event read at the blank line n.
+func (c *Checker) dispatch(n int) {
+	if c.eventLine > 0 && !c.hasData && c.eventType != "" {
+		c.add(c.eventLine, "event: "+c.eventType, automata.SeverityWarning,
+			fmt.Sprintf("event %q has no data lines, so it is not dispatched", c.eventType))
+	}
+	c.eventLine, c.hasData, c.eventType = 0, false, ""
+}
+
+func isField(name string) bool {
+	return name == "data" || name == "event" || name == "id" || name == "retry"
+}
+
+// excerpt shortens a line for findings.
+func excerpt(line []byte) string {
+	if len(line) > 60 {
+		return string(line[:57]) + "..."
+	}
+	return string(line)
+}
@@ -0,0 +1,383 @@
+// Package sshcheck validates the clear-text start of an SSH connection (RFC 4253):
+// the version exchange, the binary packet framing used until keys are taken into
+// use, and the KEXINIT messages with their algorithm name-lists. The two sides'
+// KEXINITs are also checked against each other, as a connection fails when they
+// have no algorithm in common.
+package sshcheck
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"config-validator/pkg/automata"
+)
+
+// State is the state reported in SSH findings.
+const State = "SSH"
+
+// MaxPacket is the largest packet every implementation must accept.
+const MaxPacket = 35000
+
+// Message numbers of the transport layer.
+const (
+	msgDisconnect = 1
+	msgIgnore     = 2
+	msgUnimpl     = 3
+	msgDebug      = 4
+	msgKexInit    = 20
+	msgNewKeys    = 21
+)
+
+// Lists names the name-lists of KEXINIT, in order.
+var Lists = [10]string{
+	"kex_algorithms",
+	"server_host_key_algorithms",
+	"encryption_algorithms_client_to_server",
+	"encryption_algorithms_server_to_client",
+	"mac_algorithms_client_to_server",
+	"mac_algorithms_server_to_client",
+	"compression_algorithms_client_to_server",
+	"compression_algorithms_server_to_client",
+	"languages_client_to_server",
+	"languages_server_to_client",
+}
+
+// KexInit is a decoded KEXINIT message.
+type KexInit struct {
+	Offset          int // of the packet in the stream
+	Lists           [10][]string
+	FirstKexFollows bool
+}
+
+// Endpoint is what was learned from one side of a connection.
+type Endpoint struct {
+	Version string // identification string, without CR LF
+	KexInit *KexInit
+	Checked int // bytes checked; the rest is encrypted or not SSH
+}
+
+// checker collects findings about one side's stream.
+type checker struct {
+	findings []automata.Finding
+}
+
+func (c *checker) add(offset int, command, severity, format string, args ...any) {
+	c.findings = append(c.findings, automata.Finding{Command: command, State: State, Severity: severity,
+		Message: fmt.Sprintf("offset %d: %s", offset, fmt.Sprintf(format, args...))})
+}
+
+// Check validates what one side of a connection sent. server tells which side it
+// is, as only servers may send lines before their version.
+func Check(data []byte, server bool) (Endpoint, []automata.Finding) {
+	c := &checker{}
+	var e Endpoint
+	pos, ok := c.version(data, server, &e)
+	if ok {
+		pos = c.packets(data, pos, &e)
+	}
+	e.Checked = pos
+	return e, c.findings
+}
+
+// version checks the lines up to and including the version line, returning where
+// the binary packets start and whether they follow SSH 2.
+func (c *checker) version(data []byte, server bool, e *Endpoint) (int, bool) {
+	pos := 0
+	for {
+		if pos == len(data) {
+			c.add(pos, "", automata.SeverityError, "stream ends before the version line")
+			return pos, false
+		}
+		end := bytes.IndexByte(data[pos:], '\n')
+		if end < 0 || end+1 > 255 {
+			n := len(data) - pos
+			if end >= 0 || n > 255 {
+				c.add(pos, "", automata.SeverityError, "line is longer than 255 bytes; the version line and the lines before it are limited to 255, including CR LF")
+			} else {
+				c.add(pos, excerpt(data[pos:]), automata.SeverityError, "stream ends before the line is terminated by CR LF")
+			}
+			return pos, false
+		}
+		line := data[pos : pos+end]
+		next := pos + end + 1
+		if !bytes.HasSuffix(line, []byte("\r")) {
+			c.add(pos, excerpt(line), automata.SeverityWarning, "line ends in a bare LF; RFC 4253 requires CR LF")
+		}
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if !bytes.HasPrefix(line, []byte("SSH-")) {
+			if !server {
+				c.add(pos, excerpt(line), automata.SeverityError, "client sent a line before its version; only servers may")
+			}
+			if bytes.IndexByte(line, 0) >= 0 {
+				c.add(pos, excerpt(line), automata.SeverityError, "line before the version contains NUL")
+			}
+			pos = next
+			continue
+		}
+		e.Version = string(line)
+		return next, c.versionLine(pos, string(line), server)
+	}
+}
+
+// versionLine checks SSH-protoversion-softwareversion SP comments.
+func (c *checker) versionLine(offset int, line string, server bool) bool {
+	id, comments, hasComments := strings.Cut(line, " ")
+	parts := strings.SplitN(id, "-", 3)
+	if len(parts) < 3 {
+		c.add(offset, excerpt([]byte(line)), automata.SeverityError, "version line is not SSH-protoversion-softwareversion")
+		return false
+	}
+	proto, software := parts[1], parts[2]
+	if strings.IndexByte(line, 0) >= 0 {
+		c.add(offset, excerpt([]byte(line)), automata.SeverityError, "version line contains NUL")
+	}
+	if software == "" {
+		c.add(offset, id, automata.SeverityError, "software version is empty")
+	}
+	for _, r := range software {
+		if r < 0x21 || r > 0x7e || r == '-' {
+			c.add(offset, id, automata.SeverityError, "software version %q must be printable US-ASCII without whitespace or '-'", software)
+			break
+		}
+	}
+	if hasComments && comments == "" {
+		c.add(offset, excerpt([]byte(line)), automata.SeverityWarning, "version line has a space but no comments")
+	}
+
+	switch {
+	case proto == "2.0":
+		return true
+	case proto == "1.99" && server:
+		c.add(offset, id, automata.SeverityWarning, "protocol version 1.99 offers compatibility with SSH 1, which is broken")
+		return true
+	case strings.HasPrefix(proto, "1."):
+		c.add(offset, id, automata.SeveritySecurity, "protocol version %s is SSH 1, which is broken and must not be used", proto)
+	default:
+		c.add(offset, id, automata.SeverityError, "unknown protocol version %q; it must be 2.0", proto)
+	}
+	return false
+}
+
+// packets checks the binary packets until the sender takes new keys into use,
+// returning where the check stopped.
+func (c *checker) packets(data []byte, pos int, e *Endpoint) int {
+	kexStarted := false
+	for pos < len(data) {
+		if len(data)-pos < 5 {
+			c.add(pos, "", automata.SeverityWarning, "stream ends inside a packet header")
+			return len(data)
+		}
+		length := binary.BigEndian.Uint32(data[pos:])
+		padding := int(data[pos+4])
+		if length > MaxPacket {
+			c.add(pos, "", automata.SeverityError, "packet length %d is more than %d; this is not a clear-text SSH packet", length, MaxPacket)
+			return pos
+		}
+		if (length+4)%8 != 0 {
+			c.add(pos, "", automata.SeverityError, "packet length %d + 4 is not a multiple of 8, the block size before encryption", length)
+		}
+		if length+4 < 16 {
+			c.add(pos, "", automata.SeverityError, "packet is %d bytes; packets are at least 16", length+4)
+		}
+		if padding < 4 {
+			c.add(pos, "", automata.SeverityError, "padding length %d is less than 4", padding)
+		}
+		if int(length) < padding+2 {
+			c.add(pos, "", automata.SeverityError, "padding length %d leaves no message in a packet of length %d", padding, length)
+			return pos
+		}
+		if uint32(len(data)-pos-4) < length {
+			c.add(pos, "", automata.SeverityWarning, "stream ends inside a packet of length %d", length)
+			return len(data)
+		}
+		payload := data[pos+5 : pos+4+int(length)-padding]
+		offset := pos
+		pos += 4 + int(length)
+
+		switch t := payload[0]; {
+		case t == msgDisconnect, t == msgIgnore, t == msgUnimpl, t == msgDebug:
+		case t == msgKexInit:
+			if kexStarted {
+				c.add(offset, "KEXINIT", automata.SeverityError, "second KEXINIT before NEWKEYS")
+			}
+			kexStarted = true
+			if k := c.kexInit(offset, payload); e.KexInit == nil {
+				e.KexInit = k
+			}
+		case t >= 30 && t <= 49:
+			if !kexStarted {
+				c.add(offset, fmt.Sprint(t), automata.SeverityError, "key exchange message %d before KEXINIT", t)
+			}
+		case t == msgNewKeys:
+			if !kexStarted {
+				c.add(offset, "NEWKEYS", automata.SeverityError, "NEWKEYS before KEXINIT")
+			}
+			return pos // what follows is encrypted
+		default:
+			c.add(offset, fmt.Sprint(t), automata.SeverityError, "message %d is not allowed before the first key exchange completes", t)
+		}
+	}
+	return pos
+}
+
+// kexInit decodes and checks a KEXINIT payload.
+func (c *checker) kexInit(offset int, payload []byte) *KexInit {
+	k := &KexInit{Offset: offset}
+	p := payload[1:]
+	if len(p) < 16 {
+		c.add(offset, "KEXINIT", automata.SeverityError, "KEXINIT is truncated in its cookie")
+		return nil
+	}
+	if bytes.Count(p[:16], []byte{0}) == 16 {
+		c.add(offset, "KEXINIT", automata.SeveritySecurity, "KEXINIT cookie is all zeros; it must be random")
+	}
+	p = p[16:]
+	for i, name := range Lists {
+		if len(p) < 4 || uint32(len(p)-4) < binary.BigEndian.Uint32(p) {
+			c.add(offset, name, automata.SeverityError, "KEXINIT is truncated in %s", name)
+			return nil
+		}
+		n := binary.BigEndian.Uint32(p)
+		k.Lists[i] = c.nameList(offset, i, string(p[4:4+n]))
+		p = p[4+n:]
+	}
+	if len(p) < 5 {
+		c.add(offset, "KEXINIT", automata.SeverityError, "KEXINIT is truncated after the name-lists")
+		return nil
+	}
+	if p[0] > 1 {
+		c.add(offset, "first_kex_packet_follows", automata.SeverityWarning, "first_kex_packet_follows is %d; booleans are sent as 0 or 1", p[0])
+	}
+	k.FirstKexFollows = p[0] != 0
+	if r := binary.BigEndian.Uint32(p[1:]); r != 0 {
+		c.add(offset, "reserved", automata.SeverityError, "reserved field is %d; it must be 0", r)
+	}
+	if len(p) > 5 {
+		c.add(offset, "KEXINIT", automata.SeverityWarning, "KEXINIT has %d bytes after the reserved field", len(p)-5)
+	}
+	return k
+}
+
+// nameList checks the syntax of a name-list (RFC 4251, section 5) and the algorithm
+// names in it (section 6), and flags weak algorithms.
+func (c *checker) nameList(offset, i int, value string) []string {
+	list := Lists[i]
+	if value == "" {
+		if i < 8 { // all lists but the languages
+			c.add(offset, list, automata.SeverityError, "%s is empty; it must name at least one algorithm", list)
+		}
+		return nil
+	}
+	names := strings.Split(value, ",")
+	seen := map[string]bool{}
+	var weak []string
+	for _, n := range names {
+		switch {
+		case n == "":
+			c.add(offset, list, automata.SeverityError, "%s has an empty name; names are separated by single commas", list)
+			continue
+		case len(n) > 64:
+			c.add(offset, list, automata.SeverityError, "%s: name %q is longer than 64 characters", list, excerpt([]byte(n)))
+		case !printable(n):
+			c.add(offset, list, automata.SeverityError, "%s: name %q must be printable US-ASCII without whitespace", list, n)
+		case strings.Count(n, "@") > 1, strings.HasPrefix(n, "@"), strings.HasSuffix(n, "@"):
+			c.add(offset, list, automata.SeverityError, "%s: name %q must be name@domain with a single '@'", list, n)
+		}
+		if seen[n] {
+			c.add(offset, list, automata.SeverityWarning, "%s names %s more than once", list, n)
+		}
+		seen[n] = true
+		if weakAlgorithms[n] || n == "none" && unprotected(i) {
+			weak = append(weak, n)
+		}
+	}
+	if len(weak) > 0 {
+		c.add(offset, list, automata.SeveritySecurity, "%s offers weak algorithms: %s", list, strings.Join(weak, ", "))
+	}
+	return names
+}
+
+// weakAlgorithms are broken or deprecated: SHA-1 and small groups for key exchange,
+// DSA and SHA-1 RSA host keys, CBC and RC4 ciphers, and MD5 and truncated MACs.
+var weakAlgorithms = map[string]bool{
+	"diffie-hellman-group1-sha1":         true,
+	"diffie-hellman-group14-sha1":        true,
+	"diffie-hellman-group-exchange-sha1": true,
+	"rsa1024-sha1":                       true,
+	"ssh-dss":                            true,
+	"ssh-rsa":                            true,
+	"3des-cbc":                           true,
+	"aes128-cbc":                         true,
+	"aes192-cbc":                         true,
+	"aes256-cbc":                         true,
+	"blowfish-cbc":                       true,
+	"cast128-cbc":                        true,
+	"des-cbc":                            true,
+	"arcfour":                            true,
+	"arcfour128":                         true,
+	"arcfour256":                         true,
+	"rijndael-cbc@lysator.liu.se":        true,
+	"hmac-md5":                           true,
+	"hmac-md5-96":                        true,
+	"hmac-sha1-96":                       true,
+	"hmac-md5-etm@openssh.com":           true,
+	"hmac-md5-96-etm@openssh.com":        true,
+	"umac-64@openssh.com":                true,
+}
+
+// unprotected reports whether "none" in list i leaves traffic unencrypted or
+// unauthenticated.
+func unprotected(i int) bool { return i >= 2 && i <= 5 }
+
+func printable(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x21 || s[i] > 0x7e || s[i] == ',' {
+			return false
+		}
+	}
+	return true
+}
+
+// Negotiate checks that the client and server KEXINITs have an algorithm in common
+// for every list but the languages, as the connection fails otherwise, and reports
+// weak algorithms the pair would agree on.
+func Negotiate(client, server *KexInit) []automata.Finding {
+	c := &checker{}
+	for i := 0; i < 8; i++ {
+		chosen := ""
+		for _, n := range client.Lists[i] {
+			if contains(server.Lists[i], n) {
+				chosen = n
+				break
+			}
+		}
+		switch {
+		case chosen == "":
+			c.add(server.Offset, Lists[i], automata.SeverityError, "client and server have no algorithm in common in %s, so the connection fails", Lists[i])
+		case chosen == "none" && unprotected(i):
+			c.add(server.Offset, Lists[i], automata.SeveritySecurity, "client and server agree on no protection (none) for %s", Lists[i])
+		case weakAlgorithms[chosen]:
+			c.add(server.Offset, Lists[i], automata.SeveritySecurity, "client and server agree on the weak algorithm %s for %s", chosen, Lists[i])
+		}
+	}
+	return c.findings
+}
+
+func contains(list []string, name string) bool {
+	for _, n := range list {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// excerpt shortens a line for findings.
+func excerpt(b []byte) string {
+	if len(b) > 60 {
+		return string(b[:57]) + "..."
+	}
+	return string(b)
+}
@@ -0,0 +1,305 @@
+package store
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	_ "modernc.org/sqlite" // pure-Go driver, registered as "sqlite"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS runs (
+	id            INTEGER PRIMARY KEY AUTOINCREMENT,
+	subject       TEXT NOT NULL,
+	kind          TEXT NOT NULL,
+	input_hash    TEXT NOT NULL,
+	rules_file    TEXT NOT NULL,
+	rules_hash    TEXT NOT NULL,
+	started_at    TIMESTAMP NOT NULL,
+	finished_at   TIMESTAMP NOT NULL,
+	status        TEXT NOT NULL,
+	finding_count INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS runs_subject ON runs (subject, started_at);
+CREATE TABLE IF NOT EXISTS findings (
+	run_id   INTEGER NOT NULL REFERENCES runs (id),
+	message  TEXT NOT NULL,
+	severity TEXT NOT NULL DEFAULT '',
+	rule     TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS findings_run ON findings (run_id);
+`
+
+// findingColumns are the columns of findings added after the first release, which
+// stores created before them get when they are opened. Their findings keep "".
+var findingColumns = []string{"severity", "rule"}
+
+// Run is one validation of one input: a config file or a device.
+type Run struct {
+	ID        int64
+	Subject   string // file path or device name
+	Kind      string // "file" or "device"
+	InputHash string // sha256 of the validated input
+	RulesFile string
+	RulesHash string // sha256 of the rules file, identifying the rule version used
+	Started   time.Time
+	Finished  time.Time
+	Status    string
+	Findings  []Finding
+	// Owners lists the findings by owner, for notifications; it is not stored.
+	Owners map[string][]string
+}
+
+// Finding is one finding of a run. Rule is the code of its message (see pkg/i18n), or
+// else the state it was reported in, as validation.Filter names rules.
+type Finding struct {
+	Message  string // as reported, with its line number
+	Severity string
+	Rule     string
+}
+
+// Messages returns the messages of findings.
+func Messages(findings []Finding) []string {
+	out := make([]string, len(findings))
+	for i, f := range findings {
+		out[i] = f.Message
+	}
+	return out
+}
+
+// Trend summarizes how the finding count of one subject evolved over its runs.
+type Trend struct {
+	Subject string
+	Runs    int
+	First   int
+	Last    int
+	Min     int
+	Max     int
+	Counts  []int // oldest first
+	LastRun time.Time
+	// Severities counts the findings of the last run by severity. Findings recorded
+	// before severities were stored count under "".
+	Severities map[string]int
+}
+
+// Store is the embedded SQLite result store.
+type Store struct {
+	db *sql.DB
+}
+
+// Open opens (or creates) the SQLite database at path.
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize result store %s: %v", path, err)
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to upgrade result store %s: %v", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+// migrate adds the findingColumns a store does not have yet.
+func migrate(db *sql.DB) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info('findings')`)
+	if err != nil {
+		return err
+	}
+	have := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		have[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, column := range findingColumns {
+		if !have[column] {
+			if _, err := db.Exec(`ALTER TABLE findings ADD COLUMN ` + column + ` TEXT NOT NULL DEFAULT ''`); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Record inserts a run and its findings, setting run.ID.
+func (s *Store) Record(run *Run) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`INSERT INTO runs
+		(subject, kind, input_hash, rules_file, rules_hash, started_at, finished_at, status, finding_count)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		run.Subject, run.Kind, run.InputHash, run.RulesFile, run.RulesHash,
+		run.Started.UTC(), run.Finished.UTC(), run.Status, len(run.Findings))
+	if err != nil {
+		return err
+	}
+	if run.ID, err = res.LastInsertId(); err != nil {
+		return err
+	}
+	for _, f := range run.Findings {
+		if _, err := tx.Exec(`INSERT INTO findings (run_id, message, severity, rule) VALUES (?, ?, ?, ?)`,
+			run.ID, f.Message, f.Severity, f.Rule); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// History returns every run of a subject, oldest first. Findings are not loaded.
+func (s *Store) History(subject string) ([]Run, error) {
+	rows, err := s.db.Query(`SELECT id, subject, kind, input_hash, rules_file, rules_hash,
+		started_at, finished_at, status, finding_count
+		FROM runs WHERE subject = ? ORDER BY started_at, id`, subject)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []Run
+	for rows.Next() {
+		var r Run
+		var count int
+		if err := rows.Scan(&r.ID, &r.Subject, &r.Kind, &r.InputHash, &r.RulesFile, &r.RulesHash,
+			&r.Started, &r.Finished, &r.Status, &count); err != nil {
+			return nil, err
+		}
+		r.Findings = make([]Finding, count)
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// Last returns the most recent run of a subject with its findings, or nil if there is none.
+func (s *Store) Last(subject string) (*Run, error) {
+	runs, err := s.History(subject)
+	if err != nil || len(runs) == 0 {
+		return nil, err
+	}
+	last := runs[len(runs)-1]
+	if last.Findings, err = s.Findings(last.ID); err != nil {
+		return nil, err
+	}
+	return &last, nil
+}
+
+// Findings returns the findings recorded for a run.
+func (s *Store) Findings(runID int64) ([]Finding, error) {
+	rows, err := s.db.Query(`SELECT message, severity, rule FROM findings WHERE run_id = ?`, runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Finding
+	for rows.Next() {
+		var f Finding
+		if err := rows.Scan(&f.Message, &f.Severity, &f.Rule); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// Trends returns the evolution of finding counts for every subject, ordered by subject.
+func (s *Store) Trends() ([]Trend, error) {
+	rows, err := s.db.Query(`SELECT id, subject, finding_count, started_at FROM runs ORDER BY subject, started_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trends []Trend
+	var lastRuns []int64
+	for rows.Next() {
+		var id int64
+		var subject string
+		var count int
+		var started time.Time
+		if err := rows.Scan(&id, &subject, &count, &started); err != nil {
+			return nil, err
+		}
+		if len(trends) == 0 || trends[len(trends)-1].Subject != subject {
+			trends = append(trends, Trend{Subject: subject, First: count, Min: count, Max: count})
+			lastRuns = append(lastRuns, 0)
+		}
+		lastRuns[len(lastRuns)-1] = id
+		t := &trends[len(trends)-1]
+		t.Runs++
+		t.Last = count
+		t.Min = min(t.Min, count)
+		t.Max = max(t.Max, count)
+		t.Counts = append(t.Counts, count)
+		t.LastRun = started
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	for i := range trends {
+		if trends[i].Severities, err = s.severities(lastRuns[i]); err != nil {
+			return nil, err
+		}
+	}
+	return trends, nil
+}
+
+// severities counts the findings of a run by severity.
+func (s *Store) severities(runID int64) (map[string]int, error) {
+	rows, err := s.db.Query(`SELECT severity, COUNT(*) FROM findings WHERE run_id = ? GROUP BY severity`, runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var severity string
+		var n int
+		if err := rows.Scan(&severity, &n); err != nil {
+			return nil, err
+		}
+		counts[severity] = n
+	}
+	return counts, rows.Err()
+}
+
+// HashBytes returns the hex sha256 of data, used for input identity.
+func HashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// HashFile returns the hex sha256 of a file's contents.
+func HashFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return HashBytes(data), nil
+}
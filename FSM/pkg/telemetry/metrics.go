@@ -0,0 +1,157 @@
+package telemetry
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// durationBounds are the histogram bucket bounds of stage durations, in
+// milliseconds: from a small config in the FSM to a large fleet run.
+var durationBounds = []float64{0.1, 0.5, 1, 5, 10, 50, 100, 500, 1000, 5000, 10000, 60000}
+
+// metrics holds the cumulative metrics since Init.
+type metrics struct {
+	mu       sync.Mutex
+	start    time.Time
+	stages   map[string]*histogram
+	counters map[counterKey]int64
+}
+
+type histogram struct {
+	count   int64
+	sum     float64
+	buckets []int64 // one more than durationBounds, for values above the last bound
+}
+
+// counterKey is a counter and the value of its one attribute.
+type counterKey struct {
+	name, attr, value string
+}
+
+// Counter names.
+const (
+	// LinesCounter counts the config lines validated.
+	LinesCounter = "validator.lines"
+	// FindingsCounter counts findings, with the attribute severity.
+	FindingsCounter = "validator.findings"
+	// QueueOverflowCounter counts requests a full queue refused or shed, with the
+	// attribute policy.
+	QueueOverflowCounter = "validator.queue.overflow"
+)
+
+// StageDuration records how long a pipeline stage took in the
+// validator.stage.duration histogram. Stage spans record theirs themselves.
+func StageDuration(stage string, d time.Duration) {
+	if exporter == nil {
+		return
+	}
+	m := &exporter.metrics
+	ms := float64(d) / float64(time.Millisecond)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.stages[stage]
+	if !ok {
+		h = &histogram{buckets: make([]int64, len(durationBounds)+1)}
+		m.stages[stage] = h
+	}
+	h.count++
+	h.sum += ms
+	h.buckets[sort.SearchFloat64s(durationBounds, ms)]++
+}
+
+// Add adds n to a counter. attr and value may be empty for counters without an
+// attribute.
+func Add(name, attr, value string, n int64) {
+	if exporter == nil || n == 0 {
+		return
+	}
+	m := &exporter.metrics
+	m.mu.Lock()
+	m.counters[counterKey{name, attr, value}] += n
+	m.mu.Unlock()
+}
+
+// otlpMetrics renders the metrics as an OTLP ResourceMetrics list.
+func (m *metrics) otlp(resource otlpResource, scope otlpScope) []any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	start, now := nanos(m.start), nanos(time.Now())
+
+	var points []any
+	stages := make([]string, 0, len(m.stages))
+	for stage := range m.stages {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+	for _, stage := range stages {
+		h := m.stages[stage]
+		buckets := make([]string, len(h.buckets))
+		for i, n := range h.buckets {
+			buckets[i] = itoa(n)
+		}
+		points = append(points, map[string]any{
+			"attributes":        attributes(map[string]any{"stage": stage}),
+			"startTimeUnixNano": start,
+			"timeUnixNano":      now,
+			"count":             itoa(h.count),
+			"sum":               h.sum,
+			"bucketCounts":      buckets,
+			"explicitBounds":    durationBounds,
+		})
+	}
+	var out []any
+	if len(points) > 0 {
+		out = append(out, map[string]any{
+			"name":        "validator.stage.duration",
+			"description": "Time spent in each stage of the validation pipeline",
+			"unit":        "ms",
+			"histogram":   map[string]any{"aggregationTemporality": temporalityCumulative, "dataPoints": points},
+		})
+	}
+
+	sums := map[string][]any{}
+	var names []string
+	keys := make([]counterKey, 0, len(m.counters))
+	for k := range m.counters {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].name != keys[j].name {
+			return keys[i].name < keys[j].name
+		}
+		return keys[i].value < keys[j].value
+	})
+	for _, k := range keys {
+		if _, ok := sums[k.name]; !ok {
+			names = append(names, k.name)
+		}
+		attrs := map[string]any{}
+		if k.attr != "" {
+			attrs[k.attr] = k.value
+		}
+		sums[k.name] = append(sums[k.name], map[string]any{
+			"attributes":        attributes(attrs),
+			"startTimeUnixNano": start,
+			"timeUnixNano":      now,
+			"asInt":             itoa(m.counters[k]),
+		})
+	}
+	for _, name := range names {
+		out = append(out, map[string]any{
+			"name": name,
+			"unit": "1",
+			"sum":  map[string]any{"aggregationTemporality": temporalityCumulative, "isMonotonic": true, "dataPoints": sums[name]},
+		})
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return []any{map[string]any{
+		"resource":     resource,
+		"scopeMetrics": []any{map[string]any{"scope": scope, "metrics": out}},
+	}}
+}
+
+// temporalityCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE.
+const temporalityCumulative = 2
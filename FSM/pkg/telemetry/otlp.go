@@ -0,0 +1,263 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxQueued is how many ended spans are held for the next export; beyond it spans
+// are dropped, and counted, rather than growing without bound.
+const maxQueued = 4096
+
+// exportInterval is how often spans and metrics are exported in the background.
+const exportInterval = 5 * time.Second
+
+// exporter is the configured exporter, or nil when telemetry is off.
+var exporter *otlpExporter
+
+type otlpExporter struct {
+	tracesURL  string
+	metricsURL string
+	headers    map[string]string
+	resource   otlpResource
+	scope      otlpScope
+	client     *http.Client
+
+	mu      sync.Mutex
+	queue   []*Span
+	dropped int64
+	metrics metrics
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+type otlpResource = map[string]any
+type otlpScope = map[string]any
+
+// Init configures export from the environment, as OpenTelemetry SDKs do:
+//
+//	OTEL_EXPORTER_OTLP_ENDPOINT          collector base URL, e.g. http://localhost:4318
+//	OTEL_EXPORTER_OTLP_TRACES_ENDPOINT   full URL for traces (default <base>/v1/traces)
+//	OTEL_EXPORTER_OTLP_METRICS_ENDPOINT  full URL for metrics (default <base>/v1/metrics)
+//	OTEL_EXPORTER_OTLP_HEADERS           key=value,... sent with every export
+//	OTEL_SERVICE_NAME                    service.name (default service, the argument)
+//	OTEL_RESOURCE_ATTRIBUTES             key=value,... added to the resource
+//	OTEL_SDK_DISABLED                    true turns telemetry off
+//
+// Only the http/json protocol is spoken. Telemetry stays off when no endpoint is
+// set. The returned function exports what is left and stops the background export;
+// call it before the process exits. Calling it again does nothing.
+func Init(service, version string) func() {
+	base := strings.TrimRight(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "/")
+	traces := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	metricsURL := os.Getenv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT")
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") || (base == "" && traces == "" && metricsURL == "") {
+		return func() {}
+	}
+	if traces == "" && base != "" {
+		traces = base + "/v1/traces"
+	}
+	if metricsURL == "" && base != "" {
+		metricsURL = base + "/v1/metrics"
+	}
+	if p := os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL"); p != "" && p != "http/json" {
+		log.Printf("⚠️  OTEL_EXPORTER_OTLP_PROTOCOL=%s is not supported, exporting with http/json", p)
+	}
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		service = name
+	}
+	attrs := keyValues(os.Getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	resourceAttrs := map[string]any{"service.name": service}
+	if version != "" {
+		resourceAttrs["service.version"] = version
+	}
+	for k, v := range attrs {
+		resourceAttrs[k] = v
+	}
+
+	e := &otlpExporter{
+		tracesURL:  traces,
+		metricsURL: metricsURL,
+		headers:    keyValues(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")),
+		resource:   otlpResource{"attributes": attributes(resourceAttrs)},
+		scope:      otlpScope{"name": "config-validator/pkg/telemetry"},
+		client:     &http.Client{Timeout: 10 * time.Second},
+		metrics:    metrics{start: time.Now(), stages: map[string]*histogram{}, counters: map[counterKey]int64{}},
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	exporter = e
+	go e.loop()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(e.stop)
+			<-e.done
+		})
+	}
+}
+
+func (e *otlpExporter) loop() {
+	defer close(e.done)
+	tick := time.NewTicker(exportInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			e.export()
+		case <-e.stop:
+			e.export()
+			return
+		}
+	}
+}
+
+func (e *otlpExporter) enqueue(s *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.queue) >= maxQueued {
+		e.dropped++
+		return
+	}
+	e.queue = append(e.queue, s)
+}
+
+// export sends the queued spans and the current metrics.
+func (e *otlpExporter) export() {
+	e.mu.Lock()
+	spans, dropped := e.queue, e.dropped
+	e.queue, e.dropped = nil, 0
+	e.mu.Unlock()
+	if dropped > 0 {
+		log.Printf("⚠️  Telemetry dropped %d spans: the export queue was full", dropped)
+	}
+
+	if len(spans) > 0 && e.tracesURL != "" {
+		out := make([]any, len(spans))
+		for i, s := range spans {
+			out[i] = s.otlp()
+		}
+		e.post(e.tracesURL, map[string]any{"resourceSpans": []any{map[string]any{
+			"resource":   e.resource,
+			"scopeSpans": []any{map[string]any{"scope": e.scope, "spans": out}},
+		}}})
+	}
+	if e.metricsURL != "" {
+		if rm := e.metrics.otlp(e.resource, e.scope); rm != nil {
+			e.post(e.metricsURL, map[string]any{"resourceMetrics": rm})
+		}
+	}
+}
+
+func (e *otlpExporter) post(url string, body any) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		log.Println("❌ Error encoding telemetry:", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		log.Println("❌ Error exporting telemetry:", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		log.Println("❌ Error exporting telemetry:", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		log.Printf("❌ Error exporting telemetry: %s answered %s", url, resp.Status)
+	}
+}
+
+// otlp renders the span as an OTLP Span.
+func (s *Span) otlp() map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	span := map[string]any{
+		"traceId":           hex.EncodeToString(s.traceID[:]),
+		"spanId":            hex.EncodeToString(s.spanID[:]),
+		"name":              s.name,
+		"kind":              s.kind,
+		"startTimeUnixNano": nanos(s.start),
+		"endTimeUnixNano":   nanos(s.end),
+		"attributes":        attributes(s.attrs),
+	}
+	if s.parentID != ([8]byte{}) {
+		span["parentSpanId"] = hex.EncodeToString(s.parentID[:])
+	}
+	if s.errMsg != "" {
+		span["status"] = map[string]any{"code": 2, "message": s.errMsg} // STATUS_CODE_ERROR
+	}
+	return span
+}
+
+// attributes renders attributes as OTLP KeyValues, sorted by key.
+func attributes(attrs map[string]any) []any {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]any, 0, len(keys))
+	for _, k := range keys {
+		var value map[string]any
+		switch v := attrs[k].(type) {
+		case bool:
+			value = map[string]any{"boolValue": v}
+		case int:
+			value = map[string]any{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]any{"intValue": itoa(v)}
+		case float64:
+			value = map[string]any{"doubleValue": v}
+		default:
+			value = map[string]any{"stringValue": fmt.Sprint(v)}
+		}
+		out = append(out, map[string]any{"key": k, "value": value})
+	}
+	return out
+}
+
+// keyValues parses the key=value,... lists of OTEL_* variables, whose values are
+// percent-encoded.
+func keyValues(s string) map[string]string {
+	out := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		if k, v, ok := strings.Cut(pair, "="); ok && strings.TrimSpace(k) != "" {
+			if unescaped, err := url.PathUnescape(strings.TrimSpace(v)); err == nil {
+				v = unescaped
+			}
+			out[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return out
+}
+
+// nanos is a time as OTLP/JSON writes it: nanoseconds since the epoch, as a string.
+func nanos(t time.Time) string {
+	return itoa(t.UnixNano())
+}
+
+func itoa(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
@@ -0,0 +1,177 @@
+// Package telemetry records OpenTelemetry spans and metrics for the validation
+// pipeline and exports them over OTLP/HTTP with the JSON encoding, so a collector
+// can take them without the validator depending on the OpenTelemetry SDK.
+//
+// It is configured from the standard OTEL_* environment variables and does nothing,
+// at no cost beyond a nil check, until Init finds an endpoint in them.
+package telemetry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Span is one timed operation of a trace. A nil *Span, which Start returns when
+// telemetry is off, may be used like any other and records nothing.
+type Span struct {
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	kind     int
+	start    time.Time
+	end      time.Time
+	attrs    map[string]any
+	errMsg   string
+	ended    bool
+	mu       sync.Mutex
+}
+
+// Span kinds, as numbered by OTLP.
+const (
+	KindInternal = 1
+	KindServer   = 2
+)
+
+type spanKey struct{}
+
+// Enabled reports whether Init configured an exporter, for callers that would
+// otherwise measure work for nothing.
+func Enabled() bool {
+	return exporter != nil
+}
+
+// Start begins a span as a child of the span in ctx, or as the root of a new trace,
+// and returns a context carrying it.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	return StartKind(ctx, name, KindInternal)
+}
+
+// StartKind is Start with a span kind, such as KindServer for requests handled.
+func StartKind(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	if exporter == nil {
+		return ctx, nil
+	}
+	s := &Span{name: name, kind: kind, start: time.Now(), attrs: map[string]any{}}
+	if parent := FromContext(ctx); parent != nil {
+		s.traceID, s.parentID = parent.traceID, parent.spanID
+	} else if remote, ok := ctx.Value(remoteKey{}).(remoteParent); ok {
+		s.traceID, s.parentID = remote.traceID, remote.spanID
+	} else {
+		rand.Read(s.traceID[:])
+	}
+	rand.Read(s.spanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// FromContext returns the span ctx carries, or nil.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// SetAttr sets an attribute: a string, bool, int, int64, or float64.
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attrs[key] = value
+	s.mu.Unlock()
+}
+
+// SetError marks the span as failed.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.errMsg = err.Error()
+	s.mu.Unlock()
+}
+
+// End finishes the span and queues it for export. Ending a span twice does nothing.
+func (s *Span) End() {
+	s.EndAt(time.Now())
+}
+
+// EndAt finishes the span at a given time, for spans laid out after the fact.
+func (s *Span) EndAt(t time.Time) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended, s.end = true, t
+	s.mu.Unlock()
+	exporter.enqueue(s)
+}
+
+// EndStage ends a span timing a stage of the pipeline, also recording its duration
+// in the stage duration histogram under the span's name.
+func (s *Span) EndStage() {
+	if s == nil {
+		return
+	}
+	now := time.Now()
+	s.mu.Lock()
+	ended := s.ended
+	s.mu.Unlock()
+	if !ended {
+		StageDuration(s.name, now.Sub(s.start))
+	}
+	s.EndAt(now)
+}
+
+// Stage records a stage of work that happened in pieces, such as the time spent in
+// the FSM over every line of a config, as a child span of parent lasting the total
+// duration, starting at start, and in the stage duration histogram. It returns
+// when the stage span ends, so stages can be laid out one after another within
+// their parent for a latency breakdown.
+func Stage(parent *Span, name string, start time.Time, d time.Duration) time.Time {
+	if parent == nil {
+		return start
+	}
+	StageDuration(name, d)
+	s := &Span{name: name, kind: KindInternal, start: start, attrs: map[string]any{"validator.stage.interleaved": true},
+		traceID: parent.traceID, parentID: parent.spanID}
+	rand.Read(s.spanID[:])
+	s.EndAt(start.Add(d))
+	return start.Add(d)
+}
+
+// remoteParent is a span of another process, from a traceparent header.
+type remoteParent struct {
+	traceID [16]byte
+	spanID  [8]byte
+}
+
+type remoteKey struct{}
+
+// WithTraceparent continues the trace of a W3C traceparent header
+// ("00-<trace id>-<span id>-<flags>"), so spans of a request join the caller's
+// trace. An invalid header is ignored.
+func WithTraceparent(ctx context.Context, header string) context.Context {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if exporter == nil || len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return ctx
+	}
+	var p remoteParent
+	if _, err := hex.Decode(p.traceID[:], []byte(parts[1])); err != nil {
+		return ctx
+	}
+	if _, err := hex.Decode(p.spanID[:], []byte(parts[2])); err != nil {
+		return ctx
+	}
+	if p.traceID == ([16]byte{}) || p.spanID == ([8]byte{}) {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, p)
+}
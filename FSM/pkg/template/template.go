@@ -0,0 +1,178 @@
+package template
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"config-validator/pkg/automata"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// {{ name }}, {{ name | default('x') }}, <%= name %>, and <%= @name %>.
+	placeholderRe = regexp.MustCompile(`\{\{-?\s*(.*?)\s*-?\}\}|<%=\s*(.*?)\s*-?%>`)
+	// {% if %}, {# comment #}, <% code %>, and <%# comment %> carry no config.
+	controlRe = regexp.MustCompile(`\{%.*?%\}|\{#.*?#\}|<%[^=].*?%>`)
+	defaultRe = regexp.MustCompile(`^default\(\s*(?:'([^']*)'|"([^"]*)")\s*\)$`)
+)
+
+// wildcardValues are tried in place of placeholders that have no value, so that a
+// templated line passes when some plausible rendering of it matches a rule.
+var wildcardValues = []string{
+	"1", "10.0.0.1", "255.255.255.0", "0.0.0.255", "GigabitEthernet0/1", "example",
+}
+
+// maxWildcards bounds the renderings tried for a line; lines with more placeholders
+// only try the first value for the rest.
+const maxWildcards = 3
+
+// Options controls template preprocessing. Vars are substituted for placeholders;
+// placeholders left over are matched as wildcards, and reported unless Wildcard is set.
+type Options struct {
+	Vars     map[string]string
+	Wildcard bool
+}
+
+// LoadVars reads a YAML or JSON vars file. Nested mappings are flattened with dots,
+// so {mgmt: {ip: 10.0.0.1}} provides mgmt.ip.
+func LoadVars(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vars file: %v", err)
+	}
+	var raw map[string]any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse vars file %s: %v", path, err)
+	}
+	vars := map[string]string{}
+	flatten("", raw, vars)
+	return vars, nil
+}
+
+func flatten(prefix string, value any, vars map[string]string) {
+	switch v := value.(type) {
+	case map[string]any:
+		for k, item := range v {
+			if prefix != "" {
+				k = prefix + "." + k
+			}
+			flatten(k, item, vars)
+		}
+	default:
+		vars[prefix] = fmt.Sprint(v)
+	}
+}
+
+// Line is one preprocessed config line.
+type Line struct {
+	Text string
+	// Skip is set for lines holding only template control statements or comments.
+	Skip bool
+	// Wildcards are renderings to try when Text, which still has placeholders, matches
+	// no rule; nil when every placeholder was substituted.
+	Wildcards []string
+}
+
+// Processor renders template lines one at a time, recording undefined variables.
+type Processor struct {
+	opts     Options
+	Findings []automata.Finding
+}
+
+// NewProcessor returns a Processor for the options.
+func NewProcessor(opts Options) *Processor {
+	return &Processor{opts: opts}
+}
+
+// Line preprocesses one line of a templated config.
+func (p *Processor) Line(originalLine string, lineNum int) Line {
+	text := originalLine
+	if controlRe.MatchString(text) {
+		text = controlRe.ReplaceAllString(text, "")
+		if strings.TrimSpace(text) == "" {
+			return Line{Skip: true}
+		}
+	}
+
+	var missing []string
+	text = placeholderRe.ReplaceAllStringFunc(text, func(ph string) string {
+		m := placeholderRe.FindStringSubmatch(ph)
+		expr := m[1] + m[2]
+		if value, ok := p.resolve(expr); ok {
+			return value
+		}
+		missing = append(missing, variable(expr))
+		return ph
+	})
+	if len(missing) == 0 {
+		return Line{Text: text}
+	}
+	if !p.opts.Wildcard {
+		for _, name := range missing {
+			p.Findings = append(p.Findings, automata.Finding{
+				Line:     lineNum,
+				Command:  strings.TrimSpace(originalLine),
+				State:    "TEMPLATE",
+				Message:  fmt.Sprintf("undefined template variable '%s'", name),
+				Severity: automata.SeverityError,
+				Code:     "template.undefined-variable",
+			})
+		}
+	}
+	return Line{Text: text, Wildcards: renderings(strings.TrimSpace(text))}
+}
+
+// resolve evaluates a placeholder expression: a variable with optional filters, of
+// which default(...) supplies a value and upper/lower transform it.
+func (p *Processor) resolve(expr string) (string, bool) {
+	parts := strings.Split(expr, "|")
+	value, ok := p.opts.Vars[variable(expr)]
+	for _, filter := range parts[1:] {
+		filter = strings.TrimSpace(filter)
+		switch {
+		case filter == "upper" && ok:
+			value = strings.ToUpper(value)
+		case filter == "lower" && ok:
+			value = strings.ToLower(value)
+		case defaultRe.MatchString(filter) && !ok:
+			m := defaultRe.FindStringSubmatch(filter)
+			value, ok = m[1]+m[2], true
+		}
+	}
+	return value, ok
+}
+
+// variable returns the variable a placeholder expression reads, without filters and
+// ERB's @ for instance variables.
+func variable(expr string) string {
+	name, _, _ := strings.Cut(expr, "|")
+	return strings.TrimPrefix(strings.TrimSpace(name), "@")
+}
+
+// renderings returns the line with its placeholders replaced by every combination of
+// wildcard values.
+func renderings(line string) []string {
+	locs := placeholderRe.FindAllStringIndex(line, -1)
+	out := []string{""}
+	prev := 0
+	for i, loc := range locs {
+		values := wildcardValues
+		if i >= maxWildcards {
+			values = values[:1]
+		}
+		var next []string
+		for _, prefix := range out {
+			for _, v := range values {
+				next = append(next, prefix+line[prev:loc[0]]+v)
+			}
+		}
+		out, prev = next, loc[1]
+	}
+	for i := range out {
+		out[i] += line[prev:]
+	}
+	return out
+}
@@ -0,0 +1,540 @@
+// Package tomlcheck validates TOML documents: table headers, keys, values, and the
+// rules on where tables, dotted keys, and arrays of tables may be defined. Application
+// configs shipped alongside device configs often use TOML, and its findings share
+// the model of config validation.
+package tomlcheck
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/linereader"
+)
+
+// State is the state reported in TOML findings.
+const State = "TOML"
+
+// kind is what a key path was defined as.
+type kind int
+
+const (
+	implicit kind = iota + 1 // a table created as the parent of a header
+	table                    // a table created by a [header]
+	array                    // an array of tables, created by [[header]]
+	dotted                   // a table created by dotted keys (a.b = 1)
+	value                    // a key with a value
+)
+
+var kindNames = map[kind]string{
+	implicit: "a table", table: "a table", array: "an array of tables",
+	dotted: "a table of dotted keys", value: "a value",
+}
+
+var (
+	bareKeyRe = regexp.MustCompile(`^[A-Za-z0-9_-]+`)
+	scalarRes = []*regexp.Regexp{
+		regexp.MustCompile(`^(true|false)$`),
+		regexp.MustCompile(`^[+-]?(0|[1-9](_?[0-9])*)$`),
+		regexp.MustCompile(`^0x[0-9A-Fa-f](_?[0-9A-Fa-f])*$`),
+		regexp.MustCompile(`^0o[0-7](_?[0-7])*$`),
+		regexp.MustCompile(`^0b[01](_?[01])*$`),
+		regexp.MustCompile(`^[+-]?(0|[1-9](_?[0-9])*)(\.[0-9](_?[0-9])*)?([eE][+-]?[0-9](_?[0-9])*)?$`),
+		regexp.MustCompile(`^[+-]?(inf|nan)$`),
+		regexp.MustCompile(`^\d{4}-\d{2}-\d{2}([Tt ]\d{2}:\d{2}:\d{2}(\.\d+)?([Zz]|[+-]\d{2}:\d{2})?)?$`),
+		regexp.MustCompile(`^\d{2}:\d{2}:\d{2}(\.\d+)?$`),
+	}
+	datePrefixRe = regexp.MustCompile(`^\d{4}-\d{2}-\d{2} \d{2}:`)
+)
+
+type checker struct {
+	findings []automata.Finding
+	defs     map[string]kind
+	elems    map[string]int // elements of each array of tables so far
+	current  string         // resolved path of the current table, "" for the root
+}
+
+// Check returns the findings for a TOML document.
+func Check(content []byte) []automata.Finding {
+	c := &checker{defs: map[string]kind{}, elems: map[string]int{}}
+	scanner := linereader.NewScanner(bytes.NewReader(content))
+	var pending string // a value continued over several lines
+	start := 0
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if pending != "" {
+			pending += "\n" + line
+			if complete(pending) {
+				c.keyValue(pending, start)
+				pending = ""
+			}
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+		case strings.HasPrefix(trimmed, "["):
+			c.header(trimmed, n)
+		case complete(trimmed):
+			c.keyValue(trimmed, n)
+		default:
+			pending, start = trimmed, n
+		}
+	}
+	if pending != "" {
+		c.add(start, pending, "value is not closed: a multi-line string or array runs to the end of the file")
+	}
+	return c.findings
+}
+
+func (c *checker) add(n int, line, msg string) {
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	c.findings = append(c.findings, automata.Finding{
+		Line: n, Command: strings.TrimSpace(line), State: State, Message: msg, Severity: automata.SeverityError,
+	})
+}
+
+// header handles [table] and [[array.of.tables]] lines.
+func (c *checker) header(line string, n int) {
+	aot := strings.HasPrefix(line, "[[")
+	open, close := "[", "]"
+	if aot {
+		open, close = "[[", "]]"
+	}
+	body := stripComment(line[len(open):])
+	if !strings.HasSuffix(body, close) {
+		c.add(n, line, fmt.Sprintf("table header must end with %s", close))
+		return
+	}
+	keys, rest, err := parseKey(strings.TrimSpace(strings.TrimSuffix(body, close)))
+	if err == nil && rest != "" {
+		err = fmt.Errorf("unexpected %q after the key", rest)
+	}
+	if err != nil {
+		c.add(n, line, "invalid table header: "+err.Error())
+		return
+	}
+
+	parent, ok := c.parents("", keys[:len(keys)-1], implicit, n, line)
+	if !ok {
+		return
+	}
+	path := join(parent, keys[len(keys)-1])
+	name := strings.Join(keys, ".")
+	prev := c.defs[path]
+	switch {
+	case aot && (prev == 0 || prev == array):
+		c.defs[path] = array
+		c.elems[path]++
+		c.current = path + "#" + strconv.Itoa(c.elems[path])
+		return
+	case aot:
+		c.add(n, line, fmt.Sprintf("[[%s]] cannot define an array of tables: %s is already %s", name, name, kindNames[prev]))
+	case prev == 0 || prev == implicit:
+		c.defs[path] = table
+	case prev == array:
+		c.add(n, line, fmt.Sprintf("%s is an array of tables; add an element with [[%s]]", name, name))
+	case prev == table:
+		c.add(n, line, fmt.Sprintf("table [%s] is defined more than once", name))
+	case prev == dotted:
+		c.add(n, line, fmt.Sprintf("table [%s] was already defined with dotted keys", name))
+	default:
+		c.add(n, line, fmt.Sprintf("[%s] cannot define a table: %s is already %s", name, name, kindNames[prev]))
+	}
+	c.current = path
+}
+
+// parents walks the tables leading to a key, resolving arrays of tables to their last
+// element and creating missing tables as create. It reports a key that is a value.
+func (c *checker) parents(base string, keys []string, create kind, n int, line string) (string, bool) {
+	path := base
+	for i, key := range keys {
+		path = join(path, key)
+		switch prev := c.defs[path]; prev {
+		case 0:
+			c.defs[path] = create
+		case array:
+			path += "#" + strconv.Itoa(c.elems[path])
+		case value:
+			c.add(n, line, fmt.Sprintf("%s is a value, not a table", strings.Join(keys[:i+1], ".")))
+			return "", false
+		case table, implicit:
+			if create == dotted && base == c.current && path != c.current {
+				c.add(n, line, fmt.Sprintf("dotted keys cannot add to table [%s], which has its own header", strings.Join(keys[:i+1], ".")))
+				return "", false
+			}
+		}
+	}
+	return path, true
+}
+
+// keyValue handles a key = value line, possibly continued over several lines.
+func (c *checker) keyValue(text string, n int) {
+	keys, rest, err := parseKey(text)
+	if err != nil {
+		c.add(n, text, "invalid key: "+err.Error())
+		return
+	}
+	rest = strings.TrimLeft(rest, " \t")
+	if !strings.HasPrefix(rest, "=") {
+		c.add(n, text, fmt.Sprintf("expected '=' after key %s", strings.Join(keys, ".")))
+		return
+	}
+	v := &valueParser{s: strings.TrimLeft(rest[1:], " \t")}
+	if err := v.value(); err != nil {
+		c.add(n, text, err.Error())
+	} else if v.skip(false); v.pos < len(v.s) {
+		c.add(n, text, fmt.Sprintf("unexpected %q after the value; put one key = value per line", v.s[v.pos:]))
+	}
+
+	parent, ok := c.parents(c.current, keys[:len(keys)-1], dotted, n, text)
+	if !ok {
+		return
+	}
+	path := join(parent, keys[len(keys)-1])
+	if prev := c.defs[path]; prev != 0 {
+		c.add(n, text, fmt.Sprintf("key %s is defined more than once (it is already %s)", strings.Join(keys, "."), kindNames[prev]))
+		return
+	}
+	c.defs[path] = value
+}
+
+// parseKey reads a bare, quoted, or dotted key and returns its parts and what follows.
+func parseKey(s string) ([]string, string, error) {
+	var keys []string
+	for {
+		s = strings.TrimLeft(s, " \t")
+		var key string
+		switch {
+		case strings.HasPrefix(s, `"`):
+			end := closingQuote(s, '"')
+			if end < 0 {
+				return nil, "", fmt.Errorf("unterminated quoted key")
+			}
+			unq, err := strconv.Unquote(s[:end+1])
+			if err != nil {
+				return nil, "", fmt.Errorf("invalid escape in quoted key %s", s[:end+1])
+			}
+			key, s = unq, s[end+1:]
+		case strings.HasPrefix(s, "'"):
+			end := strings.IndexByte(s[1:], '\'')
+			if end < 0 {
+				return nil, "", fmt.Errorf("unterminated quoted key")
+			}
+			key, s = s[1:end+1], s[end+2:]
+		default:
+			key = bareKeyRe.FindString(s)
+			if key == "" {
+				if s == "" {
+					return nil, "", fmt.Errorf("missing key")
+				}
+				return nil, "", fmt.Errorf("bare keys may only contain A-Z a-z 0-9 _ - (quote the key: %q)", firstWord(s))
+			}
+			s = s[len(key):]
+		}
+		keys = append(keys, key)
+		s = strings.TrimLeft(s, " \t")
+		if !strings.HasPrefix(s, ".") {
+			return keys, s, nil
+		}
+		s = s[1:]
+	}
+}
+
+// valueParser checks the syntax of a TOML value.
+type valueParser struct {
+	s   string
+	pos int
+}
+
+func (v *valueParser) value() error {
+	if v.pos >= len(v.s) {
+		return fmt.Errorf("missing value after '='")
+	}
+	rest := v.s[v.pos:]
+	switch {
+	case strings.HasPrefix(rest, `"""`):
+		return v.multiline(`"""`)
+	case strings.HasPrefix(rest, "'''"):
+		return v.multiline("'''")
+	case rest[0] == '"':
+		end := closingQuote(rest, '"')
+		if end < 0 || strings.Contains(rest[:end], "\n") {
+			return fmt.Errorf("unterminated string; use \"\"\" for strings over several lines")
+		}
+		if err := checkEscapes(rest[1:end]); err != nil {
+			return err
+		}
+		v.pos += end + 1
+	case rest[0] == '\'':
+		end := strings.IndexByte(rest[1:], '\'')
+		if end < 0 || strings.Contains(rest[:end+1], "\n") {
+			return fmt.Errorf("unterminated literal string")
+		}
+		v.pos += end + 2
+	case rest[0] == '[':
+		return v.array()
+	case rest[0] == '{':
+		return v.inlineTable()
+	default:
+		return v.scalar()
+	}
+	return nil
+}
+
+func (v *valueParser) multiline(delim string) error {
+	body := v.s[v.pos+3:]
+	end := strings.Index(body, delim)
+	if end < 0 {
+		return fmt.Errorf("unterminated multi-line string")
+	}
+	// Up to two quotes may directly precede the closing delimiter.
+	for end+3 < len(body) && body[end+3] == delim[0] && end < len(body) {
+		end++
+	}
+	if delim == `"""` {
+		if err := checkEscapes(strings.ReplaceAll(body[:end], "\\\n", "")); err != nil {
+			return err
+		}
+	}
+	v.pos += 3 + end + 3
+	return nil
+}
+
+func (v *valueParser) array() error {
+	v.pos++ // [
+	for {
+		v.skip(true)
+		if v.pos >= len(v.s) {
+			return fmt.Errorf("array is not closed with ]")
+		}
+		if v.s[v.pos] == ']' {
+			v.pos++
+			return nil
+		}
+		if err := v.value(); err != nil {
+			return err
+		}
+		v.skip(true)
+		if v.pos < len(v.s) && v.s[v.pos] == ',' {
+			v.pos++
+			continue
+		}
+		if v.pos < len(v.s) && v.s[v.pos] == ']' {
+			v.pos++
+			return nil
+		}
+		return fmt.Errorf("array elements must be separated by commas")
+	}
+}
+
+func (v *valueParser) inlineTable() error {
+	v.pos++ // {
+	seen := map[string]bool{}
+	v.skip(false)
+	if v.pos < len(v.s) && v.s[v.pos] == '}' {
+		v.pos++
+		return nil
+	}
+	for {
+		keys, rest, err := parseKey(v.s[v.pos:])
+		if err != nil {
+			return fmt.Errorf("invalid key in inline table: %v", err)
+		}
+		v.pos = len(v.s) - len(rest)
+		name := strings.Join(keys, ".")
+		if seen[name] {
+			return fmt.Errorf("key %s is defined more than once in the inline table", name)
+		}
+		seen[name] = true
+		v.skip(false)
+		if v.pos >= len(v.s) || v.s[v.pos] != '=' {
+			return fmt.Errorf("expected '=' after key %s in the inline table", name)
+		}
+		v.pos++
+		v.skip(false)
+		if err := v.value(); err != nil {
+			return err
+		}
+		v.skip(false)
+		if v.pos >= len(v.s) {
+			return fmt.Errorf("inline table is not closed with }; inline tables must fit on one line")
+		}
+		switch v.s[v.pos] {
+		case ',':
+			v.pos++
+			v.skip(false)
+			if v.pos < len(v.s) && v.s[v.pos] == '}' {
+				return fmt.Errorf("inline tables may not have a trailing comma")
+			}
+		case '}':
+			v.pos++
+			return nil
+		default:
+			return fmt.Errorf("inline table entries must be separated by commas")
+		}
+	}
+}
+
+func (v *valueParser) scalar() error {
+	rest := v.s[v.pos:]
+	n := strings.IndexAny(rest, " \t\n,]}#")
+	if n < 0 {
+		n = len(rest)
+	}
+	if datePrefixRe.MatchString(rest) { // 1979-05-27 07:32:00Z
+		if m := strings.IndexAny(rest[11:], " \t\n,]}#"); m >= 0 {
+			n = 11 + m
+		} else {
+			n = len(rest)
+		}
+	}
+	token := rest[:n]
+	for _, re := range scalarRes {
+		if re.MatchString(token) {
+			v.pos += n
+			return nil
+		}
+	}
+	if token == "" {
+		return fmt.Errorf("missing value")
+	}
+	return fmt.Errorf("invalid value %q: strings must be quoted, and numbers, booleans, and dates written as in TOML", token)
+}
+
+// skip skips whitespace and comments, and newlines too inside arrays.
+func (v *valueParser) skip(newlines bool) {
+	for v.pos < len(v.s) {
+		switch ch := v.s[v.pos]; {
+		case ch == ' ' || ch == '\t' || (newlines && (ch == '\n' || ch == '\r')):
+			v.pos++
+		case ch == '#':
+			end := strings.IndexByte(v.s[v.pos:], '\n')
+			if end < 0 || !newlines {
+				v.pos = len(v.s)
+			} else {
+				v.pos += end
+			}
+		default:
+			return
+		}
+	}
+}
+
+// complete reports whether a key = value text has no open multi-line string or array.
+func complete(text string) bool {
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch {
+		case strings.HasPrefix(text[i:], `"""`), strings.HasPrefix(text[i:], "'''"):
+			end := strings.Index(text[i+3:], text[i:i+3])
+			if end < 0 {
+				return false
+			}
+			i += 3 + end + 2
+		case text[i] == '"':
+			end := closingQuote(text[i:], '"')
+			if end < 0 {
+				return true // reported as an unterminated string
+			}
+			i += end
+		case text[i] == '\'':
+			end := strings.IndexByte(text[i+1:], '\'')
+			if end < 0 {
+				return true
+			}
+			i += end + 1
+		case text[i] == '#':
+			end := strings.IndexByte(text[i:], '\n')
+			if end < 0 {
+				return depth == 0
+			}
+			i += end
+		case text[i] == '[':
+			depth++
+		case text[i] == ']':
+			depth--
+		}
+	}
+	return depth <= 0
+}
+
+// closingQuote returns the index of the quote closing a basic string that starts at
+// s[0], skipping escaped quotes, or -1.
+func closingQuote(s string, quote byte) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote:
+			return i
+		}
+	}
+	return -1
+}
+
+func checkEscapes(s string) error {
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			continue
+		}
+		if i+1 >= len(s) {
+			return fmt.Errorf("invalid escape at the end of a string")
+		}
+		switch s[i+1] {
+		case 'b', 't', 'n', 'f', 'r', '"', '\\':
+			i++
+		case 'u', 'U':
+			digits := 4
+			if s[i+1] == 'U' {
+				digits = 8
+			}
+			if i+2+digits > len(s) {
+				return fmt.Errorf("\\%c needs %d hex digits", s[i+1], digits)
+			}
+			if _, err := strconv.ParseUint(s[i+2:i+2+digits], 16, 32); err != nil {
+				return fmt.Errorf("\\%c needs %d hex digits", s[i+1], digits)
+			}
+			i += 1 + digits
+		default:
+			return fmt.Errorf("invalid escape \\%c in string; use a literal string ('...') for backslashes", s[i+1])
+		}
+	}
+	return nil
+}
+
+func stripComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '#':
+			return strings.TrimSpace(s[:i])
+		}
+	}
+	return strings.TrimSpace(s)
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return strconv.Quote(key)
+	}
+	return path + "." + strconv.Quote(key)
+}
+
+func firstWord(s string) string {
+	if i := strings.IndexAny(s, " \t=."); i > 0 {
+		return s[:i]
+	}
+	return s
+}
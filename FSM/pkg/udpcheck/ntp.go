@@ -0,0 +1,145 @@
+package udpcheck
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/capture"
+)
+
+// NTPState is the state reported in NTP findings.
+const NTPState = "NTP"
+
+// NTP modes (RFC 5905).
+const (
+	ntpSymmetricActive  = 1
+	ntpSymmetricPassive = 2
+	ntpClient           = 3
+	ntpServer           = 4
+	ntpBroadcast        = 5
+	ntpControl          = 6
+	ntpPrivate          = 7
+)
+
+// ntpHeader is the length of an NTP packet without extensions or a MAC.
+const ntpHeader = 48
+
+// ntpRequest is a client request waiting for its response.
+type ntpRequest struct {
+	s        capture.Segment
+	version  int
+	transmit uint64
+}
+
+type ntp struct {
+	findings
+	port      int
+	requests  map[netip.AddrPort]ntpRequest // by the client's address and port
+	order     []netip.AddrPort
+	exchanges int
+}
+
+func newNTP(port int) Checker {
+	return &ntp{findings: findings{state: NTPState}, port: port, requests: map[netip.AddrPort]ntpRequest{}}
+}
+
+func (c *ntp) Datagram(s capture.Segment) {
+	if s.Flow.Proto != capture.UDP || (int(s.Flow.Dst.Port()) != c.port && int(s.Flow.Src.Port()) != c.port) {
+		return
+	}
+	d := s.Payload
+	if len(d) < ntpHeader {
+		c.add(s, "", automata.SeverityError, "packet is %d bytes, shorter than the %d-byte NTP header", len(d), ntpHeader)
+		return
+	}
+	leap, version, mode := int(d[0]>>6), int(d[0]>>3&7), int(d[0]&7)
+	stratum := int(d[1])
+	cmd := fmt.Sprintf("NTPv%d mode %d", version, mode)
+	switch {
+	case version < 1 || version > 4:
+		c.add(s, cmd, automata.SeverityError, "version %d is not NTP 1 to 4", version)
+		return
+	case version < 3:
+		c.add(s, cmd, automata.SeverityWarning, "NTP version %d is obsolete", version)
+	}
+	if mode == 0 {
+		c.add(s, cmd, automata.SeverityError, "mode 0 is reserved")
+		return
+	}
+	if mode == ntpControl || mode == ntpPrivate {
+		return // control and private messages have formats of their own
+	}
+	reference := binary.BigEndian.Uint64(d[16:])
+	origin := binary.BigEndian.Uint64(d[24:])
+	receive := binary.BigEndian.Uint64(d[32:])
+	transmit := binary.BigEndian.Uint64(d[40:])
+	if transmit == 0 {
+		c.add(s, cmd, automata.SeverityError, "transmit timestamp is zero")
+	}
+
+	switch mode {
+	case ntpClient:
+		if _, waiting := c.requests[s.Flow.Src]; !waiting {
+			c.order = append(c.order, s.Flow.Src)
+		}
+		c.requests[s.Flow.Src] = ntpRequest{s: s, version: version, transmit: transmit}
+	case ntpServer:
+		req, ok := c.requests[s.Flow.Dst]
+		switch {
+		case !ok:
+			c.add(s, cmd, automata.SeverityWarning, "server response to no request in the capture")
+		case origin != req.transmit:
+			c.add(s, cmd, automata.SeverityError, "origin timestamp does not echo the transmit timestamp of the request in packet %d, so clients discard the response as bogus", req.s.Number)
+		default:
+			c.exchanges++
+			if version != req.version {
+				c.add(s, cmd, automata.SeverityWarning, "response is version %d, but the request was version %d", version, req.version)
+			}
+		}
+		delete(c.requests, s.Flow.Dst)
+		switch {
+		case stratum == 0:
+			c.add(s, cmd, automata.SeverityWarning, "kiss-o'-death %q: the server tells the client to %s", d[12:16], kissMeaning(d[12:16]))
+			return
+		case stratum == 16:
+			c.add(s, cmd, automata.SeverityWarning, "stratum 16: the server is not synchronized")
+		case stratum > 16:
+			c.add(s, cmd, automata.SeverityError, "stratum %d is reserved", stratum)
+		case leap == 3:
+			c.add(s, cmd, automata.SeverityWarning, "leap indicator 3: the server's clock is not synchronized")
+		}
+		if receive != 0 && transmit != 0 && receive > transmit {
+			c.add(s, cmd, automata.SeverityError, "receive timestamp is after the transmit timestamp")
+		}
+		if reference == 0 && stratum > 0 && stratum < 16 {
+			c.add(s, cmd, automata.SeverityWarning, "reference timestamp is zero, though the server claims stratum %d", stratum)
+		}
+	case ntpSymmetricActive, ntpSymmetricPassive, ntpBroadcast:
+		if stratum > 16 {
+			c.add(s, cmd, automata.SeverityError, "stratum %d is reserved", stratum)
+		}
+	}
+}
+
+// kissMeaning describes the kiss codes clients must act on.
+func kissMeaning(id []byte) string {
+	switch string(id) {
+	case "DENY", "RSTR":
+		return "stop sending to it"
+	case "RATE":
+		return "reduce its polling rate"
+	}
+	return "treat the response as unsynchronized"
+}
+
+func (c *ntp) Close() ([]automata.Finding, int) {
+	for _, client := range c.order {
+		if req, ok := c.requests[client]; ok {
+			c.add(req.s, fmt.Sprintf("NTPv%d mode %d", req.version, ntpClient), automata.SeverityWarning, "request has no response in the capture")
+			delete(c.requests, client)
+		}
+	}
+	return c.list, c.exchanges
+}
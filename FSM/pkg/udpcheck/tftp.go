@@ -0,0 +1,326 @@
+package udpcheck
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/capture"
+)
+
+// TFTPState is the state reported in TFTP findings.
+const TFTPState = "TFTP"
+
+// TFTP opcodes (RFC 1350 and RFC 2347).
+const (
+	tftpRRQ   = 1
+	tftpWRQ   = 2
+	tftpDATA  = 3
+	tftpACK   = 4
+	tftpERROR = 5
+	tftpOACK  = 6
+)
+
+var tftpOpcodes = map[uint16]string{tftpRRQ: "RRQ", tftpWRQ: "WRQ", tftpDATA: "DATA", tftpACK: "ACK", tftpERROR: "ERROR", tftpOACK: "OACK"}
+
+// tftpOptions are the options of RFC 2348, 2349, and 7440, with their ranges.
+var tftpOptions = map[string][2]int{
+	"blksize":    {8, 65464},
+	"timeout":    {1, 255},
+	"tsize":      {0, 1<<31 - 1},
+	"windowsize": {1, 65535},
+}
+
+// transfer is a file transfer: a request to the server's port, then DATA and ACK
+// between the client's port and the port the server chose for it (its TID).
+type transfer struct {
+	request  capture.Segment
+	client   netip.AddrPort
+	server   netip.Addr
+	tid      uint16 // 0 until the server answers
+	write    bool
+	file     string
+	options  map[string]string
+	blksize  int
+	window   int
+	dataSeen bool
+	lastData uint16
+	ackSeen  bool
+	lastAck  uint16
+	final    bool // the last, short, block was sent
+	done     bool
+	rolled   bool
+}
+
+type tftp struct {
+	findings
+	port      int
+	transfers map[netip.AddrPort]*transfer // by the client's address and port
+	order     []*transfer
+}
+
+func newTFTP(port int) Checker {
+	return &tftp{findings: findings{state: TFTPState}, port: port, transfers: map[netip.AddrPort]*transfer{}}
+}
+
+func (c *tftp) Datagram(s capture.Segment) {
+	if s.Flow.Proto != capture.UDP {
+		return
+	}
+	if int(s.Flow.Dst.Port()) == c.port {
+		c.request(s)
+		return
+	}
+	if t := c.transfers[s.Flow.Src]; t != nil && t.server == s.Flow.Dst.Addr() {
+		if t.tid != 0 && s.Flow.Dst.Port() != t.tid {
+			c.add(s, "", automata.SeverityError, "client sends to port %d, but the server's TID for the transfer is %d", s.Flow.Dst.Port(), t.tid)
+		}
+		c.packet(t, s, true)
+		return
+	}
+	if t := c.transfers[s.Flow.Dst]; t != nil && t.server == s.Flow.Src.Addr() {
+		switch {
+		case t.tid == 0:
+			t.tid = s.Flow.Src.Port()
+		case s.Flow.Src.Port() != t.tid:
+			c.add(s, "", automata.SeverityError, "server sends from port %d, which is not the transfer's TID %d; the client should answer it with ERROR 5", s.Flow.Src.Port(), t.tid)
+			return
+		}
+		c.packet(t, s, false)
+	}
+}
+
+// request checks a datagram to the server's port, which starts a transfer.
+func (c *tftp) request(s capture.Segment) {
+	d := s.Payload
+	if len(d) < 2 {
+		c.add(s, "", automata.SeverityError, "datagram is too short to hold an opcode")
+		return
+	}
+	op := binary.BigEndian.Uint16(d)
+	if op != tftpRRQ && op != tftpWRQ {
+		c.add(s, opName(op), automata.SeverityError, "%s is sent to port %d, which only takes RRQ and WRQ", opName(op), c.port)
+		return
+	}
+	if old := c.transfers[s.Flow.Src]; old != nil && !old.done {
+		c.add(s, opName(op), automata.SeverityWarning, "new request from the port of a transfer that did not finish")
+	}
+	t := &transfer{request: s, client: s.Flow.Src, server: s.Flow.Dst.Addr(), write: op == tftpWRQ, blksize: 512, window: 1}
+	c.transfers[s.Flow.Src] = t
+	c.order = append(c.order, t)
+
+	fields := bytes.Split(d[2:], []byte{0})
+	if len(fields) < 3 || len(fields[len(fields)-1]) != 0 {
+		c.add(s, opName(op), automata.SeverityError, "request must be filename, mode, and options, each ending in NUL")
+		return
+	}
+	fields = fields[:len(fields)-1]
+	t.file = string(fields[0])
+	cmd := fmt.Sprintf("%s %s", opName(op), t.file)
+	if t.file == "" {
+		c.add(s, cmd, automata.SeverityError, "request names no file")
+	}
+	switch mode := strings.ToLower(string(fields[1])); mode {
+	case "netascii", "octet":
+	case "mail":
+		c.add(s, cmd, automata.SeverityWarning, "mode mail is obsolete")
+	default:
+		c.add(s, cmd, automata.SeverityError, "mode %q is not netascii or octet", fields[1])
+	}
+	opts := fields[2:]
+	if len(opts)%2 != 0 {
+		c.add(s, cmd, automata.SeverityError, "option %q has no value", opts[len(opts)-1])
+		opts = opts[:len(opts)-1]
+	}
+	if len(opts) > 0 {
+		t.options = map[string]string{}
+	}
+	for i := 0; i < len(opts); i += 2 {
+		name, value := strings.ToLower(string(opts[i])), string(opts[i+1])
+		if _, dup := t.options[name]; dup {
+			c.add(s, cmd, automata.SeverityError, "option %s is given twice", name)
+		}
+		t.options[name] = value
+		r, known := tftpOptions[name]
+		if !known {
+			c.add(s, cmd, automata.SeverityWarning, "unknown option %s", name)
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		switch {
+		case err != nil || n < r[0] || n > r[1]:
+			c.add(s, cmd, automata.SeverityError, "option %s %q is not %d to %d", name, value, r[0], r[1])
+		case name == "tsize" && !t.write && n != 0:
+			c.add(s, cmd, automata.SeverityError, "tsize in a read request must be 0, asking the server for the size")
+		}
+	}
+}
+
+// packet checks a datagram of a transfer after its request.
+func (c *tftp) packet(t *transfer, s capture.Segment, fromClient bool) {
+	d := s.Payload
+	if len(d) < 2 {
+		c.add(s, "", automata.SeverityError, "datagram is too short to hold an opcode")
+		return
+	}
+	op := binary.BigEndian.Uint16(d)
+	sender := fromClient == t.write // the side sending the file
+	if t.done && op != tftpERROR {
+		c.add(s, opName(op), automata.SeverityWarning, "%s after the transfer of %s ended", opName(op), t.file)
+		return
+	}
+	switch op {
+	case tftpDATA:
+		if len(d) < 4 {
+			c.add(s, "DATA", automata.SeverityError, "DATA is too short to hold a block number")
+			return
+		}
+		c.data(t, s, binary.BigEndian.Uint16(d[2:]), len(d)-4, sender)
+	case tftpACK:
+		if len(d) != 4 {
+			c.add(s, "ACK", automata.SeverityError, "ACK is %d bytes rather than 4", len(d))
+			if len(d) < 4 {
+				return
+			}
+		}
+		c.ack(t, s, binary.BigEndian.Uint16(d[2:]), sender)
+	case tftpERROR:
+		t.done = true
+		if len(d) < 5 || d[len(d)-1] != 0 {
+			c.add(s, "ERROR", automata.SeverityError, "ERROR must be a code and a message ending in NUL")
+			return
+		}
+		if code := binary.BigEndian.Uint16(d[2:]); code > 8 {
+			c.add(s, "ERROR", automata.SeverityError, "error code %d is not defined", code)
+		}
+	case tftpOACK:
+		c.oack(t, s, fromClient)
+	case tftpRRQ, tftpWRQ:
+		c.add(s, opName(op), automata.SeverityError, "%s is sent to the transfer's TID rather than port %d", opName(op), c.port)
+	default:
+		c.add(s, opName(op), automata.SeverityError, "opcode %d is not a TFTP opcode", op)
+	}
+}
+
+func (c *tftp) data(t *transfer, s capture.Segment, block uint16, n int, sender bool) {
+	cmd := fmt.Sprintf("DATA %d", block)
+	if !sender {
+		c.add(s, cmd, automata.SeverityError, "DATA is sent by the side receiving %s", t.file)
+		return
+	}
+	if n > t.blksize {
+		c.add(s, cmd, automata.SeverityError, "block holds %d bytes, more than the block size of %d", n, t.blksize)
+	}
+	expect := t.lastData + 1
+	switch {
+	case t.write && !t.ackSeen:
+		c.add(s, cmd, automata.SeverityError, "DATA is sent before the server acknowledged the write request")
+	case t.dataSeen && block == t.lastData:
+		c.add(s, cmd, automata.SeverityWarning, "block %d is sent again", block)
+		return
+	case t.final:
+		c.add(s, cmd, automata.SeverityError, "DATA after block %d, which was shorter than the block size and so the last", t.lastData)
+		return
+	case block != expect:
+		c.add(s, cmd, automata.SeverityError, "block %d is out of sequence; expected %d", block, expect)
+	case (t.ackSeen || !t.write) && block-t.lastAck > uint16(t.window):
+		c.add(s, cmd, automata.SeverityError, "block %d is sent before block %d is acknowledged, beyond a window of %d", block, t.lastAck+1, t.window)
+	}
+	if block == 0 && !t.rolled && t.dataSeen {
+		t.rolled = true
+		c.add(s, cmd, automata.SeverityWarning, "block numbers roll over past 65535, which not every implementation supports")
+	}
+	t.dataSeen, t.lastData = true, block
+	t.final = n < t.blksize
+}
+
+func (c *tftp) ack(t *transfer, s capture.Segment, block uint16, sender bool) {
+	cmd := fmt.Sprintf("ACK %d", block)
+	if sender {
+		c.add(s, cmd, automata.SeverityError, "ACK is sent by the side sending %s", t.file)
+		return
+	}
+	switch {
+	case block == 0 && !t.dataSeen && (t.write || t.options != nil):
+		// acknowledges the write request, or for a read the OACK
+	case !t.dataSeen || t.lastData-block >= 1<<15:
+		c.add(s, cmd, automata.SeverityError, "ACK for block %d, which was not sent", block)
+		return
+	case t.ackSeen && block == t.lastAck:
+		c.add(s, cmd, automata.SeverityWarning, "block %d is acknowledged again", block)
+	}
+	t.ackSeen, t.lastAck = true, block
+	if t.final && block == t.lastData {
+		t.done = true
+	}
+}
+
+// oack checks an option acknowledgment: the server's answer to a request with
+// options, which may only accept options the client asked for.
+func (c *tftp) oack(t *transfer, s capture.Segment, fromClient bool) {
+	switch {
+	case fromClient:
+		c.add(s, "OACK", automata.SeverityError, "OACK is sent by the client")
+		return
+	case t.options == nil:
+		c.add(s, "OACK", automata.SeverityError, "OACK answers a request that had no options")
+		return
+	case t.dataSeen || t.ackSeen:
+		c.add(s, "OACK", automata.SeverityError, "OACK after the transfer started")
+		return
+	}
+	fields := bytes.Split(s.Payload[2:], []byte{0})
+	if len(fields) < 3 || len(fields)%2 != 1 || len(fields[len(fields)-1]) != 0 {
+		c.add(s, "OACK", automata.SeverityError, "OACK must be option and value pairs, each ending in NUL")
+		return
+	}
+	for i := 0; i+1 < len(fields)-1; i += 2 {
+		name, value := strings.ToLower(string(fields[i])), string(fields[i+1])
+		asked, ok := t.options[name]
+		if !ok {
+			c.add(s, "OACK", automata.SeverityError, "OACK accepts option %s, which the request did not have", name)
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		a, _ := strconv.Atoi(asked)
+		switch {
+		case err != nil:
+			c.add(s, "OACK", automata.SeverityError, "option %s %q is not a number", name, value)
+		case (name == "blksize" || name == "windowsize") && n > a:
+			c.add(s, "OACK", automata.SeverityError, "option %s %d is more than the %d requested", name, n, a)
+		case name == "timeout" && n != a:
+			c.add(s, "OACK", automata.SeverityError, "option timeout %d differs from the %d requested", n, a)
+		case name == "blksize":
+			t.blksize = n
+		case name == "windowsize":
+			t.window = n
+		}
+	}
+	if t.write {
+		t.ackSeen = true // the OACK stands for ACK 0
+	}
+}
+
+func (c *tftp) Close() ([]automata.Finding, int) {
+	for _, t := range c.order {
+		switch {
+		case t.done:
+		case t.tid == 0:
+			c.add(t.request, opName(binary.BigEndian.Uint16(t.request.Payload)), automata.SeverityWarning, "request for %s is never answered", t.file)
+		default:
+			c.add(t.request, "", automata.SeverityWarning, "transfer of %s does not finish in the capture", t.file)
+		}
+	}
+	return c.list, len(c.order)
+}
+
+func opName(op uint16) string {
+	if name, ok := tftpOpcodes[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("opcode %d", op)
+}
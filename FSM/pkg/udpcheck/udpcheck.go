@@ -0,0 +1,59 @@
+// Package udpcheck validates simple protocols carried over UDP, such as TFTP and NTP,
+// from the datagrams of a capture in order. Unlike protocols on TCP, their exchanges
+// are not byte streams but datagrams each side answers, so each checker follows the
+// state of every exchange as its datagrams arrive. Each protocol is an entry in
+// Protocols, so others are added without changing callers.
+package udpcheck
+
+import (
+	"fmt"
+	"sort"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/capture"
+)
+
+// Protocol is a protocol carried over UDP.
+type Protocol struct {
+	Name string
+	Port int // well-known server port
+	// New returns a checker of the exchanges with a server on port.
+	New func(port int) Checker
+}
+
+// Checker checks the datagrams of a capture.
+type Checker interface {
+	// Datagram checks the next UDP datagram of the capture. Datagrams of other
+	// protocols are ignored.
+	Datagram(s capture.Segment)
+	// Close checks the exchanges that never ended, and returns the findings and the
+	// number of exchanges seen.
+	Close() (findings []automata.Finding, exchanges int)
+}
+
+// Protocols are the protocols validated, by name.
+var Protocols = map[string]Protocol{
+	"tftp": {Name: "TFTP", Port: 69, New: newTFTP},
+	"ntp":  {Name: "NTP", Port: 123, New: newNTP},
+}
+
+// Names returns the names of the protocols, sorted.
+func Names() []string {
+	var names []string
+	for name := range Protocols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// findings collects findings, each about a datagram of the capture.
+type findings struct {
+	state string
+	list  []automata.Finding
+}
+
+func (f *findings) add(s capture.Segment, command, severity, format string, args ...any) {
+	f.list = append(f.list, automata.Finding{Command: command, State: f.state, Severity: severity, Packet: s.Number,
+		Message: fmt.Sprintf("packet %d (%s): %s", s.Number, s.Flow, fmt.Sprintf(format, args...))})
+}
@@ -0,0 +1,92 @@
+package validation
+
+import (
+	"encoding/json"
+	"os"
+
+	"config-validator/pkg/automata"
+)
+
+// EntryResult is the report for one file inside an archive.
+type EntryResult struct {
+	Name     string   `json:"name"`
+	Kind     string   `json:"kind"` // config, json, or the name of the plugin that validated it
+	Status   string   `json:"status"`
+	Errors   []string `json:"errors,omitempty"`
+	Score    int      `json:"score"`
+	Grade    string   `json:"grade"`
+	Encoding string   `json:"encoding,omitempty"`
+	SHA256   string   `json:"sha256"` // of the entry's content
+	// Owners lists the findings by owner when an owners file was used.
+	Owners map[string][]string `json:"owners,omitempty"`
+	// Findings are the structured errors, for annotations.
+	Findings []automata.Finding `json:"-"`
+}
+
+// NewEntryResult scores the findings of one archive entry.
+func NewEntryResult(name, kind string, findings []automata.Finding) EntryResult {
+	e := EntryResult{
+		Name:     name,
+		Kind:     kind,
+		Status:   "success",
+		Errors:   FormatFindings(findings),
+		Score:    Score(findings),
+		Owners:   FindingsByOwner(findings),
+		Findings: findings,
+	}
+	if len(findings) > 0 {
+		e.Status = "failed"
+	}
+	e.Grade = Grade(e.Score)
+	return e
+}
+
+// ArchiveReport summarizes the validation of every matching file in an archive.
+type ArchiveReport struct {
+	Status  string        `json:"status"`
+	Archive string        `json:"archive"`
+	Total   int           `json:"total"`
+	Passed  int           `json:"passed"`
+	Failed  int           `json:"failed"`
+	Score   int           `json:"score"` // average over the entries
+	Grade   string        `json:"grade"`
+	Entries []EntryResult `json:"entries"`
+}
+
+// NewArchiveReport tallies the entry results into an archive-level summary.
+func NewArchiveReport(archive string, entries []EntryResult) *ArchiveReport {
+	report := &ArchiveReport{Archive: archive, Total: len(entries), Entries: entries, Score: 100}
+	total := 0
+	for _, e := range entries {
+		total += e.Score
+		if e.Status == "success" {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+	}
+	if len(entries) > 0 {
+		report.Score = total / len(entries)
+	}
+	report.Grade = Grade(report.Score)
+	if report.Failed == 0 {
+		report.Status = "success"
+	} else {
+		report.Status = "failed"
+	}
+	return report
+}
+
+// GenerateArchiveReport writes the archive report as a JSON file.
+func GenerateArchiveReport(report *ArchiveReport, outputFile string) error {
+	data, err := ArchiveReportJSON(report)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outputFile, data, 0644)
+}
+
+// ArchiveReportJSON returns the archive report GenerateArchiveReport writes.
+func ArchiveReportJSON(report *ArchiveReport) ([]byte, error) {
+	return json.MarshalIndent(report, "", "  ")
+}
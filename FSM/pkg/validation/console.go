@@ -0,0 +1,170 @@
+package validation
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"config-validator/pkg/automata"
+)
+
+// ConsoleOptions control how WriteConsole renders findings.
+type ConsoleOptions struct {
+	Color   bool   // ANSI colors, see UseColor
+	Summary string // appended to the summary line, such as the score and report path
+	// SummaryOnly leaves the findings out, for scripts that only want the totals.
+	SummaryOnly bool
+	// MaxFindings prints only the first this many findings, across the files; the
+	// summary line still counts every finding. 0 prints all.
+	MaxFindings int
+}
+
+// ANSI escape sequences of the console renderer.
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiDim    = "\x1b[2m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiPurple = "\x1b[35m"
+	ansiCyan   = "\x1b[36m"
+)
+
+// severityColor is the color of a severity on the console.
+func severityColor(severity string) string {
+	switch severity {
+	case automata.SeverityError:
+		return ansiRed
+	case automata.SeveritySecurity:
+		return ansiPurple
+	case automata.SeverityWarning:
+		return ansiYellow
+	}
+	return ansiCyan
+}
+
+// UseColor reports whether console output to w should be colored: only on a
+// terminal, and never when the NO_COLOR environment variable is set (no-color.org).
+func UseColor(w io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// WriteConsole renders findings for a person at a terminal: grouped by file, then by
+// severity with the worst first, each group headed by its count and sorted by line.
+// Files without findings are left out. A summary line with the totals per severity
+// ends the output.
+func WriteConsole(w io.Writer, files []FileFindings, opts ConsoleOptions) error {
+	paint := func(color, s string) string {
+		if !opts.Color {
+			return s
+		}
+		return color + s + ansiReset
+	}
+
+	totals := map[string]int{}
+	failed, findings, shown := 0, 0, 0
+	var b strings.Builder
+	for i, file := range LimitFiles(files, opts.MaxFindings) {
+		for _, f := range files[i].Findings {
+			severity := f.Severity
+			if severity == "" {
+				severity = automata.SeverityError
+			}
+			totals[severity]++
+		}
+		if len(files[i].Findings) == 0 {
+			continue
+		}
+		failed++
+		findings += len(files[i].Findings)
+		shown += len(file.Findings)
+		if opts.SummaryOnly || len(file.Findings) == 0 {
+			continue
+		}
+		groups := map[string][]automata.Finding{}
+		for _, f := range file.Findings {
+			severity := f.Severity
+			if severity == "" {
+				severity = automata.SeverityError
+			}
+			groups[severity] = append(groups[severity], f)
+		}
+
+		fmt.Fprintf(&b, "%s\n", paint(ansiBold, file.File))
+		for _, severity := range bySeverity(groups) {
+			group := groups[severity]
+			sort.SliceStable(group, func(i, j int) bool { return group[i].Line < group[j].Line })
+			fmt.Fprintf(&b, "  %s\n", paint(severityColor(severity), fmt.Sprintf("%s (%d)", severity, len(group))))
+			for _, f := range group {
+				where := "file"
+				if f.Line > 0 {
+					where = fmt.Sprintf("line %d", f.Line)
+				}
+				fmt.Fprintf(&b, "    %s  %s", paint(ansiDim, fmt.Sprintf("%-10s", where)), f.Message)
+				if f.Code != "" {
+					fmt.Fprintf(&b, "  %s", paint(ansiDim, f.Code))
+				}
+				if f.Owner != "" {
+					fmt.Fprintf(&b, "  %s", paint(ansiDim, "@"+f.Owner))
+				}
+				b.WriteString("\n")
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	if !opts.SummaryOnly && shown < findings {
+		fmt.Fprintf(&b, "%s\n\n", paint(ansiDim, fmt.Sprintf("%d more findings not shown", findings-shown)))
+	}
+	noun := "files"
+	if len(files) == 1 {
+		noun = "file"
+	}
+	if findings == 0 {
+		fmt.Fprintf(&b, "%s No findings in %d %s", paint(ansiGreen, "✔"), len(files), noun)
+	} else {
+		var counts []string
+		for _, severity := range bySeverity(totals) {
+			counts = append(counts, paint(severityColor(severity), fmt.Sprintf("%s %d", severity, totals[severity])))
+		}
+		what := "findings"
+		if findings == 1 {
+			what = "finding"
+		}
+		fmt.Fprintf(&b, "%s %d %s in %d of %d %s (%s)", paint(ansiRed, "✖"), findings, what, failed, len(files), noun, strings.Join(counts, ", "))
+	}
+	if opts.Summary != "" {
+		b.WriteString(", " + opts.Summary)
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// bySeverity returns the severities of m, the worst first: by their SeverityPenalty,
+// then by name.
+func bySeverity[T any](m map[string]T) []string {
+	severities := make([]string, 0, len(m))
+	for s := range m {
+		severities = append(severities, s)
+	}
+	sort.Slice(severities, func(i, j int) bool {
+		pi, pj := SeverityPenalty[severities[i]], SeverityPenalty[severities[j]]
+		if pi != pj {
+			return pi > pj
+		}
+		return severities[i] < severities[j]
+	})
+	return severities
+}
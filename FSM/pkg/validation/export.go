@@ -0,0 +1,152 @@
+package validation
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"config-validator/pkg/automata"
+)
+
+// FileFindings are the findings of one file, for exports covering several files
+// such as the entries of an archive.
+type FileFindings struct {
+	File     string
+	Findings []automata.Finding
+}
+
+// exportColumns are the columns of the CSV and XLSX exports, one row per finding.
+// Findings carry no column, so that one is left empty for tools that expect it.
+var exportColumns = []string{"file", "line", "column", "code", "severity", "state", "message", "owner"}
+
+// exportRows renders the findings as rows of exportColumns. Findings about a file as
+// a whole have no line.
+func exportRows(files []FileFindings) [][]string {
+	var rows [][]string
+	for _, ff := range files {
+		for _, f := range ff.Findings {
+			line := ""
+			if f.Line > 0 {
+				line = strconv.Itoa(f.Line)
+			}
+			severity := f.Severity
+			if severity == "" {
+				severity = automata.SeverityError
+			}
+			rows = append(rows, []string{ff.File, line, "", f.Code, severity, f.State, f.Message, f.Owner})
+		}
+	}
+	return rows
+}
+
+// WriteFindingsCSV writes the findings as CSV with a header row. Cells that a
+// spreadsheet would take for a formula are prefixed with a quote, since messages
+// quote lines of untrusted configs.
+func WriteFindingsCSV(w io.Writer, files ...FileFindings) error {
+	cw := csv.NewWriter(w)
+	cw.Write(exportColumns)
+	for _, row := range exportRows(files) {
+		for i, cell := range row {
+			if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+				row[i] = "'" + cell
+			}
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteFindingsXLSX writes the findings as an Excel workbook of one sheet, with a
+// bold, frozen header row and filters on every column.
+func WriteFindingsXLSX(w io.Writer, files ...FileFindings) error {
+	rows := exportRows(files)
+	var sheet strings.Builder
+	sheet.WriteString(xml.Header)
+	sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	sheet.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	sheet.WriteString(`<cols><col min="1" max="1" width="32" customWidth="1"/><col min="2" max="3" width="8" customWidth="1"/>` +
+		`<col min="4" max="6" width="24" customWidth="1"/><col min="7" max="7" width="100" customWidth="1"/></cols><sheetData>`)
+	writeRow := func(n int, cells []string, style string) {
+		fmt.Fprintf(&sheet, `<row r="%d">`, n)
+		for i, cell := range cells {
+			ref := fmt.Sprintf("%c%d", 'A'+i, n)
+			if cell == "" {
+				continue
+			}
+			if exportColumns[i] == "line" && n > 1 {
+				fmt.Fprintf(&sheet, `<c r="%s"><v>%s</v></c>`, ref, cell)
+				continue
+			}
+			fmt.Fprintf(&sheet, `<c r="%s" t="inlineStr"%s><is><t xml:space="preserve">%s</t></is></c>`, ref, style, xmlEscape(cell))
+		}
+		sheet.WriteString(`</row>`)
+	}
+	writeRow(1, exportColumns, ` s="1"`)
+	for i, row := range rows {
+		writeRow(i+2, row, "")
+	}
+	fmt.Fprintf(&sheet, `</sheetData><autoFilter ref="A1:%c%d"/></worksheet>`, 'A'+len(exportColumns)-1, len(rows)+1)
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+			`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+			`</Types>`},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+			`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Findings" sheetId="1" r:id="rId1"/></sheets>` +
+			`<definedNames><definedName name="_xlnm._FilterDatabase" localSheetId="0" hidden="1">` +
+			fmt.Sprintf("Findings!$A$1:$%c$%d", 'A'+len(exportColumns)-1, len(rows)+1) + `</definedName></definedNames></workbook>`},
+		{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+			`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+			`</Relationships>`},
+		{"xl/styles.xml", xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+			`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+			`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+			`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+			`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+			`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+			`</styleSheet>`},
+		{"xl/worksheets/sheet1.xml", sheet.String()},
+	}
+
+	zw := zip.NewWriter(w)
+	for _, p := range parts {
+		f, err := zw.Create(p.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, p.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// xmlEscape escapes text for an XML element, dropping the control characters XML
+// does not allow.
+func xmlEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	var out strings.Builder
+	xml.EscapeText(&out, []byte(b.String()))
+	return out.String()
+}
@@ -0,0 +1,132 @@
+package validation
+
+import (
+	"fmt"
+	"path"
+
+	"config-validator/pkg/automata"
+)
+
+// Filter narrows the findings of a run, so a run can focus on some of the rules
+// without editing the rules file. Rules are named by the state of their findings
+// (such as INTERFACE or HARDENING) or by their catalog code (such as hardening.ntp),
+// with path.Match globs such as hardening.*. Codes are only known once the findings
+// went through an i18n catalog, so filter localized findings.
+type Filter struct {
+	OnlyRules    []string // keep only findings of these rules; all when empty
+	ExcludeRules []string // then drop findings of these rules
+	Severities   []string // keep only findings of these severities; all when empty
+	// MaxFindings limits the findings printed to the first this many, 0 for no limit.
+	// Apply leaves it to the printing (see Limit and LimitFiles), so that the report,
+	// the score, and the exit status still cover every finding the rules keep.
+	MaxFindings int
+}
+
+// Active reports whether Apply drops anything.
+func (f *Filter) Active() bool {
+	return f != nil && (len(f.OnlyRules) > 0 || len(f.ExcludeRules) > 0 || len(f.Severities) > 0)
+}
+
+// Check reports malformed globs and unknown severities.
+func (f *Filter) Check() error {
+	for _, glob := range append(append([]string{}, f.OnlyRules...), f.ExcludeRules...) {
+		if _, err := path.Match(glob, ""); err != nil {
+			return fmt.Errorf("rule pattern %q: %v", glob, err)
+		}
+	}
+	for _, s := range f.Severities {
+		if _, ok := SeverityPenalty[s]; !ok {
+			return fmt.Errorf("unknown severity %q: use error, warning, or security", s)
+		}
+	}
+	if f.MaxFindings < 0 {
+		return fmt.Errorf("the maximum number of findings cannot be negative")
+	}
+	return nil
+}
+
+// Apply returns the findings the filter keeps by rule and severity, in their order.
+// The findings are not modified.
+func (f *Filter) Apply(findings []automata.Finding) []automata.Finding {
+	if !f.Active() {
+		return findings
+	}
+	var out []automata.Finding
+	for _, finding := range findings {
+		if f.Keeps(finding) {
+			out = append(out, finding)
+		}
+	}
+	return out
+}
+
+// Limit returns the findings to print: the first MaxFindings of them.
+func (f *Filter) Limit(findings []automata.Finding) []automata.Finding {
+	if f == nil || f.MaxFindings == 0 || len(findings) <= f.MaxFindings {
+		return findings
+	}
+	return findings[:f.MaxFindings]
+}
+
+// LimitFiles returns the findings of files to print: the first max of them, counted
+// across the files in order, or all of them when max is 0.
+func LimitFiles(files []FileFindings, max int) []FileFindings {
+	if max == 0 {
+		return files
+	}
+	out := make([]FileFindings, len(files))
+	for i, file := range files {
+		out[i] = FileFindings{File: file.File, Findings: file.Findings[:min(len(file.Findings), max)]}
+		max -= len(out[i].Findings)
+	}
+	return out
+}
+
+// ApplyFSM filters the findings of a validation run, and the Errors entries rendered
+// from them.
+func (f *Filter) ApplyFSM(fsm *automata.FSM) {
+	if !f.Active() {
+		return
+	}
+	fsm.Findings = f.Apply(fsm.Findings)
+	fsm.Errors = FormatFindings(fsm.Findings)
+}
+
+// Keeps reports whether the filter keeps a finding by its rule and severity, for
+// findings printed as they are found; MaxFindings is left to the caller.
+func (f *Filter) Keeps(finding automata.Finding) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.OnlyRules) > 0 && !matchesRule(f.OnlyRules, finding) {
+		return false
+	}
+	if matchesRule(f.ExcludeRules, finding) {
+		return false
+	}
+	if len(f.Severities) == 0 {
+		return true
+	}
+	severity := finding.Severity
+	if severity == "" {
+		severity = automata.SeverityError
+	}
+	for _, s := range f.Severities {
+		if s == severity {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesRule reports whether a glob matches the finding's state or code.
+func matchesRule(globs []string, finding automata.Finding) bool {
+	for _, glob := range globs {
+		for _, name := range []string{finding.State, finding.Code} {
+			if ok, _ := path.Match(glob, name); ok && name != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
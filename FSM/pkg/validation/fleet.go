@@ -0,0 +1,109 @@
+package validation
+
+import (
+	"encoding/json"
+	"os"
+
+	"config-validator/pkg/automata"
+)
+
+// DeviceResult is the per-device drill-down entry of a fleet report.
+type DeviceResult struct {
+	Name       string   `json:"name"`
+	Host       string   `json:"host"`
+	Vendor     string   `json:"vendor,omitempty"`
+	Status     string   `json:"status"` // success, failed, or unreachable
+	Error      string   `json:"error,omitempty"`
+	ConfigFile string   `json:"config_file,omitempty"`
+	RulesFile  string   `json:"rules_file,omitempty"`
+	ReportFile string   `json:"report_file,omitempty"`
+	Errors     []string `json:"errors,omitempty"`
+	Score      *int     `json:"score,omitempty"` // unset when the device could not be validated
+	Grade      string   `json:"grade,omitempty"`
+	// RemediationFile is the config snippet fixing the findings that have known fixes.
+	RemediationFile string `json:"remediation_file,omitempty"`
+	// ConfigSHA256 is the sha256 of the fetched config, which ConfigFile holds
+	// encrypted when the run encrypts its files.
+	ConfigSHA256 string `json:"config_sha256,omitempty"`
+	// Baselined counts the findings left out as in the baseline (see pkg/baseline), and
+	// Resolved lists the findings of the baseline the device no longer has.
+	Baselined int      `json:"baselined,omitempty"`
+	Resolved  []string `json:"resolved,omitempty"`
+	// Owners lists the findings by owner when an owners file was used.
+	Owners map[string][]string `json:"owners,omitempty"`
+	// Stats are in the device's own report; the fleet report adds them up.
+	Stats *automata.Stats `json:"-"`
+	// Findings are the structured errors, for baselines.
+	Findings []automata.Finding `json:"-"`
+}
+
+// FleetReport summarizes the validation of every device in an inventory.
+type FleetReport struct {
+	Status      string         `json:"status"`
+	Total       int            `json:"total"`
+	Passed      int            `json:"passed"`
+	Failed      int            `json:"failed"`
+	Unreachable int            `json:"unreachable"`
+	Score       int            `json:"score"` // average over the devices that were validated
+	Grade       string         `json:"grade"`
+	Devices     []DeviceResult `json:"devices"`
+	// Stats adds up the rule statistics of every validated device, so states that
+	// never activate anywhere in the fleet stand out.
+	Stats *automata.Stats `json:"stats,omitempty"`
+}
+
+// NewFleetReport tallies the device results into a fleet-level summary.
+func NewFleetReport(results []DeviceResult) *FleetReport {
+	report := &FleetReport{
+		Total:   len(results),
+		Devices: results,
+	}
+	scored, total := 0, 0
+	var stats []*automata.Stats
+	for _, r := range results {
+		if r.Stats != nil {
+			stats = append(stats, r.Stats)
+		}
+		if r.Score != nil {
+			scored++
+			total += *r.Score
+		}
+		switch r.Status {
+		case "success":
+			report.Passed++
+		case "unreachable":
+			report.Unreachable++
+		default:
+			report.Failed++
+		}
+	}
+
+	if scored > 0 {
+		report.Score = total / scored
+	}
+	report.Grade = Grade(report.Score)
+	if len(stats) > 0 {
+		report.Stats = automata.MergeStats(stats...)
+	}
+
+	if report.Passed == report.Total {
+		report.Status = "success"
+	} else {
+		report.Status = "failed"
+	}
+	return report
+}
+
+// GenerateFleetReport writes the fleet summary as a JSON file.
+func GenerateFleetReport(report *FleetReport, outputFile string) error {
+	data, err := FleetReportJSON(report)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outputFile, data, 0644)
+}
+
+// FleetReportJSON returns the fleet summary GenerateFleetReport writes.
+func FleetReportJSON(report *FleetReport) ([]byte, error) {
+	return json.MarshalIndent(report, "", "  ")
+}
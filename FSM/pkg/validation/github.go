@@ -0,0 +1,55 @@
+package validation
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"config-validator/pkg/automata"
+)
+
+// WriteGitHubAnnotations writes one workflow command per finding, which GitHub Actions
+// turns into inline annotations on the given file in pull requests. The command follows
+// the finding's severity, see githubCommand.
+func WriteGitHubAnnotations(w io.Writer, file string, findings []automata.Finding) error {
+	for _, f := range findings {
+		title := "config-validator"
+		if f.State != "" {
+			title += ": " + f.State
+		}
+		location := "file=" + escapeGitHubProperty(file)
+		if f.Line > 0 {
+			location += fmt.Sprintf(",line=%d", f.Line) // findings about the whole file have none
+		}
+		_, err := fmt.Fprintf(w, "::%s %s,title=%s::%s\n",
+			githubCommand(f.Severity), location, escapeGitHubProperty(title), escapeGitHubData(f.Message))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// githubCommand returns the annotation level for a severity: errors and security
+// findings are `error`, warnings are `warning`, and any other severity, such as one
+// read back from a report by ParseFindings, is a `notice`.
+func githubCommand(severity string) string {
+	switch severity {
+	case "", automata.SeverityError, automata.SeveritySecurity:
+		return "error"
+	case automata.SeverityWarning:
+		return "warning"
+	}
+	return "notice"
+}
+
+// escapeGitHubData escapes a workflow command message.
+func escapeGitHubData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeGitHubProperty escapes a workflow command property value, which additionally
+// cannot contain the ':' and ',' separators.
+func escapeGitHubProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
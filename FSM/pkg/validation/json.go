@@ -0,0 +1,117 @@
+package validation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"config-validator/pkg/automata"
+)
+
+// CheckJSON reports JSON syntax errors in a payload as findings, so JSON files can be
+// gated alongside configs by the webhook and git hook modes. The full PDA-based JSON
+// validator lives in the PDA project; this is a syntax-only check.
+//
+// Valid payloads, the common case for servers and proxies, are only scanned, which
+// allocates nothing; invalid ones are decoded again to locate the error.
+func CheckJSON(payload []byte) []automata.Finding {
+	if json.Valid(payload) {
+		return nil
+	}
+	var v any
+	err := json.Unmarshal(payload, &v)
+	if err == nil {
+		return nil
+	}
+
+	offset := int64(len(payload))
+	if se, ok := err.(*json.SyntaxError); ok {
+		offset = se.Offset
+	}
+	if offset > int64(len(payload)) {
+		offset = int64(len(payload))
+	}
+	line := bytes.Count(payload[:offset], []byte("\n")) + 1
+	return []automata.Finding{{
+		Line:    line,
+		State:   "JSON",
+		Message: fmt.Sprintf("invalid JSON at offset %d: %v", offset, err),
+		Code:    "json.invalid",
+	}}
+}
+
+// JSONRepair is a single edit that fixes the first structural JSON error: a
+// trailing comma, a missing or unmatched bracket, or an unterminated string.
+type JSONRepair struct {
+	Title  string
+	Offset int // byte offset of the edit
+	Length int // bytes removed
+	Text   string
+}
+
+// RepairJSON finds the first structural error of a payload with a stack of the
+// open objects and arrays, as the PDA validator does, and returns the edit fixing
+// it. It returns false when there is none it knows how to fix. Applying the edit
+// may reveal the next error.
+func RepairJSON(payload []byte) (JSONRepair, bool) {
+	var stack []byte // the closing bracket each open object or array expects
+	lastComma := -1  // a comma with only whitespace after it so far
+	inString, escaped := false, false
+	for i, c := range payload {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString, lastComma = true, -1
+		case '{':
+			stack, lastComma = append(stack, '}'), -1
+		case '[':
+			stack, lastComma = append(stack, ']'), -1
+		case ',':
+			lastComma = i
+		case '}', ']':
+			if lastComma >= 0 {
+				return JSONRepair{Title: "Remove trailing comma", Offset: lastComma, Length: 1}, true
+			}
+			if len(stack) == 0 {
+				return JSONRepair{Title: fmt.Sprintf("Remove unmatched '%c'", c), Offset: i, Length: 1}, true
+			}
+			if want := stack[len(stack)-1]; want != c {
+				return JSONRepair{Title: fmt.Sprintf("Insert missing '%c'", want), Offset: i, Text: string(want)}, true
+			}
+			stack = stack[:len(stack)-1]
+		case ' ', '\t', '\r', '\n':
+		default:
+			lastComma = -1
+		}
+	}
+
+	end := len(bytes.TrimRight(payload, " \t\r\n"))
+	var closing []byte
+	if inString {
+		closing = append(closing, '"')
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		closing = append(closing, stack[i])
+	}
+	if len(closing) == 0 {
+		return JSONRepair{}, false
+	}
+	title := fmt.Sprintf("Insert missing '%s'", closing)
+	if inString {
+		title = fmt.Sprintf("Close the string and insert missing '%s'", closing[1:])
+		if len(closing) == 1 {
+			title = "Close the string"
+		}
+	}
+	return JSONRepair{Title: title, Offset: end, Text: string(closing)}, true
+}
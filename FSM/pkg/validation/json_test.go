@@ -0,0 +1,33 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// benchJSON is a request body of roughly size bytes, as a server or proxy checks.
+func benchJSON(size int) []byte {
+	var b strings.Builder
+	b.WriteString(`{"items": [`)
+	for i := 0; b.Len() < size; i++ {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, `{"id": %d, "name": "item-%d", "active": %t, "tags": ["a", "b"], "parent": null}`, i, i, i%2 == 0)
+	}
+	b.WriteString("]}")
+	return []byte(b.String())
+}
+
+// BenchmarkCheckJSON checks a valid 64 KiB payload.
+func BenchmarkCheckJSON(b *testing.B) {
+	payload := benchJSON(64 << 10)
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	for b.Loop() {
+		if findings := CheckJSON(payload); len(findings) > 0 {
+			b.Fatal(findings[0].Message)
+		}
+	}
+}
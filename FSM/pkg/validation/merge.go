@@ -0,0 +1,223 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"config-validator/pkg/automata"
+)
+
+// MergedReport combines report files into one summary, for fleet- or repo-level
+// dashboards.
+type MergedReport struct {
+	Status      string         `json:"status"`
+	Reports     int            `json:"reports"` // report files merged
+	Total       int            `json:"total"`   // files and devices in them
+	Passed      int            `json:"passed"`
+	Failed      int            `json:"failed"`
+	Unreachable int            `json:"unreachable,omitempty"`
+	Findings    int            `json:"findings"`
+	Score       int            `json:"score"` // average over the files and devices with a score
+	Grade       string         `json:"grade"`
+	BySeverity  map[string]int `json:"by_severity"`
+	// ByRule counts the findings of every rule, most frequent first. Findings no
+	// rule is known for are counted under "other".
+	ByRule []RuleCount   `json:"by_rule"`
+	Files  []FileSummary `json:"files"`
+}
+
+// RuleCount is how often a rule was violated, and in how many files.
+type RuleCount struct {
+	Rule     string `json:"rule"`
+	Findings int    `json:"findings"`
+	Files    int    `json:"files"`
+}
+
+// FileSummary is one file or device of the merged reports.
+type FileSummary struct {
+	File       string         `json:"file"`
+	Report     string         `json:"report"` // the report file it came from
+	Status     string         `json:"status"`
+	Score      *int           `json:"score,omitempty"` // unset for unreachable devices
+	Findings   int            `json:"findings"`
+	BySeverity map[string]int `json:"by_severity,omitempty"`
+}
+
+// MergeInput is the findings of one file or device of a report file.
+type MergeInput struct {
+	FileFindings
+	Report string
+	Status string
+	Score  *int
+}
+
+// ErrMergedReport is returned by ReadReportFile for a merged report, which is not
+// merged again.
+var ErrMergedReport = errors.New("already a merged report")
+
+// ReadReportFile reads a report file written by any of the commands: a single
+// file's report, whose file is named after the report (router1.json is router1), an
+// archive report, whose entries are named archive:entry, or a fleet report, with
+// one input per device. Reports carry their findings as text, so only the line,
+// severity, and message of each are known.
+func ReadReportFile(path string) ([]MergeInput, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r struct {
+		Status  *string  `json:"status"`
+		Reports *int     `json:"reports"`
+		Errors  []string `json:"errors"`
+		Score   *int     `json:"score"`
+		Archive string   `json:"archive"`
+		Entries []struct {
+			Name   string   `json:"name"`
+			Status string   `json:"status"`
+			Errors []string `json:"errors"`
+			Score  int      `json:"score"`
+		} `json:"entries"`
+		Devices []struct {
+			Name   string   `json:"name"`
+			Status string   `json:"status"`
+			Errors []string `json:"errors"`
+			Score  *int     `json:"score"`
+		} `json:"devices"`
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var inputs []MergeInput
+	switch {
+	case r.Reports != nil:
+		return nil, fmt.Errorf("%s: %w", path, ErrMergedReport)
+	case r.Devices != nil:
+		for _, d := range r.Devices {
+			inputs = append(inputs, MergeInput{FileFindings{d.Name, ParseFindings(d.Errors)}, path, d.Status, d.Score})
+		}
+	case r.Entries != nil:
+		for _, e := range r.Entries {
+			score := e.Score
+			inputs = append(inputs, MergeInput{FileFindings{r.Archive + ":" + e.Name, ParseFindings(e.Errors)}, path, e.Status, &score})
+		}
+	case r.Status != nil:
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		inputs = append(inputs, MergeInput{FileFindings{name, ParseFindings(r.Errors)}, path, *r.Status, r.Score})
+	default:
+		return nil, fmt.Errorf("%s: not a validation report", path)
+	}
+	return inputs, nil
+}
+
+var formattedFindingRe = regexp.MustCompile(`^(?:Line (\d+): )?(?:\[(\w+)\] )?(.*)$`)
+
+// ParseFindings turns Errors entries back into findings, the reverse of
+// FormatFindings.
+func ParseFindings(entries []string) []automata.Finding {
+	var findings []automata.Finding
+	for _, e := range entries {
+		m := formattedFindingRe.FindStringSubmatch(e)
+		f := automata.Finding{Message: m[3], Severity: automata.SeverityError}
+		f.Line, _ = strconv.Atoi(m[1])
+		if m[2] != "" {
+			f.Severity = m[2]
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+// MergeReports tallies the inputs into one summary. The findings' codes are the
+// rules they are counted under.
+func MergeReports(reports int, inputs []MergeInput) *MergedReport {
+	m := &MergedReport{Reports: reports, BySeverity: map[string]int{}}
+	byRule := map[string]*RuleCount{}
+	scored, total := 0, 0
+	for _, in := range inputs {
+		fs := FileSummary{File: in.File, Report: in.Report, Status: in.Status, Score: in.Score, Findings: len(in.Findings)}
+		rulesSeen := map[string]bool{}
+		for _, f := range in.Findings {
+			severity := f.Severity
+			if severity == "" {
+				severity = automata.SeverityError
+			}
+			m.BySeverity[severity]++
+			if fs.BySeverity == nil {
+				fs.BySeverity = map[string]int{}
+			}
+			fs.BySeverity[severity]++
+
+			rule := f.Code
+			if rule == "" {
+				rule = "other"
+			}
+			rc := byRule[rule]
+			if rc == nil {
+				rc = &RuleCount{Rule: rule}
+				byRule[rule] = rc
+			}
+			rc.Findings++
+			if !rulesSeen[rule] {
+				rulesSeen[rule] = true
+				rc.Files++
+			}
+		}
+		m.Findings += len(in.Findings)
+		m.Files = append(m.Files, fs)
+
+		if in.Score != nil {
+			scored++
+			total += *in.Score
+		}
+		switch in.Status {
+		case "success":
+			m.Passed++
+		case "unreachable":
+			m.Unreachable++
+		default:
+			m.Failed++
+		}
+	}
+	m.Total = len(m.Files)
+
+	for _, rc := range byRule {
+		m.ByRule = append(m.ByRule, *rc)
+	}
+	sort.Slice(m.ByRule, func(i, j int) bool {
+		a, b := m.ByRule[i], m.ByRule[j]
+		if a.Findings != b.Findings {
+			return a.Findings > b.Findings
+		}
+		return a.Rule < b.Rule
+	})
+	// The worst files first, as dashboards list them
+	sort.SliceStable(m.Files, func(i, j int) bool { return m.Files[i].Findings > m.Files[j].Findings })
+
+	if scored > 0 {
+		m.Score = total / scored
+	}
+	m.Grade = Grade(m.Score)
+	if m.Passed == m.Total {
+		m.Status = "success"
+	} else {
+		m.Status = "failed"
+	}
+	return m
+}
+
+// GenerateMergedReport writes the merged summary as a JSON file.
+func GenerateMergedReport(report *MergedReport, outputFile string) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outputFile, data, 0644)
+}
@@ -0,0 +1,80 @@
+package validation
+
+import (
+	"regexp"
+	"strings"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/policy"
+)
+
+// Redacted replaces the text masked by Redact, as the security audit masks the
+// secrets it finds.
+const Redacted = "<redacted>"
+
+// Redact masks the matches of a pattern in the excerpts and messages of findings, for
+// sensitive text the security audit does not know, such as site-specific credentials
+// or customer names. A pattern with groups masks only what its first group matched,
+// so `password (\S+)` keeps the keyword. Line numbers are kept. The findings are not
+// modified; a nil pattern returns them as they are.
+func Redact(findings []automata.Finding, re *regexp.Regexp) []automata.Finding {
+	if re == nil {
+		return findings
+	}
+	out := make([]automata.Finding, len(findings))
+	for i, f := range findings {
+		f.Command = redactText(f.Command, re)
+		f.Message = redactText(f.Message, re)
+		out[i] = f
+	}
+	return out
+}
+
+// RedactFSM masks the findings of a validation run, and the Errors entries rendered
+// from them.
+func RedactFSM(fsm *automata.FSM, re *regexp.Regexp) {
+	if re == nil {
+		return
+	}
+	fsm.Findings = Redact(fsm.Findings, re)
+	fsm.Errors = FormatFindings(fsm.Findings)
+}
+
+// RedactMatrix masks the evidence lines of a compliance matrix, in place.
+func RedactMatrix(m *policy.Matrix, re *regexp.Regexp) {
+	if m == nil || re == nil {
+		return
+	}
+	for _, control := range m.Controls {
+		for _, check := range control.Checks {
+			for i, line := range check.Evidence {
+				check.Evidence[i] = redactText(line, re)
+			}
+		}
+	}
+}
+
+func redactText(s string, re *regexp.Regexp) string {
+	var b strings.Builder
+	last, masked := 0, false
+	for _, m := range re.FindAllStringSubmatchIndex(s, -1) {
+		start, end := m[0], m[1]
+		if len(m) > 2 {
+			if m[2] < 0 {
+				continue // the group did not take part in the match
+			}
+			start, end = m[2], m[3]
+		}
+		if start == end {
+			continue
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(Redacted)
+		last, masked = end, true
+	}
+	if !masked {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
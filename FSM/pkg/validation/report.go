@@ -7,35 +7,118 @@ import (
 	"os"
 
 	"config-validator/pkg/automata"
+	"config-validator/pkg/policy"
 )
 
 // Report defines the structure of the final JSON output.
 type Report struct {
 	Status string   `json:"status"`
 	Errors []string `json:"errors,omitempty"` // omitempty hides the field if there are no errors
+	Score  int      `json:"score"`            // 0-100, see Score
+	Grade  string   `json:"grade"`
+	// Encoding is the detected encoding of the input, which was converted to UTF-8.
+	Encoding string `json:"encoding,omitempty"`
+	// Security repeats the security-severity findings, whose excerpts are redacted.
+	Security []automata.Finding `json:"security,omitempty"`
+	// Compliance is the per-control matrix when the run used a policy pack.
+	Compliance *policy.Matrix `json:"compliance,omitempty"`
+	// Stats counts the lines per state and the matches per rule, for tuning rules.
+	Stats *automata.Stats `json:"stats,omitempty"`
+	// Owners lists the findings by owner when an owners file was used.
+	Owners map[string][]string `json:"owners,omitempty"`
 }
 
 // GenerateReport creates a JSON report file from the FSM's final state.
 func GenerateReport(fsm *automata.FSM, outputFile string) error {
-	var status string
-	if len(fsm.Errors) == 0 {
-		status = "success"
-	} else {
-		status = "failed"
+	data, err := ReportJSON(fsm)
+	if err != nil {
+		return err
 	}
+	return os.WriteFile(outputFile, data, 0644)
+}
 
-	// The new FSM only has an `Errors` field, which is all we need.
-	report := Report{
-		Status: status,
-		Errors: fsm.Errors,
-	}
+// ReportJSON returns the report GenerateReport writes, for callers that save it
+// themselves, such as to seal it (see pkg/seal).
+func ReportJSON(fsm *automata.FSM) ([]byte, error) {
+	return marshalReport(Report{Errors: fsm.Errors, Encoding: fsm.Encoding, Stats: fsm.Stats()}, fsm.Findings)
+}
 
-	// Marshal the report into a nicely formatted JSON string.
-	data, err := json.MarshalIndent(report, "", "  ")
+// GeneratePolicyReport creates the JSON report with the compliance matrix of a policy pack.
+func GeneratePolicyReport(fsm *automata.FSM, matrix *policy.Matrix, outputFile string) error {
+	data, err := PolicyReportJSON(fsm, matrix)
 	if err != nil {
 		return err
 	}
+	return os.WriteFile(outputFile, data, 0644)
+}
+
+// PolicyReportJSON returns the report GeneratePolicyReport writes.
+func PolicyReportJSON(fsm *automata.FSM, matrix *policy.Matrix) ([]byte, error) {
+	return marshalReport(Report{Errors: fsm.Errors, Encoding: fsm.Encoding, Compliance: matrix, Stats: fsm.Stats()}, fsm.Findings)
+}
 
-	// Write the JSON data to the specified output file.
+// GenerateFindingsReport creates the same JSON report for findings that did not come
+// from the FSM, such as those returned by plugins.
+func GenerateFindingsReport(findings []automata.Finding, outputFile string) error {
+	data, err := FindingsReportJSON(findings)
+	if err != nil {
+		return err
+	}
 	return os.WriteFile(outputFile, data, 0644)
+}
+
+// FindingsReportJSON returns the report GenerateFindingsReport writes.
+func FindingsReportJSON(findings []automata.Finding) ([]byte, error) {
+	return marshalReport(Report{Errors: FormatFindings(findings)}, findings)
+}
+
+// FormatFindings renders structured findings the way the FSM formats its Errors.
+func FormatFindings(findings []automata.Finding) []string {
+	var errors []string
+	for _, f := range findings {
+		errors = append(errors, automata.FormatFinding(f))
+	}
+	return errors
+}
+
+// FindingsByOwner renders the findings that have an owner, by owner (see
+// pkg/ownership). It returns nil when none has one.
+func FindingsByOwner(findings []automata.Finding) map[string][]string {
+	var owners map[string][]string
+	for _, f := range findings {
+		if f.Owner == "" {
+			continue
+		}
+		if owners == nil {
+			owners = map[string][]string{}
+		}
+		owners[f.Owner] = append(owners[f.Owner], automata.FormatFinding(f))
+	}
+	return owners
+}
+
+func securityFindings(findings []automata.Finding) []automata.Finding {
+	var out []automata.Finding
+	for _, f := range findings {
+		if f.Severity == automata.SeveritySecurity {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// writeReport fills in the parts of the report derived from the findings and writes it.
+func marshalReport(report Report, findings []automata.Finding) ([]byte, error) {
+	if len(report.Errors) == 0 {
+		report.Status = "success"
+	} else {
+		report.Status = "failed"
+	}
+	report.Score = Score(findings)
+	report.Grade = Grade(report.Score)
+	report.Security = securityFindings(findings)
+	report.Owners = FindingsByOwner(findings)
+
+	// Marshal the report into a nicely formatted JSON string.
+	return json.MarshalIndent(report, "", "  ")
 }
\ No newline at end of file
@@ -0,0 +1,37 @@
+package validation
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"config-validator/pkg/automata"
+)
+
+// benchFindings is n findings of mixed severities, as a large failing config produces.
+func benchFindings(n int) []automata.Finding {
+	severities := []string{automata.SeverityError, automata.SeverityWarning, automata.SeveritySecurity}
+	findings := make([]automata.Finding, n)
+	for i := range findings {
+		findings[i] = automata.Finding{
+			Line:     i + 1,
+			Command:  fmt.Sprintf("frobnicate %d", i),
+			State:    "INTERFACE",
+			Message:  fmt.Sprintf("invalid command 'frobnicate %d' in state INTERFACE", i),
+			Severity: severities[i%len(severities)],
+		}
+	}
+	return findings
+}
+
+// BenchmarkGenerateFindingsReport scores, formats, and writes a report of 10k findings.
+func BenchmarkGenerateFindingsReport(b *testing.B) {
+	findings := benchFindings(10000)
+	out := filepath.Join(b.TempDir(), "report.json")
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := GenerateFindingsReport(findings, out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package validation
+
+import "config-validator/pkg/automata"
+
+// SeverityPenalty is how many points a finding of each severity takes off a config's
+// score of 100, before the weight of the rule that reported it is applied.
+var SeverityPenalty = map[string]int{
+	automata.SeverityError:    5,
+	automata.SeveritySecurity: 10,
+	automata.SeverityWarning:  2,
+}
+
+// Score rates a config from 0 to 100: every finding lowers it by its severity penalty
+// times its rule weight.
+func Score(findings []automata.Finding) int {
+	score := 100
+	for _, f := range findings {
+		severity := f.Severity
+		if severity == "" {
+			severity = automata.SeverityError
+		}
+		weight := f.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		score -= SeverityPenalty[severity] * weight
+	}
+	return max(score, 0)
+}
+
+// Grade turns a score into a letter grade: A from 90, B from 80, C from 70, D from
+// 60, and F below.
+func Grade(score int) string {
+	switch {
+	case score >= 90:
+		return "A"
+	case score >= 80:
+		return "B"
+	case score >= 70:
+		return "C"
+	case score >= 60:
+		return "D"
+	default:
+		return "F"
+	}
+}
@@ -0,0 +1,237 @@
+package vrf
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strings"
+
+	"config-validator/pkg/automata"
+)
+
+var (
+	definitionRe  = regexp.MustCompile(`^(?:vrf definition|ip vrf) (\S+)$`)
+	rdRe          = regexp.MustCompile(`^rd (\S+)$`)
+	forwardingRe  = regexp.MustCompile(`^(?:ip )?vrf forwarding (\S+)`)
+	staticRouteRe = regexp.MustCompile(`^ip route vrf (\S+) `)
+	bgpRe         = regexp.MustCompile(`^router bgp \S+`)
+	familyVRFRe   = regexp.MustCompile(`^address-family \S+(?: \S+)? vrf (\S+)$`)
+	nestedVRFRe   = regexp.MustCompile(`^vrf (\S+)$`)
+	declareRe     = regexp.MustCompile(`^neighbor (\S+) (?:remote-as|peer-group|inherit peer-session)\b`)
+	activateRe    = regexp.MustCompile(`^neighbor (\S+) activate$`)
+)
+
+// Analyzer checks VRFs and the BGP address-families they are used in, following the
+// context of each line (see automata.Contexts): VRFs without a route-distinguisher
+// or sharing one, interfaces, static routes, and address-families using a VRF that
+// is not defined, and BGP neighbors activated in the address-family of another VRF
+// than the one they are declared in, or IPv6 neighbors activated for IPv4.
+type Analyzer struct {
+	Findings []automata.Finding
+
+	contexts    *automata.Contexts
+	vrf         *vrf // the vrf definition block the analyzer is in
+	bgp         bool // in a router bgp block
+	vrfs        map[string]*vrf
+	order       []string
+	refs        []statement
+	declared    map[string]map[string]statement // neighbors by VRF, "" being the global table
+	activations []activation
+}
+
+type vrf struct {
+	def statement
+	rd  statement
+}
+
+type statement struct {
+	line int
+	text string
+	name string // the VRF or neighbor the statement is about
+}
+
+type activation struct {
+	statement
+	context automata.Context
+}
+
+// Line feeds one line of the config to the analyzer.
+func (a *Analyzer) Line(originalLine string, lineNum int) {
+	if a.contexts == nil {
+		a.contexts = automata.NewContexts()
+		a.vrfs = map[string]*vrf{}
+		a.declared = map[string]map[string]statement{}
+	}
+	line := strings.TrimSpace(originalLine)
+	indented := strings.HasPrefix(originalLine, " ")
+	// Configs write ! between the address-families of a router bgp block too, so only
+	// an unindented one ends the block.
+	if line == "" || strings.HasPrefix(line, "!") {
+		if !indented {
+			a.contexts.Reset()
+			a.vrf, a.bgp = nil, false
+		}
+		return
+	}
+	context := a.contexts.Line(originalLine)
+	if !indented {
+		a.vrf, a.bgp = nil, bgpRe.MatchString(line)
+		if m := definitionRe.FindStringSubmatch(line); m != nil {
+			if _, ok := a.vrfs[m[1]]; !ok {
+				a.vrfs[m[1]] = &vrf{def: statement{lineNum, line, m[1]}}
+				a.order = append(a.order, m[1])
+			}
+			a.vrf = a.vrfs[m[1]]
+		}
+		if m := staticRouteRe.FindStringSubmatch(line); m != nil {
+			a.refs = append(a.refs, statement{lineNum, line, m[1]})
+		}
+		return
+	}
+
+	switch {
+	case a.vrf != nil && rdRe.MatchString(line):
+		a.vrf.rd = statement{lineNum, line, rdRe.FindStringSubmatch(line)[1]}
+	case forwardingRe.MatchString(line):
+		a.refs = append(a.refs, statement{lineNum, line, forwardingRe.FindStringSubmatch(line)[1]})
+	case !a.bgp:
+	case familyVRFRe.MatchString(line):
+		a.refs = append(a.refs, statement{lineNum, line, familyVRFRe.FindStringSubmatch(line)[1]})
+	case nestedVRFRe.MatchString(line):
+		a.refs = append(a.refs, statement{lineNum, line, nestedVRFRe.FindStringSubmatch(line)[1]})
+	case activateRe.MatchString(line):
+		m := activateRe.FindStringSubmatch(line)
+		a.activations = append(a.activations, activation{statement{lineNum, line, m[1]}, context})
+	case declareRe.MatchString(line):
+		m := declareRe.FindStringSubmatch(line)
+		if a.declared[context.VRF] == nil {
+			a.declared[context.VRF] = map[string]statement{}
+		}
+		if _, ok := a.declared[context.VRF][m[1]]; !ok {
+			a.declared[context.VRF][m[1]] = statement{lineNum, line, m[1]}
+		}
+	}
+}
+
+// Finish runs the checks over the whole config.
+func (a *Analyzer) Finish() []automata.Finding {
+	rds := map[string]*vrf{}
+	for _, name := range a.order {
+		v := a.vrfs[name]
+		if v.rd.text == "" {
+			a.add(v.def, "", "vrf.no-rd", fmt.Sprintf("vrf %s has no route-distinguisher", name))
+			continue
+		}
+		if other, ok := rds[v.rd.name]; ok {
+			a.add(v.rd, "", "vrf.duplicate-rd", fmt.Sprintf("vrf %s has route-distinguisher %s, as vrf %s does (line %d)", name, v.rd.name, other.def.name, other.rd.line))
+			continue
+		}
+		rds[v.rd.name] = v
+	}
+	for _, ref := range a.refs {
+		if _, ok := a.vrfs[ref.name]; !ok {
+			a.add(ref, "", "vrf.undefined", fmt.Sprintf("vrf %s is not defined", ref.name))
+		}
+	}
+	for _, act := range a.activations {
+		a.checkActivation(act)
+	}
+	sort.SliceStable(a.Findings, func(i, j int) bool { return a.Findings[i].Line < a.Findings[j].Line })
+	return a.Findings
+}
+
+// checkActivation checks that a neighbor is activated in an address-family of the
+// VRF it is declared in, and of its IP version. Neighbors declared nowhere are left
+// to the routing pass, which reports them as having no remote-as.
+func (a *Analyzer) checkActivation(act activation) {
+	where := act.context.String()
+	if where == "" {
+		where = "the global table"
+	}
+	if _, ok := a.declared[act.context.VRF][act.name]; !ok {
+		vrfs := make([]string, 0, len(a.declared))
+		for vrf := range a.declared {
+			vrfs = append(vrfs, vrf)
+		}
+		sort.Strings(vrfs)
+		for _, vrf := range vrfs {
+			if decl, ok := a.declared[vrf][act.name]; ok {
+				a.add(act.statement, act.context.String(), "vrf.neighbor-elsewhere", fmt.Sprintf("neighbor %s is activated in %s, but declared in %s (line %d)", act.name, where, vrfName(vrf), decl.line))
+				return
+			}
+		}
+		return
+	}
+	// Outside an address-family, activate is for IPv4 unicast.
+	family := act.context.AddressFamily
+	if addr, err := netip.ParseAddr(act.name); err == nil && addr.Is6() && (family == "" || strings.HasPrefix(family, "ipv4")) {
+		a.add(act.statement, act.context.String(), "vrf.ipv6-neighbor-ipv4", fmt.Sprintf("IPv6 neighbor %s is activated for IPv4 in %s", act.name, where))
+	}
+}
+
+func vrfName(name string) string {
+	if name == "" {
+		return "the global table"
+	}
+	return "vrf " + name
+}
+
+func (a *Analyzer) add(s statement, context, code, msg string) {
+	a.Findings = append(a.Findings, automata.Finding{
+		Line:     s.line,
+		Command:  s.text,
+		State:    "VRF",
+		Message:  msg,
+		Severity: automata.SeverityWarning,
+		Code:     code,
+		Context:  context,
+	})
+}
+
+// Append adds the VRFs, references, and BGP neighbors of other, an analyzer fed the
+// lines after a's on their own, with their line numbers moved by shift, as if a had
+// been fed those lines: a VRF defined again keeps its first definition, and takes
+// the route-distinguisher of the later one when that sets one. other is not modified.
+func (a *Analyzer) Append(other *Analyzer, shift int) {
+	if a.vrfs == nil {
+		a.vrfs = map[string]*vrf{}
+		a.declared = map[string]map[string]statement{}
+	}
+	for _, name := range other.order {
+		v := other.vrfs[name]
+		rd := v.rd
+		if rd.text != "" {
+			rd.line += shift
+		}
+		existing, ok := a.vrfs[name]
+		if !ok {
+			def := v.def
+			def.line += shift
+			a.vrfs[name] = &vrf{def: def, rd: rd}
+			a.order = append(a.order, name)
+		} else if rd.text != "" {
+			existing.rd = rd
+		}
+	}
+	for _, ref := range other.refs {
+		ref.line += shift
+		a.refs = append(a.refs, ref)
+	}
+	for context, neighbors := range other.declared {
+		if a.declared[context] == nil {
+			a.declared[context] = map[string]statement{}
+		}
+		for name, decl := range neighbors {
+			if _, ok := a.declared[context][name]; !ok {
+				decl.line += shift
+				a.declared[context][name] = decl
+			}
+		}
+	}
+	for _, act := range other.activations {
+		act.line += shift
+		a.activations = append(a.activations, act)
+	}
+	a.contexts, a.vrf, a.bgp = automata.NewContexts(), nil, false
+}
@@ -0,0 +1,176 @@
+package wasm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+
+	"config-validator/pkg/automata"
+)
+
+// WASM checks run in a wazero sandbox with no filesystem, network, environment, or
+// clock access beyond what WASI requires, bounded memory, and a per-call deadline, so
+// untrusted rule packs can run inside the admission webhook or daemon.
+//
+// A module exports its linear memory as "memory" and
+//
+//	alloc(size i32) -> ptr i32            a buffer the host writes the request into
+//	<check>(ptr i32, len i32) -> i64      one function per check named in rules.yaml
+//
+// The request is JSON {"line", "line_num", "state", "groups", "vrf", "address_family"}. A check returns
+// (ptr << 32 | len) of a JSON array of messages in its memory; an empty array or a
+// zero result means the line is fine. Modules built as WASI reactors have their
+// _initialize export called once after instantiation. Module memory persists across
+// calls for the whole config, so checks can keep cross-line state.
+const (
+	memoryLimitPages = 256 // 16 MiB
+	callTimeout      = time.Second
+)
+
+// cache shares compiled modules between validation runs.
+var cache = wazero.NewCompilationCache()
+
+type request struct {
+	Line    string   `json:"line"`
+	LineNum int      `json:"line_num"`
+	State   string   `json:"state"`
+	Groups  []string `json:"groups"`
+	automata.Context
+}
+
+// Loader resolves the wasm references in a rule set. Each module is instantiated
+// once, so a Loader belongs to a single validation run and must be closed after it.
+type Loader struct {
+	dir     string
+	ctx     context.Context
+	runtime wazero.Runtime
+	modules map[string]api.Module
+}
+
+// NewLoader returns a Loader resolving module paths relative to dir, normally the
+// directory of the rules file. The runtime is only created once a rule needs it.
+func NewLoader(dir string) *Loader {
+	return &Loader{dir: dir, ctx: context.Background(), modules: map[string]api.Module{}}
+}
+
+// Attach sets Check on every rule that references a wasm module.
+func (l *Loader) Attach(rules map[string][]automata.Rule) error {
+	for state, list := range rules {
+		for i := range list {
+			if list[i].Wasm == "" {
+				continue
+			}
+			check, err := l.Check(list[i].Wasm)
+			if err != nil {
+				return fmt.Errorf("state %s: %v", state, err)
+			}
+			list[i].Check = check
+		}
+	}
+	return nil
+}
+
+// Check returns the check named by ref, written "module.wasm:function".
+func (l *Loader) Check(ref string) (automata.Check, error) {
+	file, name, ok := strings.Cut(ref, ":")
+	if !ok || file == "" || name == "" {
+		return nil, fmt.Errorf("invalid wasm reference '%s', want module.wasm:function", ref)
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(l.dir, file)
+	}
+	mod, err := l.module(file)
+	if err != nil {
+		return nil, err
+	}
+	fn := mod.ExportedFunction(name)
+	if fn == nil {
+		return nil, fmt.Errorf("wasm module %s has no function %s", file, name)
+	}
+	alloc := mod.ExportedFunction("alloc")
+	if alloc == nil || mod.Memory() == nil {
+		return nil, fmt.Errorf("wasm module %s must export alloc and memory", file)
+	}
+
+	return func(c automata.CheckContext) ([]string, error) {
+		req, err := json.Marshal(request{Line: c.Line, LineNum: c.LineNum, State: c.State, Groups: c.Groups, Context: c.Context})
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(l.ctx, callTimeout)
+		defer cancel()
+
+		res, err := alloc.Call(ctx, uint64(len(req)))
+		if err != nil {
+			return nil, err
+		}
+		ptr := uint32(res[0])
+		if !mod.Memory().Write(ptr, req) {
+			return nil, fmt.Errorf("alloc returned an out of range buffer")
+		}
+		res, err = fn.Call(ctx, uint64(ptr), uint64(len(req)))
+		if err != nil {
+			return nil, err
+		}
+		if res[0] == 0 {
+			return nil, nil
+		}
+		out, ok := mod.Memory().Read(uint32(res[0]>>32), uint32(res[0]))
+		if !ok {
+			return nil, fmt.Errorf("%s returned an out of range result", name)
+		}
+		var messages []string
+		if err := json.Unmarshal(out, &messages); err != nil {
+			return nil, fmt.Errorf("%s returned invalid JSON: %v", name, err)
+		}
+		return messages, nil
+	}, nil
+}
+
+func (l *Loader) module(file string) (api.Module, error) {
+	if mod, ok := l.modules[file]; ok {
+		return mod, nil
+	}
+	code, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wasm module: %v", err)
+	}
+	if l.runtime == nil {
+		cfg := wazero.NewRuntimeConfig().
+			WithCompilationCache(cache).
+			WithMemoryLimitPages(memoryLimitPages).
+			WithCloseOnContextDone(true)
+		l.runtime = wazero.NewRuntimeWithConfig(l.ctx, cfg)
+		if _, err := wasi_snapshot_preview1.Instantiate(l.ctx, l.runtime); err != nil {
+			return nil, err
+		}
+	}
+	cfg := wazero.NewModuleConfig().
+		WithName(file).
+		WithStdout(io.Discard).
+		WithStderr(io.Discard).
+		WithStartFunctions("_initialize")
+	mod, err := l.runtime.InstantiateWithConfig(l.ctx, code, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to instantiate wasm module %s: %v", file, err)
+	}
+	l.modules[file] = mod
+	return mod, nil
+}
+
+// Close releases the runtime and every module instantiated by the Loader.
+func (l *Loader) Close() error {
+	if l.runtime == nil {
+		return nil
+	}
+	return l.runtime.Close(l.ctx)
+}
@@ -0,0 +1,414 @@
+// Package xmlcheck checks XML documents for well-formedness with a pushdown automaton:
+// every start tag pushes its name and every end tag must pop the same name. Errors
+// carry the stack of open tags at the point of error, the way the PDA's JSON
+// validator reports its bracket stack, and checking carries on after an error so
+// every problem is reported at once.
+package xmlcheck
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"config-validator/pkg/automata"
+)
+
+// State is the state reported in XML findings.
+const State = "XML"
+
+// Error is a well-formedness error, in the shape of the PDA's JSON errors.
+type Error struct {
+	ErrorType  string   `json:"error_type"`
+	Line       int      `json:"line"`
+	Position   int      `json:"position"` // byte offset
+	StackState []string `json:"pda_stack_state"`
+	Suggestion string   `json:"suggestion"`
+}
+
+// predefined are the entities every XML document may use without a DTD.
+var predefined = map[string]bool{"lt": true, "gt": true, "amp": true, "apos": true, "quot": true}
+
+type checker struct {
+	src     []byte
+	pos     int
+	stack   []string
+	errs    []Error
+	roots   int  // top-level elements seen
+	begin   int  // offset of the document after a BOM
+	doctype bool // a DTD may declare more entities
+}
+
+// Check returns the well-formedness errors of an XML document.
+func Check(content []byte) []Error {
+	c := &checker{src: content}
+	if bytes.HasPrefix(content, []byte("\xEF\xBB\xBF")) {
+		c.pos, c.begin = 3, 3
+	}
+	for c.pos < len(c.src) {
+		if c.src[c.pos] == '<' {
+			c.markup()
+		} else {
+			c.text()
+		}
+	}
+	if len(c.stack) > 0 {
+		c.fail(len(c.src), "unclosed_tags", fmt.Sprintf("close <%s> and every tag opened inside it, innermost first", c.stack[0]))
+	}
+	if c.roots == 0 {
+		c.fail(len(c.src), "missing_root", "an XML document needs exactly one root element")
+	}
+	return c.errs
+}
+
+// Findings converts errors into findings for the report pipeline.
+func Findings(errs []Error) []automata.Finding {
+	var findings []automata.Finding
+	for _, e := range errs {
+		msg := fmt.Sprintf("%s: %s", strings.ReplaceAll(e.ErrorType, "_", " "), e.Suggestion)
+		if len(e.StackState) > 0 {
+			msg += fmt.Sprintf(" (open tags: %s)", strings.Join(e.StackState, " > "))
+		}
+		findings = append(findings, automata.Finding{Line: e.Line, State: State, Message: msg, Severity: automata.SeverityError})
+	}
+	return findings
+}
+
+func (c *checker) fail(pos int, kind, suggestion string) {
+	c.errs = append(c.errs, Error{
+		ErrorType:  kind,
+		Line:       bytes.Count(c.src[:pos], []byte("\n")) + 1,
+		Position:   pos,
+		StackState: append([]string{}, c.stack...),
+		Suggestion: suggestion,
+	})
+}
+
+// text consumes character data up to the next '<', checking entity references and
+// that nothing but whitespace sits outside the root element.
+func (c *checker) text() {
+	start := c.pos
+	end := bytes.IndexByte(c.src[c.pos:], '<')
+	if end < 0 {
+		end = len(c.src)
+	} else {
+		end += c.pos
+	}
+	data := c.src[start:end]
+	c.pos = end
+
+	if len(c.stack) == 0 && len(bytes.TrimSpace(data)) > 0 {
+		c.fail(start, "content_outside_root", "text must be inside the root element")
+	}
+	c.entities(data, start, "text")
+}
+
+// entities checks the '&' references in text or an attribute value starting at offset.
+func (c *checker) entities(data []byte, offset int, where string) {
+	for i := 0; i < len(data); i++ {
+		if data[i] != '&' {
+			continue
+		}
+		semi := bytes.IndexByte(data[i:], ';')
+		if semi < 0 {
+			c.fail(offset+i, "invalid_entity", fmt.Sprintf("a bare '&' in %s must be written &amp;", where))
+			continue
+		}
+		ref := string(data[i+1 : i+semi])
+		switch {
+		case strings.HasPrefix(ref, "#x"):
+			if !isHex(ref[2:]) {
+				c.fail(offset+i, "invalid_entity", fmt.Sprintf("&%s; is not a hexadecimal character reference such as &#x3C;", ref))
+			}
+		case strings.HasPrefix(ref, "#"):
+			if !isDigits(ref[1:]) {
+				c.fail(offset+i, "invalid_entity", fmt.Sprintf("&%s; is not a decimal character reference such as &#60;", ref))
+			}
+		case !isName(ref):
+			c.fail(offset+i, "invalid_entity", fmt.Sprintf("a bare '&' in %s must be written &amp;", where))
+			continue
+		case !predefined[ref] && !c.doctype:
+			c.fail(offset+i, "undefined_entity", fmt.Sprintf("&%s; is not one of &lt; &gt; &amp; &apos; &quot; and there is no DTD declaring it", ref))
+		}
+		i += semi
+	}
+}
+
+// markup consumes a construct starting with '<'.
+func (c *checker) markup() {
+	rest := c.src[c.pos:]
+	switch {
+	case bytes.HasPrefix(rest, []byte("<!--")):
+		c.comment()
+	case bytes.HasPrefix(rest, []byte("<![CDATA[")):
+		c.until("]]>", "unterminated_cdata", "end the CDATA section with ]]>")
+		if len(c.stack) == 0 {
+			c.fail(c.pos, "content_outside_root", "CDATA sections must be inside the root element")
+		}
+	case bytes.HasPrefix(rest, []byte("<!DOCTYPE")):
+		if c.roots > 0 {
+			c.fail(c.pos, "misplaced_doctype", "the DOCTYPE must come before the root element")
+		}
+		c.doctype = true
+		c.doctypeDecl()
+	case bytes.HasPrefix(rest, []byte("<?")):
+		if bytes.HasPrefix(rest, []byte("<?xml")) && len(rest) > 5 && isSpace(rest[5]) && c.pos != c.begin {
+			c.fail(c.pos, "misplaced_declaration", "the <?xml ...?> declaration must be the very first thing in the document")
+		}
+		c.until("?>", "unterminated_processing_instruction", "end the processing instruction with ?>")
+	case bytes.HasPrefix(rest, []byte("</")):
+		c.endTag()
+	default:
+		c.startTag()
+	}
+}
+
+func (c *checker) comment() {
+	start := c.pos
+	end := bytes.Index(c.src[c.pos+4:], []byte("-->"))
+	if end < 0 {
+		c.fail(start, "unterminated_comment", "end the comment with -->")
+		c.pos = len(c.src)
+		return
+	}
+	body := c.src[c.pos+4 : c.pos+4+end]
+	if bytes.Contains(body, []byte("--")) || bytes.HasSuffix(body, []byte("-")) {
+		c.fail(start, "invalid_comment", "comments may not contain -- or end with -")
+	}
+	c.pos += 4 + end + 3
+}
+
+// until skips to just after end, or reports an error and skips to the end of input.
+func (c *checker) until(end, kind, suggestion string) {
+	if i := bytes.Index(c.src[c.pos:], []byte(end)); i >= 0 {
+		c.pos += i + len(end)
+		return
+	}
+	c.fail(c.pos, kind, suggestion)
+	c.pos = len(c.src)
+}
+
+// doctypeDecl skips a DOCTYPE declaration, including an internal subset in [...].
+func (c *checker) doctypeDecl() {
+	start := c.pos
+	depth := 0
+	var quote byte
+	for i := c.pos; i < len(c.src); i++ {
+		ch := c.src[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '[':
+			depth++
+		case ch == ']':
+			depth--
+		case ch == '>' && depth == 0:
+			c.pos = i + 1
+			return
+		}
+	}
+	c.fail(start, "unterminated_doctype", "end the DOCTYPE declaration with >")
+	c.pos = len(c.src)
+}
+
+func (c *checker) endTag() {
+	start := c.pos
+	c.pos += 2
+	name := c.name()
+	c.skipSpace()
+	if c.pos >= len(c.src) || c.src[c.pos] != '>' {
+		c.fail(start, "malformed_end_tag", fmt.Sprintf("end tags have only a name: </%s>", name))
+		c.skipTo('>')
+	} else {
+		c.pos++
+	}
+	if name == "" {
+		c.fail(start, "malformed_end_tag", "an end tag needs the name of the element it closes")
+		return
+	}
+
+	// Pop the matching start tag. An end tag for an element further down the stack
+	// closes the elements above it, which are reported as unclosed.
+	for i := len(c.stack) - 1; i >= 0; i-- {
+		if c.stack[i] != name {
+			continue
+		}
+		if i < len(c.stack)-1 {
+			c.fail(start, "mismatched_tag", fmt.Sprintf("found </%s> but <%s> is still open; close it first with </%s>", name, c.stack[len(c.stack)-1], c.stack[len(c.stack)-1]))
+		}
+		c.stack = c.stack[:i]
+		return
+	}
+	if len(c.stack) == 0 {
+		c.fail(start, "unexpected_end_tag", fmt.Sprintf("</%s> has no matching start tag; remove it or add <%s>", name, name))
+	} else {
+		c.fail(start, "mismatched_tag", fmt.Sprintf("found </%s> but the open element is <%s>; expected </%s>", name, c.stack[len(c.stack)-1], c.stack[len(c.stack)-1]))
+	}
+}
+
+func (c *checker) startTag() {
+	start := c.pos
+	c.pos++
+	name := c.name()
+	if name == "" {
+		c.fail(start, "invalid_tag_name", "a '<' in text must be written &lt;, and tag names start with a letter, '_' or ':'")
+		c.skipTo('>')
+		return
+	}
+
+	seen := map[string]bool{}
+	for {
+		hadSpace := c.skipSpace()
+		if c.pos >= len(c.src) {
+			c.fail(start, "unterminated_tag", fmt.Sprintf("end <%s with > or />", name))
+			return
+		}
+		switch ch := c.src[c.pos]; {
+		case ch == '>':
+			c.pos++
+			c.open(start, name)
+			return
+		case ch == '/' && c.pos+1 < len(c.src) && c.src[c.pos+1] == '>':
+			c.pos += 2
+			if len(c.stack) == 0 {
+				c.root(start)
+			}
+			return
+		case !hadSpace:
+			c.fail(c.pos, "malformed_tag", fmt.Sprintf("separate the attributes of <%s> with whitespace", name))
+			c.skipTo('>')
+			return
+		}
+		if !c.attribute(name, seen) {
+			c.skipTo('>')
+			return
+		}
+	}
+}
+
+// attribute checks one name="value" pair, reporting whether the tag can be read on.
+func (c *checker) attribute(tag string, seen map[string]bool) bool {
+	start := c.pos
+	attr := c.name()
+	if attr == "" {
+		c.fail(start, "malformed_attribute", fmt.Sprintf("unexpected %q in <%s>", c.src[c.pos], tag))
+		return false
+	}
+	if seen[attr] {
+		c.fail(start, "duplicate_attribute", fmt.Sprintf("attribute %s appears more than once in <%s>", attr, tag))
+	}
+	seen[attr] = true
+
+	c.skipSpace()
+	if c.pos >= len(c.src) || c.src[c.pos] != '=' {
+		c.fail(start, "malformed_attribute", fmt.Sprintf("attribute %s of <%s> needs a value: %s=\"...\"", attr, tag, attr))
+		return false
+	}
+	c.pos++
+	c.skipSpace()
+	if c.pos >= len(c.src) || (c.src[c.pos] != '"' && c.src[c.pos] != '\'') {
+		c.fail(start, "unquoted_attribute", fmt.Sprintf("quote the value of %s in <%s>: %s=\"...\"", attr, tag, attr))
+		// Skip the unquoted value to carry on with the next attribute.
+		for c.pos < len(c.src) && !isSpace(c.src[c.pos]) && c.src[c.pos] != '>' {
+			c.pos++
+		}
+		if c.pos < len(c.src) && c.src[c.pos] == '>' && c.src[c.pos-1] == '/' {
+			c.pos-- // <tag a=b/>
+		}
+		return true
+	}
+	quote := c.src[c.pos]
+	end := bytes.IndexByte(c.src[c.pos+1:], quote)
+	if end < 0 {
+		c.fail(start, "unterminated_attribute", fmt.Sprintf("close the quote of %s in <%s>", attr, tag))
+		c.pos = len(c.src)
+		return false
+	}
+	value := c.src[c.pos+1 : c.pos+1+end]
+	if i := bytes.IndexByte(value, '<'); i >= 0 {
+		c.fail(c.pos+1+i, "invalid_attribute_value", fmt.Sprintf("a '<' in the value of %s must be written &lt;", attr))
+	}
+	c.entities(value, c.pos+1, "attribute values")
+	c.pos += end + 2
+	return true
+}
+
+// open pushes a start tag, counting it as a root when nothing is open.
+func (c *checker) open(pos int, name string) {
+	if len(c.stack) == 0 {
+		c.root(pos)
+	}
+	c.stack = append(c.stack, name)
+}
+
+func (c *checker) root(pos int) {
+	c.roots++
+	if c.roots == 2 {
+		c.fail(pos, "multiple_roots", "an XML document has a single root element; wrap the elements in one")
+	}
+}
+
+// name reads an XML name at the current position.
+func (c *checker) name() string {
+	start := c.pos
+	for c.pos < len(c.src) {
+		r, size := utf8.DecodeRune(c.src[c.pos:])
+		if !(r == '_' || r == ':' || unicode.IsLetter(r) || (c.pos > start && (r == '-' || r == '.' || unicode.IsDigit(r)))) {
+			break
+		}
+		c.pos += size
+	}
+	return string(c.src[start:c.pos])
+}
+
+func (c *checker) skipSpace() bool {
+	start := c.pos
+	for c.pos < len(c.src) && isSpace(c.src[c.pos]) {
+		c.pos++
+	}
+	return c.pos > start
+}
+
+func (c *checker) skipTo(ch byte) {
+	if i := bytes.IndexByte(c.src[c.pos:], ch); i >= 0 {
+		c.pos += i + 1
+	} else {
+		c.pos = len(c.src)
+	}
+}
+
+func isSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
+}
+
+func isName(s string) bool {
+	for i, r := range s {
+		if !(r == '_' || r == ':' || unicode.IsLetter(r) || (i > 0 && (r == '-' || r == '.' || unicode.IsDigit(r)))) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isHex(s string) bool {
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,271 @@
+// Package yamlcheck validates the structure of YAML documents: indentation, tabs,
+// duplicate keys, and anchors and aliases. Many payloads that are called JSON are
+// really YAML, and a YAML parser stops at the first problem, so the document is
+// also walked line by line with a stack of open blocks, the indentation counterpart
+// of the bracket stack the PDA keeps for JSON, to report every problem at once.
+package yamlcheck
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"config-validator/pkg/automata"
+	"config-validator/pkg/linereader"
+)
+
+// State is the state reported in YAML findings.
+const State = "YAML"
+
+var (
+	// keyRe matches a mapping key at the start of a line: a plain, single-quoted, or
+	// double-quoted scalar followed by ": " or a colon at the end of the line.
+	keyRe = regexp.MustCompile(`^("(?:[^"\\]|\\.)*"|'(?:[^']|'')*'|[^\s#'"&*!|>\[\]{},?\-][^#]*?|-[^\s#][^#]*?|\?)\s*:(?:\s+|$)`)
+	// anchorRe matches an anchor at the start of a token. aliasRe matches an alias,
+	// which is a whole node: the value itself or an entry of a flow collection.
+	anchorRe = regexp.MustCompile(`(?:^|[\s\[{,])&([^\s\[\]{},]+)`)
+	aliasRe  = regexp.MustCompile(`(?:^|[\[{,]\s*)\*([^\s\[\]{},]+)`)
+	// quotedRe matches quoted scalars, whose & and * are text.
+	quotedRe = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'(?:[^']|'')*'`)
+	// parseErrRe extracts the line of a yaml.v3 error message.
+	parseErrRe = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+)
+
+// block is an open mapping or sequence on the stack.
+type block struct {
+	indent int
+	keys   map[string]int // key -> line it was first defined on
+}
+
+type checker struct {
+	findings []automata.Finding
+	stack    []block
+	anchors  map[string]bool
+	opened   bool // the previous line opened a nested block
+	scalar   int  // indentation a block scalar's lines must exceed, or -1
+}
+
+// Check returns the findings for a YAML stream, which may hold several documents.
+func Check(content []byte) []automata.Finding {
+	c := &checker{anchors: map[string]bool{}, scalar: -1}
+	scanner := linereader.NewScanner(bytes.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		c.line(scanner.Text(), n)
+	}
+
+	// Syntax errors come from the parser, unless a line already has a finding. Unknown
+	// anchors were reported above, with their line.
+	reported := map[int]bool{}
+	for _, f := range c.findings {
+		reported[f.Line] = true
+	}
+	for _, f := range parseErrors(content) {
+		if !reported[f.Line] && !strings.Contains(f.Message, "unknown anchor") {
+			c.findings = append(c.findings, f)
+		}
+	}
+	sort.SliceStable(c.findings, func(i, j int) bool { return c.findings[i].Line < c.findings[j].Line })
+	return c.findings
+}
+
+func (c *checker) add(n int, line, msg string) {
+	c.findings = append(c.findings, automata.Finding{
+		Line:     n,
+		Command:  strings.TrimSpace(line),
+		State:    State,
+		Message:  msg,
+		Severity: automata.SeverityError,
+	})
+}
+
+func (c *checker) line(line string, n int) {
+	trimmed := strings.TrimSpace(line)
+	ws := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+	indent := 0
+	for _, ch := range ws {
+		if ch == '\t' {
+			indent += 8 - indent%8 // as an editor would show it; reported below
+		} else {
+			indent++
+		}
+	}
+
+	// Lines of a block scalar (| or >) are text, whatever they contain.
+	if c.scalar >= 0 {
+		if trimmed == "" || indent > c.scalar {
+			return
+		}
+		c.scalar = -1
+	}
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return
+	}
+	if strings.HasPrefix(line, "---") || strings.HasPrefix(line, "...") || strings.HasPrefix(line, "%") {
+		// A new document: blocks and anchors do not carry over.
+		c.stack, c.opened = nil, false
+		c.anchors = map[string]bool{}
+		return
+	}
+	if strings.Contains(ws, "\t") {
+		c.add(n, line, "tab character in indentation, YAML allows only spaces")
+	}
+
+	switch top := len(c.stack) - 1; {
+	case top < 0 || (indent > c.stack[top].indent && c.opened):
+		c.push(indent)
+	case indent > c.stack[top].indent:
+		// Continuation of a multi-line scalar or flow collection.
+		c.aliases(stripComment(trimmed), line, n)
+		return
+	case indent < c.stack[top].indent:
+		open := c.stackString()
+		for len(c.stack) > 1 && indent < c.stack[len(c.stack)-1].indent {
+			c.stack = c.stack[:len(c.stack)-1]
+		}
+		if indent != c.stack[len(c.stack)-1].indent {
+			c.add(n, line, fmt.Sprintf("inconsistent indentation: %d spaces matches no open block (open blocks at columns %s)", indent, open))
+		}
+	}
+	c.opened = false
+	c.content(trimmed, indent, line, n)
+}
+
+// content handles a line's content starting at column col: sequence entries ("- "),
+// which open a block of their own, then a key and its value.
+func (c *checker) content(s string, col int, line string, n int) {
+	for s == "-" || strings.HasPrefix(s, "- ") {
+		if s == "-" {
+			c.opened = true
+			return
+		}
+		rest := strings.TrimLeft(s[1:], " ")
+		col += len(s) - len(rest)
+		s = rest
+		c.push(col) // each entry is a new mapping
+	}
+
+	value := s
+	if m := keyRe.FindStringSubmatch(s); m != nil {
+		key := unquote(m[1])
+		top := &c.stack[len(c.stack)-1]
+		if first, ok := top.keys[key]; ok && key != "<<" {
+			c.add(n, line, fmt.Sprintf("duplicate key '%s', first defined on line %d", key, first))
+		} else if !ok {
+			top.keys[key] = n
+		}
+		value = strings.TrimSpace(s[len(m[0]):])
+	}
+	c.value(value, col, line, n)
+}
+
+// value records anchors, checks aliases, and notes whether the value opens a nested
+// block or starts a block scalar.
+func (c *checker) value(v string, col int, line string, n int) {
+	v = stripComment(v)
+	c.aliases(v, line, n)
+
+	// Anchors and tags alone leave the value to the following lines.
+	var rest []string
+	for _, field := range strings.Fields(v) {
+		if !strings.HasPrefix(field, "&") && !strings.HasPrefix(field, "!") {
+			rest = append(rest, field)
+		}
+	}
+	switch {
+	case len(rest) == 0:
+		c.opened = true
+	case strings.HasPrefix(rest[0], "|") || strings.HasPrefix(rest[0], ">"):
+		c.scalar = col
+	}
+}
+
+// aliases records the anchors in s and reports aliases to anchors not defined yet.
+func (c *checker) aliases(s, line string, n int) {
+	s = quotedRe.ReplaceAllString(s, `""`)
+	for _, m := range anchorRe.FindAllStringSubmatch(s, -1) {
+		c.anchors[m[1]] = true
+	}
+	for _, m := range aliasRe.FindAllStringSubmatch(s, -1) {
+		if !c.anchors[m[1]] {
+			c.add(n, line, fmt.Sprintf("alias '*%s' refers to an anchor that is not defined before it", m[1]))
+		}
+	}
+}
+
+func (c *checker) push(indent int) {
+	c.stack = append(c.stack, block{indent: indent, keys: map[string]int{}})
+}
+
+// stackString renders the columns of the open blocks, innermost last, the way the
+// JSON validator shows its bracket stack.
+func (c *checker) stackString() string {
+	levels := make([]string, len(c.stack))
+	for i, b := range c.stack {
+		levels[i] = strconv.Itoa(b.indent)
+	}
+	return strings.Join(levels, " ")
+}
+
+// stripComment drops a trailing comment outside quotes.
+func stripComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return strings.TrimSpace(s[:i])
+		}
+	}
+	return s
+}
+
+func unquote(key string) string {
+	if len(key) >= 2 && (key[0] == '"' || key[0] == '\'') && key[len(key)-1] == key[0] {
+		return key[1 : len(key)-1]
+	}
+	return strings.TrimSpace(key)
+}
+
+// parseErrors parses every document and returns the parser's errors as findings.
+func parseErrors(content []byte) []automata.Finding {
+	var findings []automata.Finding
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var v any
+		err := dec.Decode(&v)
+		if err == nil {
+			continue
+		}
+		if err == io.EOF {
+			return findings
+		}
+		messages := []string{err.Error()}
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			messages = typeErr.Errors // the document was read; these are per value
+		}
+		for _, msg := range messages {
+			f := automata.Finding{State: State, Message: "invalid YAML: " + msg, Severity: automata.SeverityError}
+			if m := parseErrRe.FindStringSubmatch(msg); m != nil {
+				f.Line, _ = strconv.Atoi(m[1])
+				f.Message = "invalid YAML: " + m[2]
+			}
+			findings = append(findings, f)
+		}
+		if typeErr == nil {
+			return findings // the parser cannot continue after a syntax error
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ANSI escape sequences of the console output.
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiDim    = "\x1b[2m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+)
+
+// Error severities: the payload is not JSON, or it is but breaks the policy.
+const (
+	severityError  = "error"
+	severityPolicy = "policy"
+)
+
+// errorSeverity is the severity of an error, from its type.
+func errorSeverity(e DetailedError) string {
+	if strings.HasPrefix(e.ErrorType, "POLICY_") {
+		return severityPolicy
+	}
+	return severityError
+}
+
+// useColor reports whether console output to f should be colored: only on a
+// terminal, and never when the NO_COLOR environment variable is set (no-color.org).
+func useColor(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// console renders results for a person at a terminal, as the default -format text.
+type console struct {
+	w           io.Writer
+	color       bool
+	summaryOnly bool // -q: the errors are left out
+}
+
+func (c console) paint(color, s string) string {
+	if !c.color {
+		return s
+	}
+	return color + s + ansiReset
+}
+
+// errors prints the errors of a file grouped by severity, syntax errors first, each
+// group headed by its count, and a summary line with the count per severity.
+func (c console) errors(file string, errs []DetailedError, summary string) {
+	var b strings.Builder
+	if !c.summaryOnly {
+		fmt.Fprintf(&b, "%s\n", c.paint(ansiBold, file))
+	}
+	counts := map[string]int{}
+	for _, severity := range []string{severityError, severityPolicy} {
+		color := ansiRed
+		if severity == severityPolicy {
+			color = ansiYellow
+		}
+		var group []DetailedError
+		for _, e := range errs {
+			if errorSeverity(e) == severity {
+				group = append(group, e)
+			}
+		}
+		if len(group) == 0 {
+			continue
+		}
+		counts[severity] = len(group)
+		if c.summaryOnly {
+			continue
+		}
+		fmt.Fprintf(&b, "  %s\n", c.paint(color, fmt.Sprintf("%s (%d)", severity, len(group))))
+		for _, e := range group {
+			where := fmt.Sprintf("%d:%d", e.Line, e.Column)
+			if e.Document > 0 {
+				where = fmt.Sprintf("#%d %s", e.Document, where)
+			}
+			fmt.Fprintf(&b, "    %s  %s  %s\n", c.paint(ansiDim, fmt.Sprintf("%-8s", where)), e.ErrorType, e.Suggestion)
+		}
+	}
+	var parts []string
+	for _, severity := range []string{severityError, severityPolicy} {
+		if n := counts[severity]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", severity, n))
+		}
+	}
+	if !c.summaryOnly {
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "%s %d errors in %s (%s)", c.paint(ansiRed, "✖"), len(errs), file, strings.Join(parts, ", "))
+	c.finish(&b, summary)
+}
+
+// valid prints the summary line of a valid payload, which may hold several documents.
+func (c console) valid(file string, stats PayloadStats, documents, tokens, lines int, summary string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s is valid: ", c.paint(ansiGreen, "✔"), c.paint(ansiBold, file))
+	if documents > 1 {
+		fmt.Fprintf(&b, "%d documents, ", documents)
+	}
+	fmt.Fprintf(&b, "%d tokens, %d lines, %d keys, depth %d", tokens, lines, stats.Keys, stats.MaxDepth)
+	c.finish(&b, summary)
+}
+
+func (c console) finish(b *strings.Builder, summary string) {
+	if summary != "" {
+		b.WriteString(", " + summary)
+	}
+	b.WriteString("\n")
+	io.WriteString(c.w, b.String())
+}
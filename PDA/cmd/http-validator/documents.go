@@ -0,0 +1,89 @@
+package main
+
+import "protocol-validator/pkg/validation"
+
+// document is one of the JSON documents of an input, input[Start:End], such as one
+// line of a log extract. Its tokens point into the whole input.
+type document struct {
+	Start, End int
+	Tokens     []jsonToken
+}
+
+// splitDocuments splits an input into its whitespace-separated JSON documents. The
+// boundaries are where the stack of open objects and arrays empties, as the PDA
+// reads the tokens: after a closing bracket that ends the outermost value, or after
+// a scalar read with nothing open. A closing bracket always closes the innermost
+// open value, even one of the other kind, so a mismatch does not swallow the
+// documents after it; one that is never closed runs to the end of the input. An
+// input of one document, or of none, is returned whole.
+func splitDocuments(input string, tokens []jsonToken) []document {
+	var docs []document
+	depth, first := 0, 0
+	for i, t := range tokens {
+		switch input[t.Start] {
+		case '{', '[':
+			depth++
+		case '}', ']':
+			if depth > 0 {
+				depth--
+			}
+		default:
+			if depth > 0 {
+				continue
+			}
+		}
+		if depth == 0 {
+			docs = append(docs, document{Start: int(tokens[first].Start), End: int(t.End), Tokens: tokens[first : i+1]})
+			first = i + 1
+		}
+	}
+	if first < len(tokens) {
+		docs = append(docs, document{Start: int(tokens[first].Start), End: len(input), Tokens: tokens[first:]})
+	}
+	if len(docs) <= 1 {
+		return []document{{Start: 0, End: len(input), Tokens: tokens}}
+	}
+	return docs
+}
+
+// documentError is a validation error of a document, at its offset in the whole
+// input.
+type documentError struct {
+	validation.ValidationError
+	Document int // 1-based, 0 for an input of one document
+}
+
+// validateDocuments runs the PDA validation on each document, and returns the errors
+// of all of them and whether each document is valid.
+func validateDocuments(input string, docs []document) ([]documentError, []bool) {
+	var errs []documentError
+	valid := make([]bool, len(docs))
+	for i, d := range docs {
+		docErrs := validation.ValidateJSON(input[d.Start:d.End])
+		valid[i] = len(docErrs) == 0
+		for _, e := range docErrs {
+			e.Position += d.Start
+			de := documentError{ValidationError: e}
+			if len(docs) > 1 {
+				de.Document = i + 1
+			}
+			errs = append(errs, de)
+		}
+	}
+	return errs, valid
+}
+
+// addStats adds the statistics of a document to those of the input: counts add up,
+// and the deepest document gives the depth and its path.
+func addStats(total *PayloadStats, s PayloadStats) {
+	if s.MaxDepth > total.MaxDepth {
+		total.MaxDepth, total.DeepestPath = s.MaxDepth, s.DeepestPath
+	}
+	total.Objects += s.Objects
+	total.Arrays += s.Arrays
+	total.Keys += s.Keys
+	total.Strings += s.Strings
+	total.Numbers += s.Numbers
+	total.Booleans += s.Booleans
+	total.Nulls += s.Nulls
+}
@@ -2,40 +2,108 @@ package main
 
 import (
 	"bytes"
+	_ "embed"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"protocol-validator/pkg/automata"
-	"protocol-validator/pkg/validation"
+	"protocol-validator/pkg/position"
 	"regexp"
+	"strings"
 	"time"
 )
 
+// DetailedError locates an error both ways: byte offsets for byte-oriented tools,
+// and rune offsets and columns for editors, which differ once the input holds
+// multi-byte UTF-8. Position is the byte offset, kept for existing consumers.
 type DetailedError struct {
 	ErrorType  string   `json:"error_type"`
+	Document   int      `json:"document,omitempty"` // 1-based, in inputs of several documents
 	Line       int      `json:"line"`
+	Column     int      `json:"column"` // 1-based, in runes
 	Position   int      `json:"position"`
+	ByteOffset int      `json:"byte_offset"`
+	RuneOffset int      `json:"rune_offset"`
 	StackState []string `json:"pda_stack_state"`
 	Suggestion string   `json:"suggestion"`
 }
 
+// demoRequest is validated when no input file is given, so the binary runs on its own.
+//
+//go:embed demo_request.json
+var demoRequest []byte
+
 func main() {
 	// CLI flags
 	var outDir string
 	var rootDir string
+	var format string
 	flag.StringVar(&outDir, "outdir", ".", "directory where report files will be saved")
 	flag.StringVar(&rootDir, "root", ".", "root directory to resolve relative input paths (helps locate files in nested workspaces)")
+	flag.StringVar(&format, "format", "text", "stdout format: text (errors grouped by severity, with a summary) or json (the input and the JSON report, as saved)")
+	quiet, verbose, trace := addVerbosityFlags()
+	// Structural policy, checked on payloads that are valid JSON
+	var policy Policy
+	var forbiddenKeys, requiredKeys string
+	flag.IntVar(&policy.MaxArrayLength, "max-array-length", 0, "maximum number of elements of an array (0 for no limit)")
+	flag.IntVar(&policy.MaxKeyLength, "max-key-length", 0, "maximum length of a key, in characters (0 for no limit)")
+	flag.IntVar(&policy.MaxKeys, "max-keys", 0, "maximum number of keys in the whole payload (0 for no limit)")
+	flag.StringVar(&forbiddenKeys, "forbidden-keys", "", "regular expression of key names that must not appear, e.g. '^(__proto__|constructor)$'")
+	flag.StringVar(&requiredKeys, "required-keys", "", "comma-separated keys the top-level object must have")
+	// Redaction of what is saved and printed
+	var redactKeys, redactPattern string
+	flag.StringVar(&redactKeys, "redact-keys", defaultRedactKeys, "comma-separated keys whose values are masked in reports and output, at any depth (empty to mask none)")
+	flag.StringVar(&redactPattern, "redact", "", "regular expression of text masked in reports and output; with a group, only the group is masked")
 	flag.Parse()
 
-	// Determine JSON path from remaining args (after flags)
+	if format != "text" && format != "json" {
+		fmt.Printf("Unknown -format %q: use text or json\n", format)
+		os.Exit(2)
+	}
+	level, err := verbosityLevel(*quiet, *verbose, *trace)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	timer := newStageTimer()
+	// The saved report is the same in both formats; json also prints it as it is built
+	echo := io.Discard
+	if format == "json" {
+		echo = os.Stdout
+	}
+	term := console{w: os.Stdout, color: useColor(os.Stdout), summaryOnly: level == quietOutput}
+
+	if forbiddenKeys != "" {
+		re, err := regexp.Compile(forbiddenKeys)
+		if err != nil {
+			fmt.Printf("Invalid -forbidden-keys: %v\n", err)
+			os.Exit(2)
+		}
+		policy.ForbiddenKeys = re
+	}
+	redaction, err := newRedaction(redactKeys, redactPattern)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	for _, key := range strings.Split(requiredKeys, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			policy.RequiredKeys = append(policy.RequiredKeys, key)
+		}
+	}
+
+	// Determine JSON path from remaining args (after flags); without one, the
+	// built-in demo request is validated
 	var jsonPath string
+	var data []byte
 	args := flag.Args()
 	if len(args) > 0 {
 		jsonPath = args[0]
 	} else {
-		jsonPath = "protocol-validator/protocol-validator/request2.json"
+		jsonPath, data = "demo_request.json", demoRequest
 	}
 
 	// Resolve absolute paths for root, outdir
@@ -52,7 +120,9 @@ func main() {
 	// 3) try rootDir + jsonPath
 	// 4) fallback: search recursively under rootDir for matching basename
 	var resolvedInput string
-	if filepath.IsAbs(jsonPath) {
+	if data != nil {
+		// built-in demo request: nothing to resolve
+	} else if filepath.IsAbs(jsonPath) {
 		if _, err := os.Stat(jsonPath); err == nil {
 			resolvedInput = jsonPath
 		}
@@ -95,87 +165,157 @@ func main() {
 	}
 	jsonPath = resolvedInput
 
-	data, err := os.ReadFile(jsonPath)
-	if err != nil {
-		fmt.Printf("Failed to read %s: %v\n", jsonPath, err)
-		return
+	if data == nil {
+		var err error
+		if data, err = os.ReadFile(jsonPath); err != nil {
+			fmt.Printf("Failed to read %s: %v\n", jsonPath, err)
+			return
+		}
 	}
 
 	httpInput := string(data)
+	timer.done("read")
+
+	// The input may hold several JSON documents back to back, as pipes and log
+	// extracts do. Each is validated by the PDA on its own, and a valid one is then
+	// walked for its statistics and checked against the policy
+	pooled := tokenize(httpInput)
+	defer releaseTokens(pooled)
+	tokens := *pooled
+	docs := splitDocuments(httpInput, tokens)
+	vErrs, validDocs := validateDocuments(httpInput, docs)
+	timer.done("validate")
+	var dErrs []DetailedError
+	var stats PayloadStats
+	// What is saved and printed has the sensitive values masked, in place so the
+	// positions of the errors still point into it
+	shown, secrets := redaction.apply(httpInput, tokens)
+
 	// Capture all printed output so we can save it to a file in the current directory
 	var out bytes.Buffer
-	fmt.Fprintf(&out, "Raw input received from %s : %s\n\n", jsonPath, httpInput)
+	fmt.Fprintf(&out, "Raw input received from %s : %s\n\n", jsonPath, shown)
 	// Also print raw input to stdout for immediate feedback
-	fmt.Print(out.String())
-
-	// Run PDA-based JSON validation
-	vErrs := validation.ValidateJSON(httpInput)
-	if len(vErrs) > 0 {
-		fmt.Println("==================== ERRORS DETECTED ====================")
+	fmt.Fprint(echo, out.String())
+	for i, doc := range docs {
+		if !validDocs[i] {
+			continue
+		}
+		docStats, violations := walkPayload(httpInput, doc.Tokens, policy)
+		addStats(&stats, docStats)
+		for _, v := range violations {
+			if len(docs) > 1 {
+				v.Document = i + 1
+			}
+			dErrs = append(dErrs, v)
+		}
+	}
+	timer.done("walk")
+	if level == traceOutput {
+		traceTokens(shown, tokens)
+	}
+	if len(vErrs) > 0 || len(dErrs) > 0 {
+		fmt.Fprintln(echo, "==================== ERRORS DETECTED ====================")
 		fmt.Fprintln(&out, "==================== ERRORS DETECTED ====================")
-		var dErrs []DetailedError
+		// The input is indexed once, so each error is located in logarithmic time
+		index := position.NewIndex(httpInput)
 		for _, vErr := range vErrs {
-			line := findLineNumber(httpInput, vErr.Position)
+			pos := index.Locate(vErr.Position)
 			dErrs = append(dErrs, DetailedError{
 				ErrorType:  vErr.ErrorType,
-				Line:       line,
-				Position:   vErr.Position,
+				Document:   vErr.Document,
+				Line:       pos.Line,
+				Column:     pos.Column,
+				Position:   pos.ByteOffset,
+				ByteOffset: pos.ByteOffset,
+				RuneOffset: pos.RuneOffset,
 				StackState: vErr.StackState,
 				Suggestion: vErr.Suggestion,
 			})
 		}
+		for i := range dErrs {
+			dErrs[i].Suggestion = redaction.text(dErrs[i].Suggestion, secrets)
+		}
 		b, _ := json.MarshalIndent(dErrs, "", "  ")
 		// Print to stdout and buffer
-		fmt.Println(string(b))
+		fmt.Fprintln(echo, string(b))
 		fmt.Fprintln(&out, string(b))
-		fmt.Println("================== END OF ERRORS ==================")
+		fmt.Fprintln(echo, "================== END OF ERRORS ==================")
 		fmt.Fprintln(&out, "================== END OF ERRORS ==================")
 
 		// Save the buffer to a timestamped file in the requested output directory
-		saveReport(outDir, jsonPath, out.Bytes())
+		saved := saveReport(outDir, jsonPath, out.Bytes())
+		timer.done("report")
+		if level >= verboseOutput {
+			timer.print()
+			if len(vErrs) == 0 {
+				printStats(stats) // only the policy failed
+			}
+		}
+		if format == "text" {
+			term.errors(jsonPath, dErrs, savedSummary(saved))
+		} else if saved != "" {
+			fmt.Printf("Saved report to: %s\n", saved)
+		}
 		return
 	}
 
 	// Success: print full JSON report
 	type SuccessReport struct {
-		Status     string   `json:"status"`
-		File       string   `json:"file"`
-		PDAStack   []string `json:"pda_stack_state"`
-		TokenCount int      `json:"token_count"`
-		LineCount  int      `json:"line_count"`
-		Message    string   `json:"message"`
-	}
-	tokens := validation.TokenizeJSONWithLines(httpInput)
-	pda := NewPDAForStack(tokens)
+		Status     string       `json:"status"`
+		File       string       `json:"file"`
+		PDAStack   []string     `json:"pda_stack_state"`
+		Documents  int          `json:"documents,omitempty"` // when the input holds several
+		TokenCount int          `json:"token_count"`
+		LineCount  int          `json:"line_count"`
+		Stats      PayloadStats `json:"stats"`
+		Message    string       `json:"message"`
+	}
+	pda := NewPDAForStack(httpInput, tokens)
+	documents := 0
+	if len(docs) > 1 {
+		documents = len(docs)
+	}
 	report := SuccessReport{
 		Status:     "valid",
 		File:       jsonPath,
 		PDAStack:   runeSliceToStringSlice(pda.StackSnapshot()),
+		Documents:  documents,
 		TokenCount: len(tokens),
 		LineCount:  countLines(httpInput),
+		Stats:      stats,
 		Message:    " HTTP request and JSON body are valid.",
 	}
 	b, _ := json.MarshalIndent(report, "", "  ")
 	// Print to stdout and append to buffer
-	fmt.Println(string(b))
+	fmt.Fprintln(echo, string(b))
 	fmt.Fprintln(&out, string(b))
 
 	// Save the buffer to a timestamped file in the requested output directory
-	saveReport(outDir, jsonPath, out.Bytes())
+	saved := saveReport(outDir, jsonPath, out.Bytes())
+	timer.done("report")
+	if level >= verboseOutput {
+		timer.print()
+		printStats(stats)
+	}
+	if format == "text" {
+		term.valid(jsonPath, stats, report.Documents, report.TokenCount, report.LineCount, savedSummary(saved))
+	} else if saved != "" {
+		fmt.Printf("Saved report to: %s\n", saved)
+	}
 }
 
-// findLineNumber maps a position index to line number in the JSON input
-func findLineNumber(input string, pos int) int {
-	line := 1
-	for i, r := range input {
-		if i >= pos {
-			break
-		}
-		if r == '\n' {
-			line++
-		}
+// savedSummary ends the console summary line with where the report was saved.
+func savedSummary(path string) string {
+	if path == "" {
+		return ""
 	}
-	return line
+	return "report saved to " + path
+}
+
+// findLineNumber maps a position index to line number in the JSON input. It
+// indexes the input for one lookup; locate many positions with a position.Index.
+func findLineNumber(input string, pos int) int {
+	return position.NewIndex(input).Line(pos)
 }
 
 // optional: regex-based parser if you feed external errors
@@ -189,17 +329,17 @@ func extractLineFromError(errMsg string) string {
 }
 
 // Helper: create PDA and return stack after processing tokens
-func NewPDAForStack(tokens []validation.TokenInfo) *automata.PDA {
+func NewPDAForStack(input string, tokens []jsonToken) *automata.PDA {
 	pda := automata.NewPDA()
 	for _, t := range tokens {
-		switch t.Token {
-		case "{", "[":
-			pda.Push(rune(t.Token[0]))
-		case "}":
+		switch input[t.Start] {
+		case '{', '[':
+			pda.Push(rune(input[t.Start]))
+		case '}':
 			if pda.Peek() == '{' {
 				pda.Pop()
 			}
-		case "]":
+		case ']':
 			if pda.Peek() == '[' {
 				pda.Pop()
 			}
@@ -227,12 +367,13 @@ func runeSliceToStringSlice(runes []rune) []string {
 	return result
 }
 
-// saveReport writes report bytes into a timestamped file in the current working directory.
-func saveReport(outDir string, inputPath string, data []byte) {
+// saveReport writes report bytes into a timestamped file in the output directory,
+// and returns its path, or "" when it could not be written.
+func saveReport(outDir string, inputPath string, data []byte) string {
 	// Ensure the output directory exists
 	if err := os.MkdirAll(outDir, 0o755); err != nil {
 		fmt.Printf("Failed to create outdir %s: %v\n", outDir, err)
-		return
+		return ""
 	}
 	// use basename of input to name file
 	base := filepath.Base(inputPath)
@@ -241,7 +382,7 @@ func saveReport(outDir string, inputPath string, data []byte) {
 	outPath := filepath.Join(outDir, outName)
 	if err := os.WriteFile(outPath, data, 0o644); err != nil {
 		fmt.Printf("Failed to write report to %s: %v\n", outPath, err)
-		return
+		return ""
 	}
-	fmt.Printf("Saved report to: %s\n", outPath)
+	return outPath
 }
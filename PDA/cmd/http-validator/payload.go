@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"protocol-validator/pkg/position"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// PayloadStats describe the shape of a valid payload, for complexity budgets.
+type PayloadStats struct {
+	MaxDepth    int    `json:"max_depth"`    // nesting of objects and arrays; 0 for a scalar
+	DeepestPath string `json:"deepest_path"` // of the first container at MaxDepth, e.g. $.items[3].dims
+	Objects     int    `json:"objects"`
+	Arrays      int    `json:"arrays"`
+	Keys        int    `json:"keys"`
+	Strings     int    `json:"strings"` // string values; keys are counted separately
+	Numbers     int    `json:"numbers"`
+	Booleans    int    `json:"booleans"`
+	Nulls       int    `json:"nulls"`
+}
+
+// Policy holds structural limits for payloads, a lightweight alternative to a JSON
+// Schema for gateway-style checks. Zero values disable a limit.
+type Policy struct {
+	MaxArrayLength int
+	MaxKeyLength   int // in characters
+	MaxKeys        int // in the whole payload
+	ForbiddenKeys  *regexp.Regexp
+	RequiredKeys   []string // of the top-level object
+}
+
+// container is an object or array open while walkPayload reads the tokens.
+type container struct {
+	kind      byte   // '{' or '['
+	path      string // from the root
+	key       string // the key of the member being read, in objects
+	index     int    // of the element being read, in arrays
+	elements  int    // values started so far, in arrays
+	expectKey bool   // the next string is a key
+	keys      map[string]bool
+}
+
+var identifierRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// walkPayload reads the tokens of a valid payload with a stack of the open
+// containers, as the PDA does, counting values, tracking the deepest one, and
+// checking them against the policy. Violations are reported at their tokens.
+func walkPayload(input string, tokens []jsonToken, policy Policy) (PayloadStats, []DetailedError) {
+	var stats PayloadStats
+	var violations []DetailedError
+	var index *position.Index // built at the first violation
+	var stack []*container
+	var rootKeys map[string]bool
+	rootIsObject := false
+
+	// childPath is the path of the value being read in the innermost container
+	childPath := func() string {
+		if len(stack) == 0 {
+			return "$"
+		}
+		top := stack[len(stack)-1]
+		if top.kind == '[' {
+			return fmt.Sprintf("%s[%d]", top.path, top.index)
+		}
+		return memberPath(top.path, top.key)
+	}
+	violate := func(offset int, errorType, suggestion string) {
+		if index == nil {
+			index = position.NewIndex(input)
+		}
+		pos := index.Locate(offset)
+		stackState := make([]string, len(stack))
+		for i, c := range stack {
+			stackState[i] = string(c.kind)
+		}
+		violations = append(violations, DetailedError{
+			ErrorType:  errorType,
+			Line:       pos.Line,
+			Column:     pos.Column,
+			Position:   pos.ByteOffset,
+			ByteOffset: pos.ByteOffset,
+			RuneOffset: pos.RuneOffset,
+			StackState: stackState,
+			Suggestion: suggestion,
+		})
+	}
+	// startValue counts a value starting at offset as an element of the innermost
+	// array, if it is in one
+	startValue := func(offset int) {
+		if len(stack) == 0 || stack[len(stack)-1].kind != '[' {
+			return
+		}
+		top := stack[len(stack)-1]
+		top.elements++
+		if policy.MaxArrayLength > 0 && top.elements == policy.MaxArrayLength+1 {
+			violate(offset, "POLICY_MAX_ARRAY_LENGTH",
+				fmt.Sprintf("%s has more than %d elements; send fewer or paginate", top.path, policy.MaxArrayLength))
+		}
+	}
+
+	for _, t := range tokens {
+		tok, offset := t.text(input), int(t.Start)
+
+		switch {
+		case tok == "{" || tok == "[":
+			startValue(offset)
+			if tok == "{" {
+				stats.Objects++
+			} else {
+				stats.Arrays++
+			}
+			c := &container{kind: tok[0], path: childPath(), expectKey: tok == "{"}
+			if len(stack) == 0 && tok == "{" {
+				rootIsObject = true
+				c.keys = map[string]bool{}
+				rootKeys = c.keys
+			}
+			stack = append(stack, c)
+			if len(stack) > stats.MaxDepth {
+				stats.MaxDepth = len(stack)
+				stats.DeepestPath = c.path
+			}
+		case tok == "}" || tok == "]":
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case tok == ",":
+			if len(stack) > 0 {
+				top := stack[len(stack)-1]
+				top.index++
+				top.expectKey = top.kind == '{'
+			}
+		case tok == ":":
+		case strings.HasPrefix(tok, `"`) && len(stack) > 0 && stack[len(stack)-1].expectKey:
+			top := stack[len(stack)-1]
+			// Keys without escapes are their own text, and need no decoding
+			if len(tok) >= 2 && !strings.Contains(tok, `\`) {
+				top.key = tok[1 : len(tok)-1]
+			} else if err := json.Unmarshal([]byte(tok), &top.key); err != nil {
+				top.key = strings.Trim(tok, `"`)
+			}
+			top.expectKey = false
+			if top.keys != nil {
+				top.keys[top.key] = true
+			}
+			stats.Keys++
+
+			path := memberPath(top.path, top.key)
+			if policy.MaxKeyLength > 0 && utf8.RuneCountInString(top.key) > policy.MaxKeyLength {
+				violate(offset, "POLICY_MAX_KEY_LENGTH",
+					fmt.Sprintf("key of %s is %d characters long, over the maximum of %d", path, utf8.RuneCountInString(top.key), policy.MaxKeyLength))
+			}
+			if policy.MaxKeys > 0 && stats.Keys == policy.MaxKeys+1 {
+				violate(offset, "POLICY_MAX_KEYS",
+					fmt.Sprintf("payload has more than %d keys; %s is the first over the limit", policy.MaxKeys, path))
+			}
+			if policy.ForbiddenKeys != nil && policy.ForbiddenKeys.MatchString(top.key) {
+				violate(offset, "POLICY_FORBIDDEN_KEY",
+					fmt.Sprintf("key %q at %s matches the forbidden pattern %s", top.key, path, policy.ForbiddenKeys))
+			}
+		case strings.HasPrefix(tok, `"`):
+			startValue(offset)
+			stats.Strings++
+		case tok == "true" || tok == "false":
+			startValue(offset)
+			stats.Booleans++
+		case tok == "null":
+			startValue(offset)
+			stats.Nulls++
+		default:
+			startValue(offset)
+			stats.Numbers++
+		}
+	}
+
+	// Missing keys have no token to point at, so they are reported at the start of
+	// the payload, which is the first token of its document
+	start := 0
+	if len(tokens) > 0 {
+		start = int(tokens[0].Start)
+	}
+	if len(policy.RequiredKeys) > 0 && !rootIsObject {
+		violate(start, "POLICY_REQUIRED_KEYS", "payload must be an object with the keys "+strings.Join(policy.RequiredKeys, ", "))
+	} else {
+		for _, key := range policy.RequiredKeys {
+			if !rootKeys[key] {
+				violate(start, "POLICY_REQUIRED_KEY", fmt.Sprintf("required top-level key %q is missing", key))
+			}
+		}
+	}
+	return stats, violations
+}
+
+// memberPath is the path of an object member: $.name, or $["a b"] for keys that
+// are not identifiers.
+func memberPath(parent, key string) string {
+	if identifierRe.MatchString(key) {
+		return parent + "." + key
+	}
+	quoted, _ := json.Marshal(key)
+	return parent + "[" + string(quoted) + "]"
+}
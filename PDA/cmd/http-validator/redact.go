@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultRedactKeys are the keys whose values are masked unless -redact-keys says
+// otherwise.
+const defaultRedactKeys = "password,passwd,secret,token,api_key,authorization,cookie,access_token,refresh_token,client_secret,private_key"
+
+// masks replace a character of the given UTF-8 width, so a masked payload has its
+// lines, byte offsets, and columns where the original had them, and the reported
+// positions still point at the right place in the saved report.
+var masks = [utf8.UTFMax + 1]string{1: "*", 2: "·", 3: "•", 4: "🔒"}
+
+// minSecretLength is the shortest masked value that is also masked in the error
+// suggestions; shorter ones, such as small numbers, would mask unrelated text.
+const minSecretLength = 4
+
+// Redaction masks sensitive text of a payload before it is saved or printed: the
+// values of some keys, at any depth, and the matches of a pattern.
+type Redaction struct {
+	Keys    map[string]bool // normalized, see redactKey
+	Pattern *regexp.Regexp  // with a group, only the group is masked
+}
+
+// newRedaction reads -redact-keys and -redact.
+func newRedaction(keys, pattern string) (Redaction, error) {
+	var r Redaction
+	for _, key := range strings.Split(keys, ",") {
+		if key = redactKey(key); key != "" {
+			if r.Keys == nil {
+				r.Keys = map[string]bool{}
+			}
+			r.Keys[key] = true
+		}
+	}
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return r, fmt.Errorf("invalid -redact: %v", err)
+		}
+		r.Pattern = re
+	}
+	return r, nil
+}
+
+// redactKey normalizes a key name, so that api_key also covers apiKey and Api-Key.
+func redactKey(key string) string {
+	return strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(strings.TrimSpace(key)))
+}
+
+func (r Redaction) active() bool { return len(r.Keys) > 0 || r.Pattern != nil }
+
+// apply returns the input with the values of the redacted keys and the matches of
+// the pattern masked, and the masked values, for masking them in messages too.
+// Invalid payloads are masked as far as their tokens go.
+func (r Redaction) apply(input string, tokens []jsonToken) (string, []string) {
+	if !r.active() {
+		return input, nil
+	}
+	masked := []byte(input)
+	var secrets []string
+	mask := func(start, end int) {
+		if s := input[start:end]; len(s) >= minSecretLength {
+			secrets = append(secrets, s)
+		}
+		maskBytes(masked[start:end])
+	}
+
+	isKey := func(i int) bool {
+		return tokens[i].text(input)[0] == '"' && i+1 < len(tokens) && tokens[i+1].text(input) == ":"
+	}
+	depth := 0 // of the object or array being masked; 0 outside one
+	for i := 0; i < len(tokens); i++ {
+		text := tokens[i].text(input)
+		if depth > 0 {
+			switch text {
+			case "{", "[":
+				depth++
+			case "}", "]":
+				depth--
+			case ",", ":":
+			default:
+				if !isKey(i) { // keys of a masked object are kept, for its shape
+					maskToken(tokens[i], text, mask)
+				}
+			}
+			continue
+		}
+		if !isKey(i) || i+2 >= len(tokens) || !r.Keys[redactKey(strings.Trim(text, `"`))] {
+			continue
+		}
+		i += 2 // the value
+		switch value := tokens[i].text(input); value {
+		case "{", "[":
+			depth = 1
+		case "}", "]", ",", ":":
+		default:
+			maskToken(tokens[i], value, mask)
+		}
+	}
+
+	for _, span := range r.matches(input) {
+		mask(span[0], span[1])
+	}
+	return string(masked), secrets
+}
+
+// text masks the secrets found by apply, and the matches of the pattern, in a
+// message such as an error suggestion.
+func (r Redaction) text(s string, secrets []string) string {
+	for _, secret := range secrets {
+		if strings.Contains(s, secret) {
+			b := []byte(secret)
+			maskBytes(b)
+			s = strings.ReplaceAll(s, secret, string(b))
+		}
+	}
+	if spans := r.matches(s); len(spans) > 0 {
+		b := []byte(s)
+		for _, span := range spans {
+			maskBytes(b[span[0]:span[1]])
+		}
+		s = string(b)
+	}
+	return s
+}
+
+// matches returns the spans of s the pattern masks: its matches, or what their
+// first group matched.
+func (r Redaction) matches(s string) [][2]int {
+	if r.Pattern == nil {
+		return nil
+	}
+	var spans [][2]int
+	for _, m := range r.Pattern.FindAllStringSubmatchIndex(s, -1) {
+		start, end := m[0], m[1]
+		if len(m) > 2 {
+			start, end = m[2], m[3]
+		}
+		if start < end {
+			spans = append(spans, [2]int{start, end})
+		}
+	}
+	return spans
+}
+
+// maskToken masks a scalar token: the inside of a string, so the quotes keep the
+// payload's shape, or the whole of a number or literal.
+func maskToken(t jsonToken, text string, mask func(start, end int)) {
+	start, end := int(t.Start), int(t.End)
+	if text[0] == '"' {
+		start++
+		if len(text) > 1 && text[len(text)-1] == '"' {
+			end--
+		}
+	}
+	if start < end {
+		mask(start, end)
+	}
+}
+
+// maskBytes masks text in place, character by character, keeping line breaks.
+func maskBytes(b []byte) {
+	for i := 0; i < len(b); {
+		r, size := utf8.DecodeRune(b[i:])
+		if r != '\n' && r != '\r' {
+			if r == utf8.RuneError && size == 1 {
+				b[i] = '*'
+			} else {
+				copy(b[i:], masks[size])
+			}
+		}
+		i += size
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import "sync"
+
+// jsonToken is a token of the input by position: its text is input[Start:End].
+// Tokens point into the input instead of copying it, so tokenizing allocates
+// nothing but the slice of tokens, which is pooled. Positions are 32-bit to keep
+// tokens small, which limits inputs to 2 GiB.
+type jsonToken struct {
+	Start, End int32
+	Line       int32 // 1-based, of the token's first byte
+}
+
+func (t jsonToken) text(input string) string { return input[t.Start:t.End] }
+
+// scanTokens appends the tokens of input to dst, splitting it as
+// validation.TokenizeJSONWithLines does: strings run to their closing quote (or
+// the end of the input), each of {}[],: is a token, and anything else runs to the
+// next whitespace or punctuation.
+func scanTokens(input string, dst []jsonToken) []jsonToken {
+	line := int32(1)
+	for i := 0; i < len(input); {
+		start := i
+		switch input[i] {
+		case '\n':
+			line++
+			i++
+			continue
+		case ' ', '\t', '\r':
+			i++
+			continue
+		case '{', '}', '[', ']', ',', ':':
+			i++
+		case '"':
+			startLine := line
+			for i++; i < len(input) && input[i] != '"'; i++ {
+				if input[i] == '\\' && i+1 < len(input) {
+					i++
+				}
+				if input[i] == '\n' {
+					line++
+				}
+			}
+			if i < len(input) {
+				i++ // the closing quote
+			}
+			dst = append(dst, jsonToken{Start: int32(start), End: int32(i), Line: startLine})
+			continue
+		default:
+			for i < len(input) && !isDelimiter(input[i]) {
+				i++
+			}
+		}
+		dst = append(dst, jsonToken{Start: int32(start), End: int32(i), Line: line})
+	}
+	return dst
+}
+
+func isDelimiter(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '{', '}', '[', ']', ',', ':', '"':
+		return true
+	}
+	return false
+}
+
+// maxPooledTokens is the largest token slice kept for reuse, so one huge payload
+// does not pin its tokens' memory for the life of a server.
+const maxPooledTokens = 1 << 21
+
+var tokenPool = sync.Pool{New: func() any { return new([]jsonToken) }}
+
+// tokenize returns the tokens of input in a pooled slice; hand it back with
+// releaseTokens once they are no longer used.
+func tokenize(input string) *[]jsonToken {
+	tokens := tokenPool.Get().(*[]jsonToken)
+	*tokens = scanTokens(input, (*tokens)[:0])
+	return tokens
+}
+
+func releaseTokens(tokens *[]jsonToken) {
+	if cap(*tokens) <= maxPooledTokens {
+		tokenPool.Put(tokens)
+	}
+}
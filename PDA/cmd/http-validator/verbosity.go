@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"protocol-validator/pkg/position"
+)
+
+// verbosity is how much the text format prints. What -v and -vv add goes to stderr,
+// so stdout stays the same for scripts.
+type verbosity int
+
+const (
+	quietOutput   verbosity = iota // -q: the summary line only
+	normalOutput                   // the errors and the summary line
+	verboseOutput                  // -v: also stage timings and payload statistics
+	traceOutput                    // -vv: also every token with the PDA stack after it
+)
+
+// verbosityLevel reads -q, -v, and -vv; -q cannot be combined with the others.
+func verbosityLevel(quiet, verbose, trace bool) (verbosity, error) {
+	switch {
+	case quiet && (verbose || trace):
+		return 0, fmt.Errorf("-q cannot be combined with -v or -vv")
+	case quiet:
+		return quietOutput, nil
+	case trace:
+		return traceOutput, nil
+	case verbose:
+		return verboseOutput, nil
+	}
+	return normalOutput, nil
+}
+
+func addVerbosityFlags() (quiet, verbose, trace *bool) {
+	return flag.Bool("q", false, "print the summary line only"),
+		flag.Bool("v", false, "also print stage timings and payload statistics on stderr"),
+		flag.Bool("vv", false, "like -v, and trace every token with the PDA stack on stderr")
+}
+
+// stageTimer records how long the stages of a run took, for -v.
+type stageTimer struct {
+	started, last time.Time
+	stages        []string
+}
+
+func newStageTimer() *stageTimer {
+	now := time.Now()
+	return &stageTimer{started: now, last: now}
+}
+
+// done ends a stage, which started when the one before it ended.
+func (t *stageTimer) done(stage string) {
+	now := time.Now()
+	t.stages = append(t.stages, fmt.Sprintf("%s %s", stage, now.Sub(t.last).Round(time.Microsecond)))
+	t.last = now
+}
+
+func (t *stageTimer) print() {
+	fmt.Fprintf(os.Stderr, "timing: %s, total %s\n", strings.Join(t.stages, ", "), time.Since(t.started).Round(time.Microsecond))
+}
+
+// printStats prints the shape of a payload that is valid JSON, for -v.
+func printStats(stats PayloadStats) {
+	fmt.Fprintf(os.Stderr, "stats: depth %d at %s; %d objects, %d arrays, %d keys, %d strings, %d numbers, %d booleans, %d nulls\n",
+		stats.MaxDepth, stats.DeepestPath, stats.Objects, stats.Arrays, stats.Keys, stats.Strings, stats.Numbers, stats.Booleans, stats.Nulls)
+}
+
+// traceTokens prints every token of the input at its line and column with the PDA
+// stack after it, for -vv. Invalid payloads are traced too, up to the end of the
+// input, so the trace shows where the stack stopped matching.
+func traceTokens(input string, tokens []jsonToken) {
+	index := position.NewIndex(input)
+	var stack []byte
+	for _, t := range tokens {
+		text := t.text(input)
+		switch text {
+		case "{", "[":
+			stack = append(stack, text[0])
+		case "}", "]":
+			if n := len(stack); n > 0 && stack[n-1] == text[0]-2 { // '{'+2 is '}', '['+2 is ']'
+				stack = stack[:n-1]
+			}
+		}
+		if runes := []rune(text); len(runes) > 40 {
+			text = string(runes[:37]) + "..."
+		}
+		pos := index.Locate(int(t.Start))
+		fmt.Fprintf(os.Stderr, "trace: %-8s %-40s stack %s\n", fmt.Sprintf("%d:%d", pos.Line, pos.Column), text, stack)
+	}
+}
@@ -0,0 +1,101 @@
+// Package position converts byte offsets of an input to lines, columns, and rune
+// offsets. An Index is built once per input in one pass, after which each lookup is
+// a binary search, so reporting many errors of a large input stays cheap.
+package position
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Position is where an offset is in the input.
+type Position struct {
+	Line       int // 1-based
+	Column     int // 1-based, in runes
+	ByteOffset int
+	RuneOffset int
+}
+
+// checkpointEvery is how many bytes apart rune counts are recorded within a line,
+// so lookups in long lines, such as minified JSON, decode at most this many bytes.
+const checkpointEvery = 256
+
+// checkpoint is the rune offset of a byte offset where a rune starts.
+type checkpoint struct {
+	byteOffset, runeOffset int
+}
+
+// Index maps the offsets of one input.
+type Index struct {
+	input       string
+	lines       []checkpoint // the start of each line
+	checkpoints []checkpoint // line starts, and rune starts every checkpointEvery bytes
+}
+
+// NewIndex indexes input. Runes are decoded as utf8.DecodeRuneInString does, so
+// each byte of an invalid sequence counts as one rune.
+func NewIndex(input string) *Index {
+	ix := &Index{input: input}
+	runes := 0
+	for start := 0; ; {
+		line := checkpoint{start, runes}
+		ix.lines = append(ix.lines, line)
+		ix.checkpoints = append(ix.checkpoints, line)
+		n := strings.IndexByte(input[start:], '\n')
+		end := len(input)
+		if n >= 0 {
+			end = start + n + 1
+		}
+		// A rune starts at any byte utf8.RuneStart accepts, as no valid sequence
+		// holds one past its first byte, so rune counts can be taken in chunks
+		for i := start; i < end; {
+			next := min(i+checkpointEvery, end)
+			for next < end && !utf8.RuneStart(input[next]) {
+				next++
+			}
+			runes += utf8.RuneCountInString(input[i:next])
+			if i = next; i < end {
+				ix.checkpoints = append(ix.checkpoints, checkpoint{i, runes})
+			}
+		}
+		if n < 0 {
+			return ix
+		}
+		start = end
+	}
+}
+
+// Locate returns the position of a byte offset. Offsets past the end are clamped
+// to it, and offsets inside a multi-byte character are moved back to its first
+// byte.
+func (ix *Index) Locate(byteOffset int) Position {
+	byteOffset = min(max(byteOffset, 0), len(ix.input))
+	line := sort.Search(len(ix.lines), func(i int) bool { return ix.lines[i].byteOffset > byteOffset }) - 1
+	c := ix.checkpoints[sort.Search(len(ix.checkpoints), func(i int) bool { return ix.checkpoints[i].byteOffset > byteOffset })-1]
+	i, runes := c.byteOffset, c.runeOffset
+	for i < byteOffset {
+		_, size := utf8.DecodeRuneInString(ix.input[i:])
+		if i+size > byteOffset {
+			byteOffset = i // inside this character
+			break
+		}
+		i += size
+		runes++
+	}
+	return Position{
+		Line:       line + 1,
+		Column:     runes - ix.lines[line].runeOffset + 1,
+		ByteOffset: byteOffset,
+		RuneOffset: runes,
+	}
+}
+
+// Line returns the 1-based line of a byte offset.
+func (ix *Index) Line(byteOffset int) int {
+	byteOffset = min(max(byteOffset, 0), len(ix.input))
+	return sort.Search(len(ix.lines), func(i int) bool { return ix.lines[i].byteOffset > byteOffset })
+}
+
+// Lines is the number of lines of the input: one more than its newlines.
+func (ix *Index) Lines() int { return len(ix.lines) }